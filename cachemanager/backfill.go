@@ -0,0 +1,111 @@
+package cachemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"github.com/QuantumCoinProject/qc/log"
+)
+
+var BackfillKey = "backfill-%s" //%s is the name of the backfilled data
+
+// backfillDeleteLimit is the number of stale keys deleted with each indexed
+// block before backfilled data is rebuilt.
+const backfillDeleteLimit = 10000
+
+// backfillState is the progress of rebuilding data that was added to the cache,
+// or whose layout changed, after blocks were indexed. It is written with the
+// batch of an indexed block, so that rolling the block back also rolls back the
+// progress made with it. The data is complete once Version is the version the
+// relay expects.
+type backfillState struct {
+	Version uint64 `json:"version"`
+	Cleared bool   `json:"cleared,omitempty"` // Stale data was deleted
+	Block   uint64 `json:"block,omitempty"`   // Last block replayed
+	Key     string `json:"key,omitempty"`     // Last key visited
+}
+
+func getBackfillKey(name string) []byte {
+	return []byte(fmt.Sprintf(BackfillKey, name))
+}
+
+// getBackfillState returns the progress of a backfill. Data without a stored
+// state was built before it was versioned, and is rebuilt from scratch.
+func (c *CacheManager) getBackfillState(name string) (*backfillState, error) {
+	key := getBackfillKey(name)
+	has, err := c.cacheDb.Has(key)
+	if err != nil {
+		return nil, err
+	}
+	if has == false {
+		return &backfillState{}, nil
+	}
+	blob, err := c.cacheDb.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	var state backfillState
+	if err := json.Unmarshal(blob, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (c *CacheManager) putBackfillState(name string, state *backfillState, batch *ethdb.Batch) error {
+	blob, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return (*batch).Put(getBackfillKey(name), blob)
+}
+
+// isBackfilled reports whether the data of a backfill is complete.
+func (c *CacheManager) isBackfilled(name string, version uint64) (bool, error) {
+	state, err := c.getBackfillState(name)
+	if err != nil {
+		return false, err
+	}
+	return state.Version == version, nil
+}
+
+// initBackfills marks the backfilled data of a new cache as complete, since it
+// is built along with the first indexed blocks.
+func (c *CacheManager) initBackfills() error {
+	batch := c.cacheDb.NewBatch()
+	for name, version := range map[string]uint64{
+		TokenBalancesBackfill:  TokenBalancesVersion,
+		SupplyBalancesBackfill: SupplyBalancesVersion,
+	} {
+		if err := c.putBackfillState(name, &backfillState{Version: version}, &batch); err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
+// deleteStaleKeys deletes up to limit keys starting with the given prefixes,
+// and returns the number of keys deleted.
+func (c *CacheManager) deleteStaleKeys(prefixes []string, limit int, batch *ethdb.Batch) (int, error) {
+	deleted := 0
+	for _, prefix := range prefixes {
+		it := c.cacheDb.NewIterator([]byte(prefix), nil)
+		for deleted < limit && it.Next() {
+			if err := (*batch).Delete(common.CopyBytes(it.Key())); err != nil {
+				it.Release()
+				return deleted, err
+			}
+			deleted++
+		}
+		err := it.Error()
+		it.Release()
+		if err != nil {
+			log.Error("deleteStaleKeys", "error", err, "prefix", prefix)
+			return deleted, err
+		}
+		if deleted == limit {
+			break
+		}
+	}
+	return deleted, nil
+}
@@ -7,13 +7,17 @@ import (
 	"fmt"
 	"github.com/QuantumCoinProject/qc/common"
 	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/consensus/proofofstake"
 	"github.com/QuantumCoinProject/qc/core"
 	"github.com/QuantumCoinProject/qc/core/rawdb"
 	"github.com/QuantumCoinProject/qc/core/types"
 	"github.com/QuantumCoinProject/qc/ethclient"
 	"github.com/QuantumCoinProject/qc/ethdb"
+	"github.com/QuantumCoinProject/qc/event"
 	"github.com/QuantumCoinProject/qc/log"
 	"github.com/QuantumCoinProject/qc/params"
+	"github.com/QuantumCoinProject/qc/relay/upstream"
+	"github.com/QuantumCoinProject/qc/rpc"
 	"github.com/QuantumCoinProject/qc/token"
 	"io/ioutil"
 	"math/big"
@@ -28,17 +32,22 @@ import (
 
 type CacheManager struct {
 	cacheDir                 string
-	nodeUrl                  string
+	upstreams                *upstream.Pool
 	cacheLock                sync.Mutex
 	cacheDb                  ethdb.Database
-	client                   *ethclient.Client
-	pendingTxClient          *ethclient.Client
 	enableExtendedApis       bool
+	indexInternalTxs         bool
 	genesisCirculatingSupply string
+	genesisAccounts          []common.Address
 	maxSupply                string
 	pendingTxLock            sync.Mutex
 	pendingTxMapLock         sync.RWMutex
 	pendingTransactions      *map[string]map[string]map[string]*ethclient.TxPoolTransaction
+	metrics                  *indexerMetrics
+	eventFeed                event.Feed
+	eventQueue               chan *Event
+	pendingTxHashes          map[common.Hash]bool
+	webhooks                 *webhookManager
 }
 
 var SummaryKey = "summary"
@@ -66,6 +75,7 @@ const (
 	TOKEN_TRANSFER     TransactionType = "TokenTransfer"
 	NEW_SMART_CONTRACT TransactionType = "NewSmartContract"
 	SMART_CONTRACT     TransactionType = "SmartContract"
+	INTERNAL_TRANSFER  TransactionType = "InternalTransfer"
 )
 
 type TokenDetails struct {
@@ -101,6 +111,8 @@ type AccountTransactionCompact struct {
 	Status string `json:"status,omitempty"`
 
 	TransactionType string `json:"transactionType,omitempty"`
+
+	TokenAddress string `json:"tokenAddress,omitempty"`
 }
 
 type ListAccountTransactionsResponse struct {
@@ -142,11 +154,13 @@ type GetBlockchainDetailsResponse struct {
 	BlockchainDetails
 }
 
-func NewCacheManager(cacheDir string, nodeUrl string, enableExtendedApis bool, genesisFilePath string, maxSupply string) (*CacheManager, error) {
+func NewCacheManager(cacheDir string, upstreams *upstream.Pool, enableExtendedApis bool, indexInternalTxs bool, genesisFilePath string, maxSupply string) (*CacheManager, error) {
 	cManager := &CacheManager{
-		nodeUrl:            nodeUrl,
+		upstreams:          upstreams,
 		cacheDir:           cacheDir,
 		enableExtendedApis: enableExtendedApis,
+		indexInternalTxs:   indexInternalTxs,
+		metrics:            newIndexerMetrics(),
 	}
 
 	var err error
@@ -177,11 +191,15 @@ func NewCacheManager(cacheDir string, nodeUrl string, enableExtendedApis bool, g
 
 		genesisCirculatingSupply := big.NewInt(0)
 		if genesis.Alloc != nil {
-			for _, v := range genesis.Alloc {
+			for k, v := range genesis.Alloc {
 				genesisCirculatingSupply = common.SafeAddBigInt(genesisCirculatingSupply, v.Balance)
+				cManager.genesisAccounts = append(cManager.genesisAccounts, k)
 			}
 		}
 		cManager.genesisCirculatingSupply = hexutil.EncodeBig(genesisCirculatingSupply)
+		if indexInternalTxs == false {
+			log.Warn("Internal transactions are not indexed, the balance index misses coins sent by contracts and supply responses are flagged incomplete")
+		}
 		log.Error("genesis genesisCirculatingSupply", "genesisCirculatingSupply", params.WeiToEther(genesisCirculatingSupply), "maxSupply", params.WeiToEther(maxSupplyBig))
 	}
 
@@ -190,6 +208,14 @@ func NewCacheManager(cacheDir string, nodeUrl string, enableExtendedApis bool, g
 		return nil, err
 	}
 
+	cManager.webhooks, err = newWebhookManager(cManager.cacheDb)
+	if err != nil {
+		return nil, err
+	}
+	cManager.webhooks.start(&cManager.eventFeed)
+	cManager.eventQueue = make(chan *Event, eventQueueSize)
+	go cManager.eventLoop()
+
 	err = cManager.start()
 	if err != nil {
 		return nil, err
@@ -199,7 +225,7 @@ func NewCacheManager(cacheDir string, nodeUrl string, enableExtendedApis bool, g
 }
 
 func (c *CacheManager) initialize() error {
-	log.Info("Quantum Coin initialize cache manager", "cacheDir", c.cacheDir, "nodeUrl", c.nodeUrl)
+	log.Info("Quantum Coin initialize cache manager", "cacheDir", c.cacheDir, "nodeUrls", c.upstreams.Urls())
 
 	catchManagerFilePath := filepath.Join(c.cacheDir, "cacheManager.db")
 	catchManager, err := rawdb.NewLevelDBDatabase(catchManagerFilePath, 64, 0, "", false)
@@ -208,25 +234,15 @@ func (c *CacheManager) initialize() error {
 	}
 	c.cacheDb = catchManager
 
-	client, err := ethclient.Dial(c.nodeUrl)
-	if err != nil {
+	err = c.withNodeClient(func(client *ethclient.Client) (err error) {
+		chainID, err = client.NetworkID(context.Background())
 		return err
-	}
-
-	pendingTxClient, err := ethclient.Dial(c.nodeUrl)
-	if err != nil {
-		return err
-	}
-
-	chainID, err = client.NetworkID(context.Background())
+	})
 	if err != nil {
 		log.Error("initialize NetworkID", "error", err)
 		return err
 	}
 
-	c.client = client
-	c.pendingTxClient = pendingTxClient
-
 	return nil
 }
 
@@ -244,19 +260,12 @@ func (c *CacheManager) start() error {
 		if err.Error() == "leveldb: not found" {
 			log.Warn("First time start")
 			blockNumber = 0
+			if err := c.initBackfills(); err != nil {
+				log.Error("initBackfills", "err", err.Error())
+				return err
+			}
 			if c.enableExtendedApis {
-				runningSummary = &BlockchainDetails{
-					BlockNumber:           0,
-					MaxSupply:             c.maxSupply,
-					TotalSupply:           c.genesisCirculatingSupply,
-					CirculatingSupply:     c.genesisCirculatingSupply,
-					BurntCoins:            "0x0",
-					BlockRewardsCoins:     "0x0",
-					BaseBlockRewardsCoins: "0x0",
-					TxnFeeRewardsCoins:    "0x0",
-					TxnFeeBurntCoins:      "0x0",
-					SlashedCoins:          "0x0",
-				}
+				runningSummary = c.newSummary()
 			}
 		} else {
 			log.Error("GetLastBlockByDb", "err", err.Error())
@@ -281,18 +290,21 @@ func (c *CacheManager) start() error {
 			case <-cacheTimer.C:
 				go c.processPendingTransactions()
 
-				blockNumberToGet := blockNumber + 1
-				log.Info("Batch Start ", "Block Number ", blockNumberToGet)
-				err := c.processByCacheManager(blockNumberToGet, runningSummary)
+				log.Info("Batch Start ", "Block Number ", blockNumber+1)
+				blockNumber, err = c.indexBlocks(blockNumber, runningSummary)
 				if err == nil {
-					blockNumber = blockNumberToGet
-					log.Info("Batch Complete", "Block number", blockNumberToGet)
 					delayNumber = 0
+				} else if errors.Is(err, errNoUndoData) {
+					// The reorg goes back further than the undo records kept, so
+					// the cache cannot follow the node any more. Retrying would
+					// fail the same way.
+					log.Error("Reorg deeper than the rollback window, indexing stopped; rebuild the cache", "error", err, "maxReorgDepth", MaxReorgDepth)
+					continue
 				} else {
 					if err.Error() == "not found" {
-						log.Info("Waiting for Block...", "Block number", blockNumberToGet)
+						log.Info("Waiting for Block...", "Block number", blockNumber+1)
 					} else {
-						log.Error("Batch Error", "error", err.Error(), "Block number", blockNumberToGet)
+						log.Error("Batch Error", "error", err.Error(), "Block number", blockNumber+1)
 					}
 					delayNumber = int64(5 * time.Second)
 				}
@@ -314,11 +326,30 @@ func (c *CacheManager) start() error {
 	return nil
 }
 
+func (c *CacheManager) newSummary() *BlockchainDetails {
+	return &BlockchainDetails{
+		BlockNumber:           0,
+		MaxSupply:             c.maxSupply,
+		TotalSupply:           c.genesisCirculatingSupply,
+		CirculatingSupply:     c.genesisCirculatingSupply,
+		BurntCoins:            "0x0",
+		BlockRewardsCoins:     "0x0",
+		BaseBlockRewardsCoins: "0x0",
+		TxnFeeRewardsCoins:    "0x0",
+		TxnFeeBurntCoins:      "0x0",
+		SlashedCoins:          "0x0",
+	}
+}
+
 func (c *CacheManager) processPendingTransactions() {
 	c.pendingTxLock.Lock()
 	defer c.pendingTxLock.Unlock()
 
-	err, txnList := c.pendingTxClient.TxPoolContent(context.Background())
+	var txnList *map[string]map[string]map[string]*ethclient.TxPoolTransaction
+	err := c.withNodeClient(func(client *ethclient.Client) (err error) {
+		err, txnList = client.TxPoolContent(context.Background())
+		return err
+	})
 	if err != nil {
 		log.Error("processPendingTransactions", "err", err)
 		return
@@ -329,25 +360,32 @@ func (c *CacheManager) processPendingTransactions() {
 		return
 	}
 
-	c.pendingTxMapLock.Lock()
-	defer c.pendingTxMapLock.Unlock()
+	events, pending := pendingEvents(*txnList, c.pendingTxHashes)
+	c.pendingTxHashes = pending
 
+	c.pendingTxMapLock.Lock()
 	c.pendingTransactions = txnList
+	c.pendingTxMapLock.Unlock()
+
+	c.sendEvents(events)
 }
 
-func (c *CacheManager) processByCacheManager(blockNumber uint64, runningSummary *BlockchainDetails) error {
+// processByCacheManager indexes a fetched block. All changes are written in one
+// batch, along with the undo record to roll the block back.
+func (c *CacheManager) processByCacheManager(fetched *fetchedBlock, runningSummary *BlockchainDetails) error {
+	block := fetched.block
+	blockNumber := fetched.number
 	blockNum := new(big.Int).SetUint64(blockNumber)
-	block, err := c.client.BlockByNumber(context.Background(), blockNum)
+
+	journal := newJournalBatch(c.cacheDb)
+	var txnBatch ethdb.Batch = journal
+	blockKey := []byte(LastBlockKey)
+	err := txnBatch.Put(blockKey, common.Uint64ToBytes(blockNumber))
 	if err != nil {
-		if err.Error() != "not found" {
-			log.Error("BlockByNumber", "error", err)
-		}
+		log.Error("processByCacheManager txnBatch.Put", "error", err)
 		return err
 	}
-
-	txnBatch := c.cacheDb.NewBatch()
-	blockKey := []byte(LastBlockKey)
-	err = txnBatch.Put(blockKey, common.Uint64ToBytes(blockNumber))
+	err = txnBatch.Put(getBlockHashKey(blockNumber), block.Hash().Bytes())
 	if err != nil {
 		log.Error("processByCacheManager txnBatch.Put", "error", err)
 		return err
@@ -357,16 +395,13 @@ func (c *CacheManager) processByCacheManager(blockNumber uint64, runningSummary
 	liveAccountMap = make(map[string][]AccountTransactionCompact)
 
 	tokensCreated := make([]*TokenDetails, 0)
+	blockTokenTransfers := make([]*tokenTransfer, 0)
 
-	var receipts types.Receipts
-	receipts = make(types.Receipts, len(block.Transactions()))
+	if len(fetched.receipts) != len(block.Transactions()) {
+		return errors.New("processByCacheManager unexpected receipt count")
+	}
 	for i, tx := range block.Transactions() {
-		receipt, err := c.client.TransactionReceipt(context.Background(), tx.Hash())
-		if err != nil {
-			log.Error("processByCacheManager TransactionReceipt", "error", err)
-			return err
-		}
-		receipts[i] = receipt
+		receipt := fetched.receipts[i]
 
 		msg, err := tx.AsMessage(types.NewLondonSigner(chainID))
 		if err != nil {
@@ -428,6 +463,29 @@ func (c *CacheManager) processByCacheManager(blockNumber uint64, runningSummary
 				liveAccountMap[toAddress] = append(liveAccountMap[toAddress], transaction)
 			}
 		}
+
+		transfers := tokenTransfers(receipt)
+		blockTokenTransfers = append(blockTokenTransfers, transfers...)
+		for _, transfer := range transfers {
+			tokenTransaction := transaction
+			tokenTransaction.From = strings.ToLower(transfer.from.Hex())
+			tokenTransaction.To = strings.ToLower(transfer.to.Hex())
+			tokenTransaction.Value = common.BigIntToHexString(transfer.value)
+			tokenTransaction.TransactionType = string(TOKEN_TRANSFER)
+			tokenTransaction.TokenAddress = strings.ToLower(transfer.contract.Hex())
+			addAccountTransaction(liveAccountMap, tokenTransaction, tokenTransaction.From, tokenTransaction.To)
+		}
+
+		if fetched.internalTxs != nil {
+			for _, transfer := range internalTransfers(fetched.internalTxs[i]) {
+				internalTransaction := transaction
+				internalTransaction.From = transfer.from
+				internalTransaction.To = transfer.to
+				internalTransaction.Value = common.BigIntToHexString(transfer.value)
+				internalTransaction.TransactionType = string(INTERNAL_TRANSFER)
+				addAccountTransaction(liveAccountMap, internalTransaction, transfer.from, transfer.to)
+			}
+		}
 	}
 
 	//First store new tokens before processing account transactions!
@@ -439,6 +497,17 @@ func (c *CacheManager) processByCacheManager(blockNumber uint64, runningSummary
 		}
 	}
 
+	blockTokenTransfers, err = c.backfillTokenTransfers(blockNumber, blockTokenTransfers, c.fetchTokenTransfers, &txnBatch)
+	if err != nil {
+		log.Error("backfillTokenTransfers", "error", err)
+		return err
+	}
+	err = c.processTokenBalances(blockTokenTransfers, &txnBatch)
+	if err != nil {
+		log.Error("processTokenBalances", "error", err)
+		return err
+	}
+
 	for k, v := range liveAccountMap {
 		err = c.processAccountTransactions(k, &v, &txnBatch)
 		if err != nil {
@@ -448,23 +517,51 @@ func (c *CacheManager) processByCacheManager(blockNumber uint64, runningSummary
 	}
 
 	if c.enableExtendedApis {
-		err = c.updateSummary(blockNum, runningSummary, &txnBatch)
+		err = c.updateSummary(blockNum, fetched.consensusData, fetched.burntCoins, runningSummary, &txnBatch)
 		if err != nil {
 			log.Error("updateSummary", "error", err)
 			return err
 		}
+
+		err = c.putBlockStaking(block, fetched.consensusData, &txnBatch)
+		if err != nil {
+			log.Error("putBlockStaking", "error", err)
+			return err
+		}
+
+		if fetched.validators != nil {
+			err = c.putValidators(blockNumber, fetched.validators, &txnBatch)
+			if err != nil {
+				log.Error("putValidators", "error", err)
+				return err
+			}
+		}
+
+		balances, backfilled, err := c.backfillBalances(blockNumber, fetched.balances, c.fetchAccountBalances, &txnBatch)
+		if err != nil {
+			log.Error("backfillBalances", "error", err)
+			return err
+		}
+
+		err = c.updateSupply(block, balances, fetched.validators, liveAccountMap, runningSummary, backfilled && c.indexInternalTxs, &txnBatch)
+		if err != nil {
+			log.Error("updateSupply", "error", err)
+			return err
+		}
 	}
 
-	err = txnBatch.Write()
+	err = journal.commit(blockNumber)
 	if err != nil {
 		log.Error("processByCacheManager txnBatch Write", "error", err)
 		return err
 	}
 
+	c.sendEvents(blockEvents(block, liveAccountMap))
+
 	return nil
 }
 
-func (c *CacheManager) updateSummary(blockNumber *big.Int, runningSummary *BlockchainDetails, batch *ethdb.Batch) error {
+func (c *CacheManager) updateSummary(blockNumber *big.Int, consensusData *proofofstake.ConsensusData, burntCoinsWei *big.Int, runningSummary *BlockchainDetails, batch *ethdb.Batch) error {
 
 	leftBlock := blockNumber.Uint64()
 	rightBlock := runningSummary.BlockNumber + 1
@@ -473,11 +570,11 @@ func (c *CacheManager) updateSummary(blockNumber *big.Int, runningSummary *Block
 		return errors.New("updateSummary unexpected blockNumber")
 	}
 
-	consensusData, err := c.client.GetBlockConsensusData(context.Background(), blockNumber)
-	if err != nil {
-		return err
+	if consensusData == nil || burntCoinsWei == nil {
+		return errors.New("updateSummary missing block rewards info")
 	}
 
+	var err error
 	txnBatch := *batch
 	blockRewardsInfo := consensusData.BlockRewardsInfo
 
@@ -560,13 +657,7 @@ func (c *CacheManager) updateSummary(blockNumber *big.Int, runningSummary *Block
 		runningSummary.SlashedCoins = hexutil.EncodeBig(common.SafeAddBigInt(slashedCoinsBig, slashAmount))
 	}
 
-	//Get latest burnt coins info
-	burntCoinsWei, err := c.client.BalanceAt(context.Background(), common.ZERO_ADDRESS, blockNumber)
-	if err != nil {
-		log.Error("updateSummary BalanceAt", "error", err)
-		return err
-	}
-
+	//Latest burnt coins info
 	runningSummary.BurntCoins = hexutil.EncodeBig(burntCoinsWei)
 	genesisCirculatingSupplyBig, _ := hexutil.DecodeBig(c.genesisCirculatingSupply)
 	blockRewardsCoinsBig, _ := hexutil.DecodeBig(runningSummary.BlockRewardsCoins)
@@ -583,14 +674,40 @@ func (c *CacheManager) updateSummary(blockNumber *big.Int, runningSummary *Block
 	return nil
 }
 
-func (c *CacheManager) latestBlockByNode() (uint64, error) {
+// withNodeClient calls fn with a client of the healthiest upstream node, and
+// again with a client of the next one if the node fails. Calls that have to be
+// answered by the same node should be made within the same fn.
+func (c *CacheManager) withNodeClient(fn func(client *ethclient.Client) error) error {
+	return c.upstreams.Failover(context.Background(), func(client *rpc.Client) error {
+		return fn(ethclient.NewClient(client))
+	})
+}
 
-	client, err := ethclient.Dial(c.nodeUrl)
-	if err != nil {
-		return 0, err
+// tokenDetails reads the details of a token contract from the node. A contract
+// that is not a token is an answer of the node rather than a failure, so the
+// other upstreams are not asked.
+func (c *CacheManager) tokenDetails(contract common.Address, blockNumber *big.Int) (*token.TokenDetails, error) {
+	var details *token.TokenDetails
+	err := c.withNodeClient(func(client *ethclient.Client) (err error) {
+		details, err = client.GetTokenDetails(contract, blockNumber)
+		if err == token.NotATokenError {
+			return nil
+		}
+		return err
+	})
+	if err == nil && details == nil {
+		return nil, token.NotATokenError
 	}
+	return details, err
+}
 
-	latestBlock, err := client.BlockNumber(context.Background())
+func (c *CacheManager) latestBlockByNode() (uint64, error) {
+
+	var latestBlock uint64
+	err := c.withNodeClient(func(client *ethclient.Client) (err error) {
+		latestBlock, err = client.BlockNumber(context.Background())
+		return err
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -646,10 +763,16 @@ func (c *CacheManager) putSummary(summary *BlockchainDetails, batch *ethdb.Batch
 	return nil
 }
 
+// Database returns the cache database, in which the api keys of the read relay
+// are kept as well.
+func (c *CacheManager) Database() ethdb.Database {
+	return c.cacheDb
+}
+
 func (c *CacheManager) close() error {
 	c.pendingTxLock.Lock()
 	defer c.pendingTxLock.Unlock()
-	c.pendingTxClient.Close()
+	c.webhooks.stop()
 
 	cacheDb := c.cacheDb
 	err := cacheDb.Close()
@@ -658,7 +781,6 @@ func (c *CacheManager) close() error {
 		return err
 	}
 
-	c.client.Close()
 	return nil
 }
 
@@ -962,7 +1084,7 @@ func (c *CacheManager) getTransactionType(from string, txn *types.Transaction, r
 	if txn.To() == nil {
 		if receipt.Status == 1 { //success
 			if receipt.ContractAddress.IsEqualTo(common.ZERO_ADDRESS) == false {
-				tok, err := c.client.GetTokenDetails(receipt.ContractAddress, receipt.BlockNumber)
+				tok, err := c.tokenDetails(receipt.ContractAddress, receipt.BlockNumber)
 				if err != nil {
 					if err == token.NotATokenError {
 						return NEW_SMART_CONTRACT, nil, nil
@@ -0,0 +1,555 @@
+package cachemanager
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/consensus/proofofstake"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/ethclient"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"github.com/QuantumCoinProject/qc/log"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var AccountStakingKey = "account-staking-%s-%020d"  //%s is account address, %d is block number
+var AccountStakingKeyPrefix = "account-staking-%s-" //%s is account address
+
+// Entry types of account exports, besides the transaction types.
+const (
+	BLOCK_REWARD TransactionType = "BlockReward"
+	SLASHING     TransactionType = "Slashing"
+)
+
+const (
+	ExportFormatCsv        = "csv"
+	ExportFormatJsonLines  = "jsonl"
+	ExportAssetCoin        = "QC"
+	ExportAssetStaking     = "staking"
+	ExportDateLayout       = "2006-01-02" // Layout of the dates of export queries
+	exportCoinDecimals     = 18
+	exportDirectionIn      = "in"
+	exportDirectionOut     = "out"
+	exportDirectionSelf    = "self"
+	exportStatusSuccess    = "success"
+	exportStatusFailed     = "failed"
+	exportCancelCheckCount = 1000
+)
+
+var (
+	ErrExportRange  = errors.New("invalid export range")
+	ErrExportFormat = errors.New("invalid export format")
+)
+
+// accountStakingEntry is a block reward or a slashing of a validator, stored for
+// the validator and for its depositor.
+type accountStakingEntry struct {
+	BlockNumber uint64          `json:"blockNumber"`
+	CreatedAt   string          `json:"createdAt"`
+	Type        TransactionType `json:"type"`
+	Validator   string          `json:"validator"`
+	Amount      string          `json:"amount"`
+}
+
+// ExportQuery selects the blocks of an account export. Dates are UTC days and
+// both ends are included.
+type ExportQuery struct {
+	FromBlock *uint64
+	ToBlock   *uint64
+	FromDate  *time.Time
+	ToDate    *time.Time
+}
+
+// ExportRange is the block range of an account export. Only blocks that can no
+// longer be rolled back are exported, so that the same range always returns the
+// same entries.
+type ExportRange struct {
+	FromBlock  uint64 `json:"fromBlock"`
+	ToBlock    uint64 `json:"toBlock"`
+	FinalBlock uint64 `json:"finalBlock"`
+}
+
+// ExportEntry is a line of an account export. Value, fee and balance are
+// decimal, in units of the asset; fee is only set when the account paid it.
+// Balance is the balance of the asset after the entry; for the staking asset it
+// is the sum of the rewards less the slashings of the account.
+type ExportEntry struct {
+	BlockNumber     uint64 `json:"blockNumber"`
+	CreatedAt       string `json:"createdAt"`
+	Hash            string `json:"hash"`
+	TransactionType string `json:"transactionType"`
+	Status          string `json:"status"`
+	From            string `json:"from"`
+	To              string `json:"to"`
+	Asset           string `json:"asset"`
+	Symbol          string `json:"symbol"`
+	Direction       string `json:"direction"`
+	Value           string `json:"value"`
+	Fee             string `json:"fee"`
+	Balance         string `json:"balance"`
+}
+
+var exportColumns = []string{"blockNumber", "createdAt", "hash", "transactionType", "status", "from", "to", "asset", "symbol", "direction", "value", "fee", "balance"}
+
+func (e *ExportEntry) record() []string {
+	return []string{strconv.FormatUint(e.BlockNumber, 10), e.CreatedAt, e.Hash, e.TransactionType, e.Status, e.From, e.To, e.Asset, e.Symbol, e.Direction, e.Value, e.Fee, e.Balance}
+}
+
+// ExportWriter writes export entries as CSV, with a header line, or as JSON
+// lines.
+type ExportWriter struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+func NewExportWriter(w io.Writer, format string) (*ExportWriter, error) {
+	switch format {
+	case ExportFormatCsv:
+		writer := &ExportWriter{csv: csv.NewWriter(w)}
+		if err := writer.csv.Write(exportColumns); err != nil {
+			return nil, err
+		}
+		return writer, nil
+	case ExportFormatJsonLines:
+		return &ExportWriter{json: json.NewEncoder(w)}, nil
+	}
+	return nil, ErrExportFormat
+}
+
+func (w *ExportWriter) Write(entry *ExportEntry) error {
+	if w.csv != nil {
+		return w.csv.Write(entry.record())
+	}
+	return w.json.Encode(entry)
+}
+
+func (w *ExportWriter) Flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	return nil
+}
+
+// FormatUnits formats an amount of the smallest unit of an asset as a decimal
+// number, without trailing zeros.
+func FormatUnits(amount *big.Int, decimals uint64) string {
+	digits := new(big.Int).Abs(amount).String()
+	sign := ""
+	if amount.Sign() < 0 {
+		sign = "-"
+	}
+	if decimals == 0 {
+		return sign + digits
+	}
+	if uint64(len(digits)) <= decimals {
+		digits = strings.Repeat("0", int(decimals)-len(digits)+1) + digits
+	}
+	point := len(digits) - int(decimals)
+	fraction := strings.TrimRight(digits[point:], "0")
+	if len(fraction) == 0 {
+		return sign + digits[:point]
+	}
+	return sign + digits[:point] + "." + fraction
+}
+
+func getAccountStakingKey(address string, blockNumber uint64) []byte {
+	return []byte(fmt.Sprintf(AccountStakingKey, address, blockNumber))
+}
+
+// putAccountStaking stores the block reward and the slashings of a block for
+// the validators and their depositors, for account exports.
+func (c *CacheManager) putAccountStaking(block *types.Block, rewards *proofofstake.BlockRewardsInfo, proposer common.Address, batch *ethdb.Batch) error {
+	txnBatch := *batch
+	if rewards == nil {
+		return nil
+	}
+	createdAt := time.Unix(int64(block.Time()), 0).UTC().Format(TimeLayout)
+	entries := make(map[string][]accountStakingEntry)
+	add := func(validator common.Address, entryType TransactionType, amount string) error {
+		value, err := hexutil.DecodeBig(amount)
+		if err != nil || value.Sign() == 0 {
+			return err
+		}
+		address := strings.ToLower(validator.Hex())
+		entry := accountStakingEntry{BlockNumber: block.NumberU64(), CreatedAt: createdAt, Type: entryType, Validator: address, Amount: amount}
+		entries[address] = append(entries[address], entry)
+
+		key := getStakingValidatorKey(address)
+		has, err := c.cacheDb.Has(key)
+		if err != nil || has == false {
+			return err
+		}
+		depositor, err := c.cacheDb.Get(key)
+		if err != nil {
+			return err
+		}
+		if string(depositor) != address {
+			entries[string(depositor)] = append(entries[string(depositor)], entry)
+		}
+		return nil
+	}
+
+	if len(rewards.BlockProposerRewards) > 0 {
+		if err := add(proposer, BLOCK_REWARD, rewards.BlockProposerRewards); err != nil {
+			return err
+		}
+	}
+	for _, slashing := range rewards.SlashedValidators {
+		if err := add(slashing.SlashedValidator, SLASHING, slashing.SlashedAmount); err != nil {
+			return err
+		}
+	}
+	for address, list := range entries {
+		blob, err := json.Marshal(list)
+		if err != nil {
+			return err
+		}
+		if err := txnBatch.Put(getAccountStakingKey(address, block.NumberU64()), blob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolveExportRange returns the block range of an export query. The range ends
+// at most MaxReorgDepth blocks before the last indexed block.
+func (c *CacheManager) ResolveExportRange(ctx context.Context, query ExportQuery) (ExportRange, error) {
+	if has, err := c.cacheDb.Has([]byte(LastBlockKey)); err != nil || has == false {
+		return ExportRange{}, ErrExportRange
+	}
+	lastBlock, err := c.getLastBlockNumberByDb(LastBlockKey)
+	if err != nil {
+		return ExportRange{}, err
+	}
+	var final uint64
+	if lastBlock > MaxReorgDepth {
+		final = lastBlock - MaxReorgDepth
+	}
+
+	r := ExportRange{FromBlock: 0, ToBlock: final, FinalBlock: final}
+	if query.FromBlock != nil {
+		r.FromBlock = *query.FromBlock
+	}
+	if query.ToBlock != nil && *query.ToBlock < r.ToBlock {
+		r.ToBlock = *query.ToBlock
+	}
+	if query.FromDate != nil && r.FromBlock <= r.ToBlock {
+		first, err := c.firstBlockAtOrAfter(ctx, query.FromDate.UTC(), r.FromBlock, r.ToBlock)
+		if err != nil {
+			return ExportRange{}, err
+		}
+		r.FromBlock = first
+	}
+	if query.ToDate != nil && r.FromBlock <= r.ToBlock {
+		next, err := c.firstBlockAtOrAfter(ctx, query.ToDate.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1), r.FromBlock, r.ToBlock)
+		if err != nil {
+			return ExportRange{}, err
+		}
+		if next == 0 {
+			return ExportRange{}, ErrExportRange
+		}
+		r.ToBlock = next - 1
+	}
+	if r.FromBlock > r.ToBlock {
+		return ExportRange{}, ErrExportRange
+	}
+	return r, nil
+}
+
+// firstBlockAtOrAfter returns the first block between low and high with a time
+// at or after t, or high+1 if there is none.
+func (c *CacheManager) firstBlockAtOrAfter(ctx context.Context, t time.Time, low uint64, high uint64) (uint64, error) {
+	var first uint64
+	err := c.withNodeClient(func(client *ethclient.Client) error {
+		first = low
+		end := high + 1
+		for first < end {
+			mid := first + (end-first)/2
+			header, err := client.HeaderByNumber(ctx, new(big.Int).SetUint64(mid))
+			if err != nil {
+				return err
+			}
+			if int64(header.Time) >= t.Unix() {
+				end = mid
+			} else {
+				first = mid + 1
+			}
+		}
+		return nil
+	})
+	return first, err
+}
+
+// ExportAccount writes the history of an account in an export range, oldest
+// first: its transactions, token transfers and internal transfers, and the
+// block rewards and slashings of its validator, with running balances. The
+// coin balance starts from the balance at the block before the range, read from
+// the node.
+func (c *CacheManager) ExportAccount(ctx context.Context, accountAddress common.Address, r ExportRange, write func(*ExportEntry) error) error {
+	var openingBlock uint64
+	if r.FromBlock > 0 {
+		openingBlock = r.FromBlock - 1
+	}
+	var opening *big.Int
+	err := c.withNodeClient(func(client *ethclient.Client) (err error) {
+		opening, err = client.BalanceAt(ctx, accountAddress, new(big.Int).SetUint64(openingBlock))
+		return err
+	})
+	if err != nil {
+		log.Error("ExportAccount BalanceAt", "error", err)
+		return err
+	}
+	return c.exportAccount(ctx, strings.ToLower(accountAddress.Hex()), r, opening, write)
+}
+
+type exportToken struct {
+	symbol   string
+	decimals uint64
+}
+
+// exportState holds the running balances of an export.
+type exportState struct {
+	address   string
+	fromBlock uint64
+	balances  map[string]*big.Int // asset to balance
+	tokens    map[string]*exportToken
+}
+
+func (c *CacheManager) exportToken(state *exportState, contract string, blockNumber uint64) *exportToken {
+	if token, ok := state.tokens[contract]; ok {
+		return token
+	}
+	token := &exportToken{}
+	if details, err := c.GetTokenDetails(contract); err == nil {
+		token.symbol = details.Result.Symbol
+		token.decimals, _ = hexutil.DecodeUint64(details.Result.Decimals)
+	} else if c.upstreams != nil {
+		if details, err := c.tokenDetails(common.HexToAddress(contract), new(big.Int).SetUint64(blockNumber)); err == nil {
+			token.symbol = details.Symbol
+			token.decimals = uint64(details.Decimals)
+		} else {
+			log.Warn("ExportAccount token details not found", "contract", contract, "error", err)
+		}
+	}
+	state.tokens[contract] = token
+	return token
+}
+
+func (state *exportState) balance(asset string) *big.Int {
+	if balance, ok := state.balances[asset]; ok {
+		return balance
+	}
+	balance := new(big.Int)
+	state.balances[asset] = balance
+	return balance
+}
+
+// transactionEntry applies a transaction of the account to the running
+// balances. The coin balance of blocks before the range is already in the
+// opening balance.
+func (c *CacheManager) transactionEntry(state *exportState, txn *AccountTransactionCompact) (*ExportEntry, error) {
+	entry := &ExportEntry{
+		BlockNumber:     txn.BlockNumber,
+		CreatedAt:       txn.CreatedAt,
+		Hash:            txn.Hash,
+		TransactionType: txn.TransactionType,
+		From:            txn.From,
+		To:              txn.To,
+		Asset:           ExportAssetCoin,
+		Symbol:          ExportAssetCoin,
+		Status:          exportStatusSuccess,
+	}
+	if txn.Status != "0x1" {
+		entry.Status = exportStatusFailed
+	}
+	decimals := uint64(exportCoinDecimals)
+	if len(txn.TokenAddress) > 0 {
+		token := c.exportToken(state, txn.TokenAddress, txn.BlockNumber)
+		entry.Asset, entry.Symbol, decimals = txn.TokenAddress, token.symbol, token.decimals
+	}
+
+	outgoing, incoming := txn.From == state.address, txn.To == state.address
+	switch {
+	case outgoing && incoming:
+		entry.Direction = exportDirectionSelf
+	case outgoing:
+		entry.Direction = exportDirectionOut
+	default:
+		entry.Direction = exportDirectionIn
+	}
+
+	value, err := hexutil.DecodeBig(txn.Value)
+	if err != nil {
+		return nil, err
+	}
+	delta := new(big.Int)
+	if entry.Status == exportStatusSuccess {
+		if outgoing {
+			delta.Sub(delta, value)
+		}
+		if incoming {
+			delta.Add(delta, value)
+		}
+	}
+	// Token and internal transfers repeat the fee of their transaction, which is
+	// only paid once, by the sender of the transaction
+	fee := new(big.Int)
+	if outgoing && len(txn.TokenAddress) == 0 && txn.TransactionType != string(INTERNAL_TRANSFER) && len(txn.TxnFee) > 0 {
+		if fee, err = hexutil.DecodeBig(txn.TxnFee); err != nil {
+			return nil, err
+		}
+		delta.Sub(delta, fee)
+	}
+
+	if entry.Asset != ExportAssetCoin || txn.BlockNumber >= state.fromBlock {
+		balance := state.balance(entry.Asset)
+		balance.Add(balance, delta)
+	}
+	entry.Value = FormatUnits(value, decimals)
+	entry.Fee = FormatUnits(fee, exportCoinDecimals)
+	entry.Balance = FormatUnits(state.balance(entry.Asset), decimals)
+	return entry, nil
+}
+
+func (c *CacheManager) stakingEntry(state *exportState, staking *accountStakingEntry) (*ExportEntry, error) {
+	amount, err := hexutil.DecodeBig(staking.Amount)
+	if err != nil {
+		return nil, err
+	}
+	entry := &ExportEntry{
+		BlockNumber:     staking.BlockNumber,
+		CreatedAt:       staking.CreatedAt,
+		TransactionType: string(staking.Type),
+		Status:          exportStatusSuccess,
+		Asset:           ExportAssetStaking,
+		Symbol:          ExportAssetCoin,
+		Value:           FormatUnits(amount, exportCoinDecimals),
+		Fee:             "0",
+	}
+	balance := state.balance(ExportAssetStaking)
+	if staking.Type == SLASHING {
+		entry.From, entry.Direction = staking.Validator, exportDirectionOut
+		balance.Sub(balance, amount)
+	} else {
+		entry.To, entry.Direction = staking.Validator, exportDirectionIn
+		balance.Add(balance, amount)
+	}
+	entry.Balance = FormatUnits(balance, exportCoinDecimals)
+	return entry, nil
+}
+
+// accountTransactions returns the function that returns the transactions of
+// an account one at a time, oldest first, and nil after the last one.
+func (c *CacheManager) accountTransactions(address string) (func() (*AccountTransactionCompact, error), error) {
+	txnCount, err := c.getAccountTxnCount(address)
+	if err != nil {
+		return nil, err
+	}
+	pageCount := getPageCount(txnCount)
+	var page []AccountTransactionCompact
+	var pageNumber uint64
+	return func() (*AccountTransactionCompact, error) {
+		for len(page) == 0 {
+			if pageNumber == pageCount {
+				return nil, nil
+			}
+			pageNumber++
+			blob, err := c.cacheDb.Get(getAccountPageKey(address, pageNumber))
+			if err != nil {
+				return nil, err
+			}
+			var list AccountTransactionList
+			if err := json.Unmarshal(blob, &list); err != nil {
+				return nil, err
+			}
+			page = list.Transactions
+		}
+		// Pages hold the newest transaction first
+		txn := page[len(page)-1]
+		page = page[:len(page)-1]
+		return &txn, nil
+	}, nil
+}
+
+func (c *CacheManager) exportAccount(ctx context.Context, address string, r ExportRange, opening *big.Int, write func(*ExportEntry) error) error {
+	state := &exportState{
+		address:   address,
+		fromBlock: r.FromBlock,
+		balances:  map[string]*big.Int{ExportAssetCoin: new(big.Int).Set(opening)},
+		tokens:    make(map[string]*exportToken),
+	}
+
+	nextTxn, err := c.accountTransactions(address)
+	if err != nil {
+		return err
+	}
+	it := c.cacheDb.NewIterator([]byte(fmt.Sprintf(AccountStakingKeyPrefix, address)), nil)
+	defer it.Release()
+	var stakingEntries []accountStakingEntry
+	nextStaking := func() (*accountStakingEntry, error) {
+		for len(stakingEntries) == 0 {
+			if it.Next() == false {
+				return nil, it.Error()
+			}
+			if err := json.Unmarshal(it.Value(), &stakingEntries); err != nil {
+				return nil, err
+			}
+		}
+		entry := stakingEntries[0]
+		stakingEntries = stakingEntries[1:]
+		return &entry, nil
+	}
+
+	txn, err := nextTxn()
+	if err != nil {
+		return err
+	}
+	staking, err := nextStaking()
+	if err != nil {
+		return err
+	}
+	for count := 1; ; count++ {
+		if count%exportCancelCheckCount == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var entry *ExportEntry
+		// Rewards and slashings are applied after the transactions of the block
+		if txn != nil && (staking == nil || txn.BlockNumber <= staking.BlockNumber) {
+			if txn.BlockNumber > r.ToBlock {
+				return nil
+			}
+			if entry, err = c.transactionEntry(state, txn); err != nil {
+				return err
+			}
+			if txn, err = nextTxn(); err != nil {
+				return err
+			}
+		} else if staking != nil {
+			if staking.BlockNumber > r.ToBlock {
+				return nil
+			}
+			if entry, err = c.stakingEntry(state, staking); err != nil {
+				return err
+			}
+			if staking, err = nextStaking(); err != nil {
+				return err
+			}
+		} else {
+			return nil
+		}
+		if entry.BlockNumber >= r.FromBlock {
+			if err := write(entry); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package cachemanager
+
+import (
+	"bytes"
+	"context"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/consensus/proofofstake"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestFormatUnits(t *testing.T) {
+	tests := []struct {
+		amount   string
+		decimals uint64
+		want     string
+	}{
+		{"0", 18, "0"},
+		{"1500000000000000000", 18, "1.5"},
+		{"1", 18, "0.000000000000000001"},
+		{"-250", 2, "-2.5"},
+		{"42", 0, "42"},
+		{"1000", 3, "1"},
+	}
+	for _, test := range tests {
+		amount, _ := new(big.Int).SetString(test.amount, 10)
+		if got := FormatUnits(amount, test.decimals); got != test.want {
+			t.Errorf("FormatUnits(%s, %d) = %s, want %s", test.amount, test.decimals, got, test.want)
+		}
+	}
+}
+
+func TestExportAccount(t *testing.T) {
+	c := &CacheManager{cacheDb: rawdb.NewMemoryDatabase(), metrics: newIndexerMetrics()}
+	account := strings.ToLower(common.BytesToAddress([]byte{0x01}).Hex())
+	other := strings.ToLower(common.BytesToAddress([]byte{0x02}).Hex())
+	validator := common.BytesToAddress([]byte{0x01, 0xff})
+	token := strings.ToLower(common.BytesToAddress([]byte{0x10}).Hex())
+
+	applyBatch(t, c, 1, func(batch *ethdb.Batch) error {
+		if err := c.putTokenInDb(&TokenDetails{ContractAddress: token, Symbol: "TKN", Decimals: "0x2"}, batch); err != nil {
+			return err
+		}
+		if err := (*batch).Put(getStakingValidatorKey(strings.ToLower(validator.Hex())), []byte(account)); err != nil {
+			return err
+		}
+		return c.putAccountTxnCount(account, 0, batch)
+	})
+	ether := "0xde0b6b3a7640000"
+	txns := []AccountTransactionCompact{
+		{Hash: "0x01", BlockNumber: 2, From: other, To: account, Value: ether, TxnFee: "0x1", Status: "0x1", TransactionType: string(COIN_TRANSFER)},
+		{Hash: "0x02", BlockNumber: 3, From: account, To: other, Value: ether, TxnFee: "0x2", Status: "0x0", TransactionType: string(COIN_TRANSFER)},
+		{Hash: "0x03", BlockNumber: 4, From: account, To: token, Value: "0x0", TxnFee: "0x3", Status: "0x1", TransactionType: string(SMART_CONTRACT)},
+		{Hash: "0x03", BlockNumber: 4, From: other, To: account, Value: "0x96", TxnFee: "0x3", Status: "0x1", TransactionType: string(TOKEN_TRANSFER), TokenAddress: token},
+	}
+	// More than a page of transactions, to read several pages
+	for i := uint64(0); i < PageSize; i++ {
+		txns = append(txns, AccountTransactionCompact{Hash: "0x04", BlockNumber: 5 + i, From: other, To: account, Value: "0x1", TxnFee: "0x1", Status: "0x1", TransactionType: string(COIN_TRANSFER)})
+	}
+	for _, txn := range txns {
+		list := []AccountTransactionCompact{txn}
+		applyBatch(t, c, txn.BlockNumber, func(batch *ethdb.Batch) error {
+			return c.processAccountTransactions(account, &list, batch)
+		})
+	}
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(4), Time: 1700000000})
+	rewards := &proofofstake.BlockRewardsInfo{BlockProposerRewards: "0x64"}
+	applyBatch(t, c, 4, func(batch *ethdb.Batch) error {
+		return c.putAccountStaking(block, rewards, validator, batch)
+	})
+
+	export := func(r ExportRange, opening int64) []*ExportEntry {
+		entries := make([]*ExportEntry, 0)
+		err := c.exportAccount(context.Background(), account, r, big.NewInt(opening), func(entry *ExportEntry) error {
+			entries = append(entries, entry)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return entries
+	}
+
+	entries := export(ExportRange{FromBlock: 0, ToBlock: 4}, 0)
+	want := []struct {
+		hash, asset, direction, value, fee, balance string
+	}{
+		{"0x01", ExportAssetCoin, exportDirectionIn, "1", "0", "1"},
+		{"0x02", ExportAssetCoin, exportDirectionOut, "1", "0.000000000000000002", "0.999999999999999998"},
+		{"0x03", ExportAssetCoin, exportDirectionOut, "0", "0.000000000000000003", "0.999999999999999995"},
+		{"0x03", token, exportDirectionIn, "1.5", "0", "1.5"},
+		{"", ExportAssetStaking, exportDirectionIn, "0.0000000000000001", "0", "0.0000000000000001"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("%d entries, want %d", len(entries), len(want))
+	}
+	for i, w := range want {
+		e := entries[i]
+		if e.Hash != w.hash || e.Asset != w.asset || e.Direction != w.direction || e.Value != w.value || e.Fee != w.fee || e.Balance != w.balance {
+			t.Errorf("entry %d: %+v, want %+v", i, e, w)
+		}
+	}
+	if entries[1].Status != exportStatusFailed || entries[3].Symbol != "TKN" || entries[4].TransactionType != string(BLOCK_REWARD) {
+		t.Fatalf("unexpected entries %+v %+v %+v", entries[1], entries[3], entries[4])
+	}
+
+	// The coin balance starts from the opening balance, the token and staking
+	// balances from the earlier entries
+	entries = export(ExportRange{FromBlock: 5, ToBlock: 100}, 1000000000000000000)
+	if len(entries) != int(PageSize) {
+		t.Fatalf("%d entries, want %d", len(entries), PageSize)
+	}
+	if last := entries[len(entries)-1]; last.BlockNumber != 4+PageSize || last.Balance != "1.00000000000000002" {
+		t.Fatalf("unexpected last entry %+v", last)
+	}
+
+	var buf bytes.Buffer
+	writer, err := NewExportWriter(&buf, ExportFormatCsv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Write(entries[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || lines[0] != strings.Join(exportColumns, ",") || strings.HasPrefix(lines[1], "5,") == false {
+		t.Fatalf("unexpected csv %q", buf.String())
+	}
+	if _, err := NewExportWriter(&buf, "xml"); err != ErrExportFormat {
+		t.Fatalf("unexpected error %v, want %v", err, ErrExportFormat)
+	}
+}
@@ -0,0 +1,414 @@
+package cachemanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ethereum "github.com/QuantumCoinProject/qc"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/consensus/proofofstake"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/ethclient"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/metrics"
+	"github.com/QuantumCoinProject/qc/rlp"
+	"math/big"
+	"time"
+)
+
+var BlockHashKey = "block-hash-%d" //%d is block number
+var BlockUndoKey = "block-undo-%d" //%d is block number
+
+const (
+	// IndexerRangeSize is the maximum number of blocks fetched in one indexing round.
+	IndexerRangeSize uint64 = 64
+
+	// IndexerWorkers is the number of blocks fetched from the node concurrently.
+	IndexerWorkers = 8
+
+	// MaxReorgDepth is the number of most recent blocks that can be rolled back.
+	// Undo records of older blocks are deleted.
+	MaxReorgDepth uint64 = 128
+
+	// receiptBatchSize is the maximum number of receipts requested in one batch call.
+	receiptBatchSize = 100
+)
+
+var (
+	errBlockChanged = errors.New("block changed while being fetched")
+	errNoUndoData   = errors.New("no undo data to roll back block")
+)
+
+// indexerMetrics are the progress metrics of the cache indexer. They are created
+// with the cache manager so that the relay can enable metrics before.
+type indexerMetrics struct {
+	indexed   metrics.Gauge // Last indexed block number
+	head      metrics.Gauge // Head block number of the node
+	lag       metrics.Gauge // Blocks the cache is behind the node
+	blocks    metrics.Meter // Indexed blocks
+	rollbacks metrics.Meter // Blocks rolled back because of reorgs
+	fetch     metrics.Timer // Time to fetch a block and its receipts
+	commit    metrics.Timer // Time to index a fetched block
+
+	droppedEvents metrics.Meter // Events dropped because the event queue was full
+	tokenClamps   metrics.Meter // Token balances that went negative and were clamped to zero
+}
+
+func newIndexerMetrics() *indexerMetrics {
+	return &indexerMetrics{
+		indexed:   metrics.GetOrRegisterGauge("relay/indexer/block", nil),
+		head:      metrics.GetOrRegisterGauge("relay/indexer/head", nil),
+		lag:       metrics.GetOrRegisterGauge("relay/indexer/lag", nil),
+		blocks:    metrics.GetOrRegisterMeter("relay/indexer/blocks", nil),
+		rollbacks: metrics.GetOrRegisterMeter("relay/indexer/rollbacks", nil),
+		fetch:     metrics.GetOrRegisterTimer("relay/indexer/fetch", nil),
+		commit:    metrics.GetOrRegisterTimer("relay/indexer/commit", nil),
+
+		droppedEvents: metrics.GetOrRegisterMeter("relay/events/dropped", nil),
+		tokenClamps:   metrics.GetOrRegisterMeter("relay/tokens/clamped", nil),
+	}
+}
+
+// undoEntry is the value of a cache key before a block was indexed.
+type undoEntry struct {
+	Key    []byte
+	Value  []byte
+	Exists bool
+}
+
+// journalBatch is a batch that records the previous value of every key it
+// changes, so that the changes of an indexed block can be reverted.
+type journalBatch struct {
+	ethdb.Batch
+	db   ethdb.KeyValueReader
+	undo []undoEntry
+	seen map[string]bool
+	err  error
+}
+
+func newJournalBatch(db ethdb.Database) *journalBatch {
+	return &journalBatch{
+		Batch: db.NewBatch(),
+		db:    db,
+		seen:  make(map[string]bool),
+	}
+}
+
+func (b *journalBatch) record(key []byte) {
+	if b.seen[string(key)] {
+		return
+	}
+	b.seen[string(key)] = true
+
+	entry := undoEntry{Key: common.CopyBytes(key)}
+	exists, err := b.db.Has(key)
+	if err != nil {
+		b.err = err
+		return
+	}
+	if exists {
+		value, err := b.db.Get(key)
+		if err != nil {
+			b.err = err
+			return
+		}
+		entry.Value, entry.Exists = value, true
+	}
+	b.undo = append(b.undo, entry)
+}
+
+// Put implements ethdb.KeyValueWriter, recording the previous value of the key.
+func (b *journalBatch) Put(key []byte, value []byte) error {
+	b.record(key)
+	return b.Batch.Put(key, value)
+}
+
+// Delete implements ethdb.KeyValueWriter, recording the previous value of the key.
+func (b *journalBatch) Delete(key []byte) error {
+	b.record(key)
+	return b.Batch.Delete(key)
+}
+
+// Reset implements ethdb.Batch, also dropping the recorded values.
+func (b *journalBatch) Reset() {
+	b.Batch.Reset()
+	b.undo, b.seen, b.err = nil, make(map[string]bool), nil
+}
+
+// commit stores the undo record of the block along with its changes and writes
+// the batch. The undo record of the block falling out of the reorg window is
+// deleted.
+func (b *journalBatch) commit(blockNumber uint64) error {
+	if b.err != nil {
+		return b.err
+	}
+	blob, err := rlp.EncodeToBytes(b.undo)
+	if err != nil {
+		return err
+	}
+	if err := b.Batch.Put(getBlockUndoKey(blockNumber), blob); err != nil {
+		return err
+	}
+	if blockNumber > MaxReorgDepth {
+		if err := b.Batch.Delete(getBlockUndoKey(blockNumber - MaxReorgDepth)); err != nil {
+			return err
+		}
+	}
+	return b.Batch.Write()
+}
+
+func getBlockHashKey(blockNumber uint64) []byte {
+	return []byte(fmt.Sprintf(BlockHashKey, blockNumber))
+}
+
+func getBlockUndoKey(blockNumber uint64) []byte {
+	return []byte(fmt.Sprintf(BlockUndoKey, blockNumber))
+}
+
+// getIndexedBlockHash returns the hash of an indexed block, or false if the block
+// was indexed before block hashes were recorded.
+func (c *CacheManager) getIndexedBlockHash(blockNumber uint64) (common.Hash, bool) {
+	blob, err := c.cacheDb.Get(getBlockHashKey(blockNumber))
+	if err != nil {
+		return common.Hash{}, false
+	}
+	return common.BytesToHash(blob), true
+}
+
+// rollbackBlock reverts the cache to the state before the block was indexed.
+func (c *CacheManager) rollbackBlock(blockNumber uint64) error {
+	blob, err := c.cacheDb.Get(getBlockUndoKey(blockNumber))
+	if err != nil {
+		return fmt.Errorf("%w %d", errNoUndoData, blockNumber)
+	}
+	var undo []undoEntry
+	if err := rlp.DecodeBytes(blob, &undo); err != nil {
+		return err
+	}
+
+	batch := c.cacheDb.NewBatch()
+	for i := len(undo) - 1; i >= 0; i-- {
+		if undo[i].Exists {
+			err = batch.Put(undo[i].Key, undo[i].Value)
+		} else {
+			err = batch.Delete(undo[i].Key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := batch.Delete(getBlockUndoKey(blockNumber)); err != nil {
+		return err
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	c.metrics.rollbacks.Mark(1)
+	log.Warn("Rolled back block", "Block number", blockNumber, "keys", len(undo))
+	return nil
+}
+
+// fetchedBlock is a block with everything needed to index it.
+type fetchedBlock struct {
+	number        uint64
+	block         *types.Block
+	receipts      types.Receipts
+	consensusData *proofofstake.ConsensusData
+	burntCoins    *big.Int
+	internalTxs   []*ethclient.InternalTransactionDetails // Call traces aligned with the transactions, if enabled
+	validators    []*proofofstake.ValidatorDetails        // Validator list at the block, if it was refreshed
+	balances      map[string]*big.Int                     // Coin balances of the accounts touched in the block, if enabled
+	err           error
+	done          chan struct{}
+}
+
+func (c *CacheManager) fetchBlock(client *ethclient.Client, blockNumber uint64) (*types.Block, types.Receipts, *proofofstake.ConsensusData, *big.Int, error) {
+	start := time.Now()
+	defer c.metrics.fetch.UpdateSince(start)
+
+	ctx := context.Background()
+	blockNum := new(big.Int).SetUint64(blockNumber)
+	block, err := client.BlockByNumber(ctx, blockNum)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	receipts, err := fetchReceipts(ctx, client, block)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	if c.enableExtendedApis == false {
+		return block, receipts, nil, nil, nil
+	}
+	consensusData, err := client.GetBlockConsensusData(ctx, blockNum)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	burntCoins, err := client.BalanceAt(ctx, common.ZERO_ADDRESS, blockNum)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return block, receipts, consensusData, burntCoins, nil
+}
+
+// fetchReceipts fetches the receipts of the transactions of a block, in batches
+// of receiptBatchSize.
+func fetchReceipts(ctx context.Context, client *ethclient.Client, block *types.Block) (types.Receipts, error) {
+	txs := block.Transactions()
+	receipts := make(types.Receipts, 0, len(txs))
+	for i := 0; i < len(txs); i += receiptBatchSize {
+		end := i + receiptBatchSize
+		if end > len(txs) {
+			end = len(txs)
+		}
+		hashes := make([]common.Hash, 0, end-i)
+		for _, tx := range txs[i:end] {
+			hashes = append(hashes, tx.Hash())
+		}
+		batch, err := client.TransactionReceipts(ctx, hashes)
+		if err != nil {
+			return nil, err
+		}
+		for _, receipt := range batch {
+			if receipt.BlockHash.IsEqualTo(block.Hash()) == false {
+				return nil, errBlockChanged
+			}
+		}
+		receipts = append(receipts, batch...)
+	}
+	return receipts, nil
+}
+
+// fetchSlot fetches a block and the data indexed along with it. All of it is
+// read from the same node, so that it comes from the same view of the chain.
+func (c *CacheManager) fetchSlot(client *ethclient.Client, slot *fetchedBlock) error {
+	var err error
+	slot.block, slot.receipts, slot.consensusData, slot.burntCoins, err = c.fetchBlock(client, slot.number)
+	if err == nil && c.indexInternalTxs {
+		slot.internalTxs, err = c.traceInternalTransactions(client, slot.block.Transactions(), slot.receipts)
+	}
+	if err == nil && c.enableExtendedApis && c.needsValidatorRefresh(slot.block, slot.consensusData) {
+		slot.validators, err = client.ListValidators(context.Background(), new(big.Int).SetUint64(slot.number))
+	}
+	if err == nil && c.enableExtendedApis {
+		slot.balances, err = c.fetchBalances(client, slot)
+	}
+	return err
+}
+
+// fetchRange fetches the blocks from..to concurrently. The returned slots are
+// in block order and each is closed once its block is fetched. Fetching stops
+// when abort is closed.
+func (c *CacheManager) fetchRange(from uint64, to uint64, abort chan struct{}) []*fetchedBlock {
+	slots := make([]*fetchedBlock, 0, to-from+1)
+	jobs := make(chan *fetchedBlock, to-from+1)
+	for number := from; number <= to; number++ {
+		slot := &fetchedBlock{number: number, done: make(chan struct{})}
+		slots = append(slots, slot)
+		jobs <- slot
+	}
+	close(jobs)
+
+	workers := IndexerWorkers
+	if len(slots) < workers {
+		workers = len(slots)
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for slot := range jobs {
+				select {
+				case <-abort:
+					slot.err = errors.New("aborted")
+				default:
+					// A block is fetched from one node, and again from the next
+					// one if the node fails
+					slot.err = c.withNodeClient(func(client *ethclient.Client) error {
+						return c.fetchSlot(client, slot)
+					})
+				}
+				close(slot.done)
+			}
+		}()
+	}
+	return slots
+}
+
+// indexBlocks fetches and indexes the blocks after lastBlock, up to the head of
+// the node, and returns the new last indexed block. If a block does not build on
+// the indexed one, the indexed block is rolled back instead, so that the next
+// call moves to the new canonical chain.
+func (c *CacheManager) indexBlocks(lastBlock uint64, runningSummary *BlockchainDetails) (uint64, error) {
+	var head uint64
+	err := c.withNodeClient(func(client *ethclient.Client) (err error) {
+		head, err = client.BlockNumber(context.Background())
+		return err
+	})
+	if err != nil {
+		return lastBlock, err
+	}
+	c.metrics.head.Update(int64(head))
+	if head <= lastBlock {
+		c.metrics.lag.Update(0)
+		return lastBlock, ethereum.NotFound
+	}
+	to := head
+	if to-lastBlock > IndexerRangeSize {
+		to = lastBlock + IndexerRangeSize
+	}
+
+	abort := make(chan struct{})
+	defer close(abort)
+	for _, slot := range c.fetchRange(lastBlock+1, to, abort) {
+		<-slot.done
+		if slot.err != nil {
+			return lastBlock, slot.err
+		}
+
+		if indexedHash, ok := c.getIndexedBlockHash(lastBlock); ok && indexedHash.IsEqualTo(slot.block.ParentHash()) == false {
+			log.Warn("Reorg detected", "Block number", slot.number, "parentHash", slot.block.ParentHash(), "indexedHash", indexedHash)
+			if err := c.rollbackBlock(lastBlock); err != nil {
+				return lastBlock, err
+			}
+			c.sendEvents([]*Event{blockRemovedEvent(lastBlock, indexedHash)})
+			if c.enableExtendedApis {
+				if err := c.reloadSummary(runningSummary); err != nil {
+					return lastBlock - 1, err
+				}
+			}
+			return lastBlock - 1, nil
+		}
+
+		start := time.Now()
+		if err := c.processByCacheManager(slot, runningSummary); err != nil {
+			if c.enableExtendedApis {
+				if reloadErr := c.reloadSummary(runningSummary); reloadErr != nil {
+					log.Error("reloadSummary", "error", reloadErr)
+				}
+			}
+			return lastBlock, err
+		}
+		c.metrics.commit.UpdateSince(start)
+		c.metrics.blocks.Mark(1)
+		c.metrics.indexed.Update(int64(slot.number))
+		c.metrics.lag.Update(int64(head - slot.number))
+		lastBlock = slot.number
+	}
+	log.Info("Batch Complete", "Block number", lastBlock, "head", head)
+	return lastBlock, nil
+}
+
+// reloadSummary replaces the running summary with the one in the cache, after
+// blocks were rolled back.
+func (c *CacheManager) reloadSummary(runningSummary *BlockchainDetails) error {
+	summary, err := c.getSummaryFromDb()
+	if err != nil {
+		if err.Error() != "leveldb: not found" {
+			return err
+		}
+		summary = c.newSummary()
+	}
+	*runningSummary = *summary
+	return nil
+}
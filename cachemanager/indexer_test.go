@@ -0,0 +1,339 @@
+package cachemanager
+
+import (
+	"bytes"
+	"errors"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/consensus/proofofstake"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/crypto/cryptobase"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"github.com/QuantumCoinProject/qc/internal/ethapi"
+	"github.com/QuantumCoinProject/qc/relay/upstream"
+	"github.com/QuantumCoinProject/qc/rpc"
+	"github.com/QuantumCoinProject/qc/trie"
+	"math/big"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// applyBatch indexes the changes made by apply as the block number, with the
+// journal batch used by the indexer, so that they can be rolled back.
+func applyBatch(t *testing.T, c *CacheManager, number uint64, apply func(batch *ethdb.Batch) error) {
+	journal := newJournalBatch(c.cacheDb)
+	var batch ethdb.Batch = journal
+	if err := apply(&batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := journal.commit(number); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJournalBatchRollback(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	c := &CacheManager{cacheDb: db, metrics: newIndexerMetrics()}
+
+	db.Put([]byte("changed"), []byte("old"))
+	db.Put([]byte("deleted"), []byte("gone"))
+
+	batch := newJournalBatch(db)
+	batch.Put([]byte("changed"), []byte("new"))
+	batch.Put([]byte("changed"), []byte("newer"))
+	batch.Put([]byte("added"), []byte("value"))
+	batch.Delete([]byte("deleted"))
+	if err := batch.commit(5); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := db.Get([]byte("changed")); !bytes.Equal(value, []byte("newer")) {
+		t.Fatalf("unexpected value %q after commit", value)
+	}
+
+	if err := c.rollbackBlock(5); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := db.Get([]byte("changed")); !bytes.Equal(value, []byte("old")) {
+		t.Fatalf("changed key not restored: %q", value)
+	}
+	if value, _ := db.Get([]byte("deleted")); !bytes.Equal(value, []byte("gone")) {
+		t.Fatalf("deleted key not restored: %q", value)
+	}
+	if has, _ := db.Has([]byte("added")); has {
+		t.Fatal("added key not removed")
+	}
+	if err := c.rollbackBlock(5); !errors.Is(err, errNoUndoData) {
+		t.Fatalf("unexpected error %v, want %v", err, errNoUndoData)
+	}
+}
+
+func TestJournalBatchPrune(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	for number := uint64(1); number <= MaxReorgDepth+1; number++ {
+		batch := newJournalBatch(db)
+		batch.Put([]byte(LastBlockKey), []byte{byte(number)})
+		if err := batch.commit(number); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if has, _ := db.Has(getBlockUndoKey(1)); has {
+		t.Fatal("undo record outside of the reorg window not deleted")
+	}
+	if has, _ := db.Has(getBlockUndoKey(2)); !has {
+		t.Fatal("undo record within the reorg window deleted")
+	}
+}
+
+// testNode serves a chain over rpc with the methods used by the indexer. The
+// chain can be replaced to simulate a reorg.
+type testNode struct {
+	lock     sync.Mutex
+	chain    []*types.Block // Indexed by block number, from the genesis block
+	receipts map[common.Hash]*types.Receipt
+}
+
+func (n *testNode) setChain(chain []*types.Block, receipts map[common.Hash]*types.Receipt) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.chain, n.receipts = chain, receipts
+}
+
+type testEthApi struct{ node *testNode }
+
+func (api *testEthApi) BlockNumber() hexutil.Uint64 {
+	api.node.lock.Lock()
+	defer api.node.lock.Unlock()
+	return hexutil.Uint64(len(api.node.chain) - 1)
+}
+
+func (api *testEthApi) GetBlockByNumber(number rpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
+	api.node.lock.Lock()
+	defer api.node.lock.Unlock()
+	if number < 0 || int(number) >= len(api.node.chain) {
+		return nil, nil
+	}
+	return ethapi.RPCMarshalBlock(api.node.chain[number], true, fullTx)
+}
+
+func (api *testEthApi) GetTransactionReceipt(hash common.Hash) (*types.Receipt, error) {
+	api.node.lock.Lock()
+	defer api.node.lock.Unlock()
+	return api.node.receipts[hash], nil
+}
+
+func (api *testEthApi) GetBalance(address common.Address, number rpc.BlockNumber) (*hexutil.Big, error) {
+	return (*hexutil.Big)(big.NewInt(0)), nil
+}
+
+type testProofOfStakeApi struct{}
+
+func (api *testProofOfStakeApi) GetBlockConsensusData(number rpc.BlockNumber) (*proofofstake.ConsensusData, error) {
+	return &proofofstake.ConsensusData{BlockRewardsInfo: &proofofstake.BlockRewardsInfo{BlockProposerRewards: "0x1"}}, nil
+}
+
+func (api *testProofOfStakeApi) ListValidators(number rpc.BlockNumber) ([]*proofofstake.ValidatorDetails, error) {
+	return []*proofofstake.ValidatorDetails{}, nil
+}
+
+// testChain builds the blocks of a test chain and their receipts.
+type testChain struct {
+	blocks   []*types.Block
+	receipts map[common.Hash]*types.Receipt
+}
+
+func newTestChain() *testChain {
+	genesis := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(0), Difficulty: big.NewInt(1)})
+	return &testChain{blocks: []*types.Block{genesis}, receipts: make(map[common.Hash]*types.Receipt)}
+}
+
+// fork returns a copy of the chain up to the block number.
+func (c *testChain) fork(number uint64) *testChain {
+	fork := &testChain{blocks: append([]*types.Block{}, c.blocks[:number+1]...), receipts: make(map[common.Hash]*types.Receipt)}
+	for hash, receipt := range c.receipts {
+		fork.receipts[hash] = receipt
+	}
+	return fork
+}
+
+// add appends a block with the transactions, each emitting the logs at the
+// same index. Blocks with a different seed have different hashes.
+func (c *testChain) add(seed byte, txs []*types.Transaction, logs [][]*types.Log) *types.Block {
+	parent := c.blocks[len(c.blocks)-1]
+	receipts := make([]*types.Receipt, len(txs))
+	for i, tx := range txs {
+		receipts[i] = &types.Receipt{Status: types.ReceiptStatusSuccessful, TxHash: tx.Hash(), GasUsed: tx.Gas(), Logs: append([]*types.Log{}, logs[i]...)}
+		receipts[i].Bloom = types.CreateBloom(types.Receipts{receipts[i]})
+	}
+	block := types.NewBlock(&types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		Difficulty: big.NewInt(1),
+		GasLimit:   10000000,
+		Time:       parent.Time() + 1,
+		Extra:      []byte{seed},
+	}, txs, receipts, trie.NewStackTrie(nil))
+	for i, receipt := range receipts {
+		receipt.BlockHash, receipt.BlockNumber, receipt.TransactionIndex = block.Hash(), block.Number(), uint(i)
+		for _, l := range receipt.Logs {
+			l.BlockHash, l.BlockNumber, l.TxHash, l.TxIndex = block.Hash(), block.NumberU64(), receipt.TxHash, uint(i)
+		}
+		c.receipts[receipt.TxHash] = receipt
+	}
+	c.blocks = append(c.blocks, block)
+	return block
+}
+
+func (c *testChain) addEmpty(seed byte, count int) {
+	for i := 0; i < count; i++ {
+		c.add(seed, nil, nil)
+	}
+}
+
+// Tests that the indexer rolls back the blocks replaced by a reorg, one block
+// per call, and then indexes the new canonical chain.
+func TestIndexBlocksReorg(t *testing.T) {
+	key, err := cryptobase.SigAlg.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainID = big.NewInt(123123)
+	signer := types.NewLondonSigner(chainID)
+	sender := cryptobase.SigAlg.PublicKeyToAddressNoError(&key.PublicKey)
+	alice := common.BytesToAddress([]byte{0x01})
+	bob := common.BytesToAddress([]byte{0x02})
+	token := common.BytesToAddress([]byte{0x10})
+	signTx := func(nonce uint64, to common.Address, data []byte) *types.Transaction {
+		tx, err := types.SignTx(types.NewTransaction(nonce, to, big.NewInt(1), 100000, big.NewInt(1), data), signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx
+	}
+	mint := &types.Log{
+		Address: token,
+		Topics:  []common.Hash{TransferEventTopic, common.BytesToHash(common.ZERO_ADDRESS.Bytes()), common.BytesToHash(bob.Bytes())},
+		Data:    common.LeftPadBytes(big.NewInt(40).Bytes(), 32),
+	}
+
+	// The canonical chain pays alice in block 1 and mints tokens to bob in
+	// block 3
+	chain := newTestChain()
+	chain.add(0, []*types.Transaction{signTx(0, alice, nil)}, [][]*types.Log{nil})
+	chain.addEmpty(0, 1)
+	replaced := chain.add(0, []*types.Transaction{signTx(1, token, []byte{0x01})}, [][]*types.Log{{mint}})
+
+	node := &testNode{}
+	node.setChain(chain.blocks, chain.receipts)
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName("eth", &testEthApi{node}); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegisterName("proofofstake", &testProofOfStakeApi{}); err != nil {
+		t.Fatal(err)
+	}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+	pool, err := upstream.NewPool([]string{httpServer.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// The indexer tells missing keys by the leveldb error
+	db, err := rawdb.NewLevelDBDatabase(t.TempDir(), 16, 16, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	c := &CacheManager{
+		cacheDb:                  db,
+		upstreams:                pool,
+		enableExtendedApis:       true,
+		genesisCirculatingSupply: "0x0",
+		metrics:                  newIndexerMetrics(),
+		eventQueue:               make(chan *Event, 1024),
+	}
+	if err := c.initBackfills(); err != nil {
+		t.Fatal(err)
+	}
+	summary := c.newSummary()
+	lastBlock, err := c.indexBlocks(0, summary)
+	if err != nil || lastBlock != 3 {
+		t.Fatalf("indexed up to %d, %v", lastBlock, err)
+	}
+	if list, err := c.ListTransactionsByAccount(bob, 1); err != nil || len(list.Items) != 1 {
+		t.Fatalf("unexpected transactions of bob %+v, %v", list, err)
+	}
+	if list, err := c.ListTokensByAccount(bob, 1); err != nil || len(list.Items) != 1 {
+		t.Fatalf("unexpected tokens of bob %+v, %v", list, err)
+	}
+
+	// The fork replaces block 3: the block is rolled back first, without
+	// indexing the blocks of the fork
+	fork := chain.fork(2)
+	fork.addEmpty(1, 2)
+	node.setChain(fork.blocks, fork.receipts)
+	for len(c.eventQueue) > 0 {
+		<-c.eventQueue
+	}
+	lastBlock, err = c.indexBlocks(lastBlock, summary)
+	if err != nil || lastBlock != 2 {
+		t.Fatalf("rolled back to %d, %v", lastBlock, err)
+	}
+	if ev := <-c.eventQueue; ev.Type != EVENT_BLOCK_REMOVED || ev.BlockNumber != 3 || ev.BlockHash != replaced.Hash().Hex() {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+	if list, err := c.ListTransactionsByAccount(bob, 1); err != nil || list.PageCount != 0 {
+		t.Fatalf("unexpected transactions of bob after rollback %+v, %v", list, err)
+	}
+	if list, err := c.ListTransactionsByAccount(sender, 1); err != nil || len(list.Items) != 1 || list.Items[0].BlockNumber != 1 {
+		t.Fatalf("unexpected transactions of the sender after rollback %+v, %v", list, err)
+	}
+	if list, err := c.ListTokensByAccount(bob, 1); err != nil || list.PageCount != 0 {
+		t.Fatalf("unexpected tokens of bob after rollback %+v, %v", list, err)
+	}
+	if details, err := c.GetBlockchainDetails(); err != nil || details.BlockNumber != 2 || details.BlockRewardsCoins != "0x2" {
+		t.Fatalf("unexpected summary after rollback %+v, %v", details, err)
+	}
+	if summary.BlockNumber != 2 {
+		t.Fatalf("running summary at block %d, want 2", summary.BlockNumber)
+	}
+
+	lastBlock, err = c.indexBlocks(lastBlock, summary)
+	if err != nil || lastBlock != 4 {
+		t.Fatalf("indexed up to %d, %v", lastBlock, err)
+	}
+	if hash, _ := c.getIndexedBlockHash(3); hash != fork.blocks[3].Hash() {
+		t.Fatalf("block 3 indexed with hash %v, want %v", hash, fork.blocks[3].Hash())
+	}
+
+	// A reorg deeper than the undo records cannot be rolled back, and stops at
+	// the last block that still has its undo record
+	fork.addEmpty(1, int(MaxReorgDepth))
+	node.setChain(fork.blocks, fork.receipts)
+	head := uint64(len(fork.blocks) - 1)
+	for lastBlock < head && err == nil {
+		lastBlock, err = c.indexBlocks(lastBlock, summary)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	deep := fork.fork(2)
+	deep.addEmpty(2, int(head))
+	node.setChain(deep.blocks, deep.receipts)
+	for i := uint64(0); i <= MaxReorgDepth && err == nil; i++ {
+		lastBlock, err = c.indexBlocks(lastBlock, summary)
+	}
+	if !errors.Is(err, errNoUndoData) {
+		t.Fatalf("unexpected error %v, want %v", err, errNoUndoData)
+	}
+	if want := head - MaxReorgDepth; lastBlock != want {
+		t.Fatalf("rolled back to %d, want %d", lastBlock, want)
+	}
+	if hash, _ := c.getIndexedBlockHash(lastBlock); hash != fork.blocks[lastBlock].Hash() {
+		t.Fatalf("block %d indexed with hash %v, want %v", lastBlock, hash, fork.blocks[lastBlock].Hash())
+	}
+}
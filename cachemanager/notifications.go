@@ -0,0 +1,190 @@
+package cachemanager
+
+import (
+	"fmt"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/ethclient"
+	"github.com/QuantumCoinProject/qc/event"
+	"github.com/QuantumCoinProject/qc/log"
+	"sort"
+	"strings"
+)
+
+// eventQueueSize is the number of events queued for the subscribers. Events
+// are dropped when the queue is full.
+const eventQueueSize = 16384
+
+type EventType string
+
+// List of EventType
+const (
+	EVENT_NEW_BLOCK           EventType = "newBlock"
+	EVENT_BLOCK_REMOVED       EventType = "blockRemoved"
+	EVENT_TRANSACTION         EventType = "transaction"
+	EVENT_TOKEN_TRANSFER      EventType = "tokenTransfer"
+	EVENT_PENDING_TRANSACTION EventType = "pendingTransaction"
+)
+
+var AllEventTypes = []EventType{
+	EVENT_NEW_BLOCK,
+	EVENT_BLOCK_REMOVED,
+	EVENT_TRANSACTION,
+	EVENT_TOKEN_TRANSFER,
+	EVENT_PENDING_TRANSACTION,
+}
+
+// Event is a notification emitted by the cache indexer. Block events are emitted
+// once a block is indexed. Events are delivered at most once: they are dropped
+// when a queue is full and lost when the relay restarts, and are not replayed.
+// If the block is rolled back later because of a reorg, a blockRemoved event is
+// emitted for it.
+type Event struct {
+	// Id is unique for the event and the same if the event is delivered again.
+	Id string `json:"id"`
+
+	Type EventType `json:"type"`
+
+	BlockNumber uint64 `json:"blockNumber,omitempty"`
+
+	BlockHash string `json:"blockHash,omitempty"`
+
+	// Address is the account the event is about, empty for block events.
+	Address string `json:"address,omitempty"`
+
+	Transaction *AccountTransactionCompact `json:"transaction,omitempty"`
+
+	PendingTransaction *AccountPendingTransactionCompact `json:"pendingTransaction,omitempty"`
+}
+
+func IsValidEventType(eventType string) bool {
+	for _, t := range AllEventTypes {
+		if string(t) == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// SubscribeEvents subscribes to the events of the indexer. Events are sent to
+// the subscribers by a separate goroutine, so indexing does not wait for them,
+// but the channel should be drained quickly: events are dropped once the event
+// queue is full.
+func (c *CacheManager) SubscribeEvents(ch chan<- *Event) event.Subscription {
+	return c.eventFeed.Subscribe(ch)
+}
+
+// blockEvents returns the events of an indexed block: the block itself, then
+// the transactions of each account, ordered by account address.
+func blockEvents(block *types.Block, liveAccountMap map[string][]AccountTransactionCompact) []*Event {
+	blockHash := strings.ToLower(block.Hash().Hex())
+	events := []*Event{{
+		Id:          blockHash,
+		Type:        EVENT_NEW_BLOCK,
+		BlockNumber: block.NumberU64(),
+		BlockHash:   blockHash,
+	}}
+
+	addresses := make([]string, 0, len(liveAccountMap))
+	for address := range liveAccountMap {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	for _, address := range addresses {
+		for i := range liveAccountMap[address] {
+			transaction := liveAccountMap[address][i]
+			eventType := EVENT_TRANSACTION
+			if transaction.TransactionType == string(TOKEN_TRANSFER) && len(transaction.TokenAddress) > 0 {
+				eventType = EVENT_TOKEN_TRANSFER
+			}
+			events = append(events, &Event{
+				Id:          fmt.Sprintf("%s-%s-%d", blockHash, address, i),
+				Type:        eventType,
+				BlockNumber: block.NumberU64(),
+				BlockHash:   blockHash,
+				Address:     address,
+				Transaction: &transaction,
+			})
+		}
+	}
+	return events
+}
+
+func blockRemovedEvent(blockNumber uint64, blockHash common.Hash) *Event {
+	hash := strings.ToLower(blockHash.Hex())
+	return &Event{
+		Id:          "removed-" + hash,
+		Type:        EVENT_BLOCK_REMOVED,
+		BlockNumber: blockNumber,
+		BlockHash:   hash,
+	}
+}
+
+// pendingEvents returns the events of the transactions that were not pending in
+// the previous transaction pool content, and the hashes of all the pending ones.
+func pendingEvents(content map[string]map[string]map[string]*ethclient.TxPoolTransaction, seen map[common.Hash]bool) ([]*Event, map[common.Hash]bool) {
+	pending := make(map[common.Hash]bool)
+	events := make([]*Event, 0)
+	for _, accounts := range content {
+		for _, txs := range accounts {
+			for _, tx := range txs {
+				if pending[tx.Hash] {
+					continue
+				}
+				pending[tx.Hash] = true
+				if seen[tx.Hash] {
+					continue
+				}
+				txn := AccountPendingTransactionCompact{
+					Hash:  tx.Hash.Hex(),
+					From:  strings.ToLower(tx.From.Hex()),
+					Nonce: uint64(tx.Nonce),
+				}
+				if tx.Value != nil {
+					txn.Value = tx.Value.String()
+				}
+				if tx.To != nil {
+					txn.To = strings.ToLower(tx.To.Hex())
+				}
+				addresses := []string{txn.From}
+				if len(txn.To) > 0 && txn.To != txn.From {
+					addresses = append(addresses, txn.To)
+				}
+				for _, address := range addresses {
+					events = append(events, &Event{
+						Id:                 fmt.Sprintf("pending-%s-%s", strings.ToLower(txn.Hash), address),
+						Type:               EVENT_PENDING_TRANSACTION,
+						Address:            address,
+						PendingTransaction: &txn,
+					})
+				}
+			}
+		}
+	}
+	return events, pending
+}
+
+// sendEvents queues events for the subscribers without blocking the indexer.
+// Events that do not fit in the queue are dropped and counted.
+func (c *CacheManager) sendEvents(events []*Event) {
+	dropped := 0
+	for _, ev := range events {
+		select {
+		case c.eventQueue <- ev:
+		default:
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		c.metrics.droppedEvents.Mark(int64(dropped))
+		log.Warn("Event queue full, events dropped", "dropped", dropped)
+	}
+}
+
+// eventLoop sends the queued events to the subscribers.
+func (c *CacheManager) eventLoop() {
+	for ev := range c.eventQueue {
+		c.eventFeed.Send(ev)
+	}
+}
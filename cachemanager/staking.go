@@ -0,0 +1,230 @@
+package cachemanager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/consensus/proofofstake"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/systemcontracts/staking"
+	"strings"
+)
+
+var ValidatorListKey = "validator-list"
+var StakingDepositorKey = "staking-depositor-%s" //%s is depositor address
+var StakingValidatorKey = "staking-validator-%s" //%s is validator address, value is the depositor address
+var BlockStakingKey = "block-staking-%d"         //%d is block number
+
+var (
+	ErrValidatorsNotFound = errors.New("validators not found")
+	ErrStakingNotFound    = errors.New("staking details not found")
+)
+
+// ValidatorRefreshInterval is the number of blocks after which the validator list
+// is fetched again. It is also fetched after blocks with staking contract
+// transactions or slashings.
+const ValidatorRefreshInterval uint64 = 32
+
+type ListValidatorsResponse struct {
+	BlockNumber uint64                           `json:"blockNumber"`
+	Items       []*proofofstake.ValidatorDetails `json:"items"`
+}
+
+type StakingDetailsResponse struct {
+	BlockNumber uint64                         `json:"blockNumber"`
+	Result      *proofofstake.ValidatorDetails `json:"result"`
+}
+
+// BlockStakingDetails is the proposer and the rewards of a block.
+type BlockStakingDetails struct {
+	BlockNumber   uint64                         `json:"blockNumber"`
+	BlockHash     string                         `json:"blockHash"`
+	BlockProposer string                         `json:"blockProposer"`
+	Round         uint64                         `json:"round"`
+	VoteType      uint64                         `json:"voteType"`
+	Rewards       *proofofstake.BlockRewardsInfo `json:"rewards"`
+}
+
+type GetBlockStakingDetailsResponse struct {
+	Result BlockStakingDetails `json:"result"`
+}
+
+func getStakingDepositorKey(depositor string) []byte {
+	return []byte(fmt.Sprintf(StakingDepositorKey, depositor))
+}
+
+func getStakingValidatorKey(validator string) []byte {
+	return []byte(fmt.Sprintf(StakingValidatorKey, validator))
+}
+
+func getBlockStakingKey(blockNumber uint64) []byte {
+	return []byte(fmt.Sprintf(BlockStakingKey, blockNumber))
+}
+
+// needsValidatorRefresh reports whether the validator list has to be fetched
+// for the block.
+func (c *CacheManager) needsValidatorRefresh(block *types.Block, consensusData *proofofstake.ConsensusData) bool {
+	if block.NumberU64()%ValidatorRefreshInterval == 0 {
+		return true
+	}
+	if has, err := c.cacheDb.Has([]byte(ValidatorListKey)); err != nil || has == false {
+		return true
+	}
+	for _, tx := range block.Transactions() {
+		if tx.To() != nil && tx.To().IsEqualTo(staking.STAKING_CONTRACT_ADDRESS) {
+			return true
+		}
+	}
+	if consensusData != nil && consensusData.BlockRewardsInfo != nil && len(consensusData.BlockRewardsInfo.SlashedValidators) > 0 {
+		return true
+	}
+	return false
+}
+
+// putBlockStaking stores the proposer and the rewards of a block.
+func (c *CacheManager) putBlockStaking(block *types.Block, consensusData *proofofstake.ConsensusData, batch *ethdb.Batch) error {
+	txnBatch := *batch
+	if consensusData == nil || consensusData.Data == nil {
+		return nil
+	}
+	details := BlockStakingDetails{
+		BlockNumber:   block.NumberU64(),
+		BlockHash:     strings.ToLower(block.Hash().Hex()),
+		BlockProposer: strings.ToLower(consensusData.Data.BlockProposer.Hex()),
+		Round:         uint64(consensusData.Data.Round),
+		VoteType:      uint64(consensusData.Data.VoteType),
+		Rewards:       consensusData.BlockRewardsInfo,
+	}
+	blob, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	if err := txnBatch.Put(getBlockStakingKey(block.NumberU64()), blob); err != nil {
+		return err
+	}
+	return c.putAccountStaking(block, consensusData.BlockRewardsInfo, consensusData.Data.BlockProposer, batch)
+}
+
+// getJSON unmarshals the value of key into v. notFound is returned if the key
+// is missing.
+func (c *CacheManager) getJSON(key []byte, v interface{}, notFound error) error {
+	has, err := c.cacheDb.Has(key)
+	if err != nil {
+		return err
+	}
+	if has == false {
+		return notFound
+	}
+	blob, err := c.cacheDb.Get(key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(blob, v)
+}
+
+// putValidators stores the validator list and the staking details of each
+// depositor. The details of depositors that left the list are deleted.
+func (c *CacheManager) putValidators(blockNumber uint64, validators []*proofofstake.ValidatorDetails, batch *ethdb.Batch) error {
+	txnBatch := *batch
+
+	previous, err := c.ListValidators()
+	if err != nil && errors.Is(err, ErrValidatorsNotFound) == false {
+		log.Error("putValidators ListValidators", "error", err)
+		return err
+	}
+
+	current := make(map[string]bool)
+	for _, validator := range validators {
+		depositor := strings.ToLower(validator.Depositor.Hex())
+		current[depositor] = true
+		blob, err := json.Marshal(validator)
+		if err != nil {
+			return err
+		}
+		if err := txnBatch.Put(getStakingDepositorKey(depositor), blob); err != nil {
+			return err
+		}
+		if err := txnBatch.Put(getStakingValidatorKey(strings.ToLower(validator.Validator.Hex())), []byte(depositor)); err != nil {
+			return err
+		}
+	}
+	if previous != nil {
+		for _, validator := range previous.Items {
+			depositor := strings.ToLower(validator.Depositor.Hex())
+			if current[depositor] {
+				continue
+			}
+			if err := txnBatch.Delete(getStakingDepositorKey(depositor)); err != nil {
+				return err
+			}
+			if err := txnBatch.Delete(getStakingValidatorKey(strings.ToLower(validator.Validator.Hex()))); err != nil {
+				return err
+			}
+		}
+	}
+
+	blob, err := json.Marshal(ListValidatorsResponse{BlockNumber: blockNumber, Items: validators})
+	if err != nil {
+		return err
+	}
+	return txnBatch.Put([]byte(ValidatorListKey), blob)
+}
+
+// ListValidators returns the validator list at the block it was last fetched.
+func (c *CacheManager) ListValidators() (*ListValidatorsResponse, error) {
+	var response ListValidatorsResponse
+	if err := c.getJSON([]byte(ValidatorListKey), &response, ErrValidatorsNotFound); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// GetStakingDetails returns the stake, rewards, slashings and withdrawal status
+// of a depositor. The address can also be the validator of the depositor.
+func (c *CacheManager) GetStakingDetails(address common.Address) (*StakingDetailsResponse, error) {
+	list, err := c.ListValidators()
+	if err != nil {
+		if errors.Is(err, ErrValidatorsNotFound) {
+			return nil, ErrStakingNotFound
+		}
+		return nil, err
+	}
+
+	depositor := strings.ToLower(address.Hex())
+	has, err := c.cacheDb.Has(getStakingDepositorKey(depositor))
+	if err != nil {
+		return nil, err
+	}
+	if has == false {
+		key := getStakingValidatorKey(depositor)
+		if has, err = c.cacheDb.Has(key); err != nil {
+			return nil, err
+		}
+		if has == false {
+			return nil, ErrStakingNotFound
+		}
+		blob, err := c.cacheDb.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		depositor = string(blob)
+	}
+
+	var details proofofstake.ValidatorDetails
+	if err := c.getJSON(getStakingDepositorKey(depositor), &details, ErrStakingNotFound); err != nil {
+		return nil, err
+	}
+	return &StakingDetailsResponse{BlockNumber: list.BlockNumber, Result: &details}, nil
+}
+
+// GetBlockStakingDetails returns the proposer and the rewards of a block.
+func (c *CacheManager) GetBlockStakingDetails(blockNumber uint64) (*GetBlockStakingDetailsResponse, error) {
+	var response GetBlockStakingDetailsResponse
+	if err := c.getJSON(getBlockStakingKey(blockNumber), &response.Result, ErrStakingNotFound); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
@@ -0,0 +1,63 @@
+package cachemanager
+
+import (
+	"errors"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/consensus/proofofstake"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"testing"
+)
+
+func TestStakingDetails(t *testing.T) {
+	c := &CacheManager{cacheDb: rawdb.NewMemoryDatabase(), metrics: newIndexerMetrics()}
+	validator := func(n byte, balance string) *proofofstake.ValidatorDetails {
+		return &proofofstake.ValidatorDetails{
+			Depositor: common.BytesToAddress([]byte{n}),
+			Validator: common.BytesToAddress([]byte{n, 0xff}),
+			Balance:   balance,
+		}
+	}
+	first, second := validator(0x01, "0x1"), validator(0x02, "0x2")
+
+	if _, err := c.GetStakingDetails(first.Depositor); !errors.Is(err, ErrStakingNotFound) {
+		t.Fatalf("unexpected error %v, want %v", err, ErrStakingNotFound)
+	}
+
+	applyBatch(t, c, 32, func(batch *ethdb.Batch) error {
+		return c.putValidators(32, []*proofofstake.ValidatorDetails{first, second}, batch)
+	})
+	list, err := c.ListValidators()
+	if err != nil || list.BlockNumber != 32 || len(list.Items) != 2 {
+		t.Fatalf("unexpected validator list %+v, %v", list, err)
+	}
+	// Details are found by the depositor and by the validator address
+	for _, address := range []common.Address{second.Depositor, second.Validator} {
+		details, err := c.GetStakingDetails(address)
+		if err != nil || details.BlockNumber != 32 || details.Result.Balance != "0x2" {
+			t.Fatalf("unexpected details for %x: %+v, %v", address, details, err)
+		}
+	}
+
+	// The second depositor withdraws and leaves the list
+	applyBatch(t, c, 33, func(batch *ethdb.Batch) error {
+		return c.putValidators(33, []*proofofstake.ValidatorDetails{validator(0x01, "0x3")}, batch)
+	})
+	if _, err := c.GetStakingDetails(second.Validator); !errors.Is(err, ErrStakingNotFound) {
+		t.Fatalf("unexpected error %v, want %v", err, ErrStakingNotFound)
+	}
+	if details, err := c.GetStakingDetails(first.Depositor); err != nil || details.Result.Balance != "0x3" {
+		t.Fatalf("unexpected details %+v, %v", details, err)
+	}
+
+	// Rolling the block back restores the previous list
+	if err := c.rollbackBlock(33); err != nil {
+		t.Fatal(err)
+	}
+	if details, err := c.GetStakingDetails(second.Validator); err != nil || details.BlockNumber != 32 {
+		t.Fatalf("unexpected details after rollback %+v, %v", details, err)
+	}
+	if details, err := c.GetStakingDetails(first.Depositor); err != nil || details.Result.Balance != "0x1" {
+		t.Fatalf("unexpected details after rollback %+v, %v", details, err)
+	}
+}
@@ -0,0 +1,629 @@
+package cachemanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/common/math"
+	"github.com/QuantumCoinProject/qc/consensus/proofofstake"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/ethclient"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/params"
+	"github.com/QuantumCoinProject/qc/systemcontracts/staking"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+var AccountBalanceKey = "account-balance-%s" //%s is account address
+var BalanceRankKey = "balance-rank-%064x-%s" //%x is the largest uint256 minus the balance, %s is account address
+var BalanceRankKeyPrefix = "balance-rank-"
+var SupplyDistributionKey = "supply-distribution"
+var SupplyKey = "supply"
+var SupplySnapshotKey = "supply-snapshot-%s" //%s is UTC day
+var SupplySnapshotKeyPrefix = "supply-snapshot-"
+var ActiveAddressKey = "active-address-%s-%s" //%s is UTC day, %s is account address
+var ActiveAddressKeyPrefix = "active-address-"
+var DailyActiveAddressesKey = "daily-active-addresses-%s" //%s is UTC day
+
+const (
+	SupplyDateLayout     = "2006-01-02" // Layout of the days of supply snapshots
+	DefaultRichListCount = 100
+	MaxRichListCount     = 1000
+	MaxSupplyHistoryDays = 366
+
+	// SupplyBalancesBackfill is the name of the balance index backfill.
+	SupplyBalancesBackfill = "supply-balances"
+
+	// SupplyBalancesVersion is the version of the balance index. Bumping it
+	// refreshes the balances of all the accounts known to the cache.
+	SupplyBalancesVersion = 1
+
+	// SupplyBackfillAccounts is the number of accounts whose balance is
+	// refreshed with each indexed block while the balance index is backfilled.
+	SupplyBackfillAccounts = 500
+)
+
+var (
+	ErrSupplyNotFound = errors.New("supply details not found")
+	ErrSupplyRange    = errors.New("invalid supply history range")
+)
+
+// balanceBucketBounds are the lower bounds, in coins, of the buckets of the
+// balance distribution. The last bucket has no upper bound.
+var balanceBucketBounds = []int64{0, 1, 10, 100, 1000, 10000, 100000, 1000000, 10000000, 100000000, 1000000000}
+
+// BalanceBucket is the number of accounts holding a balance in [Min, Max), and
+// the sum of their balances.
+type BalanceBucket struct {
+	Min     string `json:"min"`
+	Max     string `json:"max,omitempty"`
+	Holders uint64 `json:"holders"`
+	Balance string `json:"balance"`
+}
+
+// SupplyDistribution is the balance distribution of the indexed accounts with a
+// non zero balance.
+type SupplyDistribution struct {
+	BlockNumber uint64           `json:"blockNumber"`
+	Holders     uint64           `json:"holders"`
+	Balance     string           `json:"balance"`
+	Buckets     []*BalanceBucket `json:"buckets"`
+	Incomplete  bool             `json:"incomplete,omitempty"`
+}
+
+// SupplySnapshot is the supply of a block, split between the coins staked in the
+// staking contract and the liquid coins. One snapshot is kept per UTC day, for
+// the last block of the day.
+type SupplySnapshot struct {
+	Date              string           `json:"date"`
+	BlockNumber       uint64           `json:"blockNumber"`
+	CreatedAt         string           `json:"createdAt"`
+	CirculatingSupply string           `json:"circulatingSupply"`
+	StakedSupply      string           `json:"stakedSupply"`
+	LiquidSupply      string           `json:"liquidSupply"`
+	BurntCoins        string           `json:"burntCoins"`
+	Validators        uint64           `json:"validators"`
+	Holders           uint64           `json:"holders"`
+	ActiveAddresses   uint64           `json:"activeAddresses"`
+	Buckets           []*BalanceBucket `json:"buckets"`
+	Incomplete        bool             `json:"incomplete,omitempty"`
+}
+
+type RichListEntry struct {
+	Rank    uint64 `json:"rank"`
+	Address string `json:"address"`
+	Balance string `json:"balance"`
+}
+
+type RichListResponse struct {
+	BlockNumber uint64           `json:"blockNumber"`
+	Items       []*RichListEntry `json:"items"`
+	Incomplete  bool             `json:"incomplete,omitempty"`
+}
+
+type SupplyHistoryResponse struct {
+	Items []*SupplySnapshot `json:"items"`
+}
+
+func getAccountBalanceKey(address string) []byte {
+	return []byte(fmt.Sprintf(AccountBalanceKey, address))
+}
+
+func getBalanceRankKey(address string, balance *big.Int) []byte {
+	return []byte(fmt.Sprintf(BalanceRankKey, new(big.Int).Sub(math.MaxBig256, balance), address))
+}
+
+func getSupplySnapshotKey(date string) []byte {
+	return []byte(fmt.Sprintf(SupplySnapshotKey, date))
+}
+
+func getActiveAddressKey(date string, address string) []byte {
+	return []byte(fmt.Sprintf(ActiveAddressKey, date, address))
+}
+
+func getDailyActiveAddressesKey(date string) []byte {
+	return []byte(fmt.Sprintf(DailyActiveAddressesKey, date))
+}
+
+// balanceBucket returns the index of the distribution bucket of a balance.
+func balanceBucket(balance *big.Int) int {
+	coins := new(big.Int).Div(balance, big.NewInt(params.Ether))
+	for i := len(balanceBucketBounds) - 1; i > 0; i-- {
+		if coins.Cmp(big.NewInt(balanceBucketBounds[i])) >= 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+func newSupplyDistribution() *SupplyDistribution {
+	distribution := &SupplyDistribution{Balance: hexutil.EncodeBig(common.Big0)}
+	for i, bound := range balanceBucketBounds {
+		bucket := &BalanceBucket{
+			Min:     hexutil.EncodeBig(new(big.Int).Mul(big.NewInt(bound), big.NewInt(params.Ether))),
+			Balance: hexutil.EncodeBig(common.Big0),
+		}
+		if i+1 < len(balanceBucketBounds) {
+			bucket.Max = hexutil.EncodeBig(new(big.Int).Mul(big.NewInt(balanceBucketBounds[i+1]), big.NewInt(params.Ether)))
+		}
+		distribution.Buckets = append(distribution.Buckets, bucket)
+	}
+	return distribution
+}
+
+// add adds a balance to the distribution, or removes it if sign is -1.
+func (d *SupplyDistribution) add(balance *big.Int, sign int) error {
+	total, err := hexutil.DecodeBig(d.Balance)
+	if err != nil {
+		return err
+	}
+	bucket := d.Buckets[balanceBucket(balance)]
+	bucketBalance, err := hexutil.DecodeBig(bucket.Balance)
+	if err != nil {
+		return err
+	}
+	if sign < 0 {
+		d.Holders--
+		bucket.Holders--
+		d.Balance = hexutil.EncodeBig(common.SafeSubBigInt(total, balance))
+		bucket.Balance = hexutil.EncodeBig(common.SafeSubBigInt(bucketBalance, balance))
+	} else {
+		d.Holders++
+		bucket.Holders++
+		d.Balance = hexutil.EncodeBig(common.SafeAddBigInt(total, balance))
+		bucket.Balance = hexutil.EncodeBig(common.SafeAddBigInt(bucketBalance, balance))
+	}
+	return nil
+}
+
+// touchedAccounts returns the accounts whose coin balance can change in a block:
+// the senders and recipients of its transactions, the contracts they create,
+// the parties of internal transfers, the proposer and the staking contract. The
+// depositors are added when the validator list is refreshed, since unbonded
+// stakes are paid without a transaction, and the genesis accounts are added to
+// the first block. The parties of internal transfers are only known when
+// internal transactions are indexed; without them, the balance index misses the
+// coins sent by contracts, and the supply responses are flagged incomplete.
+func (c *CacheManager) touchedAccounts(fetched *fetchedBlock) ([]common.Address, error) {
+	accounts := map[common.Address]bool{
+		staking.STAKING_CONTRACT_ADDRESS: true,
+		fetched.block.Coinbase():         true,
+	}
+	for i, tx := range fetched.block.Transactions() {
+		msg, err := tx.AsMessage(types.NewLondonSigner(chainID))
+		if err != nil {
+			return nil, err
+		}
+		accounts[msg.From()] = true
+		if tx.To() != nil {
+			accounts[*tx.To()] = true
+		} else if i < len(fetched.receipts) {
+			accounts[fetched.receipts[i].ContractAddress] = true
+		}
+		if fetched.internalTxs != nil {
+			for _, transfer := range internalTransfers(fetched.internalTxs[i]) {
+				accounts[common.HexToAddress(transfer.from)] = true
+				accounts[common.HexToAddress(transfer.to)] = true
+			}
+		}
+	}
+	for _, validator := range fetched.validators {
+		accounts[validator.Depositor] = true
+	}
+	if fetched.number == 1 {
+		for _, account := range c.genesisAccounts {
+			accounts[account] = true
+		}
+	}
+
+	list := make([]common.Address, 0, len(accounts))
+	for account := range accounts {
+		list = append(list, account)
+	}
+	return list, nil
+}
+
+// fetchBalances returns the coin balances of the accounts touched in a block, at
+// that block.
+func (c *CacheManager) fetchBalances(client *ethclient.Client, fetched *fetchedBlock) (map[string]*big.Int, error) {
+	accounts, err := c.touchedAccounts(fetched)
+	if err != nil {
+		return nil, err
+	}
+	values, err := client.BalancesAt(context.Background(), accounts, new(big.Int).SetUint64(fetched.number))
+	if err != nil {
+		return nil, err
+	}
+	balances := make(map[string]*big.Int, len(accounts))
+	for i, account := range accounts {
+		balances[strings.ToLower(account.Hex())] = values[i]
+	}
+	return balances, nil
+}
+
+// backfillBalances returns the balances to index with a block. While the balance
+// index is backfilled, the balances of up to SupplyBackfillAccounts accounts
+// known to the cache, read at the block with fetch, are added to the balances of
+// the accounts touched in the block. The genesis accounts and the staking
+// contract are refreshed first, then the accounts of the transaction history,
+// in address order. It also reports whether the index is complete.
+func (c *CacheManager) backfillBalances(blockNumber uint64, balances map[string]*big.Int, fetch func(accounts []common.Address, blockNumber uint64) ([]*big.Int, error), batch *ethdb.Batch) (map[string]*big.Int, bool, error) {
+	state, err := c.getBackfillState(SupplyBalancesBackfill)
+	if err != nil {
+		return nil, false, err
+	}
+	if state.Version == SupplyBalancesVersion {
+		return balances, true, nil
+	}
+
+	accounts := make([]common.Address, 0, SupplyBackfillAccounts)
+	if state.Cleared == false {
+		accounts = append(accounts, staking.STAKING_CONTRACT_ADDRESS)
+		accounts = append(accounts, c.genesisAccounts...)
+		state.Cleared = true
+	}
+	prefix := fmt.Sprintf(AccountTxnCountKey, "")
+	var start []byte
+	if len(state.Key) > 0 {
+		start = []byte(state.Key + "\x00")
+	}
+	it := c.cacheDb.NewIterator([]byte(prefix), start)
+	done := true
+	for it.Next() {
+		if len(accounts) >= SupplyBackfillAccounts {
+			done = false
+			break
+		}
+		state.Key = strings.TrimPrefix(string(it.Key()), prefix)
+		accounts = append(accounts, common.HexToAddress(state.Key))
+	}
+	err = it.Error()
+	it.Release()
+	if err != nil {
+		return nil, false, err
+	}
+
+	merged := make(map[string]*big.Int, len(balances)+len(accounts))
+	if len(accounts) > 0 {
+		values, err := fetch(accounts, blockNumber)
+		if err != nil {
+			log.Error("backfillBalances fetch", "error", err, "block", blockNumber)
+			return nil, false, err
+		}
+		for i, account := range accounts {
+			merged[strings.ToLower(account.Hex())] = values[i]
+		}
+	}
+	for address, balance := range balances {
+		merged[address] = balance
+	}
+
+	if done {
+		state = &backfillState{Version: SupplyBalancesVersion}
+		log.Info("Balance index backfilled", "block", blockNumber)
+	} else {
+		log.Info("Backfilling balance index", "account", state.Key, "block", blockNumber)
+	}
+	if err := c.putBackfillState(SupplyBalancesBackfill, state, batch); err != nil {
+		return nil, false, err
+	}
+	return merged, done, nil
+}
+
+// fetchAccountBalances reads the coin balances of accounts at a block from the
+// node.
+func (c *CacheManager) fetchAccountBalances(accounts []common.Address, blockNumber uint64) ([]*big.Int, error) {
+	var balances []*big.Int
+	err := c.withNodeClient(func(client *ethclient.Client) (err error) {
+		balances, err = client.BalancesAt(context.Background(), accounts, new(big.Int).SetUint64(blockNumber))
+		return err
+	})
+	return balances, err
+}
+
+// isSupplyComplete reports whether the balance index covers all the accounts:
+// it was backfilled, and internal transfers are indexed.
+func (c *CacheManager) isSupplyComplete() (bool, error) {
+	complete, err := c.isBackfilled(SupplyBalancesBackfill, SupplyBalancesVersion)
+	if err != nil {
+		return false, err
+	}
+	return complete && c.indexInternalTxs, nil
+}
+
+// getAccountBalance returns the indexed coin balance of an account, nil if the
+// account holds no coins.
+func (c *CacheManager) getAccountBalance(address string) (*big.Int, error) {
+	key := getAccountBalanceKey(address)
+	has, err := c.cacheDb.Has(key)
+	if err != nil || has == false {
+		return nil, err
+	}
+	blob, err := c.cacheDb.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return hexutil.DecodeBig(string(blob))
+}
+
+// putBalances updates the balance index, the rank index and the distribution
+// with the balances of the accounts touched in a block. Accounts left without
+// coins are removed from the index.
+func (c *CacheManager) putBalances(blockNumber uint64, balances map[string]*big.Int, batch *ethdb.Batch) (*SupplyDistribution, error) {
+	txnBatch := *batch
+
+	distribution, err := c.GetSupplyDistribution()
+	if errors.Is(err, ErrSupplyNotFound) {
+		distribution, err = newSupplyDistribution(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	distribution.BlockNumber = blockNumber
+
+	addresses := make([]string, 0, len(balances))
+	for address := range balances {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	for _, address := range addresses {
+		balance := balances[address]
+		previous, err := c.getAccountBalance(address)
+		if err != nil {
+			log.Error("putBalances getAccountBalance", "error", err, "address", address)
+			return nil, err
+		}
+		if previous != nil {
+			if previous.Cmp(balance) == 0 {
+				continue
+			}
+			if err := txnBatch.Delete(getBalanceRankKey(address, previous)); err != nil {
+				return nil, err
+			}
+			if err := distribution.add(previous, -1); err != nil {
+				return nil, err
+			}
+		}
+		if balance.Sign() <= 0 {
+			if previous != nil {
+				if err := txnBatch.Delete(getAccountBalanceKey(address)); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if err := txnBatch.Put(getAccountBalanceKey(address), []byte(hexutil.EncodeBig(balance))); err != nil {
+			return nil, err
+		}
+		if err := txnBatch.Put(getBalanceRankKey(address, balance), []byte(address)); err != nil {
+			return nil, err
+		}
+		if err := distribution.add(balance, 1); err != nil {
+			return nil, err
+		}
+	}
+
+	blob, err := json.Marshal(distribution)
+	if err != nil {
+		return nil, err
+	}
+	if err := txnBatch.Put([]byte(SupplyDistributionKey), blob); err != nil {
+		return nil, err
+	}
+	return distribution, nil
+}
+
+// putActiveAddresses marks the accounts active on the day of a block and
+// returns the number of active accounts of that day. The markers of the days
+// before the previous one are deleted on the first block of a day, since a
+// rollback cannot reach them anymore.
+func (c *CacheManager) putActiveAddresses(date string, previousDate string, accounts map[string][]AccountTransactionCompact, batch *ethdb.Batch) (uint64, error) {
+	txnBatch := *batch
+
+	var count uint64
+	countKey := getDailyActiveAddressesKey(date)
+	has, err := c.cacheDb.Has(countKey)
+	if err != nil {
+		return 0, err
+	}
+	if has {
+		blob, err := c.cacheDb.Get(countKey)
+		if err != nil {
+			return 0, err
+		}
+		count = common.BytesToUint64(blob)
+	} else {
+		it := c.cacheDb.NewIterator([]byte(ActiveAddressKeyPrefix), nil)
+		for it.Next() {
+			if string(it.Key()) >= ActiveAddressKeyPrefix+previousDate {
+				break
+			}
+			if err := txnBatch.Delete(common.CopyBytes(it.Key())); err != nil {
+				it.Release()
+				return 0, err
+			}
+		}
+		err := it.Error()
+		it.Release()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for address := range accounts {
+		key := getActiveAddressKey(date, address)
+		has, err := c.cacheDb.Has(key)
+		if err != nil {
+			return 0, err
+		}
+		if has {
+			continue
+		}
+		if err := txnBatch.Put(key, []byte{}); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	if err := txnBatch.Put(countKey, common.Uint64ToBytes(count)); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// updateSupply indexes the balances and the active accounts of a block, and
+// stores the supply snapshot of its day. validators is the validator list if it
+// was refreshed for the block, the stored list is used otherwise. complete is
+// whether the balance index covers all the accounts.
+func (c *CacheManager) updateSupply(block *types.Block, balances map[string]*big.Int, validators []*proofofstake.ValidatorDetails, accounts map[string][]AccountTransactionCompact, runningSummary *BlockchainDetails, complete bool, batch *ethdb.Batch) error {
+	txnBatch := *batch
+
+	distribution, err := c.putBalances(block.NumberU64(), balances, batch)
+	if err != nil {
+		log.Error("updateSupply putBalances", "error", err)
+		return err
+	}
+
+	createdAt := time.Unix(int64(block.Time()), 0).UTC()
+	date := createdAt.Format(SupplyDateLayout)
+	activeAddresses, err := c.putActiveAddresses(date, createdAt.AddDate(0, 0, -1).Format(SupplyDateLayout), accounts, batch)
+	if err != nil {
+		log.Error("updateSupply putActiveAddresses", "error", err)
+		return err
+	}
+
+	if validators == nil {
+		list, err := c.ListValidators()
+		if err != nil && errors.Is(err, ErrValidatorsNotFound) == false {
+			return err
+		}
+		if list != nil {
+			validators = list.Items
+		}
+	}
+	staked := big.NewInt(0)
+	for _, validator := range validators {
+		balance, err := hexutil.DecodeBig(validator.Balance)
+		if err != nil {
+			log.Error("updateSupply DecodeBig", "error", err, "depositor", validator.Depositor)
+			return err
+		}
+		staked = common.SafeAddBigInt(staked, balance)
+	}
+	circulating, err := hexutil.DecodeBig(runningSummary.CirculatingSupply)
+	if err != nil {
+		return err
+	}
+	liquid := common.SafeSubBigInt(circulating, staked)
+	if liquid.Sign() < 0 {
+		liquid = big.NewInt(0)
+	}
+
+	snapshot := SupplySnapshot{
+		Date:              date,
+		BlockNumber:       block.NumberU64(),
+		CreatedAt:         createdAt.Format(TimeLayout),
+		CirculatingSupply: runningSummary.CirculatingSupply,
+		StakedSupply:      hexutil.EncodeBig(staked),
+		LiquidSupply:      hexutil.EncodeBig(liquid),
+		BurntCoins:        runningSummary.BurntCoins,
+		Validators:        uint64(len(validators)),
+		Holders:           distribution.Holders,
+		ActiveAddresses:   activeAddresses,
+		Buckets:           distribution.Buckets,
+		Incomplete:        complete == false,
+	}
+	blob, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	if err := txnBatch.Put([]byte(SupplyKey), blob); err != nil {
+		return err
+	}
+	return txnBatch.Put(getSupplySnapshotKey(date), blob)
+}
+
+// GetRichList returns the count accounts holding the most coins.
+func (c *CacheManager) GetRichList(count uint64) (*RichListResponse, error) {
+	if count == 0 || count > MaxRichListCount {
+		return nil, ErrSupplyRange
+	}
+	distribution, err := c.GetSupplyDistribution()
+	if err != nil {
+		return nil, err
+	}
+
+	response := &RichListResponse{BlockNumber: distribution.BlockNumber, Items: make([]*RichListEntry, 0), Incomplete: distribution.Incomplete}
+	it := c.cacheDb.NewIterator([]byte(BalanceRankKeyPrefix), nil)
+	defer it.Release()
+	for uint64(len(response.Items)) < count && it.Next() {
+		key := strings.TrimPrefix(string(it.Key()), BalanceRankKeyPrefix)
+		rank, ok := new(big.Int).SetString(key[:64], 16)
+		if ok == false {
+			return nil, fmt.Errorf("invalid rank key %s", it.Key())
+		}
+		response.Items = append(response.Items, &RichListEntry{
+			Rank:    uint64(len(response.Items)) + 1,
+			Address: string(it.Value()),
+			Balance: hexutil.EncodeBig(new(big.Int).Sub(math.MaxBig256, rank)),
+		})
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// GetSupplyDistribution returns the balance distribution at the last indexed
+// block.
+func (c *CacheManager) GetSupplyDistribution() (*SupplyDistribution, error) {
+	var distribution SupplyDistribution
+	if err := c.getJSON([]byte(SupplyDistributionKey), &distribution, ErrSupplyNotFound); err != nil {
+		return nil, err
+	}
+	complete, err := c.isSupplyComplete()
+	if err != nil {
+		return nil, err
+	}
+	distribution.Incomplete = complete == false
+	return &distribution, nil
+}
+
+// GetSupply returns the supply snapshot of the last indexed block.
+func (c *CacheManager) GetSupply() (*SupplySnapshot, error) {
+	var snapshot SupplySnapshot
+	if err := c.getJSON([]byte(SupplyKey), &snapshot, ErrSupplyNotFound); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// GetSupplyHistory returns the daily supply snapshots from fromDate to toDate,
+// both included. Days without blocks have no snapshot.
+func (c *CacheManager) GetSupplyHistory(fromDate time.Time, toDate time.Time) (*SupplyHistoryResponse, error) {
+	if toDate.Before(fromDate) || toDate.Sub(fromDate) >= MaxSupplyHistoryDays*24*time.Hour {
+		return nil, ErrSupplyRange
+	}
+	last := string(getSupplySnapshotKey(toDate.Format(SupplyDateLayout)))
+
+	response := &SupplyHistoryResponse{Items: make([]*SupplySnapshot, 0)}
+	it := c.cacheDb.NewIterator([]byte(SupplySnapshotKeyPrefix), []byte(fromDate.Format(SupplyDateLayout)))
+	defer it.Release()
+	for it.Next() && string(it.Key()) <= last {
+		var snapshot SupplySnapshot
+		if err := json.Unmarshal(it.Value(), &snapshot); err != nil {
+			return nil, err
+		}
+		response.Items = append(response.Items, &snapshot)
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
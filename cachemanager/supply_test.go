@@ -0,0 +1,180 @@
+package cachemanager
+
+import (
+	"errors"
+	"fmt"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/consensus/proofofstake"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"github.com/QuantumCoinProject/qc/params"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func coins(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(params.Ether))
+}
+
+func TestSupplyAnalytics(t *testing.T) {
+	c := &CacheManager{cacheDb: rawdb.NewMemoryDatabase(), metrics: newIndexerMetrics()}
+	address := func(n byte) string {
+		return strings.ToLower(common.BytesToAddress([]byte{n}).Hex())
+	}
+	day := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	summary := &BlockchainDetails{CirculatingSupply: hexutil.EncodeBig(coins(1000)), BurntCoins: "0x0"}
+	update := func(number uint64, at time.Time, balances map[string]*big.Int, validators []*proofofstake.ValidatorDetails) {
+		block := types.NewBlockWithHeader(&types.Header{Number: new(big.Int).SetUint64(number), Time: uint64(at.Unix())})
+		active := make(map[string][]AccountTransactionCompact)
+		for account := range balances {
+			active[account] = nil
+		}
+		applyBatch(t, c, number, func(batch *ethdb.Batch) error {
+			return c.updateSupply(block, balances, validators, active, summary, true, batch)
+		})
+	}
+
+	if _, err := c.GetRichList(10); !errors.Is(err, ErrSupplyNotFound) {
+		t.Fatalf("unexpected error %v, want %v", err, ErrSupplyNotFound)
+	}
+
+	validators := []*proofofstake.ValidatorDetails{{Depositor: common.BytesToAddress([]byte{0x01}), Balance: hexutil.EncodeBig(coins(300))}}
+	update(1, day, map[string]*big.Int{address(1): coins(5), address(2): coins(500), address(3): big.NewInt(1), address(4): big.NewInt(0)}, validators)
+	update(2, day.Add(time.Hour), map[string]*big.Int{address(1): coins(50), address(3): big.NewInt(0), address(5): coins(50)}, nil)
+
+	list, err := c.GetRichList(10)
+	if err != nil || list.BlockNumber != 2 || len(list.Items) != 3 {
+		t.Fatalf("unexpected rich list %+v, %v", list, err)
+	}
+	if first := list.Items[0]; first.Rank != 1 || first.Address != address(2) || first.Balance != hexutil.EncodeBig(coins(500)) {
+		t.Fatalf("unexpected first holder %+v", first)
+	}
+	if list, err := c.GetRichList(1); err != nil || len(list.Items) != 1 {
+		t.Fatalf("unexpected rich list %+v, %v", list, err)
+	}
+
+	distribution, err := c.GetSupplyDistribution()
+	if err != nil || distribution.Holders != 3 || distribution.Balance != hexutil.EncodeBig(coins(600)) {
+		t.Fatalf("unexpected distribution %+v, %v", distribution, err)
+	}
+	for i, want := range map[int]uint64{0: 0, 1: 0, 2: 2, 3: 1} {
+		if distribution.Buckets[i].Holders != want {
+			t.Errorf("bucket %d: %d holders, want %d", i, distribution.Buckets[i].Holders, want)
+		}
+	}
+
+	// The staked supply comes from the stored validator list when it was not
+	// refreshed. Active addresses are counted once per day.
+	applyBatch(t, c, 2, func(batch *ethdb.Batch) error {
+		return c.putValidators(2, validators, batch)
+	})
+	update(3, day.Add(2*time.Hour), map[string]*big.Int{address(1): coins(50)}, nil)
+	supply, err := c.GetSupply()
+	if err != nil || supply.StakedSupply != hexutil.EncodeBig(coins(300)) || supply.LiquidSupply != hexutil.EncodeBig(coins(700)) {
+		t.Fatalf("unexpected supply %+v, %v", supply, err)
+	}
+	if supply.Date != "2024-01-01" || supply.ActiveAddresses != 5 || supply.Holders != 3 {
+		t.Fatalf("unexpected supply %+v", supply)
+	}
+
+	// A new day starts a new snapshot
+	update(4, day.Add(24*time.Hour), map[string]*big.Int{address(2): coins(400)}, nil)
+	history, err := c.GetSupplyHistory(day, day.AddDate(0, 0, 7))
+	if err != nil || len(history.Items) != 2 {
+		t.Fatalf("unexpected history %+v, %v", history, err)
+	}
+	if first, second := history.Items[0], history.Items[1]; first.BlockNumber != 3 || second.BlockNumber != 4 || second.ActiveAddresses != 1 {
+		t.Fatalf("unexpected snapshots %+v %+v", first, second)
+	}
+	if _, err := c.GetSupplyHistory(day, day.AddDate(2, 0, 0)); !errors.Is(err, ErrSupplyRange) {
+		t.Fatalf("unexpected error %v, want %v", err, ErrSupplyRange)
+	}
+
+	// Rolling the block back restores the previous ranks and snapshots
+	if err := c.rollbackBlock(4); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := c.GetRichList(1); err != nil || list.Items[0].Balance != hexutil.EncodeBig(coins(500)) {
+		t.Fatalf("unexpected rich list after rollback %+v, %v", list, err)
+	}
+	if history, err := c.GetSupplyHistory(day, day.AddDate(0, 0, 7)); err != nil || len(history.Items) != 1 {
+		t.Fatalf("unexpected history after rollback %+v, %v", history, err)
+	}
+	if supply, err := c.GetSupply(); err != nil || supply.BlockNumber != 3 {
+		t.Fatalf("unexpected supply after rollback %+v, %v", supply, err)
+	}
+}
+
+func TestBalanceIndexBackfill(t *testing.T) {
+	c := &CacheManager{cacheDb: rawdb.NewMemoryDatabase(), metrics: newIndexerMetrics(), indexInternalTxs: true}
+	c.genesisAccounts = []common.Address{common.BytesToAddress([]byte{0xff, 0xff})}
+
+	// Accounts of the transaction history indexed before the balance index
+	const historyAccounts = 600
+	for i := 0; i < historyAccounts; i++ {
+		address := strings.ToLower(common.BytesToAddress([]byte{byte(i >> 8), byte(i), 0x01}).Hex())
+		if err := c.cacheDb.Put([]byte(fmt.Sprintf(AccountTxnCountKey, address)), common.Uint64ToBytes(1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fetch := func(accounts []common.Address, blockNumber uint64) ([]*big.Int, error) {
+		values := make([]*big.Int, len(accounts))
+		for i := range accounts {
+			values[i] = coins(1)
+		}
+		return values, nil
+	}
+	live := common.BytesToAddress([]byte{0xaa, 0xbb, 0xcc, 0xdd})
+	index := func(number uint64) bool {
+		var complete bool
+		applyBatch(t, c, number, func(batch *ethdb.Batch) error {
+			balances, backfilled, err := c.backfillBalances(number, map[string]*big.Int{strings.ToLower(live.Hex()): coins(5)}, fetch, batch)
+			if err != nil {
+				return err
+			}
+			complete = backfilled
+			_, err = c.putBalances(number, balances, batch)
+			return err
+		})
+		return complete
+	}
+
+	// The staking contract, the genesis account and the first accounts of the
+	// history are refreshed with the first block, the remaining ones after
+	if index(10) {
+		t.Fatal("balance index complete after the first block")
+	}
+	if distribution, err := c.GetSupplyDistribution(); err != nil || distribution.Incomplete == false || distribution.Holders != SupplyBackfillAccounts+1 {
+		t.Fatalf("unexpected distribution %+v, %v", distribution, err)
+	}
+	if index(11) == false {
+		t.Fatal("balance index not complete after the second block")
+	}
+	distribution, err := c.GetSupplyDistribution()
+	if err != nil || distribution.Incomplete || distribution.Holders != historyAccounts+3 {
+		t.Fatalf("unexpected distribution %+v, %v", distribution, err)
+	}
+	if list, err := c.GetRichList(1); err != nil || list.Incomplete || list.Items[0].Address != strings.ToLower(live.Hex()) {
+		t.Fatalf("unexpected rich list %+v, %v", list, err)
+	}
+
+	// Without internal transactions, contracts can send coins to accounts that
+	// are not indexed
+	c.indexInternalTxs = false
+	if distribution, err := c.GetSupplyDistribution(); err != nil || distribution.Incomplete == false {
+		t.Fatalf("unexpected distribution %+v, %v", distribution, err)
+	}
+
+	// Rolling the block back also rolls back the backfill
+	c.indexInternalTxs = true
+	if err := c.rollbackBlock(11); err != nil {
+		t.Fatal(err)
+	}
+	if distribution, err := c.GetSupplyDistribution(); err != nil || distribution.Incomplete == false {
+		t.Fatalf("unexpected distribution after rollback %+v, %v", distribution, err)
+	}
+}
@@ -0,0 +1,421 @@
+package cachemanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/ethclient"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"github.com/QuantumCoinProject/qc/log"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+var AccountTokensKey = "account-tokens-%s"                 //%s is account address
+var AccountTokenBalanceKey = "account-token-balance-%s-%s" //%s is account address, %s is contract address
+var TokenHolderCountKey = "token-holder-count-%s"          //%s is contract address
+
+const (
+	// TokenBalancesBackfill is the name of the token balances backfill.
+	TokenBalancesBackfill = "token-balances"
+
+	// TokenBalancesVersion is the version of the token balance data. Bumping it
+	// rebuilds the token balances from the first block.
+	TokenBalancesVersion = 1
+
+	// TokenBackfillBlocks is the number of earlier blocks replayed with each
+	// indexed block while the token balances are rebuilt.
+	TokenBackfillBlocks = 64
+)
+
+// tokenBalanceKeyPrefixes are the prefixes of the keys of the token balance data.
+var tokenBalanceKeyPrefixes = []string{"account-tokens-", "account-token-balance-", "token-holder-count-"}
+
+type AccountTokenCompact struct {
+	ContractAddress string `json:"contractAddress,omitempty"`
+	Balance         string `json:"balance,omitempty"`
+	Name            string `json:"name,omitempty"`
+	Symbol          string `json:"symbol,omitempty"`
+	Decimals        string `json:"decimals,omitempty"`
+}
+
+// ListAccountTokensResponse is a page of the tokens of an account. Incomplete is
+// set while the token balances are being rebuilt.
+type ListAccountTokensResponse struct {
+	PageCount  uint64                `json:"pageCount"`
+	Items      []AccountTokenCompact `json:"items"`
+	Incomplete bool                  `json:"incomplete,omitempty"`
+}
+
+type TokenHolders struct {
+	ContractAddress string `json:"contractAddress,omitempty"`
+	HolderCount     uint64 `json:"holderCount"`
+	Incomplete      bool   `json:"incomplete,omitempty"`
+}
+
+type GetTokenHoldersResponse struct {
+	Result TokenHolders `json:"result,omitempty"`
+}
+
+func getAccountTokensKey(address string) []byte {
+	return []byte(fmt.Sprintf(AccountTokensKey, address))
+}
+
+func getAccountTokenBalanceKey(address string, contractAddress string) []byte {
+	return []byte(fmt.Sprintf(AccountTokenBalanceKey, address, contractAddress))
+}
+
+func getTokenHolderCountKey(contractAddress string) []byte {
+	return []byte(fmt.Sprintf(TokenHolderCountKey, contractAddress))
+}
+
+// getAccountTokens returns the contract addresses of the tokens held by an
+// account, in the order they were first received.
+func (c *CacheManager) getAccountTokens(address string) ([]string, error) {
+	key := getAccountTokensKey(address)
+	has, err := c.cacheDb.Has(key)
+	if err != nil {
+		return nil, err
+	}
+	if has == false {
+		return make([]string, 0), nil
+	}
+	blob, err := c.cacheDb.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	var tokens []string
+	if err := json.Unmarshal(blob, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (c *CacheManager) getAccountTokenBalance(address string, contractAddress string) (*big.Int, error) {
+	key := getAccountTokenBalanceKey(address, contractAddress)
+	has, err := c.cacheDb.Has(key)
+	if err != nil {
+		return nil, err
+	}
+	if has == false {
+		return big.NewInt(0), nil
+	}
+	blob, err := c.cacheDb.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return hexutil.DecodeBig(string(blob))
+}
+
+func (c *CacheManager) getTokenHolderCount(contractAddress string) (uint64, error) {
+	key := getTokenHolderCountKey(contractAddress)
+	has, err := c.cacheDb.Has(key)
+	if err != nil {
+		return 0, err
+	}
+	if has == false {
+		return 0, nil
+	}
+	blob, err := c.cacheDb.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	return common.BytesToUint64(blob), nil
+}
+
+// processTokenBalances applies the token transfers of a block to the token
+// balances of the accounts, the tokens held by each account and the holder
+// count of each token. Mints and burns are transfers from and to the zero
+// address, which is not tracked as a holder.
+func (c *CacheManager) processTokenBalances(transfers []*tokenTransfer, batch *ethdb.Batch) error {
+	txnBatch := *batch
+	if len(transfers) == 0 {
+		return nil
+	}
+
+	// Sum up the balance changes first, the batch cannot be read back
+	deltas := make(map[string]map[string]*big.Int)
+	addDelta := func(address common.Address, contractAddress string, value *big.Int) {
+		if address.IsEqualTo(common.ZERO_ADDRESS) {
+			return
+		}
+		account := strings.ToLower(address.Hex())
+		if deltas[account] == nil {
+			deltas[account] = make(map[string]*big.Int)
+		}
+		if deltas[account][contractAddress] == nil {
+			deltas[account][contractAddress] = new(big.Int)
+		}
+		deltas[account][contractAddress].Add(deltas[account][contractAddress], value)
+	}
+	for _, transfer := range transfers {
+		contractAddress := strings.ToLower(transfer.contract.Hex())
+		addDelta(transfer.from, contractAddress, new(big.Int).Neg(transfer.value))
+		addDelta(transfer.to, contractAddress, transfer.value)
+	}
+
+	accounts := make([]string, 0, len(deltas))
+	for account := range deltas {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+
+	holderDeltas := make(map[string]int64)
+	for _, account := range accounts {
+		tokens, err := c.getAccountTokens(account)
+		if err != nil {
+			log.Error("processTokenBalances getAccountTokens", "error", err, "address", account)
+			return err
+		}
+		tokensChanged := false
+
+		contracts := make([]string, 0, len(deltas[account]))
+		for contractAddress := range deltas[account] {
+			contracts = append(contracts, contractAddress)
+		}
+		sort.Strings(contracts)
+
+		for _, contractAddress := range contracts {
+			balance, err := c.getAccountTokenBalance(account, contractAddress)
+			if err != nil {
+				log.Error("processTokenBalances getAccountTokenBalance", "error", err, "address", account, "contractAddress", contractAddress)
+				return err
+			}
+			held := balance.Sign() > 0
+			balance.Add(balance, deltas[account][contractAddress])
+			if balance.Sign() < 0 {
+				// Tokens that do not log every balance change
+				log.Warn("processTokenBalances negative balance", "address", account, "contractAddress", contractAddress, "balance", balance)
+				if c.metrics != nil {
+					c.metrics.tokenClamps.Mark(1)
+				}
+				balance.SetInt64(0)
+			}
+
+			key := getAccountTokenBalanceKey(account, contractAddress)
+			if balance.Sign() > 0 {
+				err = txnBatch.Put(key, []byte(hexutil.EncodeBig(balance)))
+			} else {
+				err = txnBatch.Delete(key)
+			}
+			if err != nil {
+				log.Error("processTokenBalances txnBatch.Put", "error", err)
+				return err
+			}
+
+			if held == false && balance.Sign() > 0 {
+				tokens = append(tokens, contractAddress)
+				holderDeltas[contractAddress]++
+				tokensChanged = true
+			} else if held && balance.Sign() == 0 {
+				for i, token := range tokens {
+					if token == contractAddress {
+						tokens = append(tokens[:i], tokens[i+1:]...)
+						break
+					}
+				}
+				holderDeltas[contractAddress]--
+				tokensChanged = true
+			}
+		}
+
+		if tokensChanged == false {
+			continue
+		}
+		key := getAccountTokensKey(account)
+		if len(tokens) == 0 {
+			err = txnBatch.Delete(key)
+		} else {
+			var blob []byte
+			blob, err = json.Marshal(tokens)
+			if err == nil {
+				err = txnBatch.Put(key, blob)
+			}
+		}
+		if err != nil {
+			log.Error("processTokenBalances account tokens", "error", err, "address", account)
+			return err
+		}
+	}
+
+	for contractAddress, delta := range holderDeltas {
+		if delta == 0 {
+			continue
+		}
+		holderCount, err := c.getTokenHolderCount(contractAddress)
+		if err != nil {
+			log.Error("processTokenBalances getTokenHolderCount", "error", err, "contractAddress", contractAddress)
+			return err
+		}
+		if delta < 0 && uint64(-delta) > holderCount {
+			holderCount = 0
+		} else {
+			holderCount = uint64(int64(holderCount) + delta)
+		}
+		err = txnBatch.Put(getTokenHolderCountKey(contractAddress), common.Uint64ToBytes(holderCount))
+		if err != nil {
+			log.Error("processTokenBalances txnBatch.Put holderCount", "error", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// backfillTokenTransfers returns the token transfers to apply to the token
+// balances with an indexed block. While the token balances are rebuilt, the
+// stale balances are deleted first, then the transfers of up to
+// TokenBackfillBlocks earlier blocks, fetched with fetch, are returned with each
+// block. The transfers of the block itself are only returned once the replay
+// caught up with it, so that they are applied in order.
+func (c *CacheManager) backfillTokenTransfers(blockNumber uint64, transfers []*tokenTransfer, fetch func(number uint64) ([]*tokenTransfer, error), batch *ethdb.Batch) ([]*tokenTransfer, error) {
+	state, err := c.getBackfillState(TokenBalancesBackfill)
+	if err != nil {
+		return nil, err
+	}
+	if state.Version == TokenBalancesVersion {
+		return transfers, nil
+	}
+
+	if state.Cleared == false {
+		deleted, err := c.deleteStaleKeys(tokenBalanceKeyPrefixes, backfillDeleteLimit, batch)
+		if err != nil {
+			return nil, err
+		}
+		log.Info("Deleting stale token balances", "deleted", deleted, "block", blockNumber)
+		state.Cleared = deleted < backfillDeleteLimit
+		return nil, c.putBackfillState(TokenBalancesBackfill, state, batch)
+	}
+
+	to := state.Block + TokenBackfillBlocks
+	if to >= blockNumber {
+		to = blockNumber - 1
+	}
+	replayed := make([]*tokenTransfer, 0)
+	for number := state.Block + 1; number <= to; number++ {
+		blockTransfers, err := fetch(number)
+		if err != nil {
+			log.Error("backfillTokenTransfers fetch", "error", err, "block", number)
+			return nil, err
+		}
+		replayed = append(replayed, blockTransfers...)
+	}
+	state.Block = to
+	if to+1 == blockNumber {
+		replayed = append(replayed, transfers...)
+		state = &backfillState{Version: TokenBalancesVersion}
+		log.Info("Token balances rebuilt", "block", blockNumber)
+	} else {
+		log.Info("Rebuilding token balances", "block", to, "head", blockNumber)
+	}
+	if err := c.putBackfillState(TokenBalancesBackfill, state, batch); err != nil {
+		return nil, err
+	}
+	return replayed, nil
+}
+
+// fetchTokenTransfers fetches the token transfers of an indexed block from the
+// node.
+func (c *CacheManager) fetchTokenTransfers(number uint64) ([]*tokenTransfer, error) {
+	ctx := context.Background()
+	var receipts types.Receipts
+	err := c.withNodeClient(func(client *ethclient.Client) error {
+		block, err := client.BlockByNumber(ctx, new(big.Int).SetUint64(number))
+		if err != nil {
+			return err
+		}
+		if indexedHash, ok := c.getIndexedBlockHash(number); ok && indexedHash.IsEqualTo(block.Hash()) == false {
+			return errBlockChanged
+		}
+		receipts, err = fetchReceipts(ctx, client, block)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	transfers := make([]*tokenTransfer, 0)
+	for _, receipt := range receipts {
+		transfers = append(transfers, tokenTransfers(receipt)...)
+	}
+	return transfers, nil
+}
+
+// ListTokensByAccount returns a page of the tokens held by an account, with the
+// balance and the details of each token. Pages start at 1.
+func (c *CacheManager) ListTokensByAccount(accountAddress common.Address, pageNumberInput int64) (ListAccountTokensResponse, error) {
+	address := strings.ToLower(accountAddress.Hex())
+
+	complete, err := c.isBackfilled(TokenBalancesBackfill, TokenBalancesVersion)
+	if err != nil {
+		return ListAccountTokensResponse{}, err
+	}
+	tokens, err := c.getAccountTokens(address)
+	if err != nil {
+		log.Error("ListTokensByAccount getAccountTokens", "error", err)
+		return ListAccountTokensResponse{}, err
+	}
+	pageCount := getPageCount(uint64(len(tokens)))
+	if pageCount == 0 {
+		return ListAccountTokensResponse{PageCount: 0, Items: make([]AccountTokenCompact, 0), Incomplete: complete == false}, nil
+	}
+
+	pageNumber := uint64(1)
+	if pageNumberInput > 0 {
+		pageNumber = uint64(pageNumberInput)
+	}
+	if pageNumber > pageCount {
+		return ListAccountTokensResponse{PageCount: pageCount, Items: make([]AccountTokenCompact, 0), Incomplete: complete == false}, nil
+	}
+
+	start := (pageNumber - 1) * PageSize
+	end := start + PageSize
+	if end > uint64(len(tokens)) {
+		end = uint64(len(tokens))
+	}
+
+	items := make([]AccountTokenCompact, 0, end-start)
+	for _, contractAddress := range tokens[start:end] {
+		balance, err := c.getAccountTokenBalance(address, contractAddress)
+		if err != nil {
+			log.Error("ListTokensByAccount getAccountTokenBalance", "error", err)
+			return ListAccountTokensResponse{}, err
+		}
+		item := AccountTokenCompact{
+			ContractAddress: contractAddress,
+			Balance:         hexutil.EncodeBig(balance),
+		}
+		// Tokens created before the cache was created have no details
+		if tokenDetails, err := c.GetTokenDetails(contractAddress); err == nil {
+			item.Name = tokenDetails.Result.Name
+			item.Symbol = tokenDetails.Result.Symbol
+			item.Decimals = tokenDetails.Result.Decimals
+		}
+		items = append(items, item)
+	}
+
+	return ListAccountTokensResponse{PageCount: pageCount, Items: items, Incomplete: complete == false}, nil
+}
+
+// GetTokenHolders returns the number of accounts holding a token.
+func (c *CacheManager) GetTokenHolders(contractAddress string) (*GetTokenHoldersResponse, error) {
+	contractAddress = strings.ToLower(contractAddress)
+	holderCount, err := c.getTokenHolderCount(contractAddress)
+	if err != nil {
+		return nil, err
+	}
+	complete, err := c.isBackfilled(TokenBalancesBackfill, TokenBalancesVersion)
+	if err != nil {
+		return nil, err
+	}
+	return &GetTokenHoldersResponse{
+		Result: TokenHolders{
+			ContractAddress: contractAddress,
+			HolderCount:     holderCount,
+			Incomplete:      complete == false,
+		},
+	}, nil
+}
@@ -0,0 +1,132 @@
+package cachemanager
+
+import (
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestTokenBalances(t *testing.T) {
+	c := &CacheManager{cacheDb: rawdb.NewMemoryDatabase(), metrics: newIndexerMetrics()}
+	token := common.BytesToAddress([]byte{0x10})
+	alice := common.BytesToAddress([]byte{0x01})
+	bob := common.BytesToAddress([]byte{0x02})
+	transfer := func(from, to common.Address, value int64) *tokenTransfer {
+		return &tokenTransfer{contract: token, from: from, to: to, value: big.NewInt(value)}
+	}
+	holders := func() uint64 {
+		response, err := c.GetTokenHolders(token.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response.Result.HolderCount
+	}
+
+	// Mint to alice, who sends part to bob in the same block
+	applyBatch(t, c, 1, func(batch *ethdb.Batch) error {
+		return c.processTokenBalances([]*tokenTransfer{transfer(common.ZERO_ADDRESS, alice, 100), transfer(alice, bob, 40)}, batch)
+	})
+	if count := holders(); count != 2 {
+		t.Fatalf("holder count %d, want 2", count)
+	}
+	list, err := c.ListTokensByAccount(bob, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.PageCount != 1 || len(list.Items) != 1 || list.Items[0].Balance != "0x28" || list.Items[0].ContractAddress != strings.ToLower(token.Hex()) {
+		t.Fatalf("unexpected token list %+v", list)
+	}
+
+	// Bob sends everything back and no longer holds the token
+	applyBatch(t, c, 2, func(batch *ethdb.Batch) error {
+		return c.processTokenBalances([]*tokenTransfer{transfer(bob, alice, 40)}, batch)
+	})
+	if count := holders(); count != 1 {
+		t.Fatalf("holder count %d, want 1", count)
+	}
+	if list, _ := c.ListTokensByAccount(bob, 1); list.PageCount != 0 {
+		t.Fatalf("unexpected token list %+v", list)
+	}
+
+	// Rolling the block back restores bob's balance
+	if err := c.rollbackBlock(2); err != nil {
+		t.Fatal(err)
+	}
+	if count := holders(); count != 2 {
+		t.Fatalf("holder count %d after rollback, want 2", count)
+	}
+	if list, _ := c.ListTokensByAccount(bob, 1); len(list.Items) != 1 || list.Items[0].Balance != "0x28" {
+		t.Fatalf("unexpected token list after rollback %+v", list)
+	}
+}
+
+func TestTokenBalancesBackfill(t *testing.T) {
+	c := &CacheManager{cacheDb: rawdb.NewMemoryDatabase(), metrics: newIndexerMetrics()}
+	token := common.BytesToAddress([]byte{0x10})
+	alice := common.BytesToAddress([]byte{0x01})
+	bob := common.BytesToAddress([]byte{0x02})
+	transfer := func(from, to common.Address, value int64) *tokenTransfer {
+		return &tokenTransfer{contract: token, from: from, to: to, value: big.NewInt(value)}
+	}
+	history := map[uint64][]*tokenTransfer{
+		1: {transfer(common.ZERO_ADDRESS, alice, 100)},
+		2: {transfer(alice, bob, 40)},
+		3: {},
+		4: {transfer(bob, alice, 10)},
+	}
+	fetch := func(number uint64) ([]*tokenTransfer, error) {
+		return history[number], nil
+	}
+	index := func(number uint64) {
+		applyBatch(t, c, number, func(batch *ethdb.Batch) error {
+			transfers, err := c.backfillTokenTransfers(number, history[number], fetch, batch)
+			if err != nil {
+				return err
+			}
+			return c.processTokenBalances(transfers, batch)
+		})
+	}
+	tokens := func(account common.Address) ListAccountTokensResponse {
+		list, err := c.ListTokensByAccount(account, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+
+	// Balances indexed before token balances were versioned only saw block 2
+	applyBatch(t, c, 2, func(batch *ethdb.Batch) error {
+		return c.processTokenBalances(history[2], batch)
+	})
+	if list := tokens(bob); list.Incomplete == false {
+		t.Fatalf("unversioned token balances not marked incomplete %+v", list)
+	}
+
+	// The stale balances are deleted first, then blocks 1 to 3 are replayed
+	// along with block 4
+	index(3)
+	if list := tokens(bob); list.Incomplete == false || len(list.Items) != 0 {
+		t.Fatalf("unexpected token list while rebuilding %+v", list)
+	}
+	index(4)
+	if list := tokens(bob); list.Incomplete || len(list.Items) != 1 || list.Items[0].Balance != "0x1e" {
+		t.Fatalf("unexpected token list after rebuilding %+v", list)
+	}
+	if list := tokens(alice); len(list.Items) != 1 || list.Items[0].Balance != "0x46" {
+		t.Fatalf("unexpected token list after rebuilding %+v", list)
+	}
+	if response, err := c.GetTokenHolders(token.Hex()); err != nil || response.Result.HolderCount != 2 || response.Result.Incomplete {
+		t.Fatalf("unexpected holders %+v, %v", response, err)
+	}
+
+	// Rolling the block back also rolls back the replay
+	if err := c.rollbackBlock(4); err != nil {
+		t.Fatal(err)
+	}
+	if list := tokens(bob); list.Incomplete == false || len(list.Items) != 0 {
+		t.Fatalf("unexpected token list after rollback %+v", list)
+	}
+}
@@ -0,0 +1,133 @@
+package cachemanager
+
+import (
+	"context"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/crypto"
+	"github.com/QuantumCoinProject/qc/ethclient"
+	"github.com/QuantumCoinProject/qc/log"
+	"math/big"
+	"strings"
+)
+
+// TransferEventTopic is the topic of the ERC-20 Transfer(address,address,uint256) event.
+var TransferEventTopic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+// tokenTransfer is a token transfer decoded from a Transfer log.
+type tokenTransfer struct {
+	contract common.Address
+	from     common.Address
+	to       common.Address
+	value    *big.Int
+}
+
+// decodeTokenTransfer decodes an ERC-20 Transfer log. Logs of other events and
+// ERC-721 transfers, which index the token id, are not decoded.
+func decodeTokenTransfer(l *types.Log) (*tokenTransfer, bool) {
+	if len(l.Topics) != 3 || l.Topics[0] != TransferEventTopic || len(l.Data) != 32 {
+		return nil, false
+	}
+	return &tokenTransfer{
+		contract: l.Address,
+		from:     common.BytesToAddress(l.Topics[1].Bytes()),
+		to:       common.BytesToAddress(l.Topics[2].Bytes()),
+		value:    new(big.Int).SetBytes(l.Data),
+	}, true
+}
+
+// tokenTransfers returns the token transfers of a transaction.
+func tokenTransfers(receipt *types.Receipt) []*tokenTransfer {
+	transfers := make([]*tokenTransfer, 0)
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return transfers
+	}
+	for _, l := range receipt.Logs {
+		if transfer, ok := decodeTokenTransfer(l); ok {
+			transfers = append(transfers, transfer)
+		}
+	}
+	return transfers
+}
+
+// needsTrace reports whether a transaction can make internal value transfers.
+func needsTrace(tx *types.Transaction, receipt *types.Receipt) bool {
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		return false
+	}
+	return tx.To() == nil || len(tx.Data()) > 0
+}
+
+// traceInternalTransactions traces the contract calls of a block. Transactions
+// that cannot make internal transfers are not traced and have a nil trace.
+func (c *CacheManager) traceInternalTransactions(client *ethclient.Client, txs types.Transactions, receipts types.Receipts) ([]*ethclient.InternalTransactionDetails, error) {
+	traces := make([]*ethclient.InternalTransactionDetails, len(txs))
+	for i, tx := range txs {
+		if needsTrace(tx, receipts[i]) == false {
+			continue
+		}
+		trace, err := client.GetInternalTransactions(context.Background(), tx.Hash())
+		if err != nil {
+			return nil, err
+		}
+		traces[i] = trace
+	}
+	return traces, nil
+}
+
+// internalTransfer is a value transfer made by a contract.
+type internalTransfer struct {
+	from  string
+	to    string
+	value *big.Int
+}
+
+// internalTransfers returns the value transfers made by the contract calls of a
+// transaction. The top level call, which is the transaction itself, calls that
+// failed and calls that do not move value are skipped.
+func internalTransfers(trace *ethclient.InternalTransactionDetails) []*internalTransfer {
+	transfers := make([]*internalTransfer, 0)
+	if trace == nil || len(trace.Error) > 0 {
+		return transfers
+	}
+	var walk func(calls []ethclient.InternalTransactionDetails)
+	walk = func(calls []ethclient.InternalTransactionDetails) {
+		for i := range calls {
+			call := &calls[i]
+			if len(call.Error) > 0 {
+				continue
+			}
+			switch strings.ToUpper(call.Type) {
+			case "CALL", "CREATE", "CREATE2", "SELFDESTRUCT":
+				value, err := hexutil.DecodeBig(call.Value)
+				if err != nil && len(call.Value) > 0 {
+					log.Warn("internalTransfers DecodeBig", "value", call.Value, "error", err)
+				}
+				if err == nil && value.Sign() > 0 && len(call.From) > 0 && len(call.To) > 0 {
+					transfers = append(transfers, &internalTransfer{
+						from:  strings.ToLower(call.From),
+						to:    strings.ToLower(call.To),
+						value: value,
+					})
+				}
+			}
+			walk(call.Calls)
+		}
+	}
+	walk(trace.Calls)
+	return transfers
+}
+
+// addAccountTransaction adds a transaction to the history of the given parties,
+// once per party.
+func addAccountTransaction(liveAccountMap map[string][]AccountTransactionCompact, transaction AccountTransactionCompact, addresses ...string) {
+	added := make(map[string]bool)
+	for _, address := range addresses {
+		if len(address) == 0 || added[address] {
+			continue
+		}
+		added[address] = true
+		liveAccountMap[address] = append(liveAccountMap[address], transaction)
+	}
+}
@@ -0,0 +1,75 @@
+package cachemanager
+
+import (
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/ethclient"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestTokenTransfers(t *testing.T) {
+	contract := common.BytesToAddress([]byte{0x01})
+	from := common.BytesToAddress([]byte{0x02})
+	to := common.BytesToAddress([]byte{0x03})
+	amount := common.LeftPadBytes(big.NewInt(1000).Bytes(), 32)
+
+	receipt := &types.Receipt{
+		Status: types.ReceiptStatusSuccessful,
+		Logs: []*types.Log{
+			{Address: contract, Topics: []common.Hash{TransferEventTopic, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes())}, Data: amount},
+			// ERC-721 transfer, the token id is indexed
+			{Address: contract, Topics: []common.Hash{TransferEventTopic, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes()), {}}},
+			// Other event
+			{Address: contract, Topics: []common.Hash{{0x01}, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes())}, Data: amount},
+		},
+	}
+	transfers := tokenTransfers(receipt)
+	if len(transfers) != 1 {
+		t.Fatalf("decoded %d transfers, want 1", len(transfers))
+	}
+	transfer := transfers[0]
+	if transfer.contract != contract || transfer.from != from || transfer.to != to || transfer.value.Int64() != 1000 {
+		t.Fatalf("unexpected transfer %+v", transfer)
+	}
+
+	receipt.Status = types.ReceiptStatusFailed
+	if transfers := tokenTransfers(receipt); len(transfers) != 0 {
+		t.Fatalf("decoded %d transfers of failed transaction", len(transfers))
+	}
+}
+
+func TestInternalTransfers(t *testing.T) {
+	trace := &ethclient.InternalTransactionDetails{
+		Type: "CALL", From: "0xA", To: "0xB", Value: "0x5",
+		Calls: []ethclient.InternalTransactionDetails{
+			{Type: "CALL", From: "0xB", To: "0xC", Value: "0x1", Calls: []ethclient.InternalTransactionDetails{
+				{Type: "CALL", From: "0xC", To: "0xD", Value: "0x2"},
+			}},
+			{Type: "STATICCALL", From: "0xB", To: "0xE"},
+			{Type: "DELEGATECALL", From: "0xB", To: "0xF", Value: "0x3"},
+			{Type: "CALL", From: "0xB", To: "0xC", Value: "0x0"},
+			{Type: "CALL", From: "0xB", To: "0xC", Value: "0x4", Error: "execution reverted", Calls: []ethclient.InternalTransactionDetails{
+				{Type: "CALL", From: "0xC", To: "0xD", Value: "0x4"},
+			}},
+			{Type: "SELFDESTRUCT", From: "0xB", To: "0xA", Value: "0x6"},
+		},
+	}
+	var got []string
+	for _, transfer := range internalTransfers(trace) {
+		got = append(got, transfer.from+">"+transfer.to+":"+transfer.value.String())
+	}
+	want := "0xb>0xc:1 0xc>0xd:2 0xb>0xa:6"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("got transfers %q, want %q", strings.Join(got, " "), want)
+	}
+
+	trace.Error = "out of gas"
+	if transfers := internalTransfers(trace); len(transfers) != 0 {
+		t.Fatalf("got %d transfers of failed transaction", len(transfers))
+	}
+	if transfers := internalTransfers(nil); len(transfers) != 0 {
+		t.Fatalf("got %d transfers without trace", len(transfers))
+	}
+}
@@ -0,0 +1,536 @@
+package cachemanager
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"github.com/QuantumCoinProject/qc/event"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/metrics"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var WebhookKey = "webhook-%s" //%s is webhook id
+var WebhookKeyPrefix = "webhook-"
+
+const (
+	WebhookIdHeader        = "X-Webhook-Id"
+	WebhookEventIdHeader   = "X-Webhook-Event-Id"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+
+	// WebhookMaxAttempts is the number of times an event is posted to a webhook
+	// before it is dropped.
+	WebhookMaxAttempts = 8
+
+	// WebhookQueueSize is the number of events queued for a webhook. Events
+	// posted to a webhook whose queue is full are dropped.
+	WebhookQueueSize = 256
+
+	webhookRetryDelay = time.Second // Doubled after each failed attempt
+	webhookTimeout    = 10 * time.Second
+	webhookEventQueue = 4096
+)
+
+var (
+	ErrWebhookNotFound = errors.New("webhook not found")
+	ErrWebhookUrl      = errors.New("invalid webhook url")
+	ErrWebhookEvent    = errors.New("invalid webhook event type")
+	ErrWebhookAddress  = errors.New("invalid webhook address")
+	ErrWebhookHost     = errors.New("webhook host is not a public address")
+)
+
+// defaultWebhookEvents are the events posted to a webhook registered without a
+// list of event types.
+var defaultWebhookEvents = []EventType{EVENT_TRANSACTION, EVENT_TOKEN_TRANSFER, EVENT_BLOCK_REMOVED}
+
+// Webhook is a callback url that receives the events of a set of addresses.
+// Each request is signed with the secret of the webhook. Events are delivered
+// at most once; the events of blocks indexed while the relay is down, or
+// dropped from a full queue, are not posted.
+type Webhook struct {
+	Id        string      `json:"id"`
+	Url       string      `json:"url"`
+	Secret    string      `json:"secret,omitempty"`
+	Addresses []string    `json:"addresses"`
+	Events    []EventType `json:"events"`
+}
+
+func (w *Webhook) wants(ev *Event) bool {
+	for _, t := range w.Events {
+		if t == ev.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// SignWebhookPayload returns the signature of a webhook request, the hex encoded
+// HMAC-SHA256 of the timestamp header, a dot and the body.
+func SignWebhookPayload(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+type webhookDelivery struct {
+	hook    *Webhook
+	ev      *Event
+	body    []byte
+	attempt int
+}
+
+// webhookQueue holds the deliveries of a webhook, posted one after another by
+// its own worker so that a slow webhook does not delay the others.
+type webhookQueue struct {
+	deliveries chan *webhookDelivery
+	quit       chan struct{}
+}
+
+// webhookManager stores the registered webhooks and posts the events of the
+// indexer to them, retrying failed requests with an increasing delay. Queued
+// deliveries are kept in memory only, and are lost when the relay stops.
+type webhookManager struct {
+	db        ethdb.Database
+	lock      sync.RWMutex
+	hooks     map[string]*Webhook
+	byAddress map[string]map[string]*Webhook // address to webhook id to webhook
+	queues    map[string]*webhookQueue       // webhook id to delivery queue
+	client    *http.Client
+	retryBase time.Duration
+	sub       event.Subscription
+	dropped   metrics.Meter // Events dropped because the queue of a webhook was full
+
+	// allowPrivate allows webhooks on loopback and private addresses, for tests.
+	allowPrivate bool
+}
+
+func newWebhookManager(db ethdb.Database) (*webhookManager, error) {
+	m := &webhookManager{
+		db:        db,
+		hooks:     make(map[string]*Webhook),
+		byAddress: make(map[string]map[string]*Webhook),
+		queues:    make(map[string]*webhookQueue),
+		retryBase: webhookRetryDelay,
+		dropped:   metrics.GetOrRegisterMeter("relay/webhooks/dropped", nil),
+	}
+	// Addresses are checked again when connecting, since the host name of a
+	// webhook can resolve to another address than at registration, and
+	// redirects can point anywhere.
+	dialer := &net.Dialer{Timeout: webhookTimeout, Control: m.checkDialAddress}
+	m.client = &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+			MaxIdleConnsPerHost: 2,
+		},
+	}
+	it := db.NewIterator([]byte(WebhookKeyPrefix), nil)
+	defer it.Release()
+	for it.Next() {
+		var hook Webhook
+		if err := json.Unmarshal(it.Value(), &hook); err != nil {
+			return nil, err
+		}
+		m.add(&hook)
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	log.Info("Loaded webhooks", "count", len(m.hooks))
+	return m, nil
+}
+
+// start posts the events of the feed to the webhooks until stop is called.
+func (m *webhookManager) start(feed *event.Feed) {
+	events := make(chan *Event, webhookEventQueue)
+	m.sub = feed.Subscribe(events)
+	go func() {
+		for {
+			select {
+			case ev := <-events:
+				for _, hook := range m.matching(ev) {
+					body, err := json.Marshal(ev)
+					if err != nil {
+						log.Error("webhook json.Marshal", "error", err)
+						continue
+					}
+					m.enqueue(&webhookDelivery{hook: hook, ev: ev, body: body})
+				}
+			case <-m.sub.Err():
+				return
+			}
+		}
+	}()
+}
+
+func (m *webhookManager) stop() {
+	if m.sub != nil {
+		m.sub.Unsubscribe()
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for id, queue := range m.queues {
+		close(queue.quit)
+		delete(m.queues, id)
+	}
+}
+
+// enqueue queues a delivery without blocking. The delivery is dropped if the
+// queue of the webhook is full.
+func (m *webhookManager) enqueue(d *webhookDelivery) {
+	m.lock.Lock()
+	if _, exists := m.hooks[d.hook.Id]; exists == false {
+		m.lock.Unlock()
+		return
+	}
+	queue, ok := m.queues[d.hook.Id]
+	if ok == false {
+		queue = &webhookQueue{
+			deliveries: make(chan *webhookDelivery, WebhookQueueSize),
+			quit:       make(chan struct{}),
+		}
+		m.queues[d.hook.Id] = queue
+		go m.deliverLoop(queue)
+	}
+	m.lock.Unlock()
+
+	select {
+	case queue.deliveries <- d:
+	default:
+		m.dropped.Mark(1)
+		log.Warn("Webhook queue full, event dropped", "webhook", d.hook.Id, "event", d.ev.Id)
+	}
+}
+
+// deliverLoop posts the deliveries of a webhook in order, retrying each failed
+// delivery before moving to the next one.
+func (m *webhookManager) deliverLoop(queue *webhookQueue) {
+	for {
+		select {
+		case d := <-queue.deliveries:
+			m.deliverWithRetries(d, queue.quit)
+		case <-queue.quit:
+			return
+		}
+	}
+}
+
+func (m *webhookManager) deliverWithRetries(d *webhookDelivery, quit chan struct{}) {
+	for {
+		err := m.deliver(d)
+		if err == nil {
+			return
+		}
+		d.attempt++
+		if d.attempt >= WebhookMaxAttempts {
+			log.Error("Webhook delivery failed", "webhook", d.hook.Id, "event", d.ev.Id, "attempts", d.attempt, "error", err)
+			return
+		}
+		delay := m.retryBase << uint(d.attempt-1)
+		log.Warn("Webhook delivery failed, retrying", "webhook", d.hook.Id, "event", d.ev.Id, "attempt", d.attempt, "delay", delay, "error", err)
+		select {
+		case <-time.After(delay):
+		case <-quit:
+			return
+		}
+	}
+}
+
+// matching returns the webhooks an event is posted to. Account events are
+// posted to the webhooks registered for the account, block events to all
+// webhooks that want them.
+func (m *webhookManager) matching(ev *Event) []*Webhook {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	hooks := make([]*Webhook, 0)
+	if len(ev.Address) > 0 {
+		for _, hook := range m.byAddress[ev.Address] {
+			if hook.wants(ev) {
+				hooks = append(hooks, hook)
+			}
+		}
+		return hooks
+	}
+	for _, hook := range m.hooks {
+		if hook.wants(ev) {
+			hooks = append(hooks, hook)
+		}
+	}
+	return hooks
+}
+
+func (m *webhookManager) deliver(d *webhookDelivery) error {
+	m.lock.RLock()
+	_, exists := m.hooks[d.hook.Id]
+	m.lock.RUnlock()
+	if exists == false {
+		return nil // Deleted while the event was queued
+	}
+
+	req, err := http.NewRequest(http.MethodPost, d.hook.Url, bytes.NewReader(d.body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookIdHeader, d.hook.Id)
+	req.Header.Set(WebhookEventIdHeader, d.ev.Id)
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookPayload(d.hook.Secret, timestamp, d.body))
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (m *webhookManager) add(hook *Webhook) {
+	m.hooks[hook.Id] = hook
+	for _, address := range hook.Addresses {
+		if m.byAddress[address] == nil {
+			m.byAddress[address] = make(map[string]*Webhook)
+		}
+		m.byAddress[address][hook.Id] = hook
+	}
+}
+
+func (m *webhookManager) remove(hook *Webhook) {
+	delete(m.hooks, hook.Id)
+	for _, address := range hook.Addresses {
+		delete(m.byAddress[address], hook.Id)
+		if len(m.byAddress[address]) == 0 {
+			delete(m.byAddress, address)
+		}
+	}
+}
+
+func (m *webhookManager) put(hook *Webhook) error {
+	blob, err := json.Marshal(hook)
+	if err != nil {
+		return err
+	}
+	return m.db.Put([]byte(fmt.Sprintf(WebhookKey, hook.Id)), blob)
+}
+
+// isPublicIP reports whether ip is a public unicast address. Loopback, private,
+// link-local, unspecified and multicast addresses are not.
+func isPublicIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast()
+}
+
+// checkWebhookHost checks that the host of a webhook url only resolves to public
+// addresses, so that webhooks cannot be used to reach the network of the relay.
+func (m *webhookManager) checkWebhookHost(host string) error {
+	if m.allowPrivate {
+		return nil
+	}
+	ips, err := net.DefaultResolver.LookupIP(context.Background(), "ip", host)
+	if err != nil || len(ips) == 0 {
+		return fmt.Errorf("%w %s", ErrWebhookUrl, host)
+	}
+	for _, ip := range ips {
+		if isPublicIP(ip) == false {
+			return fmt.Errorf("%w %s", ErrWebhookHost, host)
+		}
+	}
+	return nil
+}
+
+// checkDialAddress rejects connections of webhook requests to non public
+// addresses.
+func (m *webhookManager) checkDialAddress(network string, address string, _ syscall.RawConn) error {
+	if m.allowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isPublicIP(ip) == false {
+		return fmt.Errorf("%w %s", ErrWebhookHost, host)
+	}
+	return nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func parseWebhookAddresses(addresses []string) ([]string, error) {
+	parsed := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		if common.IsHexAddressDeep(address) == false {
+			return nil, fmt.Errorf("%w %s", ErrWebhookAddress, address)
+		}
+		parsed = append(parsed, strings.ToLower(common.HexToAddress(address).Hex()))
+	}
+	return parsed, nil
+}
+
+func (m *webhookManager) register(hookUrl string, addresses []string, events []string) (*Webhook, error) {
+	u, err := url.Parse(hookUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Hostname()) == 0 {
+		return nil, ErrWebhookUrl
+	}
+	if err := m.checkWebhookHost(u.Hostname()); err != nil {
+		return nil, err
+	}
+	parsedAddresses, err := parseWebhookAddresses(addresses)
+	if err != nil {
+		return nil, err
+	}
+	eventTypes := make([]EventType, 0, len(events))
+	for _, e := range events {
+		if IsValidEventType(e) == false {
+			return nil, fmt.Errorf("%w %s", ErrWebhookEvent, e)
+		}
+		eventTypes = append(eventTypes, EventType(e))
+	}
+	if len(eventTypes) == 0 {
+		eventTypes = append(eventTypes, defaultWebhookEvents...)
+	}
+
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	hook := &Webhook{
+		Id:        id,
+		Url:       hookUrl,
+		Secret:    secret,
+		Addresses: parsedAddresses,
+		Events:    eventTypes,
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.put(hook); err != nil {
+		return nil, err
+	}
+	m.add(hook)
+	return hook, nil
+}
+
+func (m *webhookManager) addAddresses(id string, addresses []string) (*Webhook, error) {
+	parsedAddresses, err := parseWebhookAddresses(addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	hook, ok := m.hooks[id]
+	if ok == false {
+		return nil, ErrWebhookNotFound
+	}
+	updated := *hook
+	updated.Addresses = append([]string{}, hook.Addresses...)
+	for _, address := range parsedAddresses {
+		if _, exists := m.byAddress[address][id]; exists {
+			continue
+		}
+		updated.Addresses = append(updated.Addresses, address)
+	}
+	if err := m.put(&updated); err != nil {
+		return nil, err
+	}
+	m.remove(hook)
+	m.add(&updated)
+	return &updated, nil
+}
+
+func (m *webhookManager) get(id string) (*Webhook, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	hook, ok := m.hooks[id]
+	if ok == false {
+		return nil, ErrWebhookNotFound
+	}
+	return hook, nil
+}
+
+func (m *webhookManager) delete(id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	hook, ok := m.hooks[id]
+	if ok == false {
+		return ErrWebhookNotFound
+	}
+	if err := m.db.Delete([]byte(fmt.Sprintf(WebhookKey, id))); err != nil {
+		return err
+	}
+	m.remove(hook)
+	if queue, ok := m.queues[id]; ok {
+		close(queue.quit)
+		delete(m.queues, id)
+	}
+	return nil
+}
+
+// RegisterWebhook registers a url to receive the events of the given addresses.
+// The returned webhook includes the secret used to sign the requests, which is
+// not returned again. Without event types, confirmed and token transactions and
+// removed blocks are posted.
+func (c *CacheManager) RegisterWebhook(hookUrl string, addresses []string, events []string) (*Webhook, error) {
+	return c.webhooks.register(hookUrl, addresses, events)
+}
+
+// AddWebhookAddresses adds addresses to a webhook.
+func (c *CacheManager) AddWebhookAddresses(id string, addresses []string) (*Webhook, error) {
+	hook, err := c.webhooks.addAddresses(id, addresses)
+	if err != nil {
+		return nil, err
+	}
+	result := *hook
+	result.Secret = ""
+	return &result, nil
+}
+
+// GetWebhook returns a webhook, without its secret.
+func (c *CacheManager) GetWebhook(id string) (*Webhook, error) {
+	hook, err := c.webhooks.get(id)
+	if err != nil {
+		return nil, err
+	}
+	result := *hook
+	result.Secret = ""
+	return &result, nil
+}
+
+// DeleteWebhook deletes a webhook. Queued events are not posted anymore.
+func (c *CacheManager) DeleteWebhook(id string) error {
+	return c.webhooks.delete(id)
+}
@@ -0,0 +1,130 @@
+package cachemanager
+
+import (
+	"errors"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/ethclient"
+	"github.com/QuantumCoinProject/qc/event"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookDelivery(t *testing.T) {
+	type request struct {
+		eventId string
+		valid   bool
+	}
+	var attempts int32
+	requests := make(chan request, 10)
+	var secret atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Fail the first attempt to exercise the retry
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		signature := SignWebhookPayload(secret.Load().(string), r.Header.Get(WebhookTimestampHeader), body)
+		requests <- request{r.Header.Get(WebhookEventIdHeader), signature == r.Header.Get(WebhookSignatureHeader)}
+	}))
+	defer server.Close()
+
+	db := rawdb.NewMemoryDatabase()
+	m, err := newWebhookManager(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.retryBase = 10 * time.Millisecond
+	m.allowPrivate = true
+	var feed event.Feed
+	m.start(&feed)
+	defer m.stop()
+
+	address := common.BytesToAddress([]byte{0x01})
+	hook, err := m.register(server.URL, []string{address.Hex()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret.Store(hook.Secret)
+	if _, err := m.register("ftp://example.com", nil, nil); !errors.Is(err, ErrWebhookUrl) {
+		t.Fatalf("unexpected error %v, want %v", err, ErrWebhookUrl)
+	}
+
+	// Webhooks cannot post to loopback, private or link-local addresses
+	guarded, err := newWebhookManager(rawdb.NewMemoryDatabase())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hookUrl := range []string{server.URL, "http://localhost/", "http://10.0.0.1/hook", "http://169.254.169.254/", "http://[::1]:8080/"} {
+		if _, err := guarded.register(hookUrl, nil, nil); !errors.Is(err, ErrWebhookHost) {
+			t.Errorf("%s: unexpected error %v, want %v", hookUrl, err, ErrWebhookHost)
+		}
+	}
+	if _, err := guarded.client.Get(server.URL); !errors.Is(err, ErrWebhookHost) {
+		t.Fatalf("unexpected error %v, want %v", err, ErrWebhookHost)
+	}
+
+	// Events of other addresses and unwanted types are not posted
+	other := strings.ToLower(common.BytesToAddress([]byte{0x02}).Hex())
+	own := strings.ToLower(address.Hex())
+	feed.Send(&Event{Id: "other", Type: EVENT_TRANSACTION, Address: other})
+	feed.Send(&Event{Id: "block", Type: EVENT_NEW_BLOCK})
+	feed.Send(&Event{Id: "own", Type: EVENT_TRANSACTION, Address: own})
+
+	select {
+	case req := <-requests:
+		if req.eventId != "own" || req.valid == false {
+			t.Fatalf("unexpected request %+v", req)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not delivered")
+	}
+	if n := atomic.LoadInt32(&attempts); n != 2 {
+		t.Fatalf("delivered after %d attempts, want 2", n)
+	}
+
+	// Webhooks are loaded again from the database
+	reloaded, err := newWebhookManager(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := reloaded.get(hook.Id); err != nil || got.Secret != hook.Secret || len(reloaded.byAddress[own]) != 1 {
+		t.Fatalf("webhook not reloaded: %v %+v", err, got)
+	}
+	if err := m.delete(hook.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.get(hook.Id); !errors.Is(err, ErrWebhookNotFound) {
+		t.Fatalf("unexpected error %v, want %v", err, ErrWebhookNotFound)
+	}
+}
+
+func TestPendingEvents(t *testing.T) {
+	from := common.BytesToAddress([]byte{0x01})
+	to := common.BytesToAddress([]byte{0x02})
+	tx := func(hash byte, to *common.Address) *ethclient.TxPoolTransaction {
+		return &ethclient.TxPoolTransaction{From: from, To: to, Value: (*hexutil.Big)(big.NewInt(1)), Hash: common.Hash{hash}}
+	}
+	content := map[string]map[string]map[string]*ethclient.TxPoolTransaction{
+		"pending": {from.Hex(): {"0": tx(1, &to), "1": tx(2, &from)}},
+	}
+	events, seen := pendingEvents(content, nil)
+	if len(events) != 3 || len(seen) != 2 {
+		t.Fatalf("got %d events for %d transactions, want 3 for 2", len(events), len(seen))
+	}
+
+	// Only the new transaction is notified
+	content["queued"] = map[string]map[string]*ethclient.TxPoolTransaction{from.Hex(): {"5": tx(3, nil)}}
+	events, seen = pendingEvents(content, seen)
+	if len(events) != 1 || events[0].PendingTransaction.Hash != (common.Hash{3}).Hex() || len(seen) != 3 {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
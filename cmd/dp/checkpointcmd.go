@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strconv"
+
+	"github.com/QuantumCoinProject/qc/accounts/keystore"
+	"github.com/QuantumCoinProject/qc/cmd/utils"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/consensus/proofofstake"
+	"github.com/QuantumCoinProject/qc/params"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	checkpointCommand = cli.Command{
+		Name:      "checkpoint",
+		Usage:     "Create and sign trusted checkpoints of the chain",
+		ArgsUsage: "",
+		Category:  "MISCELLANEOUS COMMANDS",
+		Description: `
+Checkpoints commit to a section of the canonical chain (the section head, the CHT
+and bloom trie roots) and to the validator set at its head. A checkpoint is
+trusted once validators holding a quorum of the stake of the previous checkpoint,
+or of the genesis block for the first one, have signed it. Nodes started with
+--checkpoint.file verify the signatures and start syncing from the latest
+checkpoint in the file. On an empty chain, fast sync fetches its section head
+from a peer that has it, checks it against the signed hash and downloads and
+verifies the headers, blocks and state after it, skipping the history before it.
+This needs the freezer to be disabled (the default). Otherwise, and in full sync
+mode, the checkpoint is enforced: the local chain must contain its section head
+and peers that do not have it are dropped during the sync handshake.`,
+		Subcommands: []cli.Command{
+			checkpointCreateCommand,
+			checkpointSignCommand,
+		},
+	}
+	checkpointCreateCommand = cli.Command{
+		Action:    utils.MigrateFlags(createCheckpoint),
+		Name:      "create",
+		Usage:     "Append the checkpoint of a section to a checkpoint file",
+		ArgsUsage: "<checkpoint file> [section] [endpoint]",
+		Description: `
+Asks a running node for the checkpoint of the given section, or of the latest
+complete section, and appends it unsigned to the checkpoint file, creating the
+file if needed. The node is reached at the given endpoint or its default IPC path.`,
+	}
+	checkpointSignCommand = cli.Command{
+		Action:    utils.MigrateFlags(signCheckpoint),
+		Name:      "sign",
+		Usage:     "Sign the latest checkpoint of a checkpoint file with a validator key",
+		ArgsUsage: "<checkpoint file> <keyfile>",
+		Flags: []cli.Flag{
+			utils.PasswordFileFlag,
+		},
+		Description: `
+Adds the signature of the validator key in the keyfile to the last checkpoint of
+the checkpoint file and prints the stake that has signed it so far.`,
+	}
+)
+
+func readCheckpoints(path string) ([]*params.ValidatorCheckpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var checkpoints []*params.ValidatorCheckpoint
+	if err := json.Unmarshal(data, &checkpoints); err != nil {
+		return nil, err
+	}
+	return checkpoints, nil
+}
+
+func writeCheckpoints(path string, checkpoints []*params.ValidatorCheckpoint) error {
+	data, err := json.MarshalIndent(checkpoints, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func createCheckpoint(ctx *cli.Context) error {
+	if ctx.NArg() < 1 || ctx.NArg() > 3 {
+		utils.Fatalf("Usage: dp checkpoint create <checkpoint file> [section] [endpoint]")
+	}
+	path := ctx.Args().Get(0)
+	client, err := dialRPC(ctx.Args().Get(2))
+	if err != nil {
+		utils.Fatalf("Unable to attach to node: %v", err)
+	}
+	defer client.Close()
+
+	var section uint64
+	if arg := ctx.Args().Get(1); arg != "" {
+		if section, err = strconv.ParseUint(arg, 0, 64); err != nil {
+			utils.Fatalf("Invalid section %s: %v", arg, err)
+		}
+	} else {
+		var head hexutil.Uint64
+		if err := client.Call(&head, "eth_blockNumber"); err != nil {
+			utils.Fatalf("Failed to retrieve the chain head: %v", err)
+		}
+		if uint64(head)+1 < params.CHTFrequency {
+			utils.Fatalf("No complete checkpoint section, chain head is %d", head)
+		}
+		section = (uint64(head)+1)/params.CHTFrequency - 1
+	}
+
+	checkpoints, err := readCheckpoints(path)
+	if err != nil {
+		utils.Fatalf("Failed to read checkpoint file: %v", err)
+	}
+	if n := len(checkpoints); n > 0 && checkpoints[n-1].SectionIndex >= section {
+		utils.Fatalf("Checkpoint file already has section %d", checkpoints[n-1].SectionIndex)
+	}
+
+	checkpoint := new(params.ValidatorCheckpoint)
+	if err := client.Call(checkpoint, "proofofstake_getCheckpoint", hexutil.EncodeUint64(section)); err != nil {
+		utils.Fatalf("Failed to create checkpoint: %v", err)
+	}
+	if err := writeCheckpoints(path, append(checkpoints, checkpoint)); err != nil {
+		utils.Fatalf("Failed to write checkpoint file: %v", err)
+	}
+	fmt.Printf("Section:    %d\n", checkpoint.SectionIndex)
+	fmt.Printf("Head:       %d %s\n", checkpoint.SectionNumber(), checkpoint.SectionHead.Hex())
+	fmt.Printf("CHT root:   %s\n", checkpoint.CHTRoot.Hex())
+	fmt.Printf("Bloom root: %s\n", checkpoint.BloomRoot.Hex())
+	fmt.Printf("Validators: %d\n", len(checkpoint.Validators))
+	return nil
+}
+
+func signCheckpoint(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		utils.Fatalf("Usage: dp checkpoint sign <checkpoint file> <keyfile>")
+	}
+	path := ctx.Args().Get(0)
+	checkpoints, err := readCheckpoints(path)
+	if err != nil {
+		utils.Fatalf("Failed to read checkpoint file: %v", err)
+	}
+	if len(checkpoints) == 0 {
+		utils.Fatalf("No checkpoint to sign in %s", path)
+	}
+	checkpoint := checkpoints[len(checkpoints)-1]
+
+	keyjson, err := ioutil.ReadFile(ctx.Args().Get(1))
+	if err != nil {
+		utils.Fatalf("Failed to read the keyfile: %v", err)
+	}
+	password := utils.GetPassPhraseWithList("Validator key password:", false, 0, utils.MakePasswordList(ctx))
+	key, err := keystore.DecryptKey(keyjson, password)
+	if err != nil {
+		utils.Fatalf("Failed to decrypt the keyfile: %v", err)
+	}
+
+	signers, err := proofofstake.CheckpointSigners(checkpoint)
+	if err != nil {
+		utils.Fatalf("Checkpoint has invalid signatures: %v", err)
+	}
+	for _, signer := range signers {
+		if signer.IsEqualTo(key.Address) {
+			utils.Fatalf("Checkpoint already signed by %s", key.Address.Hex())
+		}
+	}
+	if err := proofofstake.SignCheckpoint(checkpoint, key.PrivateKey); err != nil {
+		utils.Fatalf("Failed to sign checkpoint: %v", err)
+	}
+	if err := writeCheckpoints(path, checkpoints); err != nil {
+		utils.Fatalf("Failed to write checkpoint file: %v", err)
+	}
+	fmt.Printf("Signed checkpoint of section %d with %s, %d signatures\n", checkpoint.SectionIndex, key.Address.Hex(), len(checkpoint.Signatures))
+
+	// The stake of the first checkpoint is checked against the genesis validators
+	// by the nodes, which are not known here.
+	if len(checkpoints) > 1 {
+		previous := make(map[common.Address]*big.Int)
+		for _, v := range checkpoints[len(checkpoints)-2].Validators {
+			previous[v.Address] = v.Deposit
+		}
+		signed, total, err := proofofstake.CheckpointSignedStake(checkpoint, previous)
+		if err != nil {
+			utils.Fatalf("Checkpoint has invalid signatures: %v", err)
+		}
+		fmt.Printf("Signed stake: %v of %v\n", signed, total)
+	}
+	return nil
+}
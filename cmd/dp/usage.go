@@ -54,6 +54,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.IdentityFlag,
 			utils.LightKDFFlag,
 			utils.WhitelistFlag,
+			utils.CheckpointFileFlag,
 			utils.FreezerModeFlag,
 		},
 	},
@@ -154,6 +155,8 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.ListenPortFlag,
 			utils.MaxPeersFlag,
 			utils.MaxPendingPeersFlag,
+			utils.MaxEgressRateFlag,
+			utils.MaxPeerEgressRateFlag,
 			utils.NATFlag,
 			utils.NoDiscoverFlag,
 			utils.DiscoveryV5Flag,
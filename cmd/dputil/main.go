@@ -11,10 +11,15 @@ import (
 	"github.com/QuantumCoinProject/qc/conversionutil"
 	"github.com/QuantumCoinProject/qc/crypto/crosssign"
 	"github.com/QuantumCoinProject/qc/crypto/cryptobase"
+	"github.com/QuantumCoinProject/qc/crypto/signaturealgorithm"
 	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/systemcontracts/conversion"
+	"github.com/QuantumCoinProject/qc/systemcontracts/governance"
+	"github.com/QuantumCoinProject/qc/systemcontracts/unbonding"
 	"io/ioutil"
 	"math/big"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -42,6 +47,15 @@ func printHelp() {
 	fmt.Println("      Set the following environment variables:")
 	fmt.Println("           DP_KEY_FILE")
 	fmt.Println("===========")
+	fmt.Println("dputil getcoinsfortokensbatch BATCH_JSON_FILE_NAME")
+	fmt.Println("      The file has a json array of {\"ethAddress\": ETH_ADDRESS, \"ethSignature\": ETH_SIGNATURE} entries")
+	fmt.Println("      Set the following environment variables:")
+	fmt.Println("           DP_RAW_URL, DP_KEY_FILE")
+	fmt.Println("===========")
+	fmt.Println("dputil conversionreport [unconverted]")
+	fmt.Println("      Set the following environment variables:")
+	fmt.Println("           DP_RAW_URL")
+	fmt.Println("===========")
 	fmt.Println("dputil balance ACCOUNT_ADDRESS")
 	fmt.Println("===========")
 	fmt.Println("dputil stakingdeposit DEPOSITOR_ADDRESS VALIDATOR_ADDRESS DEPOSITOR_AMOUNT")
@@ -101,6 +115,26 @@ func printHelp() {
 	fmt.Println("      Set the following environment variables:")
 	fmt.Println("           DP_RAW_URL, DP_KEY_FILE_DIR")
 	fmt.Println("===========")
+	fmt.Println("dputil governancepropose DEPOSITOR_ADDRESS PARAMETER VALUE EFFECTIVE_BLOCK")
+	fmt.Println("      PARAMETER is one of slashAmount (wei), txnFeeRewardsPercentage, gasTierPrice (wei),")
+	fmt.Println("      conversionDeadlineBlock, conversionUnclaimedAddress (as a decimal number)")
+	fmt.Println("      Set the following environment variables:")
+	fmt.Println("           DP_RAW_URL, DP_KEY_FILE_DIR")
+	fmt.Println("dputil governancevote DEPOSITOR_ADDRESS PROPOSAL_ID yes|no")
+	fmt.Println("      Set the following environment variables:")
+	fmt.Println("           DP_RAW_URL, DP_KEY_FILE_DIR")
+	fmt.Println("dputil governanceproposals")
+	fmt.Println("      Set the following environment variables:")
+	fmt.Println("           DP_RAW_URL")
+	fmt.Println("===========")
+	fmt.Println("dputil completeunbonding DEPOSITOR_ADDRESS TRANCHE_ID")
+	fmt.Println("      Set the following environment variables:")
+	fmt.Println("           DP_RAW_URL, DP_KEY_FILE_DIR")
+	fmt.Println("dputil exitunbondingearly DEPOSITOR_ADDRESS TRANCHE_ID")
+	fmt.Println("      Part of the tranche is burnt as a penalty, see getstakingdetails for the amount")
+	fmt.Println("      Set the following environment variables:")
+	fmt.Println("           DP_RAW_URL, DP_KEY_FILE_DIR")
+	fmt.Println("===========")
 	fmt.Println("===========")
 }
 
@@ -143,6 +177,16 @@ func main() {
 		if err != nil {
 			fmt.Println("Error", err)
 		}
+	} else if os.Args[1] == "getcoinsfortokensbatch" {
+		err := ConvertToCoinsBatch()
+		if err != nil {
+			fmt.Println("Error", err)
+		}
+	} else if os.Args[1] == "conversionreport" {
+		err := conversionReport(len(os.Args) > 2 && os.Args[2] == "unconverted")
+		if err != nil {
+			fmt.Println("Error", err)
+		}
 	} else if os.Args[1] == "stakingdeposit" {
 		err := Deposit()
 		if err != nil {
@@ -223,6 +267,31 @@ func main() {
 		if err != nil {
 			fmt.Println("Error", err)
 		}
+	} else if os.Args[1] == "governancepropose" {
+		err := GovernancePropose()
+		if err != nil {
+			fmt.Println("Error", err)
+		}
+	} else if os.Args[1] == "governancevote" {
+		err := GovernanceVote()
+		if err != nil {
+			fmt.Println("Error", err)
+		}
+	} else if os.Args[1] == "governanceproposals" {
+		err := listGovernanceProposals()
+		if err != nil {
+			fmt.Println("Error", err)
+		}
+	} else if os.Args[1] == "completeunbonding" {
+		err := Unbonding(unbonding.COMPLETE_METHOD)
+		if err != nil {
+			fmt.Println("Error", err)
+		}
+	} else if os.Args[1] == "exitunbondingearly" {
+		err := Unbonding(unbonding.EXIT_EARLY_METHOD)
+		if err != nil {
+			fmt.Println("Error", err)
+		}
 	} else {
 		printHelp()
 	}
@@ -638,6 +707,77 @@ func ConvertToCoins() error {
 	}
 }
 
+func ConvertToCoinsBatch() error {
+	if len(os.Args) < 3 {
+		printHelp()
+		return errors.New("incorrect usage")
+	}
+
+	data, err := ReadDataFile(os.Args[2])
+	if err != nil {
+		return err
+	}
+
+	var requests []*conversion.ConversionRequest
+	err = json.Unmarshal(data, &requests)
+	if err != nil {
+		return err
+	}
+	if len(requests) == 0 || len(requests) > conversion.MAX_CONVERSION_BATCH_SIZE {
+		return conversion.ErrConversionBatchSize
+	}
+
+	keyFile := os.Getenv("DP_KEY_FILE")
+	if len(keyFile) == 0 {
+		return errors.New("DP_KEY_FILE environment variable is not set")
+	}
+
+	fmt.Println(fmt.Sprintf("Quantum wallet address %s", keyFile))
+	accPwd, err := prompt.Stdin.PromptPassword(fmt.Sprintf("Enter the quantum wallet password : "))
+	if err != nil {
+		return err
+	}
+	if len(accPwd) == 0 {
+		return errors.New("password is not set")
+	}
+
+	key, err := GetKeyFromFile(keyFile, accPwd)
+	if err != nil {
+		return err
+	}
+
+	qAddr, err := cryptobase.SigAlg.PublicKeyToAddress(&key.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	for _, request := range requests {
+		if common.IsLegacyEthereumHexAddress(request.EthAddress) == false {
+			return errors.New("invalid EthAddress " + request.EthAddress)
+		}
+		if conversionutil.IsSnapshotAddress(request.EthAddress) == false {
+			return errors.New("unidentified eth address " + request.EthAddress)
+		}
+		err = conversionutil.VerifyConversionRequest(qAddr, request.EthAddress, request.EthSignature)
+		if err != nil {
+			fmt.Println("An error occurred while verifying the ethereum signature of", request.EthAddress)
+			return err
+		}
+	}
+
+	fmt.Println()
+	quantumConfirm, err := prompt.Stdin.PromptConfirm(fmt.Sprintf("Do you confirm that you want the coins of %d ETH addresses deposited to QUANTUM ADDRESS %s ?", len(requests), qAddr.Hex()))
+	if err != nil {
+		return err
+	}
+	if quantumConfirm != true {
+		return errors.New("confirmation not made")
+	}
+	fmt.Println()
+
+	return requestConversionBatch(key, requests)
+}
+
 func Deposit() error {
 	if len(os.Args) < 5 {
 		printHelp()
@@ -1482,3 +1622,123 @@ func TransferTokens() error {
 
 	return transferTokens(contractAddr, toAddr, tokenTransferAmount, fromKey)
 }
+
+func getDepositorKey(depositorAddr string) (*signaturealgorithm.PrivateKey, error) {
+	if len(os.Getenv("DP_KEY_FILE_DIR")) == 0 {
+		return nil, errors.New("set the keyfile directory environment variable DP_KEY_FILE_DIR")
+	}
+
+	if common.IsHexAddress(depositorAddr) == false {
+		return nil, errors.New("invalid depositor address " + depositorAddr)
+	}
+
+	depositorKeyFile, err := findKeyFile(depositorAddr)
+	if err != nil {
+		return nil, errors.New("error finding DEPOSITOR_ADDRESS in DP_KEY_FILE_DIR " + err.Error())
+	}
+
+	fmt.Println(fmt.Sprintf("Depositor wallet address %s", depositorKeyFile))
+	depositorPwd, err := prompt.Stdin.PromptPassword(fmt.Sprintf("Enter the depositor wallet password : "))
+	if err != nil {
+		return nil, err
+	}
+	if len(depositorPwd) == 0 {
+		return nil, errors.New("depositor password is not set")
+	}
+
+	depKey, err := GetKeyFromFile(depositorKeyFile, depositorPwd)
+	if err != nil {
+		return nil, errors.New("error decrypting depositor key " + err.Error())
+	}
+
+	depAddressFromKey, err := cryptobase.SigAlg.PublicKeyToAddress(&depKey.PublicKey)
+	if err != nil {
+		return nil, errors.New("depositor public key to address " + err.Error())
+	}
+
+	if !depAddressFromKey.IsEqualTo(common.HexToAddress(depositorAddr)) {
+		return nil, errors.New("depositor key address check failed")
+	}
+
+	return depKey, nil
+}
+
+func GovernancePropose() error {
+	if len(os.Args) < 6 {
+		printHelp()
+		return errors.New("incorrect usage")
+	}
+
+	parameter, err := governance.ParameterByName(os.Args[3])
+	if err != nil {
+		return err
+	}
+
+	value, ok := new(big.Int).SetString(os.Args[4], 10)
+	if ok == false {
+		return errors.New("invalid value " + os.Args[4])
+	}
+	err = governance.ValidateParameter(parameter, value)
+	if err != nil {
+		return err
+	}
+
+	effectiveBlock, err := strconv.ParseUint(os.Args[5], 10, 64)
+	if err != nil {
+		return errors.New("invalid effective block " + os.Args[5])
+	}
+
+	depKey, err := getDepositorKey(os.Args[2])
+	if err != nil {
+		return err
+	}
+
+	return governancePropose(depKey, parameter, value, effectiveBlock)
+}
+
+func GovernanceVote() error {
+	if len(os.Args) < 5 {
+		printHelp()
+		return errors.New("incorrect usage")
+	}
+
+	proposalId, err := strconv.ParseUint(os.Args[3], 10, 64)
+	if err != nil {
+		return errors.New("invalid proposal id " + os.Args[3])
+	}
+
+	var support bool
+	if os.Args[4] == "yes" {
+		support = true
+	} else if os.Args[4] == "no" {
+		support = false
+	} else {
+		return errors.New("vote should be yes or no")
+	}
+
+	depKey, err := getDepositorKey(os.Args[2])
+	if err != nil {
+		return err
+	}
+
+	return governanceVote(depKey, proposalId, support)
+}
+
+func Unbonding(method string) error {
+	if len(os.Args) < 4 {
+		printHelp()
+		return errors.New("incorrect usage")
+	}
+
+	trancheId, err := strconv.ParseUint(os.Args[3], 10, 64)
+	if err != nil {
+		return errors.New("invalid tranche id " + os.Args[3])
+	}
+
+	depKey, err := getDepositorKey(os.Args[2])
+	if err != nil {
+		return err
+	}
+
+	return unbondingTransact(depKey, method, trancheId)
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	ethereum "github.com/QuantumCoinProject/qc"
 	"github.com/QuantumCoinProject/qc/accounts"
 	"github.com/QuantumCoinProject/qc/accounts/abi/bind"
 	"github.com/QuantumCoinProject/qc/accounts/keystore"
@@ -17,10 +18,13 @@ import (
 	"github.com/QuantumCoinProject/qc/crypto/signaturealgorithm"
 	"github.com/QuantumCoinProject/qc/ethclient"
 	"github.com/QuantumCoinProject/qc/params"
+	"github.com/QuantumCoinProject/qc/rpc"
 	"github.com/QuantumCoinProject/qc/systemcontracts/conversion"
+	"github.com/QuantumCoinProject/qc/systemcontracts/governance"
 	"github.com/QuantumCoinProject/qc/systemcontracts/staking"
 	"github.com/QuantumCoinProject/qc/systemcontracts/staking/stakingv1"
 	"github.com/QuantumCoinProject/qc/systemcontracts/staking/stakingv2"
+	"github.com/QuantumCoinProject/qc/systemcontracts/unbonding"
 	"github.com/QuantumCoinProject/qc/token"
 	"io/ioutil"
 	"log"
@@ -1350,6 +1354,11 @@ func getStakingDetails(validatorAddress common.Address) error {
 		fmt.Println("Rewards coins ", weiToEther(stakingDetails.BlockRewards).String())
 		fmt.Println("Staking Balance coins ", weiToEther(stakingDetails.Balance).String())
 		fmt.Println("Net Balance coins ", weiToEther(stakingDetails.NetBalance).String())
+
+		err = printUnbondingTranches(validatorAddress)
+		if err != nil {
+			return err
+		}
 	}
 
 	fmt.Println()
@@ -1539,3 +1548,296 @@ func transferTokens(contractAddr string, toAddr string, tokenTransferAmount *big
 
 	return nil
 }
+
+func governanceTransact(key *signaturealgorithm.PrivateKey, method string, params ...interface{}) (*types.Transaction, error) {
+	client, err := ethclient.Dial(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	fromAddress, err := cryptobase.SigAlg.PublicKeyToAddress(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := client.PendingNonceAt(context.Background(), fromAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	txnOpts, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(123123))
+	if err != nil {
+		return nil, err
+	}
+
+	txnOpts.From = fromAddress
+	txnOpts.Nonce = big.NewInt(int64(nonce))
+	txnOpts.GasLimit = uint64(65000)
+
+	governanceAbi, err := governance.GetGovernanceContract_ABI()
+	if err != nil {
+		return nil, err
+	}
+
+	contract := bind.NewBoundContract(governance.GOVERNANCE_CONTRACT_ADDRESS, governanceAbi, client, client, client)
+	return contract.Transact(txnOpts, method, params...)
+}
+
+func governancePropose(key *signaturealgorithm.PrivateKey, parameter governance.Parameter, value *big.Int, effectiveBlock uint64) error {
+	tx, err := governanceTransact(key, governance.PROPOSE_METHOD, uint8(parameter), value, new(big.Int).SetUint64(effectiveBlock))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Your governance proposal has been added to the queue for processing.")
+	fmt.Println("The transaction hash for tracking this request is: ", tx.Hash())
+	fmt.Println()
+
+	time.Sleep(1000 * time.Millisecond)
+
+	return nil
+}
+
+func governanceVote(key *signaturealgorithm.PrivateKey, proposalId uint64, support bool) error {
+	tx, err := governanceTransact(key, governance.VOTE_METHOD, new(big.Int).SetUint64(proposalId), support)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Your governance vote has been added to the queue for processing.")
+	fmt.Println("The transaction hash for tracking this request is: ", tx.Hash())
+	fmt.Println()
+
+	time.Sleep(1000 * time.Millisecond)
+
+	return nil
+}
+
+func listGovernanceProposals() error {
+	if len(rawURL) == 0 {
+		return errors.New("DP_RAW_URL environment variable not specified")
+	}
+
+	client, err := rpc.Dial(rawURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var proposals []*proofofstake.GovernanceProposalDetails
+	err = client.CallContext(context.Background(), &proposals, "proofofstake_listGovernanceProposals", "")
+	if err != nil {
+		return err
+	}
+
+	for _, proposal := range proposals {
+		fmt.Println("Proposal", proposal.Id, "Proposer", proposal.Proposer, "Status", proposal.Status)
+		fmt.Println("    Parameter", proposal.Parameter, "Value", proposal.Value, "Effective Block", proposal.EffectiveBlock)
+		fmt.Println("    Voting End Block", proposal.EndBlock, "Voters", proposal.VoterCount, "Yes", proposal.YesWeight, "No", proposal.NoWeight)
+	}
+
+	fmt.Println()
+
+	return nil
+}
+
+func printUnbondingTranches(validatorAddress common.Address) error {
+	client, err := rpc.Dial(rawURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var validatorDetails *proofofstake.ValidatorDetails
+	err = client.CallContext(context.Background(), &validatorDetails, "proofofstake_getStakingDetailsByValidatorAddress", validatorAddress, "")
+	if err != nil {
+		return err
+	}
+
+	for _, tranche := range validatorDetails.UnbondingTranches {
+		amount, err := hexutil.DecodeBig(tranche.Amount)
+		if err != nil {
+			return err
+		}
+		penalty, err := hexutil.DecodeBig(tranche.EarlyExitPenalty)
+		if err != nil {
+			return err
+		}
+		maturityBlock, err := hexutil.DecodeUint64(tranche.MaturityBlock)
+		if err != nil {
+			return err
+		}
+		id, err := hexutil.DecodeUint64(tranche.Id)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Unbonding Tranche ", id, " coins ", weiToEther(amount).String(), " Maturity Block ", maturityBlock,
+			" Early Exit Penalty coins ", weiToEther(penalty).String())
+	}
+
+	return nil
+}
+
+func unbondingTransact(key *signaturealgorithm.PrivateKey, method string, trancheId uint64) error {
+	client, err := ethclient.Dial(rawURL)
+	if err != nil {
+		return err
+	}
+
+	fromAddress, err := cryptobase.SigAlg.PublicKeyToAddress(&key.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	nonce, err := client.PendingNonceAt(context.Background(), fromAddress)
+	if err != nil {
+		return err
+	}
+
+	txnOpts, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(123123))
+	if err != nil {
+		return err
+	}
+
+	txnOpts.From = fromAddress
+	txnOpts.Nonce = big.NewInt(int64(nonce))
+	txnOpts.GasLimit = uint64(65000)
+
+	unbondingAbi, err := unbonding.GetUnbondingContract_ABI()
+	if err != nil {
+		return err
+	}
+
+	contract := bind.NewBoundContract(unbonding.UNBONDING_CONTRACT_ADDRESS, unbondingAbi, client, client, client)
+	tx, err := contract.Transact(txnOpts, method, new(big.Int).SetUint64(trancheId))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Your unbonding request has been added to the queue for processing.")
+	fmt.Println("The transaction hash for tracking this request is: ", tx.Hash())
+	fmt.Println()
+
+	time.Sleep(1000 * time.Millisecond)
+
+	return nil
+}
+
+func requestConversionBatch(key *signaturealgorithm.PrivateKey, requests []*conversion.ConversionRequest) error {
+	if len(rawURL) == 0 {
+		return errors.New("DP_RAW_URL environment variable not specified")
+	}
+
+	client, err := ethclient.Dial(rawURL)
+	if err != nil {
+		return err
+	}
+
+	fromAddress, err := cryptobase.SigAlg.PublicKeyToAddress(&key.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	nonce, err := client.PendingNonceAt(context.Background(), fromAddress)
+	if err != nil {
+		return err
+	}
+
+	txnOpts, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(123123))
+	if err != nil {
+		return err
+	}
+
+	txnOpts.From = fromAddress
+	txnOpts.Nonce = big.NewInt(int64(nonce))
+
+	input, err := conversion.PackConversionBatch(requests)
+	if err != nil {
+		return err
+	}
+
+	contractAddress := conversion.CONVERSION_BATCH_CONTRACT_ADDRESS
+	gasLimit, err := client.EstimateGas(context.Background(), ethereum.CallMsg{From: fromAddress, To: &contractAddress, Data: input})
+	if err != nil {
+		return err
+	}
+
+	baseTx := types.NewDefaultFeeTransactionSimple(nonce, &contractAddress, nil, gasLimit, input)
+	signTx, err := txnOpts.Signer(txnOpts.From, types.NewTx(baseTx))
+	if err != nil {
+		return err
+	}
+
+	err = client.SendTransaction(context.Background(), signTx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Your batch request to get the quantum dp coins has been added to the queue for processing. Please check your account balance after 10 minutes.")
+	fmt.Println("The transaction hash for tracking this request is: ", signTx.Hash())
+	fmt.Println()
+
+	time.Sleep(1000 * time.Millisecond)
+
+	return nil
+}
+
+func conversionReport(unconvertedOnly bool) error {
+	if len(rawURL) == 0 {
+		return errors.New("DP_RAW_URL environment variable not specified")
+	}
+
+	client, err := rpc.Dial(rawURL)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	var report *proofofstake.ConversionReport
+	err = client.CallContext(context.Background(), &report, "proofofstake_getConversionReport", "")
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range report.Entries {
+		if unconvertedOnly && entry.Status != "unconverted" {
+			continue
+		}
+		coins, err := hexutil.DecodeBig(entry.Coins)
+		if err != nil {
+			return err
+		}
+		fmt.Println(entry.EthAddress.Hex(), entry.Status, "coins", weiToEther(coins).String(), "quantum address", entry.QuantumAddress.Hex())
+	}
+
+	fmt.Println()
+	for _, total := range []struct {
+		name  string
+		count string
+		coins string
+	}{
+		{"Converted", report.ConvertedCount, report.ConvertedCoins},
+		{"Unconverted", report.UnconvertedCount, report.UnconvertedCoins},
+		{"Expired", report.ExpiredCount, report.ExpiredCoins},
+	} {
+		count, err := hexutil.DecodeUint64(total.count)
+		if err != nil {
+			return err
+		}
+		coins, err := hexutil.DecodeBig(total.coins)
+		if err != nil {
+			return err
+		}
+		fmt.Println(total.name, "addresses", count, "coins", weiToEther(coins).String())
+	}
+	deadline, err := hexutil.DecodeUint64(report.DeadlineBlock)
+	if err != nil {
+		return err
+	}
+	if deadline > 0 {
+		fmt.Println("Conversion deadline block", deadline, "unclaimed coins address", report.UnclaimedAddress.Hex())
+	}
+	fmt.Println()
+
+	return nil
+}
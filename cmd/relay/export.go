@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/QuantumCoinProject/qc/cachemanager"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/relay/apikeys"
+	"github.com/QuantumCoinProject/qc/relay/qcreadapi"
+)
+
+// exportAccount downloads the export of an account from a read relay, for the
+// export-account command.
+func exportAccount(args []string) error {
+	flags := flag.NewFlagSet("export-account", flag.ContinueOnError)
+	relayUrl := flags.String("url", "http://127.0.0.1:9090", "url of the read relay")
+	address := flags.String("address", "", "account address")
+	fromBlock := flags.String("fromBlock", "", "first block of the export")
+	toBlock := flags.String("toBlock", "", "last block of the export")
+	fromDate := flags.String("fromDate", "", "first UTC day of the export, YYYY-MM-DD")
+	toDate := flags.String("toDate", "", "last UTC day of the export, YYYY-MM-DD")
+	format := flags.String("format", cachemanager.ExportFormatCsv, "csv or jsonl")
+	apiKey := flags.String("apiKey", "", "api key of the relay")
+	output := flags.String("output", "", "output file, the standard output if not set")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if common.IsHexAddressDeep(*address) == false {
+		return errors.New("invalid address " + *address)
+	}
+
+	query := url.Values{}
+	query.Set("format", *format)
+	for name, value := range map[string]string{"fromBlock": *fromBlock, "toBlock": *toBlock, "fromDate": *fromDate, "toDate": *toDate} {
+		if len(value) > 0 {
+			query.Set(name, value)
+		}
+	}
+	request, err := http.NewRequest(http.MethodGet, strings.TrimRight(*relayUrl, "/")+"/account/"+*address+"/export?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if len(*apiKey) > 0 {
+		request.Header.Set(apikeys.ApiKeyHeader, *apiKey)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 4096))
+		return fmt.Errorf("export failed with status %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	out := io.Writer(os.Stdout)
+	if len(*output) > 0 {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	// An export that fails after it started is cut short by the relay, and the
+	// copy returns an error
+	if _, err := io.Copy(out, response.Body); err != nil {
+		return fmt.Errorf("export incomplete: %v", err)
+	}
+	fmt.Fprintln(os.Stderr, "Exported blocks", response.Header.Get(qcreadapi.ExportFromBlockHeader), "to", response.Header.Get(qcreadapi.ExportToBlockHeader))
+	return nil
+}
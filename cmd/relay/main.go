@@ -14,15 +14,22 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/ethdb"
 	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/metrics"
+	"github.com/QuantumCoinProject/qc/metrics/exp"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	qcreadapi "github.com/QuantumCoinProject/qc/relay/qcreadapi"
 	qcwriteapi "github.com/QuantumCoinProject/qc/relay/qcwriteapi"
 	cachemanager "github.com/QuantumCoinProject/qc/cachemanager"
 	"github.com/QuantumCoinProject/qc/relay"
+	"github.com/QuantumCoinProject/qc/relay/apikeys"
+	"github.com/QuantumCoinProject/qc/relay/upstream"
 	"strconv"
 	"strings"
 )
@@ -36,6 +43,15 @@ type Configs struct {
 
 func main() {
 
+	// The export is written to the standard output, before the banner
+	if len(os.Args) > 1 && os.Args[1] == "export-account" {
+		if err := exportAccount(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	fmt.Println("==========================================")
 	fmt.Println("||             Quantum Coin              ||")
 	fmt.Println("||                   Q                   ||")
@@ -61,11 +77,24 @@ func main() {
 		return
 	}
 
+	// Metrics have to be enabled before the cache managers create them
 	for _, config := range configs{
+		if len(config.MetricsAddress) > 0 {
+			metrics.Enabled = true
+		}
+	}
+	metricsAddresses := make(map[string]bool)
+
+	for _, config := range configs{
+		if len(config.MetricsAddress) > 0 && metricsAddresses[config.MetricsAddress] == false {
+			metricsAddresses[config.MetricsAddress] = true
+			exp.Setup(config.MetricsAddress)
+		}
+
 		api := config.Api
 		ip := config.Ip
 		port := config.Port
-		nodeUrl := config.NodeUrl
+		nodeUrls := config.Upstreams()
 		corsAllowedOrigins := config.CorsAllowedOrigins
 		enableAuth := config.EnableAuth
 		apiKeys := config.ApiKeys
@@ -81,27 +110,45 @@ func main() {
 			return
 		}
 
-		if len(strings.TrimSpace(nodeUrl)) == 0{
-			fmt.Println("Check configuration  node Url value", nodeUrl)
+		if len(nodeUrls) == 0{
+			fmt.Println("Check configuration  node Url value", config.NodeUrl)
 			return
 		}
 
+		upstreams, err := upstream.NewPool(nodeUrls)
+		if err != nil {
+			log.Error("NewPool failed", "error", err)
+			panic(err)
+		}
+		upstreams.Start()
+
 		if strings.EqualFold(api ,"read") {
 			if len(strings.TrimSpace(cachePath)) == 0 {
 				fmt.Println("Check configuration cache path value", cachePath)
 				return
 			}
 
-			cacheManager, err := cachemanager.NewCacheManager(cachePath, nodeUrl, config.EnableExtendedApis, config.GenesisFilePath, config.MaxSupply)
+			cacheManager, err := cachemanager.NewCacheManager(cachePath, upstreams, config.EnableExtendedApis, config.IndexInternalTransactions, config.GenesisFilePath, config.MaxSupply)
 			if err != nil {
 				log.Error("NewCacheManager failed", "error", err)
 				panic(err)
 			}
-			go qcReadApi(ip, port, nodeUrl, corsAllowedOrigins,enableAuth,apiKeys, cacheManager, config.EnableExtendedApis)
+			keys := newApiKeys(cacheManager.Database(), apiKeys, config)
+			go qcReadApi(ip, port, upstreams, corsAllowedOrigins,enableAuth,keys, cacheManager, config.EnableExtendedApis)
 		}
 
 		if strings.EqualFold(api ,"write") {
-			go qcWriteApi(ip, port, nodeUrl, corsAllowedOrigins,enableAuth,apiKeys)
+			// The write relay has no cache, the api keys get their own database
+			var db ethdb.Database = rawdb.NewMemoryDatabase()
+			if len(strings.TrimSpace(cachePath)) > 0 {
+				db, err = rawdb.NewLevelDBDatabase(filepath.Join(cachePath, "apiKeys-" + port + ".db"), 16, 0, "", false)
+				if err != nil {
+					log.Error("Open api keys database failed", "error", err)
+					panic(err)
+				}
+			}
+			keys := newApiKeys(db, apiKeys, config)
+			go qcWriteApi(ip, port, upstreams, corsAllowedOrigins,enableAuth,keys)
 		}
 	}
 
@@ -109,24 +156,38 @@ func main() {
 	<-make(chan int)
 }
 
-func qcReadApi(ip string, port string, nodeUrl string, corsAllowedOrigins string, enableAuth bool, apiKeys string, cacheManager *cachemanager.CacheManager, enableExtendedApis bool) {
-	ReadApiAPIService, err := qcreadapi.NewReadApiAPIService(nodeUrl, cacheManager, enableExtendedApis)
+func newApiKeys(db ethdb.Database, apiKeys string, config relay.RelayConfig) *apikeys.Manager {
+	keys, err := apikeys.NewManager(db, apiKeys, config.ApiKeyTiers, config.AdminApiKey)
+	if err != nil {
+		log.Error("NewManager failed", "error", err)
+		panic(err)
+	}
+	keys.Start()
+	return keys
+}
+
+func qcReadApi(ip string, port string, upstreams *upstream.Pool, corsAllowedOrigins string, enableAuth bool, keys *apikeys.Manager, cacheManager *cachemanager.CacheManager, enableExtendedApis bool) {
+	ReadApiAPIService, err := qcreadapi.NewReadApiAPIService(upstreams, cacheManager, enableExtendedApis)
 	if err != nil {
 		panic(err)
 	}
-	ReadApiAPIController := qcreadapi.NewReadApiAPIController(ReadApiAPIService, corsAllowedOrigins, enableAuth, apiKeys)
+	ReadApiAPIController := qcreadapi.NewReadApiAPIController(ReadApiAPIService, corsAllowedOrigins, enableAuth, keys)
 	readRouter := qcreadapi.NewRouter(ReadApiAPIController)
+	readRouter.Use(keys.Middleware)
+	keys.RegisterAdminRoutes(readRouter)
 
-	fmt.Println("Read api server is listening on : ", ip + ":" + port, "nodeUrl" + ":" + nodeUrl, "corsAllowedOrigins" + ":" + corsAllowedOrigins)
+	fmt.Println("Read api server is listening on : ", ip + ":" + port, "nodeUrls" + ":" + strings.Join(upstreams.Urls(), ","), "corsAllowedOrigins" + ":" + corsAllowedOrigins)
 	http.ListenAndServe(ip + ":" + port, readRouter)
 }
 
-func qcWriteApi(ip string, port string, nodeUrl string, corsAllowedOrigins string, enableAuth bool, apiKeys string) {
-	WriteApiAPIService := qcwriteapi.NewWriteApiAPIService(nodeUrl)
-	WriteApiAPIController := qcwriteapi.NewWriteApiAPIController(WriteApiAPIService, corsAllowedOrigins, enableAuth, apiKeys)
+func qcWriteApi(ip string, port string, upstreams *upstream.Pool, corsAllowedOrigins string, enableAuth bool, keys *apikeys.Manager) {
+	WriteApiAPIService := qcwriteapi.NewWriteApiAPIService(upstreams)
+	WriteApiAPIController := qcwriteapi.NewWriteApiAPIController(WriteApiAPIService, corsAllowedOrigins, enableAuth, keys)
 	writeRouter := qcwriteapi.NewRouter(WriteApiAPIController)
+	writeRouter.Use(keys.Middleware)
+	keys.RegisterAdminRoutes(writeRouter)
 
-	fmt.Println("Write api server is listening on : ", ip + ":" + port, "nodeUrl" + ":" + nodeUrl, "corsAllowedOrigins" + ":" + corsAllowedOrigins)
+	fmt.Println("Write api server is listening on : ", ip + ":" + port, "nodeUrls" + ":" + strings.Join(upstreams.Urls(), ","), "corsAllowedOrigins" + ":" + corsAllowedOrigins)
 	http.ListenAndServe(ip + ":" + port,  writeRouter)
 }
 
@@ -160,5 +221,6 @@ func readConfigJsonDataFile(filename string)  ([]relay.RelayConfig, error) {
 func printHelp() {
 	fmt.Println("===========")
 	fmt.Println("relay config.json")
+	fmt.Println("relay export-account -address 0x... [-url http://127.0.0.1:9090] [-fromBlock n] [-toBlock n] [-fromDate YYYY-MM-DD] [-toDate YYYY-MM-DD] [-format csv|jsonl] [-apiKey key] [-output file]")
 	fmt.Println("===========")
 }
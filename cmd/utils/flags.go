@@ -18,6 +18,7 @@
 package utils
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/QuantumCoinProject/qc/crypto/cryptobase"
 	"github.com/QuantumCoinProject/qc/crypto/signaturealgorithm"
@@ -242,6 +243,10 @@ var (
 		Name:  "whitelist",
 		Usage: "Comma separated block number-to-hash mappings to enforce (<number>=<hash>)",
 	}
+	CheckpointFileFlag = cli.StringFlag{
+		Name:  "checkpoint.file",
+		Usage: "JSON file with validator signed checkpoints to start syncing from",
+	}
 	BloomFilterSizeFlag = cli.Uint64Flag{
 		Name:  "bloomfilter.size",
 		Usage: "Megabytes of memory allocated to bloom-filter for pruning",
@@ -600,6 +605,14 @@ var (
 		Usage: "Maximum number of pending connection attempts (defaults used if set to 0)",
 		Value: node.DefaultConfig.P2P.MaxPendingPeers,
 	}
+	MaxEgressRateFlag = cli.IntFlag{
+		Name:  "bandwidth.egress",
+		Usage: "Maximum outbound bandwidth in KB/s, consensus messages are never held back (0 = unlimited)",
+	}
+	MaxPeerEgressRateFlag = cli.IntFlag{
+		Name:  "bandwidth.peeregress",
+		Usage: "Maximum outbound bandwidth per peer in KB/s, consensus messages are never held back (0 = unlimited)",
+	}
 	ListenPortFlag = cli.IntFlag{
 		Name:  "port",
 		Usage: "Network listening port",
@@ -1184,6 +1197,12 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 	if ctx.GlobalIsSet(MaxPendingPeersFlag.Name) {
 		cfg.MaxPendingPeers = ctx.GlobalInt(MaxPendingPeersFlag.Name)
 	}
+	if ctx.GlobalIsSet(MaxEgressRateFlag.Name) {
+		cfg.MaxEgressRate = ctx.GlobalInt(MaxEgressRateFlag.Name) * 1024
+	}
+	if ctx.GlobalIsSet(MaxPeerEgressRateFlag.Name) {
+		cfg.MaxPeerEgressRate = ctx.GlobalInt(MaxPeerEgressRateFlag.Name) * 1024
+	}
 	if ctx.GlobalIsSet(NoDiscoverFlag.Name) || lightClient {
 		cfg.NoDiscovery = true
 	}
@@ -1421,6 +1440,22 @@ func setWhitelist(ctx *cli.Context, cfg *ethconfig.Config) {
 	}
 }
 
+func setCheckpoints(ctx *cli.Context, cfg *ethconfig.Config) {
+	path := ctx.GlobalString(CheckpointFileFlag.Name)
+	if path == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		Fatalf("Failed to read checkpoint file %s: %v", path, err)
+	}
+	var checkpoints []*params.ValidatorCheckpoint
+	if err := json.Unmarshal(data, &checkpoints); err != nil {
+		Fatalf("Invalid checkpoint file %s: %v", path, err)
+	}
+	cfg.Checkpoints = checkpoints
+}
+
 // CheckExclusive verifies that only a single instance of the provided flags was
 // set by the user. Each flag might optionally be followed by a string type to
 // specialize it further.
@@ -1491,6 +1526,7 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	setTxPool(ctx, &cfg.TxPool)
 	setMiner(ctx, &cfg.Miner)
 	setWhitelist(ctx, cfg)
+	setCheckpoints(ctx, cfg)
 	setLes(ctx, cfg)
 
 	// Cap the cache allowance and tune the garbage collector
@@ -360,6 +360,45 @@ func ParseConsensusPackets(parentHash common.Hash, consensusPackets *[]eth.Conse
 	return packetRoundMap, nil
 }
 
+// addCommitCertificate verifies the commit certificate of a block and adds the
+// commits it holds to the packets of its round.
+func addCommitCertificate(parentHash common.Hash, cert *CommitCertificate, blockConsensusData *BlockConsensusData,
+	filteredValidatorDepositMap map[common.Address]*big.Int, packetRoundMap map[byte]*PacketMap) error {
+	if cert.Round != blockConsensusData.Round {
+		return ErrCertificateRound
+	}
+	commitHash := getCommitHash(blockConsensusData.PrecommitHash)
+	signers, err := cert.Verify(parentHash, commitHash, filteredValidatorDepositMap)
+	if err != nil {
+		return err
+	}
+
+	packetMap, ok := packetRoundMap[cert.Round]
+	if ok == false {
+		packetMap = &PacketMap{
+			round:                 cert.Round,
+			proposalDetailsMap:    make(map[common.Address]*ProposalDetails),
+			proposalAckDetailsMap: make(map[common.Address]*ProposalAckDetails),
+			precommitDetailsMap:   make(map[common.Address]*PreCommitDetails),
+			commitDetailsMap:      make(map[common.Address]*CommitDetails),
+		}
+		packetRoundMap[cert.Round] = packetMap
+	}
+	for _, v := range signers {
+		_, ok := packetMap.commitDetailsMap[v]
+		if ok == true {
+			log.Warn("duplicate commit in certificate", "validator", v)
+			return errors.New("duplicate commit packet")
+		}
+		commitDetails := &CommitDetails{
+			Round: cert.Round,
+		}
+		commitDetails.CommitHash.CopyFrom(commitHash)
+		packetMap.commitDetailsMap[v] = commitDetails
+	}
+	return nil
+}
+
 func ValidatePackets(parentHash common.Hash, round byte, packetMap *PacketMap, voteType VoteType,
 	filteredValidatorDepositMap *map[common.Address]*big.Int, totalBlockDepositValue *big.Int, minDepositRequired *big.Int, txns []common.Hash, blockNumber uint64, proposedBlockTime uint64) error {
 	valMap := *filteredValidatorDepositMap
@@ -563,6 +602,16 @@ func ValidateBlockConsensusDataInner(txns []common.Hash, parentHash common.Hash,
 		return err
 	}
 
+	if blockAdditionalConsensusData.CommitCertificate != nil {
+		if blockNumber < COMMIT_CERTIFICATE_START_BLOCK {
+			return errors.New("unexpected commit certificate")
+		}
+		err = addCommitCertificate(parentHash, blockAdditionalConsensusData.CommitCertificate, blockConsensusData, filteredValidatorDepositMap, packetRoundMap)
+		if err != nil {
+			return err
+		}
+	}
+
 	if blockConsensusData.VoteType == VOTE_TYPE_NIL {
 		if len(txns) > 0 {
 			return errors.New("txns in a NIL block")
@@ -3,6 +3,7 @@ package proofofstake
 import (
 	"github.com/QuantumCoinProject/qc/common"
 	"github.com/QuantumCoinProject/qc/eth/protocols/eth"
+	"github.com/QuantumCoinProject/qc/p2p"
 )
 
 type P2PHandler interface {
@@ -11,4 +12,5 @@ type P2PHandler interface {
 	RequestTransactions(txns []common.Hash) error
 	RequestConsensusData(packet *eth.RequestConsensusDataPacket) error
 	GetLocalPeerId() string
+	ReportPeer(peerId string, event p2p.ScoreEvent)
 }
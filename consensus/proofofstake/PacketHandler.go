@@ -13,6 +13,7 @@ import (
 	"github.com/QuantumCoinProject/qc/handler"
 	"github.com/QuantumCoinProject/qc/log"
 	"github.com/QuantumCoinProject/qc/node"
+	"github.com/QuantumCoinProject/qc/p2p"
 	"github.com/QuantumCoinProject/qc/params"
 	"github.com/QuantumCoinProject/qc/rlp"
 	"io/ioutil"
@@ -75,6 +76,8 @@ type ConsensusHandler struct {
 	latestBlockMutex  sync.RWMutex
 
 	peerHandler *PeerHandler
+
+	clockSkew time.Duration //offset of the local clock, injected by simulations
 }
 
 type PacketStats struct {
@@ -93,8 +96,9 @@ type BlockConsensusData struct {
 }
 
 type BlockAdditionalConsensusData struct {
-	ConsensusPackets []eth.ConsensusPacket `json:"consensusPackets" gencodec:"required"`
-	InitTime         uint64                `json:"initTime" gencodec:"required"`
+	ConsensusPackets  []eth.ConsensusPacket `json:"consensusPackets" gencodec:"required"`
+	InitTime          uint64                `json:"initTime" gencodec:"required"`
+	CommitCertificate *CommitCertificate    `json:"commitCertificate,omitempty" rlp:"optional"` //Replaces the commit packets of the final round from COMMIT_CERTIFICATE_START_BLOCK
 }
 
 // todo: use mono clock
@@ -836,6 +840,12 @@ func (cph *ConsensusHandler) isBlockProposer(parentHash common.Hash, filteredVal
 	return blockProposer.IsEqualTo(cph.account.Address), nil
 }
 
+// HandleConsensusPacket handles a consensus packet received from a peer. A nil
+// error means the packet may be rebroadcast: its signature was verified, even
+// on nodes that are not validators. Peers are only penalized for packets that
+// are malformed or badly signed, since relayed packets that are merely stale or
+// out of order are not the fault of the relaying peer. Peers are rewarded for
+// packets that were accepted.
 func (cph *ConsensusHandler) HandleConsensusPacket(packet *eth.ConsensusPacket, fromPeerId string) error {
 	log.Debug("HandleConsensusPacket", "ParentHash", packet.ParentHash, "fromPeerId", fromPeerId)
 	cph.outerPacketLock.Lock()
@@ -843,8 +853,17 @@ func (cph *ConsensusHandler) HandleConsensusPacket(packet *eth.ConsensusPacket,
 
 	if packet == nil || packet.Signature == nil || packet.ConsensusData == nil || len(packet.Signature) == 0 || len(packet.ConsensusData) == 0 {
 		log.Debug("HandleConsensusPacket nil", "fromPeerId", fromPeerId)
+		cph.reportPeer(fromPeerId, p2p.ScoreInvalidConsensusPacket)
 		return errors.New("invalid packet, nil data")
 	}
+	markConsensusTraffic("ingress", packet)
+
+	validator, packetType, err := cph.verifyPacket(packet)
+	if err != nil {
+		log.Trace("HandleConsensusPacket verify", "err", err, "fromPeerId", fromPeerId)
+		cph.reportPeer(fromPeerId, p2p.ScoreInvalidConsensusPacket)
+		return err
+	}
 
 	if cph.signFn == nil {
 		return nil
@@ -857,7 +876,7 @@ func (cph *ConsensusHandler) HandleConsensusPacket(packet *eth.ConsensusPacket,
 	}
 
 	cph.LogIncomingPacketStats()
-	err := cph.processPacket(packet, fromPeerId)
+	err = cph.processVerifiedPacket(validator, packetType, packet)
 	if errors.Is(err, OutOfOrderPackerErr) {
 		pkt := eth.NewConsensusPacket(packet)
 		packetMap, ok := cph.outOfOrderPacketsMap[packet.ParentHash]
@@ -882,6 +901,7 @@ func (cph *ConsensusHandler) HandleConsensusPacket(packet *eth.ConsensusPacket,
 	if err != nil {
 		log.Trace("HandleConsensusPacket error", "err", err, "fromPeerId", fromPeerId)
 	} else {
+		cph.reportPeer(fromPeerId, p2p.ScoreUsefulConsensusPacket)
 		err = cph.peerHandler.HandleConsensusPacket(packet, fromPeerId)
 		if err != nil {
 			log.Trace("HandleConsensusPacket peerHandler", "error", err, "fromPeerId", fromPeerId)
@@ -896,6 +916,14 @@ func (cph *ConsensusHandler) HandleConsensusPacket(packet *eth.ConsensusPacket,
 	return nil
 }
 
+// reportPeer reports the behaviour of the peer a packet was received from.
+func (cph *ConsensusHandler) reportPeer(fromPeerId string, event p2p.ScoreEvent) {
+	if cph.p2pHandler == nil || len(fromPeerId) == 0 {
+		return
+	}
+	cph.p2pHandler.ReportPeer(fromPeerId, event)
+}
+
 func shouldSignFull(blockNumber uint64) bool {
 	if blockNumber >= FULL_SIGN_PROPOSAL_CUTOFF_BLOCK && blockNumber%FULL_SIGN_PROPOSAL_FREQUENCY_BLOCKS == 0 {
 		return true
@@ -904,9 +932,19 @@ func shouldSignFull(blockNumber uint64) bool {
 }
 
 func (cph *ConsensusHandler) processPacket(packet *eth.ConsensusPacket, fromPeerId string) error {
+	validator, packetType, err := cph.verifyPacket(packet)
+	if err != nil {
+		return err
+	}
+	return cph.processVerifiedPacket(validator, packetType, packet)
+}
+
+// verifyPacket verifies the signature of a consensus packet and returns the
+// address of the validator that signed it.
+func (cph *ConsensusHandler) verifyPacket(packet *eth.ConsensusPacket) (common.Address, ConsensusPacketType, error) {
 	if packet == nil || packet.ConsensusData == nil || len(packet.ConsensusData) < 1 || packet.Signature == nil || len(packet.Signature) < hybrideds.CRYPTO_SIGNATURE_BYTES {
 		log.Debug("processPacket nil")
-		return errors.New("nil packet")
+		return ZERO_ADDRESS, 0, errors.New("nil packet")
 	}
 
 	var startIndex int
@@ -927,31 +965,37 @@ func (cph *ConsensusHandler) processPacket(packet *eth.ConsensusPacket, fromPeer
 		pubKey, err = cryptobase.SigAlg.PublicKeyFromSignatureWithContext(digestHash, packet.Signature, FULL_SIGN_CONTEXT)
 		if err != nil {
 			log.Debug("processPacket invalid 1")
-			return InvalidPacketErr
+			return ZERO_ADDRESS, 0, InvalidPacketErr
 		}
 
 		if cryptobase.SigAlg.VerifyWithContext(pubKey.PubData, digestHash, packet.Signature, FULL_SIGN_CONTEXT) == false {
-			return InvalidPacketErr
+			return ZERO_ADDRESS, 0, InvalidPacketErr
 		}
 	} else {
 		pubKey, err = cryptobase.SigAlg.PublicKeyFromSignature(digestHash, packet.Signature)
 		if err != nil {
 			log.Debug("processPacket invalid 2")
-			return InvalidPacketErr
+			return ZERO_ADDRESS, 0, InvalidPacketErr
 		}
 
 		if cryptobase.SigAlg.Verify(pubKey.PubData, digestHash, packet.Signature) == false {
 			log.Debug("processPacket invalid 3")
-			return InvalidPacketErr
+			return ZERO_ADDRESS, 0, InvalidPacketErr
 		}
 	}
 
 	validator, err := cryptobase.SigAlg.PublicKeyToAddress(pubKey)
 	if err != nil {
 		log.Debug("processPacket invalid 4")
-		return InvalidPacketErr
+		return ZERO_ADDRESS, 0, InvalidPacketErr
 	}
 
+	return validator, packetType, nil
+}
+
+// processVerifiedPacket handles a consensus packet whose signature was verified
+// by verifyPacket.
+func (cph *ConsensusHandler) processVerifiedPacket(validator common.Address, packetType ConsensusPacketType, packet *eth.ConsensusPacket) error {
 	log.Trace("processPacket", "validator", validator, "packetType", packetType)
 	if packetType == CONSENSUS_PACKET_TYPE_PROPOSE_BLOCK {
 		return cph.handleProposeBlockPacket(validator, packet, false)
@@ -1094,8 +1138,20 @@ func (cph *ConsensusHandler) getBlockConsensusData(parentHash common.Hash) (bloc
 		for _, pkt := range blockRoundDetails.precommitPackets {
 			consensusPackets = append(consensusPackets, eth.NewConsensusPacket(pkt))
 		}
-		for _, pkt := range blockRoundDetails.commitPackets {
-			consensusPackets = append(consensusPackets, eth.NewConsensusPacket(pkt))
+		if r == blockStateDetails.currentRound && blockStateDetails.blockNumber >= COMMIT_CERTIFICATE_START_BLOCK {
+			cert, remaining, err := NewCommitCertificate(parentHash, r, getCommitHash(blockRoundDetails.precommitHash),
+				blockStateDetails.filteredValidatorsDepositMap, blockRoundDetails.commitPackets)
+			if err != nil {
+				return nil, nil, err
+			}
+			blockAdditionalConsensusData.CommitCertificate = cert
+			for _, pkt := range remaining {
+				consensusPackets = append(consensusPackets, eth.NewConsensusPacket(pkt))
+			}
+		} else {
+			for _, pkt := range blockRoundDetails.commitPackets {
+				consensusPackets = append(consensusPackets, eth.NewConsensusPacket(pkt))
+			}
 		}
 
 		roundProposer, err := getBlockProposer(parentHash, &blockStateDetails.filteredValidatorsDepositMap, r,
@@ -1311,7 +1367,7 @@ func (cph *ConsensusHandler) handleProposeBlockPacket(validator common.Address,
 		return errors.New("invalid proposer")
 	}
 
-	if ValidateBlockProposalTimeConsensus(blockStateDetails.blockNumber, proposalDetails.BlockTime) == false {
+	if validateBlockProposalTimeConsensusAt(blockStateDetails.blockNumber, proposalDetails.BlockTime, cph.now()) == false {
 		return errors.New("block time validation failed, skipping packet")
 	}
 
@@ -1987,6 +2043,11 @@ func HasExceededTimeThreshold(startTime time.Time, thresholdMs int64) bool {
 	}
 }
 
+// now returns the local wall clock time used for block times.
+func (cph *ConsensusHandler) now() time.Time {
+	return time.Now().Add(cph.clockSkew)
+}
+
 func Elapsed(startTime time.Time) int64 {
 	end := time.Now().UnixNano() / int64(time.Millisecond)
 	start := startTime.UnixNano() / int64(time.Millisecond)
@@ -1995,8 +2056,12 @@ func Elapsed(startTime time.Time) int64 {
 }
 
 func GetProposalTime(blockNumber uint64) uint64 {
+	return getProposalTimeAt(blockNumber, time.Now())
+}
+
+func getProposalTimeAt(blockNumber uint64, now time.Time) uint64 {
 	if blockNumber == 1 || blockNumber%BLOCK_PERIOD_TIME_CHANGE == 0 || blockNumber >= BLOCK_TIME_ORIG_START_BLOCK {
-		blockTime := uint64(time.Now().UTC().Unix())
+		blockTime := uint64(now.UTC().Unix())
 		if blockTime%60 != 0 {
 			blockTime = blockTime - (blockTime % 60)
 		}
@@ -2008,6 +2073,10 @@ func GetProposalTime(blockNumber uint64) uint64 {
 }
 
 func ValidateBlockProposalTimeConsensus(blockNumber uint64, proposedTime uint64) bool {
+	return validateBlockProposalTimeConsensusAt(blockNumber, proposedTime, time.Now())
+}
+
+func validateBlockProposalTimeConsensusAt(blockNumber uint64, proposedTime uint64, now time.Time) bool {
 	if blockNumber == 1 || blockNumber%BLOCK_PERIOD_TIME_CHANGE == 0 || blockNumber >= BLOCK_TIME_ORIG_START_BLOCK {
 		if proposedTime == 0 {
 			return false
@@ -2017,7 +2086,7 @@ func ValidateBlockProposalTimeConsensus(blockNumber uint64, proposedTime uint64)
 		if tm.Second() != 0 || tm.Nanosecond() != 0 { //No granularity at anything other than minute level allowed, to reduce ability to manipulate blockHash
 			return false
 		}
-		currTimeVal := time.Now().UTC().Unix() //Note that packet may have arrived late. So, these comparisions are approximate.
+		currTimeVal := now.UTC().Unix() //Note that packet may have arrived late. So, these comparisions are approximate.
 		if currTimeVal%60 != 0 {
 			currTimeVal = currTimeVal - (currTimeVal % 60)
 		}
@@ -2063,7 +2132,7 @@ func (cph *ConsensusHandler) proposeBlock(parentHash common.Hash, txns []common.
 	} else {
 		proposalDetails.Txns = make([]common.Hash, 0)
 	}
-	proposalDetails.BlockTime = GetProposalTime(blockNumber)
+	proposalDetails.BlockTime = getProposalTimeAt(blockNumber, cph.now())
 
 	log.Trace("ProposeBlock with txns", "count", len(proposalDetails.Txns))
 
@@ -2820,6 +2889,7 @@ func (cph *ConsensusHandler) broadCast(packet *eth.ConsensusPacket) error {
 	if cph.latestBlockNumber >= PACKET_PROTOCOL_START_BLOCK {
 		sendCount := cph.peerHandler.BroadcastLocalPacket(packet)
 		if sendCount > 8 {
+			markConsensusTraffic("broadcast", packet)
 			return nil
 		}
 	}
@@ -2853,6 +2923,7 @@ func (cph *ConsensusHandler) broadCast(packet *eth.ConsensusPacket) error {
 	}
 
 	cph.cleanupBroadcast()
+	markConsensusTraffic("broadcast", packet)
 	go cph.p2pHandler.BroadcastConsensusData(packet)
 
 	return nil
@@ -3128,3 +3199,51 @@ func (cph *ConsensusHandler) ShouldRebroadCast(packet *eth.ConsensusPacket, from
 
 	return true
 }
+
+// PacketRound returns the round of a propose, ack, precommit or commit packet,
+// used by relays to bundle packets of the same round.
+func (cph *ConsensusHandler) PacketRound(packet *eth.ConsensusPacket) (byte, bool) {
+	if packet == nil || len(packet.ConsensusData) == 0 {
+		return 0, false
+	}
+
+	var startIndex int
+	if packet.ConsensusData[0] >= MinConsensusNetworkProtocolVersion {
+		startIndex = 2
+	} else {
+		startIndex = 1
+	}
+	if len(packet.ConsensusData) <= startIndex {
+		return 0, false
+	}
+	data := packet.ConsensusData[startIndex:]
+
+	switch ConsensusPacketType(packet.ConsensusData[startIndex-1]) {
+	case CONSENSUS_PACKET_TYPE_PROPOSE_BLOCK:
+		details := ProposalDetails{}
+		if rlp.DecodeBytes(data, &details) != nil {
+			return 0, false
+		}
+		return details.Round, true
+	case CONSENSUS_PACKET_TYPE_ACK_BLOCK_PROPOSAL:
+		details := ProposalAckDetails{}
+		if rlp.DecodeBytes(data, &details) != nil {
+			return 0, false
+		}
+		return details.Round, true
+	case CONSENSUS_PACKET_TYPE_PRECOMMIT_BLOCK:
+		details := PreCommitDetails{}
+		if rlp.DecodeBytes(data, &details) != nil {
+			return 0, false
+		}
+		return details.Round, true
+	case CONSENSUS_PACKET_TYPE_COMMIT_BLOCK:
+		details := CommitDetails{}
+		if rlp.DecodeBytes(data, &details) != nil {
+			return 0, false
+		}
+		return details.Round, true
+	default:
+		return 0, false
+	}
+}
@@ -17,20 +17,21 @@
 package proofofstake
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"github.com/QuantumCoinProject/qc/common"
 	"github.com/QuantumCoinProject/qc/common/hexutil"
 	"github.com/QuantumCoinProject/qc/consensus"
+	"github.com/QuantumCoinProject/qc/conversionutil"
 	"github.com/QuantumCoinProject/qc/core"
 	"github.com/QuantumCoinProject/qc/core/types"
 	"github.com/QuantumCoinProject/qc/crypto"
-	"github.com/QuantumCoinProject/qc/internal/ethapi"
 	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/params"
 	"github.com/QuantumCoinProject/qc/rlp"
 	"github.com/QuantumCoinProject/qc/rpc"
 	"github.com/QuantumCoinProject/qc/systemcontracts/conversion"
+	"github.com/QuantumCoinProject/qc/systemcontracts/governance"
 	"math/big"
 )
 
@@ -89,6 +90,8 @@ func (api *API) ListValidators(blockNumberHex string) ([]*ValidatorDetails, erro
 type StakingData struct {
 	TotalDepositedBalance string              `json:"totalDepositedBalance"     gencodec:"required"`
 	Validators            []*ValidatorDetails `json:"validators"     gencodec:"required"`
+	ExitingStake          string              `json:"exitingStake"     gencodec:"required"`
+	UnbondingDelay        string              `json:"unbondingDelay"     gencodec:"required"` //blocks a withdrawal initiated in the next block has to wait
 }
 
 func (api *API) GetStakingDetailsByValidatorAddress(validator common.Address, blockNumberHex string) (*ValidatorDetails, error) {
@@ -143,6 +146,11 @@ func (api *API) GetStakingDetailsByValidatorAddress(validator common.Address, bl
 			}
 		}
 
+		validatorDetails.UnbondingTranches, err = api.proofofstake.getUnbondingTranches(validatorDetailsV2.Depositor, header.Hash())
+		if err != nil {
+			return nil, err
+		}
+
 		return validatorDetails, nil
 	}
 }
@@ -203,6 +211,11 @@ func (api *API) GetStakingDetailsByDepositorAddress(depositor common.Address, bl
 				validatorDetails.BlockProposerResetBlock = hexutil.EncodeUint64(blockProposerResetBlock)
 			}
 		}
+
+		validatorDetails.UnbondingTranches, err = api.proofofstake.getUnbondingTranches(validatorDetailsV2.Depositor, header.Hash())
+		if err != nil {
+			return nil, err
+		}
 		return validatorDetails, nil
 	}
 }
@@ -232,10 +245,16 @@ func (api *API) GetStakingDetails(blockNumberHex string) (*StakingData, error) {
 	if err != nil {
 		return nil, err
 	}
+	exitingStake, unbondingDelay, err := api.proofofstake.getUnbondingQueueInfo(header, balance)
+	if err != nil {
+		return nil, err
+	}
 
 	return &StakingData{
 		TotalDepositedBalance: hexutil.EncodeBig(balance),
 		Validators:            validators,
+		ExitingStake:          hexutil.EncodeBig(exitingStake),
+		UnbondingDelay:        hexutil.EncodeUint64(unbondingDelay),
 	}, nil
 }
 
@@ -335,7 +354,7 @@ func (api *API) GetBlockProposalDetails(blockNumberHex string) (*ProposalExtende
 	return nil, errors.New("proposal packet not found")
 }
 
-func ParseRewardsInfo(block *types.Block, receipts []*types.Receipt) (*BlockRewardsInfo, error) {
+func ParseRewardsInfo(block *types.Block, receipts []*types.Receipt, consensusParams *ConsensusParameters) (*BlockRewardsInfo, error) {
 	blockRewardsInfo := &BlockRewardsInfo{}
 
 	blockConsensusData := &BlockConsensusData{}
@@ -353,7 +372,7 @@ func ParseRewardsInfo(block *types.Block, receipts []*types.Receipt) (*BlockRewa
 		blockRewardsInfo.BaseBlockProposerRewards = hexutil.EncodeBig(blockRewards)
 
 		if len(block.Transactions()) > 0 {
-			txnFeeTotal, rewardsAmountTxnFee, burnAmountTxnFee, err := calculateTxnFeeSplit(blockRewards, block.Transactions(), receipts)
+			txnFeeTotal, rewardsAmountTxnFee, burnAmountTxnFee, err := calculateTxnFeeSplit(blockRewards, block.Transactions(), receipts, consensusParams)
 			if err != nil {
 				log.Error("pos calculateTxnFeeSplit", "error", err)
 				return nil, err
@@ -377,12 +396,7 @@ func ParseRewardsInfo(block *types.Block, receipts []*types.Receipt) (*BlockRewa
 		if blockConsensusData.Round == 1 && blockConsensusData.SlashedBlockProposers != nil && len(blockConsensusData.SlashedBlockProposers) > 0 && header.Number.Uint64() >= slashStartBlockNumber {
 			blockRewardsInfo.SlashedValidators = make([]*Slashing, len(blockConsensusData.SlashedBlockProposers))
 
-			var slashAmount *big.Int
-			if header.Number.Uint64() >= SlashV2StartBlock {
-				slashAmount = SLASH_AMOUNT
-			} else {
-				slashAmount = SLASH_AMOUNT_V2
-			}
+			slashAmount := consensusParams.SlashAmount
 
 			for i, val := range blockConsensusData.SlashedBlockProposers {
 				slashing := &Slashing{
@@ -399,6 +413,155 @@ func ParseRewardsInfo(block *types.Block, receipts []*types.Receipt) (*BlockRewa
 	return blockRewardsInfo, nil
 }
 
+func (api *API) getHeader(blockNumberHex string) (*types.Header, error) {
+	var blockNumber uint64
+	var err error
+	if blockNumberHex == "" || len(blockNumberHex) == 0 {
+		blockNumber = api.chain.CurrentHeader().Number.Uint64()
+	} else {
+		blockNumber, err = hexutil.DecodeUint64(blockNumberHex)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var header = api.chain.GetHeaderByNumber(blockNumber)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	return header, nil
+}
+
+// GetGovernanceParameters retrieves the governance controlled consensus parameters at the specified block.
+func (api *API) GetGovernanceParameters(blockNumberHex string) (map[string]string, error) {
+	header, err := api.getHeader(blockNumberHex)
+	if err != nil {
+		return nil, err
+	}
+	state, err := api.proofofstake.governanceStateAt(header)
+	if err != nil {
+		return nil, err
+	}
+	values, err := governance.GetParameters(state)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string)
+	for parameter, value := range values {
+		result[parameter.String()] = hexutil.EncodeBig(value)
+	}
+	return result, nil
+}
+
+// GetGovernanceProposal retrieves a governance proposal at the specified block.
+func (api *API) GetGovernanceProposal(proposalIdHex string, blockNumberHex string) (*GovernanceProposalDetails, error) {
+	proposalId, err := hexutil.DecodeUint64(proposalIdHex)
+	if err != nil {
+		return nil, err
+	}
+	header, err := api.getHeader(blockNumberHex)
+	if err != nil {
+		return nil, err
+	}
+	state, err := api.proofofstake.governanceStateAt(header)
+	if err != nil {
+		return nil, err
+	}
+	proposal, err := governance.GetProposal(state, proposalId)
+	if err != nil {
+		return nil, err
+	}
+	return newGovernanceProposalDetails(proposal), nil
+}
+
+// ListGovernanceProposals retrieves all governance proposals at the specified block.
+func (api *API) ListGovernanceProposals(blockNumberHex string) ([]*GovernanceProposalDetails, error) {
+	header, err := api.getHeader(blockNumberHex)
+	if err != nil {
+		return nil, err
+	}
+	state, err := api.proofofstake.governanceStateAt(header)
+	if err != nil {
+		return nil, err
+	}
+
+	count := governance.GetProposalCount(state)
+	proposals := make([]*GovernanceProposalDetails, 0, count)
+	for id := uint64(1); id <= count; id++ {
+		proposal, err := governance.GetProposal(state, id)
+		if err != nil {
+			return nil, err
+		}
+		proposals = append(proposals, newGovernanceProposalDetails(proposal))
+	}
+	return proposals, nil
+}
+
+// TallyGovernanceProposal counts the stake weighted votes of a proposal using the deposits at the specified block.
+func (api *API) TallyGovernanceProposal(proposalIdHex string, blockNumberHex string) (*GovernanceTallyDetails, error) {
+	proposalId, err := hexutil.DecodeUint64(proposalIdHex)
+	if err != nil {
+		return nil, err
+	}
+	header, err := api.getHeader(blockNumberHex)
+	if err != nil {
+		return nil, err
+	}
+	state, err := api.proofofstake.governanceStateAt(header)
+	if err != nil {
+		return nil, err
+	}
+
+	stake := &governanceStakeReader{p: api.proofofstake, blockHash: header.Hash(), blockNumber: header.Number.Uint64()}
+	tally, err := governance.TallyProposal(state, stake, proposalId)
+	if err != nil {
+		return nil, err
+	}
+	return &GovernanceTallyDetails{
+		ProposalId:            hexutil.EncodeUint64(proposalId),
+		YesWeight:             hexutil.EncodeBig(tally.YesWeight),
+		NoWeight:              hexutil.EncodeBig(tally.NoWeight),
+		TotalDepositedBalance: hexutil.EncodeBig(tally.TotalDepositedBalance),
+		QuorumReached:         tally.QuorumReached,
+		Passed:                tally.Passed,
+	}, nil
+}
+
+// GetCheckpoint builds the unsigned checkpoint of a section of the canonical chain,
+// to be signed by the validators with the checkpoint command.
+func (api *API) GetCheckpoint(sectionHex string) (*params.ValidatorCheckpoint, error) {
+	section, err := hexutil.DecodeUint64(sectionHex)
+	if err != nil {
+		return nil, err
+	}
+	return api.proofofstake.NewCheckpoint(section)
+}
+
+// GetValidatorStats retrieves the proposal, vote and slashing counts of a validator between two blocks, both inclusive.
+func (api *API) GetValidatorStats(validator common.Address, fromBlockHex string, toBlockHex string) (*ValidatorStatsDetails, error) {
+	fromBlock, err := hexutil.DecodeUint64(fromBlockHex)
+	if err != nil {
+		return nil, err
+	}
+	toHeader, err := api.getHeader(toBlockHex)
+	if err != nil {
+		return nil, err
+	}
+	toBlock := toHeader.Number.Uint64()
+
+	stats, err := api.proofofstake.GetValidatorStats(api.chain, fromBlock, toBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	validatorStats, ok := stats[validator]
+	if ok == false {
+		validatorStats = &ValidatorStats{Validator: validator}
+	}
+	return newValidatorStatsDetails(validator, fromBlock, toBlock, validatorStats), nil
+}
+
 // GetBlockConsensusData retrieves proofofstake consensus data of the block.
 func (api *API) GetBlockConsensusData(blockNumberHex string) (*ConsensusData, error) {
 	var blockNumber uint64
@@ -471,7 +634,12 @@ func (api *API) GetBlockConsensusData(blockNumberHex string) (*ConsensusData, er
 		}
 	}
 
-	consensusData.BlockRewardsInfo, err = ParseRewardsInfo(block, receipts)
+	consensusParams, err := api.proofofstake.consensusParametersOf(block.Header())
+	if err != nil {
+		return nil, err
+	}
+
+	consensusData.BlockRewardsInfo, err = ParseRewardsInfo(block, receipts, consensusParams)
 	if err != nil {
 		return nil, err
 	}
@@ -545,141 +713,114 @@ func (api *API) GetConversionDetails(ethAddressHex string) (*ConversionDetails,
 	return conversionDetails, nil
 }
 
-func (api *API) getConversionStatus(ethAddress common.Address, blockHash common.Hash) (bool, error) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := conversion.GetContract_Method_getConversionStatus()
-
-	abiData, err := conversion.GetConversionContract_ABI()
+// GetConversionReport lists every snapshot entry with its conversion status and amount, along with
+// the totals of converted, unconverted and expired amounts.
+func (api *API) GetConversionReport(blockNumberHex string) (*ConversionReport, error) {
+	header, err := api.getHeader(blockNumberHex)
 	if err != nil {
-		log.Error("getConversionStatus abi error", "err", err)
-		return false, err
+		return nil, err
 	}
-	contractAddress := common.HexToAddress(conversion.CONVERSION_CONTRACT)
-
-	// call
-	data, err := abiData.Pack(method, ethAddress)
+	if api.proofofstake.blockchain == nil {
+		return nil, errors.New("blockchain not set")
+	}
+	state, err := api.proofofstake.blockchain.StateAt(header.Root)
 	if err != nil {
-		log.Error("Unable to pack tx for getConversionStatus", "error", err)
-		return false, err
+		return nil, err
 	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
+	deadline, recipient, err := conversionExpiryOf(state)
+	if err != nil {
+		return nil, err
+	}
+
+	convertedCount, unconvertedCount, expiredCount := uint64(0), uint64(0), uint64(0)
+	convertedCoins, unconvertedCoins, expiredCoins := big.NewInt(0), big.NewInt(0), big.NewInt(0)
+	entries := make([]*ConversionReportEntry, 0, len(conversionutil.SnapshotMap))
+	for _, eAddress := range conversionutil.SnapshotAddresses() {
+		ethAddress := common.HexToAddress(eAddress)
+		coins, err := api.GetCoinsForEthereumAddress(ethAddress, header.Hash())
+		if err != nil {
+			return nil, err
+		}
+		isConverted, err := api.getConversionStatus(ethAddress, header.Hash())
+		if err != nil {
+			return nil, err
+		}
 
-	msgData := (hexutil.Bytes)(data)
-	result, err := api.proofofstake.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
+		entry := &ConversionReportEntry{
+			EthAddress:     ethAddress,
+			QuantumAddress: ZERO_ADDRESS,
+			Coins:          hexutil.EncodeBig(coins),
+		}
+		if isConverted {
+			entry.QuantumAddress, err = api.getConversionQuantumAddress(ethAddress, header.Hash())
+			if err != nil {
+				return nil, err
+			}
+			entry.Status = conversionReportStatusConverted
+			convertedCount++
+			convertedCoins = common.SafeAddBigInt(convertedCoins, coins)
+		} else if conversion.IsExpired(state, ethAddress) {
+			entry.Status = conversionReportStatusExpired
+			expiredCount++
+			expiredCoins = common.SafeAddBigInt(expiredCoins, coins)
+		} else {
+			entry.Status = conversionReportStatusUnconverted
+			unconvertedCount++
+			unconvertedCoins = common.SafeAddBigInt(unconvertedCoins, coins)
+		}
+		entries = append(entries, entry)
+	}
+
+	return &ConversionReport{
+		BlockNumber:      hexutil.EncodeBig(header.Number),
+		DeadlineBlock:    hexutil.EncodeUint64(deadline),
+		UnclaimedAddress: recipient,
+		ConvertedCount:   hexutil.EncodeUint64(convertedCount),
+		ConvertedCoins:   hexutil.EncodeBig(convertedCoins),
+		UnconvertedCount: hexutil.EncodeUint64(unconvertedCount),
+		UnconvertedCoins: hexutil.EncodeBig(unconvertedCoins),
+		ExpiredCount:     hexutil.EncodeUint64(expiredCount),
+		ExpiredCoins:     hexutil.EncodeBig(expiredCoins),
+		Entries:          entries,
+	}, nil
+}
+
+func (api *API) getConversionStatus(ethAddress common.Address, blockHash common.Hash) (bool, error) {
+	caller, err := api.proofofstake.conversionCaller()
 	if err != nil {
-		log.Error("Call", "err", err)
 		return false, err
 	}
-	if len(result) == 0 {
-		return false, errors.New("getConversionStatus result is 0")
-	}
-
 	var out bool
-
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		log.Debug("UnpackIntoInterface", "err", err, "ethAddress", ethAddress)
+	if err := caller.Call(blockHash, &out, conversion.GetContract_Method_getConversionStatus(), ethAddress); err != nil {
+		log.Debug("getConversionStatus", "err", err, "ethAddress", ethAddress)
 		return false, err
 	}
-
 	return out, nil
 }
 
 func (api *API) getConversionQuantumAddress(ethAddress common.Address, blockHash common.Hash) (common.Address, error) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := conversion.GetContract_Method_getQuantumAddress()
-
-	abiData, err := conversion.GetConversionContract_ABI()
-	if err != nil {
-		log.Error("getConversionQuantumAddress abi error", "err", err)
-		return ZERO_ADDRESS, err
-	}
-	contractAddress := common.HexToAddress(conversion.CONVERSION_CONTRACT)
-
-	// call
-	data, err := abiData.Pack(method, ethAddress)
-	if err != nil {
-		log.Error("Unable to pack tx for getConversionQuantumAddress", "error", err)
-		return ZERO_ADDRESS, err
-	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
-
-	msgData := (hexutil.Bytes)(data)
-	result, err := api.proofofstake.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
+	caller, err := api.proofofstake.conversionCaller()
 	if err != nil {
-		log.Error("Call", "err", err)
 		return ZERO_ADDRESS, err
 	}
-	if len(result) == 0 {
-		return ZERO_ADDRESS, errors.New("getConversionQuantumAddress result is 0")
-	}
-
-	var (
-		ret0 = new(common.Address)
-	)
-	out := ret0
-
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		log.Debug("UnpackIntoInterface", "err", err, "ethAddress", ethAddress)
+	var out common.Address
+	if err := caller.Call(blockHash, &out, conversion.GetContract_Method_getQuantumAddress(), ethAddress); err != nil {
+		log.Debug("getConversionQuantumAddress", "err", err, "ethAddress", ethAddress)
 		return ZERO_ADDRESS, err
 	}
-
-	return *out, nil
+	return out, nil
 }
 
 func (api *API) GetCoinsForEthereumAddress(ethAddress common.Address, blockHash common.Hash) (*big.Int, error) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := conversion.GetContract_Method_getAmount()
-
-	abiData, err := conversion.GetConversionContract_ABI()
+	caller, err := api.proofofstake.conversionCaller()
 	if err != nil {
-		log.Error("GetCoinsForEthereumAddress abi error", "err", err)
 		return nil, err
 	}
-	contractAddress := common.HexToAddress(conversion.CONVERSION_CONTRACT)
-
-	// call
-	data, err := abiData.Pack(method, ethAddress)
-	if err != nil {
-		log.Error("Unable to pack tx for GetCoinsForEthereumAddress", "error", err)
-		return nil, err
-	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
-
-	msgData := (hexutil.Bytes)(data)
-	result, err := api.proofofstake.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
-	if err != nil {
-		log.Error("Call", "err", err)
-		return nil, err
-	}
-	if len(result) == 0 {
-		return nil, errors.New("GetCoinsForEthereumAddress result is 0")
-	}
-
 	var out *big.Int
-
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		log.Debug("UnpackIntoInterface", "err", err, "ethAddress", ethAddress)
+	if err := caller.Call(blockHash, &out, conversion.GetContract_Method_getAmount(), ethAddress); err != nil {
+		log.Debug("GetCoinsForEthereumAddress", "err", err, "ethAddress", ethAddress)
 		return nil, err
 	}
-
 	return out, nil
 }
 
@@ -0,0 +1,192 @@
+package proofofstake
+
+import (
+	"bytes"
+	"errors"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/crypto"
+	"github.com/QuantumCoinProject/qc/crypto/cryptobase"
+	"github.com/QuantumCoinProject/qc/eth/protocols/eth"
+	"github.com/QuantumCoinProject/qc/rlp"
+	"math/big"
+	"sort"
+)
+
+var (
+	ErrCertificateRound     = errors.New("commit certificate round mismatch")
+	ErrCertificateSigners   = errors.New("commit certificate signer bitmap mismatch")
+	ErrCertificateSignature = errors.New("invalid commit certificate signature")
+)
+
+// CommitCertificate is the compact form of the commit packets of the final round
+// of a block. All commits of the round sign the same data, so only the signatures
+// are kept. Signers is a bitmap over the filtered validators of the block sorted
+// by address and Signatures holds the signatures of the set bits in that order.
+type CommitCertificate struct {
+	Round      byte     `json:"round" gencodec:"required"`
+	Version    byte     `json:"version" gencodec:"required"` //Consensus network protocol version of the commit packets
+	Signers    []byte   `json:"signers" gencodec:"required"`
+	Signatures [][]byte `json:"signatures" gencodec:"required"`
+}
+
+// sortedValidators returns the validators of a deposit map ordered by address,
+// the order the bits of a commit certificate refer to.
+func sortedValidators(validatorDepositMap map[common.Address]*big.Int) []common.Address {
+	validators := make([]common.Address, 0, len(validatorDepositMap))
+	for v := range validatorDepositMap {
+		validators = append(validators, v)
+	}
+	sort.Slice(validators, func(i, j int) bool {
+		return bytes.Compare(validators[i].Bytes(), validators[j].Bytes()) < 0
+	})
+	return validators
+}
+
+// commitPacketData returns the consensus data every validator signs to commit
+// a round.
+func commitPacketData(version byte, round byte, commitHash common.Hash) ([]byte, error) {
+	data, err := rlp.EncodeToBytes(&CommitDetails{CommitHash: commitHash, Round: round})
+	if err != nil {
+		return nil, err
+	}
+	if version >= MinConsensusNetworkProtocolVersion {
+		return append([]byte{version, byte(CONSENSUS_PACKET_TYPE_COMMIT_BLOCK)}, data...), nil
+	}
+	return append([]byte{byte(CONSENSUS_PACKET_TYPE_COMMIT_BLOCK)}, data...), nil
+}
+
+// NewCommitCertificate compacts the commit packets of a round into a certificate.
+// The certificate uses the packet format most of the commits were sent with;
+// packets that cannot be expressed in it are returned so they can be kept as
+// they are. No certificate is returned if none of the packets fit.
+func NewCommitCertificate(parentHash common.Hash, round byte, commitHash common.Hash, validatorDepositMap map[common.Address]*big.Int,
+	commitPackets map[common.Address]*eth.ConsensusPacket) (*CommitCertificate, []*eth.ConsensusPacket, error) {
+	var version byte
+	var data []byte
+	matched := -1
+	for _, v := range []byte{ConsensusNetworkProtocolVersion, 0} {
+		d, err := commitPacketData(v, round, commitHash)
+		if err != nil {
+			return nil, nil, err
+		}
+		count := 0
+		for validator, packet := range commitPackets {
+			if _, ok := validatorDepositMap[validator]; ok && packet.ParentHash.IsEqualTo(parentHash) && bytes.Equal(packet.ConsensusData, d) {
+				count++
+			}
+		}
+		if count > matched {
+			version, data, matched = v, d, count
+		}
+	}
+
+	remaining := make([]*eth.ConsensusPacket, 0)
+	if matched == 0 {
+		for _, packet := range commitPackets {
+			remaining = append(remaining, packet)
+		}
+		return nil, remaining, nil
+	}
+
+	validators := sortedValidators(validatorDepositMap)
+	cert := &CommitCertificate{
+		Round:      round,
+		Version:    version,
+		Signers:    make([]byte, (len(validators)+7)/8),
+		Signatures: make([][]byte, 0, matched),
+	}
+	for i, v := range validators {
+		packet, ok := commitPackets[v]
+		if ok == false {
+			continue
+		}
+		if packet.ParentHash.IsEqualTo(parentHash) == false || bytes.Equal(packet.ConsensusData, data) == false {
+			remaining = append(remaining, packet)
+			continue
+		}
+		cert.Signers[i/8] |= 1 << (uint(i) % 8)
+		cert.Signatures = append(cert.Signatures, common.CopyBytes(packet.Signature))
+	}
+	for v, packet := range commitPackets {
+		if _, ok := validatorDepositMap[v]; ok == false {
+			remaining = append(remaining, packet)
+		}
+	}
+	return cert, remaining, nil
+}
+
+// Verify checks the certificate signatures against the validators of the block
+// and returns the validators that committed.
+func (cert *CommitCertificate) Verify(parentHash common.Hash, commitHash common.Hash, validatorDepositMap map[common.Address]*big.Int) ([]common.Address, error) {
+	validators := sortedValidators(validatorDepositMap)
+	if len(cert.Signers) != (len(validators)+7)/8 {
+		return nil, ErrCertificateSigners
+	}
+	digestHash, err := cert.digestHash(parentHash, commitHash)
+	if err != nil {
+		return nil, err
+	}
+
+	signers := make([]common.Address, 0, len(cert.Signatures))
+	for i, v := range validators {
+		if cert.Signers[i/8]&(1<<(uint(i)%8)) == 0 {
+			continue
+		}
+		if len(signers) == len(cert.Signatures) {
+			return nil, ErrCertificateSigners
+		}
+		signer, err := recoverCommitSigner(digestHash, cert.Signatures[len(signers)])
+		if err != nil || signer.IsEqualTo(v) == false {
+			return nil, ErrCertificateSignature
+		}
+		signers = append(signers, v)
+	}
+	//Bits past the last validator must not be set, and every signature must belong to a set bit
+	for i := len(validators); i < len(cert.Signers)*8; i++ {
+		if cert.Signers[i/8]&(1<<(uint(i)%8)) != 0 {
+			return nil, ErrCertificateSigners
+		}
+	}
+	if len(signers) != len(cert.Signatures) {
+		return nil, ErrCertificateSigners
+	}
+	return signers, nil
+}
+
+// RecoverSigners returns the signers of the certificate without checking them
+// against the signer bitmap, for callers that do not know the filtered
+// validators of the block.
+func (cert *CommitCertificate) RecoverSigners(parentHash common.Hash, commitHash common.Hash) ([]common.Address, error) {
+	digestHash, err := cert.digestHash(parentHash, commitHash)
+	if err != nil {
+		return nil, err
+	}
+	signers := make([]common.Address, len(cert.Signatures))
+	for i, signature := range cert.Signatures {
+		signers[i], err = recoverCommitSigner(digestHash, signature)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return signers, nil
+}
+
+// digestHash returns the hash signed by the commits of the certificate.
+func (cert *CommitCertificate) digestHash(parentHash common.Hash, commitHash common.Hash) ([]byte, error) {
+	data, err := commitPacketData(cert.Version, cert.Round, commitHash)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Keccak256(append(parentHash.Bytes(), data...)), nil
+}
+
+func recoverCommitSigner(digestHash []byte, signature []byte) (common.Address, error) {
+	pubKey, err := cryptobase.SigAlg.PublicKeyFromSignature(digestHash, signature)
+	if err != nil {
+		return ZERO_ADDRESS, ErrCertificateSignature
+	}
+	if cryptobase.SigAlg.Verify(pubKey.PubData, digestHash, signature) == false {
+		return ZERO_ADDRESS, ErrCertificateSignature
+	}
+	return cryptobase.SigAlg.PublicKeyToAddress(pubKey)
+}
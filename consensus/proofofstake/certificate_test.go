@@ -0,0 +1,210 @@
+package proofofstake
+
+import (
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/crypto/cryptobase"
+	"github.com/QuantumCoinProject/qc/crypto/signaturealgorithm"
+	"github.com/QuantumCoinProject/qc/eth/protocols/eth"
+	"github.com/QuantumCoinProject/qc/rlp"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestCommitCertificate(t *testing.T) {
+	var (
+		parentHash = randHash()
+		commitHash = randHash()
+		round      = byte(2)
+		keys       = make([]*signaturealgorithm.PrivateKey, 4)
+		addrs      = make([]common.Address, 4)
+		deposits   = make(map[common.Address]*big.Int)
+	)
+	for i := range keys {
+		keys[i], _ = cryptobase.SigAlg.GenerateKey()
+		addrs[i], _ = cryptobase.SigAlg.PublicKeyToAddress(&keys[i].PublicKey)
+		deposits[addrs[i]] = big.NewInt(int64(10 * (i + 1)))
+	}
+
+	packets := make(map[common.Address]*eth.ConsensusPacket)
+	for i := 0; i < 2; i++ {
+		packet := newCommitPacket(t, keys[i], parentHash, round, commitHash)
+		packets[addrs[i]] = &packet
+	}
+	other := newCommitPacket(t, keys[2], parentHash, round+1, commitHash)
+	packets[addrs[2]] = &other
+
+	cert, remaining, err := NewCommitCertificate(parentHash, round, commitHash, deposits, packets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 1 || remaining[0] != &other {
+		t.Fatalf("remaining packets %v, want the packet of the other round", remaining)
+	}
+	if len(cert.Signatures) != 2 || len(cert.Signers) != 1 {
+		t.Fatalf("certificate has %d signatures and %d bitmap bytes, want 2 and 1", len(cert.Signatures), len(cert.Signers))
+	}
+
+	// The certificate survives encoding in the block
+	enc, err := rlp.EncodeToBytes(&BlockAdditionalConsensusData{CommitCertificate: cert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &BlockAdditionalConsensusData{}
+	if err := rlp.DecodeBytes(enc, decoded); err != nil {
+		t.Fatal(err)
+	}
+	signers, err := decoded.CommitCertificate.Verify(parentHash, commitHash, deposits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signers) != 2 {
+		t.Fatalf("verified %d signers, want 2", len(signers))
+	}
+	for _, signer := range signers {
+		if signer != addrs[0] && signer != addrs[1] {
+			t.Fatalf("unexpected signer %x", signer)
+		}
+	}
+	recovered, err := cert.RecoverSigners(parentHash, commitHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recovered) != 2 {
+		t.Fatalf("recovered %d signers, want 2", len(recovered))
+	}
+
+	// A certificate for another parent or commit hash does not verify
+	if _, err := cert.Verify(randHash(), commitHash, deposits); err != ErrCertificateSignature {
+		t.Fatalf("unexpected error %v, want %v", err, ErrCertificateSignature)
+	}
+	if _, err := cert.Verify(parentHash, randHash(), deposits); err != ErrCertificateSignature {
+		t.Fatalf("unexpected error %v, want %v", err, ErrCertificateSignature)
+	}
+
+	// Moving a signature to the bit of another validator is detected
+	swapped := *cert
+	swapped.Signers = []byte{cert.Signers[0] ^ 0x0f}
+	if _, err := swapped.Verify(parentHash, commitHash, deposits); err == nil {
+		t.Fatal("certificate with tampered bitmap accepted")
+	}
+
+	// Bits past the last validator and bitmaps of the wrong length are rejected
+	extra := *cert
+	extra.Signers = []byte{cert.Signers[0] | 0x80}
+	if _, err := extra.Verify(parentHash, commitHash, deposits); err != ErrCertificateSigners {
+		t.Fatalf("unexpected error %v, want %v", err, ErrCertificateSigners)
+	}
+	long := *cert
+	long.Signers = []byte{cert.Signers[0], 0}
+	if _, err := long.Verify(parentHash, commitHash, deposits); err != ErrCertificateSigners {
+		t.Fatalf("unexpected error %v, want %v", err, ErrCertificateSigners)
+	}
+
+	// Extra signatures without a bit are rejected
+	padded := *cert
+	padded.Signatures = append(append([][]byte{}, cert.Signatures...), cert.Signatures[0])
+	if _, err := padded.Verify(parentHash, commitHash, deposits); err != ErrCertificateSigners {
+		t.Fatalf("unexpected error %v, want %v", err, ErrCertificateSigners)
+	}
+}
+
+func TestVerifyCommitPacketsCertificate(t *testing.T) {
+	var (
+		parentHash   = randHash()
+		proposalHash = randHash()
+		round        = byte(1)
+		keys         = make([]*signaturealgorithm.PrivateKey, 3)
+		deposits     = make(map[common.Address]*big.Int)
+		packets      = make(map[common.Address]*eth.ConsensusPacket)
+	)
+	precommitHash := getOkVotePreCommitHash(parentHash, proposalHash, round)
+	commitHash := getCommitHash(precommitHash)
+	for i := range keys {
+		keys[i], _ = cryptobase.SigAlg.GenerateKey()
+		addr, _ := cryptobase.SigAlg.PublicKeyToAddress(&keys[i].PublicKey)
+		deposits[addr] = big.NewInt(int64(10 * (i + 1)))
+		packet := newCommitPacket(t, keys[i], parentHash, round, commitHash)
+		packets[addr] = &packet
+	}
+	cert, remaining, err := NewCommitCertificate(parentHash, round, commitHash, deposits, packets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 0 {
+		t.Fatalf("%d packets not in certificate, want 0", len(remaining))
+	}
+
+	blockConsensusData := &BlockConsensusData{
+		VoteType:              VOTE_TYPE_OK,
+		ProposalHash:          proposalHash,
+		PrecommitHash:         precommitHash,
+		SlashedBlockProposers: []common.Address{},
+		Round:                 round,
+		SelectedTransactions:  []common.Hash{},
+	}
+	consensusData, err := rlp.EncodeToBytes(blockConsensusData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unhashedConsensusData, err := rlp.EncodeToBytes(&BlockAdditionalConsensusData{
+		ConsensusPackets:  []eth.ConsensusPacket{},
+		CommitCertificate: cert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := &types.Header{
+		ParentHash:            parentHash,
+		Number:                big.NewInt(2),
+		Difficulty:            big.NewInt(1),
+		ConsensusData:         consensusData,
+		UnhashedConsensusData: unhashedConsensusData,
+	}
+	stake, err := VerifyCommitPackets(header, deposits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stake.Cmp(big.NewInt(60)) != 0 {
+		t.Fatalf("committed stake %v, want 60", stake)
+	}
+}
+
+func TestPacketHandler_commit_certificate(t *testing.T) {
+	startBlock := COMMIT_CERTIFICATE_START_BLOCK
+	COMMIT_CERTIFICATE_START_BLOCK = 0
+	defer func() {
+		COMMIT_CERTIFICATE_START_BLOCK = startBlock
+	}()
+
+	numKeys := 4
+	_, p2p, valMap, valDetailsMap := Initialize(numKeys)
+	parentHash := getTestParentHash(TEST_CONSENSUS_BLOCK_NUMBER)
+
+	errc := make(chan error, len(p2p.mockP2pHandlers))
+
+	startTime := time.Now().UnixNano() / int64(time.Millisecond)
+	for _, handler := range p2p.mockP2pHandlers {
+		go WaitBlockCommit(parentHash, handler, errc)
+	}
+	ok := ValidateTest(valMap, valDetailsMap, startTime, parentHash, p2p, numKeys, DefaultMaxWaitCount, map[VoteType]bool{VOTE_TYPE_OK: true}, BLOCK_STATE_RECEIVED_COMMITS, t)
+	select {
+	case err := <-errc:
+		t.Fatal(err)
+	default:
+	}
+	if ok == false {
+		t.Fatalf("failed")
+	}
+
+	for _, handler := range p2p.mockP2pHandlers {
+		_, blockAdditionalConsensusData, err := handler.consensusHandler.getBlockConsensusData(parentHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if blockAdditionalConsensusData.CommitCertificate == nil || len(blockAdditionalConsensusData.CommitCertificate.Signatures) == 0 {
+			t.Fatalf("block of %x has no commit certificate", handler.validator)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package proofofstake
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/crypto"
+	"github.com/QuantumCoinProject/qc/crypto/cryptobase"
+	"github.com/QuantumCoinProject/qc/crypto/signaturealgorithm"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"github.com/QuantumCoinProject/qc/params"
+	"github.com/QuantumCoinProject/qc/rlp"
+	"github.com/QuantumCoinProject/qc/trie"
+	"math/big"
+)
+
+const (
+	// bloomTrieBits is the number of bits in a header bloom, each stored as a
+	// separate bit vector per bloom section.
+	bloomTrieBits = 2048
+
+	// CHECKPOINT_QUORUM_PERCENTAGE is the share of the trusted stake that has to
+	// sign a checkpoint for it to be accepted.
+	CHECKPOINT_QUORUM_PERCENTAGE = 67
+)
+
+var (
+	ErrCheckpointOrder      = errors.New("checkpoints are not in increasing section order")
+	ErrCheckpointSignature  = errors.New("invalid checkpoint signature")
+	ErrCheckpointDuplicate  = errors.New("checkpoint signed twice by the same validator")
+	ErrCheckpointQuorum     = errors.New("checkpoint not signed by a quorum of the trusted validators")
+	ErrCheckpointValidators = errors.New("checkpoint has no validators")
+	errCheckpointNotReady   = errors.New("checkpoint section is not complete or not indexed yet")
+)
+
+// chtNode is the value stored in the canonical hash trie for each block.
+type chtNode struct {
+	Hash common.Hash
+	Td   *big.Int
+}
+
+// chtKey returns the canonical hash trie key of a block number.
+func chtKey(number uint64) []byte {
+	var key [8]byte
+	binary.BigEndian.PutUint64(key[:], number)
+	return key[:]
+}
+
+// bloomTrieKey returns the bloom trie key of a bit vector of a bloom section.
+func bloomTrieKey(bit uint, section uint64) []byte {
+	var key [10]byte
+	binary.BigEndian.PutUint16(key[0:2], uint16(bit))
+	binary.BigEndian.PutUint64(key[2:], section)
+	return key[:]
+}
+
+// checkpointSectionHead returns the number of the last block of a checkpoint section.
+func checkpointSectionHead(section uint64) uint64 {
+	return (section+1)*params.CHTFrequency - 1
+}
+
+// computeCHTRoot returns the root of the canonical hash trie over all blocks up
+// to and including the last block of the section.
+func computeCHTRoot(db ethdb.Reader, section uint64) (common.Hash, error) {
+	st := trie.NewStackTrie(nil)
+	last := checkpointSectionHead(section)
+	for number := uint64(0); number <= last; number++ {
+		hash := rawdb.ReadCanonicalHash(db, number)
+		if hash == (common.Hash{}) {
+			return common.Hash{}, errCheckpointNotReady
+		}
+		td := rawdb.ReadTd(db, hash, number)
+		if td == nil {
+			return common.Hash{}, fmt.Errorf("missing total difficulty of block %d", number)
+		}
+		data, err := rlp.EncodeToBytes(&chtNode{Hash: hash, Td: td})
+		if err != nil {
+			return common.Hash{}, err
+		}
+		if err := st.TryUpdate(chtKey(number), data); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	return st.Hash(), nil
+}
+
+// computeBloomTrieRoot returns the root of the trie of the compressed bloom bit
+// vectors of all bloom sections up to the end of the checkpoint section, as
+// stored by the bloom bits indexer.
+func computeBloomTrieRoot(db ethdb.Reader, section uint64) (common.Hash, error) {
+	sections := (checkpointSectionHead(section) + 1) / params.BloomBitsBlocks
+	heads := make([]common.Hash, sections)
+	for i := range heads {
+		heads[i] = rawdb.ReadCanonicalHash(db, (uint64(i)+1)*params.BloomBitsBlocks-1)
+		if heads[i] == (common.Hash{}) {
+			return common.Hash{}, errCheckpointNotReady
+		}
+	}
+
+	st := trie.NewStackTrie(nil)
+	for bit := uint(0); bit < bloomTrieBits; bit++ {
+		for i, head := range heads {
+			bits, err := rawdb.ReadBloomBits(db, bit, uint64(i), head)
+			if err != nil {
+				return common.Hash{}, errCheckpointNotReady
+			}
+			if err := st.TryUpdate(bloomTrieKey(bit, uint64(i)), bits); err != nil {
+				return common.Hash{}, err
+			}
+		}
+	}
+	return st.Hash(), nil
+}
+
+// newCheckpointValidators converts a deposit map into the validator list of a
+// checkpoint, ordered by address.
+func newCheckpointValidators(validatorDepositMap map[common.Address]*big.Int) []params.CheckpointValidator {
+	validators := make([]params.CheckpointValidator, 0, len(validatorDepositMap))
+	for _, v := range sortedValidators(validatorDepositMap) {
+		validators = append(validators, params.CheckpointValidator{Address: v, Deposit: new(big.Int).Set(validatorDepositMap[v])})
+	}
+	return validators
+}
+
+// NewCheckpoint builds the unsigned checkpoint of a section of the canonical
+// chain. The section has to be complete and its bloom bits indexed.
+func (c *ProofOfStake) NewCheckpoint(section uint64) (*params.ValidatorCheckpoint, error) {
+	if c.blockchain == nil {
+		return nil, errors.New("blockchain not set")
+	}
+	headNumber := checkpointSectionHead(section)
+	if c.blockchain.CurrentHeader().Number.Uint64() < headNumber {
+		return nil, errCheckpointNotReady
+	}
+	head := rawdb.ReadCanonicalHash(c.db, headNumber)
+	if head == (common.Hash{}) {
+		return nil, errCheckpointNotReady
+	}
+	chtRoot, err := computeCHTRoot(c.db, section)
+	if err != nil {
+		return nil, err
+	}
+	bloomRoot, err := computeBloomTrieRoot(c.db, section)
+	if err != nil {
+		return nil, err
+	}
+	validatorDepositMap, err := c.GetValidators(head)
+	if err != nil {
+		return nil, err
+	}
+
+	return &params.ValidatorCheckpoint{
+		TrustedCheckpoint: params.TrustedCheckpoint{
+			SectionIndex: section,
+			SectionHead:  head,
+			CHTRoot:      chtRoot,
+			BloomRoot:    bloomRoot,
+		},
+		Validators: newCheckpointValidators(validatorDepositMap),
+		Signatures: []hexutil.Bytes{},
+	}, nil
+}
+
+// CheckpointTd returns the total difficulty of the chain up to and including
+// the section head of a checkpoint. Every block after the genesis block has its
+// number as difficulty, so it follows from the genesis total difficulty alone.
+func CheckpointTd(genesisTd *big.Int, cp *params.ValidatorCheckpoint) *big.Int {
+	number := cp.SectionNumber()
+	td := new(big.Int).Mul(new(big.Int).SetUint64(number), new(big.Int).SetUint64(number+1))
+	td.Rsh(td, 1)
+	return td.Add(td, genesisTd)
+}
+
+// CheckpointSigningHash returns the hash the validators sign to approve a
+// checkpoint. It covers the checkpoint and the validator set it carries.
+func CheckpointSigningHash(cp *params.ValidatorCheckpoint) (common.Hash, error) {
+	data, err := rlp.EncodeToBytes([]interface{}{cp.TrustedCheckpoint.Hash(), cp.Validators})
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(data), nil
+}
+
+// SignCheckpoint adds the signature of a validator key to a checkpoint.
+func SignCheckpoint(cp *params.ValidatorCheckpoint, key *signaturealgorithm.PrivateKey) error {
+	hash, err := CheckpointSigningHash(cp)
+	if err != nil {
+		return err
+	}
+	signature, err := cryptobase.SigAlg.Sign(hash.Bytes(), key)
+	if err != nil {
+		return err
+	}
+	cp.Signatures = append(cp.Signatures, signature)
+	return nil
+}
+
+// CheckpointSigners returns the validators that signed a checkpoint.
+func CheckpointSigners(cp *params.ValidatorCheckpoint) ([]common.Address, error) {
+	hash, err := CheckpointSigningHash(cp)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[common.Address]bool)
+	signers := make([]common.Address, 0, len(cp.Signatures))
+	for _, signature := range cp.Signatures {
+		pubKey, err := cryptobase.SigAlg.PublicKeyFromSignature(hash.Bytes(), signature)
+		if err != nil {
+			return nil, ErrCheckpointSignature
+		}
+		if cryptobase.SigAlg.Verify(pubKey.PubData, hash.Bytes(), signature) == false {
+			return nil, ErrCheckpointSignature
+		}
+		signer, err := cryptobase.SigAlg.PublicKeyToAddress(pubKey)
+		if err != nil {
+			return nil, ErrCheckpointSignature
+		}
+		if seen[signer] {
+			return nil, ErrCheckpointDuplicate
+		}
+		seen[signer] = true
+		signers = append(signers, signer)
+	}
+	return signers, nil
+}
+
+// CheckpointSignedStake returns the stake of the trusted validators that signed
+// a checkpoint, and the total stake of the trusted validators.
+func CheckpointSignedStake(cp *params.ValidatorCheckpoint, validatorDepositMap map[common.Address]*big.Int) (*big.Int, *big.Int, error) {
+	signers, err := CheckpointSigners(cp)
+	if err != nil {
+		return nil, nil, err
+	}
+	signed, total := new(big.Int), new(big.Int)
+	for _, deposit := range validatorDepositMap {
+		total.Add(total, deposit)
+	}
+	for _, signer := range signers {
+		if deposit, ok := validatorDepositMap[signer]; ok {
+			signed.Add(signed, deposit)
+		}
+	}
+	return signed, total, nil
+}
+
+// VerifyCheckpoints checks a chain of checkpoints, ordered by section, starting
+// from a trusted validator set. Each checkpoint has to be signed by validators
+// holding a quorum of the stake of the validator set of the previous checkpoint.
+// The last checkpoint is returned.
+func VerifyCheckpoints(validatorDepositMap map[common.Address]*big.Int, checkpoints []*params.ValidatorCheckpoint) (*params.ValidatorCheckpoint, error) {
+	var last *params.ValidatorCheckpoint
+	for _, cp := range checkpoints {
+		if last != nil && cp.SectionIndex <= last.SectionIndex {
+			return nil, ErrCheckpointOrder
+		}
+		signed, total, err := CheckpointSignedStake(cp, validatorDepositMap)
+		if err != nil {
+			return nil, fmt.Errorf("checkpoint %d: %w", cp.SectionIndex, err)
+		}
+		if total.Sign() == 0 || new(big.Int).Mul(signed, big.NewInt(100)).Cmp(new(big.Int).Mul(total, big.NewInt(CHECKPOINT_QUORUM_PERCENTAGE))) < 0 {
+			return nil, fmt.Errorf("checkpoint %d: %w", cp.SectionIndex, ErrCheckpointQuorum)
+		}
+		if len(cp.Validators) == 0 {
+			return nil, fmt.Errorf("checkpoint %d: %w", cp.SectionIndex, ErrCheckpointValidators)
+		}
+		validatorDepositMap = make(map[common.Address]*big.Int, len(cp.Validators))
+		for _, v := range cp.Validators {
+			if v.Deposit == nil {
+				return nil, fmt.Errorf("checkpoint %d: %w", cp.SectionIndex, ErrCheckpointValidators)
+			}
+			validatorDepositMap[v.Address] = v.Deposit
+		}
+		last = cp
+	}
+	return last, nil
+}
+
+// VerifyTrustedCheckpoints checks signed checkpoints against the validators of
+// the genesis block and returns the latest one, or nil if there are none.
+func (c *ProofOfStake) VerifyTrustedCheckpoints(genesisHash common.Hash, checkpoints []*params.ValidatorCheckpoint) (*params.ValidatorCheckpoint, error) {
+	if len(checkpoints) == 0 {
+		return nil, nil
+	}
+	validatorDepositMap, err := c.GetValidators(genesisHash)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyCheckpoints(validatorDepositMap, checkpoints)
+}
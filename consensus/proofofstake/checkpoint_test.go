@@ -0,0 +1,166 @@
+package proofofstake
+
+import (
+	"errors"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/crypto/cryptobase"
+	"github.com/QuantumCoinProject/qc/crypto/signaturealgorithm"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"github.com/QuantumCoinProject/qc/params"
+	"math/big"
+	"testing"
+)
+
+func newCheckpointKeys(t *testing.T, count int) ([]*signaturealgorithm.PrivateKey, map[common.Address]*big.Int) {
+	keys := make([]*signaturealgorithm.PrivateKey, count)
+	deposits := make(map[common.Address]*big.Int)
+	for i := range keys {
+		key, err := cryptobase.SigAlg.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		addr, err := cryptobase.SigAlg.PublicKeyToAddress(&key.PublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+		deposits[addr] = big.NewInt(int64(10 * (i + 1)))
+	}
+	return keys, deposits
+}
+
+func newTestCheckpoint(t *testing.T, section uint64, validators map[common.Address]*big.Int, signers ...*signaturealgorithm.PrivateKey) *params.ValidatorCheckpoint {
+	cp := &params.ValidatorCheckpoint{
+		TrustedCheckpoint: params.TrustedCheckpoint{
+			SectionIndex: section,
+			SectionHead:  randHash(),
+			CHTRoot:      randHash(),
+			BloomRoot:    randHash(),
+		},
+		Validators: newCheckpointValidators(validators),
+	}
+	for _, key := range signers {
+		if err := SignCheckpoint(cp, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cp
+}
+
+func TestVerifyCheckpoints(t *testing.T) {
+	genesisKeys, genesisDeposits := newCheckpointKeys(t, 4) // Deposits 10, 20, 30, 40
+	nextKeys, nextDeposits := newCheckpointKeys(t, 3)       // Deposits 10, 20, 30
+
+	// 20+30+40 of 100 signed the first checkpoint, its validators sign the second
+	first := newTestCheckpoint(t, 0, nextDeposits, genesisKeys[1], genesisKeys[2], genesisKeys[3])
+	second := newTestCheckpoint(t, 2, genesisDeposits, nextKeys[1], nextKeys[2])
+	last, err := VerifyCheckpoints(genesisDeposits, []*params.ValidatorCheckpoint{first, second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last != second {
+		t.Fatalf("verified checkpoint %d, want %d", last.SectionIndex, second.SectionIndex)
+	}
+
+	// The second checkpoint is not signed by the validators of the first one
+	wrongSet := newTestCheckpoint(t, 2, genesisDeposits, genesisKeys...)
+	if _, err := VerifyCheckpoints(genesisDeposits, []*params.ValidatorCheckpoint{first, wrongSet}); !errors.Is(err, ErrCheckpointQuorum) {
+		t.Fatalf("unexpected error %v, want %v", err, ErrCheckpointQuorum)
+	}
+
+	// 10+20+30 of 100 is below the quorum
+	minority := newTestCheckpoint(t, 0, nextDeposits, genesisKeys[0], genesisKeys[1], genesisKeys[2])
+	if _, err := VerifyCheckpoints(genesisDeposits, []*params.ValidatorCheckpoint{minority}); !errors.Is(err, ErrCheckpointQuorum) {
+		t.Fatalf("unexpected error %v, want %v", err, ErrCheckpointQuorum)
+	}
+
+	// Signing twice does not count twice
+	duplicate := newTestCheckpoint(t, 0, nextDeposits, genesisKeys[3], genesisKeys[3])
+	if _, err := VerifyCheckpoints(genesisDeposits, []*params.ValidatorCheckpoint{duplicate}); !errors.Is(err, ErrCheckpointDuplicate) {
+		t.Fatalf("unexpected error %v, want %v", err, ErrCheckpointDuplicate)
+	}
+
+	// Changing the checkpoint or its validator set invalidates the signatures
+	tampered := *first
+	tampered.CHTRoot = randHash()
+	if _, err := VerifyCheckpoints(genesisDeposits, []*params.ValidatorCheckpoint{&tampered}); err == nil {
+		t.Fatal("checkpoint with tampered root accepted")
+	}
+	tampered = *first
+	tampered.Validators = newCheckpointValidators(genesisDeposits)
+	if _, err := VerifyCheckpoints(genesisDeposits, []*params.ValidatorCheckpoint{&tampered}); err == nil {
+		t.Fatal("checkpoint with tampered validators accepted")
+	}
+
+	// Checkpoints have to be ordered by section
+	if _, err := VerifyCheckpoints(genesisDeposits, []*params.ValidatorCheckpoint{second, first}); err == nil {
+		t.Fatal("unordered checkpoints accepted")
+	}
+}
+
+func writeCheckpointChain(db ethdb.Database, blocks uint64) {
+	td := new(big.Int)
+	for number := uint64(0); number < blocks; number++ {
+		hash := randHash()
+		td.Add(td, big.NewInt(1))
+		rawdb.WriteCanonicalHash(db, hash, number)
+		rawdb.WriteTd(db, hash, number, td)
+		if (number+1)%params.BloomBitsBlocks == 0 {
+			section := (number+1)/params.BloomBitsBlocks - 1
+			for bit := uint(0); bit < bloomTrieBits; bit++ {
+				rawdb.WriteBloomBits(db, bit, section, hash, []byte{byte(bit), byte(section)})
+			}
+		}
+	}
+}
+
+func TestCheckpointRoots(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	writeCheckpointChain(db, params.CHTFrequency)
+
+	chtRoot, err := computeCHTRoot(db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bloomRoot, err := computeBloomTrieRoot(db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chtRoot == (common.Hash{}) || bloomRoot == (common.Hash{}) || chtRoot == bloomRoot {
+		t.Fatalf("unexpected roots %x %x", chtRoot, bloomRoot)
+	}
+
+	// The next section is not complete yet
+	if _, err := computeCHTRoot(db, 1); err != errCheckpointNotReady {
+		t.Fatalf("unexpected error %v, want %v", err, errCheckpointNotReady)
+	}
+	if _, err := computeBloomTrieRoot(db, 1); err != errCheckpointNotReady {
+		t.Fatalf("unexpected error %v, want %v", err, errCheckpointNotReady)
+	}
+
+	// A different canonical block changes the CHT root
+	rawdb.WriteCanonicalHash(db, randHash(), 100)
+	rawdb.WriteTd(db, rawdb.ReadCanonicalHash(db, 100), 100, big.NewInt(101))
+	changed, err := computeCHTRoot(db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed == chtRoot {
+		t.Fatal("CHT root does not cover the canonical hashes")
+	}
+}
+
+func TestCheckpointTd(t *testing.T) {
+	genesisTd := big.NewInt(1)
+	for _, section := range []uint64{0, 1, 5} {
+		cp := &params.ValidatorCheckpoint{TrustedCheckpoint: params.TrustedCheckpoint{SectionIndex: section}}
+		want := new(big.Int).Set(genesisTd)
+		for number := uint64(1); number <= cp.SectionNumber(); number++ {
+			want.Add(want, new(big.Int).SetUint64(number))
+		}
+		if td := CheckpointTd(genesisTd, cp); td.Cmp(want) != 0 {
+			t.Fatalf("failed %v %v %v", section, td, want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package proofofstake
+
+import (
+	"errors"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/crypto"
+	"github.com/QuantumCoinProject/qc/crypto/cryptobase"
+	"github.com/QuantumCoinProject/qc/rlp"
+	"math/big"
+)
+
+var (
+	ErrCommitPrecommitHashMismatch = errors.New("precommit hash does not match block consensus data")
+	ErrCommitPacketParentHash      = errors.New("commit packet signed over unexpected parent hash")
+)
+
+// VerifyCommitPackets checks the commit packets and the commit certificate
+// embedded in header against the given validator deposits, without access to
+// the chain state. The packets are signed over header.ParentHash, so the
+// returned stake is the deposit of the distinct validators that committed to a
+// child of the parent block in the round recorded in the header's consensus
+// data. Packets of other types, of other rounds and of validators missing from
+// validatorDepositMap are ignored.
+func VerifyCommitPackets(header *types.Header, validatorDepositMap map[common.Address]*big.Int) (*big.Int, error) {
+	if header.ConsensusData == nil || header.UnhashedConsensusData == nil {
+		return nil, errors.New("VerifyCommitPackets nil")
+	}
+	blockConsensusData := &BlockConsensusData{}
+	if err := rlp.DecodeBytes(header.ConsensusData, blockConsensusData); err != nil {
+		return nil, err
+	}
+	blockAdditionalConsensusData := &BlockAdditionalConsensusData{}
+	if err := rlp.DecodeBytes(header.UnhashedConsensusData, blockAdditionalConsensusData); err != nil {
+		return nil, err
+	}
+	if len(blockAdditionalConsensusData.ConsensusPackets) > MAX_PACKETS_SAFETY_LIMIT {
+		return nil, PacketsOverLimitErr
+	}
+
+	var precommitHash common.Hash
+	switch blockConsensusData.VoteType {
+	case VOTE_TYPE_OK:
+		precommitHash = getOkVotePreCommitHash(header.ParentHash, blockConsensusData.ProposalHash, blockConsensusData.Round)
+	case VOTE_TYPE_NIL:
+		precommitHash = getNilVotePreCommitHash(header.ParentHash, blockConsensusData.Round)
+	default:
+		return nil, errors.New("invalid vote type")
+	}
+	if precommitHash.IsEqualTo(blockConsensusData.PrecommitHash) == false {
+		return nil, ErrCommitPrecommitHashMismatch
+	}
+	commitHash := getCommitHash(precommitHash)
+
+	committed := make(map[common.Address]bool)
+	stake := new(big.Int)
+	for _, packet := range blockAdditionalConsensusData.ConsensusPackets {
+		if len(packet.ConsensusData) == 0 || len(packet.Signature) == 0 {
+			return nil, InvalidPacketErr
+		}
+		startIndex := 1
+		if packet.ConsensusData[0] >= MinConsensusNetworkProtocolVersion {
+			startIndex = 2
+		}
+		if len(packet.ConsensusData) <= startIndex || ConsensusPacketType(packet.ConsensusData[startIndex-1]) != CONSENSUS_PACKET_TYPE_COMMIT_BLOCK {
+			continue
+		}
+		if packet.ParentHash.IsEqualTo(header.ParentHash) == false {
+			return nil, ErrCommitPacketParentHash
+		}
+
+		digestHash := crypto.Keccak256(append(packet.ParentHash.Bytes(), packet.ConsensusData...))
+		pubKey, err := cryptobase.SigAlg.PublicKeyFromSignature(digestHash, packet.Signature)
+		if err != nil {
+			return nil, err
+		}
+		if cryptobase.SigAlg.Verify(pubKey.PubData, digestHash, packet.Signature) == false {
+			return nil, InvalidPacketErr
+		}
+		validator, err := cryptobase.SigAlg.PublicKeyToAddress(pubKey)
+		if err != nil {
+			return nil, err
+		}
+
+		details := CommitDetails{}
+		if err := rlp.DecodeBytes(packet.ConsensusData[startIndex:], &details); err != nil {
+			return nil, err
+		}
+		if details.Round != blockConsensusData.Round || details.CommitHash.IsEqualTo(commitHash) == false {
+			continue
+		}
+		deposit, ok := validatorDepositMap[validator]
+		if ok == false || committed[validator] {
+			continue
+		}
+		committed[validator] = true
+		stake.Add(stake, deposit)
+	}
+
+	if cert := blockAdditionalConsensusData.CommitCertificate; cert != nil && cert.Round == blockConsensusData.Round {
+		signers, err := cert.RecoverSigners(header.ParentHash, commitHash)
+		if err != nil {
+			return nil, err
+		}
+		for _, validator := range signers {
+			deposit, ok := validatorDepositMap[validator]
+			if ok == false || committed[validator] {
+				continue
+			}
+			committed[validator] = true
+			stake.Add(stake, deposit)
+		}
+	}
+	return stake, nil
+}
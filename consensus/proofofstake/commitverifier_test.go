@@ -0,0 +1,106 @@
+package proofofstake
+
+import (
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/crypto"
+	"github.com/QuantumCoinProject/qc/crypto/cryptobase"
+	"github.com/QuantumCoinProject/qc/crypto/signaturealgorithm"
+	"github.com/QuantumCoinProject/qc/eth/protocols/eth"
+	"github.com/QuantumCoinProject/qc/rlp"
+	"math/big"
+	"testing"
+)
+
+func newCommitPacket(t *testing.T, key *signaturealgorithm.PrivateKey, parentHash common.Hash, round byte, commitHash common.Hash) eth.ConsensusPacket {
+	data, err := rlp.EncodeToBytes(&CommitDetails{CommitHash: commitHash, Round: round})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append([]byte{ConsensusNetworkProtocolVersion, byte(CONSENSUS_PACKET_TYPE_COMMIT_BLOCK)}, data...)
+	signature, err := cryptobase.SigAlg.Sign(crypto.Keccak256(append(parentHash.Bytes(), data...)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return eth.ConsensusPacket{ParentHash: parentHash, Signature: signature, ConsensusData: data}
+}
+
+func newCommitHeader(t *testing.T, parentHash common.Hash, blockConsensusData *BlockConsensusData, packets []eth.ConsensusPacket) *types.Header {
+	consensusData, err := rlp.EncodeToBytes(blockConsensusData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unhashedConsensusData, err := rlp.EncodeToBytes(&BlockAdditionalConsensusData{ConsensusPackets: packets})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &types.Header{
+		ParentHash:            parentHash,
+		Number:                big.NewInt(2),
+		Difficulty:            big.NewInt(1),
+		ConsensusData:         consensusData,
+		UnhashedConsensusData: unhashedConsensusData,
+	}
+}
+
+func TestVerifyCommitPackets(t *testing.T) {
+	var (
+		parentHash   = randHash()
+		proposalHash = randHash()
+		round        = byte(1)
+		keys         = make([]*signaturealgorithm.PrivateKey, 4)
+		deposits     = make(map[common.Address]*big.Int)
+	)
+	for i := range keys {
+		keys[i], _ = cryptobase.SigAlg.GenerateKey()
+		addr, _ := cryptobase.SigAlg.PublicKeyToAddress(&keys[i].PublicKey)
+		if i < 3 {
+			deposits[addr] = big.NewInt(int64(10 * (i + 1)))
+		}
+	}
+	precommitHash := getOkVotePreCommitHash(parentHash, proposalHash, round)
+	commitHash := getCommitHash(precommitHash)
+	blockConsensusData := &BlockConsensusData{
+		VoteType:              VOTE_TYPE_OK,
+		ProposalHash:          proposalHash,
+		PrecommitHash:         precommitHash,
+		SlashedBlockProposers: []common.Address{},
+		Round:                 round,
+		SelectedTransactions:  []common.Hash{},
+	}
+
+	packets := []eth.ConsensusPacket{
+		newCommitPacket(t, keys[0], parentHash, round, commitHash),
+		newCommitPacket(t, keys[0], parentHash, round, commitHash), // duplicate
+		newCommitPacket(t, keys[1], parentHash, round, commitHash),
+		newCommitPacket(t, keys[2], parentHash, round+1, commitHash), // other round
+		newCommitPacket(t, keys[3], parentHash, round, commitHash),   // not a validator
+	}
+	stake, err := VerifyCommitPackets(newCommitHeader(t, parentHash, blockConsensusData, packets), deposits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stake.Cmp(big.NewInt(30)) != 0 {
+		t.Fatalf("committed stake %v, want 30", stake)
+	}
+
+	// A packet whose signature does not match its data is rejected
+	forged := newCommitPacket(t, keys[2], parentHash, round, commitHash)
+	forged.ConsensusData[len(forged.ConsensusData)-1] ^= 0x01
+	if _, err := VerifyCommitPackets(newCommitHeader(t, parentHash, blockConsensusData, append(packets, forged)), deposits); err == nil {
+		t.Fatal("forged commit packet accepted")
+	}
+
+	// Packets signed over another parent cannot attest this one
+	stray := newCommitPacket(t, keys[2], randHash(), round, commitHash)
+	if _, err := VerifyCommitPackets(newCommitHeader(t, parentHash, blockConsensusData, append(packets, stray)), deposits); err != ErrCommitPacketParentHash {
+		t.Fatalf("unexpected error %v, want %v", err, ErrCommitPacketParentHash)
+	}
+
+	// The header's precommit hash must be derived from its parent
+	mismatched := *blockConsensusData
+	mismatched.PrecommitHash = randHash()
+	if _, err := VerifyCommitPackets(newCommitHeader(t, parentHash, &mismatched, packets), deposits); err != ErrCommitPrecommitHashMismatch {
+		t.Fatalf("unexpected error %v, want %v", err, ErrCommitPrecommitHashMismatch)
+	}
+}
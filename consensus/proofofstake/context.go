@@ -1,137 +1,52 @@
 package proofofstake
 
 import (
-	"context"
 	"errors"
 	"github.com/QuantumCoinProject/qc/common"
-	"github.com/QuantumCoinProject/qc/common/hexutil"
 	"github.com/QuantumCoinProject/qc/core/state"
 	"github.com/QuantumCoinProject/qc/core/types"
-	"github.com/QuantumCoinProject/qc/internal/ethapi"
 	"github.com/QuantumCoinProject/qc/log"
-	"github.com/QuantumCoinProject/qc/rpc"
+	"github.com/QuantumCoinProject/qc/systemcontracts"
 	"github.com/QuantumCoinProject/qc/systemcontracts/consensuscontext"
-	"math"
 	"strconv"
 )
 
 func (p *ProofOfStake) SetConsensusContext(key string, context [32]byte, state *state.StateDB, header *types.Header) error {
-	method := consensuscontext.SET_CONTEXT_METHOD
-	abiData, err := consensuscontext.GetConsensusContract_ABI()
-	if err != nil {
-		log.Error("SetConsensusContext abi error", "err", err)
-		return err
-	}
-	contractAddress := consensuscontext.CONSENSUS_CONTEXT_CONTRACT_ADDRESS
-
-	data, err := encodeCall(&abiData, method, key, context)
-	if err != nil {
-		log.Error("Unable to pack SetConsensusContext", "error", err)
-		return err
-	}
-
-	msgData := (hexutil.Bytes)(data)
-	var from common.Address
-	from.CopyFrom(ZERO_ADDRESS)
-	args := ethapi.TransactionArgs{
-		From: &from,
-		To:   &contractAddress,
-		Data: &msgData,
-	}
-
-	msg, err := args.ToMessage(math.MaxUint64)
-	if err != nil {
-		return err
-	}
-
-	_, err = p.blockchain.ExecuteNoGas(msg, state, header)
+	caller, err := p.consensusContextCaller()
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return caller.Execute(state, header, nil, consensuscontext.SET_CONTEXT_METHOD, key, context)
 }
 
 func (p *ProofOfStake) DeleteConsensusContext(key string, state *state.StateDB, header *types.Header) error {
-	method := consensuscontext.DELETE_CONTEXT_METHOD
-	abiData, err := consensuscontext.GetConsensusContract_ABI()
-	if err != nil {
-		log.Error("DeleteConsensusContext abi error", "err", err)
-		return err
-	}
-	contractAddress := consensuscontext.CONSENSUS_CONTEXT_CONTRACT_ADDRESS
-
-	data, err := encodeCall(&abiData, method, key)
-	if err != nil {
-		log.Error("Unable to pack DeleteConsensusContext", "error", err)
-		return err
-	}
-
-	msgData := (hexutil.Bytes)(data)
-	var from common.Address
-	from.CopyFrom(ZERO_ADDRESS)
-	args := ethapi.TransactionArgs{
-		From: &from,
-		To:   &contractAddress,
-		Data: &msgData,
-	}
-
-	msg, err := args.ToMessage(math.MaxUint64)
-	if err != nil {
-		return err
-	}
-
-	_, err = p.blockchain.ExecuteNoGas(msg, state, header)
+	caller, err := p.consensusContextCaller()
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return caller.Execute(state, header, nil, consensuscontext.DELETE_CONTEXT_METHOD, key)
 }
 
 func (p *ProofOfStake) GetConsensusContext(key string, blockHash common.Hash) ([32]byte, error) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
 	var out [32]byte
-
-	method := consensuscontext.GET_CONTEXT_METHOD
-
-	abiData, err := consensuscontext.GetConsensusContract_ABI()
+	caller, err := p.consensusContextCaller()
 	if err != nil {
-		log.Error("GetConsensusContext abi error", "err", err)
 		return out, err
 	}
-	contractAddress := consensuscontext.CONSENSUS_CONTEXT_CONTRACT_ADDRESS
-
-	// call
-	data, err := abiData.Pack(method, key)
-	if err != nil {
-		log.Error("Unable to pack tx for GetConsensusContext", "error", err)
+	if err := caller.Call(blockHash, &out, consensuscontext.GET_CONTEXT_METHOD, key); err != nil {
+		log.Debug("GetConsensusContext", "err", err, "key", key)
 		return out, err
 	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
+	return out, nil
+}
 
-	msgData := (hexutil.Bytes)(data)
-	result, err := p.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
+func (p *ProofOfStake) consensusContextCaller() (*systemcontracts.Caller, error) {
+	abiData, err := consensuscontext.GetConsensusContract_ABI()
 	if err != nil {
-		log.Error("Call", "err", err)
-		return out, err
+		log.Error("consensus context abi error", "err", err)
+		return nil, err
 	}
-	if len(result) == 0 {
-		return out, errors.New("GetConsensusContext result is 0")
-	}
-
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		log.Debug("UnpackIntoInterface", "err", err, "key", key)
-		return out, err
-	}
-
-	return out, nil
+	return p.newCaller(consensuscontext.CONSENSUS_CONTEXT_CONTRACT_ADDRESS, abiData), nil
 }
 
 func GetConsensusContextKey(blockNumber uint64) (string, error) {
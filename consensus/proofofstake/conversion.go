@@ -1,61 +1,25 @@
 package proofofstake
 
 import (
-	"errors"
 	"github.com/QuantumCoinProject/qc/common"
-	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/conversionutil"
 	"github.com/QuantumCoinProject/qc/core/state"
 	"github.com/QuantumCoinProject/qc/core/types"
-	"github.com/QuantumCoinProject/qc/internal/ethapi"
 	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/systemcontracts"
 	"github.com/QuantumCoinProject/qc/systemcontracts/conversion"
-	"math"
+	"github.com/QuantumCoinProject/qc/systemcontracts/governance"
 	"math/big"
 )
 
 func (p *ProofOfStake) GetCoinsForEthereumAddress(ethAddress common.Address, state *state.StateDB, header *types.Header) (*big.Int, error) {
-	method := conversion.GetContract_Method_getAmount()
-	abiData, err := conversion.GetConversionContract_ABI()
-	if err != nil {
-		log.Error("GetCoinsForEthereumAddress abi error", "err", err)
-		return nil, err
-	}
-	contractAddress := common.HexToAddress(conversion.CONVERSION_CONTRACT)
-
-	// call
-	data, err := encodeCall(&abiData, method, ethAddress)
-	if err != nil {
-		log.Error("Unable to pack GetCoinsForEthereumAddress", "error", err)
-		return nil, err
-	}
-
-	msgData := (hexutil.Bytes)(data)
-	var from common.Address
-	from.CopyFrom(ZERO_ADDRESS)
-	args := ethapi.TransactionArgs{
-		From: &from,
-		To:   &contractAddress,
-		Data: &msgData,
-	}
-
-	msg, err := args.ToMessage(math.MaxUint64)
+	caller, err := p.conversionCaller()
 	if err != nil {
 		return nil, err
 	}
-
-	result, err := p.blockchain.ExecuteNoGas(msg, state, header)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(result) == 0 {
-		return nil, errors.New("GetCoinsForEthereumAddress result is 0")
-	}
-
 	var out *big.Int
-
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		log.Error("GetCoinsForEthereumAddress UnpackIntoInterface", "err", err, "ethAddress", ethAddress)
+	if err := caller.Execute(state, header, &out, conversion.GetContract_Method_getAmount(), ethAddress); err != nil {
+		log.Error("GetCoinsForEthereumAddress", "err", err, "ethAddress", ethAddress)
 		return nil, err
 	}
 
@@ -65,48 +29,13 @@ func (p *ProofOfStake) GetCoinsForEthereumAddress(ethAddress common.Address, sta
 }
 
 func (p *ProofOfStake) GetConversionStatus(ethAddress common.Address, state *state.StateDB, header *types.Header) (bool, error) {
-	method := conversion.GetContract_Method_getConversionStatus()
-	abiData, err := conversion.GetConversionContract_ABI()
-	if err != nil {
-		log.Error("GetConversionStatus abi error", "err", err)
-		return false, err
-	}
-	contractAddress := common.HexToAddress(conversion.CONVERSION_CONTRACT)
-
-	// call
-	data, err := encodeCall(&abiData, method, ethAddress)
-	if err != nil {
-		log.Error("Unable to pack GetConversionStatus", "error", err)
-		return false, err
-	}
-
-	msgData := (hexutil.Bytes)(data)
-	var from common.Address
-	from.CopyFrom(ZERO_ADDRESS)
-	args := ethapi.TransactionArgs{
-		From: &from,
-		To:   &contractAddress,
-		Data: &msgData,
-	}
-
-	msg, err := args.ToMessage(math.MaxUint64)
-	if err != nil {
-		return false, err
-	}
-
-	result, err := p.blockchain.ExecuteNoGas(msg, state, header)
+	caller, err := p.conversionCaller()
 	if err != nil {
 		return false, err
 	}
-
-	if len(result) == 0 {
-		return false, errors.New("GetConversionStatus result is 0")
-	}
-
 	var out bool
-
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		log.Error("GetConversionStatus UnpackIntoInterface", "err", err, "ethAddress", ethAddress)
+	if err := caller.Execute(state, header, &out, conversion.GetContract_Method_getConversionStatus(), ethAddress); err != nil {
+		log.Error("GetConversionStatus", "err", err, "ethAddress", ethAddress)
 		return false, err
 	}
 
@@ -117,103 +46,175 @@ func (p *ProofOfStake) GetConversionStatus(ethAddress common.Address, state *sta
 
 func (p *ProofOfStake) SetConverted(ethereumAddress common.Address, quantumAddress common.Address,
 	state *state.StateDB, header *types.Header) (*big.Int, error) {
-	method := conversion.GetContract_Method_setConverted()
-	abiData, err := conversion.GetConversionContract_ABI()
+	caller, err := p.conversionCaller()
 	if err != nil {
-		log.Error("SetConverted abi error", "err", err)
 		return nil, err
 	}
-	contractAddress := common.HexToAddress(conversion.CONVERSION_CONTRACT)
-
-	// call
-	data, err := encodeCall(&abiData, method, ethereumAddress, quantumAddress)
-	if err != nil {
-		log.Error("Unable to pack SetConverted", "error", err)
+	var out *big.Int
+	if err := caller.Execute(state, header, &out, conversion.GetContract_Method_setConverted(), ethereumAddress, quantumAddress); err != nil {
+		log.Error("SetConverted", "err", err, "ethAddress", ethereumAddress)
 		return nil, err
 	}
 
-	msgData := (hexutil.Bytes)(data)
-	var from common.Address
-	from.CopyFrom(ZERO_ADDRESS)
-	args := ethapi.TransactionArgs{
-		From: &from,
-		To:   &contractAddress,
-		Data: &msgData,
-	}
+	log.Info("===============SetConverted", "out", out)
 
-	msg, err := args.ToMessage(math.MaxUint64)
-	if err != nil {
-		return nil, err
-	}
+	return out, nil
+}
 
-	result, err := p.blockchain.ExecuteNoGas(msg, state, header)
+func (p *ProofOfStake) GetQuantumAddress(ethAddress common.Address, state *state.StateDB, header *types.Header) (common.Address, error) {
+	caller, err := p.conversionCaller()
 	if err != nil {
-		return nil, err
-	}
-
-	if len(result) == 0 {
-		return nil, errors.New("SetConverted result is 0")
+		return ZERO_ADDRESS, err
 	}
-
-	var out *big.Int
-
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		log.Error("SetConverted UnpackIntoInterface", "err", err, "ethAddress", ethereumAddress)
-		return nil, err
+	var out common.Address
+	if err := caller.Execute(state, header, &out, conversion.GetContract_Method_getQuantumAddress(), ethAddress); err != nil {
+		log.Error("GetQuantumAddress", "err", err, "ethAddress", ethAddress)
+		return ZERO_ADDRESS, err
 	}
 
-	log.Info("===============SetConverted", "out", out)
+	log.Info("===============GetQuantumAddress", "out", out)
 
 	return out, nil
 }
 
-func (p *ProofOfStake) GetQuantumAddress(ethAddress common.Address, state *state.StateDB, header *types.Header) (common.Address, error) {
-	method := conversion.GetContract_Method_getQuantumAddress()
+func (p *ProofOfStake) conversionCaller() (*systemcontracts.Caller, error) {
 	abiData, err := conversion.GetConversionContract_ABI()
 	if err != nil {
-		log.Error("GetQuantumAddress abi error", "err", err)
-		return ZERO_ADDRESS, err
+		log.Error("conversion abi error", "err", err)
+		return nil, err
 	}
-	contractAddress := common.HexToAddress(conversion.CONVERSION_CONTRACT)
+	return p.newCaller(conversion.CONVERSION_CONTRACT_ADDRESS, abiData), nil
+}
 
-	// call
-	data, err := encodeCall(&abiData, method, ethAddress)
-	if err != nil {
-		log.Error("Unable to pack GetQuantumAddress", "error", err)
-		return ZERO_ADDRESS, err
+// conversionExpiryOf returns the deadline block and the recipient of unclaimed snapshot amounts
+// set through governance. The deadline is 0 if none is set.
+func conversionExpiryOf(state governance.StateDB) (uint64, common.Address, error) {
+	if governance.IsInitialized(state) == false {
+		return 0, ZERO_ADDRESS, nil
 	}
-
-	msgData := (hexutil.Bytes)(data)
-	var from common.Address
-	from.CopyFrom(ZERO_ADDRESS)
-	args := ethapi.TransactionArgs{
-		From: &from,
-		To:   &contractAddress,
-		Data: &msgData,
+	deadline, err := governance.GetParameter(state, governance.PARAMETER_CONVERSION_DEADLINE_BLOCK)
+	if err != nil {
+		return 0, ZERO_ADDRESS, err
 	}
-
-	msg, err := args.ToMessage(math.MaxUint64)
+	recipient, err := governance.GetParameter(state, governance.PARAMETER_CONVERSION_UNCLAIMED_ADDRESS)
 	if err != nil {
-		return ZERO_ADDRESS, err
+		return 0, ZERO_ADDRESS, err
 	}
+	return deadline.Uint64(), common.BigToAddress(recipient), nil
+}
 
-	result, err := p.blockchain.ExecuteNoGas(msg, state, header)
+// isPastConversionDeadline reports whether snapshot entries can no longer be converted in the block,
+// since the conversion deadline set through governance has passed.
+func isPastConversionDeadline(state governance.StateDB, blockNumber uint64) (bool, error) {
+	if blockNumber < conversion.CONVERSION_V2_START_BLOCK {
+		return false, nil
+	}
+	deadline, _, err := conversionExpiryOf(state)
 	if err != nil {
-		return ZERO_ADDRESS, err
+		return false, err
 	}
+	return deadline != 0 && blockNumber > deadline, nil
+}
 
-	if len(result) == 0 {
-		return ZERO_ADDRESS, errors.New("GetQuantumAddress result is 0")
-	}
+// processConversionExpiry moves the amounts of unconverted snapshot entries to the unclaimed address
+// after the conversion deadline. Up to CONVERSION_EXPIRY_BATCH_SIZE entries are visited per block, in
+// address order, starting from the cursor stored in the conversion contract. It never fails the block:
+// entries that cannot be expired are logged and skipped.
+func (p *ProofOfStake) processConversionExpiry(header *types.Header, state *state.StateDB) {
+	blockNumber := header.Number.Uint64()
+	if blockNumber < conversion.CONVERSION_V2_START_BLOCK || conversion.IsExpiryProcessed(state) {
+		return
+	}
+	deadline, recipient, err := conversionExpiryOf(state)
+	if err != nil {
+		log.Error("processConversionExpiry conversionExpiryOf", "err", err)
+		return
+	}
+	if deadline == 0 || blockNumber <= deadline {
+		return
+	}
+
+	expireSnapshotBatch(state, conversionutil.SnapshotAddresses(), recipient, blockNumber, func(ethAddress common.Address) (*big.Int, error) {
+		coins, err := p.GetCoinsForEthereumAddress(ethAddress, state, header)
+		if err != nil {
+			return nil, err
+		}
+		if coins.Sign() <= 0 {
+			return coins, nil
+		}
+		converted, err := p.GetConversionStatus(ethAddress, state, header)
+		if err != nil {
+			return nil, err
+		}
+		if converted {
+			return big.NewInt(0), nil
+		}
+		return coins, nil
+	})
+}
 
-	var out common.Address
+// expireSnapshotBatch expires the next batch of snapshot entries after the stored cursor, and then
+// advances the cursor past the batch. unclaimedOf returns the amount of an entry that was not converted.
+func expireSnapshotBatch(state conversion.StateDB, addresses []string, recipient common.Address, blockNumber uint64,
+	unclaimedOf func(common.Address) (*big.Int, error)) {
+	start := conversion.GetExpiryCursor(state)
+	if start > uint64(len(addresses)) {
+		start = uint64(len(addresses))
+	}
+	end := start + CONVERSION_EXPIRY_BATCH_SIZE
+	if end > uint64(len(addresses)) {
+		end = uint64(len(addresses))
+	}
+
+	total := big.NewInt(0)
+	count := 0
+	skipped := 0
+	for _, eAddress := range addresses[start:end] {
+		ethAddress := common.HexToAddress(eAddress)
+		coins, err := unclaimedOf(ethAddress)
+		if err == nil && coins.Sign() > 0 {
+			err = conversion.Expire(state, ethAddress, coins, recipient)
+			if err == nil {
+				total = common.SafeAddBigInt(total, coins)
+				count++
+			}
+		}
+		if err != nil {
+			log.Error("Snapshot entry expiry skipped", "ethAddress", eAddress, "err", err)
+			skipped++
+		}
+	}
+	conversion.SetExpiryCursor(state, end)
+	if end == uint64(len(addresses)) {
+		conversion.SetExpiryProcessed(state, blockNumber)
+	}
+
+	log.Info("Unclaimed conversions expired", "blockNumber", blockNumber, "entries", end-start, "remaining", uint64(len(addresses))-end,
+		"count", count, "skipped", skipped, "coins", total, "recipient", recipient)
+}
 
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		log.Error("GetQuantumAddress UnpackIntoInterface", "err", err, "ethAddress", ethAddress)
-		return ZERO_ADDRESS, err
-	}
+const (
+	conversionReportStatusConverted   = "converted"
+	conversionReportStatusUnconverted = "unconverted"
+	conversionReportStatusExpired     = "expired"
+)
 
-	log.Info("===============GetQuantumAddress", "out", out)
+type ConversionReportEntry struct {
+	EthAddress     common.Address `json:"ethAddress"     gencodec:"required"`
+	QuantumAddress common.Address `json:"quantumAddress"     gencodec:"required"`
+	Status         string         `json:"status"     gencodec:"required"`
+	Coins          string         `json:"coins"     gencodec:"required"`
+}
 
-	return out, nil
+type ConversionReport struct {
+	BlockNumber      string                   `json:"blockNumber"     gencodec:"required"`
+	DeadlineBlock    string                   `json:"deadlineBlock"     gencodec:"required"`
+	UnclaimedAddress common.Address           `json:"unclaimedAddress"     gencodec:"required"`
+	ConvertedCount   string                   `json:"convertedCount"     gencodec:"required"`
+	ConvertedCoins   string                   `json:"convertedCoins"     gencodec:"required"`
+	UnconvertedCount string                   `json:"unconvertedCount"     gencodec:"required"`
+	UnconvertedCoins string                   `json:"unconvertedCoins"     gencodec:"required"`
+	ExpiredCount     string                   `json:"expiredCount"     gencodec:"required"`
+	ExpiredCoins     string                   `json:"expiredCoins"     gencodec:"required"`
+	Entries          []*ConversionReportEntry `json:"entries"     gencodec:"required"`
 }
@@ -0,0 +1,57 @@
+package proofofstake
+
+import (
+	"errors"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/core/state"
+	"github.com/QuantumCoinProject/qc/systemcontracts/conversion"
+	"math/big"
+	"testing"
+)
+
+func TestExpireSnapshotBatch(t *testing.T) {
+	batchSize := CONVERSION_EXPIRY_BATCH_SIZE
+	CONVERSION_EXPIRY_BATCH_SIZE = 2
+	defer func() {
+		CONVERSION_EXPIRY_BATCH_SIZE = batchSize
+	}()
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.AddBalance(conversion.CONVERSION_CONTRACT_ADDRESS, big.NewInt(150))
+	recipient := common.HexToAddress("0x0000000000000000000000000000000000000000000000000000000000000099")
+	addresses := []string{
+		"0x1000000000000000000000000000000000000001",
+		"0x1000000000000000000000000000000000000002",
+		"0x1000000000000000000000000000000000000003",
+	}
+	unclaimedOf := func(ethAddress common.Address) (*big.Int, error) {
+		if ethAddress.IsEqualTo(common.HexToAddress(addresses[2])) {
+			return nil, errors.New("snapshot lookup failed")
+		}
+		return big.NewInt(100), nil
+	}
+
+	//The second entry is more than the remaining contract balance, it is skipped instead of failing the block
+	expireSnapshotBatch(statedb, addresses, recipient, 10, unclaimedOf)
+	if conversion.GetExpiryCursor(statedb) != 2 || conversion.IsExpiryProcessed(statedb) {
+		t.Fatalf("failed %v", conversion.GetExpiryCursor(statedb))
+	}
+	if conversion.IsExpired(statedb, common.HexToAddress(addresses[0])) == false ||
+		conversion.IsExpired(statedb, common.HexToAddress(addresses[1])) {
+		t.Fatalf("failed")
+	}
+	if statedb.GetBalance(recipient).Cmp(big.NewInt(100)) != 0 ||
+		statedb.GetBalance(conversion.CONVERSION_CONTRACT_ADDRESS).Cmp(big.NewInt(50)) != 0 {
+		t.Fatalf("failed")
+	}
+
+	//A failed lookup is skipped as well, and the expiry completes with the last batch
+	expireSnapshotBatch(statedb, addresses, recipient, 11, unclaimedOf)
+	if conversion.GetExpiryCursor(statedb) != 3 || conversion.IsExpiryProcessed(statedb) == false {
+		t.Fatalf("failed %v", conversion.GetExpiryCursor(statedb))
+	}
+	if conversion.IsExpired(statedb, common.HexToAddress(addresses[2])) || statedb.GetBalance(recipient).Cmp(big.NewInt(100)) != 0 {
+		t.Fatalf("failed")
+	}
+}
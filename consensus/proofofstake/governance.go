@@ -0,0 +1,214 @@
+package proofofstake
+
+import (
+	"errors"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/core/state"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/systemcontracts/governance"
+	"math/big"
+)
+
+// ConsensusParameters are the values used by Finalize that can be changed through governance.
+type ConsensusParameters struct {
+	SlashAmount             *big.Int
+	TxnFeeRewardsPercentage int64
+	GasTierPrice            *big.Int //nil until governance is active, in which case the gas price of each txn is used
+}
+
+func defaultConsensusParameters(blockNumber uint64) *ConsensusParameters {
+	slashAmount := SLASH_AMOUNT
+	if blockNumber >= SlashV2StartBlock {
+		slashAmount = SLASH_AMOUNT_V2
+	}
+	return &ConsensusParameters{
+		SlashAmount:             slashAmount,
+		TxnFeeRewardsPercentage: TxnFeeRewardsPercentage,
+	}
+}
+
+// GetConsensusParameters returns the parameters in effect for the block being processed on top of the given state.
+func GetConsensusParameters(state governance.StateDB, blockNumber uint64) (*ConsensusParameters, error) {
+	if governance.IsInitialized(state) == false {
+		return defaultConsensusParameters(blockNumber), nil
+	}
+
+	values, err := governance.GetParameters(state)
+	if err != nil {
+		return nil, err
+	}
+
+	txnFeeRewardsPercentage := values[governance.PARAMETER_TXN_FEE_REWARDS_PERCENTAGE]
+	if txnFeeRewardsPercentage.IsInt64() == false {
+		return nil, governance.ErrParameterOutOfRange
+	}
+
+	return &ConsensusParameters{
+		SlashAmount:             values[governance.PARAMETER_SLASH_AMOUNT],
+		TxnFeeRewardsPercentage: txnFeeRewardsPercentage.Int64(),
+		GasTierPrice:            values[governance.PARAMETER_GAS_TIER_PRICE],
+	}, nil
+}
+
+func governanceDefaults() map[governance.Parameter]*big.Int {
+	return map[governance.Parameter]*big.Int{
+		governance.PARAMETER_SLASH_AMOUNT:                 SLASH_AMOUNT_V2,
+		governance.PARAMETER_TXN_FEE_REWARDS_PERCENTAGE:   big.NewInt(TxnFeeRewardsPercentage),
+		governance.PARAMETER_GAS_TIER_PRICE:               types.GAS_TIER_DEFAULT_PRICE,
+		governance.PARAMETER_CONVERSION_DEADLINE_BLOCK:    big.NewInt(0),
+		governance.PARAMETER_CONVERSION_UNCLAIMED_ADDRESS: big.NewInt(0),
+	}
+}
+
+// governanceStakeReader weighs governance votes by the staking balances at a given block.
+type governanceStakeReader struct {
+	p           *ProofOfStake
+	blockHash   common.Hash
+	blockNumber uint64
+}
+
+func (r *governanceStakeReader) GetBalanceOfDepositor(depositor common.Address) (*big.Int, error) {
+	return r.p.GetBalanceOfDepositor(depositor, r.blockHash)
+}
+
+func (r *governanceStakeReader) GetTotalDepositedBalance() (*big.Int, error) {
+	return r.p.GetTotalDepositedBalance(r.blockHash, r.blockNumber)
+}
+
+// processGovernance initializes the governance contract at GOVERNANCE_START_BLOCK, applies the
+// propose and vote transactions of the block and then closes and applies scheduled proposals.
+// Invalid governance transactions are skipped; they only consume the gas of the sender.
+func (c *ProofOfStake) processGovernance(header *types.Header, state *state.StateDB, txs []*types.Transaction,
+	receipts []*types.Receipt, blockConsensusData *BlockConsensusData) error {
+	blockNumber := header.Number.Uint64()
+	if blockNumber < GOVERNANCE_START_BLOCK {
+		return nil
+	}
+
+	if blockNumber == GOVERNANCE_START_BLOCK {
+		log.Info("Initializing governance contract", "blockNumber", GOVERNANCE_START_BLOCK)
+		return governance.Initialize(state, governanceDefaults())
+	}
+
+	stake := &governanceStakeReader{p: c, blockHash: header.ParentHash, blockNumber: blockNumber - 1}
+
+	if blockConsensusData.VoteType == VOTE_TYPE_OK && len(txs) == len(receipts) {
+		for i, txn := range txs {
+			if txn.To() == nil || txn.To().IsEqualTo(governance.GOVERNANCE_CONTRACT_ADDRESS) == false {
+				continue
+			}
+			if receipts[i].Status != types.ReceiptStatusSuccessful {
+				continue
+			}
+			msg, err := txn.AsMessage(c.signer)
+			if err != nil {
+				return err
+			}
+			err = governance.ProcessTransaction(state, stake, msg.From(), txn.Data(), blockNumber)
+			if err != nil {
+				log.Info("Governance txn skipped", "txn", txn.Hash(), "from", msg.From(), "err", err)
+			}
+		}
+	}
+
+	applied, err := governance.ProcessBlock(state, stake, blockNumber)
+	if err != nil {
+		return err
+	}
+	for _, proposal := range applied {
+		log.Info("Governance proposal applied", "id", proposal.Id, "parameter", proposal.Parameter, "value", proposal.Value, "blockNumber", blockNumber)
+	}
+
+	return nil
+}
+
+type GovernanceProposalDetails struct {
+	Id             string         `json:"id"     gencodec:"required"`
+	Proposer       common.Address `json:"proposer"     gencodec:"required"`
+	Parameter      string         `json:"parameter"     gencodec:"required"`
+	Value          string         `json:"value"     gencodec:"required"`
+	StartBlock     string         `json:"startBlock"     gencodec:"required"`
+	EndBlock       string         `json:"endBlock"     gencodec:"required"`
+	EffectiveBlock string         `json:"effectiveBlock"     gencodec:"required"`
+	Status         string         `json:"status"     gencodec:"required"`
+	VoterCount     string         `json:"voterCount"     gencodec:"required"`
+	YesWeight      string         `json:"yesWeight"     gencodec:"required"`
+	NoWeight       string         `json:"noWeight"     gencodec:"required"`
+}
+
+type GovernanceTallyDetails struct {
+	ProposalId            string `json:"proposalId"     gencodec:"required"`
+	YesWeight             string `json:"yesWeight"     gencodec:"required"`
+	NoWeight              string `json:"noWeight"     gencodec:"required"`
+	TotalDepositedBalance string `json:"totalDepositedBalance"     gencodec:"required"`
+	QuorumReached         bool   `json:"quorumReached"     gencodec:"required"`
+	Passed                bool   `json:"passed"     gencodec:"required"`
+}
+
+func proposalStatusString(status governance.ProposalStatus) string {
+	switch status {
+	case governance.PROPOSAL_STATUS_VOTING:
+		return "voting"
+	case governance.PROPOSAL_STATUS_TALLYING:
+		return "tallying"
+	case governance.PROPOSAL_STATUS_PASSED:
+		return "passed"
+	case governance.PROPOSAL_STATUS_REJECTED:
+		return "rejected"
+	case governance.PROPOSAL_STATUS_APPLIED:
+		return "applied"
+	}
+	return "none"
+}
+
+func newGovernanceProposalDetails(proposal *governance.Proposal) *GovernanceProposalDetails {
+	return &GovernanceProposalDetails{
+		Id:             hexutil.EncodeUint64(proposal.Id),
+		Proposer:       proposal.Proposer,
+		Parameter:      proposal.Parameter.String(),
+		Value:          hexutil.EncodeBig(proposal.Value),
+		StartBlock:     hexutil.EncodeUint64(proposal.StartBlock),
+		EndBlock:       hexutil.EncodeUint64(proposal.EndBlock),
+		EffectiveBlock: hexutil.EncodeUint64(proposal.EffectiveBlock),
+		Status:         proposalStatusString(proposal.Status),
+		VoterCount:     hexutil.EncodeUint64(proposal.VoterCount),
+		YesWeight:      hexutil.EncodeBig(proposal.YesWeight),
+		NoWeight:       hexutil.EncodeBig(proposal.NoWeight),
+	}
+}
+
+// consensusParametersOf returns the parameters that were used to finalize the given block.
+func (c *ProofOfStake) consensusParametersOf(header *types.Header) (*ConsensusParameters, error) {
+	blockNumber := header.Number.Uint64()
+	if blockNumber <= GOVERNANCE_START_BLOCK {
+		return defaultConsensusParameters(blockNumber), nil
+	}
+	if c.blockchain == nil {
+		return nil, errors.New("blockchain not set")
+	}
+	parent := c.blockchain.GetHeader(header.ParentHash, blockNumber-1)
+	if parent == nil {
+		return nil, errUnknownBlock
+	}
+	state, err := c.blockchain.StateAt(parent.Root)
+	if err != nil {
+		return nil, err
+	}
+	return GetConsensusParameters(state, blockNumber)
+}
+
+func (c *ProofOfStake) governanceStateAt(header *types.Header) (*state.StateDB, error) {
+	if c.blockchain == nil {
+		return nil, errors.New("blockchain not set")
+	}
+	state, err := c.blockchain.StateAt(header.Root)
+	if err != nil {
+		return nil, err
+	}
+	if governance.IsInitialized(state) == false {
+		return nil, governance.ErrNotInitialized
+	}
+	return state, nil
+}
@@ -0,0 +1,50 @@
+package proofofstake
+
+import (
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/core/state"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/systemcontracts/governance"
+	"math/big"
+	"testing"
+)
+
+func TestGetConsensusParameters(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+
+	consensusParams, err := GetConsensusParameters(statedb, SlashV2StartBlock-1)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if consensusParams.SlashAmount.Cmp(SLASH_AMOUNT) != 0 || consensusParams.GasTierPrice != nil ||
+		consensusParams.TxnFeeRewardsPercentage != TxnFeeRewardsPercentage {
+		t.Fatalf("failed %v", consensusParams)
+	}
+
+	consensusParams, err = GetConsensusParameters(statedb, SlashV2StartBlock)
+	if err != nil || consensusParams.SlashAmount.Cmp(SLASH_AMOUNT_V2) != 0 {
+		t.Fatalf("failed %v %v", consensusParams, err)
+	}
+
+	defaults := governanceDefaults()
+	defaults[governance.PARAMETER_TXN_FEE_REWARDS_PERCENTAGE] = big.NewInt(80)
+	err = governance.Initialize(statedb, defaults)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	consensusParams, err = GetConsensusParameters(statedb, SlashV2StartBlock)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if consensusParams.TxnFeeRewardsPercentage != 80 || consensusParams.GasTierPrice.Cmp(types.GAS_TIER_DEFAULT_PRICE) != 0 {
+		t.Fatalf("failed %v", consensusParams)
+	}
+
+	txnFeeTotal := big.NewInt(1000)
+	burnAmount, txnFeeRewards := calculateTxnFeeSplitCoinsPercentage(txnFeeTotal, consensusParams.TxnFeeRewardsPercentage)
+	if burnAmount.Cmp(big.NewInt(200)) != 0 || txnFeeRewards.Cmp(big.NewInt(800)) != 0 {
+		t.Fatalf("failed %v %v", burnAmount, txnFeeRewards)
+	}
+}
@@ -0,0 +1,37 @@
+package proofofstake
+
+import (
+	"fmt"
+
+	"github.com/QuantumCoinProject/qc/eth/protocols/eth"
+	"github.com/QuantumCoinProject/qc/metrics"
+)
+
+// consensusPacketNames are the metric names of the consensus packet types.
+var consensusPacketNames = map[ConsensusPacketType]string{
+	CONSENSUS_PACKET_TYPE_PROPOSE_BLOCK:      "propose",
+	CONSENSUS_PACKET_TYPE_ACK_BLOCK_PROPOSAL: "ack",
+	CONSENSUS_PACKET_TYPE_PRECOMMIT_BLOCK:    "precommit",
+	CONSENSUS_PACKET_TYPE_COMMIT_BLOCK:       "commit",
+	CONSENSUS_PACKET_TYPE_CAPABILITY:         "capability",
+	CONSENSUS_PACKET_TYPE_SYNC:               "sync",
+}
+
+// markConsensusTraffic records the size of a consensus packet received from or
+// broadcast to peers in the per packet type meters of the given direction.
+func markConsensusTraffic(direction string, packet *eth.ConsensusPacket) {
+	if !metrics.Enabled {
+		return
+	}
+	packetType, err := consensusPacketType(packet)
+	if err != nil {
+		return
+	}
+	name, ok := consensusPacketNames[packetType]
+	if ok == false {
+		name = "unknown"
+	}
+	m := fmt.Sprintf("consensus/%s/%s", direction, name)
+	metrics.GetOrRegisterMeter(m, nil).Mark(int64(len(packet.ConsensusData) + len(packet.Signature) + len(packet.ParentHash)))
+	metrics.GetOrRegisterMeter(m+"/packets", nil).Mark(1)
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/QuantumCoinProject/qc/crypto/signaturealgorithm"
 	"github.com/QuantumCoinProject/qc/eth/protocols/eth"
 	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/p2p"
 	"github.com/QuantumCoinProject/qc/params"
 	"github.com/QuantumCoinProject/qc/rlp"
 	"math/big"
@@ -63,6 +64,7 @@ type MockP2PHandler struct {
 	validatorDetails *ValidatorDetailsTest
 	networkDetails   MockNetworkDetails
 	localPeerId      string
+	reports          map[p2p.ScoreEvent]int
 }
 
 func (m *MockP2PManager) DoesFinalizedTransactionExistFn(txnHash common.Hash) (bool, error) {
@@ -213,6 +215,15 @@ func (p *MockP2PHandler) GetLocalPeerId() string {
 	return p.localPeerId
 }
 
+func (p *MockP2PHandler) ReportPeer(peerId string, event p2p.ScoreEvent) {
+	p.mockLock.Lock()
+	defer p.mockLock.Unlock()
+	if p.reports == nil {
+		p.reports = make(map[p2p.ScoreEvent]int)
+	}
+	p.reports[event]++
+}
+
 func (p *MockP2PHandler) BroadcastConsensusData(packet *eth.ConsensusPacket) error {
 	for _, val := range p.mockP2pManager.mockP2pHandlers {
 		handler := val.consensusHandler
@@ -465,15 +476,19 @@ func Initialize(numKeys int) (vm *ValidatorManager, mockp2pManager *MockP2PManag
 	return
 }
 
-func WaitBlockCommit(parentHash common.Hash, mockp2pHandler *MockP2PHandler, t *testing.T) {
+// WaitBlockCommit drives the consensus of a validator. It runs in its own
+// goroutine, so failures are sent on errc, since only the test goroutine may
+// stop the test.
+func WaitBlockCommit(parentHash common.Hash, mockp2pHandler *MockP2PHandler, errc chan<- error) {
 	waitLock.Lock()
 
 	valAddress := mockp2pHandler.validator
 	_, ok := waitMap[valAddress]
+	waitLock.Unlock()
 	if ok == true {
-		t.Fatalf("validator wait already exists")
+		errc <- errors.New("validator wait already exists " + valAddress.String())
+		return
 	}
-	waitLock.Unlock()
 
 	for {
 		txns := mockp2pHandler.GetValidatorTransactions()
@@ -485,6 +500,18 @@ func WaitBlockCommit(parentHash common.Hash, mockp2pHandler *MockP2PHandler, t *
 	}
 }
 
+// testErrors returns a channel on which helpers running in their own goroutines
+// report failures of the test.
+func testErrors(t *testing.T) chan<- error {
+	errc := make(chan error)
+	go func() {
+		for err := range errc {
+			t.Error(err)
+		}
+	}()
+	return errc
+}
+
 func ValidateBlockConsensusDataTest(parentHash common.Hash, p2p *MockP2PManager, validatorMap *map[common.Address]*big.Int, valDetailsMap *map[common.Address]*ValidatorDetailsV2, t *testing.T) {
 	for _, handler := range p2p.mockP2pHandlers {
 		blockState, _, err := handler.consensusHandler.getBlockState(parentHash)
@@ -619,7 +646,7 @@ func testPacketHandler_basic(numKeys int, t *testing.T) {
 	startTime := time.Now().UnixNano() / int64(time.Millisecond)
 	for _, handler := range p2p.mockP2pHandlers {
 		h := handler
-		go WaitBlockCommit(parentHash, h, t)
+		go WaitBlockCommit(parentHash, h, testErrors(t))
 	}
 
 	if ValidateTest(valMap, valDetailsMap, startTime, parentHash, p2p, numKeys, DefaultMaxWaitCount, map[VoteType]bool{VOTE_TYPE_OK: true}, BLOCK_STATE_RECEIVED_COMMITS, t) == false {
@@ -668,7 +695,7 @@ func testPacketHandler_min_basic(t *testing.T) {
 			skipList[h.validator] = true
 			continue
 		}
-		go WaitBlockCommit(parentHash, h, t)
+		go WaitBlockCommit(parentHash, h, testErrors(t))
 		c = c + 1
 	}
 
@@ -711,7 +738,7 @@ func testPacketHandler_extended_failure(t *testing.T, numKeys int, minPass int,
 	for _, handler := range p2p.mockP2pHandlers {
 		h := handler
 		if h.validator.IsEqualTo(proposer) == true {
-			go WaitBlockCommit(parentHash, h, t)
+			go WaitBlockCommit(parentHash, h, testErrors(t))
 			break
 		}
 	}
@@ -728,7 +755,7 @@ func testPacketHandler_extended_failure(t *testing.T, numKeys int, minPass int,
 			c = c + 1
 			continue
 		}
-		go WaitBlockCommit(parentHash, h, t)
+		go WaitBlockCommit(parentHash, h, testErrors(t))
 		c = c + 1
 	}
 
@@ -776,7 +803,7 @@ func testPacketHandler_min_negative(t *testing.T, numKeys int, minPass int, unre
 			skipList[h.validator] = true
 			continue
 		}
-		go WaitBlockCommit(parentHash, h, t)
+		go WaitBlockCommit(parentHash, h, testErrors(t))
 		c = c + 1
 	}
 
@@ -831,7 +858,7 @@ func testPacketHandler_no_round2_then_round2(t *testing.T, numKeys int, minPass
 		}
 		h.SetValidatorTransactions(txns)
 
-		go WaitBlockCommit(parentHash, h, t)
+		go WaitBlockCommit(parentHash, h, testErrors(t))
 		c = c + 1
 	}
 
@@ -864,7 +891,7 @@ func testPacketHandler_no_round2_then_round2(t *testing.T, numKeys int, minPass
 						txns[i] = common.BytesToHash([]byte{byte(rand.Intn(255))})
 					}
 					vh.SetValidatorTransactions(txns)
-					go WaitBlockCommit(parentHash, vh, t)
+					go WaitBlockCommit(parentHash, vh, testErrors(t))
 				}
 				breakLoop = true
 				break
@@ -952,7 +979,7 @@ func testPacketHandler_bifurcated(t *testing.T) {
 		}
 		h.SetValidatorTransactions(txns)
 		prev = h
-		go WaitBlockCommit(parentHash, h, t)
+		go WaitBlockCommit(parentHash, h, testErrors(t))
 		c = c + 1
 	}
 
@@ -1012,7 +1039,7 @@ func testPacketHandler_round2(t *testing.T, numKeys int, minPass int) {
 		}
 		h.SetValidatorTransactions(txns)
 		prev = h
-		go WaitBlockCommit(parentHash, h, t)
+		go WaitBlockCommit(parentHash, h, testErrors(t))
 		c = c + 1
 	}
 
@@ -1107,7 +1134,7 @@ func testPacketHandler_basic_txns(t *testing.T) {
 	for _, handler := range p2p.mockP2pHandlers {
 		h := handler
 		h.SetValidatorTransactions(txns)
-		go WaitBlockCommit(parentHash, h, t)
+		go WaitBlockCommit(parentHash, h, testErrors(t))
 	}
 
 	if ValidateTest(valMap, valDetailsMap, startTime, parentHash, p2p, numKeys, DefaultMaxWaitCount, map[VoteType]bool{VOTE_TYPE_OK: true}, BLOCK_STATE_RECEIVED_COMMITS, t) == false {
@@ -1170,7 +1197,7 @@ func testPacketHandler_basic_txns_finalize_fail(t *testing.T) {
 	for _, handler := range p2p.mockP2pHandlers {
 		h := handler
 		h.SetValidatorTransactions(txns)
-		go WaitBlockCommit(parentHash, h, t)
+		go WaitBlockCommit(parentHash, h, testErrors(t))
 	}
 
 	if ValidateTest(valMap, valDetailsMap, startTime, parentHash, p2p, numKeys-1, DefaultMaxWaitCount*2, map[VoteType]bool{VOTE_TYPE_NIL: true}, BLOCK_STATE_RECEIVED_COMMITS, t) == false {
@@ -1206,7 +1233,7 @@ func testPacketHandler_split_txns(t *testing.T) {
 
 	for _, handler := range p2p.mockP2pHandlers {
 		h := handler
-		go WaitBlockCommit(parentHash, h, t)
+		go WaitBlockCommit(parentHash, h, testErrors(t))
 
 	}
 
@@ -1270,7 +1297,7 @@ func testPacketHandler_split_increasing_txns(t *testing.T) {
 		}
 		h := handler
 		handler.SetValidatorTransactions(txns)
-		go WaitBlockCommit(parentHash, h, t)
+		go WaitBlockCommit(parentHash, h, testErrors(t))
 	}
 
 	if ValidateTest(valMap, valDetailsMap, startTime, parentHash, p2p, 7, DefaultMaxWaitCount, map[VoteType]bool{VOTE_TYPE_OK: true}, BLOCK_STATE_RECEIVED_COMMITS, t) == false {
@@ -1336,7 +1363,7 @@ func testPacketHandler_split_increasing_txns_some_unresponsive(t *testing.T, num
 				j = j + 1
 			}
 			h.SetValidatorTransactions(txns)
-			go WaitBlockCommit(parentHash, h, t)
+			go WaitBlockCommit(parentHash, h, testErrors(t))
 			break
 		}
 	}
@@ -1357,7 +1384,7 @@ func testPacketHandler_split_increasing_txns_some_unresponsive(t *testing.T, num
 			j = j + 1
 		}
 		h.SetValidatorTransactions(txns)
-		go WaitBlockCommit(parentHash, h, t)
+		go WaitBlockCommit(parentHash, h, testErrors(t))
 		c = c + 1
 	}
 
@@ -1423,7 +1450,7 @@ func testPacketHandler_packet_loss_txns(t *testing.T) {
 		h := handler
 		handler.SetValidatorTransactions(txns)
 		h.networkDetails.packetLoss = 50
-		go WaitBlockCommit(parentHash, h, t)
+		go WaitBlockCommit(parentHash, h, testErrors(t))
 	}
 
 	if ValidateTest(valMap, valDetailsMap, startTime, parentHash, p2p, minPass, DefaultMaxWaitCount*10, map[VoteType]bool{VOTE_TYPE_OK: true}, BLOCK_STATE_RECEIVED_COMMITS, t) == false {
@@ -1491,7 +1518,7 @@ func testPacketHandler_packet_loss_txns_some_unresponsive(t *testing.T, numVal i
 			}
 			h.SetValidatorTransactions(txns)
 			h.networkDetails.packetLoss = 50
-			go WaitBlockCommit(parentHash, h, t)
+			go WaitBlockCommit(parentHash, h, testErrors(t))
 			break
 		}
 	}
@@ -1512,7 +1539,7 @@ func testPacketHandler_packet_loss_txns_some_unresponsive(t *testing.T, numVal i
 			j = j + 1
 		}
 		handler.SetValidatorTransactions(txns)
-		go WaitBlockCommit(parentHash, h, t)
+		go WaitBlockCommit(parentHash, h, testErrors(t))
 		c = c + 1
 	}
 
@@ -1936,3 +1963,38 @@ func TestPacketHandler_basic_various_blocks(t *testing.T) {
 	TEST_CONSENSUS_BLOCK_NUMBER = uint64(1)
 	fmt.Println("TestPacketHandler_basic_various_blocks done")
 }
+
+func TestPacketHandler_relay_verifies_packets(t *testing.T) {
+	_, mockP2p, _, _ := Initialize(3)
+	var signer *ConsensusHandler
+	for _, handler := range mockP2p.mockP2pHandlers {
+		signer = handler.consensusHandler
+		break
+	}
+	parentHash := getTestParentHash(TEST_CONSENSUS_BLOCK_NUMBER)
+	packet, err := signer.createConsensusPacket(parentHash, []byte{MinConsensusNetworkProtocolVersion, byte(CONSENSUS_PACKET_TYPE_PRECOMMIT_BLOCK), 0xc0}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A node that is not a validator relays packets once their signature is
+	// verified, and only penalizes peers for badly signed packets
+	relay := NewConsensusPacketHandler()
+	reports := &MockP2PHandler{}
+	relay.p2pHandler = reports
+	if err := relay.HandleConsensusPacket(packet, "peer"); err != nil {
+		t.Fatalf("valid packet rejected: %v", err)
+	}
+	if len(reports.reports) != 0 {
+		t.Fatalf("unexpected reports %v", reports.reports)
+	}
+
+	tampered := eth.NewConsensusPacket(packet)
+	tampered.ParentHash = common.BytesToHash([]byte{0x01})
+	if err := relay.HandleConsensusPacket(&tampered, "peer"); !errors.Is(err, InvalidPacketErr) {
+		t.Fatalf("unexpected error %v, want %v", err, InvalidPacketErr)
+	}
+	if reports.reports[p2p.ScoreInvalidConsensusPacket] != 1 || reports.reports[p2p.ScoreUsefulConsensusPacket] != 0 {
+		t.Fatalf("unexpected reports %v", reports.reports)
+	}
+}
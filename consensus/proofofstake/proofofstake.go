@@ -34,6 +34,7 @@ import (
 	"github.com/QuantumCoinProject/qc/systemcontracts/staking"
 	"github.com/QuantumCoinProject/qc/trie"
 	"io"
+	"math"
 	"math/big"
 	"sync"
 	"time"
@@ -106,6 +107,14 @@ var (
 	OfflineValidatorDeferStartBlock = SlashV2StartBlock + 10
 
 	SixtySevenVoteStartBlock = uint64(OfflineValidatorDeferStartBlock + 10)
+
+	GOVERNANCE_START_BLOCK = uint64(math.MaxUint64) //To be scheduled
+
+	//Number of snapshot entries visited per block when unclaimed amounts expire
+	CONVERSION_EXPIRY_BATCH_SIZE = uint64(256)
+
+	//Commit packets of the final round are stored as a compact commit certificate
+	COMMIT_CERTIFICATE_START_BLOCK = uint64(math.MaxUint64) //To be scheduled
 )
 
 // Various error messages to mark blocks invalid. These should be private to
@@ -217,6 +226,8 @@ type ProofOfStake struct {
 
 	account    *accounts.Account
 	blockchain *core.BlockChain
+
+	statsIndexer *core.ChainIndexer
 }
 
 // New creates a ProofOfStake proof-of-authority consensus engine with the initial
@@ -601,6 +612,13 @@ func (c *ProofOfStake) Prepare(chain consensus.ChainHeaderReader, header *types.
 }
 
 func (c *ProofOfStake) VerifyBlock(chain consensus.ChainHeaderReader, block *types.Block) error {
+	return c.verifyBlock(block, c.GetValidators, c.ListValidatorsAsMap, c.GetConsensusContext)
+}
+
+// verifyBlock checks the consensus data of a block on top of the current head against the given
+// validator set lookups.
+func (c *ProofOfStake) verifyBlock(block *types.Block, getValidatorsFn GetValidatorsFn, listValidatorsFn ListValidatorsAsMapFn,
+	getBlockConsensusContext GetBlockConsensusContextFn) error {
 	header := block.Header()
 	number := header.Number.Uint64()
 
@@ -619,7 +637,7 @@ func (c *ProofOfStake) VerifyBlock(chain consensus.ChainHeaderReader, block *typ
 		return err
 	}
 
-	validatorDepositMap, err := c.GetValidators(header.ParentHash)
+	validatorDepositMap, err := getValidatorsFn(header.ParentHash)
 	if err != nil {
 		log.Trace("VerifyBlock 3", "err", err)
 		return err
@@ -627,13 +645,13 @@ func (c *ProofOfStake) VerifyBlock(chain consensus.ChainHeaderReader, block *typ
 
 	var valDetailsMap map[common.Address]*ValidatorDetailsV2
 	if number >= BLOCK_PROPOSER_NIL_BLOCK_START_BLOCK {
-		valDetailsMap, err = c.ListValidatorsAsMap(header.ParentHash)
+		valDetailsMap, err = listValidatorsFn(header.ParentHash)
 		if err != nil {
 			return err
 		}
 	}
 
-	err = ValidateBlockConsensusData(block, &validatorDepositMap, &valDetailsMap, c.GetConsensusContext, c.GetValidators)
+	err = ValidateBlockConsensusData(block, &validatorDepositMap, &valDetailsMap, getBlockConsensusContext, getValidatorsFn)
 	if err != nil {
 		log.Trace("ValidateBlockConsensusData", "err", err)
 	}
@@ -654,6 +672,45 @@ func (c *ProofOfStake) Convert(header *types.Header, state *state.StateDB, txn *
 		return err
 	}
 
+	return c.convertEthereumAddress(header, state, txn, eAddress, msg.From())
+}
+
+// ConvertBatch converts each verified request of a batch conversion txn. Requests that fail
+// verification are skipped, the others are converted in the same way as single conversions.
+func (c *ProofOfStake) ConvertBatch(header *types.Header, state *state.StateDB, txn *types.Transaction) error {
+	msg, err := txn.AsMessage(c.signer)
+	if err != nil {
+		return err
+	}
+
+	requests, err := conversion.UnpackConversionBatch(txn.Data())
+	if err != nil {
+		log.Info("Conversion batch txn skipped", "txn", txn.Hash(), "from", msg.From(), "err", err)
+		return nil
+	}
+
+	log.Info("Conversion batch txn", "txn", txn.Hash(), "from", msg.From(), "count", len(requests))
+
+	for _, request := range requests {
+		if common.IsLegacyEthereumHexAddress(request.EthAddress) == false || conversionutil.IsSnapshotAddress(request.EthAddress) == false {
+			log.Info("Conversion batch request skipped, address not in snapshot", "txn", txn.Hash(), "ethAddress", request.EthAddress)
+			continue
+		}
+		err = conversionutil.VerifyConversionRequest(msg.From(), request.EthAddress, request.EthSignature)
+		if err != nil {
+			log.Info("Conversion batch request skipped", "txn", txn.Hash(), "ethAddress", request.EthAddress, "err", err)
+			continue
+		}
+		err = c.convertEthereumAddress(header, state, txn, request.EthAddress, msg.From())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *ProofOfStake) convertEthereumAddress(header *types.Header, state *state.StateDB, txn *types.Transaction, eAddress string, quantumAddress common.Address) error {
 	//skip txn and proceed
 	ethAddress := common.HexToAddress(eAddress) //representative address
 	coins, err := c.GetCoinsForEthereumAddress(ethAddress, state, header)
@@ -671,11 +728,20 @@ func (c *ProofOfStake) Convert(header *types.Header, state *state.StateDB, txn *
 	}
 
 	if converted == true {
-		log.Info("Conversion txn already converted, skipping", "txn", txn.Hash(), "from", msg.From())
+		log.Info("Conversion txn already converted, skipping", "txn", txn.Hash(), "from", quantumAddress)
+		return nil
+	}
+
+	pastDeadline, err := isPastConversionDeadline(state, header.Number.Uint64())
+	if err != nil {
+		return err
+	}
+	if pastDeadline || conversion.IsExpired(state, ethAddress) {
+		log.Info("Conversion txn snapshot amount expired, skipping", "txn", txn.Hash(), "from", quantumAddress, "ethAddress", eAddress)
 		return nil
 	}
 
-	retCoins, err := c.SetConverted(ethAddress, msg.From(), state, header)
+	retCoins, err := c.SetConverted(ethAddress, quantumAddress, state, header)
 	if err != nil {
 		return err
 	}
@@ -685,7 +751,7 @@ func (c *ProofOfStake) Convert(header *types.Header, state *state.StateDB, txn *
 		return err
 	}
 
-	log.Info("=================Conversion successful", "ethAddress", eAddress, "quantumAddress", msg.From(), "coins", coins, "retQuantAddress", retQuantAddress, "retCoins", retCoins)
+	log.Info("=================Conversion successful", "ethAddress", eAddress, "quantumAddress", quantumAddress, "coins", coins, "retQuantAddress", retQuantAddress, "retCoins", retCoins)
 
 	return nil
 }
@@ -726,29 +792,55 @@ func (c *ProofOfStake) Finalize(chain consensus.ChainHeaderReader, header *types
 		return err
 	}
 
+	//Parameters are read before governance is processed, so that a change applies from the next block onwards
+	consensusParams, err := GetConsensusParameters(state, blockNumber)
+	if err != nil {
+		log.Error("GetConsensusParameters err", "err", err)
+		return err
+	}
+
 	//Conversions
 	if blockConsensusData.VoteType == VOTE_TYPE_OK && txs != nil {
-		for _, txn := range txs {
+		for i, txn := range txs {
 			if txn.To().IsEqualTo(conversion.CONVERSION_CONTRACT_ADDRESS) {
 				err = c.Convert(header, state, txn)
 				if err != nil {
 					log.Info("Convert error", "err", err)
 					return err
 				}
+			} else if txn.To().IsEqualTo(conversion.CONVERSION_BATCH_CONTRACT_ADDRESS) && blockNumber >= conversion.CONVERSION_V2_START_BLOCK &&
+				len(receipts) == len(txs) && receipts[i].Status == types.ReceiptStatusSuccessful {
+				err = c.ConvertBatch(header, state, txn)
+				if err != nil {
+					log.Info("ConvertBatch error", "err", err)
+					return err
+				}
 			}
 		}
 	}
 
+	//Conversion expiry
+	c.processConversionExpiry(header, state)
+
+	//Governance
+	err = c.processGovernance(header, state, txs, receipts, blockConsensusData)
+	if err != nil {
+		log.Error("processGovernance err", "err", err)
+		return err
+	}
+
+	//Unbonding queue
+	err = c.processUnbonding(header, state, txs, receipts, blockConsensusData)
+	if err != nil {
+		log.Error("processUnbonding err", "err", err)
+		return err
+	}
+
 	//Block Slashing
 	//If Round = 1, then it means PROPOSER was likely offline, as opposed to Round = 2 which means validators were not able to get consensus on time
 	if blockConsensusData.Round == 1 && blockConsensusData.SlashedBlockProposers != nil && len(blockConsensusData.SlashedBlockProposers) > 0 && blockNumber >= slashStartBlockNumber {
 
-		var slashAmount *big.Int
-		if blockNumber < SlashV2StartBlock {
-			slashAmount = SLASH_AMOUNT
-		} else {
-			slashAmount = SLASH_AMOUNT_V2
-		}
+		slashAmount := consensusParams.SlashAmount
 
 		for _, val := range blockConsensusData.SlashedBlockProposers {
 			depositor, err := c.GetDepositorOfValidator(val, header.ParentHash)
@@ -802,7 +894,7 @@ func (c *ProofOfStake) Finalize(chain consensus.ChainHeaderReader, header *types
 
 		//If txn fee for proposer criteria is met and the block has transactions
 		if blockNumber >= core.TXN_FEE_CUTTOFF_BLOCK && len(txs) > 0 {
-			txnFeeTotal, rewardsAmountTxnFee, burnAmountTxnFee, err := calculateTxnFeeSplit(blockProposerRewardAmount, txs, receipts)
+			txnFeeTotal, rewardsAmountTxnFee, burnAmountTxnFee, err := calculateTxnFeeSplit(blockProposerRewardAmount, txs, receipts, consensusParams)
 			if err != nil {
 				return err
 			}
@@ -902,7 +994,7 @@ func (c *ProofOfStake) Finalize(chain consensus.ChainHeaderReader, header *types
 	return nil
 }
 
-func calculateTxnFeeSplit(originalBlockRewards *big.Int, txs []*types.Transaction, receipts []*types.Receipt) (txnFeeTotal *big.Int, txnFeeRewardsAmount *big.Int, burnAmount *big.Int, err error) {
+func calculateTxnFeeSplit(originalBlockRewards *big.Int, txs []*types.Transaction, receipts []*types.Receipt, consensusParams *ConsensusParameters) (txnFeeTotal *big.Int, txnFeeRewardsAmount *big.Int, burnAmount *big.Int, err error) {
 	if len(receipts) != len(txs) {
 		log.Error("Finalize receipts and txn invalid len", "receipts len", len(receipts), "txn len", len(txs))
 		return nil, nil, nil, errors.New("finalize receipts and txn invalid length")
@@ -920,12 +1012,16 @@ func calculateTxnFeeSplit(originalBlockRewards *big.Int, txs []*types.Transactio
 			log.Error("Finalize txn not found in receipts", "hash", receipt.TxHash)
 			return nil, nil, nil, errors.New("finalize txn not found in receipts")
 		}
-		gasCoinsUsed := common.SafeMulBigInt(txn.GasPrice(), new(big.Int).SetUint64(receipt.GasUsed))
+		gasPrice := txn.GasPrice()
+		if consensusParams.GasTierPrice != nil {
+			gasPrice = consensusParams.GasTierPrice
+		}
+		gasCoinsUsed := common.SafeMulBigInt(gasPrice, new(big.Int).SetUint64(receipt.GasUsed))
 		txnFeeTotal = common.SafeAddBigInt(txnFeeTotal, gasCoinsUsed)
-		log.Trace("calculateTxnFeeSplit", "gasCoinsUsed", gasCoinsUsed, "txn", txn.Hash(), "gasPrice", txn.GasPrice(), "GasUsed", receipt.GasUsed)
+		log.Trace("calculateTxnFeeSplit", "gasCoinsUsed", gasCoinsUsed, "txn", txn.Hash(), "gasPrice", gasPrice, "GasUsed", receipt.GasUsed)
 	}
 
-	burnAmount, txnFeeRewardsAmount = calculateTxnFeeSplitCoins(txnFeeTotal)
+	burnAmount, txnFeeRewardsAmount = calculateTxnFeeSplitCoinsPercentage(txnFeeTotal, consensusParams.TxnFeeRewardsPercentage)
 
 	if len(txs) > 0 {
 		log.Trace("calculateTxnFeeSplit", "originalBlockRewards", originalBlockRewards, "txnFeeTotal", txnFeeTotal, "burnAmount", burnAmount, "txnFeeRewardsAmount", txnFeeRewardsAmount)
@@ -935,7 +1031,11 @@ func calculateTxnFeeSplit(originalBlockRewards *big.Int, txs []*types.Transactio
 }
 
 func calculateTxnFeeSplitCoins(txnFeeTotal *big.Int) (burnAmount *big.Int, txnFeeRewardsAmount *big.Int) {
-	txnFeeRewardsAmount = common.SafeRelativePercentageBigInt(txnFeeTotal, big.NewInt(TxnFeeRewardsPercentage))
+	return calculateTxnFeeSplitCoinsPercentage(txnFeeTotal, TxnFeeRewardsPercentage)
+}
+
+func calculateTxnFeeSplitCoinsPercentage(txnFeeTotal *big.Int, txnFeeRewardsPercentage int64) (burnAmount *big.Int, txnFeeRewardsAmount *big.Int) {
+	txnFeeRewardsAmount = common.SafeRelativePercentageBigInt(txnFeeTotal, big.NewInt(txnFeeRewardsPercentage))
 	burnAmount = common.SafeSubBigInt(txnFeeTotal, txnFeeRewardsAmount)
 	return burnAmount, txnFeeRewardsAmount
 }
@@ -1058,6 +1158,9 @@ func (c *ProofOfStake) SealHash(header *types.Header) common.Hash {
 
 // Close implements consensus.Engine. It's a noop for proofofstake as there are no background threads.
 func (c *ProofOfStake) Close() error {
+	if c.statsIndexer != nil {
+		return c.statsIndexer.Close()
+	}
 	return nil
 }
 
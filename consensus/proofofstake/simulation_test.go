@@ -0,0 +1,684 @@
+package proofofstake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/QuantumCoinProject/qc/accounts"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/consensus"
+	"github.com/QuantumCoinProject/qc/core"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/core/vm"
+	"github.com/QuantumCoinProject/qc/crypto"
+	"github.com/QuantumCoinProject/qc/eth/protocols/eth"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"github.com/QuantumCoinProject/qc/internal/ethapi"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/p2p"
+	"github.com/QuantumCoinProject/qc/p2p/pipes"
+	"github.com/QuantumCoinProject/qc/params"
+	"github.com/QuantumCoinProject/qc/rlp"
+	"github.com/QuantumCoinProject/qc/rpc"
+)
+
+// The simulation runs N validators, each a ProofOfStake engine on top of its
+// own core.BlockChain, over in-memory links built from p2p/pipes. The engines
+// share a stubbed validator set. Links can delay, drop and partition traffic,
+// validators can be crashed, restarted, run with a skewed clock or turned
+// byzantine. Every block a validator seals is imported into its chain, and
+// checked against the blocks sealed by the other validators at the same height.
+
+const (
+	simConsensusMsg = iota // eth.ConsensusPacket
+	simRequestMsg          // eth.RequestConsensusDataPacket
+
+	simTickInterval = 250 * time.Millisecond
+	simQueueSize    = 4096
+)
+
+var simGenesis = &core.Genesis{
+	Config:   params.AllProofOfStakeProtocolChanges,
+	GasLimit: params.GenesisGasLimit,
+}
+
+type simMsg struct {
+	Code    uint64
+	Payload []byte
+}
+
+// simDelivery is a message queued on a link until its delivery time.
+type simDelivery struct {
+	due  time.Time
+	data []byte
+}
+
+// simLink is a one-directional connection between two validators.
+type simLink struct {
+	from, to    *simNode
+	conn        net.Conn
+	queue       chan simDelivery
+	latency     time.Duration
+	packetLoss  int // percentage of dropped messages
+	partitioned bool
+}
+
+type simNode struct {
+	sim       *simulation
+	index     int
+	address   common.Address
+	peerId    string
+	db        ethdb.Database
+	engine    *simEngine
+	chain     *core.BlockChain
+	handler   *ConsensusHandler
+	crashed   bool
+	byzantine bool
+	clockSkew time.Duration
+	reports   map[string]int // peer id -> number of misbehaviour reports
+}
+
+type simulation struct {
+	t     *testing.T
+	vm    *ValidatorManager
+	nodes []*simNode
+	links map[[2]int]*simLink
+
+	lock       sync.Mutex
+	finalized  map[uint64]common.Hash // height -> first block finalized at it
+	violations []string
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newSimulation creates and starts a network of fully connected validators. The
+// consensus timeouts it shortens are restored when the test ends.
+func newSimulation(t *testing.T, validators int) *simulation {
+	if testing.Short() {
+		t.Skip("skipping the consensus simulation in short mode")
+	}
+	startupDelay, blockTimeout, ackBlockTimeout, blockCleanupTime := STARTUP_DELAY_MS, BLOCK_TIMEOUT_MS, ACK_BLOCK_TIMEOUT_MS, BLOCK_CLEANUP_TIME_MS
+	maxRound, resendDelay, cleanupDelay := MAX_ROUND, BROADCAST_RESEND_DELAY, BROADCAST_CLEANUP_DELAY
+	requestResendDelay, skipHashCheck := CONSENSUS_DATA_REQUEST_RESEND_DELAY, SKIP_HASH_CHECK
+	t.Cleanup(func() {
+		STARTUP_DELAY_MS, BLOCK_TIMEOUT_MS, ACK_BLOCK_TIMEOUT_MS, BLOCK_CLEANUP_TIME_MS = startupDelay, blockTimeout, ackBlockTimeout, blockCleanupTime
+		MAX_ROUND, BROADCAST_RESEND_DELAY, BROADCAST_CLEANUP_DELAY = maxRound, resendDelay, cleanupDelay
+		CONSENSUS_DATA_REQUEST_RESEND_DELAY, SKIP_HASH_CHECK = requestResendDelay, skipHashCheck
+	})
+
+	STARTUP_DELAY_MS = int64(2000)
+	BLOCK_TIMEOUT_MS = int64(6000)
+	ACK_BLOCK_TIMEOUT_MS = 18000
+	BLOCK_CLEANUP_TIME_MS = int64(60000)
+	MAX_ROUND = byte(2)
+	BROADCAST_RESEND_DELAY = int64(100)
+	BROADCAST_CLEANUP_DELAY = int64(1800000)
+	CONSENSUS_DATA_REQUEST_RESEND_DELAY = int64(2000)
+	SKIP_HASH_CHECK = true
+
+	sim := &simulation{
+		t:         t,
+		vm:        NewValidatorManager(validators),
+		links:     make(map[[2]int]*simLink),
+		finalized: make(map[uint64]common.Hash),
+		quit:      make(chan struct{}),
+	}
+	for addr := range sim.vm.valMap {
+		n := &simNode{
+			sim:     sim,
+			index:   len(sim.nodes),
+			address: addr,
+			peerId:  crypto.Keccak256Hash(addr.Bytes()).Hex()[2:],
+			db:      rawdb.NewMemoryDatabase(),
+			reports: make(map[string]int),
+		}
+		simGenesis.MustCommit(n.db)
+		n.start()
+		sim.nodes = append(sim.nodes, n)
+	}
+	for _, from := range sim.nodes {
+		for _, to := range sim.nodes {
+			if from.index < to.index {
+				sim.connect(from, to)
+			}
+		}
+	}
+	for _, n := range sim.nodes {
+		sim.wg.Add(1)
+		go sim.runNode(n)
+	}
+	return sim
+}
+
+// connect links two validators with a pipe, one direction per end.
+func (sim *simulation) connect(a, b *simNode) {
+	c1, c2, err := pipes.NetPipe()
+	if err != nil {
+		sim.t.Fatal(err)
+	}
+	ab := &simLink{from: a, to: b, conn: c1}
+	ba := &simLink{from: b, to: a, conn: c2}
+	for _, l := range []*simLink{ab, ba} {
+		l.queue = make(chan simDelivery, simQueueSize)
+		sim.links[[2]int{l.from.index, l.to.index}] = l
+		sim.wg.Add(1)
+		go sim.writeLoop(l)
+	}
+	// Whatever is written on one end of the pipe is read on the other
+	sim.wg.Add(2)
+	go sim.readLoop(ba.conn, b, a)
+	go sim.readLoop(ab.conn, a, b)
+}
+
+// simBackend serves the chain head to the engine, which reads it through the
+// RPC API when verifying blocks.
+type simBackend struct {
+	ethapi.Backend
+	chain *core.BlockChain
+}
+
+func (b *simBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	if number == rpc.LatestBlockNumber {
+		return b.chain.CurrentBlock().Header(), nil
+	}
+	return b.chain.GetHeaderByNumber(uint64(number)), nil
+}
+
+// simEngine is the ProofOfStake engine of a validator. Both its consensus handler
+// and the verification of the blocks inserted in its chain use the stubbed
+// validator set shared by all validators.
+type simEngine struct {
+	*ProofOfStake
+	validators *ValidatorManager
+}
+
+// newSimEngine creates the engine of a validator, with an empty consensus state.
+func newSimEngine(n *simNode, backend ethapi.Backend) *simEngine {
+	validators := n.sim.vm
+	genesisHash := rawdb.ReadCanonicalHash(n.db, 0)
+	engine := New(simGenesis.Config, n.db, ethapi.NewPublicBlockChainAPI(backend), genesisHash)
+	engine.Authorize(n.address, validators.SignData, validators.SignDataWithContext, nil, accounts.Account{Address: n.address})
+
+	h := engine.GetConsensusPacketHandler()
+	h.getValidatorsFn = validators.GetValidatorsFn
+	h.listValidatorsFn = validators.ListValidatorsAsMap
+	h.getBlockConsensusContext = getBlockConsensusContext
+	h.doesFinalizedTransactionExistFn = func(common.Hash) (bool, error) { return false, nil }
+	h.p2pHandler = n
+	h.clockSkew = n.clockSkew
+
+	return &simEngine{ProofOfStake: engine, validators: validators}
+}
+
+func (e *simEngine) VerifyBlock(chain consensus.ChainHeaderReader, block *types.Block) error {
+	return e.verifyBlock(block, e.validators.GetValidatorsFn, e.validators.ListValidatorsAsMap, getBlockConsensusContext)
+}
+
+// start opens the chain of a validator on its database, with a new engine.
+func (n *simNode) start() {
+	backend := new(simBackend)
+	engine := newSimEngine(n, backend)
+	chain, err := core.NewBlockChain(n.db, nil, simGenesis.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		n.sim.t.Fatal(err)
+	}
+	backend.chain = chain
+	engine.SetBlockchain(chain)
+
+	n.engine, n.chain, n.handler = engine, chain, engine.GetConsensusPacketHandler()
+}
+
+// stop closes the chain and the engine of a validator, keeping its database.
+func (n *simNode) stop() {
+	n.chain.Stop()
+	n.engine.Close()
+}
+
+// seal runs the consensus for the block on top of the chain head, like the
+// miner does, and assembles the block once the commits were received.
+func (n *simNode) seal(engine *ProofOfStake, chain *core.BlockChain) (*types.Block, error) {
+	parent := chain.CurrentBlock()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   parent.GasLimit(),
+	}
+	if err := engine.Prepare(chain, header); err != nil {
+		return nil, err
+	}
+	statedb, err := chain.StateAt(parent.Root())
+	if err != nil {
+		return nil, err
+	}
+	if _, err := engine.HandleTransactions(chain, header, statedb, map[common.Address]types.Transactions{}); err != nil {
+		return nil, err
+	}
+	if !engine.IsBlockReadyToSeal(chain, header, statedb) {
+		return nil, errors.New("not ready to seal")
+	}
+	return engine.FinalizeAndAssembleWithConsensus(chain, header, statedb, nil, nil)
+}
+
+// writeLoop delivers the messages queued on a link once their latency passed.
+func (sim *simulation) writeLoop(l *simLink) {
+	defer sim.wg.Done()
+	for {
+		select {
+		case d := <-l.queue:
+			if wait := time.Until(d.due); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-sim.quit:
+					return
+				}
+			}
+			if _, err := l.conn.Write(d.data); err != nil {
+				return
+			}
+		case <-sim.quit:
+			return
+		}
+	}
+}
+
+// readLoop decodes the messages arriving at a validator from one peer.
+func (sim *simulation) readLoop(conn net.Conn, to, from *simNode) {
+	defer sim.wg.Done()
+	stream := rlp.NewStream(conn, 0)
+	for {
+		var msg simMsg
+		if err := stream.Decode(&msg); err != nil {
+			return
+		}
+		sim.lock.Lock()
+		handler, crashed := to.handler, to.crashed
+		sim.lock.Unlock()
+		if crashed {
+			continue
+		}
+		switch msg.Code {
+		case simConsensusMsg:
+			var packet eth.ConsensusPacket
+			if err := rlp.DecodeBytes(msg.Payload, &packet); err != nil {
+				continue
+			}
+			handler.HandleConsensusPacket(&packet, from.peerId)
+		case simRequestMsg:
+			var request eth.RequestConsensusDataPacket
+			if err := rlp.DecodeBytes(msg.Payload, &request); err != nil {
+				continue
+			}
+			packets, err := handler.HandleRequestConsensusDataPacket(&request)
+			if err != nil {
+				continue
+			}
+			for _, packet := range packets {
+				sim.send(to, from, simConsensusMsg, packet)
+			}
+		}
+	}
+}
+
+// send queues a message on the link between two validators, applying the
+// faults configured for the link and the sender.
+func (sim *simulation) send(from, to *simNode, code uint64, packet interface{}) {
+	sim.lock.Lock()
+	l := sim.links[[2]int{from.index, to.index}]
+	if from.crashed || to.crashed || l.partitioned || (l.packetLoss > 0 && rand.Intn(100) < l.packetLoss) {
+		sim.lock.Unlock()
+		return
+	}
+	latency, byzantine := l.latency, from.byzantine
+	sim.lock.Unlock()
+
+	// Byzantine validators show a forged version of their packets to every
+	// other peer, so the honest validators disagree on what they sent
+	if p, ok := packet.(*eth.ConsensusPacket); ok && byzantine && to.index%2 == 0 {
+		forged := eth.NewConsensusPacket(p)
+		forged.ConsensusData = common.CopyBytes(p.ConsensusData)
+		forged.ConsensusData[len(forged.ConsensusData)-1] ^= 0xff
+		packet = &forged
+	}
+	payload, err := rlp.EncodeToBytes(packet)
+	if err != nil {
+		panic(err)
+	}
+	data, err := rlp.EncodeToBytes(&simMsg{Code: code, Payload: payload})
+	if err != nil {
+		panic(err)
+	}
+	select {
+	case l.queue <- simDelivery{due: time.Now().Add(latency), data: data}:
+	default:
+		log.Warn("Simulation link queue full, dropping message", "from", from.index, "to", to.index)
+	}
+}
+
+// runNode drives the consensus of a validator on top of its chain head and
+// imports the block it seals once the commits were received.
+func (sim *simulation) runNode(n *simNode) {
+	defer sim.wg.Done()
+
+	ticker := time.NewTicker(simTickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-sim.quit:
+			return
+		}
+		sim.lock.Lock()
+		if n.crashed {
+			sim.lock.Unlock()
+			continue
+		}
+		sim.syncNode(n)
+		engine, chain := n.engine, n.chain
+		sim.lock.Unlock()
+
+		block, err := n.seal(engine.ProofOfStake, chain)
+		if err != nil {
+			continue
+		}
+		sim.lock.Lock()
+		if n.chain == chain && chain.CurrentBlock().Hash() == block.ParentHash() {
+			sim.finalize(n, block)
+		}
+		sim.lock.Unlock()
+	}
+}
+
+// finalize imports a block sealed by a validator into its chain and checks it
+// against the blocks sealed by others at the same height. The lock must be
+// held.
+func (sim *simulation) finalize(n *simNode, block *types.Block) {
+	if _, err := n.chain.InsertChain(types.Blocks{block}); err != nil {
+		sim.violations = append(sim.violations, fmt.Sprintf("validator %d rejected its own block %d: %v", n.index, block.NumberU64(), err))
+		return
+	}
+	if hash, ok := sim.finalized[block.NumberU64()]; !ok {
+		sim.finalized[block.NumberU64()] = block.Hash()
+		data := &BlockConsensusData{}
+		rlp.DecodeBytes(block.Header().ConsensusData, data)
+		log.Info("Simulation finalized block", "number", block.Number(), "hash", block.Hash(), "vote", data.VoteType, "validator", n.index)
+	} else if hash != block.Hash() {
+		sim.violations = append(sim.violations, fmt.Sprintf("validator %d finalized block %d %x, conflicting with %x", n.index, block.NumberU64(), block.Hash(), hash))
+	}
+}
+
+// syncNode imports the blocks a validator missed from the longest chain among
+// its reachable peers, like block sync does on a real node. The lock must be
+// held.
+func (sim *simulation) syncNode(n *simNode) {
+	head := n.chain.CurrentBlock()
+	var best *simNode
+	for _, peer := range sim.nodes {
+		if peer == n || peer.crashed || peer.chain.CurrentBlock().NumberU64() <= head.NumberU64() {
+			continue
+		}
+		if sim.links[[2]int{peer.index, n.index}].partitioned {
+			continue
+		}
+		if best == nil || peer.chain.CurrentBlock().NumberU64() > best.chain.CurrentBlock().NumberU64() {
+			best = peer
+		}
+	}
+	if best == nil {
+		return
+	}
+	if best.chain.GetCanonicalHash(head.NumberU64()) != head.Hash() {
+		sim.violations = append(sim.violations, fmt.Sprintf("validator %d chain diverges from validator %d at block %d", n.index, best.index, head.NumberU64()))
+		return
+	}
+	var blocks types.Blocks
+	for number := head.NumberU64() + 1; number <= best.chain.CurrentBlock().NumberU64(); number++ {
+		blocks = append(blocks, best.chain.GetBlockByNumber(number))
+	}
+	if _, err := n.chain.InsertChain(blocks); err != nil {
+		sim.violations = append(sim.violations, fmt.Sprintf("validator %d rejected the blocks of validator %d: %v", n.index, best.index, err))
+	}
+}
+
+// P2PHandler implementation of the simulated validators.
+
+func (n *simNode) SendConsensusPacket(peerList []string, packet *eth.ConsensusPacket) error {
+	for _, id := range peerList {
+		for _, peer := range n.sim.nodes {
+			if peer.peerId == id && peer != n {
+				n.sim.send(n, peer, simConsensusMsg, packet)
+			}
+		}
+	}
+	return nil
+}
+
+func (n *simNode) BroadcastConsensusData(packet *eth.ConsensusPacket) error {
+	for _, peer := range n.sim.nodes {
+		if peer != n {
+			n.sim.send(n, peer, simConsensusMsg, packet)
+		}
+	}
+	return nil
+}
+
+func (n *simNode) RequestTransactions(txns []common.Hash) error {
+	return nil
+}
+
+func (n *simNode) RequestConsensusData(packet *eth.RequestConsensusDataPacket) error {
+	for _, peer := range n.sim.nodes {
+		if peer != n {
+			n.sim.send(n, peer, simRequestMsg, packet)
+		}
+	}
+	return nil
+}
+
+func (n *simNode) GetLocalPeerId() string {
+	return n.peerId
+}
+
+func (n *simNode) ReportPeer(peerId string, event p2p.ScoreEvent) {
+	n.sim.lock.Lock()
+	defer n.sim.lock.Unlock()
+	n.reports[peerId]++
+}
+
+// Fault injection.
+
+// setLinks applies the given latency and packet loss to every link.
+func (sim *simulation) setLinks(latency time.Duration, packetLoss int) {
+	sim.lock.Lock()
+	defer sim.lock.Unlock()
+	for _, l := range sim.links {
+		l.latency, l.packetLoss = latency, packetLoss
+	}
+}
+
+// partition cuts the links between validators of different groups.
+func (sim *simulation) partition(groups ...[]int) {
+	sim.lock.Lock()
+	defer sim.lock.Unlock()
+	group := make(map[int]int)
+	for g, members := range groups {
+		for _, i := range members {
+			group[i] = g
+		}
+	}
+	for key, l := range sim.links {
+		l.partitioned = group[key[0]] != group[key[1]]
+	}
+}
+
+// heal restores all links cut by a partition.
+func (sim *simulation) heal() {
+	sim.partition()
+}
+
+// crash stops a validator, dropping all its traffic.
+func (sim *simulation) crash(i int) {
+	sim.lock.Lock()
+	defer sim.lock.Unlock()
+	sim.nodes[i].crashed = true
+}
+
+// restart brings a crashed validator back with an empty consensus state. Its
+// chain is reopened on its database, like a node restarting.
+func (sim *simulation) restart(i int) {
+	sim.lock.Lock()
+	defer sim.lock.Unlock()
+	n := sim.nodes[i]
+	n.stop()
+	n.start()
+	n.crashed = false
+}
+
+// setClockSkew restarts a validator with its clock shifted by the given offset.
+func (sim *simulation) setClockSkew(i int, skew time.Duration) {
+	sim.lock.Lock()
+	sim.nodes[i].clockSkew = skew
+	sim.lock.Unlock()
+	sim.restart(i)
+}
+
+// setByzantine turns a validator byzantine.
+func (sim *simulation) setByzantine(i int) {
+	sim.lock.Lock()
+	defer sim.lock.Unlock()
+	sim.nodes[i].byzantine = true
+}
+
+// Assertions.
+
+// height returns the lowest chain height among the running honest validators.
+func (sim *simulation) height() uint64 {
+	sim.lock.Lock()
+	defer sim.lock.Unlock()
+	min := ^uint64(0)
+	for _, n := range sim.nodes {
+		if n.crashed || n.byzantine {
+			continue
+		}
+		if head := n.chain.CurrentBlock().NumberU64(); head < min {
+			min = head
+		}
+	}
+	return min
+}
+
+// waitHeight checks liveness, waiting for all running honest validators to
+// reach the given height.
+func (sim *simulation) waitHeight(height uint64, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for sim.height() < height {
+		if time.Now().After(deadline) {
+			sim.t.Fatalf("liveness: height %d not reached within %v, at %d", height, timeout, sim.height())
+		}
+		time.Sleep(simTickInterval)
+	}
+}
+
+// checkSafety fails the test if validators finalized conflicting blocks.
+func (sim *simulation) checkSafety() {
+	sim.lock.Lock()
+	defer sim.lock.Unlock()
+	for _, v := range sim.violations {
+		sim.t.Errorf("safety: %s", v)
+	}
+}
+
+// stop shuts the simulation down and checks safety.
+func (sim *simulation) stop() {
+	close(sim.quit)
+	for _, l := range sim.links {
+		l.conn.Close()
+	}
+	sim.wg.Wait()
+	for _, n := range sim.nodes {
+		n.stop()
+	}
+	sim.checkSafety()
+}
+
+func TestSimulation(t *testing.T) {
+	sim := newSimulation(t, 4)
+	defer sim.stop()
+
+	sim.waitHeight(3, 2*time.Minute)
+}
+
+func TestSimulationLossyLinks(t *testing.T) {
+	sim := newSimulation(t, 4)
+	defer sim.stop()
+
+	sim.setLinks(50*time.Millisecond, 10)
+	sim.waitHeight(2, 3*time.Minute)
+}
+
+func TestSimulationPartition(t *testing.T) {
+	sim := newSimulation(t, 4)
+	defer sim.stop()
+
+	sim.waitHeight(1, 2*time.Minute)
+
+	// Neither half has the stake to finalize anything on its own
+	sim.partition([]int{0, 1}, []int{2, 3})
+	time.Sleep(5 * time.Second)
+	stalled := sim.height()
+	time.Sleep(10 * time.Second)
+	if height := sim.height(); height > stalled+1 {
+		t.Fatalf("partitioned network progressed from %d to %d", stalled, height)
+	}
+	sim.checkSafety()
+
+	sim.heal()
+	sim.waitHeight(stalled+2, 3*time.Minute)
+}
+
+func TestSimulationCrashRestart(t *testing.T) {
+	sim := newSimulation(t, 4)
+	defer sim.stop()
+
+	sim.crash(0)
+	sim.waitHeight(2, 2*time.Minute)
+
+	sim.restart(0)
+	sim.waitHeight(sim.height()+2, 3*time.Minute)
+}
+
+func TestSimulationClockSkew(t *testing.T) {
+	sim := newSimulation(t, 4)
+	defer sim.stop()
+
+	sim.setClockSkew(0, 10*time.Minute)
+	sim.waitHeight(3, 3*time.Minute)
+}
+
+func TestSimulationByzantine(t *testing.T) {
+	sim := newSimulation(t, 4)
+	defer sim.stop()
+
+	sim.setByzantine(0)
+	sim.waitHeight(2, 3*time.Minute)
+
+	sim.lock.Lock()
+	defer sim.lock.Unlock()
+	reported := false
+	for _, n := range sim.nodes[1:] {
+		if n.reports[sim.nodes[0].peerId] > 0 {
+			reported = true
+		}
+	}
+	if !reported {
+		t.Error("byzantine validator not reported by any peer")
+	}
+}
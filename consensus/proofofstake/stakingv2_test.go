@@ -141,7 +141,7 @@ func NewDeposit(state *state.StateDB, depositor common.Address, validator common
 		return nil
 	}
 	// call
-	data, err := encodeCall(&abiData, method, validator)
+	data, err := abiData.Pack(method, validator)
 	if err != nil {
 		log.Error("Unable to pack AddDeposit", "error", err)
 		return nil
@@ -165,7 +165,7 @@ func PauseValidation(state *state.StateDB, depositor common.Address) error {
 		return err
 	}
 	// call
-	data, err := encodeCall(&abiData, method)
+	data, err := abiData.Pack(method)
 	if err != nil {
 		log.Error("Unable to pack PauseValidation", "error", err)
 		return err
@@ -190,7 +190,7 @@ func ResumeValidation(state *state.StateDB, depositor common.Address) error {
 		return err
 	}
 	// call
-	data, err := encodeCall(&abiData, method)
+	data, err := abiData.Pack(method)
 	if err != nil {
 		log.Error("Unable to pack ResumeValidation", "error", err)
 		return err
@@ -215,7 +215,7 @@ func CompleteWithdrawal(state *state.StateDB, depositor common.Address) error {
 		return err
 	}
 	// call
-	data, err := encodeCall(&abiData, method)
+	data, err := abiData.Pack(method)
 	if err != nil {
 		log.Error("Unable to pack CompleteWithdrawal", "error", err)
 		return err
@@ -250,7 +250,7 @@ func AddDepositorSlashing(state *state.StateDB, from common.Address, depositor c
 		return nil, err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, amount)
+	data, err := abiData.Pack(method, amount)
 	if err != nil {
 		log.Error("Unable to pack AddDepositorSlashing", "error", err)
 		return nil, err
@@ -285,7 +285,7 @@ func AddDepositorReward(state *state.StateDB, from common.Address, depositor com
 		return nil, err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, amount)
+	data, err := abiData.Pack(method, amount)
 	if err != nil {
 		log.Error("Unable to pack AddDepositorReward", "error", err)
 		return nil, err
@@ -320,7 +320,7 @@ func GetDepositorCount(state *state.StateDB) (*big.Int, error) {
 		return nil, err
 	}
 	// call
-	data, err := encodeCall(&abiData, method)
+	data, err := abiData.Pack(method)
 	if err != nil {
 		log.Error("Unable to pack GetDepositorCount", "error", err)
 		return nil, err
@@ -355,7 +355,7 @@ func GetTotalDepositedBalance(state *state.StateDB) (*big.Int, error) {
 		return nil, err
 	}
 	// call
-	data, err := encodeCall(&abiData, method)
+	data, err := abiData.Pack(method)
 	if err != nil {
 		log.Error("Unable to pack GetTotalDepositedBalance", "error", err)
 		return nil, err
@@ -390,7 +390,7 @@ func ListValidators(state *state.StateDB) ([]common.Address, error) {
 		return nil, err
 	}
 	// call
-	data, err := encodeCall(&abiData, method)
+	data, err := abiData.Pack(method)
 	if err != nil {
 		log.Error("Unable to pack ListValidators", "error", err)
 		return nil, err
@@ -427,7 +427,7 @@ func GetDepositorOfValidator(state *state.StateDB, validator common.Address) (co
 		return ZERO_ADDRESS, err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, validator)
+	data, err := abiData.Pack(method, validator)
 	if err != nil {
 		log.Error("Unable to pack GetDepositorOfValidator", "error", err)
 		return ZERO_ADDRESS, err
@@ -464,7 +464,7 @@ func GetValidatorOfDepositor(state *state.StateDB, depositor common.Address) (co
 		return ZERO_ADDRESS, err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, depositor)
+	data, err := abiData.Pack(method, depositor)
 	if err != nil {
 		log.Error("Unable to pack GetValidatorOfDepositor", "error", err)
 		return ZERO_ADDRESS, err
@@ -501,7 +501,7 @@ func GetBalanceOfDepositor(state *state.StateDB, depositor common.Address) (*big
 		return nil, err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, depositor)
+	data, err := abiData.Pack(method, depositor)
 	if err != nil {
 		log.Error("Unable to pack GetBalanceOfDepositor", "error", err)
 		return nil, err
@@ -536,7 +536,7 @@ func GetNetBalanceOfDepositor(state *state.StateDB, depositor common.Address) (*
 		return nil, err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, depositor)
+	data, err := abiData.Pack(method, depositor)
 	if err != nil {
 		log.Error("Unable to pack GetNetBalanceOfDepositor", "error", err)
 		return nil, err
@@ -571,7 +571,7 @@ func GetDepositorRewards(state *state.StateDB, depositor common.Address) (*big.I
 		return nil, err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, depositor)
+	data, err := abiData.Pack(method, depositor)
 	if err != nil {
 		log.Error("Unable to pack GetDepositorRewards", "error", err)
 		return nil, err
@@ -606,7 +606,7 @@ func GetDepositorSlashings(state *state.StateDB, depositor common.Address) (*big
 		return nil, err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, depositor)
+	data, err := abiData.Pack(method, depositor)
 	if err != nil {
 		log.Error("Unable to pack GetDepositorSlashings", "error", err)
 		return nil, err
@@ -641,7 +641,7 @@ func GetWithdrawalBlock(state *state.StateDB, depositor common.Address) (*big.In
 		return nil, err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, depositor)
+	data, err := abiData.Pack(method, depositor)
 	if err != nil {
 		log.Error("Unable to pack GetWithdrawalBlock", "error", err)
 		return nil, err
@@ -678,7 +678,7 @@ func IsValidationPaused(state *state.StateDB, validator common.Address) (bool, e
 		return out, err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, validator)
+	data, err := abiData.Pack(method, validator)
 	if err != nil {
 		log.Error("Unable to pack IsValidationPaused", "error", err)
 		return out, err
@@ -714,7 +714,7 @@ func DoesValidatorExist(state *state.StateDB, validator common.Address) (bool, e
 		return out, err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, validator)
+	data, err := abiData.Pack(method, validator)
 	if err != nil {
 		log.Error("Unable to pack DoesValidatorExist", "error", err)
 		return out, err
@@ -748,7 +748,7 @@ func DidValidatorEverExist(state *state.StateDB, validator common.Address) (bool
 		return out, err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, validator)
+	data, err := abiData.Pack(method, validator)
 	if err != nil {
 		log.Error("Unable to pack DidValidatorEverExist", "error", err)
 		return out, err
@@ -782,7 +782,7 @@ func DoesDepositorExist(state *state.StateDB, depositor common.Address) (bool, e
 		return out, err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, depositor)
+	data, err := abiData.Pack(method, depositor)
 	if err != nil {
 		log.Error("Unable to pack DoesDepositorExist", "error", err)
 		return out, err
@@ -816,7 +816,7 @@ func DidDepositorEverExist(state *state.StateDB, depositor common.Address) (bool
 		return out, err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, depositor)
+	data, err := abiData.Pack(method, depositor)
 	if err != nil {
 		log.Error("Unable to pack DidDepositorEverExist", "error", err)
 		return out, err
@@ -848,7 +848,7 @@ func ChangeValidator(state *state.StateDB, depositor common.Address, newValidato
 		return err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, newValidatorAddress)
+	data, err := abiData.Pack(method, newValidatorAddress)
 	if err != nil {
 		log.Error("Unable to pack ChangeValidator", "error", err)
 		return err
@@ -872,7 +872,7 @@ func InitiateChangeDepositor(state *state.StateDB, oldDepositorAddress common.Ad
 		return err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, newDepositorAddress)
+	data, err := abiData.Pack(method, newDepositorAddress)
 	if err != nil {
 		log.Error("Unable to pack InitiateChangeDepositor", "error", err)
 		return err
@@ -896,7 +896,7 @@ func CompleteChangeDepositor(state *state.StateDB, oldDepositorAddress common.Ad
 		return err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, oldDepositorAddress)
+	data, err := abiData.Pack(method, oldDepositorAddress)
 	if err != nil {
 		log.Error("Unable to pack CompleteChangeDepositor", "error", err)
 		return err
@@ -920,7 +920,7 @@ func IncreaseDeposit(state *state.StateDB, depositor common.Address, amount *big
 		return err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, amount)
+	data, err := abiData.Pack(method, amount)
 	if err != nil {
 		log.Error("Unable to pack IncreaseDeposit", "error", err)
 		return err
@@ -944,7 +944,7 @@ func InitiatePartialWithdrawal(state *state.StateDB, depositor common.Address, a
 		return err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, amount)
+	data, err := abiData.Pack(method, amount)
 	if err != nil {
 		log.Error("Unable to pack InitiatePartialWithdrawal", "error", err)
 		return err
@@ -968,7 +968,7 @@ func CompletePartialWithdrawal(state *state.StateDB, depositor common.Address) e
 		return err
 	}
 	// call
-	data, err := encodeCall(&abiData, method)
+	data, err := abiData.Pack(method)
 	if err != nil {
 		log.Error("Unable to pack CompletePartialWithdrawal", "error", err)
 		return err
@@ -992,7 +992,7 @@ func GetStakingDetails(state *state.StateDB, validator common.Address) (*Validat
 		return nil, err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, validator)
+	data, err := abiData.Pack(method, validator)
 	if err != nil {
 		log.Error("Unable to pack GetStakingDetails", "error", err)
 		return nil, err
@@ -1027,7 +1027,7 @@ func SetNilBlock(state *state.StateDB, from common.Address, validator common.Add
 		return err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, validator)
+	data, err := abiData.Pack(method, validator)
 	if err != nil {
 		log.Error("Unable to pack CompletePartialWithdrawal", "error", err)
 		return err
@@ -1051,7 +1051,7 @@ func ResetNilBlock(state *state.StateDB, from common.Address, validator common.A
 		return err
 	}
 	// call
-	data, err := encodeCall(&abiData, method, validator)
+	data, err := abiData.Pack(method, validator)
 	if err != nil {
 		log.Error("Unable to pack ResetNilBlock", "error", err)
 		return err
@@ -0,0 +1,175 @@
+package proofofstake
+
+import (
+	"errors"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/core/state"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/systemcontracts/staking"
+	"github.com/QuantumCoinProject/qc/systemcontracts/unbonding"
+	"math/big"
+)
+
+type UnbondingTrancheDetails struct {
+	Id               string `json:"id"     gencodec:"required"`
+	Amount           string `json:"amount"     gencodec:"required"`
+	StartBlock       string `json:"startBlock"     gencodec:"required"`
+	MaturityBlock    string `json:"maturityBlock"     gencodec:"required"`
+	EarlyExitPenalty string `json:"earlyExitPenalty"     gencodec:"required"`
+}
+
+func newUnbondingTrancheDetails(tranche *unbonding.Tranche, blockNumber uint64) *UnbondingTrancheDetails {
+	return &UnbondingTrancheDetails{
+		Id:               hexutil.EncodeUint64(tranche.Id),
+		Amount:           hexutil.EncodeBig(tranche.Amount),
+		StartBlock:       hexutil.EncodeUint64(tranche.StartBlock),
+		MaturityBlock:    hexutil.EncodeUint64(tranche.MaturityBlock),
+		EarlyExitPenalty: hexutil.EncodeBig(unbonding.EarlyExitPenalty(tranche, blockNumber)),
+	}
+}
+
+// parsePartialWithdrawalLog returns the depositor and amount of an OnInitiatePartialWithdrawal staking event.
+func parsePartialWithdrawalLog(l *types.Log) (common.Address, *big.Int, bool, error) {
+	if l.Address.IsEqualTo(staking.STAKING_CONTRACT_ADDRESS) == false || len(l.Topics) != 2 {
+		return common.Address{}, nil, false, nil
+	}
+	abiData, err := staking.GetStakingContractV2_ABI()
+	if err != nil {
+		return common.Address{}, nil, false, err
+	}
+	eventName := staking.GetContract_Event_InitiatePartialWithdrawal()
+	if l.Topics[0] != abiData.Events[eventName].ID {
+		return common.Address{}, nil, false, nil
+	}
+	values, err := abiData.Unpack(eventName, l.Data)
+	if err != nil {
+		return common.Address{}, nil, false, err
+	}
+	if len(values) != 2 {
+		return common.Address{}, nil, false, errors.New("invalid partial withdrawal event")
+	}
+	return common.BytesToAddress(l.Topics[1].Bytes()), values[1].(*big.Int), true, nil
+}
+
+// processUnbonding moves the withdrawals into the unbonding queue, and then applies the transactions
+// sent to the unbonding contract. The full withdrawals pending in the staking contract are queued at
+// UNBONDING_QUEUE_START_BLOCK, and the partial withdrawals as they are initiated. Invalid unbonding
+// transactions are skipped; they only consume the gas of the sender.
+func (c *ProofOfStake) processUnbonding(header *types.Header, state *state.StateDB, txs []*types.Transaction,
+	receipts []*types.Receipt, blockConsensusData *BlockConsensusData) error {
+	blockNumber := header.Number.Uint64()
+	if blockNumber < unbonding.UNBONDING_QUEUE_START_BLOCK {
+		return nil
+	}
+
+	var totalDepositedBalance *big.Int
+	if blockNumber == unbonding.UNBONDING_QUEUE_START_BLOCK {
+		depositors := unbonding.PendingFullWithdrawals(state)
+		if len(depositors) > 0 {
+			var err error
+			totalDepositedBalance, err = c.GetTotalDepositedBalance(header.ParentHash, blockNumber-1)
+			if err != nil {
+				return err
+			}
+		}
+		for _, depositor := range depositors {
+			tranche, err := unbonding.QueueFullWithdrawal(state, depositor, totalDepositedBalance, blockNumber)
+			if err != nil {
+				log.Warn("Full withdrawal not queued", "depositor", depositor, "err", err)
+				continue
+			}
+			log.Info("Full withdrawal queued", "id", tranche.Id, "depositor", depositor, "amount", tranche.Amount, "maturityBlock", tranche.MaturityBlock)
+		}
+	}
+
+	if blockConsensusData.VoteType != VOTE_TYPE_OK || len(txs) != len(receipts) {
+		return nil
+	}
+
+	for i, txn := range txs {
+		if receipts[i].Status != types.ReceiptStatusSuccessful {
+			continue
+		}
+
+		for _, l := range receipts[i].Logs {
+			depositor, amount, ok, err := parsePartialWithdrawalLog(l)
+			if err != nil {
+				return err
+			}
+			if ok == false {
+				continue
+			}
+			if totalDepositedBalance == nil {
+				totalDepositedBalance, err = c.GetTotalDepositedBalance(header.ParentHash, blockNumber-1)
+				if err != nil {
+					return err
+				}
+			}
+			tranche, err := unbonding.Queue(state, depositor, amount, totalDepositedBalance, blockNumber)
+			if err != nil {
+				return err
+			}
+			log.Debug("Unbonding tranche queued", "id", tranche.Id, "depositor", depositor, "amount", amount, "maturityBlock", tranche.MaturityBlock)
+		}
+
+		if txn.To() == nil || txn.To().IsEqualTo(unbonding.UNBONDING_CONTRACT_ADDRESS) == false {
+			continue
+		}
+		msg, err := txn.AsMessage(c.signer)
+		if err != nil {
+			return err
+		}
+		err = unbonding.ProcessTransaction(state, msg.From(), txn.Data(), blockNumber)
+		if err != nil {
+			log.Info("Unbonding txn skipped", "txn", txn.Hash(), "from", msg.From(), "err", err)
+		}
+	}
+
+	return nil
+}
+
+// getUnbondingTranches returns the open tranches of the depositor as of the given block.
+func (c *ProofOfStake) getUnbondingTranches(depositor common.Address, blockHash common.Hash) ([]*UnbondingTrancheDetails, error) {
+	if c.blockchain == nil {
+		return nil, errors.New("blockchain not set")
+	}
+	header := c.blockchain.GetHeaderByHash(blockHash)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	blockNumber := header.Number.Uint64()
+	if blockNumber < unbonding.UNBONDING_QUEUE_START_BLOCK {
+		return nil, nil
+	}
+	state, err := c.blockchain.StateAt(header.Root)
+	if err != nil {
+		return nil, err
+	}
+	tranches, err := unbonding.GetTranches(state, depositor)
+	if err != nil {
+		return nil, err
+	}
+	details := make([]*UnbondingTrancheDetails, len(tranches))
+	for i, tranche := range tranches {
+		details[i] = newUnbondingTrancheDetails(tranche, blockNumber)
+	}
+	return details, nil
+}
+
+// getUnbondingQueueInfo returns the exiting stake and the delay of a tranche queued on top of the given block.
+func (c *ProofOfStake) getUnbondingQueueInfo(header *types.Header, totalDepositedBalance *big.Int) (*big.Int, uint64, error) {
+	if header.Number.Uint64() < unbonding.UNBONDING_QUEUE_START_BLOCK {
+		return big.NewInt(0), unbonding.BASE_DELAY_BLOCKS, nil
+	}
+	if c.blockchain == nil {
+		return nil, 0, errors.New("blockchain not set")
+	}
+	state, err := c.blockchain.StateAt(header.Root)
+	if err != nil {
+		return nil, 0, err
+	}
+	exitingStake := unbonding.GetExitingStake(state)
+	return exitingStake, unbonding.UnbondingDelay(exitingStake, totalDepositedBalance), nil
+}
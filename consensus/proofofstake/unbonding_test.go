@@ -0,0 +1,37 @@
+package proofofstake
+
+import (
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/systemcontracts/staking"
+	"math/big"
+	"testing"
+)
+
+func TestParsePartialWithdrawalLog(t *testing.T) {
+	abiData, err := staking.GetStakingContractV2_ABI()
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	event := abiData.Events[staking.GetContract_Event_InitiatePartialWithdrawal()]
+	data, err := event.Inputs.NonIndexed().Pack(big.NewInt(32100), big.NewInt(5000))
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	depositor := common.HexToAddress("0x0000000000000000000000000000000000000000000000000000000000000011")
+
+	l := &types.Log{
+		Address: staking.STAKING_CONTRACT_ADDRESS,
+		Topics:  []common.Hash{event.ID, common.BytesToHash(depositor.Bytes())},
+		Data:    data,
+	}
+	parsedDepositor, amount, ok, err := parsePartialWithdrawalLog(l)
+	if err != nil || ok == false || parsedDepositor.IsEqualTo(depositor) == false || amount.Cmp(big.NewInt(5000)) != 0 {
+		t.Fatalf("failed %v %v %v %v", parsedDepositor, amount, ok, err)
+	}
+
+	l.Address = common.HexToAddress("0x0000000000000000000000000000000000000000000000000000000000002000")
+	if _, _, ok, err = parsePartialWithdrawalLog(l); ok || err != nil {
+		t.Fatalf("failed %v %v", ok, err)
+	}
+}
@@ -1,18 +1,15 @@
 package proofofstake
 
 import (
-	"context"
 	"errors"
 	"github.com/QuantumCoinProject/qc/accounts/abi"
 	"github.com/QuantumCoinProject/qc/common"
 	"github.com/QuantumCoinProject/qc/common/hexutil"
 	"github.com/QuantumCoinProject/qc/core/state"
 	"github.com/QuantumCoinProject/qc/core/types"
-	"github.com/QuantumCoinProject/qc/internal/ethapi"
 	"github.com/QuantumCoinProject/qc/log"
-	"github.com/QuantumCoinProject/qc/rpc"
+	"github.com/QuantumCoinProject/qc/systemcontracts"
 	"github.com/QuantumCoinProject/qc/systemcontracts/staking"
-	"math"
 	"math/big"
 )
 
@@ -30,6 +27,8 @@ type ValidatorDetails struct {
 	NilBlockCount           string         `json:"nilBlockCount" gencodec:"required"`
 	BlockProposerResetBlock string         `json:"blockProposerResetBlock" gencodec:"required"`
 	ValidatorResetBlock     string         `json:"validatorResetBlock" gencodec:"required"`
+
+	UnbondingTranches []*UnbondingTrancheDetails `json:"unbondingTranches"`
 }
 
 type ValidatorDetailsV2 struct {
@@ -64,68 +63,20 @@ func (p *ProofOfStake) GetValidators(blockHash common.Hash) (map[common.Address]
 		log.Debug("totalDepositedBalance", "totalDepositedBalance", totalDepositedBalance)
 	}
 
-	err = staking.IsStakingContract()
-	if err != nil {
-		log.Warn("GETH_STAKING_CONTRACT_ADDRESS: Contract1 address is empty")
-		return nil, err
-	}
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := staking.GetContract_Method_ListValidators()
-	abiData, err := p.GetStakingContractAbi()
-	if err != nil {
-		log.Error("GetValidators error getting abidata", "err", err)
-		return nil, err
-	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-	// call
-	data, err := abiData.Pack(method)
-	if err != nil {
-		log.Error("Unable to pack tx for get filteredValidatorsDepositMap", "error", err)
-		return nil, err
-	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
-
-	msgData := (hexutil.Bytes)(data)
-
-	result, err := p.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
-	if err != nil {
-		return nil, err
-	}
-	if len(result) == 0 {
-		log.Debug("result 0 length")
-		return nil, nil
-	}
-	_, err = abiData.Unpack(method, result)
-	if err != nil {
-		log.Error("Unpack", "err", err)
-		return nil, err
-	}
-
-	var (
-		ret0 = new([]common.Address)
-	)
-	out := ret0
-
-	if err := abiData.UnpackIntoInterface(out, method, result); err != nil {
-		log.Info("UnpackIntoInterface error")
+	out, err := p.listValidatorAddresses(blockHash)
+	if err != nil || out == nil {
 		return nil, err
 	}
 
 	proposalsTxnsMap := make(map[common.Address]*big.Int)
-	for _, val := range *out {
+	for _, val := range out {
 		if val.IsEqualTo(ZERO_ADDRESS) {
 			return nil, errors.New("invalid validator")
 		}
 		log.Debug("GetValidators Validator", "val", val)
 	}
 
-	for _, val := range *out {
+	for _, val := range out {
 		isPaused, err := p.IsValidatorPaused(val, blockHash)
 		if err != nil {
 			log.Debug("IsValidatorPaused failed", "err", err)
@@ -163,505 +114,168 @@ func (p *ProofOfStake) GetValidators(blockHash common.Hash) (map[common.Address]
 
 func (p *ProofOfStake) GetValidatorOfDepositor(depositor common.Address, blockHash common.Hash) (common.Address, error) {
 	log.Trace("GetValidatorOfDepositor depositor", "depositor", depositor)
-	err := staking.IsStakingContract()
+	caller, err := p.stakingCaller()
 	if err != nil {
-		log.Warn("GETH_STAKING_CONTRACT_ADDRESS: Contract1 address is empty")
 		return common.Address{}, err
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := staking.GetContract_Method_GetValidatorOfDepositor()
-	abiData, err := p.GetStakingContractAbi()
-	if err != nil {
-		log.Error("GetValidatorOfDepositor abi error", "err", err)
-		return common.Address{}, err
-	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-
-	// call
-	data, err := abiData.Pack(method, depositor)
-	if err != nil {
-		log.Error("Unable to pack tx for get validator", "error", err)
-		return common.Address{}, err
-	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
-
-	msgData := (hexutil.Bytes)(data)
-	result, err := p.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		//Gas:  &gas,
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
-	if err != nil {
-		return common.Address{}, err
-	}
-	if len(result) == 0 {
-		return common.Address{}, errors.New("no depositor found")
-	}
-
-	var (
-		ret0 = new(common.Address)
-	)
-	out := ret0
-
-	if err := abiData.UnpackIntoInterface(out, method, result); err != nil {
+	var out common.Address
+	if err := caller.Call(blockHash, &out, staking.GetContract_Method_GetValidatorOfDepositor(), depositor); err != nil {
 		return common.Address{}, err
 	}
-
-	return *out, nil
+	return out, nil
 }
 
 func (p *ProofOfStake) GetDepositorOfValidator(validator common.Address, blockHash common.Hash) (common.Address, error) {
 	log.Trace("GetDepositorOfValidator validator", "validator", validator)
-	err := staking.IsStakingContract()
+	caller, err := p.stakingCaller()
 	if err != nil {
-		log.Warn("GETH_STAKING_CONTRACT_ADDRESS: Contract1 address is empty")
 		return common.Address{}, err
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := staking.GetContract_Method_GetDepositorOfValidator()
-	abiData, err := p.GetStakingContractAbi()
-	if err != nil {
-		log.Error("GetDepositorOfValidator abi error", "err", err)
-		return common.Address{}, err
-	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-
-	// call
-	data, err := abiData.Pack(method, validator)
-	if err != nil {
-		log.Error("Unable to pack tx for get depositor", "error", err)
+	var out common.Address
+	if err := caller.Call(blockHash, &out, staking.GetContract_Method_GetDepositorOfValidator(), validator); err != nil {
 		return common.Address{}, err
 	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
-
-	msgData := (hexutil.Bytes)(data)
-	result, err := p.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		//Gas:  &gas,
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
-	if err != nil {
-		return common.Address{}, err
-	}
-	if len(result) == 0 {
-		return common.Address{}, errors.New("no depositor found")
-	}
-
-	var (
-		ret0 = new(common.Address)
-	)
-	out := ret0
-
-	if err := abiData.UnpackIntoInterface(out, method, result); err != nil {
-		return common.Address{}, err
-	}
-
-	return *out, nil
+	return out, nil
 }
 
 func (p *ProofOfStake) GetNetBalanceOfDepositor(depositor common.Address, blockHash common.Hash) (*big.Int, error) {
-	err := staking.IsStakingContract()
-	if err != nil {
-		log.Warn("DP_STAKING_CONTRACT_ADDRESS: Contract1 address is empty")
-		return nil, err
-	}
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := staking.GetContract_Method_GetNetBalanceOfDepositor() //todo: change once initial storage is set
-	//method := staking.GetContract_Method_GetBalanceOfDepositor()
-	abiData, err := p.GetStakingContractAbi()
+	caller, err := p.stakingCaller()
 	if err != nil {
-		log.Error("GetNetBalanceOfDepositor abi error", "err", err)
 		return nil, err
 	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-
-	// call
-	data, err := abiData.Pack(method, depositor)
-	if err != nil {
-		log.Error("Unable to pack tx for GetNetBalanceOfDepositor", "error", err)
-		return nil, err
-	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
-
-	msgData := (hexutil.Bytes)(data)
-	result, err := p.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
-	if err != nil {
-		log.Error("Call", "err", err)
-		return nil, err
-	}
-	if len(result) == 0 {
-		return nil, errors.New("GetNetBalanceOfDepositor result is 0")
-	}
-
 	var out *big.Int
-
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		log.Debug("UnpackIntoInterface", "err", err, "depositor", depositor)
+	if err := caller.Call(blockHash, &out, staking.GetContract_Method_GetNetBalanceOfDepositor(), depositor); err != nil {
 		return nil, err
 	}
-
 	return out, nil
 }
 
 func (p *ProofOfStake) GetDepositorCount(blockHash common.Hash) (*big.Int, error) {
-	err := staking.IsStakingContract()
-	if err != nil {
-		log.Warn("DP_STAKING_CONTRACT_ADDRESS: Contract1 address is empty")
-		return nil, err
-	}
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := staking.GetContract_Method_GetDepositorCount()
-	abiData, err := p.GetStakingContractAbi()
-	if err != nil {
-		log.Trace("GetDepositorCount abi error", "err", err)
-		return nil, err
-	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-
-	// call
-	data, err := abiData.Pack(method)
+	caller, err := p.stakingCaller()
 	if err != nil {
-		log.Error("Unable to pack tx for get filteredValidatorsDepositMap", "error", err)
 		return nil, err
 	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
-
-	msgData := (hexutil.Bytes)(data)
-
-	result, err := p.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
-	if err != nil {
-		log.Trace("Call", "err", err)
-		return nil, err
-	}
-	if len(result) == 0 {
-		return nil, errors.New("GetDepositorCount result is 0")
-	}
-
 	var out *big.Int
-
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		log.Trace("UnpackIntoInterface", "err", err)
+	if err := caller.Call(blockHash, &out, staking.GetContract_Method_GetDepositorCount()); err != nil {
 		return nil, err
 	}
-
 	return out, nil
 }
 
 func (p *ProofOfStake) GetTotalDepositedBalance(blockHash common.Hash, blockNumber uint64) (*big.Int, error) {
-	err := staking.IsStakingContract()
+	caller, err := p.stakingCaller()
 	if err != nil {
-		log.Warn("DP_STAKING_CONTRACT_ADDRESS: Contract1 address is empty")
 		return nil, err
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := staking.GetContract_Method_GetTotalDepositedBalance()
-	abiData, err := p.GetStakingContractAbi()
-	if err != nil {
-		log.Trace("GetTotalDepositedBalance abi error", "err", err)
-		return nil, err
-	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-	// call
-	data, err := abiData.Pack(method)
-	if err != nil {
-		log.Error("Unable to pack tx for get filteredValidatorsDepositMap", "error", err)
-		return nil, err
-	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
-
-	msgData := (hexutil.Bytes)(data)
-	result, err := p.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
-	if err != nil {
-		log.Trace("Call", "err", err)
-		return nil, err
-	}
-	if len(result) == 0 {
-		return nil, errors.New("GetTotalDepositedBalance result is 0")
-	}
 	var out *big.Int
-
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		log.Trace("UnpackIntoInterface", "err", err)
+	if err := caller.Call(blockHash, &out, staking.GetContract_Method_GetTotalDepositedBalance()); err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
 func (p *ProofOfStake) DoesDepositorExist(address common.Address, blockHash common.Hash) (bool, error) {
-	err := staking.IsStakingContract()
-	if err != nil {
-		log.Warn("GETH_STAKING_CONTRACT_ADDRESS: Contract1 address is empty")
-		return false, err
-	}
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := staking.GetContract_Method_DoesDepositorExist()
-	abiData, err := p.GetStakingContractAbi()
-	if err != nil {
-		log.Error("DoesDepositorExist abi error", "err", err)
-		return false, err
-	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-
-	// call
-	data, err := abiData.Pack(method, address)
-	if err != nil {
-		log.Error("Unable to pack tx for get depositor exist", "error", err)
-		return false, err
-	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
-
-	msgData := (hexutil.Bytes)(data)
-	result, err := p.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		//Gas:  &gas,
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
+	caller, err := p.stakingCaller()
 	if err != nil {
 		return false, err
 	}
-	if len(result) == 0 {
-		return false, errors.New("no depositor exist found")
-	}
-
-	var ret0 bool
-	out := ret0
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
+	var out bool
+	if err := caller.Call(blockHash, &out, staking.GetContract_Method_DoesDepositorExist(), address); err != nil {
 		return false, err
 	}
-
 	return out, nil
 }
 
 func (p *ProofOfStake) DidDepositorEverExists(address common.Address, blockHash common.Hash) (bool, error) {
-	err := staking.IsStakingContract()
-	if err != nil {
-		log.Warn("GETH_STAKING_CONTRACT_ADDRESS: Contract1 address is empty")
-		return false, err
-	}
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := staking.GetContract_Method_DidDepositorEverExist()
-	abiData, err := p.GetStakingContractAbi()
-	if err != nil {
-		log.Error("DidDepositorEverExists abi error", "err", err)
-		return false, err
-	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-
-	// call
-	data, err := abiData.Pack(method, address)
+	caller, err := p.stakingCaller()
 	if err != nil {
-		log.Error("Unable to pack tx for get depositor ever exists", "error", err)
 		return false, err
 	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
-
-	msgData := (hexutil.Bytes)(data)
-	result, err := p.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		//Gas:  &gas,
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
-	if err != nil {
-		return false, err
-	}
-	if len(result) == 0 {
-		return false, errors.New("no depositor ever exists found")
-	}
-
-	var ret0 bool
-	out := ret0
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
+	var out bool
+	if err := caller.Call(blockHash, &out, staking.GetContract_Method_DidDepositorEverExist(), address); err != nil {
 		return false, err
 	}
-
 	return out, nil
 }
 
 func (p *ProofOfStake) DoesValidatorExist(address common.Address, blockHash common.Hash) (bool, error) {
-	err := staking.IsStakingContract()
-	if err != nil {
-		log.Warn("GETH_STAKING_CONTRACT_ADDRESS: Contract1 address is empty")
-		return false, err
-	}
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := staking.GetContract_Method_DoesValidatorExist()
-	abiData, err := p.GetStakingContractAbi()
-	if err != nil {
-		log.Error("DoesValidatorExist abi error", "err", err)
-		return false, err
-	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-
-	// call
-	data, err := abiData.Pack(method, address)
+	caller, err := p.stakingCaller()
 	if err != nil {
-		log.Error("Unable to pack tx for get validator exist", "error", err)
 		return false, err
 	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
-
-	msgData := (hexutil.Bytes)(data)
-	result, err := p.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		//Gas:  &gas,
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
-	if err != nil {
-		return false, err
-	}
-	if len(result) == 0 {
-		return false, errors.New("no validator exist found")
-	}
-
-	var ret0 bool
-	out := ret0
-
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
+	var out bool
+	if err := caller.Call(blockHash, &out, staking.GetContract_Method_DoesValidatorExist(), address); err != nil {
 		return false, err
 	}
-
 	return out, nil
 }
 
 func (p *ProofOfStake) DidValidatorEverExists(address common.Address, blockHash common.Hash) (bool, error) {
-	err := staking.IsStakingContract()
+	caller, err := p.stakingCaller()
 	if err != nil {
-		log.Warn("GETH_STAKING_CONTRACT_ADDRESS: Contract1 address is empty")
 		return false, err
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := staking.GetContract_Method_DidValidatorEverExist()
-	abiData, err := p.GetStakingContractAbi()
-	if err != nil {
-		log.Error("DidValidatorEverExists abi error", "err", err)
-		return false, err
-	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-
-	// call
-	data, err := abiData.Pack(method, address)
-	if err != nil {
-		log.Error("Unable to pack tx for get validator ever exists", "error", err)
+	var out bool
+	if err := caller.Call(blockHash, &out, staking.GetContract_Method_DidValidatorEverExist(), address); err != nil {
 		return false, err
 	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
+	return out, nil
+}
 
-	msgData := (hexutil.Bytes)(data)
-	result, err := p.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		//Gas:  &gas,
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
+func (p *ProofOfStake) AddDepositorSlashing(blockHash common.Hash,
+	depositor common.Address, slashedAmount *big.Int,
+	state *state.StateDB, header *types.Header) (*big.Int, error) {
+	caller, err := p.stakingCaller()
 	if err != nil {
-		return false, err
-	}
-	if len(result) == 0 {
-		return false, errors.New("no validator ever exists found")
+		return nil, err
 	}
-
-	var ret0 bool
-	out := ret0
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		return false, err
+	var out *big.Int
+	if err := caller.Execute(state, header, &out, staking.GetContract_Method_AddDepositorSlashing(), depositor, slashedAmount); err != nil {
+		return nil, err
 	}
-
 	return out, nil
 }
 
-func encodeCall(abi *abi.ABI, method string, args ...interface{}) ([]byte, error) {
-	return abi.Pack(method, args...)
+// newCaller returns a caller for the system contract at address, executed against the blockchain.
+func (p *ProofOfStake) newCaller(address common.Address, abiData abi.ABI) *systemcontracts.Caller {
+	if p.blockchain == nil {
+		return systemcontracts.NewCaller(nil, address, abiData)
+	}
+	return systemcontracts.NewCaller(p.blockchain, address, abiData)
 }
 
-func (p *ProofOfStake) AddDepositorSlashing(blockHash common.Hash,
-	depositor common.Address, slashedAmount *big.Int,
-	state *state.StateDB, header *types.Header) (*big.Int, error) {
+// stakingCaller returns a caller for the staking contract, using the ABI of the contract version
+// active at the current block.
+func (p *ProofOfStake) stakingCaller() (*systemcontracts.Caller, error) {
 	err := staking.IsStakingContract()
 	if err != nil {
 		log.Warn("DP_STAKING_CONTRACT_ADDRESS: Contract1 address is empty")
 		return nil, err
 	}
-
-	method := staking.GetContract_Method_AddDepositorSlashing()
 	abiData, err := p.GetStakingContractAbi()
 	if err != nil {
-		log.Error("AddDepositorSlashing abi error", "err", err)
+		log.Error("staking contract abi error", "err", err)
 		return nil, err
 	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
+	return p.newCaller(staking.STAKING_CONTRACT_ADDRESS, abiData), nil
+}
 
-	// call
-	data, err := encodeCall(&abiData, method, depositor, slashedAmount)
+// listValidatorAddresses returns the validators registered in the staking contract, or nil if the
+// contract returned no data.
+func (p *ProofOfStake) listValidatorAddresses(blockHash common.Hash) ([]common.Address, error) {
+	caller, err := p.stakingCaller()
 	if err != nil {
-		log.Error("Unable to pack AddDepositorSlashing", "error", err)
 		return nil, err
 	}
-
-	msgData := (hexutil.Bytes)(data)
-	var from common.Address
-	from.CopyFrom(ZERO_ADDRESS)
-	args := ethapi.TransactionArgs{
-		From: &from,
-		To:   &contractAddress,
-		Data: &msgData,
-	}
-
-	msg, err := args.ToMessage(math.MaxUint64)
-	if err != nil {
-		return nil, err
+	var out []common.Address
+	err = caller.Call(blockHash, &out, staking.GetContract_Method_ListValidators())
+	if errors.Is(err, systemcontracts.ErrEmptyResult) {
+		log.Debug("result 0 length")
+		return nil, nil
 	}
-
-	result, err := p.blockchain.ExecuteNoGas(msg, state, header)
 	if err != nil {
 		return nil, err
 	}
-
-	if len(result) == 0 {
-		return nil, errors.New("AddDepositorSlashing result is 0")
-	}
-
-	var out *big.Int
-
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		log.Trace("UnpackIntoInterface", "err", err, "depositor", depositor)
-		return nil, err
-	}
-
 	return out, nil
 }
 
@@ -678,301 +292,74 @@ func (p *ProofOfStake) GetStakingContractAbi() (abi.ABI, error) {
 func (p *ProofOfStake) AddDepositorReward(blockHash common.Hash,
 	depositor common.Address, rewardAmount *big.Int,
 	state *state.StateDB, header *types.Header) (*big.Int, error) {
-	err := staking.IsStakingContract()
+	caller, err := p.stakingCaller()
 	if err != nil {
-		log.Warn("DP_STAKING_CONTRACT_ADDRESS: Contract1 address is empty")
 		return nil, err
 	}
-
-	method := staking.GetContract_Method_AddDepositorReward()
-	abiData, err := p.GetStakingContractAbi()
-	if err != nil {
-		log.Error("AddDepositorReward abi error", "err", err)
-		return nil, err
-	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-
-	// call
-	data, err := encodeCall(&abiData, method, depositor, rewardAmount)
-	if err != nil {
-		log.Error("Unable to pack AddDepositorReward", "error", err)
-		return nil, err
-	}
-
-	msgData := (hexutil.Bytes)(data)
-	var from common.Address
-	from.CopyFrom(ZERO_ADDRESS)
-	args := ethapi.TransactionArgs{
-		From: &from,
-		To:   &contractAddress,
-		Data: &msgData,
-	}
-
-	msg, err := args.ToMessage(math.MaxUint64)
-	if err != nil {
-		return nil, err
-	}
-
-	result, err := p.blockchain.ExecuteNoGas(msg, state, header)
-	if err != nil {
-		return nil, err
-	}
-
-	if len(result) == 0 {
-		return nil, errors.New("AddDepositorReward result is 0")
-	}
-
 	var out *big.Int
-
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		log.Trace("UnpackIntoInterface", "err", err, "depositor", depositor)
+	if err := caller.Execute(state, header, &out, staking.GetContract_Method_AddDepositorReward(), depositor, rewardAmount); err != nil {
 		return nil, err
 	}
-
 	return out, nil
 }
 
 func (p *ProofOfStake) IsValidatorPaused(validator common.Address, blockHash common.Hash) (bool, error) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := staking.GetContract_Method_IsValidationPaused()
-	abiData, err := p.GetStakingContractAbi()
-	if err != nil {
-		log.Error("IsValidatorPaused abi error", "err", err)
-		return false, err
-	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-
-	// call
-	data, err := abiData.Pack(method, validator)
+	caller, err := p.stakingCaller()
 	if err != nil {
-		log.Error("IsValidatorPaused Unable to pack", "error", err)
 		return false, err
 	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
-
-	msgData := (hexutil.Bytes)(data)
-	result, err := p.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
-	if err != nil {
-		log.Error("Call", "err", err)
-		return false, err
-	}
-	if len(result) == 0 {
-		return false, errors.New("IsValidatorPaused result is 0")
-	}
-
 	var out bool
-
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		log.Debug("IsValidatorPaused UnpackIntoInterface", "err", err, "validator", validator)
+	if err := caller.Call(blockHash, &out, staking.GetContract_Method_IsValidationPaused(), validator); err != nil {
 		return false, err
 	}
-
 	return out, nil
 }
 
 func (p *ProofOfStake) GetBalanceOfDepositor(depositor common.Address, blockHash common.Hash) (*big.Int, error) {
-	err := staking.IsStakingContract()
+	caller, err := p.stakingCaller()
 	if err != nil {
-		log.Warn("DP_STAKING_CONTRACT_ADDRESS: Contract1 address is empty")
 		return nil, err
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := staking.GetContract_Method_GetBalanceOfDepositor()
-
-	abiData, err := p.GetStakingContractAbi()
-	if err != nil {
-		log.Error("GetBalanceOfDepositor abi error", "err", err)
-		return nil, err
-	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-
-	// call
-	data, err := abiData.Pack(method, depositor)
-	if err != nil {
-		log.Error("Unable to pack tx for GetBalanceOfDepositor", "error", err)
-		return nil, err
-	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
-
-	msgData := (hexutil.Bytes)(data)
-	result, err := p.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
-	if err != nil {
-		log.Error("Call", "err", err)
-		return nil, err
-	}
-	if len(result) == 0 {
-		return nil, errors.New("GetBalanceOfDepositor result is 0")
-	}
-
 	var out *big.Int
-
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		log.Debug("UnpackIntoInterface", "err", err, "depositor", depositor)
+	if err := caller.Call(blockHash, &out, staking.GetContract_Method_GetBalanceOfDepositor(), depositor); err != nil {
 		return nil, err
 	}
-
 	return out, nil
 }
 
 func (p *ProofOfStake) GetDepositorRewards(depositor common.Address, blockHash common.Hash) (*big.Int, error) {
-	err := staking.IsStakingContract()
-	if err != nil {
-		log.Warn("DP_STAKING_CONTRACT_ADDRESS: Contract1 address is empty")
-		return nil, err
-	}
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := staking.GetContract_Method_GetDepositorRewards()
-
-	abiData, err := p.GetStakingContractAbi()
-	if err != nil {
-		log.Error("GetDepositorRewards abi error", "err", err)
-		return nil, err
-	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-
-	// call
-	data, err := abiData.Pack(method, depositor)
+	caller, err := p.stakingCaller()
 	if err != nil {
-		log.Error("Unable to pack tx for GetDepositorRewards", "error", err)
 		return nil, err
 	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
-
-	msgData := (hexutil.Bytes)(data)
-	result, err := p.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
-	if err != nil {
-		log.Error("Call", "err", err)
-		return nil, err
-	}
-	if len(result) == 0 {
-		return nil, errors.New("GetDepositorRewards result is 0")
-	}
-
 	var out *big.Int
-
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		log.Debug("UnpackIntoInterface", "err", err, "depositor", depositor)
+	if err := caller.Call(blockHash, &out, staking.GetContract_Method_GetDepositorRewards(), depositor); err != nil {
 		return nil, err
 	}
-
 	return out, nil
 }
 
 func (p *ProofOfStake) GetDepositorSlashings(depositor common.Address, blockHash common.Hash) (*big.Int, error) {
-	err := staking.IsStakingContract()
-	if err != nil {
-		log.Warn("DP_STAKING_CONTRACT_ADDRESS: Contract1 address is empty")
-		return nil, err
-	}
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := staking.GetContract_Method_GetDepositorSlashings()
-
-	abiData, err := p.GetStakingContractAbi()
+	caller, err := p.stakingCaller()
 	if err != nil {
-		log.Error("GetDepositorSlashings abi error", "err", err)
 		return nil, err
 	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-
-	// call
-	data, err := abiData.Pack(method, depositor)
-	if err != nil {
-		log.Error("Unable to pack tx for GetDepositorSlashings", "error", err)
-		return nil, err
-	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
-
-	msgData := (hexutil.Bytes)(data)
-	result, err := p.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
-	if err != nil {
-		log.Error("Call", "err", err)
-		return nil, err
-	}
-	if len(result) == 0 {
-		return nil, errors.New("GetDepositorSlashings result is 0")
-	}
-
 	var out *big.Int
-
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		log.Debug("UnpackIntoInterface", "err", err, "depositor", depositor)
+	if err := caller.Call(blockHash, &out, staking.GetContract_Method_GetDepositorSlashings(), depositor); err != nil {
 		return nil, err
 	}
-
 	return out, nil
 }
 
 func (p *ProofOfStake) GetWithdrawalBlock(depositor common.Address, blockHash common.Hash) (*big.Int, error) {
-	err := staking.IsStakingContract()
-	if err != nil {
-		log.Warn("DP_STAKING_CONTRACT_ADDRESS: Contract1 address is empty")
-		return nil, err
-	}
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := staking.GetContract_Method_GetWithdrawalBlock()
-
-	abiData, err := p.GetStakingContractAbi()
-	if err != nil {
-		log.Error("GetWithdrawalBlock abi error", "err", err)
-		return nil, err
-	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-
-	// call
-	data, err := abiData.Pack(method, depositor)
+	caller, err := p.stakingCaller()
 	if err != nil {
-		log.Error("Unable to pack tx for GetWithdrawalBlock", "error", err)
 		return nil, err
 	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
-
-	msgData := (hexutil.Bytes)(data)
-	result, err := p.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
-	if err != nil {
-		log.Error("Call", "err", err)
-		return nil, err
-	}
-	if len(result) == 0 {
-		return nil, errors.New("GetWithdrawalBlock result is 0")
-	}
-
 	var out *big.Int
-
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		log.Debug("UnpackIntoInterface", "err", err, "depositor", depositor)
+	if err := caller.Call(blockHash, &out, staking.GetContract_Method_GetWithdrawalBlock(), depositor); err != nil {
 		return nil, err
 	}
-
 	return out, nil
 }
 
@@ -984,65 +371,18 @@ func (p *ProofOfStake) ListValidators(blockHash common.Hash, blockNumber uint64)
 		log.Debug("depositorCount", "depositorCount", depositorCount)
 	}
 
-	err = staking.IsStakingContract()
-	if err != nil {
-		log.Warn("GETH_STAKING_CONTRACT_ADDRESS: Contract1 address is empty")
-		return nil, err
-	}
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := staking.GetContract_Method_ListValidators()
-	abiData, err := p.GetStakingContractAbi()
-	if err != nil {
-		log.Error("GetValidators error getting abidata", "err", err)
-		return nil, err
-	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-	// call
-	data, err := abiData.Pack(method)
-	if err != nil {
-		log.Error("Unable to pack tx for get filteredValidatorsDepositMap", "error", err)
-		return nil, err
-	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
-
-	msgData := (hexutil.Bytes)(data)
-	result, err := p.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
-	if err != nil {
-		return nil, err
-	}
-	if len(result) == 0 {
-		log.Debug("result 0 length")
-		return nil, nil
-	}
-	_, err = abiData.Unpack(method, result)
-	if err != nil {
-		log.Error("Unpack", "err", err)
-		return nil, err
-	}
-
-	var (
-		ret0 = new([]common.Address)
-	)
-	out := ret0
-
-	if err := abiData.UnpackIntoInterface(out, method, result); err != nil {
-		log.Info("UnpackIntoInterface error")
+	out, err := p.listValidatorAddresses(blockHash)
+	if err != nil || out == nil {
 		return nil, err
 	}
 	var validatorList []*ValidatorDetails
-	for _, val := range *out {
+	for _, val := range out {
 		if val.IsEqualTo(ZERO_ADDRESS) {
 			return nil, errors.New("invalid validator")
 		}
 		log.Debug("GetValidators Validator", "val", val)
 	}
-	for _, val := range *out {
+	for _, val := range out {
 		var validatorDetails *ValidatorDetails
 
 		if blockNumber < STAKING_CONTRACT_V2_CUTOFF_BLOCK {
@@ -1091,6 +431,11 @@ func (p *ProofOfStake) ListValidators(blockHash common.Hash, blockNumber uint64)
 					validatorDetails.BlockProposerResetBlock = hexutil.EncodeUint64(blockProposerResetBlock)
 				}
 			}
+
+			validatorDetails.UnbondingTranches, err = p.getUnbondingTranches(depositor, blockHash)
+			if err != nil {
+				return nil, err
+			}
 		}
 
 		validatorList = append(validatorList, validatorDetails)
@@ -1165,41 +510,12 @@ func (p *ProofOfStake) GetStakingDetailsByValidatorAddress(val common.Address, b
 }
 
 func (p *ProofOfStake) GetStakingDetailsByValidatorAddressV2(val common.Address, blockHash common.Hash) (*ValidatorDetailsV2, error) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := staking.GetContract_Method_GetStakingDetails() //todo: change once initial storage is set
-	abiData, err := p.GetStakingContractAbi()
+	caller, err := p.stakingCaller()
 	if err != nil {
-		log.Error("GetStakingDetails abi error", "err", err)
 		return nil, err
 	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-	// call
-	data, err := abiData.Pack(method, val)
-	if err != nil {
-		log.Error("Unable to pack tx for GetStakingDetails", "error", err)
-		return nil, err
-	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
-	msgData := (hexutil.Bytes)(data)
-	result, err := p.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
-	if err != nil {
-		log.Error("Call", "err", err)
-		return nil, err
-	}
-	if len(result) == 0 {
-		return nil, errors.New("GetStakingDetails result is 0")
-	}
-	var out *ValidatorDetailsV2
-	out = new(ValidatorDetailsV2)
-
-	if err := abiData.UnpackIntoInterface(&out, method, result); err != nil {
-		log.Debug("UnpackIntoInterface", "err", err, "validator", val)
+	out := new(ValidatorDetailsV2)
+	if err := caller.Call(blockHash, &out, staking.GetContract_Method_GetStakingDetails(), val); err != nil {
 		return nil, err
 	}
 	return out, nil
@@ -1207,139 +523,47 @@ func (p *ProofOfStake) GetStakingDetailsByValidatorAddressV2(val common.Address,
 
 func (p *ProofOfStake) SetNilBlock(
 	validator common.Address, state *state.StateDB, header *types.Header) error {
-	method := staking.GetContract_Method_SetNilBlock()
-	abiData, err := p.GetStakingContractAbi()
-	if err != nil {
-		log.Error("SetNilBlock abi error", "err", err)
-		return err
-	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-
-	// call
-	data, err := encodeCall(&abiData, method, validator)
+	caller, err := p.stakingCaller()
 	if err != nil {
-		log.Error("Unable to pack SetNilBlock", "error", err)
 		return err
 	}
-
-	msgData := (hexutil.Bytes)(data)
-	var from common.Address
-	from.CopyFrom(ZERO_ADDRESS)
-	args := ethapi.TransactionArgs{
-		From: &from,
-		To:   &contractAddress,
-		Data: &msgData,
-	}
-
-	msg, err := args.ToMessage(math.MaxUint64)
-	if err != nil {
-		return err
-	}
-
-	_, err = p.blockchain.ExecuteNoGas(msg, state, header)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return caller.Execute(state, header, nil, staking.GetContract_Method_SetNilBlock(), validator)
 }
 
 func (p *ProofOfStake) ResetNilBlock(
 	validator common.Address, state *state.StateDB, header *types.Header) error {
-	method := staking.GetContract_Method_ResetNilBlock()
-	abiData, err := p.GetStakingContractAbi()
-	if err != nil {
-		log.Error("ResetNilBlock abi error", "err", err)
-		return err
-	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-
-	// call
-	data, err := encodeCall(&abiData, method, validator)
-	if err != nil {
-		log.Error("Unable to pack ResetNilBlock", "error", err)
-		return err
-	}
-
-	msgData := (hexutil.Bytes)(data)
-	var from common.Address
-	from.CopyFrom(ZERO_ADDRESS)
-	args := ethapi.TransactionArgs{
-		From: &from,
-		To:   &contractAddress,
-		Data: &msgData,
-	}
-
-	msg, err := args.ToMessage(math.MaxUint64)
-	if err != nil {
-		return err
-	}
-
-	_, err = p.blockchain.ExecuteNoGas(msg, state, header)
+	caller, err := p.stakingCaller()
 	if err != nil {
 		return err
 	}
-
-	return nil
+	return caller.Execute(state, header, nil, staking.GetContract_Method_ResetNilBlock(), validator)
 }
 
 func (p *ProofOfStake) ListValidatorsAsMap(blockHash common.Hash) (map[common.Address]*ValidatorDetailsV2, error) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel() // cancel when we are finished consuming integers
-
-	method := staking.GetContract_Method_ListValidators()
 	abiData, err := staking.GetStakingContractV2_ABI()
 	if err != nil {
 		log.Error("ListValidatorsAsMap error getting abidata", "err", err)
 		return nil, err
 	}
-	contractAddress := common.HexToAddress(staking.GetStakingContract_Address_String())
-	// call
-	data, err := abiData.Pack(method)
-	if err != nil {
-		log.Error("Unable to pack tx for get ListValidatorsAsMap", "error", err)
-		return nil, err
-	}
-	// block
-	blockNr := rpc.BlockNumberOrHashWithHash(blockHash, false)
-
-	msgData := (hexutil.Bytes)(data)
-	result, err := p.ethAPI.Call(ctx, ethapi.TransactionArgs{
-		To:   &contractAddress,
-		Data: &msgData,
-	}, blockNr, nil)
-	if err != nil {
-		return nil, err
-	}
-	if len(result) == 0 {
+	var out []common.Address
+	err = p.newCaller(staking.STAKING_CONTRACT_ADDRESS, abiData).Call(blockHash, &out, staking.GetContract_Method_ListValidators())
+	if errors.Is(err, systemcontracts.ErrEmptyResult) {
 		log.Debug("result 0 length")
 		return nil, nil
 	}
-	_, err = abiData.Unpack(method, result)
 	if err != nil {
-		log.Error("Unpack", "err", err)
-		return nil, err
-	}
-
-	var (
-		ret0 = new([]common.Address)
-	)
-	out := ret0
-
-	if err := abiData.UnpackIntoInterface(out, method, result); err != nil {
-		log.Info("UnpackIntoInterface error")
 		return nil, err
 	}
 	var validatorMap map[common.Address]*ValidatorDetailsV2
 	validatorMap = make(map[common.Address]*ValidatorDetailsV2)
 
-	for _, val := range *out {
+	for _, val := range out {
 		if val.IsEqualTo(ZERO_ADDRESS) {
 			return nil, errors.New("invalid validator")
 		}
 		log.Debug("ListValidatorsAsMap Validator", "val", val)
 	}
-	for _, val := range *out {
+	for _, val := range out {
 
 		depositor, err := p.GetDepositorOfValidator(val, blockHash)
 		if err != nil {
@@ -0,0 +1,309 @@
+package proofofstake
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/consensus"
+	"github.com/QuantumCoinProject/qc/core"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/eth/protocols/eth"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/rlp"
+	"sort"
+	"time"
+)
+
+var (
+	VALIDATOR_STATS_SECTION_SIZE = uint64(4096)
+	VALIDATOR_STATS_CONFIRMS     = uint64(16)
+
+	// Maximum number of blocks that are parsed directly from headers when serving a stats request,
+	// for the parts of the range that are not covered by an indexed section
+	VALIDATOR_STATS_MAX_UNINDEXED_BLOCKS = uint64(2 * 4096)
+
+	validatorStatsThrottling = 100 * time.Millisecond
+
+	errValidatorStatsRange      = errors.New("invalid block range")
+	errValidatorStatsNotIndexed = errors.New("block range is not indexed yet")
+)
+
+// ValidatorStats are the participation counters of a validator over a range of blocks.
+type ValidatorStats struct {
+	Validator       common.Address
+	ProposalsMade   uint64 //blocks proposed that got an ok vote
+	ProposalsMissed uint64 //rounds in which the validator was the block proposer, but did not get its proposal through
+	VotesSigned     uint64 //blocks in which the validator signed an ack, precommit or commit packet
+	Slashes         uint64
+}
+
+func (s *ValidatorStats) add(other *ValidatorStats) {
+	s.ProposalsMade = s.ProposalsMade + other.ProposalsMade
+	s.ProposalsMissed = s.ProposalsMissed + other.ProposalsMissed
+	s.VotesSigned = s.VotesSigned + other.VotesSigned
+	s.Slashes = s.Slashes + other.Slashes
+}
+
+type validatorStatsMap map[common.Address]*ValidatorStats
+
+func (m validatorStatsMap) get(validator common.Address) *ValidatorStats {
+	stats, ok := m[validator]
+	if ok == false {
+		stats = &ValidatorStats{Validator: validator}
+		m[validator] = stats
+	}
+	return stats
+}
+
+func (m validatorStatsMap) merge(list []*ValidatorStats) {
+	for _, stats := range list {
+		m.get(stats.Validator).add(stats)
+	}
+}
+
+func (m validatorStatsMap) list() []*ValidatorStats {
+	list := make([]*ValidatorStats, 0, len(m))
+	for _, stats := range m {
+		list = append(list, stats)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return bytes.Compare(list[i].Validator.Bytes(), list[j].Validator.Bytes()) < 0
+	})
+	return list
+}
+
+func consensusPacketType(packet *eth.ConsensusPacket) (ConsensusPacketType, error) {
+	if len(packet.ConsensusData) < 2 {
+		return 0, InvalidPacketErr
+	}
+	if packet.ConsensusData[0] >= MinConsensusNetworkProtocolVersion {
+		return ConsensusPacketType(packet.ConsensusData[1]), nil
+	}
+	return ConsensusPacketType(packet.ConsensusData[0]), nil
+}
+
+// collectValidatorStats adds the participation of each validator in the given block to the stats.
+func collectValidatorStats(header *types.Header, stats validatorStatsMap) error {
+	blockNumber := header.Number.Uint64()
+	if blockNumber == 0 {
+		return nil
+	}
+
+	blockConsensusData := &BlockConsensusData{}
+	err := rlp.DecodeBytes(header.ConsensusData, blockConsensusData)
+	if err != nil {
+		return err
+	}
+
+	if blockConsensusData.VoteType == VOTE_TYPE_OK {
+		stats.get(blockConsensusData.BlockProposer).ProposalsMade++
+	}
+
+	for _, val := range blockConsensusData.SlashedBlockProposers {
+		valStats := stats.get(val)
+		valStats.ProposalsMissed++
+		if blockConsensusData.Round == 1 && blockNumber >= slashStartBlockNumber {
+			valStats.Slashes++
+		}
+	}
+
+	if len(header.UnhashedConsensusData) == 0 {
+		return nil
+	}
+	blockAdditionalConsensusData := &BlockAdditionalConsensusData{}
+	err = rlp.DecodeBytes(header.UnhashedConsensusData, blockAdditionalConsensusData)
+	if err != nil {
+		return err
+	}
+
+	voters := make(map[common.Address]bool)
+	for i := 0; i < len(blockAdditionalConsensusData.ConsensusPackets); i++ {
+		packet := &blockAdditionalConsensusData.ConsensusPackets[i]
+		packetType, err := consensusPacketType(packet)
+		if err != nil || packetType == CONSENSUS_PACKET_TYPE_PROPOSE_BLOCK {
+			continue
+		}
+		_, signer, err := parsePacket(packet)
+		if err != nil {
+			log.Trace("collectValidatorStats parsePacket", "blockNumber", blockNumber, "err", err)
+			continue
+		}
+		voters[signer] = true
+	}
+	if cert := blockAdditionalConsensusData.CommitCertificate; cert != nil {
+		signers, err := cert.RecoverSigners(header.ParentHash, getCommitHash(blockConsensusData.PrecommitHash))
+		if err != nil {
+			log.Trace("collectValidatorStats RecoverSigners", "blockNumber", blockNumber, "err", err)
+		}
+		for _, signer := range signers {
+			voters[signer] = true
+		}
+	}
+	for voter := range voters {
+		stats.get(voter).VotesSigned++
+	}
+
+	return nil
+}
+
+// ValidatorStatsIndexer implements core.ChainIndexerBackend, aggregating the validator
+// participation of each section of the canonical chain.
+type ValidatorStatsIndexer struct {
+	db      ethdb.Database
+	section uint64
+	head    common.Hash
+	stats   validatorStatsMap
+}
+
+// NewValidatorStatsIndexer returns a chain indexer that aggregates validator participation statistics.
+func NewValidatorStatsIndexer(db ethdb.Database, size, confirms uint64) *core.ChainIndexer {
+	backend := &ValidatorStatsIndexer{
+		db: db,
+	}
+	table := rawdb.NewTable(db, string(rawdb.ValidatorStatsIndexPrefix))
+
+	return core.NewChainIndexer(db, table, backend, size, confirms, validatorStatsThrottling, "validatorstats")
+}
+
+// Reset implements core.ChainIndexerBackend, starting a new section.
+func (v *ValidatorStatsIndexer) Reset(ctx context.Context, section uint64, lastSectionHead common.Hash) error {
+	v.section, v.head, v.stats = section, common.Hash{}, make(validatorStatsMap)
+	return nil
+}
+
+// Process implements core.ChainIndexerBackend, adding the participation of a block to the section.
+func (v *ValidatorStatsIndexer) Process(ctx context.Context, header *types.Header) error {
+	err := collectValidatorStats(header, v.stats)
+	if err != nil {
+		return err
+	}
+	v.head = header.Hash()
+	return nil
+}
+
+// Commit implements core.ChainIndexerBackend, writing out the section stats.
+func (v *ValidatorStatsIndexer) Commit() error {
+	data, err := rlp.EncodeToBytes(v.stats.list())
+	if err != nil {
+		return err
+	}
+	rawdb.WriteValidatorStats(v.db, v.section, v.head, data)
+	return nil
+}
+
+// Prune returns an empty error since we don't support pruning here.
+func (v *ValidatorStatsIndexer) Prune(threshold uint64) error {
+	return nil
+}
+
+// StartValidatorStatsIndexer starts indexing validator participation of the chain.
+func (c *ProofOfStake) StartValidatorStatsIndexer(chain core.ChainIndexerChain) {
+	c.statsIndexer = NewValidatorStatsIndexer(c.db, VALIDATOR_STATS_SECTION_SIZE, VALIDATOR_STATS_CONFIRMS)
+	if anchor := rawdb.ReadCheckpointAnchor(c.db); anchor != nil {
+		c.AnchorValidatorStatsIndexer(*anchor, rawdb.ReadCanonicalHash(c.db, *anchor))
+	}
+	c.statsIndexer.Start(chain)
+}
+
+// AnchorValidatorStatsIndexer marks the sections below the checkpoint block fast
+// sync started from as indexed, since the chain holds no headers for them.
+func (c *ProofOfStake) AnchorValidatorStatsIndexer(number uint64, hash common.Hash) {
+	if c.statsIndexer == nil || (number+1)%VALIDATOR_STATS_SECTION_SIZE != 0 {
+		return
+	}
+	c.statsIndexer.AddCheckpoint((number+1)/VALIDATOR_STATS_SECTION_SIZE-1, hash)
+}
+
+func (c *ProofOfStake) readValidatorStatsSection(section uint64) ([]*ValidatorStats, error) {
+	head := c.statsIndexer.SectionHead(section)
+	if head == (common.Hash{}) {
+		return nil, errValidatorStatsNotIndexed
+	}
+	data, err := rawdb.ReadValidatorStats(c.db, section, head)
+	if err != nil {
+		return nil, err
+	}
+	var list []*ValidatorStats
+	err = rlp.DecodeBytes(data, &list)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetValidatorStats returns the participation of all validators between fromBlock and toBlock, both inclusive.
+// Fully indexed sections are read from the database; the rest of the range is parsed from the headers.
+func (c *ProofOfStake) GetValidatorStats(chain consensus.ChainHeaderReader, fromBlock uint64, toBlock uint64) (map[common.Address]*ValidatorStats, error) {
+	if fromBlock > toBlock {
+		return nil, errValidatorStatsRange
+	}
+
+	var indexedSections uint64
+	if c.statsIndexer != nil {
+		indexedSections, _, _ = c.statsIndexer.Sections()
+	}
+
+	stats := make(validatorStatsMap)
+	unindexedBlocks := uint64(0)
+	blockNumber := fromBlock
+	for blockNumber <= toBlock {
+		section := blockNumber / VALIDATOR_STATS_SECTION_SIZE
+		sectionEnd := (section+1)*VALIDATOR_STATS_SECTION_SIZE - 1
+		if blockNumber%VALIDATOR_STATS_SECTION_SIZE == 0 && sectionEnd <= toBlock && section < indexedSections {
+			list, err := c.readValidatorStatsSection(section)
+			if err == nil {
+				stats.merge(list)
+				blockNumber = sectionEnd + 1
+				continue
+			}
+			log.Debug("readValidatorStatsSection", "section", section, "err", err)
+		}
+
+		unindexedBlocks++
+		if unindexedBlocks > VALIDATOR_STATS_MAX_UNINDEXED_BLOCKS {
+			return nil, errValidatorStatsNotIndexed
+		}
+		header := chain.GetHeaderByNumber(blockNumber)
+		if header == nil {
+			return nil, errUnknownBlock
+		}
+		err := collectValidatorStats(header, stats)
+		if err != nil {
+			return nil, err
+		}
+		blockNumber++
+	}
+
+	return stats, nil
+}
+
+type ValidatorStatsDetails struct {
+	Validator        common.Address `json:"validator"     gencodec:"required"`
+	FromBlock        string         `json:"fromBlock"     gencodec:"required"`
+	ToBlock          string         `json:"toBlock"     gencodec:"required"`
+	BlockCount       string         `json:"blockCount"     gencodec:"required"`
+	ProposalsMade    string         `json:"proposalsMade"     gencodec:"required"`
+	ProposalsMissed  string         `json:"proposalsMissed"     gencodec:"required"`
+	VotesSigned      string         `json:"votesSigned"     gencodec:"required"`
+	Slashes          string         `json:"slashes"     gencodec:"required"`
+	UptimePercentage float64        `json:"uptimePercentage"     gencodec:"required"`
+}
+
+func newValidatorStatsDetails(validator common.Address, fromBlock uint64, toBlock uint64, stats *ValidatorStats) *ValidatorStatsDetails {
+	blockCount := toBlock - fromBlock + 1
+	return &ValidatorStatsDetails{
+		Validator:        validator,
+		FromBlock:        hexutil.EncodeUint64(fromBlock),
+		ToBlock:          hexutil.EncodeUint64(toBlock),
+		BlockCount:       hexutil.EncodeUint64(blockCount),
+		ProposalsMade:    hexutil.EncodeUint64(stats.ProposalsMade),
+		ProposalsMissed:  hexutil.EncodeUint64(stats.ProposalsMissed),
+		VotesSigned:      hexutil.EncodeUint64(stats.VotesSigned),
+		Slashes:          hexutil.EncodeUint64(stats.Slashes),
+		UptimePercentage: float64(stats.VotesSigned) * 100 / float64(blockCount),
+	}
+}
@@ -0,0 +1,58 @@
+package proofofstake
+
+import (
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/rlp"
+	"math/big"
+	"testing"
+)
+
+func newStatsTestHeader(t *testing.T, blockNumber uint64, data *BlockConsensusData) *types.Header {
+	consensusData, err := rlp.EncodeToBytes(data)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	return &types.Header{Number: new(big.Int).SetUint64(blockNumber), ConsensusData: consensusData}
+}
+
+func TestCollectValidatorStats(t *testing.T) {
+	val1 := common.HexToAddress("0x0000000000000000000000000000000000000000000000000000000000000011")
+	val2 := common.HexToAddress("0x0000000000000000000000000000000000000000000000000000000000000022")
+
+	stats := make(validatorStatsMap)
+	headers := []*types.Header{
+		newStatsTestHeader(t, slashStartBlockNumber, &BlockConsensusData{BlockProposer: val1, VoteType: VOTE_TYPE_OK, Round: 1}),
+		newStatsTestHeader(t, slashStartBlockNumber+1, &BlockConsensusData{BlockProposer: val1, VoteType: VOTE_TYPE_NIL, Round: 1,
+			SlashedBlockProposers: []common.Address{val2}}),
+		newStatsTestHeader(t, slashStartBlockNumber+2, &BlockConsensusData{BlockProposer: val2, VoteType: VOTE_TYPE_OK, Round: 2,
+			SlashedBlockProposers: []common.Address{val1}}),
+	}
+	for _, header := range headers {
+		if err := collectValidatorStats(header, stats); err != nil {
+			t.Fatalf("failed %v", err)
+		}
+	}
+
+	if stats[val1].ProposalsMade != 1 || stats[val1].ProposalsMissed != 1 || stats[val1].Slashes != 0 {
+		t.Fatalf("failed %v", stats[val1])
+	}
+	if stats[val2].ProposalsMade != 1 || stats[val2].ProposalsMissed != 1 || stats[val2].Slashes != 1 {
+		t.Fatalf("failed %v", stats[val2])
+	}
+
+	data, err := rlp.EncodeToBytes(stats.list())
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	var list []*ValidatorStats
+	if err = rlp.DecodeBytes(data, &list); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	merged := make(validatorStatsMap)
+	merged.merge(list)
+	merged.merge(list)
+	if merged[val2].ProposalsMissed != 2 || merged[val2].Slashes != 2 || len(merged) != 2 {
+		t.Fatalf("failed %v", merged[val2])
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/QuantumCoinProject/qc/crypto/crosssign"
 	"github.com/QuantumCoinProject/qc/log"
 	"github.com/QuantumCoinProject/qc/systemcontracts/conversion"
+	"sort"
 	"strings"
 )
 
@@ -1060,12 +1061,7 @@ func VerifyDataAndGetEthereumAddress(quantumAddress common.Address, data []byte)
 
 	ethSignature := string(data[196:328])
 
-	crossSignDetails := &crosssign.ConversionSignDetails{
-		EthAddress:        strings.ToLower(ethAddress),
-		EthereumSignature: ethSignature,
-		QuantumAddress:    strings.ToLower(quantumAddress.Hex()),
-	}
-	_, err := crosssign.VerifyConversion(crossSignDetails)
+	err := VerifyConversionRequest(quantumAddress, ethAddress, ethSignature)
 	if err != nil {
 		return "", err
 	}
@@ -1077,6 +1073,33 @@ func VerifyDataAndGetEthereumAddress(quantumAddress common.Address, data []byte)
 	return ethAddress, nil
 }
 
+// VerifyConversionRequest verifies that the ethereum signature authorizes converting the snapshot
+// amount of ethAddress to quantumAddress.
+func VerifyConversionRequest(quantumAddress common.Address, ethAddress string, ethSignature string) error {
+	crossSignDetails := &crosssign.ConversionSignDetails{
+		EthAddress:        strings.ToLower(ethAddress),
+		EthereumSignature: ethSignature,
+		QuantumAddress:    strings.ToLower(quantumAddress.Hex()),
+	}
+	_, err := crosssign.VerifyConversion(crossSignDetails)
+	return err
+}
+
+func IsSnapshotAddress(ethAddress string) bool {
+	_, ok := SnapshotMap[strings.ToLower(ethAddress)]
+	return ok
+}
+
+// SnapshotAddresses returns the ethereum addresses of the snapshot in a deterministic order.
+func SnapshotAddresses() []string {
+	addresses := make([]string, 0, len(SnapshotMap))
+	for ethAddress := range SnapshotMap {
+		addresses = append(addresses, ethAddress)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
 func allZero(b []byte) bool {
 	for _, byte := range b {
 		if byte != 0 {
@@ -652,6 +652,38 @@ func (bc *BlockChain) FastSyncCommitHead(hash common.Hash) error {
 	return nil
 }
 
+// InsertCheckpointAnchor writes a trusted checkpoint block, along with its
+// receipts and total difficulty, as the head of a chain that holds only the
+// genesis block. Fast sync then imports the headers and blocks after the
+// checkpoint on top of it, without downloading the history before it.
+func (bc *BlockChain) InsertCheckpointAnchor(block *types.Block, receipts types.Receipts, td *big.Int) error {
+	bc.chainmu.Lock()
+	defer bc.chainmu.Unlock()
+
+	if head := bc.CurrentHeader(); head.Number.Uint64() != 0 {
+		return fmt.Errorf("chain not empty, head header #%d", head.Number)
+	}
+	batch := bc.db.NewBatch()
+	rawdb.WriteTd(batch, block.Hash(), block.NumberU64(), td)
+	rawdb.WriteBlock(batch, block)
+	rawdb.WriteReceipts(batch, block.Hash(), block.NumberU64(), receipts)
+	rawdb.WriteTxLookupEntriesByBlock(batch, block)
+	rawdb.WriteCanonicalHash(batch, block.Hash(), block.NumberU64())
+	rawdb.WriteHeadHeaderHash(batch, block.Hash())
+	rawdb.WriteHeadFastBlockHash(batch, block.Hash())
+	rawdb.WriteTxIndexTail(batch, block.NumberU64())
+	rawdb.WriteCheckpointAnchor(batch, block.NumberU64())
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	bc.hc.SetCurrentHeader(block.Header())
+	bc.currentFastBlock.Store(block)
+	headFastBlockGauge.Update(int64(block.NumberU64()))
+
+	log.Info("Anchored chain at checkpoint", "number", block.Number(), "hash", block.Hash())
+	return nil
+}
+
 // GasLimit returns the gas limit of the current HEAD block.
 func (bc *BlockChain) GasLimit() uint64 {
 	return bc.CurrentBlock().GasLimit()
@@ -2286,29 +2318,39 @@ func (bc *BlockChain) maintainTxIndex(ancients uint64) {
 	indexBlocks := func(tail *uint64, head uint64, done chan struct{}) {
 		defer func() { done <- struct{}{} }()
 
+		// Blocks below the checkpoint fast sync started from are not stored, so
+		// the index never extends below it.
+		var floor uint64
+		if anchor := rawdb.ReadCheckpointAnchor(bc.db); anchor != nil {
+			floor = *anchor
+		}
 		// If the user just upgraded Geth to a new version which supports transaction
 		// index pruning, write the new tail and remove anything older.
 		if tail == nil {
 			if bc.txLookupLimit == 0 || head < bc.txLookupLimit {
 				// Nothing to delete, write the tail and return
-				rawdb.WriteTxIndexTail(bc.db, 0)
+				rawdb.WriteTxIndexTail(bc.db, floor)
 			} else {
 				// Prune all stale tx indices and record the tx index tail
-				rawdb.UnindexTransactions(bc.db, 0, head-bc.txLookupLimit+1, bc.quit)
+				rawdb.UnindexTransactions(bc.db, floor, head-bc.txLookupLimit+1, bc.quit)
 			}
 			return
 		}
 		// If a previous indexing existed, make sure that we fill in any missing entries
 		if bc.txLookupLimit == 0 || head < bc.txLookupLimit {
-			if *tail > 0 {
-				rawdb.IndexTransactions(bc.db, 0, *tail, bc.quit)
+			if *tail > floor {
+				rawdb.IndexTransactions(bc.db, floor, *tail, bc.quit)
 			}
 			return
 		}
 		// Update the transaction index to the new chain state
 		if head-bc.txLookupLimit+1 < *tail {
 			// Reindex a part of missing indices and rewind index tail to HEAD-limit
-			rawdb.IndexTransactions(bc.db, head-bc.txLookupLimit+1, *tail, bc.quit)
+			from := head - bc.txLookupLimit + 1
+			if from < floor {
+				from = floor
+			}
+			rawdb.IndexTransactions(bc.db, from, *tail, bc.quit)
 		} else {
 			// Unindex a part of stale indices and forward index tail to HEAD-limit
 			rawdb.UnindexTransactions(bc.db, *tail, head-bc.txLookupLimit+1, bc.quit)
@@ -2572,3 +2614,29 @@ func (bc *BlockChain) ExecuteNoGas(msg Message, state *state.StateDB, header *ty
 
 	return result.Return(), result.Err
 }
+
+// ExecuteSystemCall applies a privileged call from ZERO_ADDRESS to a system contract on the given
+// state. The call is not charged gas and its state changes are kept.
+func (bc *BlockChain) ExecuteSystemCall(to common.Address, data []byte, state *state.StateDB, header *types.Header) ([]byte, error) {
+	msg := types.NewMessage(common.ZERO_ADDRESS, &to, 0, new(big.Int), math.MaxUint64, new(big.Int), data, nil, false)
+	return bc.ExecuteNoGas(msg, state, header)
+}
+
+// CallContract executes a read-only call from ZERO_ADDRESS on the given state, capped at gas.
+// The state is modified by the call and should be discarded afterwards.
+func (bc *BlockChain) CallContract(to common.Address, data []byte, gas uint64, state *state.StateDB, header *types.Header) ([]byte, error) {
+	msg := types.NewMessage(common.ZERO_ADDRESS, &to, 0, new(big.Int), gas, new(big.Int), data, nil, false)
+	txContext := NewEVMTxContext(msg)
+	context := NewEVMBlockContext(header, bc, nil)
+	evm := vm.NewEVM(context, txContext, state, bc.Config(), vm.Config{})
+
+	gp := new(GasPool).AddGas(math.MaxUint64)
+	result, err := ApplyMessage(evm, msg, gp)
+	if err != nil {
+		return nil, fmt.Errorf("err: %w (supplied gas %d)", err, gas)
+	}
+	if len(result.Revert()) > 0 {
+		return nil, NewRevertError(result)
+	}
+	return result.Return(), result.Err
+}
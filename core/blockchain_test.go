@@ -0,0 +1,71 @@
+package core
+
+import (
+	"github.com/QuantumCoinProject/qc/consensus/mockconsensus"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/core/vm"
+	"github.com/QuantumCoinProject/qc/params"
+	"testing"
+)
+
+// Tests that a chain anchored at a checkpoint block imports the headers and
+// blocks after it without the history before it.
+func TestInsertCheckpointAnchor(t *testing.T) {
+	var (
+		gspec             = &Genesis{Config: params.TestChainConfig}
+		sourceDb          = rawdb.NewMemoryDatabase()
+		genesis           = gspec.MustCommit(sourceDb)
+		blocks, receipts  = GenerateChain(params.TestChainConfig, genesis, mockconsensus.NewMockConsensus(), sourceDb, 20, nil)
+		anchor            = blocks[9]
+		headers           = make([]*types.Header, len(blocks))
+		source, sourceErr = NewBlockChain(sourceDb, nil, params.TestChainConfig, mockconsensus.NewMockConsensus(), vm.Config{}, nil, nil)
+	)
+	if sourceErr != nil {
+		t.Fatalf("failed %v", sourceErr)
+	}
+	defer source.Stop()
+	if _, err := source.InsertChain(blocks); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+
+	db := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(db)
+	chain, err := NewBlockChain(db, nil, params.TestChainConfig, mockconsensus.NewMockConsensus(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	defer chain.Stop()
+
+	if err := chain.InsertCheckpointAnchor(anchor, receipts[9], source.GetTd(anchor.Hash(), anchor.NumberU64())); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if chain.CurrentHeader().Hash() != anchor.Hash() || chain.CurrentFastBlock().Hash() != anchor.Hash() {
+		t.Fatalf("failed %v %v", chain.CurrentHeader().Number, chain.CurrentFastBlock().Number())
+	}
+	if number := rawdb.ReadCheckpointAnchor(db); number == nil || *number != anchor.NumberU64() {
+		t.Fatalf("failed %v", number)
+	}
+	if chain.HasHeader(blocks[8].Hash(), blocks[8].NumberU64()) {
+		t.Fatalf("failed")
+	}
+
+	if _, err := chain.InsertHeaderChain(headers[10:], 1); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if _, err := chain.InsertReceiptChain(blocks[10:], receipts[10:], 0); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	head := blocks[len(blocks)-1]
+	if chain.CurrentFastBlock().Hash() != head.Hash() || chain.GetTd(head.Hash(), head.NumberU64()).Cmp(source.GetTd(head.Hash(), head.NumberU64())) != 0 {
+		t.Fatalf("failed %v", chain.CurrentFastBlock().Number())
+	}
+
+	//Only an empty chain can be anchored
+	if err := chain.InsertCheckpointAnchor(anchor, receipts[9], source.GetTd(anchor.Hash(), anchor.NumberU64())); err == nil {
+		t.Fatalf("failed")
+	}
+}
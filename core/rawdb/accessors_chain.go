@@ -269,6 +269,26 @@ func WriteFastTxLookupLimit(db ethdb.KeyValueWriter, number uint64) {
 	}
 }
 
+// ReadCheckpointAnchor retrieves the number of the checkpoint block fast sync
+// started from. Blocks below it, other than the genesis block, are not stored.
+// If the node synced from the genesis block, the anchor will always be nil.
+func ReadCheckpointAnchor(db ethdb.KeyValueReader) *uint64 {
+	data, _ := db.Get(checkpointAnchorKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteCheckpointAnchor stores the number of the checkpoint block fast sync
+// started from.
+func WriteCheckpointAnchor(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Put(checkpointAnchorKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store the checkpoint anchor", "err", err)
+	}
+}
+
 // ReadHeaderRLP retrieves a block header in its raw RLP database encoding.
 func ReadHeaderRLP(db ethdb.Reader, hash common.Hash, number uint64) rlp.RawValue {
 	// First try to look up the data in ancient database. Extra hash
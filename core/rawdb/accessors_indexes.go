@@ -175,3 +175,17 @@ func DeleteBloombits(db ethdb.Database, bit uint, from uint64, to uint64) {
 		log.Crit("Failed to delete bloom bits", "err", it.Error())
 	}
 }
+
+// ReadValidatorStats retrieves the encoded validator statistics belonging to the
+// given section.
+func ReadValidatorStats(db ethdb.KeyValueReader, section uint64, head common.Hash) ([]byte, error) {
+	return db.Get(validatorStatsKey(section, head))
+}
+
+// WriteValidatorStats stores the encoded validator statistics belonging to the
+// given section.
+func WriteValidatorStats(db ethdb.KeyValueWriter, section uint64, head common.Hash, stats []byte) {
+	if err := db.Put(validatorStatsKey(section, head), stats); err != nil {
+		log.Crit("Failed to store validator stats", "err", err)
+	}
+}
@@ -69,6 +69,9 @@ var (
 	// fastTxLookupLimitKey tracks the transaction lookup limit during fast sync.
 	fastTxLookupLimitKey = []byte("FastTransactionLookupLimit")
 
+	// checkpointAnchorKey tracks the checkpoint block fast sync started from, if not the genesis block.
+	checkpointAnchorKey = []byte("CheckpointAnchor")
+
 	// badBlockKey tracks the list of bad blocks seen by local
 	badBlockKey = []byte("InvalidBlock")
 
@@ -86,6 +89,7 @@ var (
 
 	txLookupPrefix        = []byte("l") // txLookupPrefix + hash -> transaction/receipt lookup metadata
 	bloomBitsPrefix       = []byte("B") // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash -> bloom bits
+	validatorStatsPrefix  = []byte("V") // validatorStatsPrefix + section (uint64 big endian) + hash -> validator stats
 	SnapshotAccountPrefix = []byte("a") // SnapshotAccountPrefix + account hash -> account trie value
 	SnapshotStoragePrefix = []byte("o") // SnapshotStoragePrefix + account hash + storage hash -> storage trie value
 	CodePrefix            = []byte("c") // CodePrefix + code hash -> account code
@@ -94,7 +98,8 @@ var (
 	configPrefix   = []byte("ethereum-config-") // config prefix for the db
 
 	// Chain index prefixes (use `i` + single byte to avoid mixing data types).
-	BloomBitsIndexPrefix = []byte("iB") // BloomBitsIndexPrefix is the data table of a chain indexer to track its progress
+	BloomBitsIndexPrefix      = []byte("iB") // BloomBitsIndexPrefix is the data table of a chain indexer to track its progress
+	ValidatorStatsIndexPrefix = []byte("iV") // ValidatorStatsIndexPrefix is the data table of the validator stats chain indexer
 
 	preimageCounter    = metrics.NewRegisteredCounter("db/preimage/total", nil)
 	preimageHitCounter = metrics.NewRegisteredCounter("db/preimage/hits", nil)
@@ -207,6 +212,15 @@ func bloomBitsKey(bit uint, section uint64, hash common.Hash) []byte {
 	return key
 }
 
+// validatorStatsKey = validatorStatsPrefix + section (uint64 big endian) + hash
+func validatorStatsKey(section uint64, hash common.Hash) []byte {
+	key := append(append(validatorStatsPrefix, make([]byte, 8)...), hash.Bytes()...)
+
+	binary.BigEndian.PutUint64(key[1:], section)
+
+	return key
+}
+
 // preimageKey = preimagePrefix + hash
 func preimageKey(hash common.Hash) []byte {
 	return append(preimagePrefix, hash.Bytes()...)
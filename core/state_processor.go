@@ -23,6 +23,7 @@ import (
 	"github.com/QuantumCoinProject/qc/consensus/misc"
 	"github.com/QuantumCoinProject/qc/conversionutil"
 	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/systemcontracts/governance"
 	"math/big"
 
 	"github.com/QuantumCoinProject/qc/common"
@@ -89,6 +90,8 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 			return nil, nil, 0, fmt.Errorf("could not apply tx %d [%v]: %w", i, tx.Hash().Hex(), err)
 		}
 
+		overrideGovernanceGasPrice(statedb, msg)
+
 		vmConfig := cfg
 		isGasExemptTxn, err := conversionutil.IsGasExemptTxn(tx, signer)
 		if err == nil && isGasExemptTxn {
@@ -171,6 +174,37 @@ func applyTransaction(msg types.Message, config *params.ChainConfig, bc ChainCon
 	return receipt, err
 }
 
+// GovernanceGasPrice returns the gas tier price set through governance in the given state, or nil
+// if governance is not active yet and transactions are charged their own gas price.
+func GovernanceGasPrice(statedb governance.StateDB) *big.Int {
+	if governance.IsInitialized(statedb) == false {
+		return nil
+	}
+	gasTierPrice, err := governance.GetParameter(statedb, governance.PARAMETER_GAS_TIER_PRICE)
+	if err != nil {
+		log.Error("GovernanceGasPrice", "err", err)
+		return nil
+	}
+	return gasTierPrice
+}
+
+// TxCost returns the value of a transaction plus its gas at the given gas price, or at the gas
+// price of the transaction if gasPrice is nil.
+func TxCost(tx *types.Transaction, gasPrice *big.Int) *big.Int {
+	if gasPrice == nil {
+		return tx.Cost()
+	}
+	total := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(tx.Gas()))
+	return total.Add(total, tx.Value())
+}
+
+// overrideGovernanceGasPrice charges the gas tier price set through governance, once it is active.
+func overrideGovernanceGasPrice(statedb *state.StateDB, msg types.Message) {
+	if gasTierPrice := GovernanceGasPrice(statedb); gasTierPrice != nil {
+		msg.OverrideGasPrice(gasTierPrice)
+	}
+}
+
 // ApplyTransaction attempts to apply a transaction to the given state database
 // and uses the input parameters for its environment. It returns the receipt
 // for the transaction, gas used and an error if the transaction failed,
@@ -186,6 +220,8 @@ func ApplyTransaction(config *params.ChainConfig, bc ChainContext, author *commo
 		return nil, err
 	}
 
+	overrideGovernanceGasPrice(statedb, msg)
+
 	vmConfig := cfg
 	if isGasExemptTxn {
 		vmConfig = *cfg.DeepCopy()
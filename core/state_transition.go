@@ -22,6 +22,9 @@ import (
 	"github.com/QuantumCoinProject/qc/core/types"
 	"github.com/QuantumCoinProject/qc/core/vm"
 	"github.com/QuantumCoinProject/qc/params"
+	"github.com/QuantumCoinProject/qc/systemcontracts/conversion"
+	"github.com/QuantumCoinProject/qc/systemcontracts/governance"
+	"github.com/QuantumCoinProject/qc/systemcontracts/unbonding"
 	"math"
 	"math/big"
 )
@@ -243,6 +246,22 @@ func (st *StateTransition) TransitionDb() (*ExecutionResult, error) {
 		return nil, err
 	}
 	msg := st.msg
+
+	// Governance transactions are not payable, any value sent would be locked in the contract address
+	if msg.Value().Sign() > 0 && msg.To() != nil && msg.To().IsEqualTo(governance.GOVERNANCE_CONTRACT_ADDRESS) &&
+		governance.IsInitialized(st.state) {
+		return nil, fmt.Errorf("%w: address %v", ErrGovernanceValue, msg.From().Hex())
+	}
+	// Unbonding transactions are not payable either
+	if msg.Value().Sign() > 0 && msg.To() != nil && msg.To().IsEqualTo(unbonding.UNBONDING_CONTRACT_ADDRESS) &&
+		st.evm.Context.BlockNumber.Uint64() >= unbonding.UNBONDING_QUEUE_START_BLOCK {
+		return nil, fmt.Errorf("%w: address %v", ErrUnbondingValue, msg.From().Hex())
+	}
+	// Conversion batch transactions are processed by the consensus engine, the address has no code to receive value
+	if msg.Value().Sign() > 0 && msg.To() != nil && msg.To().IsEqualTo(conversion.CONVERSION_BATCH_CONTRACT_ADDRESS) &&
+		st.evm.Context.BlockNumber.Uint64() >= conversion.CONVERSION_V2_START_BLOCK {
+		return nil, fmt.Errorf("%w: address %v", ErrConversionBatchValue, msg.From().Hex())
+	}
 	sender := vm.AccountRef(msg.From())
 	homestead := st.evm.ChainConfig().IsHomestead(st.evm.Context.BlockNumber)
 	istanbul := st.evm.ChainConfig().IsIstanbul(st.evm.Context.BlockNumber)
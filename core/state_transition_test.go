@@ -0,0 +1,77 @@
+package core
+
+import (
+	"errors"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/core/state"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/core/vm"
+	"github.com/QuantumCoinProject/qc/params"
+	"github.com/QuantumCoinProject/qc/systemcontracts/conversion"
+	"github.com/QuantumCoinProject/qc/systemcontracts/unbonding"
+	"math/big"
+	"testing"
+)
+
+var transitionTestSender = common.HexToAddress("0x0000000000000000000000000000000000000000000000000000000000001001")
+
+// applyValueTransfer applies a message sending value to the given address at the given block.
+func applyValueTransfer(t *testing.T, to common.Address, value *big.Int, blockNumber uint64) error {
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	statedb.AddBalance(transitionTestSender, big.NewInt(params.Ether))
+
+	blockContext := vm.BlockContext{
+		CanTransfer: CanTransfer,
+		Transfer:    Transfer,
+		GasLimit:    params.GenesisGasLimit,
+		BlockNumber: new(big.Int).SetUint64(blockNumber),
+		Time:        big.NewInt(0),
+		Difficulty:  big.NewInt(0),
+		BaseFee:     big.NewInt(0),
+	}
+	msg := types.NewMessage(transitionTestSender, &to, 0, value, params.TxGas, big.NewInt(1), nil, nil, false)
+	evm := vm.NewEVM(blockContext, NewEVMTxContext(msg), statedb, params.AllProofOfStakeProtocolChanges, vm.Config{})
+
+	_, err = ApplyMessage(evm, msg, new(GasPool).AddGas(params.GenesisGasLimit))
+	return err
+}
+
+func TestStateTransition_UnbondingValue(t *testing.T) {
+	startBlock := unbonding.UNBONDING_QUEUE_START_BLOCK
+	unbonding.UNBONDING_QUEUE_START_BLOCK = 100
+	defer func() {
+		unbonding.UNBONDING_QUEUE_START_BLOCK = startBlock
+	}()
+
+	if err := applyValueTransfer(t, unbonding.UNBONDING_CONTRACT_ADDRESS, big.NewInt(1000), 99); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if err := applyValueTransfer(t, unbonding.UNBONDING_CONTRACT_ADDRESS, big.NewInt(1000), 100); errors.Is(err, ErrUnbondingValue) == false {
+		t.Fatalf("failed %v", err)
+	}
+	if err := applyValueTransfer(t, unbonding.UNBONDING_CONTRACT_ADDRESS, big.NewInt(0), 100); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+}
+
+func TestStateTransition_ConversionBatchValue(t *testing.T) {
+	startBlock := conversion.CONVERSION_V2_START_BLOCK
+	conversion.CONVERSION_V2_START_BLOCK = 100
+	defer func() {
+		conversion.CONVERSION_V2_START_BLOCK = startBlock
+	}()
+
+	if err := applyValueTransfer(t, conversion.CONVERSION_BATCH_CONTRACT_ADDRESS, big.NewInt(1000), 99); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if err := applyValueTransfer(t, conversion.CONVERSION_BATCH_CONTRACT_ADDRESS, big.NewInt(1000), 100); errors.Is(err, ErrConversionBatchValue) == false {
+		t.Fatalf("failed %v", err)
+	}
+	if err := applyValueTransfer(t, conversion.CONVERSION_BATCH_CONTRACT_ADDRESS, big.NewInt(0), 100); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+}
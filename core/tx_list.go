@@ -253,17 +253,17 @@ type txList struct {
 	strict bool         // Whether nonces are strictly continuous or not
 	txs    *txSortedMap // Heap indexed sorted hash map of the transactions
 
-	costcap *big.Int // Price of the highest costing transaction (reset only if exceeds balance)
-	gascap  uint64   // Gas limit of the highest spending transaction (reset only if exceeds block limit)
+	valuecap *big.Int // Value of the highest value transaction (reset only if the cost exceeds balance)
+	gascap   uint64   // Gas limit of the highest spending transaction (reset only if exceeds block limit)
 }
 
 // newTxList create a new transaction list for maintaining nonce-indexable fast,
 // gapped, sortable transaction lists.
 func newTxList(strict bool) *txList {
 	return &txList{
-		strict:  strict,
-		txs:     newTxSortedMap(),
-		costcap: new(big.Int),
+		strict:   strict,
+		txs:      newTxSortedMap(),
+		valuecap: new(big.Int),
 	}
 }
 
@@ -276,7 +276,7 @@ func (l *txList) Overlaps(tx *types.Transaction) bool {
 // Add tries to insert a new transaction into the list, returning whether the
 // transaction was accepted, and if yes, any previous transaction it replaced.
 //
-// If the new transaction is accepted into the list, the lists' cost and gas
+// If the new transaction is accepted into the list, the lists' value and gas
 // thresholds are also potentially updated.
 func (l *txList) Add(tx *types.Transaction) (bool, *types.Transaction) {
 	// If there's an older better transaction, abort
@@ -286,8 +286,8 @@ func (l *txList) Add(tx *types.Transaction) (bool, *types.Transaction) {
 	}
 	// Otherwise overwrite the old transaction with the current one
 	l.txs.Put(tx)
-	if cost := tx.Cost(); l.costcap.Cmp(cost) < 0 {
-		l.costcap = cost
+	if value := tx.Value(); l.valuecap.Cmp(value) < 0 {
+		l.valuecap = value
 	}
 	if gas := tx.Gas(); l.gascap < gas {
 		l.gascap = gas
@@ -303,21 +303,29 @@ func (l *txList) Forward(threshold uint64) types.Transactions {
 }
 
 // Filter removes all transactions from the list with a cost or gas limit higher
-// than the provided thresholds. Every removed transaction is returned for any
-// post-removal maintenance. Strict-mode invalidated transactions are also
-// returned.
+// than the provided thresholds. The cost is computed with the given gas price,
+// or with the gas price of each transaction if it is nil. Every removed
+// transaction is returned for any post-removal maintenance. Strict-mode
+// invalidated transactions are also returned.
 //
-// This method uses the cached costcap and gascap to quickly decide if there's even
+// This method uses the cached valuecap and gascap to quickly decide if there's even
 // a point in calculating all the costs or if the balance covers all. If the threshold
-// is lower than the costgas cap, the caps will be reset to a new high after removing
+// is lower than the caps, the caps will be reset to a new high after removing
 // the newly invalidated transactions.
-func (l *txList) Filter(costLimit *big.Int, gasLimit uint64, signer types.Signer) (types.Transactions, types.Transactions) {
-	// If all transactions are below the threshold, short circuit
-	if l.costcap.Cmp(costLimit) <= 0 && l.gascap <= gasLimit {
+func (l *txList) Filter(costLimit *big.Int, gasLimit uint64, gasPrice *big.Int, signer types.Signer) (types.Transactions, types.Transactions) {
+	// If all transactions are below the threshold, short circuit. Transactions
+	// all carry the default gas tier price until governance sets another one.
+	capPrice := gasPrice
+	if capPrice == nil {
+		capPrice = types.GAS_TIER_DEFAULT_PRICE
+	}
+	costcap := new(big.Int).Mul(capPrice, new(big.Int).SetUint64(l.gascap))
+	if costcap.Add(costcap, l.valuecap).Cmp(costLimit) <= 0 && l.gascap <= gasLimit {
 		return nil, nil
 	}
-	l.costcap = new(big.Int).Set(costLimit) // Lower the caps to the thresholds
-	l.gascap = gasLimit
+	// Reset the caps to the highest remaining transaction
+	l.valuecap = new(big.Int)
+	l.gascap = 0
 
 	// Filter out all the transactions above the account's funds
 	removed := l.txs.Filter(func(tx *types.Transaction) bool {
@@ -326,7 +334,16 @@ func (l *txList) Filter(costLimit *big.Int, gasLimit uint64, signer types.Signer
 			log.Info("txlist Filter skipping gas-exempt txn", "txn", tx.Hash())
 			return false
 		}
-		return tx.Gas() > gasLimit || tx.Cost().Cmp(costLimit) > 0
+		if tx.Gas() > gasLimit || TxCost(tx, gasPrice).Cmp(costLimit) > 0 {
+			return true
+		}
+		if value := tx.Value(); l.valuecap.Cmp(value) < 0 {
+			l.valuecap = value
+		}
+		if gas := tx.Gas(); l.gascap < gas {
+			l.gascap = gas
+		}
+		return false
 	})
 
 	if len(removed) == 0 {
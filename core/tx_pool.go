@@ -21,7 +21,9 @@ import (
 	"github.com/QuantumCoinProject/qc/backupmanager"
 	"github.com/QuantumCoinProject/qc/conversionutil"
 	"github.com/QuantumCoinProject/qc/systemcontracts/conversion"
+	"github.com/QuantumCoinProject/qc/systemcontracts/governance"
 	"github.com/QuantumCoinProject/qc/systemcontracts/staking"
+	"github.com/QuantumCoinProject/qc/systemcontracts/unbonding"
 	"math"
 	"math/big"
 	"sort"
@@ -83,6 +85,18 @@ var (
 	// transaction with a negative value.
 	ErrNegativeValue = errors.New("negative value")
 
+	// ErrGovernanceValue is returned if a transaction to the governance contract
+	// transfers value.
+	ErrGovernanceValue = errors.New("governance transaction with value")
+
+	// ErrUnbondingValue is returned if a transaction to the unbonding contract
+	// transfers value.
+	ErrUnbondingValue = errors.New("unbonding transaction with value")
+
+	// ErrConversionBatchValue is returned if a transaction to the conversion batch
+	// contract transfers value.
+	ErrConversionBatchValue = errors.New("conversion batch transaction with value")
+
 	// ErrOversizedData is returned if the input data of a transaction is greater
 	// than some meaningful limit a user might use. This is not a consensus error
 	// making the transaction invalid, rather a DOS protection.
@@ -246,6 +260,7 @@ type TxPool struct {
 	currentState  *state.StateDB // Current state in the blockchain head
 	pendingNonces *txNoncer      // Pending state tracking virtual nonces
 	currentMaxGas uint64         // Current gas limit for transaction caps
+	gasTierPrice  *big.Int       // Gas price charged at the head, nil until set through governance
 
 	locals  *accountSet // Set of local transaction to exempt from eviction rules
 	journal *txJournal  // Journal of local transaction to back up to disk
@@ -586,6 +601,17 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	if tx.Value().Sign() < 0 {
 		return ErrNegativeValue
 	}
+	// Governance transactions are not payable, any value sent would be locked in the contract address
+	if tx.To().IsEqualTo(governance.GOVERNANCE_CONTRACT_ADDRESS) && tx.Value().Sign() > 0 {
+		return ErrGovernanceValue
+	}
+	// Unbonding transactions are not payable either
+	if tx.To().IsEqualTo(unbonding.UNBONDING_CONTRACT_ADDRESS) && tx.Value().Sign() > 0 {
+		return ErrUnbondingValue
+	}
+	if tx.To().IsEqualTo(conversion.CONVERSION_BATCH_CONTRACT_ADDRESS) && tx.Value().Sign() > 0 {
+		return ErrConversionBatchValue
+	}
 	// Ensure the transaction doesn't exceed the current block limit gas.
 	if pool.currentMaxGas < tx.Gas() {
 		return ErrGasLimit
@@ -602,9 +628,10 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 		return ErrNonceTooLow
 	}
 	// Transactor should have enough funds to cover the costs
-	// cost == V + GP * GL
-	log.Trace("validateTx gas error", "from", from, "balance", pool.currentState.GetBalance(from), "cost", tx.Cost())
-	if pool.currentState.GetBalance(from).Cmp(tx.Cost()) < 0 {
+	// cost == V + GP * GL, with the gas price charged at the head
+	cost := TxCost(tx, pool.gasTierPrice)
+	log.Trace("validateTx gas error", "from", from, "balance", pool.currentState.GetBalance(from), "cost", cost)
+	if pool.currentState.GetBalance(from).Cmp(cost) < 0 {
 		isGasExempt, err := conversionutil.IsGasExemptTxn(tx, pool.signer)
 		if err == nil && isGasExempt == true {
 			log.Trace("Is a GasExempt Txn", "from", from, "tx", tx.Hash())
@@ -1249,6 +1276,7 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	pool.currentState = statedb
 	pool.pendingNonces = newTxNoncer(statedb)
 	pool.currentMaxGas = newHead.GasLimit
+	pool.gasTierPrice = GovernanceGasPrice(statedb)
 
 	// Inject any transactions discarded due to reorgs
 	log.Debug("Reinjecting stale transactions", "count", len(reinject))
@@ -1283,7 +1311,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 		}
 		log.Trace("Removed old queued transactions", "count", len(forwards))
 		// Drop all transactions that are low balance or out of gas
-		drops, _ := list.Filter(pool.currentState.GetBalance(addr), pool.currentMaxGas, pool.signer)
+		drops, _ := list.Filter(pool.currentState.GetBalance(addr), pool.currentMaxGas, pool.gasTierPrice, pool.signer)
 		for _, tx := range drops {
 			hash := tx.Hash()
 			pool.all.Remove(hash)
@@ -1481,7 +1509,7 @@ func (pool *TxPool) demoteUnexecutables() {
 			log.Trace("Removed old pending transaction", "hash", hash)
 		}
 		// Drop all transactions that are too costly (low balance or out of gas), and queue any invalids back for later
-		drops, invalids := list.Filter(pool.currentState.GetBalance(addr), pool.currentMaxGas, pool.signer)
+		drops, invalids := list.Filter(pool.currentState.GetBalance(addr), pool.currentMaxGas, pool.gasTierPrice, pool.signer)
 		for _, tx := range drops {
 			hash := tx.Hash()
 			log.Trace("Removed unpayable pending transaction", "hash", hash)
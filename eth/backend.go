@@ -41,6 +41,7 @@ import (
 	"github.com/QuantumCoinProject/qc/eth/filters"
 	"github.com/QuantumCoinProject/qc/eth/gasprice"
 	"github.com/QuantumCoinProject/qc/eth/protocols/eth"
+	"github.com/QuantumCoinProject/qc/eth/protocols/snap"
 	"github.com/QuantumCoinProject/qc/ethdb"
 	"github.com/QuantumCoinProject/qc/event"
 	"github.com/QuantumCoinProject/qc/internal/ethapi"
@@ -207,6 +208,9 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		eth.blockchain.SetHead(compat.RewindTo)
 		rawdb.WriteChainConfig(chainDb, genesisHash, chainConfig)
 	}
+	if anchor := rawdb.ReadCheckpointAnchor(chainDb); anchor != nil {
+		eth.anchorBloomIndexer(*anchor, rawdb.ReadCanonicalHash(chainDb, *anchor))
+	}
 	eth.bloomIndexer.Start(eth.blockchain)
 
 	if config.TxPool.Journal != "" {
@@ -217,10 +221,45 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	// Permit the downloader to use the trie cache allowance during fast sync
 	cacheLimit := cacheConfig.TrieCleanLimit + cacheConfig.TrieDirtyLimit + cacheConfig.SnapshotLimit
 	checkpoint := config.Checkpoint
-	if checkpoint == nil {
-		checkpoint = params.TrustedCheckpoints[genesisHash]
+	var anchor *downloader.Anchor
+	if eng, ok := eth.engine.(*proofofstake.ProofOfStake); ok {
+		eng.SetBlockchain(eth.blockchain)
+
+		// A verified checkpoint is enforced on the local chain and used for the
+		// checkpoint challenge of sync peers. On an empty chain, fast sync starts
+		// from its section head instead of the genesis block.
+		checkpoints := config.Checkpoints
+		if len(checkpoints) == 0 {
+			checkpoints = params.ValidatorCheckpoints[genesisHash]
+		}
+		trusted, err := eng.VerifyTrustedCheckpoints(genesisHash, checkpoints)
+		if err != nil {
+			return nil, fmt.Errorf("invalid checkpoint: %w", err)
+		}
+		if trusted != nil {
+			log.Info("Verified validator signed checkpoint", "section", trusted.SectionIndex, "number", trusted.SectionNumber(),
+				"hash", trusted.SectionHead, "signatures", len(trusted.Signatures))
+			if hash := rawdb.ReadCanonicalHash(chainDb, trusted.SectionNumber()); hash != (common.Hash{}) && hash != trusted.SectionHead {
+				return nil, fmt.Errorf("local chain has block %x at checkpoint %d, want %x", hash, trusted.SectionNumber(), trusted.SectionHead)
+			}
+			checkpoint = &trusted.TrustedCheckpoint
+
+			// The ancient store cannot hold a chain without the history below the
+			// checkpoint, so the bootstrap needs the freezer to be disabled.
+			if config.SyncMode == downloader.FastSync && config.FreezerMode == rawdb.FreezerModeSkipAll {
+				anchor = &downloader.Anchor{
+					Number: trusted.SectionNumber(),
+					Hash:   trusted.SectionHead,
+					Td:     proofofstake.CheckpointTd(eth.blockchain.GetTd(genesisHash, 0), trusted),
+				}
+			} else {
+				log.Info("Checkpoint bootstrap needs fast sync with the freezer disabled, syncing from the genesis block")
+			}
+		}
 	}
 
+	setupSentry(eth.p2pServer, config)
+
 	if eth.handler, err = handler.NewHandler(&handler.HandlerConfig{
 		Database:         chainDb,
 		Chain:            eth.blockchain,
@@ -230,17 +269,24 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		BloomCache:       uint64(cacheLimit),
 		EventMux:         eth.eventMux,
 		Checkpoint:       checkpoint,
+		Anchor:           anchor,
 		Whitelist:        config.Whitelist,
 		RebroadcastCount: stack.Config().RebroadcastCount,
+		SentryNodes:      config.SentryNodes,
+		PrivatePeers:     config.PrivatePeers,
+		PeerScorer:       eth.p2pServer,
 	}); err != nil {
 		return nil, err
 	}
+	if anchor != nil {
+		go eth.anchorLoop(eth.eventMux.Subscribe(downloader.AnchorEvent{}))
+	}
 
 	if eng, ok := eth.engine.(*proofofstake.ProofOfStake); ok {
 		eng.SetP2PHandler(eth.handler, eth.p2pServer.GetLocalPeerId())
 		var consensusHandler handler.ConsensusHandler = eng.GetConsensusPacketHandler()
 		eth.handler.SetConsensusHandler(consensusHandler)
-		eng.SetBlockchain(eth.blockchain)
+		eng.StartValidatorStatsIndexer(eth.blockchain)
 	}
 
 	eth.p2pServer.SetRequestPeersFn(eth.handler.RequestPeerList)
@@ -534,10 +580,35 @@ func (s *Ethereum) Synced() bool                       { return atomic.LoadUint3
 func (s *Ethereum) ArchiveMode() bool                  { return s.config.NoPruning }
 func (s *Ethereum) BloomIndexer() *core.ChainIndexer   { return s.bloomIndexer }
 
+// setupSentry configures the p2p server for the sentry node architecture. A
+// validator with sentries hides from the network: it runs no discovery and only
+// keeps authenticated connections to its sentries. A sentry keeps its protected
+// validators connected regardless of the peer limit.
+func setupSentry(srv *p2p.Server, config *ethconfig.Config) {
+	if len(config.SentryNodes) > 0 {
+		log.Info("Running validator behind sentry nodes", "sentries", len(config.SentryNodes))
+		srv.TrustedOnly = true
+		srv.NoDiscovery = true
+		srv.DiscoveryV5 = false
+		srv.StaticNodes = append(srv.StaticNodes, config.SentryNodes...)
+		srv.TrustedNodes = append(srv.TrustedNodes, config.SentryNodes...)
+		config.EthDiscoveryURLs = nil
+		config.SnapDiscoveryURLs = nil
+	}
+	if len(config.PrivatePeers) > 0 {
+		log.Info("Running as sentry node", "validators", len(config.PrivatePeers))
+		srv.StaticNodes = append(srv.StaticNodes, config.PrivatePeers...)
+		srv.TrustedNodes = append(srv.TrustedNodes, config.PrivatePeers...)
+	}
+}
+
 // Protocols returns all the currently configured
 // network protocols to start.
 func (s *Ethereum) Protocols() []p2p.Protocol {
 	protos := eth.MakeProtocols((*handler.EthHandler)(s.handler), s.networkID, s.ethDialCandidates)
+	if s.config.SnapshotCache > 0 {
+		protos = append(protos, snap.MakeProtocols((*handler.SnapHandler)(s.handler), s.snapDialCandidates)...)
+	}
 	return protos
 }
 
@@ -583,3 +654,17 @@ func (s *Ethereum) Stop() error {
 
 	return nil
 }
+
+// anchorLoop moves the chain indexers past the checkpoint block once fast sync
+// anchors the chain at it. It returns when the event mux is stopped.
+func (s *Ethereum) anchorLoop(sub *event.TypeMuxSubscription) {
+	for ev := range sub.Chan() {
+		if anchor, ok := ev.Data.(downloader.AnchorEvent); ok {
+			number, hash := anchor.Anchor.Number.Uint64(), anchor.Anchor.Hash()
+			s.anchorBloomIndexer(number, hash)
+			if eng, ok := s.engine.(*proofofstake.ProofOfStake); ok {
+				eng.AnchorValidatorStatsIndexer(number, hash)
+			}
+		}
+	}
+}
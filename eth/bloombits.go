@@ -19,8 +19,10 @@ package eth
 import (
 	"time"
 
+	"github.com/QuantumCoinProject/qc/common"
 	"github.com/QuantumCoinProject/qc/common/bitutil"
 	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/params"
 )
 
 const (
@@ -72,3 +74,12 @@ func (eth *Ethereum) startBloomHandlers(sectionSize uint64) {
 		}()
 	}
 }
+
+// anchorBloomIndexer marks the bloom sections below the checkpoint block fast
+// sync started from as done, since the chain holds no headers to index them.
+func (eth *Ethereum) anchorBloomIndexer(number uint64, hash common.Hash) {
+	if (number+1)%params.BloomBitsBlocks != 0 {
+		return
+	}
+	eth.bloomIndexer.AddCheckpoint((number+1)/params.BloomBitsBlocks-1, hash)
+}
@@ -26,6 +26,7 @@ import (
 	"github.com/QuantumCoinProject/qc/core/state/snapshot"
 	"github.com/QuantumCoinProject/qc/core/types"
 	"github.com/QuantumCoinProject/qc/eth/protocols/eth"
+	"github.com/QuantumCoinProject/qc/eth/protocols/snap"
 	"github.com/QuantumCoinProject/qc/ethdb"
 	"github.com/QuantumCoinProject/qc/event"
 	"github.com/QuantumCoinProject/qc/log"
@@ -86,11 +87,20 @@ var (
 // chainHeightFn is a callback type to retrieve the current chain height.
 type chainHeightFn func() uint64
 
+// Anchor is a trusted block that fast sync starts from on an empty chain,
+// instead of downloading the history from the genesis block.
+type Anchor struct {
+	Number uint64      // Number of the trusted block
+	Hash   common.Hash // Hash of the trusted block
+	Td     *big.Int    // Total difficulty of the chain up to and including the trusted block
+}
+
 type Downloader struct {
 	mode uint32         // Synchronisation mode defining the strategy used (per sync cycle), use d.getMode() to get the SyncMode
 	mux  *event.TypeMux // Event multiplexer to announce sync operation events
 
 	checkpoint uint64   // Checkpoint block number to enforce head against (e.g. fast sync)
+	anchor     *Anchor  // Trusted block to start fast sync from on an empty chain (nil = genesis)
 	genesis    uint64   // Genesis block number to limit sync to (e.g. light client CHT)
 	queue      *queue   // Scheduler for selecting the hashes to download
 	peers      *peerSet // Set of active peers from which download can proceed
@@ -129,7 +139,8 @@ type Downloader struct {
 	pivotHeader *types.Header // Pivot block header to dynamically push the syncing state root
 	pivotLock   sync.RWMutex  // Lock protecting pivot header reads from updates
 
-	snapSync       bool // Whether to run state sync over the snap protocol
+	snapSync       bool         // Whether to run state sync over the snap protocol
+	SnapSyncer     *snap.Syncer // Syncer downloading the state over the snap protocol
 	stateSyncStart chan *stateSync
 	trackStateReq  chan *stateReq
 	stateCh        chan dataPack // Channel receiving inbound node state data
@@ -198,12 +209,15 @@ type BlockChain interface {
 	// InsertReceiptChain inserts a batch of receipts into the local chain.
 	InsertReceiptChain(types.Blocks, []types.Receipts, uint64) (int, error)
 
+	// InsertCheckpointAnchor writes a trusted block as the head of an empty chain.
+	InsertCheckpointAnchor(*types.Block, types.Receipts, *big.Int) error
+
 	// Snapshots returns the blockchain snapshot tree to paused it during sync.
 	Snapshots() *snapshot.Tree
 }
 
 // New creates a new downloader to fetch hashes and blocks from remote peers.
-func New(checkpoint uint64, stateDb ethdb.Database, stateBloom *trie.SyncBloom, mux *event.TypeMux, chain BlockChain, lightchain LightChain, dropPeer peerDropFn) *Downloader {
+func New(checkpoint uint64, anchor *Anchor, stateDb ethdb.Database, stateBloom *trie.SyncBloom, mux *event.TypeMux, chain BlockChain, lightchain LightChain, dropPeer peerDropFn) *Downloader {
 	if lightchain == nil {
 		lightchain = chain
 	}
@@ -212,6 +226,7 @@ func New(checkpoint uint64, stateDb ethdb.Database, stateBloom *trie.SyncBloom,
 		stateBloom:     stateBloom,
 		mux:            mux,
 		checkpoint:     checkpoint,
+		anchor:         anchor,
 		queue:          newQueue(blockCacheMaxItems, blockCacheInitialItems),
 		peers:          newPeerSet(),
 		blockchain:     chain,
@@ -226,6 +241,7 @@ func New(checkpoint uint64, stateDb ethdb.Database, stateBloom *trie.SyncBloom,
 		quitCh:         make(chan struct{}),
 		stateCh:        make(chan dataPack),
 		stateSyncStart: make(chan *stateSync),
+		SnapSyncer:     snap.NewSyncer(stateDb, stateBloom),
 		syncStatsState: stateSyncStats{
 			processed: rawdb.ReadFastTrieProgress(stateDb),
 		},
@@ -406,6 +422,21 @@ func (d *Downloader) synchronise(id string, hash common.Hash, td *big.Int, mode
 
 	defer d.Cancel() // No matter what, we can't leave the cancel channel open
 
+	// If snap sync was requested, switch to fast sync mode with the state being
+	// downloaded over the snap protocol instead of node by node.
+	if mode == SnapSync {
+		if !d.snapSync {
+			// Snap sync uses the snapshot namespace to store potentially flakey data until
+			// sync completely heals and finishes. Pause snapshot maintenance in the mean
+			// time to prevent access.
+			if snapshots := d.blockchain.Snapshots(); snapshots != nil { // Only nil in tests
+				snapshots.Disable()
+			}
+			log.Info("Enabling snapshot sync")
+			d.snapSync = true
+		}
+		mode = FastSync
+	}
 	// Atomically set the requested sync mode
 	atomic.StoreUint32(&d.mode, uint32(mode))
 
@@ -456,6 +487,13 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 		// nil panics on an access.
 		pivot = d.blockchain.CurrentBlock().Header()
 	}
+	// On an empty chain, start from the trusted anchor block if the remote pivot
+	// is past it. The ancestor lookup below then settles on the anchor.
+	if mode == FastSync && d.anchor != nil && pivot.Number.Uint64() > d.anchor.Number && d.lightchain.CurrentHeader().Number.Uint64() == 0 {
+		if err := d.fetchAnchor(p); err != nil {
+			return err
+		}
+	}
 	height := latest.Number.Uint64()
 
 	origin, err := d.findAncestor(p, latest)
@@ -509,6 +547,11 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td *big.I
 		} else {
 			d.ancientLimit = 0
 		}
+		// A chain started from a checkpoint anchor has no history below it, which
+		// the ancient store cannot represent, so keep all the data in the active store.
+		if rawdb.ReadCheckpointAnchor(d.stateDB) != nil {
+			d.ancientLimit = 0
+		}
 		frozen, _ := d.stateDB.Ancients() // Ignore the error here since light client can also hit here.
 
 		// If a part of blockchain data has already been written into active store,
@@ -685,6 +728,80 @@ func (d *Downloader) fetchHead(p *peerConnection) (head *types.Header, pivot *ty
 	}
 }
 
+// fetchAnchor retrieves the trusted anchor block and its receipts from the remote
+// peer, checks them against the trusted hash and writes them as the head of the
+// local chain, so that the sync continues from the anchor.
+func (d *Downloader) fetchAnchor(p *peerConnection) error {
+	p.log.Debug("Retrieving checkpoint anchor", "number", d.anchor.Number, "hash", d.anchor.Hash)
+
+	var (
+		header  *types.Header
+		txs     []*types.Transaction
+		gotBody bool
+		ttl     = d.peers.rates.TargetTimeout()
+		timeout = time.After(ttl)
+		hasher  = trie.NewStackTrie(nil)
+		hashes  = []common.Hash{d.anchor.Hash}
+	)
+	go p.peer.RequestHeadersByNumber(d.anchor.Number, 1, 0, false)
+
+	for {
+		select {
+		case <-d.cancelCh:
+			return errCanceled
+
+		case packet := <-d.headerCh:
+			// Discard anything not from the origin peer
+			if packet.PeerId() != p.id || header != nil {
+				log.Debug("Received headers from incorrect peer", "peer", packet.PeerId())
+				break
+			}
+			headers := packet.(*headerPack).headers
+			if len(headers) != 1 {
+				return fmt.Errorf("%w: returned headers %d != requested 1", errBadPeer, len(headers))
+			}
+			if headers[0].Number.Uint64() != d.anchor.Number || headers[0].Hash() != d.anchor.Hash {
+				return fmt.Errorf("%w: anchor %d [%x..] != trusted [%x..]", errUnsyncedPeer, headers[0].Number, headers[0].Hash().Bytes()[:4], d.anchor.Hash.Bytes()[:4])
+			}
+			header = headers[0]
+			timeout = time.After(ttl)
+			go p.peer.RequestBodies(hashes)
+
+		case packet := <-d.bodyCh:
+			if packet.PeerId() != p.id || header == nil || gotBody {
+				log.Debug("Received bodies from incorrect peer", "peer", packet.PeerId())
+				break
+			}
+			bodies := packet.(*bodyPack).transactions
+			if len(bodies) != 1 || types.DeriveSha(types.Transactions(bodies[0]), hasher) != header.TxHash {
+				return fmt.Errorf("%w: %v", errBadPeer, errInvalidBody)
+			}
+			txs, gotBody = bodies[0], true
+			timeout = time.After(ttl)
+			go p.peer.RequestReceipts(hashes)
+
+		case packet := <-d.receiptCh:
+			if packet.PeerId() != p.id || !gotBody {
+				log.Debug("Received receipts from incorrect peer", "peer", packet.PeerId())
+				break
+			}
+			receipts := packet.(*receiptPack).receipts
+			if len(receipts) != 1 || types.DeriveSha(types.Receipts(receipts[0]), hasher) != header.ReceiptHash {
+				return fmt.Errorf("%w: %v", errBadPeer, errInvalidReceipt)
+			}
+			if err := d.blockchain.InsertCheckpointAnchor(types.NewBlockWithHeader(header).WithBody(txs), receipts[0], d.anchor.Td); err != nil {
+				return err
+			}
+			d.mux.Post(AnchorEvent{header})
+			return nil
+
+		case <-timeout:
+			p.log.Debug("Waiting for checkpoint anchor timed out", "elapsed", ttl)
+			return errTimeout
+		}
+	}
+}
+
 // calculateRequestSpan calculates what headers to request from a peer when trying to determine the
 // common ancestor.
 // It returns parameters to be used for peer.RequestHeadersByNumber:
@@ -1486,6 +1603,10 @@ func (d *Downloader) processHeaders(origin uint64, td *big.Int) error {
 	)
 	defer func() {
 		if rollback > 0 {
+			// Never roll back past a checkpoint anchor, there is no history below it
+			if anchor := rawdb.ReadCheckpointAnchor(d.stateDB); anchor != nil && rollback <= *anchor {
+				rollback = *anchor + 1
+			}
 			lastHeader, lastFastBlock, lastBlock := d.lightchain.CurrentHeader().Number, common.Big0, common.Big0
 			lastFastBlock = d.blockchain.CurrentFastBlock().Number()
 			lastBlock = d.blockchain.CurrentBlock().Number()
@@ -1921,6 +2042,32 @@ func (d *Downloader) DeliverNodeData(id string, data [][]byte) error {
 	return d.deliver(d.stateCh, &statePack{id, data}, stateInMeter, stateDropMeter)
 }
 
+// DeliverSnapPacket is invoked from a peer's message handler when it transmits a
+// data packet for the local node to consume.
+func (d *Downloader) DeliverSnapPacket(peer *snap.Peer, packet snap.Packet) error {
+	switch packet := packet.(type) {
+	case *snap.AccountRangePacket:
+		hashes, accounts, err := packet.Unpack()
+		if err != nil {
+			return err
+		}
+		return d.SnapSyncer.OnAccounts(peer, packet.ID, hashes, accounts, packet.Proof)
+
+	case *snap.StorageRangesPacket:
+		hashset, slotset := packet.Unpack()
+		return d.SnapSyncer.OnStorage(peer, packet.ID, hashset, slotset, packet.Proof)
+
+	case *snap.ByteCodesPacket:
+		return d.SnapSyncer.OnByteCodes(peer, packet.ID, packet.Codes)
+
+	case *snap.TrieNodesPacket:
+		return d.SnapSyncer.OnTrieNodes(peer, packet.ID, packet.Nodes)
+
+	default:
+		return fmt.Errorf("unexpected snap packet type: %T", packet)
+	}
+}
+
 // deliver injects a new batch of data received from a remote node.
 func (d *Downloader) deliver(destCh chan dataPack, packet dataPack, inMeter, dropMeter metrics.Meter) (err error) {
 	// Update the delivery metrics for both good and failed deliveries
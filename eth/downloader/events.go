@@ -23,3 +23,4 @@ type DoneEvent struct {
 }
 type StartEvent struct{}
 type FailedEvent struct{ Err error }
+type AnchorEvent struct{ Anchor *types.Header }
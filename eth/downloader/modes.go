@@ -25,10 +25,11 @@ type SyncMode uint32
 const (
 	FullSync SyncMode = iota // Synchronise the entire blockchain history from full blocks
 	FastSync                 // Quickly download the headers, full sync only at the chain
+	SnapSync                 // Download the chain and the state via compact snapshots
 )
 
 func (mode SyncMode) IsValid() bool {
-	return mode >= FullSync && mode <= FastSync
+	return mode >= FullSync && mode <= SnapSync
 }
 
 // String implements the stringer interface.
@@ -38,6 +39,8 @@ func (mode SyncMode) String() string {
 		return "full"
 	case FastSync:
 		return "fast"
+	case SnapSync:
+		return "snap"
 	default:
 		return "unknown"
 	}
@@ -49,6 +52,8 @@ func (mode SyncMode) MarshalText() ([]byte, error) {
 		return []byte("full"), nil
 	case FastSync:
 		return []byte("fast"), nil
+	case SnapSync:
+		return []byte("snap"), nil
 	default:
 		return nil, fmt.Errorf("unknown sync mode %d", mode)
 	}
@@ -60,8 +65,10 @@ func (mode *SyncMode) UnmarshalText(text []byte) error {
 		*mode = FullSync
 	case "fast":
 		*mode = FastSync
+	case "snap":
+		*mode = SnapSync
 	default:
-		return fmt.Errorf(`unknown sync mode %q, want "full", "fast"`, text)
+		return fmt.Errorf(`unknown sync mode %q, want "full", "fast", "snap"`, text)
 	}
 	return nil
 }
@@ -35,6 +35,7 @@ import (
 	"github.com/QuantumCoinProject/qc/ethdb"
 	"github.com/QuantumCoinProject/qc/miner"
 	"github.com/QuantumCoinProject/qc/node"
+	"github.com/QuantumCoinProject/qc/p2p/enode"
 	"github.com/QuantumCoinProject/qc/params"
 )
 
@@ -125,6 +126,14 @@ type Config struct {
 	EthDiscoveryURLs  []string
 	SnapDiscoveryURLs []string
 
+	// SentryNodes turns a validator into a sentry-protected node: it only peers
+	// with these nodes and neither runs discovery nor accepts other peers.
+	SentryNodes []*enode.Node `toml:",omitempty"`
+
+	// PrivatePeers are the validators a sentry node protects. They are always
+	// connected, receive all consensus traffic and are never advertised.
+	PrivatePeers []*enode.Node `toml:",omitempty"`
+
 	NoPruning  bool // Whether to disable pruning and flush everything to disk
 	NoPrefetch bool // Whether to disable prefetching and only load state on demand
 
@@ -186,6 +195,12 @@ type Config struct {
 	// Checkpoint is a hardcoded checkpoint which can be nil.
 	Checkpoint *params.TrustedCheckpoint `toml:",omitempty"`
 
+	// Checkpoints are validator signed checkpoints of the chain, ordered by section.
+	// Once the chain of signatures is verified against the genesis validators,
+	// fast sync on an empty chain starts from the section head of the latest one.
+	// It is also enforced on the local chain and used to challenge sync peers.
+	Checkpoints []*params.ValidatorCheckpoint `toml:",omitempty"`
+
 	// CheckpointOracle is the configuration for checkpoint oracle.
 	CheckpointOracle *params.CheckpointOracleConfig `toml:",omitempty"`
 
@@ -11,6 +11,7 @@ import (
 	"github.com/QuantumCoinProject/qc/eth/downloader"
 	"github.com/QuantumCoinProject/qc/eth/gasprice"
 	"github.com/QuantumCoinProject/qc/miner"
+	"github.com/QuantumCoinProject/qc/p2p/enode"
 	"github.com/QuantumCoinProject/qc/params"
 )
 
@@ -22,6 +23,8 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		SyncMode                downloader.SyncMode
 		EthDiscoveryURLs        []string
 		SnapDiscoveryURLs       []string
+		SentryNodes             []*enode.Node `toml:",omitempty"`
+		PrivatePeers            []*enode.Node `toml:",omitempty"`
 		NoPruning               bool
 		NoPrefetch              bool
 		TxLookupLimit           uint64                 `toml:",omitempty"`
@@ -55,6 +58,7 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		RPCGasCap               uint64
 		RPCTxFeeCap             float64
 		Checkpoint              *params.TrustedCheckpoint      `toml:",omitempty"`
+		Checkpoints             []*params.ValidatorCheckpoint  `toml:",omitempty"`
 		CheckpointOracle        *params.CheckpointOracleConfig `toml:",omitempty"`
 		OverrideLondon          *big.Int                       `toml:",omitempty"`
 	}
@@ -64,6 +68,8 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.SyncMode = c.SyncMode
 	enc.EthDiscoveryURLs = c.EthDiscoveryURLs
 	enc.SnapDiscoveryURLs = c.SnapDiscoveryURLs
+	enc.SentryNodes = c.SentryNodes
+	enc.PrivatePeers = c.PrivatePeers
 	enc.NoPruning = c.NoPruning
 	enc.NoPrefetch = c.NoPrefetch
 	enc.TxLookupLimit = c.TxLookupLimit
@@ -97,6 +103,7 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.RPCGasCap = c.RPCGasCap
 	enc.RPCTxFeeCap = c.RPCTxFeeCap
 	enc.Checkpoint = c.Checkpoint
+	enc.Checkpoints = c.Checkpoints
 	enc.CheckpointOracle = c.CheckpointOracle
 	enc.OverrideLondon = c.OverrideLondon
 	return &enc, nil
@@ -110,6 +117,8 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		SyncMode                *downloader.SyncMode
 		EthDiscoveryURLs        []string
 		SnapDiscoveryURLs       []string
+		SentryNodes             []*enode.Node `toml:",omitempty"`
+		PrivatePeers            []*enode.Node `toml:",omitempty"`
 		NoPruning               *bool
 		NoPrefetch              *bool
 		TxLookupLimit           *uint64                `toml:",omitempty"`
@@ -143,6 +152,7 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		RPCGasCap               *uint64
 		RPCTxFeeCap             *float64
 		Checkpoint              *params.TrustedCheckpoint      `toml:",omitempty"`
+		Checkpoints             []*params.ValidatorCheckpoint  `toml:",omitempty"`
 		CheckpointOracle        *params.CheckpointOracleConfig `toml:",omitempty"`
 		OverrideLondon          *big.Int                       `toml:",omitempty"`
 	}
@@ -165,6 +175,12 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.SnapDiscoveryURLs != nil {
 		c.SnapDiscoveryURLs = dec.SnapDiscoveryURLs
 	}
+	if dec.SentryNodes != nil {
+		c.SentryNodes = dec.SentryNodes
+	}
+	if dec.PrivatePeers != nil {
+		c.PrivatePeers = dec.PrivatePeers
+	}
 	if dec.NoPruning != nil {
 		c.NoPruning = *dec.NoPruning
 	}
@@ -264,6 +280,9 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.Checkpoint != nil {
 		c.Checkpoint = dec.Checkpoint
 	}
+	if dec.Checkpoints != nil {
+		c.Checkpoints = dec.Checkpoints
+	}
 	if dec.CheckpointOracle != nil {
 		c.CheckpointOracle = dec.CheckpointOracle
 	}
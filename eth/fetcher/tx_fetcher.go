@@ -171,6 +171,7 @@ type TxFetcher struct {
 	hasTx    func(common.Hash) bool             // Retrieves a tx from the local txpool
 	addTxs   func([]*types.Transaction) []error // Insert a batch of transactions into local txpool
 	fetchTxs func(string, []common.Hash) error  // Retrieves a set of txs from a remote peer
+	dropTxs  func(string)                       // Reports a peer delivering invalid transactions, may be nil
 
 	step  chan struct{} // Notification channel when the fetcher loop iterates
 	clock mclock.Clock  // Time wrapper to simulate in tests
@@ -179,8 +180,10 @@ type TxFetcher struct {
 
 // NewTxFetcher creates a transaction fetcher to retrieve transaction
 // based on hash announcements.
-func NewTxFetcher(hasTx func(common.Hash) bool, addTxs func([]*types.Transaction) []error, fetchTxs func(string, []common.Hash) error) *TxFetcher {
-	return NewTxFetcherForTests(hasTx, addTxs, fetchTxs, mclock.System{}, nil)
+func NewTxFetcher(hasTx func(common.Hash) bool, addTxs func([]*types.Transaction) []error, fetchTxs func(string, []common.Hash) error, dropTxs func(string)) *TxFetcher {
+	f := NewTxFetcherForTests(hasTx, addTxs, fetchTxs, mclock.System{}, nil)
+	f.dropTxs = dropTxs
+	return f
 }
 
 // NewTxFetcherForTests is a testing method to mock out the realtime clock with
@@ -274,6 +277,7 @@ func (f *TxFetcher) Enqueue(peer string, txs []*types.Transaction, direct bool)
 		duplicate   int64
 		underpriced int64
 		otherreject int64
+		invalid     bool
 	)
 	errs := f.addTxs(txs)
 	for i, err := range errs {
@@ -297,6 +301,12 @@ func (f *TxFetcher) Enqueue(peer string, txs []*types.Transaction, direct bool)
 			case core.ErrUnderpriced, core.ErrReplaceUnderpriced:
 				underpriced++
 
+			case core.ErrInvalidSender, core.ErrNegativeValue, core.ErrOversizedData, core.ErrIntrinsicGas,
+				core.ErrGasUintOverflow, core.ErrTipAboveFeeCap, core.ErrTipVeryHigh, core.ErrFeeCapVeryHigh:
+				// Transactions no honest node would have relayed
+				otherreject++
+				invalid = true
+
 			default:
 				otherreject++
 			}
@@ -312,6 +322,9 @@ func (f *TxFetcher) Enqueue(peer string, txs []*types.Transaction, direct bool)
 		txBroadcastUnderpricedMeter.Mark(underpriced)
 		txBroadcastOtherRejectMeter.Mark(otherreject)
 	}
+	if invalid && f.dropTxs != nil {
+		f.dropTxs(peer)
+	}
 	select {
 	case f.cleanup <- &txDelivery{origin: peer, hashes: added, direct: direct}:
 		return nil
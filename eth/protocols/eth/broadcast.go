@@ -207,6 +207,13 @@ func (p *Peer) broadcastConsensusMessages() {
 			}
 			p.Log().Trace("broadcastConsensusMessages", "parentHash", packet.ParentHash, "peer", p.id)
 
+		case bundle := <-p.queuedConsensusBundles:
+			err := p.SendConsensusBundle(bundle)
+			if err != nil {
+				continue
+			}
+			p.Log().Trace("broadcastConsensusMessages", "parentHash", bundle.ParentHash, "round", bundle.Round, "packets", len(bundle.Packets), "peer", p.id)
+
 		case <-p.term:
 			return
 		}
@@ -126,6 +126,7 @@ func MakeProtocols(backend Backend, network uint64, dnsdisc enode.Iterator) []p2
 			},
 			Attributes:     []enr.Entry{currentENREntry(backend.Chain())},
 			DialCandidates: dnsdisc,
+			Priority:       IsConsensusMsg,
 		}
 	}
 	return protocols
@@ -193,6 +194,15 @@ var eth66 = map[uint64]msgHandler{
 	PeerListMsg:              handlePeerList,
 }
 
+var eth67 = func() map[uint64]msgHandler {
+	handlers := make(map[uint64]msgHandler, len(eth66)+1)
+	for code, handler := range eth66 {
+		handlers[code] = handler
+	}
+	handlers[ConsensusBundleMsg] = handleConsensusBundle
+	return handlers
+}()
+
 // handleMessage is invoked whenever an inbound message is received from a remote
 // peer. The remote connection is torn down upon returning any error.
 func handleMessage(backend Backend, peer *Peer) error {
@@ -207,8 +217,8 @@ func handleMessage(backend Backend, peer *Peer) error {
 	defer msg.Discard()
 
 	var handlers = eth66
-	if peer.Version() >= ETH66 {
-		handlers = eth66
+	if peer.Version() >= ETH67 {
+		handlers = eth67
 	}
 	// Track the amount of time it takes to serve the request and run the handler
 	if metrics.Enabled {
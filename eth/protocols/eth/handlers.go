@@ -533,6 +533,31 @@ func handleConsensus(backend Backend, msg Decoder, peer *Peer) error {
 	return nil
 }
 
+func handleConsensusBundle(backend Backend, msg Decoder, peer *Peer) error {
+	_, err := peer.Node().Address()
+	if err != nil {
+		return err
+	}
+
+	var bundle ConsensusBundlePacket
+	if err := msg.Decode(&bundle); err != nil {
+		return fmt.Errorf("%w: message %v: %v", errDecode, msg, err)
+	}
+	if len(bundle.Packets) > maxConsensusBundlePackets {
+		return fmt.Errorf("%w: %d consensus packets in bundle", errMsgTooLarge, len(bundle.Packets))
+	}
+	for i := 0; i < len(bundle.Packets); i++ {
+		if bundle.Packets[i].ParentHash.IsEqualTo(bundle.ParentHash) == false {
+			return fmt.Errorf("%w: consensus bundle packet parent hash mismatch", errDecode)
+		}
+	}
+	err = backend.Handle(peer, &bundle)
+	if err != nil {
+		log.Trace("handleConsensusBundle", "err", err)
+	}
+	return nil
+}
+
 func handleRequestConsensus(backend Backend, msg Decoder, peer *Peer) error {
 	_, err := peer.Node().Address()
 	if err != nil {
@@ -55,7 +55,12 @@ const (
 	// above some healthy uncle limit, so use that.
 	maxQueuedBlockAnns = 4
 
-	maxQueuedConsensusMessages       = 128
+	maxQueuedConsensusMessages = 128
+	maxQueuedConsensusBundles  = 32
+
+	// maxConsensusBundlePackets is the maximum number of consensus packets
+	// accepted in a single bundle.
+	maxConsensusBundlePackets        = 256
 	maxQueuedRequestPeerListMessages = 3
 	maxQueuedPeerListMessages        = 3
 )
@@ -83,6 +88,7 @@ type Peer struct {
 	queuedBlocks                   chan *blockPropagation // Queue of blocks to broadcast to the peer
 	queuedBlockAnns                chan *types.Block      // Queue of blocks to announce to the peer
 	queuedConsensusMessages        chan *ConsensusPacket  // Queue of ConsensusPackets to broadcast to the peer
+	queuedConsensusBundles         chan *ConsensusBundlePacket
 	queuedRequestConsensusMessages chan *RequestConsensusDataPacket
 	queuedRequestPeerListMessages  chan *RequestPeerListPacket
 	queuedPeerListMessages         chan *PeerListPacket
@@ -109,6 +115,7 @@ func NewPeer(version uint, p *p2p.Peer, rw p2p.MsgReadWriter, txpool TxPool) *Pe
 		queuedBlocks:                   make(chan *blockPropagation, maxQueuedBlocks),
 		queuedBlockAnns:                make(chan *types.Block, maxQueuedBlockAnns),
 		queuedConsensusMessages:        make(chan *ConsensusPacket, maxQueuedConsensusMessages),
+		queuedConsensusBundles:         make(chan *ConsensusBundlePacket, maxQueuedConsensusBundles),
 		queuedRequestConsensusMessages: make(chan *RequestConsensusDataPacket, maxQueuedConsensusMessages),
 		queuedRequestPeerListMessages:  make(chan *RequestPeerListPacket, maxQueuedRequestPeerListMessages),
 		queuedPeerListMessages:         make(chan *PeerListPacket, maxQueuedPeerListMessages),
@@ -587,6 +594,22 @@ func (p *Peer) AsyncSendConsensusPacket(packet *ConsensusPacket) {
 	}
 }
 
+// SendConsensusBundle sends consensus packets of the same parent hash and round
+// in a single message. The peer must support eth/67.
+func (p *Peer) SendConsensusBundle(bundle *ConsensusBundlePacket) error {
+	return p2p.Send(p.rw, ConsensusBundleMsg, bundle)
+}
+
+// AsyncSendConsensusBundle queues a consensus bundle to the remote peer. If
+// the peer's bundle queue is full, the bundle is silently dropped.
+func (p *Peer) AsyncSendConsensusBundle(bundle *ConsensusBundlePacket) {
+	select {
+	case p.queuedConsensusBundles <- bundle:
+
+	default:
+	}
+}
+
 func (p *Peer) SendRequestPeerListPacket(packet *RequestPeerListPacket) error {
 	p.Log().Trace("SendRequestPeerListPacket", "packet MaxPeers", packet.MaxPeers)
 	return p2p.Send(p.rw, RequestPeerListMsg, packet)
@@ -32,6 +32,7 @@ import (
 // Constants to match up protocol versions and messages
 const (
 	ETH66 = 66
+	ETH67 = 67
 )
 
 // ProtocolName is the official short name of the `eth` protocol used during
@@ -40,11 +41,11 @@ const ProtocolName = "eth"
 
 // ProtocolVersions are the supported versions of the `eth` protocol (first
 // is primary).
-var ProtocolVersions = []uint{ETH66}
+var ProtocolVersions = []uint{ETH67, ETH66}
 
 // protocolLengths are the number of implemented message corresponding to
 // different protocol versions.
-var protocolLengths = map[uint]uint64{ETH66: 34}
+var protocolLengths = map[uint]uint64{ETH67: 35, ETH66: 34}
 
 // maxMessageSize is the maximum cap on the size of a protocol message.
 const maxMessageSize = 4294967295
@@ -74,8 +75,18 @@ const (
 
 	RequestPeerListMsg = 0x20
 	PeerListMsg        = 0x21
+
+	// Protocol messages introduced in eth/67
+	ConsensusBundleMsg = 0x22
 )
 
+// IsConsensusMsg reports whether a message code carries consensus data. Consensus
+// messages take precedence over block and transaction gossip when bandwidth is
+// limited.
+func IsConsensusMsg(code uint64) bool {
+	return code == ConsensusMsg || code == RequestConsensusDataMsg || code == ConsensusBundleMsg
+}
+
 var (
 	errNoStatusMsg             = errors.New("no status message")
 	errMsgTooLarge             = errors.New("message too long")
@@ -332,6 +343,14 @@ type ConsensusPacket struct {
 	ConsensusData []byte      `json:"consensusData" gencodec:"required"`
 }
 
+// ConsensusBundlePacket is the network packet carrying several consensus packets
+// of the same parent hash and round
+type ConsensusBundlePacket struct {
+	ParentHash common.Hash       `json:"parentHash"    gencodec:"required"`
+	Round      byte              `json:"round"         gencodec:"required"`
+	Packets    []ConsensusPacket `json:"packets"       gencodec:"required"`
+}
+
 // type RequestConsensusDataPacket struct { is the network packet for requesting Consensus Data
 type RequestConsensusDataPacket struct {
 	ParentHash  common.Hash `json:"parentHash"    gencodec:"required"`
@@ -401,6 +420,9 @@ func (c *ConsensusPacket) Hash() common.Hash {
 	return crypto.Keccak256Hash(c.ConsensusData, c.ParentHash[:], c.Signature)
 }
 
+func (*ConsensusBundlePacket) Name() string { return "ConsensusBundlePacket" }
+func (*ConsensusBundlePacket) Kind() byte   { return ConsensusBundleMsg }
+
 func (*RequestConsensusDataPacket) Name() string { return "RequestConsensusDataPacket" }
 func (*RequestConsensusDataPacket) Kind() byte   { return RequestConsensusDataMsg }
 
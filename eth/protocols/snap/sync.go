@@ -0,0 +1,1170 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/core/state"
+	"github.com/QuantumCoinProject/qc/core/state/snapshot"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/crypto"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"github.com/QuantumCoinProject/qc/ethdb/memorydb"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/rlp"
+	"github.com/QuantumCoinProject/qc/trie"
+)
+
+const (
+	// maxRequestSize is the maximum number of bytes to request from a remote peer.
+	maxRequestSize = 512 * 1024
+
+	// maxStorageSetRequestCount is the maximum number of contracts to request the
+	// storage of in a single query. If this number is too low, we're not filling
+	// responses fully and waste round trip times. If it's too high, we're capping
+	// responses and waste bandwidth.
+	maxStorageSetRequestCount = maxRequestSize / 1024
+
+	// maxCodeRequestCount is the maximum number of bytecode blobs to request in a
+	// single query.
+	maxCodeRequestCount = maxRequestSize / (24 * 1024) * 4
+
+	// maxTrieRequestCount is the maximum number of trie node blobs to request in
+	// a single query.
+	maxTrieRequestCount = 256
+
+	// accountConcurrency is the number of chunks to split the account trie into
+	// to allow concurrent retrievals.
+	accountConcurrency = 16
+
+	// requestTimeout is the maximum time a peer is allowed to spend on serving
+	// a single network request.
+	requestTimeout = 10 * time.Second
+
+	// statusLogInterval is the time between two sync progress reports.
+	statusLogInterval = 8 * time.Second
+)
+
+var (
+	// emptyRoot is the known root hash of an empty trie.
+	emptyRoot = types.EmptyRootHash
+
+	// errCancelled is returned from sync if the operation was prematurely
+	// terminated.
+	errCancelled = errors.New("sync cancelled")
+)
+
+// SyncPeer abstracts out the methods required for a peer to be synced against
+// with the goal of allowing the construction of mock peers without the full
+// blown networking.
+type SyncPeer interface {
+	// ID retrieves the peer's unique identifier.
+	ID() string
+
+	// RequestAccountRange fetches a batch of accounts rooted in a specific account
+	// trie, starting with the origin.
+	RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error
+
+	// RequestStorageRanges fetches a batch of storage slots belonging to one or
+	// more accounts. If slots from only one account is requested, an origin marker
+	// may also be used to retrieve from there.
+	RequestStorageRanges(id uint64, root common.Hash, accounts []common.Hash, origin, limit []byte, bytes uint64) error
+
+	// RequestByteCodes fetches a batch of bytecodes by hash.
+	RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error
+
+	// RequestTrieNodes fetches a batch of account or storage trie nodes rooted in
+	// a specific state trie.
+	RequestTrieNodes(id uint64, root common.Hash, paths []TrieNodePathSet, bytes uint64) error
+
+	// Log retrieves the peer's own contextual logger.
+	Log() log.Logger
+}
+
+// accountTask represents the sync task for a chunk of the account snapshot.
+type accountTask struct {
+	Next common.Hash // Next account to sync in this interval
+	Last common.Hash // Last account to sync in this interval
+
+	done bool // Flag whether the task has been fully synced
+}
+
+// syncProgress is a database entry to allow suspending and resuming a snapshot
+// state sync. Opposed to full and fast sync, there is no way to restart a
+// suspended snap sync without prior knowledge of the suspension point.
+type syncProgress struct {
+	Tasks []*accountTask // The suspended account tasks (contract tasks within)
+
+	// Status report during syncing phase
+	AccountSynced  uint64             // Number of accounts downloaded
+	AccountBytes   common.StorageSize // Number of account trie bytes persisted to disk
+	BytecodeSynced uint64             // Number of bytecodes downloaded
+	BytecodeBytes  common.StorageSize // Number of bytecode bytes downloaded
+	StorageSynced  uint64             // Number of storage slots downloaded
+	StorageBytes   common.StorageSize // Number of storage trie bytes persisted to disk
+
+	// Status report during healing phase
+	TrienodeHealSynced uint64             // Number of state trie nodes downloaded
+	TrienodeHealBytes  common.StorageSize // Number of state trie bytes persisted to disk
+	BytecodeHealSynced uint64             // Number of bytecodes downloaded
+	BytecodeHealBytes  common.StorageSize // Number of bytecodes persisted to disk
+}
+
+// request is a network request in flight, tracking the parameters needed to
+// verify its response.
+type request struct {
+	peer string // Peer the request was sent to
+	code uint64 // Message code of the expected response
+
+	root     common.Hash   // State root the request is served from
+	origin   common.Hash   // First account or storage slot of the requested range
+	accounts []common.Hash // Accounts whose storage was requested
+	roots    []common.Hash // Storage roots of the requested accounts
+	hashes   []common.Hash // Hashes of the requested bytecodes or trie nodes
+
+	deliver chan interface{} // Verified response, nil if the request failed
+}
+
+// accountResponse is a verified account range response.
+type accountResponse struct {
+	hashes   []common.Hash // Account hashes in the returned range
+	accounts [][]byte      // Consensus RLP encoded accounts in the returned range
+	cont     bool          // Whether the account range has a continuation
+}
+
+// storageResponse is a verified storage ranges response.
+type storageResponse struct {
+	hashes [][]common.Hash // Storage slot hashes in the returned ranges
+	slots  [][][]byte      // Storage slot values in the returned ranges
+	cont   bool            // Whether the last storage range has a continuation
+}
+
+// Syncer is an Ethereum account and storage trie syncer based on snapshots and
+// the snap protocol. Its purpose is to download all the accounts and storage
+// slots from remote peers and reassemble chunks of the state trie, on top of
+// which a state sync can be run to fix any gaps / overlaps.
+type Syncer struct {
+	db    ethdb.KeyValueStore // Database to store the trie nodes into (and dedup)
+	bloom *trie.SyncBloom     // Bloom filter to deduplicate nodes for state fixup
+
+	root  common.Hash    // Current state trie root being synced
+	tasks []*accountTask // Current account task set being synced
+
+	peers     map[string]SyncPeer // Currently active peers to download from
+	idlers    map[string]struct{} // Peers not serving any request at the moment
+	stateless map[string]struct{} // Peers that failed to deliver state data
+	update    chan struct{}       // Notification channel for possible sync progression
+	requests  map[uint64]*request // Requests currently running
+
+	accountSynced      uint64             // Number of accounts downloaded
+	accountBytes       common.StorageSize // Number of account trie bytes persisted to disk
+	bytecodeSynced     uint64             // Number of bytecodes downloaded
+	bytecodeBytes      common.StorageSize // Number of bytecode bytes downloaded
+	storageSynced      uint64             // Number of storage slots downloaded
+	storageBytes       common.StorageSize // Number of storage trie bytes persisted to disk
+	trienodeHealSynced uint64             // Number of state trie nodes downloaded
+	trienodeHealBytes  common.StorageSize // Number of state trie bytes persisted to disk
+	bytecodeHealSynced uint64             // Number of bytecodes downloaded
+	bytecodeHealBytes  common.StorageSize // Number of bytecodes persisted to disk
+
+	startTime time.Time // Time instance when snapshot sync started
+	logTime   time.Time // Time instance when status was last reported
+
+	lock sync.RWMutex // Protects fields that can change outside of sync (peers, reqs, root)
+}
+
+// NewSyncer creates a new snapshot syncer to download the Ethereum state over the
+// snap protocol.
+func NewSyncer(db ethdb.KeyValueStore, bloom *trie.SyncBloom) *Syncer {
+	return &Syncer{
+		db:        db,
+		bloom:     bloom,
+		peers:     make(map[string]SyncPeer),
+		idlers:    make(map[string]struct{}),
+		stateless: make(map[string]struct{}),
+		update:    make(chan struct{}),
+		requests:  make(map[uint64]*request),
+	}
+}
+
+// Register injects a new data source into the syncer's peerset.
+func (s *Syncer) Register(peer SyncPeer) error {
+	// Make sure the peer is not registered yet
+	id := peer.ID()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.peers[id]; ok {
+		log.Error("Snap peer already registered", "id", id)
+		return errors.New("already registered")
+	}
+	s.peers[id] = peer
+	s.idlers[id] = struct{}{}
+
+	// Notify any active syncs that a new peer can be assigned data
+	s.notify()
+	return nil
+}
+
+// Unregister removes a peer from the syncer and fails all its pending requests.
+func (s *Syncer) Unregister(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.peers[id]; !ok {
+		log.Error("Snap peer not registered", "id", id)
+		return errors.New("not registered")
+	}
+	delete(s.peers, id)
+	delete(s.idlers, id)
+	delete(s.stateless, id)
+
+	for reqid, req := range s.requests {
+		if req.peer == id {
+			delete(s.requests, reqid)
+			req.deliver <- nil
+		}
+	}
+	return nil
+}
+
+// notify wakes up all goroutines waiting for an idle peer. The caller must hold
+// the lock.
+func (s *Syncer) notify() {
+	close(s.update)
+	s.update = make(chan struct{})
+}
+
+// Sync starts (or resumes a previous) sync cycle to iterate over a state trie
+// with the given root and reconstruct the nodes based on the snapshot leaves.
+// Previously downloaded segments will not be redownloaded or fixed, rather any
+// errors will be healed after the leaves are fully accumulated.
+func (s *Syncer) Sync(root common.Hash, cancel chan struct{}) error {
+	// Move the trie root from any previous value, revert stateless markers for
+	// any peers and initialize the syncer if it was not yet run
+	s.lock.Lock()
+	s.root = root
+	s.stateless = make(map[string]struct{})
+	s.lock.Unlock()
+
+	if s.startTime == (time.Time{}) {
+		s.startTime = time.Now()
+	}
+	// Retrieve the previous sync status from LevelDB and abort if already synced
+	s.loadSyncStatus()
+	log.Debug("Starting snapshot sync cycle", "root", root)
+	defer s.saveSyncStatus()
+
+	// Stop all workers if the sync is cancelled or any of them fails
+	var (
+		stop  = make(chan struct{})
+		once  sync.Once
+		abort = func() { once.Do(func() { close(stop) }) }
+	)
+	defer abort()
+	go func() {
+		select {
+		case <-cancel:
+			abort()
+		case <-stop:
+		}
+	}()
+	// Download the account ranges concurrently, each with its storage and code
+	errc := make(chan error, len(s.tasks))
+	for _, task := range s.tasks {
+		go func(task *accountTask) {
+			err := s.syncAccounts(task, stop)
+			if err != nil {
+				abort()
+			}
+			errc <- err
+		}(task)
+	}
+	var err error
+	for range s.tasks {
+		if e := <-errc; e != nil && err == nil {
+			err = e
+		}
+	}
+	s.cleanAccountTasks()
+	if err != nil {
+		return err
+	}
+	// All account ranges have been downloaded, fix up the trie by healing
+	if err := s.heal(stop); err != nil {
+		return err
+	}
+	s.reportSyncProgress(true)
+	log.Debug("Snapshot sync completed", "root", root)
+	return nil
+}
+
+// loadSyncStatus retrieves a previously aborted sync status from the database,
+// or generates a fresh one if none is available.
+func (s *Syncer) loadSyncStatus() {
+	var progress syncProgress
+
+	if status := rawdb.ReadSnapshotSyncStatus(s.db); status != nil {
+		if err := json.Unmarshal(status, &progress); err != nil {
+			log.Error("Failed to decode snap sync status", "err", err)
+		} else {
+			for _, task := range progress.Tasks {
+				log.Debug("Scheduled account sync task", "from", task.Next, "last", task.Last)
+			}
+			s.lock.Lock()
+			s.tasks = progress.Tasks
+
+			s.accountSynced, s.accountBytes = progress.AccountSynced, progress.AccountBytes
+			s.bytecodeSynced, s.bytecodeBytes = progress.BytecodeSynced, progress.BytecodeBytes
+			s.storageSynced, s.storageBytes = progress.StorageSynced, progress.StorageBytes
+			s.trienodeHealSynced, s.trienodeHealBytes = progress.TrienodeHealSynced, progress.TrienodeHealBytes
+			s.bytecodeHealSynced, s.bytecodeHealBytes = progress.BytecodeHealSynced, progress.BytecodeHealBytes
+			s.lock.Unlock()
+			return
+		}
+	}
+	// Either we've failed to decode the previous state, or there was none.
+	// Start a fresh sync by chunking up the account range and scheduling
+	// them for retrieval.
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.tasks = nil
+	s.accountSynced, s.accountBytes = 0, 0
+	s.bytecodeSynced, s.bytecodeBytes = 0, 0
+	s.storageSynced, s.storageBytes = 0, 0
+	s.trienodeHealSynced, s.trienodeHealBytes = 0, 0
+	s.bytecodeHealSynced, s.bytecodeHealBytes = 0, 0
+
+	var next common.Hash
+	step := new(big.Int).Sub(
+		new(big.Int).Div(
+			new(big.Int).Exp(common.Big2, common.Big256, nil),
+			big.NewInt(accountConcurrency),
+		), common.Big1,
+	)
+	for i := 0; i < accountConcurrency; i++ {
+		last := common.BigToHash(new(big.Int).Add(next.Big(), step))
+		if i == accountConcurrency-1 {
+			// Make sure we don't overflow if the step is not a proper divisor
+			last = common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+		}
+		s.tasks = append(s.tasks, &accountTask{
+			Next: next,
+			Last: last,
+		})
+		log.Debug("Created account sync task", "from", next, "last", last)
+		next = common.BigToHash(new(big.Int).Add(last.Big(), common.Big1))
+	}
+}
+
+// saveSyncStatus marshals the remaining sync tasks into leveldb.
+func (s *Syncer) saveSyncStatus() {
+	s.lock.RLock()
+	var tasks []*accountTask
+	for _, task := range s.tasks {
+		if !task.done {
+			tasks = append(tasks, task)
+		}
+	}
+	progress := &syncProgress{
+		Tasks:              tasks,
+		AccountSynced:      s.accountSynced,
+		AccountBytes:       s.accountBytes,
+		BytecodeSynced:     s.bytecodeSynced,
+		BytecodeBytes:      s.bytecodeBytes,
+		StorageSynced:      s.storageSynced,
+		StorageBytes:       s.storageBytes,
+		TrienodeHealSynced: s.trienodeHealSynced,
+		TrienodeHealBytes:  s.trienodeHealBytes,
+		BytecodeHealSynced: s.bytecodeHealSynced,
+		BytecodeHealBytes:  s.bytecodeHealBytes,
+	}
+	status, err := json.Marshal(progress)
+	s.lock.RUnlock()
+
+	if err != nil {
+		panic(err) // This can only fail during implementation
+	}
+	rawdb.WriteSnapshotSyncStatus(s.db, status)
+}
+
+// cleanAccountTasks removes account range retrieval tasks that have already been
+// completed.
+func (s *Syncer) cleanAccountTasks() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	tasks := s.tasks[:0]
+	for _, task := range s.tasks {
+		if !task.done {
+			tasks = append(tasks, task)
+		}
+	}
+	s.tasks = tasks
+}
+
+// syncAccounts downloads an account range chunk by chunk, along with the codes
+// and storage of the contained accounts, and reconstructs its part of the account
+// trie.
+func (s *Syncer) syncAccounts(task *accountTask, stop chan struct{}) error {
+	var (
+		batch   = s.db.NewBatch()
+		genTrie = trie.NewStackTrie(batch)
+	)
+	for !task.done {
+		res, err := s.fetchAccounts(task.Next, task.Last, stop)
+		if err != nil {
+			return err
+		}
+		// Ensure that the response doesn't overflow into the subsequent task
+		for i, hash := range res.hashes {
+			if cmp := bytes.Compare(hash[:], task.Last[:]); cmp >= 0 {
+				if cmp > 0 {
+					res.hashes, res.accounts = res.hashes[:i], res.accounts[:i]
+				} else {
+					res.hashes, res.accounts = res.hashes[:i+1], res.accounts[:i+1]
+				}
+				res.cont = false
+				break
+			}
+		}
+		accounts := make([]*state.Account, len(res.accounts))
+		for i, blob := range res.accounts {
+			accounts[i] = new(state.Account)
+			if err := rlp.DecodeBytes(blob, accounts[i]); err != nil {
+				return err
+			}
+		}
+		// Retrieve all the contract codes and storage slots before the accounts
+		// themselves, so a persisted account is always complete
+		if err := s.syncCodes(accounts, stop); err != nil {
+			return err
+		}
+		if err := s.syncStorage(res.hashes, accounts, stop); err != nil {
+			return err
+		}
+		for i, hash := range res.hashes {
+			acc := accounts[i]
+			rawdb.WriteAccountSnapshot(batch, hash, snapshot.SlimAccountRLP(acc.Nonce, acc.Balance, acc.Root, acc.CodeHash))
+			if err := genTrie.TryUpdate(hash[:], res.accounts[i]); err != nil {
+				return err
+			}
+		}
+		if !res.cont {
+			if _, err := genTrie.Commit(); err != nil {
+				return err
+			}
+		}
+		size := common.StorageSize(batch.ValueSize())
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+
+		s.lock.Lock()
+		s.accountSynced += uint64(len(res.hashes))
+		s.accountBytes += size
+		if res.cont {
+			task.Next = incHash(res.hashes[len(res.hashes)-1])
+		} else {
+			task.done = true
+		}
+		s.lock.Unlock()
+
+		s.saveSyncStatus()
+		s.reportSyncProgress(false)
+	}
+	return nil
+}
+
+// fetchAccounts retrieves and verifies the accounts of the range [origin, limit].
+func (s *Syncer) fetchAccounts(origin, limit common.Hash, stop chan struct{}) (*accountResponse, error) {
+	req := &request{
+		code:   AccountRangeMsg,
+		root:   s.root,
+		origin: origin,
+	}
+	res, err := s.fetch(req, stop, func(peer SyncPeer, id uint64) error {
+		return peer.RequestAccountRange(id, req.root, origin, limit, maxRequestSize)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*accountResponse), nil
+}
+
+// syncCodes retrieves all the contract codes of the given accounts that are not
+// yet present in the database.
+func (s *Syncer) syncCodes(accounts []*state.Account, stop chan struct{}) error {
+	var (
+		missing []common.Hash
+		seen    = make(map[common.Hash]struct{})
+	)
+	for _, acc := range accounts {
+		hash := common.BytesToHash(acc.CodeHash)
+		if hash == emptyCode {
+			continue
+		}
+		if _, ok := seen[hash]; ok {
+			continue
+		}
+		seen[hash] = struct{}{}
+		if len(rawdb.ReadCode(s.db, hash)) == 0 {
+			missing = append(missing, hash)
+		}
+	}
+	for len(missing) > 0 {
+		codes, err := s.fetchByteCodes(missing[:min(len(missing), maxCodeRequestCount)], stop)
+		if err != nil {
+			return err
+		}
+		var (
+			batch = s.db.NewBatch()
+			rest  []common.Hash
+		)
+		for i, code := range codes {
+			if code == nil {
+				rest = append(rest, missing[i])
+				continue
+			}
+			rawdb.WriteCode(batch, missing[i], code)
+		}
+		size := common.StorageSize(batch.ValueSize())
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		s.lock.Lock()
+		s.bytecodeSynced += uint64(len(codes) - len(rest))
+		s.bytecodeBytes += size
+		s.lock.Unlock()
+
+		missing = append(rest, missing[len(codes):]...)
+	}
+	return nil
+}
+
+// fetchByteCodes retrieves a batch of bytecodes. The returned codes are aligned
+// with the requested hashes, with nil entries for any code not delivered.
+func (s *Syncer) fetchByteCodes(hashes []common.Hash, stop chan struct{}) ([][]byte, error) {
+	req := &request{
+		code:   ByteCodesMsg,
+		hashes: hashes,
+	}
+	res, err := s.fetch(req, stop, func(peer SyncPeer, id uint64) error {
+		return peer.RequestByteCodes(id, hashes, maxRequestSize)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.([][]byte), nil
+}
+
+// syncStorage retrieves the storage slots of all the given accounts whose storage
+// trie is not yet present in the database.
+func (s *Syncer) syncStorage(hashes []common.Hash, accounts []*state.Account, stop chan struct{}) error {
+	var pending []int
+	for i, acc := range accounts {
+		if acc.Root == emptyRoot {
+			continue
+		}
+		// Storage tries are only persisted in full, so an existing root means
+		// the trie is already complete (e.g. a contract with duplicate storage)
+		if len(rawdb.ReadTrieNode(s.db, acc.Root)) > 0 {
+			continue
+		}
+		pending = append(pending, i)
+	}
+	for len(pending) > 0 {
+		req := &request{
+			code: StorageRangesMsg,
+			root: s.root,
+		}
+		for _, idx := range pending[:min(len(pending), maxStorageSetRequestCount)] {
+			req.accounts = append(req.accounts, hashes[idx])
+			req.roots = append(req.roots, accounts[idx].Root)
+		}
+		res, err := s.fetch(req, stop, func(peer SyncPeer, id uint64) error {
+			return peer.RequestStorageRanges(id, req.root, req.accounts, nil, nil, maxRequestSize)
+		})
+		if err != nil {
+			return err
+		}
+		storage := res.(*storageResponse)
+		for i := range storage.hashes {
+			cont := storage.cont && i == len(storage.hashes)-1
+			if err := s.storeStorage(req.accounts[i], req.roots[i], storage.hashes[i], storage.slots[i], cont, stop); err != nil {
+				return err
+			}
+		}
+		pending = pending[len(storage.hashes):]
+	}
+	return nil
+}
+
+// storeStorage persists the storage slots of an account and reconstructs its
+// storage trie. If the slots are only the beginning of the storage, the rest is
+// retrieved one range after the other.
+func (s *Syncer) storeStorage(account, root common.Hash, hashes []common.Hash, slots [][]byte, cont bool, stop chan struct{}) error {
+	var (
+		batch   = s.db.NewBatch()
+		genTrie = trie.NewStackTrie(batch)
+		synced  uint64
+		size    common.StorageSize
+	)
+	for {
+		for i, hash := range hashes {
+			rawdb.WriteStorageSnapshot(batch, account, hash, slots[i])
+			if err := genTrie.TryUpdate(hash[:], slots[i]); err != nil {
+				return err
+			}
+		}
+		synced += uint64(len(hashes))
+
+		if !cont {
+			break
+		}
+		// Large contract, flush what we have and retrieve the next range
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			size += common.StorageSize(batch.ValueSize())
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+		req := &request{
+			code:     StorageRangesMsg,
+			root:     s.root,
+			origin:   incHash(hashes[len(hashes)-1]),
+			accounts: []common.Hash{account},
+			roots:    []common.Hash{root},
+		}
+		res, err := s.fetch(req, stop, func(peer SyncPeer, id uint64) error {
+			return peer.RequestStorageRanges(id, req.root, req.accounts, req.origin[:], nil, maxRequestSize)
+		})
+		if err != nil {
+			return err
+		}
+		storage := res.(*storageResponse)
+		hashes, slots, cont = storage.hashes[0], storage.slots[0], storage.cont
+	}
+	if _, err := genTrie.Commit(); err != nil {
+		return err
+	}
+	size += common.StorageSize(batch.ValueSize())
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.storageSynced += synced
+	s.storageBytes += size
+	s.lock.Unlock()
+	return nil
+}
+
+// heal runs a state sync on top of the downloaded leaves, retrieving any trie
+// node or bytecode that's still missing due to the state changing while the
+// ranges were downloaded.
+func (s *Syncer) heal(stop chan struct{}) error {
+	batch := s.db.NewBatch()
+	sched := state.NewStateSync(s.root, s.db, s.bloom, func(paths [][]byte, leaf []byte) error {
+		return onHealState(batch, paths, leaf)
+	})
+	var (
+		trieTasks = make(map[common.Hash]trie.SyncPath)
+		codeTasks = make(map[common.Hash]struct{})
+	)
+	for {
+		// Refill the task lists with any newly discovered missing data
+		nodes, paths, codes := sched.Missing(0)
+		for i, hash := range nodes {
+			trieTasks[hash] = paths[i]
+		}
+		for _, hash := range codes {
+			codeTasks[hash] = struct{}{}
+		}
+		if len(trieTasks) == 0 && len(codeTasks) == 0 {
+			break
+		}
+		// Retrieve a batch of trie nodes and bytecodes concurrently
+		var (
+			nodeHashes []common.Hash
+			nodePaths  []TrieNodePathSet
+			codeHashes []common.Hash
+		)
+		for hash, path := range trieTasks {
+			if len(nodeHashes) >= maxTrieRequestCount {
+				break
+			}
+			nodeHashes = append(nodeHashes, hash)
+			nodePaths = append(nodePaths, TrieNodePathSet(path))
+		}
+		for hash := range codeTasks {
+			if len(codeHashes) >= maxCodeRequestCount {
+				break
+			}
+			codeHashes = append(codeHashes, hash)
+		}
+		var (
+			nodeBlobs, codeBlobs [][]byte
+			nodeErr, codeErr     error
+			wg                   sync.WaitGroup
+		)
+		if len(nodeHashes) > 0 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				nodeBlobs, nodeErr = s.fetchTrieNodes(nodeHashes, nodePaths, stop)
+			}()
+		}
+		if len(codeHashes) > 0 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				codeBlobs, codeErr = s.fetchByteCodes(codeHashes, stop)
+			}()
+		}
+		wg.Wait()
+		if nodeErr != nil {
+			return nodeErr
+		}
+		if codeErr != nil {
+			return codeErr
+		}
+		// Feed the delivered data into the scheduler, keeping the rest for retry
+		var (
+			nodeSynced, codeSynced uint64
+			codeBytes              common.StorageSize
+		)
+		for i, blob := range nodeBlobs {
+			if blob == nil {
+				continue
+			}
+			delete(trieTasks, nodeHashes[i])
+			if err := sched.Process(trie.SyncResult{Hash: nodeHashes[i], Data: blob}); err != nil && err != trie.ErrAlreadyProcessed {
+				return fmt.Errorf("invalid trie node %x: %v", nodeHashes[i], err)
+			}
+			nodeSynced++
+		}
+		for i, blob := range codeBlobs {
+			if blob == nil {
+				continue
+			}
+			delete(codeTasks, codeHashes[i])
+			if err := sched.Process(trie.SyncResult{Hash: codeHashes[i], Data: blob}); err != nil && err != trie.ErrAlreadyProcessed {
+				return fmt.Errorf("invalid bytecode %x: %v", codeHashes[i], err)
+			}
+			codeSynced++
+			codeBytes += common.StorageSize(len(blob))
+		}
+		if err := sched.Commit(batch); err != nil {
+			return err
+		}
+		size := common.StorageSize(batch.ValueSize())
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+
+		s.lock.Lock()
+		s.trienodeHealSynced += nodeSynced
+		s.trienodeHealBytes += size - codeBytes
+		s.bytecodeHealSynced += codeSynced
+		s.bytecodeHealBytes += codeBytes
+		s.lock.Unlock()
+
+		s.reportHealProgress()
+	}
+	if sched.Pending() > 0 {
+		return fmt.Errorf("state heal stalled with %d pending items", sched.Pending())
+	}
+	return nil
+}
+
+// onHealState is a callback method to invoke when a flat state (account or
+// storage slot) is downloaded during the healing stage. The flat states can
+// be persisted blindly and can be fixed later in the generation stage.
+func onHealState(batch ethdb.KeyValueWriter, paths [][]byte, value []byte) error {
+	switch len(paths) {
+	case 1:
+		var account state.Account
+		if err := rlp.DecodeBytes(value, &account); err != nil {
+			return nil
+		}
+		blob := snapshot.SlimAccountRLP(account.Nonce, account.Balance, account.Root, account.CodeHash)
+		rawdb.WriteAccountSnapshot(batch, common.BytesToHash(paths[0]), blob)
+	case 2:
+		rawdb.WriteStorageSnapshot(batch, common.BytesToHash(paths[0]), common.BytesToHash(paths[1]), value)
+	}
+	return nil
+}
+
+// fetchTrieNodes retrieves a batch of trie nodes. The returned nodes are aligned
+// with the requested hashes, with nil entries for any node not delivered.
+func (s *Syncer) fetchTrieNodes(hashes []common.Hash, paths []TrieNodePathSet, stop chan struct{}) ([][]byte, error) {
+	req := &request{
+		code:   TrieNodesMsg,
+		root:   s.root,
+		hashes: hashes,
+	}
+	res, err := s.fetch(req, stop, func(peer SyncPeer, id uint64) error {
+		return peer.RequestTrieNodes(id, req.root, paths, maxRequestSize)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.([][]byte), nil
+}
+
+// fetch sends a request to an idle peer and waits for its verified response.
+// Requests that fail, time out or are answered with unavailable data are retried
+// with another peer until the sync is stopped.
+func (s *Syncer) fetch(req *request, stop chan struct{}, send func(peer SyncPeer, id uint64) error) (interface{}, error) {
+	for {
+		peer, err := s.reserve(stop)
+		if err != nil {
+			return nil, err
+		}
+		// Track the request before sending it to not miss a quick response
+		deliver := make(chan interface{}, 1)
+
+		s.lock.Lock()
+		id := uint64(rand.Int63())
+		for s.requests[id] != nil {
+			id = uint64(rand.Int63())
+		}
+		req.peer, req.deliver = peer.ID(), deliver
+		s.requests[id] = req
+		s.lock.Unlock()
+
+		if err := send(peer, id); err != nil {
+			peer.Log().Debug("Failed to send snap request", "reqid", id, "err", err)
+			s.untrack(id)
+			s.release(peer.ID())
+			continue
+		}
+		timeout := time.NewTimer(requestTimeout)
+		select {
+		case res := <-deliver:
+			timeout.Stop()
+			s.release(peer.ID())
+			if res != nil {
+				return res, nil
+			}
+		case <-timeout.C:
+			peer.Log().Debug("Snap request timed out", "reqid", id)
+			s.untrack(id)
+			s.release(peer.ID())
+		case <-stop:
+			timeout.Stop()
+			s.untrack(id)
+			s.release(peer.ID())
+			return nil, errCancelled
+		}
+	}
+}
+
+// reserve waits until a peer able to serve the current state is idle and marks
+// it busy.
+func (s *Syncer) reserve(stop chan struct{}) (SyncPeer, error) {
+	for {
+		s.lock.Lock()
+		for id := range s.idlers {
+			if _, ok := s.stateless[id]; ok {
+				continue
+			}
+			delete(s.idlers, id)
+			peer := s.peers[id]
+			s.lock.Unlock()
+			return peer, nil
+		}
+		update := s.update
+		s.lock.Unlock()
+
+		select {
+		case <-update:
+		case <-stop:
+			return nil, errCancelled
+		}
+	}
+}
+
+// release marks a peer idle again, if it's still connected.
+func (s *Syncer) release(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.peers[id]; ok {
+		s.idlers[id] = struct{}{}
+		s.notify()
+	}
+}
+
+// untrack stops tracking a request, discarding any late response.
+func (s *Syncer) untrack(id uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.requests, id)
+}
+
+// claim retrieves and stops tracking the request a response was delivered for.
+// Nil is returned if the response is unexpected, e.g. because it timed out.
+func (s *Syncer) claim(peer SyncPeer, id uint64, code uint64) *request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	req := s.requests[id]
+	if req == nil || req.peer != peer.ID() || req.code != code {
+		peer.Log().Debug("Unexpected snap response", "reqid", id, "code", code)
+		return nil
+	}
+	delete(s.requests, id)
+	return req
+}
+
+// markStateless flags a peer as unable to serve the current state root. It will
+// not be assigned requests until the next sync cycle.
+func (s *Syncer) markStateless(peer SyncPeer, req *request) {
+	peer.Log().Debug("Peer rejected snap request", "root", req.root)
+
+	s.lock.Lock()
+	s.stateless[peer.ID()] = struct{}{}
+	s.lock.Unlock()
+
+	req.deliver <- nil
+}
+
+// OnAccounts is a callback method to invoke when a range of accounts are
+// received from a remote peer.
+func (s *Syncer) OnAccounts(peer SyncPeer, id uint64, hashes []common.Hash, accounts [][]byte, proof [][]byte) error {
+	req := s.claim(peer, id, AccountRangeMsg)
+	if req == nil {
+		return nil
+	}
+	// An empty response means the peer does not have the requested state
+	if len(hashes) == 0 && len(proof) == 0 {
+		s.markStateless(peer, req)
+		return nil
+	}
+	// Reconstruct a partial trie from the response and verify it
+	keys := make([][]byte, len(hashes))
+	for i, key := range hashes {
+		keys[i] = common.CopyBytes(key[:])
+	}
+	var end []byte
+	if len(keys) > 0 {
+		end = keys[len(keys)-1]
+	}
+	cont, err := trie.VerifyRangeProof(req.root, req.origin[:], end, keys, accounts, proofDatabase(proof))
+	if err != nil {
+		peer.Log().Warn("Account range failed proof", "err", err)
+		req.deliver <- nil
+		return err
+	}
+	req.deliver <- &accountResponse{
+		hashes:   hashes,
+		accounts: accounts,
+		cont:     cont,
+	}
+	return nil
+}
+
+// OnStorage is a callback method to invoke when ranges of storage slots are
+// received from a remote peer.
+func (s *Syncer) OnStorage(peer SyncPeer, id uint64, hashes [][]common.Hash, slots [][][]byte, proof [][]byte) error {
+	req := s.claim(peer, id, StorageRangesMsg)
+	if req == nil {
+		return nil
+	}
+	// An empty response means the peer does not have the requested state
+	if len(hashes) == 0 {
+		s.markStateless(peer, req)
+		return nil
+	}
+	fail := func(err error) error {
+		peer.Log().Warn("Storage slots failed proof", "err", err)
+		req.deliver <- nil
+		return err
+	}
+	if len(hashes) > len(req.accounts) {
+		return fail(fmt.Errorf("%w: accounts %d > requested %d", errBadRequest, len(hashes), len(req.accounts)))
+	}
+	if len(hashes) != len(slots) {
+		return fail(fmt.Errorf("%w: hash and slot set size mismatch %d != %d", errBadRequest, len(hashes), len(slots)))
+	}
+	var cont bool
+	for i := range hashes {
+		keys := make([][]byte, len(hashes[i]))
+		for j, key := range hashes[i] {
+			keys[j] = common.CopyBytes(key[:])
+		}
+		// Every storage range but the last one must be complete, and so must be
+		// the last one if no proof was attached
+		if i < len(hashes)-1 || len(proof) == 0 {
+			if _, err := trie.VerifyRangeProof(req.roots[i], nil, nil, keys, slots[i], nil); err != nil {
+				return fail(err)
+			}
+			continue
+		}
+		var end []byte
+		if len(keys) > 0 {
+			end = keys[len(keys)-1]
+		}
+		var err error
+		cont, err = trie.VerifyRangeProof(req.roots[i], req.origin[:], end, keys, slots[i], proofDatabase(proof))
+		if err != nil {
+			return fail(err)
+		}
+		if cont && len(keys) == 0 {
+			return fail(errors.New("empty storage range with continuation"))
+		}
+	}
+	req.deliver <- &storageResponse{
+		hashes: hashes,
+		slots:  slots,
+		cont:   cont,
+	}
+	return nil
+}
+
+// OnByteCodes is a callback method to invoke when a batch of contract
+// bytes codes are received from a remote peer.
+func (s *Syncer) OnByteCodes(peer SyncPeer, id uint64, bytecodes [][]byte) error {
+	req := s.claim(peer, id, ByteCodesMsg)
+	if req == nil {
+		return nil
+	}
+	return s.onHashedBlobs(peer, req, bytecodes)
+}
+
+// OnTrieNodes is a callback method to invoke when a batch of trie nodes
+// are received from a remote peer.
+func (s *Syncer) OnTrieNodes(peer SyncPeer, id uint64, trienodes [][]byte) error {
+	req := s.claim(peer, id, TrieNodesMsg)
+	if req == nil {
+		return nil
+	}
+	return s.onHashedBlobs(peer, req, trienodes)
+}
+
+// onHashedBlobs cross references the requested hashes with a bytecode or trie
+// node response to find the gaps that the serving node is missing.
+func (s *Syncer) onHashedBlobs(peer SyncPeer, req *request, blobs [][]byte) error {
+	// An empty response means the peer does not have the requested state
+	if len(blobs) == 0 {
+		s.markStateless(peer, req)
+		return nil
+	}
+	aligned := make([][]byte, len(req.hashes))
+	for i, j := 0, 0; i < len(blobs); i++ {
+		hash := crypto.Keccak256Hash(blobs[i])
+		for j < len(req.hashes) && hash != req.hashes[j] {
+			j++
+		}
+		if j == len(req.hashes) {
+			// We've either ran out of hashes, or got unrequested data
+			peer.Log().Warn("Unexpected data delivered", "code", req.code, "count", len(blobs)-i)
+			req.deliver <- nil
+			return fmt.Errorf("%w: unexpected data %x", errBadRequest, hash)
+		}
+		aligned[j] = blobs[i]
+		j++
+	}
+	req.deliver <- aligned
+	return nil
+}
+
+// reportSyncProgress calculates various status reports and provides it to the user.
+func (s *Syncer) reportSyncProgress(force bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Don't report all the events, just occasionally
+	if !force && time.Since(s.logTime) < statusLogInterval {
+		return
+	}
+	s.logTime = time.Now()
+
+	// Estimate the progress from the covered parts of the account hash space
+	var remaining = new(big.Int)
+	for _, task := range s.tasks {
+		if !task.done {
+			remaining.Add(remaining, new(big.Int).Sub(task.Last.Big(), task.Next.Big()))
+		}
+	}
+	total := new(big.Int).Exp(common.Big2, common.Big256, nil)
+	done := new(big.Float).Quo(new(big.Float).SetInt(new(big.Int).Sub(total, remaining)), new(big.Float).SetInt(total))
+	percent, _ := done.Float64()
+
+	var (
+		accounts = fmt.Sprintf("%d@%v", s.accountSynced, s.accountBytes.TerminalString())
+		storage  = fmt.Sprintf("%d@%v", s.storageSynced, s.storageBytes.TerminalString())
+		bytecode = fmt.Sprintf("%d@%v", s.bytecodeSynced, s.bytecodeBytes.TerminalString())
+	)
+	log.Info("State sync in progress", "synced", fmt.Sprintf("%.2f%%", percent*100), "accounts", accounts,
+		"slots", storage, "codes", bytecode, "elapsed", common.PrettyDuration(time.Since(s.startTime)))
+}
+
+// reportHealProgress calculates various status reports and provides it to the user.
+func (s *Syncer) reportHealProgress() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Don't report all the events, just occasionally
+	if time.Since(s.logTime) < statusLogInterval {
+		return
+	}
+	s.logTime = time.Now()
+
+	var (
+		trienode = fmt.Sprintf("%d@%v", s.trienodeHealSynced, s.trienodeHealBytes.TerminalString())
+		bytecode = fmt.Sprintf("%d@%v", s.bytecodeHealSynced, s.bytecodeHealBytes.TerminalString())
+	)
+	log.Info("State heal in progress", "nodes", trienode, "codes", bytecode)
+}
+
+// proofDatabase collects a list of proof nodes into a database keyed by their hash.
+func proofDatabase(proof [][]byte) ethdb.KeyValueReader {
+	db := memorydb.New()
+	for _, node := range proof {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	return db
+}
+
+// incHash returns the next hash, in lexicographical order (a.k.a plus one).
+func incHash(h common.Hash) common.Hash {
+	for i := len(h) - 1; i >= 0; i-- {
+		h[i]++
+		if h[i] != 0 {
+			break
+		}
+	}
+	return h
+}
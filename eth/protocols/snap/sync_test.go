@@ -0,0 +1,329 @@
+// Copyright 2020 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snap
+
+import (
+	"fmt"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/core/state"
+	"github.com/QuantumCoinProject/qc/core/state/snapshot"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/rlp"
+	"github.com/QuantumCoinProject/qc/trie"
+)
+
+// testSource is a state served by the test peers.
+type testSource struct {
+	root   common.Hash
+	diskdb ethdb.KeyValueStore
+	triedb *trie.Database
+	snaps  *snapshot.Tree
+}
+
+// newTestSource creates a state with plain accounts, contracts with code, small
+// storage tries and one storage trie too large to be served in one response.
+func newTestSource(t *testing.T) *testSource {
+	diskdb := rawdb.NewMemoryDatabase()
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(diskdb), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 200; i++ {
+		addr := common.BigToAddress(big.NewInt(int64(i)))
+		statedb.SetBalance(addr, big.NewInt(int64(i)))
+		statedb.SetNonce(addr, uint64(i))
+
+		if i%10 == 0 {
+			statedb.SetCode(addr, []byte(fmt.Sprintf("code-%d", i%30)))
+		}
+		if i%40 == 0 {
+			for j := 1; j <= 20; j++ {
+				statedb.SetState(addr, common.BigToHash(big.NewInt(int64(j))), common.BigToHash(big.NewInt(int64(i*j))))
+			}
+		}
+	}
+	large := common.BigToAddress(big.NewInt(1000))
+	statedb.SetBalance(large, big.NewInt(1))
+	for j := 1; j <= 12000; j++ {
+		statedb.SetState(large, common.BigToHash(big.NewInt(int64(j))), common.BigToHash(big.NewInt(int64(j))))
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	triedb := statedb.Database().TrieDB()
+	if err := triedb.Commit(root, false, nil); err != nil {
+		t.Fatal(err)
+	}
+	snaps, err := snapshot.New(diskdb, triedb, 16, root, false, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSource{root: root, diskdb: diskdb, triedb: triedb, snaps: snaps}
+}
+
+// testPeer is a snap peer serving a test source straight to a syncer.
+type testPeer struct {
+	id     string
+	syncer *Syncer
+	source *testSource
+	logger log.Logger
+
+	stateless bool // Whether to reply to every request with an empty response
+	corrupt   bool // Whether to tamper with the served accounts
+
+	failures int32 // Number of responses rejected by the syncer
+}
+
+func newTestPeer(id string, syncer *Syncer, source *testSource) *testPeer {
+	return &testPeer{
+		id:     id,
+		syncer: syncer,
+		source: source,
+		logger: log.New("id", id),
+	}
+}
+
+func (p *testPeer) ID() string      { return p.id }
+func (p *testPeer) Log() log.Logger { return p.logger }
+
+func (p *testPeer) track(err error) {
+	if err != nil {
+		atomic.AddInt32(&p.failures, 1)
+	}
+}
+
+func (p *testPeer) RequestAccountRange(id uint64, root, origin, limit common.Hash, bytes uint64) error {
+	go func() {
+		var (
+			accounts []*AccountData
+			proof    [][]byte
+		)
+		if !p.stateless {
+			accounts, proof = serviceAccountRange(p.source.triedb, p.source.snaps, &GetAccountRangePacket{
+				ID:     id,
+				Root:   root,
+				Origin: origin,
+				Limit:  limit,
+				Bytes:  bytes,
+			})
+		}
+		if p.corrupt && len(accounts) > 0 {
+			acc, _ := snapshot.FullAccount(accounts[0].Body)
+			accounts[0].Body = snapshot.SlimAccountRLP(acc.Nonce+1, acc.Balance, common.BytesToHash(acc.Root), acc.CodeHash)
+		}
+		hashes, blobs, err := (&AccountRangePacket{Accounts: accounts, Proof: proof}).Unpack()
+		if err != nil {
+			panic(err)
+		}
+		p.track(p.syncer.OnAccounts(p, id, hashes, blobs, proof))
+	}()
+	return nil
+}
+
+func (p *testPeer) RequestStorageRanges(id uint64, root common.Hash, accounts []common.Hash, origin, limit []byte, bytes uint64) error {
+	go func() {
+		var (
+			slots [][]*StorageData
+			proof [][]byte
+		)
+		if !p.stateless {
+			slots, proof = serviceStorageRanges(p.source.triedb, p.source.snaps, &GetStorageRangesPacket{
+				ID:       id,
+				Root:     root,
+				Accounts: accounts,
+				Origin:   origin,
+				Limit:    limit,
+				Bytes:    bytes,
+			})
+		}
+		hashes, blobs := (&StorageRangesPacket{Slots: slots}).Unpack()
+		p.track(p.syncer.OnStorage(p, id, hashes, blobs, proof))
+	}()
+	return nil
+}
+
+func (p *testPeer) RequestByteCodes(id uint64, hashes []common.Hash, bytes uint64) error {
+	go func() {
+		var codes [][]byte
+		if !p.stateless {
+			codes = serviceByteCodes(p.source.diskdb, &GetByteCodesPacket{ID: id, Hashes: hashes, Bytes: bytes})
+		}
+		p.track(p.syncer.OnByteCodes(p, id, codes))
+	}()
+	return nil
+}
+
+func (p *testPeer) RequestTrieNodes(id uint64, root common.Hash, paths []TrieNodePathSet, bytes uint64) error {
+	go func() {
+		var nodes [][]byte
+		if !p.stateless {
+			var err error
+			nodes, err = serviceTrieNodes(p.source.triedb, p.source.snaps, &GetTrieNodesPacket{
+				ID:    id,
+				Root:  root,
+				Paths: paths,
+				Bytes: bytes,
+			}, time.Now())
+			if err != nil {
+				panic(err)
+			}
+		}
+		p.track(p.syncer.OnTrieNodes(p, id, nodes))
+	}()
+	return nil
+}
+
+// runSync syncs the source state into an empty database with the given peers.
+func runSync(t *testing.T, db ethdb.KeyValueStore, syncer *Syncer, source *testSource, peers ...*testPeer) {
+	for _, peer := range peers {
+		if err := syncer.Register(peer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	done := make(chan error, 1)
+	cancel := make(chan struct{})
+	go func() { done <- syncer.Sync(source.root, cancel) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("sync failed: %v", err)
+		}
+	case <-time.After(time.Minute):
+		close(cancel)
+		t.Fatal("sync timed out")
+	}
+	verifyState(t, db, source)
+}
+
+// verifyState checks that the synced database contains the full state trie with
+// all storage tries and codes, and the flat account snapshot.
+func verifyState(t *testing.T, db ethdb.KeyValueStore, source *testSource) {
+	triedb := trie.NewDatabase(db)
+	accTrie, err := trie.New(source.root, triedb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var accounts, slots int
+	it := trie.NewIterator(accTrie.NodeIterator(nil))
+	for it.Next() {
+		accounts++
+
+		var acc state.Account
+		if err := rlp.DecodeBytes(it.Value, &acc); err != nil {
+			t.Fatal(err)
+		}
+		if rawdb.ReadAccountSnapshot(db, common.BytesToHash(it.Key)) == nil {
+			t.Errorf("account %x missing from snapshot", it.Key)
+		}
+		if hash := common.BytesToHash(acc.CodeHash); hash != emptyCode && len(rawdb.ReadCode(db, hash)) == 0 {
+			t.Errorf("account %x: code %x missing", it.Key, hash)
+		}
+		stTrie, err := trie.New(acc.Root, triedb)
+		if err != nil {
+			t.Fatalf("account %x: %v", it.Key, err)
+		}
+		stIt := trie.NewIterator(stTrie.NodeIterator(nil))
+		for stIt.Next() {
+			slots++
+		}
+		if stIt.Err != nil {
+			t.Fatalf("account %x: storage incomplete: %v", it.Key, stIt.Err)
+		}
+	}
+	if it.Err != nil {
+		t.Fatalf("account trie incomplete: %v", it.Err)
+	}
+	if accounts != 201 || slots != 5*20+12000 {
+		t.Fatalf("synced %d accounts and %d slots, want %d and %d", accounts, slots, 201, 5*20+12000)
+	}
+}
+
+func TestSync(t *testing.T) {
+	source := newTestSource(t)
+	db := rawdb.NewMemoryDatabase()
+	syncer := NewSyncer(db, nil)
+
+	runSync(t, db, syncer, source, newTestPeer("a", syncer, source), newTestPeer("b", syncer, source))
+}
+
+func TestSyncStatelessPeer(t *testing.T) {
+	source := newTestSource(t)
+	db := rawdb.NewMemoryDatabase()
+	syncer := NewSyncer(db, nil)
+
+	stateless := newTestPeer("stateless", syncer, source)
+	stateless.stateless = true
+
+	runSync(t, db, syncer, source, stateless, newTestPeer("good", syncer, source))
+	if atomic.LoadInt32(&stateless.failures) != 0 {
+		t.Fatalf("stateless peer penalized %d times", stateless.failures)
+	}
+}
+
+func TestSyncCorruptPeer(t *testing.T) {
+	source := newTestSource(t)
+	db := rawdb.NewMemoryDatabase()
+	syncer := NewSyncer(db, nil)
+
+	corrupt := newTestPeer("corrupt", syncer, source)
+	corrupt.corrupt = true
+
+	// The corrupt peer is never unregistered, so it keeps getting requests that
+	// must all be rejected
+	runSync(t, db, syncer, source, corrupt, newTestPeer("good", syncer, source))
+	if atomic.LoadInt32(&corrupt.failures) == 0 {
+		t.Fatal("corrupt account ranges accepted")
+	}
+}
+
+func TestSyncHeal(t *testing.T) {
+	source := newTestSource(t)
+	db := rawdb.NewMemoryDatabase()
+
+	// A stored status without account tasks resumes a sync whose ranges were
+	// all downloaded, so the entire state is retrieved by healing
+	rawdb.WriteSnapshotSyncStatus(db, []byte(`{}`))
+	syncer := NewSyncer(db, nil)
+
+	runSync(t, db, syncer, source, newTestPeer("a", syncer, source))
+	if syncer.trienodeHealSynced == 0 || syncer.accountSynced != 0 {
+		t.Fatalf("healed %d nodes and synced %d accounts", syncer.trienodeHealSynced, syncer.accountSynced)
+	}
+}
+
+func TestIncHash(t *testing.T) {
+	tests := []struct {
+		in, want common.Hash
+	}{
+		{common.Hash{}, common.BigToHash(common.Big1)},
+		{common.BigToHash(big.NewInt(0xff)), common.BigToHash(big.NewInt(0x100))},
+	}
+	for _, test := range tests {
+		if have := incHash(test.in); have != test.want {
+			t.Errorf("incHash(%x) = %x, want %x", test.in, have, test.want)
+		}
+	}
+}
@@ -173,6 +173,13 @@ func (ec *Client) GetBlockConsensusData(ctx context.Context, number *big.Int) (*
 	return consensusData, err
 }
 
+// ListValidators returns the validators and their staking details at the given block.
+func (ec *Client) ListValidators(ctx context.Context, number *big.Int) ([]*proofofstake.ValidatorDetails, error) {
+	var validators []*proofofstake.ValidatorDetails
+	err := ec.c.CallContext(ctx, &validators, "proofofstake_listValidators", hexutil.EncodeBig(number))
+	return validators, err
+}
+
 type rpcTransaction struct {
 	tx *types.Transaction
 	TxExtraInfo
@@ -291,6 +298,32 @@ func (ec *Client) TransactionReceipt(ctx context.Context, txHash common.Hash) (*
 	return r, err
 }
 
+// TransactionReceipts returns the receipts of several transactions, retrieved
+// with a single batch request.
+func (ec *Client) TransactionReceipts(ctx context.Context, txHashes []common.Hash) ([]*types.Receipt, error) {
+	receipts := make([]*types.Receipt, len(txHashes))
+	reqs := make([]rpc.BatchElem, len(txHashes))
+	for i, hash := range txHashes {
+		reqs[i] = rpc.BatchElem{
+			Method: "eth_getTransactionReceipt",
+			Args:   []interface{}{hash},
+			Result: &receipts[i],
+		}
+	}
+	if err := ec.c.BatchCallContext(ctx, reqs); err != nil {
+		return nil, err
+	}
+	for i := range reqs {
+		if reqs[i].Error != nil {
+			return nil, reqs[i].Error
+		}
+		if receipts[i] == nil {
+			return nil, ethereum.NotFound
+		}
+	}
+	return receipts, nil
+}
+
 type rpcProgress struct {
 	StartingBlock hexutil.Uint64
 	CurrentBlock  hexutil.Uint64
@@ -353,6 +386,31 @@ func (ec *Client) BalanceAt(ctx context.Context, account common.Address, blockNu
 	return (*big.Int)(&result), err
 }
 
+// BalancesAt returns the wei balances of several accounts at the same block,
+// retrieved with a single batch request.
+func (ec *Client) BalancesAt(ctx context.Context, accounts []common.Address, blockNumber *big.Int) ([]*big.Int, error) {
+	results := make([]hexutil.Big, len(accounts))
+	reqs := make([]rpc.BatchElem, len(accounts))
+	for i, account := range accounts {
+		reqs[i] = rpc.BatchElem{
+			Method: "eth_getBalance",
+			Args:   []interface{}{account, toBlockNumArg(blockNumber)},
+			Result: &results[i],
+		}
+	}
+	if err := ec.c.BatchCallContext(ctx, reqs); err != nil {
+		return nil, err
+	}
+	balances := make([]*big.Int, len(accounts))
+	for i := range reqs {
+		if reqs[i].Error != nil {
+			return nil, reqs[i].Error
+		}
+		balances[i] = (*big.Int)(&results[i])
+	}
+	return balances, nil
+}
+
 // StorageAt returns the value of key in the contract storage of the given account.
 // The block number can be nil, in which case the value is taken from the latest known block.
 func (ec *Client) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
@@ -664,9 +722,11 @@ func (ec *Client) GetAccountTokenBalance(contactAddress common.Address, accountA
 }
 
 type InternalTransactionDetails struct {
+	Type  string                       `json:"type,omitempty"`
 	From  string                       `json:"from,omitempty"`
 	To    string                       `json:"to,omitempty"`
 	Value string                       `json:"value,omitempty"`
+	Error string                       `json:"error,omitempty"`
 	Calls []InternalTransactionDetails `json:"calls,omitempty"`
 }
 
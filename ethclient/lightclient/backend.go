@@ -0,0 +1,102 @@
+package lightclient
+
+import (
+	"context"
+	"math/big"
+
+	ethereum "github.com/QuantumCoinProject/qc"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/ethclient"
+	"github.com/QuantumCoinProject/qc/ethclient/gethclient"
+	"github.com/QuantumCoinProject/qc/rpc"
+)
+
+// Backend is the untrusted data source of the light client. Nothing returned by
+// it is handed out to users before being verified against a header that the
+// validators committed to.
+type Backend interface {
+	// BlockNumber returns the number of the most recent block known to the backend.
+	BlockNumber(ctx context.Context) (uint64, error)
+
+	// HeaderRlp returns the RLP encoding of a canonical header, including the
+	// unhashed consensus data carrying the commit packets.
+	HeaderRlp(ctx context.Context, number uint64) ([]byte, error)
+
+	// GetProof returns the Merkle proofs of an account and some of its storage
+	// slots at the given block number.
+	GetProof(ctx context.Context, account common.Address, keys []string, blockNumber *big.Int) (*gethclient.AccountResult, error)
+
+	// BlockByHash returns the block with the given hash.
+	BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error)
+
+	// TransactionReceipt returns the receipt of a transaction.
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+
+	// TransactionReceipts returns the receipts of the given transactions.
+	TransactionReceipts(ctx context.Context, txHashes []common.Hash) ([]*types.Receipt, error)
+}
+
+// rpcBackend is a Backend served by a node over RPC.
+type rpcBackend struct {
+	c  *rpc.Client
+	ec *ethclient.Client
+	gc *gethclient.Client
+}
+
+// NewRPCBackend creates a light client backend that uses the given RPC client.
+// The node must expose the eth and debug namespaces.
+func NewRPCBackend(c *rpc.Client) Backend {
+	return &rpcBackend{c: c, ec: ethclient.NewClient(c), gc: gethclient.New(c)}
+}
+
+func (b *rpcBackend) BlockNumber(ctx context.Context) (uint64, error) {
+	return b.ec.BlockNumber(ctx)
+}
+
+func (b *rpcBackend) HeaderRlp(ctx context.Context, number uint64) ([]byte, error) {
+	var encoded string
+	if err := b.c.CallContext(ctx, &encoded, "debug_getHeaderRlp", number); err != nil {
+		return nil, err
+	}
+	return hexutil.Decode("0x" + encoded)
+}
+
+func (b *rpcBackend) GetProof(ctx context.Context, account common.Address, keys []string, blockNumber *big.Int) (*gethclient.AccountResult, error) {
+	return b.gc.GetProof(ctx, account, keys, blockNumber)
+}
+
+func (b *rpcBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	return b.ec.BlockByHash(ctx, hash)
+}
+
+func (b *rpcBackend) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	return b.ec.TransactionReceipt(ctx, txHash)
+}
+
+func (b *rpcBackend) TransactionReceipts(ctx context.Context, txHashes []common.Hash) ([]*types.Receipt, error) {
+	var (
+		receipts = make([]*types.Receipt, len(txHashes))
+		batch    = make([]rpc.BatchElem, len(txHashes))
+	)
+	for i, hash := range txHashes {
+		batch[i] = rpc.BatchElem{
+			Method: "eth_getTransactionReceipt",
+			Args:   []interface{}{hash},
+			Result: &receipts[i],
+		}
+	}
+	if err := b.c.BatchCallContext(ctx, batch); err != nil {
+		return nil, err
+	}
+	for i := range batch {
+		if batch[i].Error != nil {
+			return nil, batch[i].Error
+		}
+		if receipts[i] == nil {
+			return nil, ethereum.NotFound
+		}
+	}
+	return receipts, nil
+}
@@ -0,0 +1,403 @@
+// Package lightclient provides a client that follows the chain from a trusted
+// checkpoint and verifies everything an untrusted node returns.
+//
+// A header is accepted once the header built on top of it carries commit packets
+// signed over its hash by validators holding enough of the stake of the last
+// verified validator set. The validator set itself is tracked by proving the
+// staking contract storage against each verified state root. Balances, nonces,
+// storage and receipts are only served once proven against a verified header.
+package lightclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/consensus/proofofstake"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/crypto"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/rlp"
+	"github.com/QuantumCoinProject/qc/rpc"
+	"github.com/QuantumCoinProject/qc/trie"
+)
+
+var (
+	errCheckpointMismatch = errors.New("checkpoint hash mismatch")
+	errNoValidators       = errors.New("no active validators")
+	errUnknownAncestor    = errors.New("header does not extend the verified chain")
+
+	// ErrNotVerified is returned when the requested block is ahead of the
+	// verified head.
+	ErrNotVerified = errors.New("block not verified yet")
+)
+
+// Checkpoint is a block the client trusts without verification.
+type Checkpoint struct {
+	Number uint64      `toml:",omitempty"`
+	Hash   common.Hash `toml:",omitempty"`
+}
+
+// Config contains the settings of the light client.
+type Config struct {
+	// Checkpoint is the trusted block to start following the chain from.
+	Checkpoint Checkpoint
+
+	// TrustPercentage is the percentage of the stake of the verified validator
+	// set that has to commit to a header before it is accepted. Above a third,
+	// at least one honest validator committed as long as less than a third of
+	// the stake is byzantine.
+	TrustPercentage uint64 `toml:",omitempty"`
+
+	// HeaderCache is the number of recent verified headers kept in memory. Older
+	// headers are verified on demand by walking the parent hashes back.
+	HeaderCache int `toml:",omitempty"`
+}
+
+// DefaultConfig contains the default light client settings, without a checkpoint.
+var DefaultConfig = Config{
+	TrustPercentage: 34,
+	HeaderCache:     1024,
+}
+
+// Client is a light client verifying the data served by an untrusted backend.
+type Client struct {
+	backend Backend
+	config  Config
+
+	lock       sync.RWMutex
+	head       *types.Header               // Latest verified header
+	validators map[common.Address]*big.Int // Validator deposits at the head state
+	headers    map[uint64]*types.Header    // Recent verified headers by number
+}
+
+// Dial connects a light client to the node at the given URL.
+func Dial(ctx context.Context, rawurl string, config Config) (*Client, error) {
+	c, err := rpc.DialContext(ctx, rawurl)
+	if err != nil {
+		return nil, err
+	}
+	return New(ctx, NewRPCBackend(c), config)
+}
+
+// New creates a light client on top of the given backend, retrieving the
+// checkpoint header and the validator set at its state.
+func New(ctx context.Context, backend Backend, config Config) (*Client, error) {
+	if config.TrustPercentage == 0 {
+		config.TrustPercentage = DefaultConfig.TrustPercentage
+	}
+	if config.TrustPercentage > 100 {
+		return nil, fmt.Errorf("invalid trust percentage %d", config.TrustPercentage)
+	}
+	if config.HeaderCache <= 0 {
+		config.HeaderCache = DefaultConfig.HeaderCache
+	}
+	c := &Client{
+		backend: backend,
+		config:  config,
+		headers: make(map[uint64]*types.Header),
+	}
+	header, err := c.fetchHeader(ctx, config.Checkpoint.Number)
+	if err != nil {
+		return nil, err
+	}
+	if header.Hash() != config.Checkpoint.Hash {
+		return nil, fmt.Errorf("%w: have %x, want %x", errCheckpointMismatch, header.Hash(), config.Checkpoint.Hash)
+	}
+	validators, err := c.proveValidators(ctx, header)
+	if err != nil {
+		return nil, err
+	}
+	c.setHead(header, validators)
+	return c, nil
+}
+
+// Head returns the latest verified header.
+func (c *Client) Head() *types.Header {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return types.CopyHeader(c.head)
+}
+
+// Validators returns the validator deposits at the state of the verified head.
+func (c *Client) Validators() map[common.Address]*big.Int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	validators := make(map[common.Address]*big.Int, len(c.validators))
+	for validator, deposit := range c.validators {
+		validators[validator] = new(big.Int).Set(deposit)
+	}
+	return validators
+}
+
+// Sync verifies the headers of the backend up to its latest block. As a header
+// is verified by the commits in its child, the verified head trails the backend
+// by one block.
+func (c *Client) Sync(ctx context.Context) error {
+	latest, err := c.backend.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+	for {
+		head := c.Head()
+		if head.Number.Uint64()+1 >= latest {
+			return nil
+		}
+		if err := c.verifyNext(ctx, head); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// verifyNext verifies the child of the given head using the commit packets of
+// its own child, then moves the head and the validator set forward.
+func (c *Client) verifyNext(ctx context.Context, head *types.Header) error {
+	number := head.Number.Uint64() + 1
+
+	header, err := c.fetchHeader(ctx, number)
+	if err != nil {
+		return err
+	}
+	if header.ParentHash != head.Hash() {
+		return fmt.Errorf("%w: header #%d parent %x, verified %x", errUnknownAncestor, number, header.ParentHash, head.Hash())
+	}
+	child, err := c.fetchHeader(ctx, number+1)
+	if err != nil {
+		return err
+	}
+	if child.ParentHash != header.Hash() {
+		return fmt.Errorf("%w: header #%d parent %x, fetched %x", errUnknownAncestor, number+1, child.ParentHash, header.Hash())
+	}
+
+	c.lock.RLock()
+	validators := c.validators
+	c.lock.RUnlock()
+
+	committed, err := proofofstake.VerifyCommitPackets(child, validators)
+	if err != nil {
+		return fmt.Errorf("header #%d: %v", number, err)
+	}
+	total := new(big.Int)
+	for _, deposit := range validators {
+		total.Add(total, deposit)
+	}
+	required := new(big.Int).Mul(total, new(big.Int).SetUint64(c.config.TrustPercentage))
+	if new(big.Int).Mul(committed, big.NewInt(100)).Cmp(required) < 0 || committed.Sign() == 0 {
+		return fmt.Errorf("header #%d: committed stake %v of %v below %d%%", number, committed, total, c.config.TrustPercentage)
+	}
+
+	next, err := c.proveValidators(ctx, header)
+	if err != nil {
+		return err
+	}
+	c.setHead(header, next)
+
+	log.Debug("Verified light client header", "number", number, "hash", header.Hash(), "committed", committed, "total", total)
+	return nil
+}
+
+// setHead moves the verified head forward and drops headers falling out of the
+// cache window.
+func (c *Client) setHead(header *types.Header, validators map[common.Address]*big.Int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.head = header
+	c.validators = validators
+	c.headers[header.Number.Uint64()] = header
+
+	if number := header.Number.Uint64(); number >= uint64(c.config.HeaderCache) {
+		delete(c.headers, number-uint64(c.config.HeaderCache))
+	}
+}
+
+// fetchHeader retrieves an unverified header from the backend.
+func (c *Client) fetchHeader(ctx context.Context, number uint64) (*types.Header, error) {
+	blob, err := c.backend.HeaderRlp(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(blob, header); err != nil {
+		return nil, err
+	}
+	if header.Number == nil || header.Number.Uint64() != number {
+		return nil, fmt.Errorf("header number mismatch: have %v, want %d", header.Number, number)
+	}
+	return header, nil
+}
+
+// HeaderByNumber returns a verified header. If number is nil, the verified head
+// is returned. Headers older than the cache window are verified by following
+// the parent hashes back from the oldest cached header.
+func (c *Client) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	c.lock.RLock()
+	head := c.head
+	if number == nil {
+		c.lock.RUnlock()
+		return types.CopyHeader(head), nil
+	}
+	if !number.IsUint64() || number.Uint64() > head.Number.Uint64() {
+		c.lock.RUnlock()
+		return nil, ErrNotVerified
+	}
+	target := number.Uint64()
+	if header, ok := c.headers[target]; ok {
+		c.lock.RUnlock()
+		return types.CopyHeader(header), nil
+	}
+	// Find the oldest cached header above the requested one
+	descendant := head
+	for n := target + 1; n < head.Number.Uint64(); n++ {
+		if header, ok := c.headers[n]; ok {
+			descendant = header
+			break
+		}
+	}
+	c.lock.RUnlock()
+
+	for descendant.Number.Uint64() > target {
+		parent, err := c.fetchHeader(ctx, descendant.Number.Uint64()-1)
+		if err != nil {
+			return nil, err
+		}
+		if parent.Hash() != descendant.ParentHash {
+			return nil, fmt.Errorf("%w: header #%d hash %x, want %x", errUnknownAncestor, parent.Number, parent.Hash(), descendant.ParentHash)
+		}
+		descendant = parent
+	}
+	return descendant, nil
+}
+
+// BalanceAt returns the proven balance of the given account. The block number
+// can be nil, in which case the balance is taken from the verified head.
+func (c *Client) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	header, err := c.HeaderByNumber(ctx, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	acc, _, err := c.proveAccount(ctx, header, account, nil)
+	if err != nil {
+		return nil, err
+	}
+	return acc.Balance, nil
+}
+
+// NonceAt returns the proven nonce of the given account. The block number can
+// be nil, in which case the nonce is taken from the verified head.
+func (c *Client) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	header, err := c.HeaderByNumber(ctx, blockNumber)
+	if err != nil {
+		return 0, err
+	}
+	acc, _, err := c.proveAccount(ctx, header, account, nil)
+	if err != nil {
+		return 0, err
+	}
+	return acc.Nonce, nil
+}
+
+// StorageAt returns the proven value of key in the contract storage of the
+// given account. The block number can be nil, in which case the value is taken
+// from the verified head.
+func (c *Client) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	header, err := c.HeaderByNumber(ctx, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	_, values, err := c.proveAccount(ctx, header, account, []common.Hash{key})
+	if err != nil {
+		return nil, err
+	}
+	return values[0].Bytes(), nil
+}
+
+// TransactionReceipt returns the receipt of a transaction included in a
+// verified block. The receipts of the whole block are retrieved and checked
+// against its receipt root, and the transactions against its transaction root,
+// so that the derived fields of the returned receipt can be trusted as well.
+func (c *Client) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	receipt, err := c.backend.TransactionReceipt(ctx, txHash)
+	if err != nil {
+		return nil, err
+	}
+	header, err := c.HeaderByNumber(ctx, receipt.BlockNumber)
+	if err != nil {
+		return nil, err
+	}
+	if header.Hash() != receipt.BlockHash {
+		return nil, fmt.Errorf("receipt block %x not in verified chain", receipt.BlockHash)
+	}
+	block, err := c.backend.BlockByHash(ctx, receipt.BlockHash)
+	if err != nil {
+		return nil, err
+	}
+	txs := block.Transactions()
+	if hash := types.DeriveSha(txs, trie.NewStackTrie(nil)); hash != header.TxHash {
+		return nil, fmt.Errorf("transaction root mismatch: have %x, want %x", hash, header.TxHash)
+	}
+	index := -1
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		if hashes[i] = tx.Hash(); hashes[i] == txHash {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("transaction %x not in block %x", txHash, receipt.BlockHash)
+	}
+	receipts, err := c.backend.TransactionReceipts(ctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+	if hash := types.DeriveSha(types.Receipts(receipts), trie.NewStackTrie(nil)); hash != header.ReceiptHash {
+		return nil, fmt.Errorf("receipt root mismatch: have %x, want %x", hash, header.ReceiptHash)
+	}
+	return deriveReceipt(receipts, index, header, txs[index])
+}
+
+// deriveReceipt fills the fields of a proven receipt that are not part of its
+// consensus encoding from the verified block instead of the backend.
+func deriveReceipt(receipts types.Receipts, index int, header *types.Header, tx *types.Transaction) (*types.Receipt, error) {
+	receipt := receipts[index]
+
+	receipt.TxHash = tx.Hash()
+	receipt.BlockHash = header.Hash()
+	receipt.BlockNumber = new(big.Int).Set(header.Number)
+	receipt.TransactionIndex = uint(index)
+
+	receipt.GasUsed = receipt.CumulativeGasUsed
+	if index > 0 {
+		receipt.GasUsed -= receipts[index-1].CumulativeGasUsed
+	}
+	receipt.ContractAddress = common.Address{}
+	if tx.To() == nil {
+		from, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+		if err != nil {
+			return nil, err
+		}
+		receipt.ContractAddress = crypto.CreateAddress(from, tx.Nonce())
+	}
+	var logIndex uint
+	for i := 0; i < index; i++ {
+		logIndex += uint(len(receipts[i].Logs))
+	}
+	for _, l := range receipt.Logs {
+		l.BlockNumber = header.Number.Uint64()
+		l.BlockHash = receipt.BlockHash
+		l.TxHash = receipt.TxHash
+		l.TxIndex = receipt.TransactionIndex
+		l.Index = logIndex
+		l.Removed = false
+		logIndex++
+	}
+	return receipt, nil
+}
@@ -0,0 +1,385 @@
+package lightclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/consensus/proofofstake"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/core/state"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/crypto"
+	"github.com/QuantumCoinProject/qc/crypto/cryptobase"
+	"github.com/QuantumCoinProject/qc/crypto/signaturealgorithm"
+	"github.com/QuantumCoinProject/qc/eth/protocols/eth"
+	"github.com/QuantumCoinProject/qc/ethclient/gethclient"
+	"github.com/QuantumCoinProject/qc/rlp"
+	"github.com/QuantumCoinProject/qc/systemcontracts/staking"
+	"github.com/QuantumCoinProject/qc/trie"
+)
+
+var (
+	testUser    = common.BytesToAddress([]byte("user"))
+	testBalance = big.NewInt(12345)
+	testDeposit = big.NewInt(100)
+)
+
+// testBackend serves a chain whose blocks are all committed by the signers
+// configured for them.
+type testBackend struct {
+	db       state.Database
+	headers  []*types.Header
+	blocks   map[common.Hash]*types.Block
+	receipts map[common.Hash]types.Receipts // Block receipts by block hash
+
+	proofRoot common.Hash // State root to serve proofs from instead of the header's
+}
+
+// newTestBackend creates a chain of the given length on top of a state staking
+// the validator keys. The commits in block n are signed by signers(n). Block 2
+// contains a transfer and a contract creation.
+func newTestBackend(t *testing.T, length int, keys []*signaturealgorithm.PrivateKey, signers func(n int) []*signaturealgorithm.PrivateKey) *testBackend {
+	db := state.NewDatabase(rawdb.NewMemoryDatabase())
+	statedb, _ := state.New(common.Hash{}, db, nil)
+	statedb.SetBalance(testUser, testBalance)
+
+	contract := staking.STAKING_CONTRACT_ADDRESS
+	statedb.SetState(contract, common.BigToHash(big.NewInt(slotValidatorList)), common.BigToHash(big.NewInt(int64(len(keys)))))
+	for i, key := range keys {
+		validator := cryptobase.SigAlg.PublicKeyToAddressNoError(&key.PublicKey)
+		depositor := common.BytesToAddress([]byte(fmt.Sprintf("depositor-%d", i)))
+
+		statedb.SetState(contract, arraySlot(slotValidatorList, uint64(i)), common.BytesToHash(validator.Bytes()))
+		statedb.SetState(contract, mappingSlot(validator, slotValidatorToDepositorMapping), common.BytesToHash(depositor.Bytes()))
+		statedb.SetState(contract, mappingSlot(depositor, slotDepositorExists), common.BigToHash(common.Big1))
+		statedb.SetState(contract, mappingSlot(depositor, slotDepositorBalances), common.BigToHash(testDeposit))
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &testBackend{
+		db:       db,
+		blocks:   make(map[common.Hash]*types.Block),
+		receipts: make(map[common.Hash]types.Receipts),
+	}
+	for n := 0; n < length; n++ {
+		header := &types.Header{
+			Number:      big.NewInt(int64(n)),
+			Difficulty:  common.Big1,
+			Root:        root,
+			TxHash:      types.EmptyRootHash,
+			ReceiptHash: types.EmptyRootHash,
+		}
+		var (
+			txs      types.Transactions
+			receipts types.Receipts
+		)
+		if n > 0 {
+			header.ParentHash = b.headers[n-1].Hash()
+			header.ConsensusData, header.UnhashedConsensusData = newCommits(t, header.ParentHash, signers(n))
+		}
+		if n == 2 {
+			signer := types.NewLondonSignerDefaultChain()
+			transfer, err := types.SignTx(types.NewTransaction(0, testUser, common.Big1, 21000, common.Big1, nil), signer, keys[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			create, err := types.SignTx(types.NewDefaultFeeTransaction(big.NewInt(types.DEFAULT_CHAIN_ID), 1, nil, common.Big0, 100000, types.GAS_TIER_DEFAULT, []byte{0x00}), signer, keys[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			txs = types.Transactions{transfer, create}
+			receipts = types.Receipts{
+				{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 21000, Logs: []*types.Log{}},
+				{Status: types.ReceiptStatusSuccessful, CumulativeGasUsed: 71000, Logs: []*types.Log{{Address: testUser, Data: []byte{0x01}}}},
+			}
+			for _, receipt := range receipts {
+				receipt.Bloom = types.CreateBloom(types.Receipts{receipt})
+			}
+		}
+		block := types.NewBlock(header, txs, receipts, trie.NewStackTrie(nil))
+		b.headers = append(b.headers, block.Header())
+		b.blocks[block.Hash()] = block
+		b.receipts[block.Hash()] = receipts
+	}
+	return b
+}
+
+// newCommits creates the consensus data of a block built on parentHash with
+// commit packets of the given signers.
+func newCommits(t *testing.T, parentHash common.Hash, signers []*signaturealgorithm.PrivateKey) ([]byte, []byte) {
+	var (
+		round         = byte(1)
+		proposalHash  = crypto.Keccak256Hash(parentHash.Bytes())
+		precommitHash = crypto.Keccak256Hash(parentHash.Bytes(), proposalHash.Bytes(), []byte{round}, []byte{byte(proofofstake.VOTE_TYPE_OK)})
+		commitHash    = crypto.Keccak256Hash(precommitHash.Bytes())
+	)
+	consensusData, err := rlp.EncodeToBytes(&proofofstake.BlockConsensusData{
+		VoteType:              proofofstake.VOTE_TYPE_OK,
+		ProposalHash:          proposalHash,
+		PrecommitHash:         precommitHash,
+		SlashedBlockProposers: []common.Address{},
+		Round:                 round,
+		SelectedTransactions:  []common.Hash{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	details, err := rlp.EncodeToBytes(&proofofstake.CommitDetails{CommitHash: commitHash, Round: round})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append([]byte{proofofstake.ConsensusNetworkProtocolVersion, byte(proofofstake.CONSENSUS_PACKET_TYPE_COMMIT_BLOCK)}, details...)
+
+	var packets []eth.ConsensusPacket
+	for _, key := range signers {
+		signature, err := cryptobase.SigAlg.Sign(crypto.Keccak256(append(parentHash.Bytes(), data...)), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		packets = append(packets, eth.ConsensusPacket{ParentHash: parentHash, Signature: signature, ConsensusData: data})
+	}
+	unhashedConsensusData, err := rlp.EncodeToBytes(&proofofstake.BlockAdditionalConsensusData{ConsensusPackets: packets})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return consensusData, unhashedConsensusData
+}
+
+func (b *testBackend) BlockNumber(ctx context.Context) (uint64, error) {
+	return uint64(len(b.headers) - 1), nil
+}
+
+func (b *testBackend) HeaderRlp(ctx context.Context, number uint64) ([]byte, error) {
+	if number >= uint64(len(b.headers)) {
+		return nil, fmt.Errorf("header #%d not found", number)
+	}
+	return rlp.EncodeToBytes(b.headers[number])
+}
+
+func toHexSlice(b [][]byte) []string {
+	r := make([]string, len(b))
+	for i := range b {
+		r[i] = hexutil.Encode(b[i])
+	}
+	return r
+}
+
+func (b *testBackend) GetProof(ctx context.Context, account common.Address, keys []string, blockNumber *big.Int) (*gethclient.AccountResult, error) {
+	root := b.headers[blockNumber.Uint64()].Root
+	if b.proofRoot != (common.Hash{}) {
+		root = b.proofRoot
+	}
+	statedb, err := state.New(root, b.db, nil)
+	if err != nil {
+		return nil, err
+	}
+	proof, err := statedb.GetProof(account)
+	if err != nil {
+		return nil, err
+	}
+	result := &gethclient.AccountResult{
+		Address:      account,
+		AccountProof: toHexSlice(proof),
+		Balance:      statedb.GetBalance(account),
+	}
+	for _, key := range keys {
+		proof, err := statedb.GetStorageProof(account, common.HexToHash(key))
+		if err != nil {
+			return nil, err
+		}
+		result.StorageProof = append(result.StorageProof, gethclient.StorageResult{Key: key, Proof: toHexSlice(proof)})
+	}
+	return result, nil
+}
+
+func (b *testBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	if block, ok := b.blocks[hash]; ok {
+		return block, nil
+	}
+	return nil, errors.New("block not found")
+}
+
+// receipt returns a fresh copy of a receipt as a node would serve it.
+func (b *testBackend) receipt(txHash common.Hash) (*types.Receipt, error) {
+	for hash, block := range b.blocks {
+		for i, tx := range block.Transactions() {
+			if tx.Hash() != txHash {
+				continue
+			}
+			stored := b.receipts[hash][i]
+			receipt := &types.Receipt{
+				Status:            stored.Status,
+				CumulativeGasUsed: stored.CumulativeGasUsed,
+				Bloom:             stored.Bloom,
+				TxHash:            txHash,
+				BlockHash:         hash,
+				BlockNumber:       block.Number(),
+				TransactionIndex:  uint(i),
+			}
+			for _, l := range stored.Logs {
+				receipt.Logs = append(receipt.Logs, &types.Log{Address: l.Address, Topics: l.Topics, Data: l.Data})
+			}
+			return receipt, nil
+		}
+	}
+	return nil, errors.New("receipt not found")
+}
+
+func (b *testBackend) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	return b.receipt(txHash)
+}
+
+func (b *testBackend) TransactionReceipts(ctx context.Context, txHashes []common.Hash) ([]*types.Receipt, error) {
+	receipts := make([]*types.Receipt, len(txHashes))
+	for i, hash := range txHashes {
+		receipt, err := b.receipt(hash)
+		if err != nil {
+			return nil, err
+		}
+		receipts[i] = receipt
+	}
+	return receipts, nil
+}
+
+func newTestKeys(t *testing.T, n int) []*signaturealgorithm.PrivateKey {
+	keys := make([]*signaturealgorithm.PrivateKey, n)
+	for i := range keys {
+		key, err := cryptobase.SigAlg.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[i] = key
+	}
+	return keys
+}
+
+func newTestClient(t *testing.T, backend *testBackend, config Config) *Client {
+	config.Checkpoint = Checkpoint{Number: 0, Hash: backend.headers[0].Hash()}
+	client, err := New(context.Background(), backend, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestSync(t *testing.T) {
+	keys := newTestKeys(t, 4)
+	backend := newTestBackend(t, 6, keys, func(int) []*signaturealgorithm.PrivateKey { return keys[:3] })
+	client := newTestClient(t, backend, Config{HeaderCache: 2})
+
+	validators := client.Validators()
+	if len(validators) != len(keys) {
+		t.Fatalf("tracked %d validators, want %d", len(validators), len(keys))
+	}
+	for validator, deposit := range validators {
+		if deposit.Cmp(testDeposit) != 0 {
+			t.Errorf("validator %x deposit %v, want %v", validator, deposit, testDeposit)
+		}
+	}
+
+	ctx := context.Background()
+	if err := client.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if head := client.Head(); head.Hash() != backend.headers[4].Hash() {
+		t.Fatalf("verified head #%d, want #4", head.Number)
+	}
+	if _, err := client.HeaderByNumber(ctx, big.NewInt(5)); err != ErrNotVerified {
+		t.Fatalf("unexpected error for unverified header: %v", err)
+	}
+	// Header 1 fell out of the cache and is verified through its descendants
+	header, err := client.HeaderByNumber(ctx, big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Hash() != backend.headers[1].Hash() {
+		t.Fatalf("header #1 hash %x, want %x", header.Hash(), backend.headers[1].Hash())
+	}
+
+	balance, err := client.BalanceAt(ctx, testUser, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Cmp(testBalance) != 0 {
+		t.Fatalf("balance %v, want %v", balance, testBalance)
+	}
+	if balance, err = client.BalanceAt(ctx, common.BytesToAddress([]byte("nobody")), big.NewInt(2)); err != nil || balance.Sign() != 0 {
+		t.Fatalf("balance of missing account %v, err %v", balance, err)
+	}
+
+	block := backend.blocks[backend.headers[2].Hash()]
+	create := block.Transactions()[1]
+	receipt, err := client.TransactionReceipt(ctx, create.Hash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.GasUsed != 50000 || receipt.TransactionIndex != 1 || receipt.BlockHash != block.Hash() {
+		t.Fatalf("receipt gas %d index %d block %x", receipt.GasUsed, receipt.TransactionIndex, receipt.BlockHash)
+	}
+	from := cryptobase.SigAlg.PublicKeyToAddressNoError(&keys[0].PublicKey)
+	if want := crypto.CreateAddress(from, 1); receipt.ContractAddress != want {
+		t.Fatalf("contract address %x, want %x", receipt.ContractAddress, want)
+	}
+	if len(receipt.Logs) != 1 || receipt.Logs[0].TxHash != create.Hash() {
+		t.Fatalf("receipt logs not derived: %v", receipt.Logs)
+	}
+}
+
+func TestCheckpointMismatch(t *testing.T) {
+	keys := newTestKeys(t, 1)
+	backend := newTestBackend(t, 1, keys, nil)
+
+	_, err := New(context.Background(), backend, Config{Checkpoint: Checkpoint{Hash: common.HexToHash("0x01")}})
+	if !errors.Is(err, errCheckpointMismatch) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSyncInsufficientCommits(t *testing.T) {
+	keys := newTestKeys(t, 4)
+	backend := newTestBackend(t, 4, keys, func(n int) []*signaturealgorithm.PrivateKey {
+		if n == 3 {
+			return keys[:1]
+		}
+		return keys
+	})
+	client := newTestClient(t, backend, Config{})
+
+	// Header 2 is only committed by a quarter of the stake
+	if err := client.Sync(context.Background()); err == nil {
+		t.Fatal("header with insufficient commits accepted")
+	}
+	if head := client.Head(); head.Number.Uint64() != 1 {
+		t.Fatalf("verified head #%d, want #1", head.Number)
+	}
+}
+
+func TestForgedBalance(t *testing.T) {
+	keys := newTestKeys(t, 1)
+	backend := newTestBackend(t, 3, keys, func(int) []*signaturealgorithm.PrivateKey { return keys })
+	client := newTestClient(t, backend, Config{})
+	if err := client.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Serve proofs from a state where the user is richer
+	statedb, _ := state.New(backend.headers[1].Root, backend.db, nil)
+	statedb.SetBalance(testUser, new(big.Int).Mul(testBalance, big.NewInt(2)))
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.proofRoot = root
+
+	if _, err := client.BalanceAt(context.Background(), testUser, nil); err == nil {
+		t.Fatal("balance proven against a forged state")
+	}
+}
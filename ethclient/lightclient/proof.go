@@ -0,0 +1,102 @@
+package lightclient
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/core/state"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/crypto"
+	"github.com/QuantumCoinProject/qc/ethdb/memorydb"
+	"github.com/QuantumCoinProject/qc/rlp"
+	"github.com/QuantumCoinProject/qc/trie"
+)
+
+// proofDatabase collects the hex encoded nodes of a Merkle proof into a
+// database keyed by node hash, as expected by trie.VerifyProof.
+func proofDatabase(proof []string) (*memorydb.Database, error) {
+	db := memorydb.New()
+	for _, encoded := range proof {
+		node, err := hexutil.Decode(encoded)
+		if err != nil {
+			return nil, err
+		}
+		db.Put(crypto.Keccak256(node), node)
+	}
+	return db, nil
+}
+
+// verifyAccount checks an account proof against a state root. Accounts proven
+// to be absent are returned as empty accounts.
+func verifyAccount(root common.Hash, address common.Address, proof []string) (*state.Account, error) {
+	db, err := proofDatabase(proof)
+	if err != nil {
+		return nil, err
+	}
+	value, err := trie.VerifyProof(root, crypto.Keccak256(address.Bytes()), db)
+	if err != nil {
+		return nil, fmt.Errorf("invalid account proof for %x: %v", address, err)
+	}
+	if value == nil {
+		return &state.Account{Balance: new(big.Int), Root: types.EmptyRootHash, CodeHash: crypto.Keccak256(nil)}, nil
+	}
+	var account state.Account
+	if err := rlp.DecodeBytes(value, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// verifyStorage checks a storage slot proof against a storage root. Slots
+// proven to be absent hold the zero value.
+func verifyStorage(root common.Hash, key common.Hash, proof []string) (common.Hash, error) {
+	if root == types.EmptyRootHash {
+		return common.Hash{}, nil
+	}
+	db, err := proofDatabase(proof)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	value, err := trie.VerifyProof(root, crypto.Keccak256(key.Bytes()), db)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("invalid storage proof for %x: %v", key, err)
+	}
+	if value == nil {
+		return common.Hash{}, nil
+	}
+	_, content, _, err := rlp.Split(value)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return common.BytesToHash(content), nil
+}
+
+// proveAccount retrieves an account and some of its storage slots at the
+// given verified header and checks them against the header's state root.
+func (c *Client) proveAccount(ctx context.Context, header *types.Header, address common.Address, keys []common.Hash) (*state.Account, []common.Hash, error) {
+	hexKeys := make([]string, len(keys))
+	for i, key := range keys {
+		hexKeys[i] = key.Hex()
+	}
+	result, err := c.backend.GetProof(ctx, address, hexKeys, header.Number)
+	if err != nil {
+		return nil, nil, err
+	}
+	account, err := verifyAccount(header.Root, address, result.AccountProof)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(keys) > 0 && len(result.StorageProof) != len(keys) {
+		return nil, nil, fmt.Errorf("storage proof count mismatch: have %d, want %d", len(result.StorageProof), len(keys))
+	}
+	values := make([]common.Hash, len(keys))
+	for i, key := range keys {
+		if values[i], err = verifyStorage(account.Root, key, result.StorageProof[i].Proof); err != nil {
+			return nil, nil, err
+		}
+	}
+	return account, values, nil
+}
@@ -0,0 +1,133 @@
+package lightclient
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/crypto"
+	"github.com/QuantumCoinProject/qc/systemcontracts/staking"
+)
+
+// Storage slots of the staking contract state variables, identical in the v1
+// and v2 contracts.
+const (
+	slotValidatorList               = 0
+	slotDepositorBalances           = 1
+	slotDepositorExists             = 5
+	slotValidatorToDepositorMapping = 8
+	slotDepositorSlashings          = 10
+	slotDepositorRewards            = 11
+	slotDepositorWithdrawalRequests = 12
+	slotValidationPaused            = 13
+)
+
+// maxValidatorListLength bounds the validator list a backend can make the
+// client prove.
+const maxValidatorListLength = 16384
+
+// mappingSlot returns the storage slot of key in the mapping stored at slot.
+func mappingSlot(key common.Address, slot uint64) common.Hash {
+	return crypto.Keccak256Hash(key.Bytes(), common.BigToHash(new(big.Int).SetUint64(slot)).Bytes())
+}
+
+// arraySlot returns the storage slot of the element at index in the dynamic
+// array stored at slot.
+func arraySlot(slot uint64, index uint64) common.Hash {
+	start := crypto.Keccak256Hash(common.BigToHash(new(big.Int).SetUint64(slot)).Bytes()).Big()
+	return common.BigToHash(start.Add(start, new(big.Int).SetUint64(index)))
+}
+
+// proveValidators derives the validator deposits at the given verified header
+// from proven staking contract storage, mirroring the GetValidators logic of the
+// proof-of-stake engine: paused validators and validators without a depositor
+// are left out and each validator weighs the net balance of its depositor.
+func (c *Client) proveValidators(ctx context.Context, header *types.Header) (map[common.Address]*big.Int, error) {
+	contract := staking.STAKING_CONTRACT_ADDRESS
+
+	_, values, err := c.proveAccount(ctx, header, contract, []common.Hash{common.BigToHash(big.NewInt(slotValidatorList))})
+	if err != nil {
+		return nil, err
+	}
+	length := values[0].Big()
+	if !length.IsUint64() || length.Uint64() > maxValidatorListLength {
+		return nil, fmt.Errorf("validator list too long: %v", length)
+	}
+	count := length.Uint64()
+	if count == 0 {
+		return nil, errNoValidators
+	}
+
+	// Retrieve the listed validators
+	keys := make([]common.Hash, count)
+	for i := range keys {
+		keys[i] = arraySlot(slotValidatorList, uint64(i))
+	}
+	if _, values, err = c.proveAccount(ctx, header, contract, keys); err != nil {
+		return nil, err
+	}
+	validators := make([]common.Address, count)
+	for i, value := range values {
+		validators[i] = common.BytesToAddress(value.Bytes())
+		if validators[i] == (common.Address{}) {
+			return nil, fmt.Errorf("invalid validator at index %d", i)
+		}
+	}
+
+	// Retrieve their pause flags and depositors
+	keys = make([]common.Hash, 0, 2*count)
+	for _, validator := range validators {
+		keys = append(keys, mappingSlot(validator, slotValidationPaused), mappingSlot(validator, slotValidatorToDepositorMapping))
+	}
+	if _, values, err = c.proveAccount(ctx, header, contract, keys); err != nil {
+		return nil, err
+	}
+	var (
+		active     []common.Address
+		depositors []common.Address
+	)
+	for i, validator := range validators {
+		paused, depositor := values[2*i], common.BytesToAddress(values[2*i+1].Bytes())
+		if paused != (common.Hash{}) || depositor == (common.Address{}) {
+			continue
+		}
+		active = append(active, validator)
+		depositors = append(depositors, depositor)
+	}
+	if len(active) == 0 {
+		return nil, errNoValidators
+	}
+
+	// Retrieve the depositor balances and compute the net balances
+	const fields = 5
+	keys = make([]common.Hash, 0, fields*len(depositors))
+	for _, depositor := range depositors {
+		keys = append(keys,
+			mappingSlot(depositor, slotDepositorExists),
+			mappingSlot(depositor, slotDepositorWithdrawalRequests),
+			mappingSlot(depositor, slotDepositorBalances),
+			mappingSlot(depositor, slotDepositorRewards),
+			mappingSlot(depositor, slotDepositorSlashings),
+		)
+	}
+	if _, values, err = c.proveAccount(ctx, header, contract, keys); err != nil {
+		return nil, err
+	}
+	deposits := make(map[common.Address]*big.Int, len(active))
+	for i, validator := range active {
+		var (
+			exists     = values[fields*i] != (common.Hash{})
+			withdrawal = values[fields*i+1] != (common.Hash{})
+			balance    = new(big.Int).Add(values[fields*i+2].Big(), values[fields*i+3].Big())
+			slashings  = values[fields*i+4].Big()
+		)
+		if !exists || withdrawal || balance.Cmp(slashings) <= 0 {
+			deposits[validator] = new(big.Int)
+			continue
+		}
+		deposits[validator] = balance.Sub(balance, slashings)
+	}
+	return deposits, nil
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/eth/protocols/eth"
+	"github.com/QuantumCoinProject/qc/log"
+)
+
+const (
+	// consensusBundleInterval is how long consensus packets for a peer are held
+	// back so that packets of the same round can be sent in one bundle.
+	consensusBundleInterval = 20 * time.Millisecond
+
+	// maxConsensusBundleSize is the number of packets after which a bundle is
+	// sent without waiting for the interval to pass.
+	maxConsensusBundleSize = 64
+)
+
+// bundleKey identifies the packets that can be sent in the same bundle.
+type bundleKey struct {
+	parentHash common.Hash
+	round      byte
+}
+
+// consensusBundle is a group of pending packets of the same parent hash and
+// round. Packets already in the group are not added again.
+type consensusBundle struct {
+	packets []*eth.ConsensusPacket
+	hashes  map[common.Hash]struct{}
+}
+
+// peerBundles holds the pending bundles of a peer until its flush timer fires.
+type peerBundles struct {
+	bundles map[bundleKey]*consensusBundle
+	order   []bundleKey
+}
+
+// consensusBundler aggregates the consensus packets relayed to each peer.
+type consensusBundler struct {
+	peers map[string]*peerBundles
+	lock  sync.Mutex
+}
+
+func newConsensusBundler() *consensusBundler {
+	return &consensusBundler{
+		peers: make(map[string]*peerBundles),
+	}
+}
+
+// queueConsensusPacket schedules a consensus packet to be sent to a peer. Packets
+// whose round is known are held back briefly and sent together with the other
+// packets of the same parent hash and round; all others are sent right away.
+func (h *P2PHandler) queueConsensusPacket(peer *ethPeer, packet *eth.ConsensusPacket) {
+	if h.bundler == nil || h.consensusHandler == nil {
+		peer.AsyncSendConsensusPacket(packet)
+		return
+	}
+	round, ok := h.consensusHandler.Handler.PacketRound(packet)
+	if ok == false {
+		peer.AsyncSendConsensusPacket(packet)
+		return
+	}
+	key := bundleKey{parentHash: packet.ParentHash, round: round}
+
+	h.bundler.lock.Lock()
+	pending, exists := h.bundler.peers[peer.ID()]
+	if exists == false {
+		pending = &peerBundles{
+			bundles: make(map[bundleKey]*consensusBundle),
+		}
+		h.bundler.peers[peer.ID()] = pending
+		time.AfterFunc(consensusBundleInterval, func() {
+			h.flushConsensusBundles(peer)
+		})
+	}
+	bundle, exists := pending.bundles[key]
+	if exists == false {
+		bundle = &consensusBundle{
+			hashes: make(map[common.Hash]struct{}),
+		}
+		pending.bundles[key] = bundle
+		pending.order = append(pending.order, key)
+	}
+	packetHash := packet.Hash()
+	if _, dup := bundle.hashes[packetHash]; dup {
+		h.bundler.lock.Unlock()
+		return
+	}
+	bundle.hashes[packetHash] = struct{}{}
+	bundle.packets = append(bundle.packets, packet)
+
+	var full []*eth.ConsensusPacket
+	if len(bundle.packets) >= maxConsensusBundleSize {
+		full = bundle.packets
+		bundle.packets = nil
+	}
+	h.bundler.lock.Unlock()
+
+	if full != nil {
+		sendConsensusBundle(peer, key, full)
+	}
+}
+
+// flushConsensusBundles sends all pending bundles of a peer.
+func (h *P2PHandler) flushConsensusBundles(peer *ethPeer) {
+	h.bundler.lock.Lock()
+	pending, exists := h.bundler.peers[peer.ID()]
+	delete(h.bundler.peers, peer.ID())
+	h.bundler.lock.Unlock()
+	if exists == false {
+		return
+	}
+
+	for _, key := range pending.order {
+		sendConsensusBundle(peer, key, pending.bundles[key].packets)
+	}
+}
+
+// sendConsensusPackets sends a batch of consensus packets to a peer, bundling
+// the packets that share a parent hash and round.
+func (h *P2PHandler) sendConsensusPackets(peer *ethPeer, packets []*eth.ConsensusPacket) {
+	if h.consensusHandler == nil {
+		for _, packet := range packets {
+			peer.AsyncSendConsensusPacket(packet)
+		}
+		return
+	}
+
+	groups := make(map[bundleKey][]*eth.ConsensusPacket)
+	order := make([]bundleKey, 0)
+	for _, packet := range packets {
+		round, ok := h.consensusHandler.Handler.PacketRound(packet)
+		if ok == false {
+			peer.AsyncSendConsensusPacket(packet)
+			continue
+		}
+		key := bundleKey{parentHash: packet.ParentHash, round: round}
+		if _, exists := groups[key]; exists == false {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], packet)
+	}
+	for _, key := range order {
+		sendConsensusBundle(peer, key, groups[key])
+	}
+}
+
+// sendConsensusBundle sends packets of the same parent hash and round as a single
+// bundle if the peer supports it, or one by one otherwise.
+func sendConsensusBundle(peer *ethPeer, key bundleKey, packets []*eth.ConsensusPacket) {
+	if len(packets) == 0 {
+		return
+	}
+	if len(packets) == 1 || peer.Version() < eth.ETH67 {
+		for _, packet := range packets {
+			peer.AsyncSendConsensusPacket(packet)
+		}
+		return
+	}
+
+	for start := 0; start < len(packets); start += maxConsensusBundleSize {
+		end := start + maxConsensusBundleSize
+		if end > len(packets) {
+			end = len(packets)
+		}
+		bundle := &eth.ConsensusBundlePacket{
+			ParentHash: key.parentHash,
+			Round:      key.round,
+			Packets:    make([]eth.ConsensusPacket, 0, end-start),
+		}
+		for _, packet := range packets[start:end] {
+			bundle.Packets = append(bundle.Packets, *packet)
+		}
+		log.Trace("sendConsensusBundle", "peer", peer.ID(), "parentHash", key.parentHash, "round", key.round, "packets", len(bundle.Packets))
+		peer.AsyncSendConsensusBundle(bundle)
+	}
+}
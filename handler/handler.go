@@ -31,10 +31,12 @@ import (
 	"github.com/QuantumCoinProject/qc/eth/downloader"
 	"github.com/QuantumCoinProject/qc/eth/fetcher"
 	"github.com/QuantumCoinProject/qc/eth/protocols/eth"
+	"github.com/QuantumCoinProject/qc/eth/protocols/snap"
 	"github.com/QuantumCoinProject/qc/ethdb"
 	"github.com/QuantumCoinProject/qc/event"
 	"github.com/QuantumCoinProject/qc/log"
 	"github.com/QuantumCoinProject/qc/p2p"
+	"github.com/QuantumCoinProject/qc/p2p/enode"
 	"github.com/QuantumCoinProject/qc/params"
 	"github.com/QuantumCoinProject/qc/trie"
 )
@@ -83,9 +85,18 @@ type HandlerConfig struct {
 	BloomCache             uint64                    // Megabytes to alloc for fast sync bloom
 	EventMux               *event.TypeMux            // Legacy event mux, deprecate for `feed`
 	Checkpoint             *params.TrustedCheckpoint // Hard coded checkpoint for sync challenges
+	Anchor                 *downloader.Anchor        // Trusted block to start fast sync from on an empty chain
 	Whitelist              map[uint64]common.Hash    // Hard coded whitelist for sync challenged
 	ConsensusPacketHandler *ConsensusPacketHandler
 	RebroadcastCount       int
+	SentryNodes            []*enode.Node // Sentries a validator exclusively peers with
+	PrivatePeers           []*enode.Node // Validators protected by a sentry, never advertised
+	PeerScorer             PeerScorer    // Reputation tracker to report peer behaviour to
+}
+
+// PeerScorer records the behaviour of peers to track their reputation.
+type PeerScorer interface {
+	ReportPeer(id enode.ID, event p2p.ScoreEvent)
 }
 
 type ConsensusHandler interface {
@@ -94,6 +105,7 @@ type ConsensusHandler interface {
 	OnPeerConnected(peerId string) error
 	OnPeerDisconnected(peerId string) error
 	ShouldRebroadCast(packet *eth.ConsensusPacket, fromPeerId string) bool
+	PacketRound(packet *eth.ConsensusPacket) (byte, bool)
 }
 
 type ConsensusPacketHandler struct {
@@ -150,6 +162,13 @@ type P2PHandler struct {
 
 	rebroadcastLock            sync.Mutex
 	rebroadcastLastCleanupTime time.Time
+
+	sentryNodes  map[string]struct{} // Peer ids of the sentries, set on validators
+	privatePeers map[string]struct{} // Peer ids of the protected validators, set on sentries
+
+	scorer PeerScorer
+
+	bundler *consensusBundler
 }
 
 var lock = &sync.Mutex{}
@@ -203,6 +222,10 @@ func NewHandler(config *HandlerConfig) (*P2PHandler, error) {
 		rebroadcastCount:           config.RebroadcastCount,
 		rebroadcastMap:             make(map[common.Hash]int64),
 		rebroadcastLastCleanupTime: time.Now(),
+		sentryNodes:                nodeIdSet(config.SentryNodes),
+		privatePeers:               nodeIdSet(config.PrivatePeers),
+		scorer:                     config.PeerScorer,
+		bundler:                    newConsensusBundler(),
 	}
 	if config.Sync == downloader.FullSync {
 		// The database seems empty as the current block is the genesis. Yet the fast
@@ -225,6 +248,9 @@ func NewHandler(config *HandlerConfig) (*P2PHandler, error) {
 		} else {
 			// If fast sync was requested and our database is empty, grant it
 			h.fastSync = uint32(1)
+			if config.Sync == downloader.SnapSync {
+				h.snapSync = uint32(1)
+			}
 		}
 	}
 	// If we have trusted checkpoints, enforce them on the chain
@@ -246,7 +272,7 @@ func NewHandler(config *HandlerConfig) (*P2PHandler, error) {
 		return h.chain.CurrentBlock().NumberU64()
 	}
 
-	h.Downloader = downloader.New(h.checkpointNumber, config.Database, h.stateBloom, h.eventMux, h.chain, nil, h.removePeer)
+	h.Downloader = downloader.New(h.checkpointNumber, config.Anchor, config.Database, h.stateBloom, h.eventMux, h.chain, nil, h.dropSyncPeer)
 	h.Downloader.SetChainHeighter(heighter)
 
 	// Construct the fetcher (short sync)
@@ -280,7 +306,7 @@ func NewHandler(config *HandlerConfig) (*P2PHandler, error) {
 		}
 		return n, err
 	}
-	h.blockFetcher = fetcher.NewBlockFetcher(false, nil, h.chain.GetBlockByHash, validator, h.BroadcastBlock, heighter, nil, inserter, h.removePeer)
+	h.blockFetcher = fetcher.NewBlockFetcher(false, nil, h.chain.GetBlockByHash, validator, h.BroadcastBlock, heighter, nil, inserter, h.dropFetchPeer)
 
 	fetchTx := func(peer string, hashes []common.Hash) error {
 		p := h.peers.peer(peer)
@@ -289,7 +315,10 @@ func NewHandler(config *HandlerConfig) (*P2PHandler, error) {
 		}
 		return p.RequestTxs(hashes)
 	}
-	h.txFetcher = fetcher.NewTxFetcher(h.txpool.Has, h.txpool.AddRemotes, fetchTx)
+	dropTxs := func(peer string) {
+		h.ReportPeer(peer, p2p.ScoreInvalidTransactions)
+	}
+	h.txFetcher = fetcher.NewTxFetcher(h.txpool.Has, h.txpool.AddRemotes, fetchTx, dropTxs)
 	h.chainSync = newChainSyncer(h)
 	p2phandler = h
 	return h, nil
@@ -298,6 +327,10 @@ func NewHandler(config *HandlerConfig) (*P2PHandler, error) {
 // runEthPeer registers an eth peer into the joint eth/snap peerset, adds it to
 // various subsystems and starts handling messages.
 func (h *P2PHandler) runEthPeer(peer *eth.Peer, handler eth.Handler) error {
+	if !h.allowPeer(peer.ID()) {
+		peer.Log().Debug("Rejecting non-sentry peer")
+		return p2p.DiscUnexpectedIdentity
+	}
 	// TODO(karalabe): Not sure why this is needed
 	if !h.chainSync.handlePeerEvent(peer) {
 		return p2p.DiscQuitting
@@ -383,6 +416,38 @@ func (h *P2PHandler) runEthPeer(peer *eth.Peer, handler eth.Handler) error {
 	return handler(peer)
 }
 
+// runSnapPeer registers a `snap` peer into the peerset and the state syncer and
+// starts handling messages.
+func (h *P2PHandler) runSnapPeer(peer *snap.Peer, handler snap.Handler) error {
+	if !h.allowPeer(peer.ID()) {
+		peer.Log().Debug("Rejecting non-sentry snap peer")
+		return p2p.DiscUnexpectedIdentity
+	}
+	h.peerWG.Add(1)
+	defer h.peerWG.Done()
+
+	if err := h.peers.registerSnapPeer(peer); err != nil {
+		peer.Log().Error("Snapshot peer registration failed", "err", err)
+		return err
+	}
+	defer h.unregisterSnapPeer(peer.ID())
+
+	if err := h.Downloader.SnapSyncer.Register(peer); err != nil {
+		peer.Log().Error("Failed to register peer in snap syncer", "err", err)
+		return err
+	}
+	// Handle incoming messages until the connection is torn down
+	return handler(peer)
+}
+
+// unregisterSnapPeer removes a `snap` peer from the state syncer and the peerset.
+func (h *P2PHandler) unregisterSnapPeer(id string) {
+	h.Downloader.SnapSyncer.Unregister(id)
+	if err := h.peers.unregisterSnapPeer(id); err != nil {
+		log.Error("Snapshot peer removal failed", "peer", id, "err", err)
+	}
+}
+
 // removePeer requests disconnection of a peer.
 func (h *P2PHandler) removePeer(id string) {
 	peer := h.peers.peer(id)
@@ -391,6 +456,31 @@ func (h *P2PHandler) removePeer(id string) {
 	}
 }
 
+// ReportPeer records a behaviour of a peer with the peer scorer, which drops
+// and bans the peer once its reputation is exhausted.
+func (h *P2PHandler) ReportPeer(id string, event p2p.ScoreEvent) {
+	if h.scorer == nil {
+		return
+	}
+	nodeId, err := enode.ParseID(id)
+	if err != nil {
+		return
+	}
+	h.scorer.ReportPeer(nodeId, event)
+}
+
+// dropSyncPeer penalizes and disconnects a peer misbehaving during sync.
+func (h *P2PHandler) dropSyncPeer(id string) {
+	h.ReportPeer(id, p2p.ScoreSyncFailure)
+	h.removePeer(id)
+}
+
+// dropFetchPeer penalizes and disconnects a peer propagating invalid blocks.
+func (h *P2PHandler) dropFetchPeer(id string) {
+	h.ReportPeer(id, p2p.ScoreInvalidBlock)
+	h.removePeer(id)
+}
+
 // unregisterPeer removes a peer from the Downloader, fetchers and main peer set.
 func (h *P2PHandler) unregisterPeer(id string) {
 	// Create a custom logger to avoid printing the entire id
@@ -567,7 +657,7 @@ func (h *P2PHandler) SendConsensusPacket(peerList []string, packet *eth.Consensu
 			log.Trace("SendConsensusPacket peer not found", "peerId", peer)
 			continue
 		}
-		peer.AsyncSendConsensusPacket(packet)
+		h.queueConsensusPacket(peer, packet)
 	}
 	log.Trace("SendConsensusPacket", "send peer count", len(peerList), "packetHash", packet.Hash())
 	return nil
@@ -584,7 +674,7 @@ func (h *P2PHandler) BroadcastConsensusData(packet *eth.ConsensusPacket) error {
 		if err != nil {
 			log.Trace("BroadcastConsensusData", "err", err, "peer", peer.ID())
 		}
-		peer.AsyncSendConsensusPacket(packet)
+		h.queueConsensusPacket(peer, packet)
 	}
 
 	return nil
@@ -29,6 +29,7 @@ import (
 	"github.com/QuantumCoinProject/qc/core/types"
 	"github.com/QuantumCoinProject/qc/eth/protocols/eth"
 	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/p2p"
 	"github.com/QuantumCoinProject/qc/p2p/enode"
 	"github.com/QuantumCoinProject/qc/trie"
 	"math/rand"
@@ -106,18 +107,10 @@ func (h *EthHandler) Handle(peer *eth.Peer, packet eth.Packet) error {
 		return h.txFetcher.Enqueue(peer.ID(), *packet, true)
 
 	case *eth.ConsensusPacket:
-		if h.consensusHandler != nil {
-			err := h.consensusHandler.Handler.HandleConsensusPacket(packet, peer.ID())
-			if err != nil {
-				log.Trace("Error in HandleConsensusPacket", "err", err, "peer", peer.ID())
-			} else {
-				go h.rebroadcast(peer.ID(), packet)
-			}
+		return h.handleConsensusPacket(peer, packet)
 
-			return err
-		} else {
-			return nil
-		}
+	case *eth.ConsensusBundlePacket:
+		return h.handleConsensusBundle(peer, packet)
 
 	case *eth.RequestConsensusDataPacket:
 		if h.consensusHandler != nil {
@@ -125,9 +118,11 @@ func (h *EthHandler) Handle(peer *eth.Peer, packet eth.Packet) error {
 			if err != nil {
 				return err
 			}
-			for i := 0; i < len(packets); i++ {
-				peer.AsyncSendConsensusPacket(packets[i])
+			p := h.peers.peer(peer.ID())
+			if p == nil {
+				return errors.New("unregistered during callback")
 			}
+			(*P2PHandler)(h).sendConsensusPackets(p, packets)
 		}
 		return nil
 
@@ -150,6 +145,46 @@ func (h *EthHandler) Handle(peer *eth.Peer, packet eth.Packet) error {
 	}
 }
 
+// handleConsensusPacket passes a consensus packet to the consensus engine and
+// rebroadcasts it if it was accepted. The consensus engine reports the peer,
+// since only it knows whether the packet was valid and useful.
+func (h *EthHandler) handleConsensusPacket(peer *eth.Peer, packet *eth.ConsensusPacket) error {
+	if h.consensusHandler == nil {
+		return nil
+	}
+	err := h.consensusHandler.Handler.HandleConsensusPacket(packet, peer.ID())
+	if err != nil {
+		log.Trace("Error in HandleConsensusPacket", "err", err, "peer", peer.ID())
+	} else {
+		go h.rebroadcast(peer.ID(), packet)
+	}
+
+	return err
+}
+
+// handleConsensusBundle handles each packet of a consensus bundle as if it had
+// been received on its own. Packets of another round than the bundle are
+// rejected.
+func (h *EthHandler) handleConsensusBundle(peer *eth.Peer, bundle *eth.ConsensusBundlePacket) error {
+	if h.consensusHandler == nil {
+		return nil
+	}
+	var firstErr error
+	for i := 0; i < len(bundle.Packets); i++ {
+		packet := &bundle.Packets[i]
+		round, ok := h.consensusHandler.Handler.PacketRound(packet)
+		if ok == false || round != bundle.Round {
+			(*P2PHandler)(h).ReportPeer(peer.ID(), p2p.ScoreInvalidConsensusPacket)
+			return fmt.Errorf("consensus bundle packet round mismatch, bundle round %d", bundle.Round)
+		}
+		err := h.handleConsensusPacket(peer, packet)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
 // handleHeaders is invoked from a peer's message P2PHandler when it transmits a batch
 // of headers for the local node to process.
 func (h *EthHandler) handleHeaders(peer *eth.Peer, headers []*types.Header) error {
@@ -265,7 +300,7 @@ func (h *EthHandler) handleBlockBroadcast(peer *eth.Peer, block *types.Block, td
 
 func (h *EthHandler) handleRequestPeerList(peer *eth.Peer) error {
 	packet := &eth.PeerListPacket{
-		PeerList: h.peers.PeerList(),
+		PeerList: (*P2PHandler)(h).publicPeerList(),
 	}
 	log.Trace("handleRequestPeerList", "peercount", len(packet.PeerList), "peer", peer.Node().IP())
 	peer.AsyncSendPeerListPacket(packet)
@@ -275,6 +310,9 @@ func (h *EthHandler) handleRequestPeerList(peer *eth.Peer) error {
 
 func (h *EthHandler) handlePeerList(peer *eth.Peer, packet *eth.PeerListPacket) error {
 	log.Trace("handlePeerList", "peercount", len(packet.PeerList), "peer", peer.Node().IP())
+	if (*P2PHandler)(h).isValidator() {
+		return nil
+	}
 	return h.handlePeerListFn(packet.PeerList)
 }
 
@@ -328,6 +366,9 @@ func (h *EthHandler) rebroadcast(incomingPeerId string, packet *eth.ConsensusPac
 	if shouldRebroadcast == false {
 		return
 	}
+	// Validators behind this node must see every consensus packet
+	(*P2PHandler)(h).forwardToPrivatePeers(incomingPeerId, packet)
+
 	peerList := h.peers.PeerIdList()
 	for i := len(peerList) - 1; i > 0; i-- { //Fisher Yates shuffle. Send to a random set of peers each time
 		minVal := 0
@@ -345,9 +386,12 @@ func (h *EthHandler) rebroadcast(incomingPeerId string, packet *eth.ConsensusPac
 			continue
 		}
 		log.Trace("Rebroadcast peer", "peer", peerList[index])
+		if (*P2PHandler)(h).isPrivatePeer(p.ID()) {
+			continue
+		}
 		if strings.Compare(incomingPeerId, p.ID()) != 0 {
 			log.Trace("Rebroadcast ConsensusPacket", "incoming peer", incomingPeerId, "outgoing peer", p.ID(), "parentHash", packet.ParentHash, "packetHash", packetHash.Hex())
-			p.AsyncSendConsensusPacket(packet)
+			(*P2PHandler)(h).queueConsensusPacket(p, packet)
 			count = count + 1
 			if count >= h.rebroadcastCount {
 				break
@@ -23,6 +23,7 @@ import (
 
 	"github.com/QuantumCoinProject/qc/common"
 	"github.com/QuantumCoinProject/qc/eth/protocols/eth"
+	"github.com/QuantumCoinProject/qc/eth/protocols/snap"
 	"github.com/QuantumCoinProject/qc/p2p"
 )
 
@@ -47,7 +48,8 @@ var (
 // peerSet represents the collection of active peers currently participating in
 // the `eth` protocol, with or without the `snap` extension.
 type peerSet struct {
-	peers map[string]*ethPeer // Peers connected on the `eth` protocol
+	peers     map[string]*ethPeer  // Peers connected on the `eth` protocol
+	snapPeers map[string]*snapPeer // Peers connected on the `snap` protocol
 
 	lock   sync.RWMutex
 	closed bool
@@ -56,7 +58,8 @@ type peerSet struct {
 // newPeerSet creates a new peer set to track the active participants.
 func newPeerSet() *peerSet {
 	return &peerSet{
-		peers: make(map[string]*ethPeer),
+		peers:     make(map[string]*ethPeer),
+		snapPeers: make(map[string]*snapPeer),
 	}
 }
 
@@ -96,6 +99,43 @@ func (ps *peerSet) unregisterPeer(id string) error {
 	return nil
 }
 
+// registerSnapPeer injects a new `snap` peer into the working set, or returns an
+// error if the peer is already known.
+func (ps *peerSet) registerSnapPeer(peer *snap.Peer) error {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if ps.closed {
+		return errPeerSetClosed
+	}
+	id := peer.ID()
+	if _, ok := ps.snapPeers[id]; ok {
+		return errPeerAlreadyRegistered
+	}
+	ps.snapPeers[id] = &snapPeer{Peer: peer}
+	return nil
+}
+
+// unregisterSnapPeer removes a remote `snap` peer from the active set.
+func (ps *peerSet) unregisterSnapPeer(id string) error {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if _, ok := ps.snapPeers[id]; !ok {
+		return errPeerNotRegistered
+	}
+	delete(ps.snapPeers, id)
+	return nil
+}
+
+// snapPeer retrieves the registered `snap` peer with the given id.
+func (ps *peerSet) snapPeer(id string) *snapPeer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	return ps.snapPeers[id]
+}
+
 // peer retrieves the registered peer with the given id.
 func (ps *peerSet) peer(id string) *ethPeer {
 	ps.lock.RLock()
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"github.com/QuantumCoinProject/qc/eth/protocols/eth"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/p2p/enode"
+)
+
+// nodeIdSet converts a list of nodes into a set of their peer identifiers.
+func nodeIdSet(nodes []*enode.Node) map[string]struct{} {
+	set := make(map[string]struct{}, len(nodes))
+	for _, node := range nodes {
+		set[node.ID().String()] = struct{}{}
+	}
+	return set
+}
+
+// isValidator reports whether the local node is a validator hidden behind
+// sentry nodes.
+func (h *P2PHandler) isValidator() bool {
+	return len(h.sentryNodes) > 0
+}
+
+// allowPeer reports whether a peer may be served. A validator only talks to
+// its sentries, everybody else serves any peer.
+func (h *P2PHandler) allowPeer(id string) bool {
+	if !h.isValidator() {
+		return true
+	}
+	_, ok := h.sentryNodes[id]
+	return ok
+}
+
+// isPrivatePeer reports whether a peer is a validator protected by this node.
+func (h *P2PHandler) isPrivatePeer(id string) bool {
+	_, ok := h.privatePeers[id]
+	return ok
+}
+
+// publicPeerList returns the enode URLs of the connected peers which can be
+// advertised to others. Validators advertise nobody and sentries never reveal
+// the validators they protect.
+func (h *P2PHandler) publicPeerList() []string {
+	if h.isValidator() {
+		return []string{}
+	}
+	if len(h.privatePeers) == 0 {
+		return h.peers.PeerList()
+	}
+	peers := h.peers.allPeers()
+	list := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		if h.isPrivatePeer(peer.ID()) {
+			continue
+		}
+		list = append(list, peer.Node().String())
+	}
+	return list
+}
+
+// forwardToPrivatePeers relays a consensus packet to all connected validators
+// protected by this node, except the one it came from. It returns the number
+// of peers the packet was sent to.
+func (h *P2PHandler) forwardToPrivatePeers(incomingPeerId string, packet *eth.ConsensusPacket) int {
+	count := 0
+	for id := range h.privatePeers {
+		if id == incomingPeerId {
+			continue
+		}
+		p := h.peers.peer(id)
+		if p == nil {
+			continue
+		}
+		log.Trace("Forward ConsensusPacket to private peer", "incoming peer", incomingPeerId, "outgoing peer", id, "parentHash", packet.ParentHash)
+		h.queueConsensusPacket(p, packet)
+		count++
+	}
+	return count
+}
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/eth/protocols/eth"
+	"github.com/QuantumCoinProject/qc/p2p"
+	"github.com/QuantumCoinProject/qc/p2p/enode"
+	"sort"
+	"testing"
+)
+
+// newTestPeer registers a peer connected through a message pipe, and returns
+// the end of the pipe the messages sent to the peer arrive at.
+func newTestPeer(t *testing.T, h *P2PHandler, seed byte) (*eth.Peer, *p2p.MsgPipeRW) {
+	app, net := p2p.MsgPipe()
+	peer := eth.NewPeer(eth.ETH66, p2p.NewPeer(enode.ID{seed}, "test", nil), net, nil)
+	if err := h.peers.registerPeer(peer); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		peer.Close()
+		app.Close()
+	})
+	return peer, app
+}
+
+func TestSentryPeers(t *testing.T) {
+	h := &P2PHandler{peers: newPeerSet()}
+	validator, validatorPipe := newTestPeer(t, h, 1)
+	public, _ := newTestPeer(t, h, 2)
+	other, _ := newTestPeer(t, h, 3)
+	h.privatePeers = nodeIdSet([]*enode.Node{validator.Node()})
+
+	if h.isValidator() || h.allowPeer(public.ID()) == false || h.allowPeer(validator.ID()) == false {
+		t.Fatal("sentry refused a peer")
+	}
+
+	// The protected validator is never advertised
+	list := h.publicPeerList()
+	want := []string{public.Node().String(), other.Node().String()}
+	sort.Strings(list)
+	sort.Strings(want)
+	if len(list) != len(want) || list[0] != want[0] || list[1] != want[1] {
+		t.Fatalf("unexpected peer list %v, want %v", list, want)
+	}
+
+	// Consensus packets of public peers are forwarded to the validator, but not
+	// sent back to the validator they came from
+	packet := &eth.ConsensusPacket{ParentHash: common.BytesToHash([]byte{0x01}), Signature: []byte{0x02}, ConsensusData: []byte{0x03}}
+	if count := h.forwardToPrivatePeers(public.ID(), packet); count != 1 {
+		t.Fatalf("packet forwarded to %d peers, want 1", count)
+	}
+	if err := p2p.ExpectMsg(validatorPipe, eth.ConsensusMsg, packet); err != nil {
+		t.Fatal(err)
+	}
+	if count := h.forwardToPrivatePeers(validator.ID(), packet); count != 0 {
+		t.Fatalf("packet forwarded to %d peers, want 0", count)
+	}
+
+	// Validators that are not connected are skipped
+	if err := h.peers.unregisterPeer(validator.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if count := h.forwardToPrivatePeers(public.ID(), packet); count != 0 {
+		t.Fatalf("packet forwarded to %d peers, want 0", count)
+	}
+}
+
+func TestValidatorPeers(t *testing.T) {
+	h := &P2PHandler{peers: newPeerSet()}
+	sentry, _ := newTestPeer(t, h, 1)
+	other, _ := newTestPeer(t, h, 2)
+	h.sentryNodes = nodeIdSet([]*enode.Node{sentry.Node()})
+
+	if h.isValidator() == false {
+		t.Fatal("node with sentries is not a validator")
+	}
+	if h.allowPeer(sentry.ID()) == false || h.allowPeer(other.ID()) {
+		t.Fatal("validator served a peer other than its sentries")
+	}
+	if list := h.publicPeerList(); len(list) != 0 {
+		t.Fatalf("validator advertised peers %v", list)
+	}
+}
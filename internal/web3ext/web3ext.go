@@ -60,6 +60,11 @@ web3._extend({
 			call: 'proofofstake_getConversionDetails',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'getConversionReport',
+			call: 'proofofstake_getConversionReport',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'getStakingDetailsByValidatorAddress',
 			call: 'proofofstake_getStakingDetailsByValidatorAddress',
@@ -75,6 +80,36 @@ web3._extend({
 			call: 'proofofstake_getBlockConsensusContext',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'getGovernanceParameters',
+			call: 'proofofstake_getGovernanceParameters',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'getGovernanceProposal',
+			call: 'proofofstake_getGovernanceProposal',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'listGovernanceProposals',
+			call: 'proofofstake_listGovernanceProposals',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'tallyGovernanceProposal',
+			call: 'proofofstake_tallyGovernanceProposal',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'getValidatorStats',
+			call: 'proofofstake_getValidatorStats',
+			params: 3
+		}),
+		new web3._extend.Method({
+			name: 'getCheckpoint',
+			call: 'proofofstake_getCheckpoint',
+			params: 1
+		}),
 	]
 });
 `
@@ -161,6 +196,10 @@ web3._extend({
 			name: 'peers',
 			getter: 'admin_peers'
 		}),
+		new web3._extend.Property({
+			name: 'networkTraffic',
+			getter: 'admin_networkTraffic'
+		}),
 		new web3._extend.Property({
 			name: 'datadir',
 			getter: 'admin_datadir'
@@ -190,6 +229,11 @@ web3._extend({
 			call: 'debug_getBlockRlp',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'getHeaderRlp',
+			call: 'debug_getHeaderRlp',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'testSignCliqueBlock',
 			call: 'debug_testSignCliqueBlock',
@@ -859,6 +859,9 @@ func (w *worker) proposePhase(interrupt *int32, timestamp int64) error {
 		pendingTxns[addr] = filteredList
 	}
 
+	//Remove transactions the senders cannot pay for at the gas price charged in the block
+	filterUnaffordable(w.current.state, w.current.signer, pendingTxns)
+
 	//Filter further (remove invalid nonces)
 	txsByNoncePreCheck := types.NewTransactionsByNonce(w.current.signer, pendingTxns, w.current.header.ParentHash)
 	txnFilteredMap := txsByNoncePreCheck.GetMap()
@@ -896,6 +899,29 @@ func (w *worker) proposePhase(interrupt *int32, timestamp int64) error {
 	return w.commit(w.fullTaskHook, true, tstart)
 }
 
+// filterUnaffordable cuts the transactions of each sender at the first one the sender cannot pay
+// for, charging the gas at the price set through governance once it is active. The transactions
+// of each sender must be sorted by nonce.
+func filterUnaffordable(statedb *state.StateDB, signer types.Signer, txnMap map[common.Address]types.Transactions) {
+	gasPrice := core.GovernanceGasPrice(statedb)
+	for addr, txList := range txnMap {
+		balance := new(big.Int).Set(statedb.GetBalance(addr))
+		for i, txn := range txList {
+			isGasExempt, err := conversionutil.IsGasExemptTxn(txn, signer)
+			if err == nil && isGasExempt {
+				continue
+			}
+			cost := core.TxCost(txn, gasPrice)
+			if balance.Cmp(cost) < 0 {
+				log.Trace("filterUnaffordable", "from", addr, "txn", txn.Hash(), "balance", balance, "cost", cost)
+				txnMap[addr] = txList[:i]
+				break
+			}
+			balance.Sub(balance, cost)
+		}
+	}
+}
+
 // commit runs any post-transaction state modifications, assembles the final block
 // and commits new work if consensus engine is running.
 func (w *worker) commit(interval func(), update bool, start time.Time) error {
@@ -311,6 +311,16 @@ func (api *publicAdminAPI) Peers() ([]*p2p.PeerInfo, error) {
 	return server.PeersInfo(), nil
 }
 
+// NetworkTraffic retrieves the bytes and messages exchanged with the peers per
+// message type, and the configured bandwidth limits.
+func (api *publicAdminAPI) NetworkTraffic() (*p2p.NetworkTraffic, error) {
+	server := api.node.Server()
+	if server == nil {
+		return nil, ErrNodeStopped
+	}
+	return server.NetworkTraffic(), nil
+}
+
 // NodeInfo retrieves all the information we know about the host node at the
 // protocol granularity.
 func (api *publicAdminAPI) NodeInfo() (*p2p.NodeInfo, error) {
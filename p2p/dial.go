@@ -82,6 +82,7 @@ var (
 	errRecentlyDialed   = errors.New("recently dialed")
 	errNotWhitelisted   = errors.New("not contained in netrestrict whitelist")
 	errNoPort           = errors.New("node does not provide TCP port")
+	errBanned           = errors.New("node is banned")
 )
 
 // dialer creates outbound connections and submits them into Server.
@@ -147,6 +148,7 @@ type dialConfig struct {
 	log            log.Logger
 	clock          mclock.Clock
 	rand           *mrand.Rand
+	banned         func(enode.ID) bool // reports nodes refused for misbehaviour, may be nil
 }
 
 func (cfg dialConfig) withDefaults() dialConfig {
@@ -458,6 +460,9 @@ func (d *dialScheduler) checkDial(n *enode.Node) error {
 	if d.history.contains(string(n.ID().Bytes())) {
 		return errRecentlyDialed
 	}
+	if d.banned != nil && d.banned(n.ID()) {
+		return errBanned
+	}
 	return nil
 }
 
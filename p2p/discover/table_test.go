@@ -0,0 +1,201 @@
+package discover
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/QuantumCoinProject/qc/crypto/cryptobase"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/p2p/enode"
+)
+
+// pingRecorder is a transport that answers pings for the nodes marked as alive.
+type pingRecorder struct {
+	mu    sync.Mutex
+	self  *enode.Node
+	dead  map[enode.ID]bool
+	pings []enode.ID
+}
+
+func newPingRecorder() *pingRecorder {
+	key, _ := cryptobase.SigAlg.GenerateKey()
+	return &pingRecorder{
+		self: enode.NewV4WithUDP(&key.PublicKey, net.IP{10, 0, 0, 1}, 30303, 30303),
+		dead: make(map[enode.ID]bool),
+	}
+}
+
+func (t *pingRecorder) Self() *enode.Node           { return t.self }
+func (t *pingRecorder) lookupSelf() []*enode.Node   { return nil }
+func (t *pingRecorder) lookupRandom() []*enode.Node { return nil }
+
+func (t *pingRecorder) ping(n *enode.Node) (seq uint64, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pings = append(t.pings, n.ID())
+	if t.dead[n.ID()] {
+		return 0, errTimeout
+	}
+	return n.Seq(), nil
+}
+
+func (t *pingRecorder) kill(id enode.ID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.dead[id] = true
+}
+
+func (t *pingRecorder) RequestENR(n *enode.Node) (*enode.Node, error) {
+	return nil, errors.New("not supported")
+}
+
+func newTestTable(t transport) (*Table, *enode.DB) {
+	db, _ := enode.OpenDB("")
+	tab, _ := newTable(t, db, nil, log.Root())
+	go tab.loop()
+	return tab, db
+}
+
+// newTestNode creates a node with a distinct /24 network for every index.
+func newTestNode(i int) *node {
+	key, _ := cryptobase.SigAlg.GenerateKey()
+	ip := net.IP{byte(20 + i/256), byte(i % 256), 0, 1}
+	return wrapNode(enode.NewV4WithUDP(&key.PublicKey, ip, 30303, 30303))
+}
+
+// fillBucket adds nodes at the given distance until the bucket is full. It returns
+// the number of nodes created.
+func fillBucket(tab *Table, d int) int {
+	b := tab.bucketAtDistance(d)
+	created := 0
+	for i := 0; len(b.entries) < bucketSize; i++ {
+		n := newTestNode(i)
+		if tab.bucketAtDistance(enode.LogDist(tab.self().ID(), n.ID())) != b {
+			continue
+		}
+		tab.addSeenNode(n)
+		created++
+	}
+	return created
+}
+
+func TestTable_AddSeenNodeReplacements(t *testing.T) {
+	transport := newPingRecorder()
+	tab, db := newTestTable(transport)
+	defer db.Close()
+	defer tab.close()
+
+	// Almost all random nodes end up in the farthest bucket.
+	fillBucket(tab, hashBits)
+	last := tab.bucketAtDistance(hashBits)
+	if len(last.entries) != bucketSize {
+		t.Fatalf("bucket not full: %d", len(last.entries))
+	}
+
+	// Further nodes of the bucket become replacements.
+	var extra *node
+	for i := 1000; extra == nil; i++ {
+		n := newTestNode(i)
+		if enode.LogDist(tab.self().ID(), n.ID()) == hashBits {
+			extra = n
+		}
+	}
+	tab.addSeenNode(extra)
+	if contains(last.entries, extra.ID()) || !contains(last.replacements, extra.ID()) {
+		t.Fatalf("node should be a replacement")
+	}
+
+	// A dead node is replaced during revalidation.
+	tail := last.entries[len(last.entries)-1]
+	transport.kill(tail.ID())
+	tab.mutex.Lock()
+	r := tab.replace(last, tail)
+	tab.mutex.Unlock()
+	if r == nil || r.ID() != extra.ID() || contains(last.entries, tail.ID()) {
+		t.Fatalf("dead node not replaced")
+	}
+}
+
+func TestTable_IPLimit(t *testing.T) {
+	transport := newPingRecorder()
+	tab, db := newTestTable(transport)
+	defer db.Close()
+	defer tab.close()
+
+	for i := 0; i < tableIPLimit+1; i++ {
+		key, _ := cryptobase.SigAlg.GenerateKey()
+		n := wrapNode(enode.NewV4WithUDP(&key.PublicKey, net.IP{172, 0, 1, byte(i)}, 30303, 30303))
+		tab.addSeenNode(n)
+	}
+	if tab.len() > tableIPLimit {
+		t.Fatalf("too many nodes in table: %d", tab.len())
+	}
+}
+
+func TestTable_FindnodeByID(t *testing.T) {
+	transport := newPingRecorder()
+	tab, db := newTestTable(transport)
+	defer db.Close()
+	defer tab.close()
+
+	var nodes []*node
+	for i := 0; i < 40; i++ {
+		n := newTestNode(i)
+		nodes = append(nodes, n)
+		tab.addSeenNode(n)
+	}
+
+	target := newTestNode(999).ID()
+	result := tab.findnodeByID(target, bucketSize, false).entries
+	if len(result) != bucketSize {
+		t.Fatalf("wrong number of results: %d", len(result))
+	}
+
+	// The result must be the closest nodes in the table, ordered by distance.
+	var inTable []*node
+	for _, n := range nodes {
+		if contains(tab.bucket(n.ID()).entries, n.ID()) {
+			inTable = append(inTable, n)
+		}
+	}
+	sort.Slice(inTable, func(i, j int) bool {
+		return enode.DistCmp(target, inTable[i].ID(), inTable[j].ID()) < 0
+	})
+	for i := range result {
+		if result[i].ID() != inTable[i].ID() {
+			t.Fatalf("result %d: got %v, want %v", i, result[i].ID(), inTable[i].ID())
+		}
+	}
+
+	// Verified nodes are preferred.
+	live := result[bucketSize-1]
+	live.livenessChecks = 1
+	preferred := tab.findnodeByID(target, bucketSize, true).entries
+	if len(preferred) != 1 || preferred[0].ID() != live.ID() {
+		t.Fatalf("live node not preferred: %v", fmt.Sprint(preferred))
+	}
+}
+
+func TestTable_Revalidate(t *testing.T) {
+	transport := newPingRecorder()
+	tab, db := newTestTable(transport)
+	defer db.Close()
+	defer tab.close()
+
+	n := newTestNode(1)
+	tab.addSeenNode(n)
+	transport.kill(n.ID())
+
+	done := make(chan struct{}, 1)
+	tab.doRevalidate(done)
+	<-done
+	if tab.getNode(n.ID()) != nil {
+		t.Fatalf("dead node not removed")
+	}
+}
@@ -0,0 +1,393 @@
+package discover
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumCoinProject/qc/common/mclock"
+	"github.com/QuantumCoinProject/qc/crypto"
+	"github.com/QuantumCoinProject/qc/crypto/signaturealgorithm"
+	"github.com/QuantumCoinProject/qc/p2p/enode"
+)
+
+const (
+	topicAdLifetime       = 15 * time.Minute // how long a registration is advertised
+	topicRegisterInterval = 10 * time.Minute // how often local topics are registered again
+	topicQueryInterval    = 10 * time.Second // pause between topic lookups that found nothing
+	topicRegistrars       = 3                // number of nodes close to the topic a registration is sent to
+	maxTopicLength        = 64
+	maxTopics             = 128 // number of distinct topics advertised by a node
+	maxTopicAds           = 64  // number of ads kept per topic
+	maxTopicNodes         = 16  // number of ads returned per query
+)
+
+// topicTable holds the topic advertisements registered with the local node.
+type topicTable struct {
+	clock mclock.Clock
+
+	mu  sync.Mutex
+	ads map[string]map[enode.ID]*topicAd
+}
+
+type topicAd struct {
+	node    *node
+	expires mclock.AbsTime
+}
+
+func newTopicTable(clock mclock.Clock) *topicTable {
+	return &topicTable{
+		clock: clock,
+		ads:   make(map[string]map[enode.ID]*topicAd),
+	}
+}
+
+// add advertises n under the given topic, or extends its existing advertisement. It
+// returns false if the table has no room for the ad.
+func (tt *topicTable) add(topic string, n *node) bool {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	now := tt.clock.Now()
+	tt.expire(now)
+	ads := tt.ads[topic]
+	if ads == nil {
+		if len(tt.ads) >= maxTopics {
+			return false
+		}
+		ads = make(map[enode.ID]*topicAd)
+		tt.ads[topic] = ads
+	}
+	if _, ok := ads[n.ID()]; !ok && len(ads) >= maxTopicAds {
+		return false
+	}
+	ads[n.ID()] = &topicAd{node: n, expires: now.Add(topicAdLifetime)}
+	return true
+}
+
+// nodes returns up to max nodes advertised under the topic, the most recently
+// registered first.
+func (tt *topicTable) nodes(topic string, max int) []*node {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	tt.expire(tt.clock.Now())
+	ads := make([]*topicAd, 0, len(tt.ads[topic]))
+	for _, ad := range tt.ads[topic] {
+		ads = append(ads, ad)
+	}
+	sort.Slice(ads, func(i, j int) bool {
+		return ads[i].expires > ads[j].expires
+	})
+	if len(ads) > max {
+		ads = ads[:max]
+	}
+	nodes := make([]*node, len(ads))
+	for i, ad := range ads {
+		nodes[i] = ad.node
+	}
+	return nodes
+}
+
+// expire removes the ads that have expired at the given time.
+func (tt *topicTable) expire(now mclock.AbsTime) {
+	for topic, ads := range tt.ads {
+		for id, ad := range ads {
+			if ad.expires <= now {
+				delete(ads, id)
+			}
+		}
+		if len(ads) == 0 {
+			delete(tt.ads, topic)
+		}
+	}
+}
+
+// targetForTopic returns the lookup target close to which a topic is advertised.
+func targetForTopic(topic string) enode.ID {
+	return enode.ID(crypto.Keccak256Hash([]byte(topic)))
+}
+
+// RegisterTopic advertises the local node under the given topic. The registration is
+// sent to the nodes closest to the topic and renewed until the listener is closed.
+func (t *UDP) RegisterTopic(topic string) {
+	select {
+	case t.regTopic <- topic:
+	case <-t.closeCtx.Done():
+	}
+}
+
+// topicLoop runs in its own goroutine. It keeps the registrations of local topics alive.
+func (t *UDP) topicLoop() {
+	defer t.wg.Done()
+
+	var (
+		topics  []string
+		pending []string // topics waiting for the running round to finish
+		refresh = time.NewTicker(topicRegisterInterval)
+		done    chan struct{}
+	)
+	defer refresh.Stop()
+
+	run := func(topics []string) {
+		done = make(chan struct{})
+		go func(done chan struct{}) {
+			defer close(done)
+			for _, topic := range topics {
+				t.registerTopic(topic)
+			}
+		}(done)
+	}
+
+	for {
+		select {
+		case topic := <-t.regTopic:
+			topics = append(topics, topic)
+			if done == nil {
+				run([]string{topic})
+			} else {
+				pending = append(pending, topic)
+			}
+		case <-refresh.C:
+			if done == nil {
+				run(topics)
+				pending = nil
+			}
+		case <-done:
+			done = nil
+			if len(pending) > 0 {
+				run(pending)
+				pending = nil
+			}
+		case <-t.closeCtx.Done():
+			if done != nil {
+				<-done
+			}
+			return
+		}
+	}
+}
+
+// registerTopic sends a registration for the topic to the nodes closest to it.
+func (t *UDP) registerTopic(topic string) {
+	if t.tab.len() == 0 {
+		<-t.tab.refresh()
+	}
+	closest := t.newLookup(t.closeCtx, targetForTopic(topic)).run()
+	if len(closest) > topicRegistrars {
+		closest = closest[:topicRegistrars]
+	}
+	tcp := uint16(t.Self().TCP())
+	for _, n := range closest {
+		addr := &net.UDPAddr{IP: n.IP(), Port: n.UDP()}
+		t.ensureBond(n.ID(), addr)
+		t.send(addr, n.ID(), &TopicRegister{
+			Topic:      topic,
+			TCP:        tcp,
+			Expiration: uint64(time.Now().Add(expiration).Unix()),
+		})
+	}
+	t.log.Debug("Registered discovery topic", "topic", topic, "registrars", len(closest))
+}
+
+// TopicNodes is an iterator yielding nodes that advertise the given topic. It looks up
+// the nodes close to the topic and asks them for the nodes registered with them.
+func (t *UDP) TopicNodes(topic string) enode.Iterator {
+	ctx, cancel := context.WithCancel(t.closeCtx)
+	return &topicIterator{t: t, topic: topic, ctx: ctx, cancel: cancel}
+}
+
+// queryTopic asks the given node for the nodes registered under the topic.
+func (t *UDP) queryTopic(toid enode.ID, toaddr *net.UDPAddr, topic string) ([]*node, error) {
+	t.ensureBond(toid, toaddr)
+
+	nodes := make([]*node, 0, maxTopicNodes)
+	nreceived := 0
+	rm := t.pending(toid, toaddr.IP, TopicNodesPacket, func(r Packet) (matched bool, requestDone bool) {
+		reply := r.(*TopicNodes)
+		if reply.Topic != topic {
+			return false, false
+		}
+		for _, rn := range reply.Nodes {
+			nreceived++
+			n, err := nodeFromRPC(toaddr, rn)
+			if err != nil {
+				t.log.Trace("Invalid topic node received", "ip", rn.IP, "addr", toaddr, "err", err)
+				continue
+			}
+			nodes = append(nodes, n)
+		}
+		return true, len(reply.Nodes) < maxNeighbors || nreceived >= maxTopicNodes
+	})
+	t.send(toaddr, toid, &TopicQuery{
+		Topic:      topic,
+		Expiration: uint64(time.Now().Add(expiration).Unix()),
+	})
+	err := <-rm.errc
+	if err == errTimeout && rm.reply != nil {
+		err = nil
+	}
+	return nodes, err
+}
+
+// topicIterator performs topic lookups and iterates over the advertised nodes.
+type topicIterator struct {
+	t      *UDP
+	topic  string
+	ctx    context.Context
+	cancel func()
+	seen   map[enode.ID]bool
+	buffer []*node
+}
+
+// Node returns the current node.
+func (it *topicIterator) Node() *enode.Node {
+	if len(it.buffer) == 0 {
+		return nil
+	}
+	return unwrapNode(it.buffer[0])
+}
+
+// Next moves to the next node.
+func (it *topicIterator) Next() bool {
+	if len(it.buffer) > 0 {
+		it.buffer = it.buffer[1:]
+	}
+	for len(it.buffer) == 0 {
+		if it.ctx.Err() != nil {
+			it.buffer = nil
+			return false
+		}
+		if it.seen != nil {
+			// The previous lookup is exhausted, wait before starting the next one.
+			it.wait()
+		}
+		it.buffer = it.lookup()
+	}
+	return true
+}
+
+func (it *topicIterator) wait() {
+	timer := time.NewTimer(topicQueryInterval)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-it.ctx.Done():
+	}
+}
+
+// lookup queries the nodes closest to the topic and returns the advertised nodes that
+// were not yielded by the previous lookup.
+func (it *topicIterator) lookup() []*node {
+	if it.t.tab.len() == 0 {
+		select {
+		case <-it.t.tab.refresh():
+		case <-it.ctx.Done():
+			return nil
+		}
+	}
+	registrars := it.t.newLookup(it.ctx, targetForTopic(it.topic)).run()
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		result []*node
+		seen   = make(map[enode.ID]bool)
+		self   = it.t.Self().ID()
+	)
+	for _, n := range registrars {
+		wg.Add(1)
+		go func(n *enode.Node) {
+			defer wg.Done()
+			nodes, _ := it.t.queryTopic(n.ID(), &net.UDPAddr{IP: n.IP(), Port: n.UDP()}, it.topic)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, rn := range nodes {
+				if rn.ID() == self || seen[rn.ID()] {
+					continue
+				}
+				seen[rn.ID()] = true
+				if !it.seen[rn.ID()] {
+					result = append(result, rn)
+				}
+			}
+		}(n)
+	}
+	wg.Wait()
+	it.seen = seen
+	return result
+}
+
+// Close ends the iterator.
+func (it *topicIterator) Close() {
+	it.cancel()
+}
+
+// TOPICREGISTER
+
+func (t *UDP) verifyTopicRegister(h *packetHandler, from *net.UDPAddr, fromID enode.ID, fromKey *signaturealgorithm.PublicKey) error {
+	req := h.Packet.(*TopicRegister)
+
+	if Expired(req.Expiration) {
+		return errExpired
+	}
+	if len(req.Topic) == 0 || len(req.Topic) > maxTopicLength {
+		return errInvalidTopic
+	}
+	if !t.checkBond(fromID, from.IP) {
+		return errUnknownNode
+	}
+	h.senderKey = fromKey
+	return nil
+}
+
+func (t *UDP) handleTopicRegister(h *packetHandler, from *net.UDPAddr, fromID enode.ID, mac []byte) {
+	req := h.Packet.(*TopicRegister)
+
+	n := wrapNode(enode.NewV4WithUDP(h.senderKey, from.IP, int(req.TCP), from.Port))
+	if !t.topics.add(req.Topic, n) {
+		t.log.Debug("Topic registration rejected", "topic", req.Topic, "id", fromID, "addr", from)
+	}
+}
+
+// TOPICQUERY
+
+func (t *UDP) verifyTopicQuery(h *packetHandler, from *net.UDPAddr, fromID enode.ID, fromKey *signaturealgorithm.PublicKey) error {
+	req := h.Packet.(*TopicQuery)
+
+	if Expired(req.Expiration) {
+		return errExpired
+	}
+	if len(req.Topic) == 0 || len(req.Topic) > maxTopicLength {
+		return errInvalidTopic
+	}
+	if !t.checkBond(fromID, from.IP) {
+		return errUnknownNode
+	}
+	return nil
+}
+
+func (t *UDP) handleTopicQuery(h *packetHandler, from *net.UDPAddr, fromID enode.ID, mac []byte) {
+	req := h.Packet.(*TopicQuery)
+
+	nodes := t.topics.nodes(req.Topic, maxTopicNodes)
+	t.sendNodes(from, fromID, nodes, func(nodes []Node) Packet {
+		return &TopicNodes{Topic: req.Topic, Nodes: nodes, Expiration: uint64(time.Now().Add(expiration).Unix())}
+	})
+}
+
+// TOPICNODES
+
+func (t *UDP) verifyTopicNodes(h *packetHandler, from *net.UDPAddr, fromID enode.ID, fromKey *signaturealgorithm.PublicKey) error {
+	req := h.Packet.(*TopicNodes)
+
+	if Expired(req.Expiration) {
+		return errExpired
+	}
+	if !t.handleReply(fromID, from.IP, h.Packet) {
+		return errUnsolicitedReply
+	}
+	return nil
+}
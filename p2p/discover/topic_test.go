@@ -0,0 +1,72 @@
+package discover
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumCoinProject/qc/common/mclock"
+)
+
+func TestTopicTable_Expiry(t *testing.T) {
+	clock := new(mclock.Simulated)
+	tt := newTopicTable(clock)
+
+	a, b := newTestNode(1), newTestNode(2)
+	if !tt.add("qc", a) {
+		t.Fatalf("add failed")
+	}
+	clock.Run(topicAdLifetime / 2)
+	tt.add("qc", b)
+
+	// The most recent registration comes first.
+	nodes := tt.nodes("qc", maxTopicNodes)
+	if len(nodes) != 2 || nodes[0].ID() != b.ID() || nodes[1].ID() != a.ID() {
+		t.Fatalf("unexpected nodes %v", nodes)
+	}
+	if len(tt.nodes("other", maxTopicNodes)) != 0 {
+		t.Fatalf("unexpected nodes for unknown topic")
+	}
+
+	clock.Run(topicAdLifetime/2 + time.Second)
+	nodes = tt.nodes("qc", maxTopicNodes)
+	if len(nodes) != 1 || nodes[0].ID() != b.ID() {
+		t.Fatalf("ad not expired %v", nodes)
+	}
+
+	// Registering again extends the ad.
+	tt.add("qc", b)
+	clock.Run(topicAdLifetime / 2)
+	if len(tt.nodes("qc", maxTopicNodes)) != 1 {
+		t.Fatalf("ad not renewed")
+	}
+	clock.Run(topicAdLifetime)
+	if len(tt.nodes("qc", maxTopicNodes)) != 0 || len(tt.ads) != 0 {
+		t.Fatalf("topic not removed")
+	}
+}
+
+func TestTopicTable_Limits(t *testing.T) {
+	tt := newTopicTable(new(mclock.Simulated))
+
+	for i := 0; i < maxTopicAds; i++ {
+		if !tt.add("qc", newTestNode(i)) {
+			t.Fatalf("add %d failed", i)
+		}
+	}
+	if tt.add("qc", newTestNode(maxTopicAds)) {
+		t.Fatalf("topic limit not enforced")
+	}
+	if len(tt.nodes("qc", maxTopicNodes)) != maxTopicNodes {
+		t.Fatalf("wrong number of nodes returned")
+	}
+
+	n := newTestNode(0)
+	for i := 1; i < maxTopics; i++ {
+		if !tt.add(string(rune('a'+i%26))+string(rune(i)), n) {
+			t.Fatalf("add topic %d failed", i)
+		}
+	}
+	if tt.add("one-too-many", n) {
+		t.Fatalf("topic count limit not enforced")
+	}
+}
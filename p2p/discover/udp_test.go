@@ -0,0 +1,260 @@
+package discover
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/QuantumCoinProject/qc/crypto/cryptobase"
+	"github.com/QuantumCoinProject/qc/crypto/signaturealgorithm"
+	"github.com/QuantumCoinProject/qc/p2p/enode"
+	"github.com/QuantumCoinProject/qc/p2p/enr"
+)
+
+// memNetwork connects memConns by address.
+type memNetwork struct {
+	mu    sync.Mutex
+	conns map[string]*memConn
+}
+
+type memPacket struct {
+	data []byte
+	from *net.UDPAddr
+}
+
+// memConn is an in-memory UDPConn.
+type memConn struct {
+	net       *memNetwork
+	addr      *net.UDPAddr
+	in        chan memPacket
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newMemNetwork() *memNetwork {
+	return &memNetwork{conns: make(map[string]*memConn)}
+}
+
+func (n *memNetwork) listen(port int) *memConn {
+	c := &memConn{
+		net:    n,
+		addr:   &net.UDPAddr{IP: net.IP{127, 0, 0, 1}, Port: port},
+		in:     make(chan memPacket, 256),
+		closed: make(chan struct{}),
+	}
+	n.mu.Lock()
+	n.conns[c.addr.String()] = c
+	n.mu.Unlock()
+	return c
+}
+
+func (c *memConn) ReadFromUDP(b []byte) (int, *net.UDPAddr, error) {
+	select {
+	case p := <-c.in:
+		return copy(b, p.data), p.from, nil
+	case <-c.closed:
+		return 0, nil, io.EOF
+	}
+}
+
+func (c *memConn) WriteToUDP(b []byte, addr *net.UDPAddr) (int, error) {
+	c.net.mu.Lock()
+	to := c.net.conns[addr.String()]
+	c.net.mu.Unlock()
+	if to == nil {
+		return len(b), nil
+	}
+	select {
+	case to.in <- memPacket{data: append([]byte{}, b...), from: c.addr}:
+	default:
+	}
+	return len(b), nil
+}
+
+func (c *memConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.net.mu.Lock()
+		delete(c.net.conns, c.addr.String())
+		c.net.mu.Unlock()
+		close(c.closed)
+	})
+	return nil
+}
+
+func (c *memConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+type testNode struct {
+	*UDP
+	key *signaturealgorithm.PrivateKey
+	db  *enode.DB
+}
+
+func (n *testNode) close() {
+	n.Close()
+	n.db.Close()
+}
+
+func startTestNode(t *testing.T, network *memNetwork, port int, bootnodes []*enode.Node) *testNode {
+	key, _ := cryptobase.SigAlg.GenerateKey()
+	db, _ := enode.OpenDB("")
+	ln := enode.NewLocalNode(db, key)
+	ln.SetStaticIP(net.IP{127, 0, 0, 1})
+	ln.SetFallbackUDP(port)
+	ln.Set(enr.TCP(port))
+	udp, err := ListenUDP(network.listen(port), ln, Config{PrivateKey: key, Bootnodes: bootnodes})
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	return &testNode{UDP: udp, key: key, db: db}
+}
+
+// startTestNetwork starts n nodes bootstrapping from the first one.
+func startTestNetwork(t *testing.T, n int) []*testNode {
+	network := newMemNetwork()
+	nodes := []*testNode{startTestNode(t, network, 40000, nil)}
+	for i := 1; i < n; i++ {
+		nodes = append(nodes, startTestNode(t, network, 40000+i, []*enode.Node{nodes[0].Self()}))
+	}
+	return nodes
+}
+
+func closeTestNetwork(nodes []*testNode) {
+	for _, n := range nodes {
+		n.close()
+	}
+}
+
+// waitFor polls cond until it holds or the timeout expires.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUDP_PingBond(t *testing.T) {
+	nodes := startTestNetwork(t, 2)
+	defer closeTestNetwork(nodes)
+	a, b := nodes[0], nodes[1]
+
+	if err := a.Ping(b.Self()); err != nil {
+		t.Fatalf("ping failed %v", err)
+	}
+	waitFor(t, "pong", func() bool { return a.checkBond(b.Self().ID(), b.Self().IP()) })
+	waitFor(t, "ping", func() bool { return !b.db.LastPingReceived(a.Self().ID(), a.Self().IP()).IsZero() })
+	// The remote end pings back to verify the endpoint.
+	waitFor(t, "ping back", func() bool { return b.checkBond(a.Self().ID(), a.Self().IP()) })
+}
+
+func TestUDP_RequiresEndpointProof(t *testing.T) {
+	// The nodes don't know each other, so no bond is created on startup.
+	network := newMemNetwork()
+	a, b := startTestNode(t, network, 40000, nil), startTestNode(t, network, 40001, nil)
+	defer a.close()
+	defer b.close()
+	from := &net.UDPAddr{IP: a.Self().IP(), Port: a.Self().UDP()}
+	exp := uint64(time.Now().Add(expiration).Unix())
+
+	for _, req := range []Packet{
+		&Findnode{Expiration: exp},
+		&ENRRequest{Expiration: exp},
+		&TopicRegister{Topic: "qc", Expiration: exp},
+		&TopicQuery{Topic: "qc", Expiration: exp},
+	} {
+		packet, _, err := Encode(a.key, req)
+		if err != nil {
+			t.Fatalf("failed %v", err)
+		}
+		if err := b.handlePacket(from, packet); err != errUnknownNode {
+			t.Errorf("%s: got %v, want %v", req.Name(), err, errUnknownNode)
+		}
+	}
+
+	expired, _, _ := Encode(a.key, &Ping{Version: Version, Expiration: uint64(time.Now().Add(-time.Minute).Unix())})
+	if err := b.handlePacket(from, expired); err != errExpired {
+		t.Errorf("expired ping: got %v", err)
+	}
+}
+
+func TestUDP_RequestENR(t *testing.T) {
+	nodes := startTestNetwork(t, 2)
+	defer closeTestNetwork(nodes)
+	a, b := nodes[0], nodes[1]
+
+	n, err := a.RequestENR(b.Self())
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if n.ID() != b.Self().ID() || n.Seq() != b.Self().Seq() {
+		t.Fatalf("wrong record %v", n)
+	}
+	if n.TCP() != b.Self().TCP() || n.UDP() != b.Self().UDP() {
+		t.Fatalf("wrong endpoint %v", n)
+	}
+}
+
+func TestUDP_RandomNodes(t *testing.T) {
+	nodes := startTestNetwork(t, 6)
+	defer closeTestNetwork(nodes)
+
+	it := nodes[len(nodes)-1].RandomNodes()
+	defer it.Close()
+
+	want := make(map[enode.ID]bool)
+	for _, n := range nodes[:len(nodes)-1] {
+		want[n.Self().ID()] = true
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for len(want) > 0 && it.Next() {
+			delete(want, it.Node().ID())
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(20 * time.Second):
+		it.Close()
+		<-done
+		t.Fatalf("nodes not found: %d", len(want))
+	}
+}
+
+func TestUDP_Topics(t *testing.T) {
+	nodes := startTestNetwork(t, 5)
+	defer closeTestNetwork(nodes)
+	registrant, searcher := nodes[2], nodes[4]
+
+	// Let the registrant learn about the other nodes.
+	registrant.lookupSelf()
+	registrant.registerTopic("qc")
+
+	it := searcher.TopicNodes("qc")
+	defer it.Close()
+	done := make(chan *enode.Node, 1)
+	go func() {
+		if it.Next() {
+			done <- it.Node()
+		}
+		close(done)
+	}()
+	select {
+	case n := <-done:
+		if n == nil || n.ID() != registrant.Self().ID() {
+			t.Fatalf("wrong topic node %v", n)
+		}
+		if n.TCP() != registrant.Self().TCP() {
+			t.Fatalf("wrong tcp port %d", n.TCP())
+		}
+	case <-time.After(20 * time.Second):
+		it.Close()
+		t.Fatalf("topic node not found")
+	}
+}
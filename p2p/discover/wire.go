@@ -0,0 +1,312 @@
+package discover
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/crypto"
+	"github.com/QuantumCoinProject/qc/crypto/cryptobase"
+	"github.com/QuantumCoinProject/qc/crypto/signaturealgorithm"
+	"github.com/QuantumCoinProject/qc/p2p/enode"
+	"github.com/QuantumCoinProject/qc/p2p/enr"
+	"github.com/QuantumCoinProject/qc/rlp"
+)
+
+// RPC packet types
+const (
+	PingPacket = iota + 1 // zero is 'reserved'
+	PongPacket
+	FindnodePacket
+	NeighborsPacket
+	ENRRequestPacket
+	ENRResponsePacket
+	TopicRegisterPacket
+	TopicQueryPacket
+	TopicNodesPacket
+)
+
+// Packet is implemented by all message types.
+type Packet interface {
+	Name() string // Name returns a string corresponding to the message type.
+	Kind() byte   // Kind returns the message type.
+}
+
+type (
+	// Ping is sent to prove the endpoint of the sender and to check the liveness of the recipient.
+	Ping struct {
+		Version    uint
+		From, To   Endpoint
+		Expiration uint64
+		ENRSeq     uint64 // Sequence number of the sender's record
+
+		// Ignore additional fields (for forward compatibility).
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
+	// Pong is the reply to Ping.
+	Pong struct {
+		// This field should mirror the UDP envelope address
+		// of the ping packet, which provides a way to discover the
+		// external address (after NAT).
+		To         Endpoint
+		ReplyTok   []byte // This contains the hash of the ping packet.
+		Expiration uint64 // Absolute timestamp at which the packet becomes invalid.
+		ENRSeq     uint64 // Sequence number of the sender's record
+
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
+	// Findnode is a query for nodes close to the given target.
+	Findnode struct {
+		Target     enode.ID
+		Expiration uint64
+
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
+	// Neighbors is the reply to Findnode.
+	Neighbors struct {
+		Nodes      []Node
+		Expiration uint64
+
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
+	// ENRRequest queries for the remote node's signed record.
+	ENRRequest struct {
+		Expiration uint64
+
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
+	// ENRResponse is the reply to ENRRequest.
+	ENRResponse struct {
+		ReplyTok []byte // Hash of the ENRRequest packet.
+		Record   enr.Record
+
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
+	// TopicRegister asks the recipient to advertise the sender under the given topic.
+	TopicRegister struct {
+		Topic      string
+		TCP        uint16 // RLPx port of the sender
+		Expiration uint64
+
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
+	// TopicQuery asks the recipient for nodes advertised under the given topic.
+	TopicQuery struct {
+		Topic      string
+		Expiration uint64
+
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
+	// TopicNodes is the reply to TopicQuery.
+	TopicNodes struct {
+		Topic      string
+		Nodes      []Node
+		Expiration uint64
+
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+)
+
+// Endpoint represents a network endpoint.
+type Endpoint struct {
+	IP  net.IP // len 4 for IPv4 or 16 for IPv6
+	UDP uint16 // for discovery protocol
+	TCP uint16 // for RLPx protocol
+}
+
+// NewEndpoint creates an endpoint.
+func NewEndpoint(addr *net.UDPAddr, tcpPort uint16) Endpoint {
+	ip := net.IP{}
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		ip = ip4
+	} else if ip6 := addr.IP.To16(); ip6 != nil {
+		ip = ip6
+	}
+	return Endpoint{IP: ip, UDP: uint16(addr.Port), TCP: tcpPort}
+}
+
+// Node represents information about a node. The ID is the serialized hybrid public key.
+type Node struct {
+	IP  net.IP // len 4 for IPv4 or 16 for IPv6
+	UDP uint16 // for discovery protocol
+	TCP uint16 // for RLPx protocol
+	ID  []byte
+}
+
+func (req *Ping) Name() string { return "PING" }
+func (req *Ping) Kind() byte   { return PingPacket }
+
+func (req *Pong) Name() string { return "PONG" }
+func (req *Pong) Kind() byte   { return PongPacket }
+
+func (req *Findnode) Name() string { return "FINDNODE" }
+func (req *Findnode) Kind() byte   { return FindnodePacket }
+
+func (req *Neighbors) Name() string { return "NEIGHBORS" }
+func (req *Neighbors) Kind() byte   { return NeighborsPacket }
+
+func (req *ENRRequest) Name() string { return "ENRREQUEST" }
+func (req *ENRRequest) Kind() byte   { return ENRRequestPacket }
+
+func (req *ENRResponse) Name() string { return "ENRRESPONSE" }
+func (req *ENRResponse) Kind() byte   { return ENRResponsePacket }
+
+func (req *TopicRegister) Name() string { return "TOPICREGISTER" }
+func (req *TopicRegister) Kind() byte   { return TopicRegisterPacket }
+
+func (req *TopicQuery) Name() string { return "TOPICQUERY" }
+func (req *TopicQuery) Kind() byte   { return TopicQueryPacket }
+
+func (req *TopicNodes) Name() string { return "TOPICNODES" }
+func (req *TopicNodes) Kind() byte   { return TopicNodesPacket }
+
+// Expired checks whether the given UNIX time stamp is in the past.
+func Expired(ts uint64) bool {
+	return time.Unix(int64(ts), 0).Before(time.Now())
+}
+
+// Encoder/decoder.
+
+const (
+	macSize = 32
+
+	// maxPacketSize is the largest packet accepted. Hybrid signatures and public keys
+	// are much larger than their ECDSA counterparts, so packets routinely exceed the
+	// 1280 byte limit of discovery v4 and rely on IP fragmentation.
+	maxPacketSize = 16 * 1024
+)
+
+var (
+	ErrPacketTooSmall = errors.New("too small")
+	ErrPacketTooLarge = errors.New("too large")
+	ErrBadHash        = errors.New("bad hash")
+	ErrBadSignature   = errors.New("bad signature")
+)
+
+var headSpace = make([]byte, macSize+sigSize())
+
+func sigSize() int {
+	return cryptobase.SigAlg.SignatureWithPublicKeyLength()
+}
+
+func headSize() int {
+	return macSize + sigSize()
+}
+
+// Decode reads a discovery packet. It returns the packet, the public key of the sender
+// and the hash of the packet.
+func Decode(input []byte) (Packet, *signaturealgorithm.PublicKey, []byte, error) {
+	if len(input) < headSize()+1 {
+		return nil, nil, nil, ErrPacketTooSmall
+	}
+	if len(input) > maxPacketSize {
+		return nil, nil, nil, ErrPacketTooLarge
+	}
+	hash, sig, sigdata := input[:macSize], input[macSize:headSize()], input[headSize():]
+	shouldhash := crypto.Keccak256(input[macSize:])
+	if !bytes.Equal(hash, shouldhash) {
+		return nil, nil, nil, ErrBadHash
+	}
+	fromKey, err := recoverNodeKey(crypto.Keccak256(sigdata), sig)
+	if err != nil {
+		return nil, nil, hash, err
+	}
+
+	var req Packet
+	switch ptype := sigdata[0]; ptype {
+	case PingPacket:
+		req = new(Ping)
+	case PongPacket:
+		req = new(Pong)
+	case FindnodePacket:
+		req = new(Findnode)
+	case NeighborsPacket:
+		req = new(Neighbors)
+	case ENRRequestPacket:
+		req = new(ENRRequest)
+	case ENRResponsePacket:
+		req = new(ENRResponse)
+	case TopicRegisterPacket:
+		req = new(TopicRegister)
+	case TopicQueryPacket:
+		req = new(TopicQuery)
+	case TopicNodesPacket:
+		req = new(TopicNodes)
+	default:
+		return nil, fromKey, hash, fmt.Errorf("unknown type: %d", ptype)
+	}
+	s := rlp.NewStream(bytes.NewReader(sigdata[1:]), 0)
+	err = s.Decode(req)
+	return req, fromKey, hash, err
+}
+
+// Encode encodes a discovery packet.
+func Encode(priv *signaturealgorithm.PrivateKey, req Packet) (packet, hash []byte, err error) {
+	b := new(bytes.Buffer)
+	b.Write(headSpace)
+	b.WriteByte(req.Kind())
+	if err := rlp.Encode(b, req); err != nil {
+		return nil, nil, err
+	}
+	packet = b.Bytes()
+	sig, err := cryptobase.SigAlg.Sign(crypto.Keccak256(packet[headSize():]), priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(sig) != sigSize() {
+		return nil, nil, ErrBadSignature
+	}
+	copy(packet[macSize:], sig)
+	// Add the hash to the front. Note: this doesn't protect the packet in any way.
+	hash = crypto.Keccak256(packet[macSize:])
+	copy(packet, hash)
+	if len(packet) > maxPacketSize {
+		return nil, nil, ErrPacketTooLarge
+	}
+	return packet, hash, nil
+}
+
+// recoverNodeKey extracts the public key embedded in the hybrid signature and verifies
+// the signature against it.
+func recoverNodeKey(hash, sig []byte) (*signaturealgorithm.PublicKey, error) {
+	_, pubBytes, err := common.ExtractTwoParts(sig)
+	if err != nil {
+		return nil, ErrBadSignature
+	}
+	if !cryptobase.SigAlg.Verify(pubBytes, hash, sig) {
+		return nil, ErrBadSignature
+	}
+	key, err := cryptobase.SigAlg.DeserializePublicKey(pubBytes)
+	if err != nil {
+		return nil, ErrBadSignature
+	}
+	return key, nil
+}
+
+// EncodePubkey encodes a public key.
+func EncodePubkey(key *signaturealgorithm.PublicKey) []byte {
+	b, err := cryptobase.SigAlg.SerializePublicKey(key)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// DecodePubkey reads an encoded public key.
+func DecodePubkey(e []byte) (*signaturealgorithm.PublicKey, error) {
+	if len(e) != cryptobase.SigAlg.PublicKeyLength() {
+		return nil, errors.New("wrong size public key data")
+	}
+	return cryptobase.SigAlg.DeserializePublicKey(e)
+}
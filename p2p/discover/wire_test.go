@@ -0,0 +1,141 @@
+package discover
+
+import (
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/QuantumCoinProject/qc/crypto"
+	"github.com/QuantumCoinProject/qc/crypto/cryptobase"
+	"github.com/QuantumCoinProject/qc/p2p/enode"
+	"github.com/QuantumCoinProject/qc/rlp"
+)
+
+// rawPacket encodes a packet payload as is.
+type rawPacket struct {
+	kind    byte
+	payload []byte
+}
+
+func (p *rawPacket) Name() string { return "RAW" }
+func (p *rawPacket) Kind() byte   { return p.kind }
+
+func (p *rawPacket) EncodeRLP(w io.Writer) error {
+	_, err := w.Write(p.payload)
+	return err
+}
+
+func TestWire_EncodeDecode(t *testing.T) {
+	key, _ := cryptobase.SigAlg.GenerateKey()
+	exp := uint64(time.Now().Add(expiration).Unix())
+
+	packets := []Packet{
+		&Ping{
+			Version:    Version,
+			From:       Endpoint{IP: net.IP{127, 0, 0, 1}, UDP: 30303, TCP: 30303},
+			To:         Endpoint{IP: net.IP{10, 0, 0, 1}, UDP: 30304},
+			Expiration: exp,
+			ENRSeq:     3,
+			Rest:       []rlp.RawValue{},
+		},
+		&Pong{To: Endpoint{IP: net.IP{127, 0, 0, 1}, UDP: 30303}, ReplyTok: []byte{1, 2, 3}, Expiration: exp, ENRSeq: 1, Rest: []rlp.RawValue{}},
+		&Findnode{Target: enode.ID{1}, Expiration: exp, Rest: []rlp.RawValue{}},
+		&ENRRequest{Expiration: exp, Rest: []rlp.RawValue{}},
+		&TopicRegister{Topic: "eth", TCP: 30303, Expiration: exp, Rest: []rlp.RawValue{}},
+		&TopicQuery{Topic: "eth", Expiration: exp, Rest: []rlp.RawValue{}},
+	}
+	for _, p := range packets {
+		data, hash, err := Encode(key, p)
+		if err != nil {
+			t.Fatalf("%s: encode failed %v", p.Name(), err)
+		}
+		decoded, fromKey, decodedHash, err := Decode(data)
+		if err != nil {
+			t.Fatalf("%s: decode failed %v", p.Name(), err)
+		}
+		if !reflect.DeepEqual(decoded, p) {
+			t.Errorf("%s: mismatch\ngot  %#v\nwant %#v", p.Name(), decoded, p)
+		}
+		if enode.PubkeyToIDV4(fromKey) != enode.PubkeyToIDV4(&key.PublicKey) {
+			t.Errorf("%s: wrong sender", p.Name())
+		}
+		if !reflect.DeepEqual(hash, decodedHash) {
+			t.Errorf("%s: hash mismatch", p.Name())
+		}
+	}
+}
+
+func TestWire_DecodeErrors(t *testing.T) {
+	key, _ := cryptobase.SigAlg.GenerateKey()
+	data, _, err := Encode(key, &Findnode{Expiration: uint64(time.Now().Add(expiration).Unix())})
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	if _, _, _, err := Decode(data[:headSize()]); err != ErrPacketTooSmall {
+		t.Errorf("short packet: got %v", err)
+	}
+	if _, _, _, err := Decode(make([]byte, maxPacketSize+1)); err != ErrPacketTooLarge {
+		t.Errorf("large packet: got %v", err)
+	}
+
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-1]++
+	if _, _, _, err := Decode(tampered); err != ErrBadHash {
+		t.Errorf("tampered hash: got %v", err)
+	}
+
+	// Changing the payload and fixing the hash must fail the signature check.
+	tampered = append([]byte{}, data...)
+	tampered[len(tampered)-1]++
+	copy(tampered, crypto.Keccak256(tampered[macSize:]))
+	if _, _, _, err := Decode(tampered); err != ErrBadSignature {
+		t.Errorf("tampered payload: got %v", err)
+	}
+}
+
+func TestWire_ForwardCompatibility(t *testing.T) {
+	key, _ := cryptobase.SigAlg.GenerateKey()
+
+	// A newer version of the protocol may add fields to a packet.
+	p := &Ping{Version: Version, Expiration: uint64(time.Now().Add(expiration).Unix())}
+	payload, err := rlp.EncodeToBytes([]interface{}{p.Version, p.From, p.To, p.Expiration, p.ENRSeq, []byte{1, 2}})
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	data, _, err := Encode(key, &rawPacket{kind: PingPacket, payload: payload})
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	decoded, _, _, err := Decode(data)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if ping := decoded.(*Ping); ping.Expiration != p.Expiration || len(ping.Rest) != 1 {
+		t.Fatalf("unexpected ping %#v", ping)
+	}
+}
+
+func TestWire_MaxNeighborsFit(t *testing.T) {
+	key, _ := cryptobase.SigAlg.GenerateKey()
+	nodes := make([]Node, maxNeighbors)
+	for i := range nodes {
+		nkey, _ := cryptobase.SigAlg.GenerateKey()
+		nodes[i] = Node{
+			IP:  net.IP{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+			UDP: 65535,
+			TCP: 65535,
+			ID:  EncodePubkey(&nkey.PublicKey),
+		}
+	}
+	exp := uint64(time.Now().Add(expiration).Unix())
+	if _, _, err := Encode(key, &Neighbors{Nodes: nodes, Expiration: exp}); err != nil {
+		t.Fatalf("neighbors: %v", err)
+	}
+	topic := string(make([]byte, maxTopicLength))
+	if _, _, err := Encode(key, &TopicNodes{Topic: topic, Nodes: nodes, Expiration: exp}); err != nil {
+		t.Fatalf("topic nodes: %v", err)
+	}
+}
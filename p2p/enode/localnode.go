@@ -59,6 +59,7 @@ type LocalNode struct {
 type lnEndpoint struct {
 	track                *netutil.IPTracker
 	staticIP, fallbackIP net.IP
+	fallbackUDP          int
 }
 
 // NewLocalNode creates a local node.
@@ -177,10 +178,41 @@ func (ln *LocalNode) SetFallbackIP(ip net.IP) {
 	ln.updateEndpoints()
 }
 
+// SetFallbackUDP sets the last-resort UDP port. This port is used
+// if no endpoint prediction can be made.
+func (ln *LocalNode) SetFallbackUDP(port int) {
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+
+	ln.endpoint4.fallbackUDP = port
+	ln.endpoint6.fallbackUDP = port
+	ln.updateEndpoints()
+}
+
+// UDPEndpointStatement should be called whenever a statement about the local node's
+// UDP endpoint is received. It feeds the local endpoint predictor.
+func (ln *LocalNode) UDPEndpointStatement(fromaddr, endpoint *net.UDPAddr) {
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+
+	ln.endpointForIP(endpoint.IP).track.AddStatement(fromaddr.String(), endpoint.String())
+	ln.updateEndpoints()
+}
+
+// UDPContact should be called whenever the local node has announced itself to another node
+// via UDP. It feeds the local endpoint predictor.
+func (ln *LocalNode) UDPContact(toaddr *net.UDPAddr) {
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+
+	ln.endpointForIP(toaddr.IP).track.AddContact(toaddr.String())
+	ln.updateEndpoints()
+}
+
 // updateEndpoints updates the record with predicted endpoints.
 func (ln *LocalNode) updateEndpoints() {
-	ip4, _ := ln.endpoint4.get()
-	ip6, _ := ln.endpoint6.get()
+	ip4, udp4 := ln.endpoint4.get()
+	ip6, udp6 := ln.endpoint6.get()
 
 	if ip4 != nil && !ip4.IsUnspecified() {
 		ln.set(enr.IPv4(ip4))
@@ -192,10 +224,21 @@ func (ln *LocalNode) updateEndpoints() {
 	} else {
 		ln.delete(enr.IPv6{})
 	}
+	if udp4 != 0 {
+		ln.set(enr.UDP(udp4))
+	} else {
+		ln.delete(enr.UDP(0))
+	}
+	if udp6 != 0 && udp6 != udp4 {
+		ln.set(enr.UDP6(udp6))
+	} else {
+		ln.delete(enr.UDP6(0))
+	}
 }
 
 // get returns the endpoint with highest precedence.
 func (e *lnEndpoint) get() (newIP net.IP, newPort int) {
+	newPort = e.fallbackUDP
 	if e.fallbackIP != nil {
 		newIP = e.fallbackIP
 	}
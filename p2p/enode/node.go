@@ -123,6 +123,16 @@ func (n *Node) TCP() int {
 	return int(port)
 }
 
+// UDP returns the UDP discovery port of the node. Records without a "udp"
+// entry are assumed to use the TCP port for discovery.
+func (n *Node) UDP() int {
+	var port enr.UDP
+	if n.Load(&port) != nil {
+		return n.TCP()
+	}
+	return int(port)
+}
+
 func (n *Node) Address() (common.Address, error) {
 	return cryptobase.SigAlg.PublicKeyToAddress(n.Pubkey())
 }
@@ -40,6 +40,7 @@ const (
 	dbVersionKey   = "version" // Version of the database to flush if changes
 	dbNodePrefix   = "n:"      // Identifier to prefix node entries with
 	dbLocalPrefix  = "local:"
+	dbBanPrefix    = "ban:" // Identifier to prefix peer bans with, keyed by ID only
 	dbDiscoverRoot = "v4"
 	dbDiscv5Root   = "v5"
 
@@ -452,6 +453,16 @@ func (db *DB) UpdateFindFailsV5(id ID, ip net.IP, fails int) error {
 	return db.storeInt64(v5Key(id, ip, dbNodeFindFails), int64(fails))
 }
 
+// BannedUntil retrieves the time until which a node is refused as a peer.
+func (db *DB) BannedUntil(id ID) time.Time {
+	return time.Unix(db.fetchInt64(append([]byte(dbBanPrefix), id[:]...)), 0)
+}
+
+// UpdateBannedUntil stores the time until which a node is refused as a peer.
+func (db *DB) UpdateBannedUntil(id ID, instance time.Time) error {
+	return db.storeInt64(append([]byte(dbBanPrefix), id[:]...), instance.Unix())
+}
+
 // LocalSeq retrieves the local record sequence counter.
 func (db *DB) localSeq(id ID) uint64 {
 	return db.fetchUint64(localItemKey(id, dbLocalSeq))
@@ -83,6 +83,12 @@ func ParseV4(rawurl string) (*Node, error) {
 // NewV4 creates a node from discovery v4 node information. The record
 // contained in the node has a zero-length signature.
 func NewV4(pubkey *signaturealgorithm.PublicKey, ip net.IP, tcp int) *Node {
+	return NewV4WithUDP(pubkey, ip, tcp, 0)
+}
+
+// NewV4WithUDP creates a node from discovery node information, including the UDP
+// discovery port. The record contained in the node has a zero-length signature.
+func NewV4WithUDP(pubkey *signaturealgorithm.PublicKey, ip net.IP, tcp, udp int) *Node {
 	var r enr.Record
 	if len(ip) > 0 {
 		r.Set(enr.IP(ip))
@@ -90,6 +96,9 @@ func NewV4(pubkey *signaturealgorithm.PublicKey, ip net.IP, tcp int) *Node {
 	if tcp != 0 {
 		r.Set(enr.TCP(tcp))
 	}
+	if udp != 0 {
+		r.Set(enr.UDP(udp))
+	}
 	signV4Compat(&r, pubkey)
 	n, err := New(v4CompatID{}, &r)
 	if err != nil {
@@ -106,8 +115,8 @@ func isNewV4(n *Node) bool {
 
 func parseComplete(rawurl string) (*Node, error) {
 	var (
-		id      *signaturealgorithm.PublicKey
-		tcpPort uint64
+		id               *signaturealgorithm.PublicKey
+		tcpPort, udpPort uint64
 	)
 	u, err := url.Parse(rawurl)
 	if err != nil {
@@ -140,8 +149,15 @@ func parseComplete(rawurl string) (*Node, error) {
 	if tcpPort, err = strconv.ParseUint(u.Port(), 10, 16); err != nil {
 		return nil, errors.New("invalid port")
 	}
+	qv := u.Query()
+	if qv.Get("discport") != "" {
+		udpPort, err = strconv.ParseUint(qv.Get("discport"), 10, 16)
+		if err != nil {
+			return nil, errors.New("invalid discport in query")
+		}
+	}
 
-	return NewV4(id, ip, int(tcpPort)), nil
+	return NewV4WithUDP(id, ip, int(tcpPort), int(udpPort)), nil
 }
 
 // parsePubkey parses a hex-encoded public key.
@@ -181,6 +197,9 @@ func (n *Node) URLv4() string {
 		addr := net.TCPAddr{IP: n.IP(), Port: n.TCP()}
 		u.User = url.User(nodeid)
 		u.Host = addr.String()
+		if n.UDP() != n.TCP() {
+			u.RawQuery = "discport=" + strconv.Itoa(n.UDP())
+		}
 	}
 	return u.String()
 }
@@ -113,10 +113,11 @@ var parseNodeTests = []struct {
 	},
 	{
 		input: "enode://" + hexpubkeytest1 + "@127.0.0.1:52150?discport=22334",
-		wantResult: NewV4(
+		wantResult: NewV4WithUDP(
 			hexPubkey(hexpubkeytest1),
 			net.IP{0x7f, 0x0, 0x0, 0x1},
 			52150,
+			22334,
 		),
 	},
 	// Incomplete node URLs with no address
@@ -41,6 +41,11 @@ var (
 	egressConnectMeter  = metrics.NewRegisteredMeter("p2p/dials", nil)
 	egressTrafficMeter  = metrics.NewRegisteredMeter(egressMeterName, nil)
 	activePeerGauge     = metrics.NewRegisteredGauge("p2p/peers", nil)
+	peerPenaltyMeter    = metrics.NewRegisteredMeter("p2p/score/penalties", nil)
+	peerBanMeter        = metrics.NewRegisteredMeter("p2p/score/bans", nil)
+	throttleMeter       = metrics.NewRegisteredMeter("p2p/throttle/delayed", nil)
+	throttleTimer       = metrics.NewRegisteredTimer("p2p/throttle/wait", nil)
+	priorityEgressMeter = metrics.NewRegisteredMeter("p2p/egress/priority", nil)
 )
 
 // meteredConn is a wrapper around a net.Conn that meters both the
@@ -120,6 +120,9 @@ type Peer struct {
 
 	disconnectTriggerTime time.Time
 	peerLock              sync.Mutex
+
+	traffic *trafficCounter // Traffic exchanged with the peer, set by the server
+	limiter *egressLimiter  // Bandwidth limits of outbound messages, nil if unlimited
 }
 
 // NewPeer returns a peer for testing purposes.
@@ -399,6 +402,9 @@ func (p *Peer) handle(msg Msg) error {
 			log.Trace("hanndle code out of rang", "peer", p.ID().String())
 			return fmt.Errorf("msg code out of range: %v", msg.Code)
 		}
+		if p.traffic != nil {
+			p.traffic.ingress(messageKey(proto.cap(), msg.Code-proto.offset), msg.Size)
+		}
 		if metrics.Enabled {
 			m := fmt.Sprintf("%s/%s/%d/%#02x", ingressMeterName, proto.Name, proto.Version, msg.Code-proto.offset)
 			metrics.GetOrRegisterMeter(m, nil).Mark(int64(msg.meterSize))
@@ -462,6 +468,8 @@ func (p *Peer) startProtocols(writeStart <-chan struct{}, writeErr chan<- error)
 		proto.closed = p.closed
 		proto.wstart = writeStart
 		proto.werr = writeErr
+		proto.traffic = p.traffic
+		proto.limiter = p.limiter
 		var rw MsgReadWriter = proto
 		if p.events != nil {
 			rw = newMsgEventer(rw, p.events, p.ID(), proto.Name, p.Info().Network.RemoteAddress, p.Info().Network.LocalAddress)
@@ -504,6 +512,9 @@ type protoRW struct {
 	werr   chan<- error    // for write results
 	offset uint64
 	w      MsgWriter
+
+	traffic *trafficCounter
+	limiter *egressLimiter
 }
 
 func (rw *protoRW) WriteMsg(msg Msg) (err error) {
@@ -515,6 +526,20 @@ func (rw *protoRW) WriteMsg(msg Msg) (err error) {
 	msg.meterCap = rw.cap()
 	msg.meterCode = msg.Code
 
+	priority := rw.Priority != nil && rw.Priority(msg.Code)
+	throttled := false
+	if rw.limiter != nil {
+		if throttled, err = rw.limiter.wait(msg.Size, priority, rw.closed); err != nil {
+			return err
+		}
+	}
+	if priority {
+		priorityEgressMeter.Mark(int64(msg.Size))
+	}
+	if rw.traffic != nil {
+		rw.traffic.egress(messageKey(msg.meterCap, msg.meterCode), msg.Size, throttled)
+	}
+
 	msg.Code += rw.offset
 
 	select {
@@ -560,6 +585,7 @@ type PeerInfo struct {
 		Trusted       bool   `json:"trusted"`
 		Static        bool   `json:"static"`
 	} `json:"network"`
+	Score     float64                `json:"score"`     // Reputation of the peer, see Server.ReportPeer
 	Protocols map[string]interface{} `json:"protocols"` // Sub-protocol specific metadata fields
 }
 
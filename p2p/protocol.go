@@ -61,6 +61,11 @@ type Protocol struct {
 
 	// Attributes contains protocol specific information for the node record.
 	Attributes []enr.Entry
+
+	// Priority reports whether messages with the given code are exempt from
+	// waiting for the bandwidth limits of the server. Their size still counts
+	// against the limits, delaying the other messages instead. Optional.
+	Priority func(code uint64) bool
 }
 
 func (p Protocol) cap() Cap {
@@ -3,24 +3,27 @@ package rlpx
 import (
 	"bytes"
 	cipher2 "crypto/cipher"
+	"crypto/ecdh"
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
 	"github.com/QuantumCoinProject/qc/crypto"
 	"github.com/QuantumCoinProject/qc/crypto/cryptobase"
-	"github.com/QuantumCoinProject/qc/crypto/keyestablishmentalgorithm"
 	"github.com/QuantumCoinProject/qc/crypto/oqs"
 	"github.com/QuantumCoinProject/qc/crypto/signaturealgorithm"
 	"github.com/QuantumCoinProject/qc/log"
 	"github.com/QuantumCoinProject/qc/rlp"
 	"io"
 	"sync"
+	"time"
 )
 
 type clientHelloMessage struct {
-	ClientKemPublicKey    []byte //kemPublicKeyLen
+	ClientKemPublicKey    []byte //Kyber512 public key of the version 1 handshake, empty once it is no longer accepted
 	ClientHelloRandomData [shaLen]byte
 	Version               uint
+	ClientEcdhPublicKey   []byte         `rlp:"optional"` //X25519 public key
+	KemKeyShares          []kemKeyShare  `rlp:"optional"` //one per offered ML-KEM level
 	Rest                  []rlp.RawValue `rlp:"tail"`
 }
 
@@ -31,10 +34,13 @@ type clientVerifyMessage struct {
 }
 
 type Client struct {
-	ephemeralKemPrivateKey  *keyestablishmentalgorithm.PrivateKey
-	kem                     *oqs.KeyEncapsulation
-	kemCipherText           []byte //kemCipherTextLength
-	kemSharedSecret         []byte //kemSecretLength
+	ephemeralEcdhKey        *ecdh.PrivateKey
+	kems                    map[uint]*oqs.KeyEncapsulation //offered ML-KEM levels
+	legacyKem               *oqs.KeyEncapsulation          //Kyber512 KEM offered to version 1 servers
+	kemLevel                uint                           //ML-KEM level selected by the server
+	kemSharedSecret         []byte                         //hybrid shared secret, or the Kyber512 secret in version 1
+	version                 uint                           //handshake version selected by the server
+	maxVersion              uint                           //highest handshake version offered
 	Nonce                   uint
 	clientSigningPrivateKey *signaturealgorithm.PrivateKey
 	serverSigningPublicKey  *signaturealgorithm.PublicKey
@@ -67,6 +73,9 @@ type Client struct {
 	handshakeDone bool
 	mutex         sync.Mutex
 
+	config        Config
+	clientKeyTime time.Time //when the client application key was established
+
 	context string
 }
 
@@ -89,6 +98,8 @@ func NewClient(conn io.ReadWriter, clientSigningPrivateKey *signaturealgorithm.P
 	client.clientSeqNumApplication = 1
 	client.serializer.SetContext("client " + context)
 	client.context = context
+	client.config = DefaultConfig
+	client.maxVersion = handshakeVersion
 
 	return &client
 }
@@ -97,6 +108,23 @@ func (c *Client) SetClientSigningPrivateKey(clientSigningPrivateKey *signatureal
 	c.clientSigningPrivateKey = clientSigningPrivateKey
 }
 
+// SetConfig sets the key exchange and rekeying settings. It must be called before
+// the handshake.
+func (c *Client) SetConfig(config Config) {
+	c.config = config
+}
+
+// KemLevel returns the ML-KEM level negotiated in the handshake, zero for the
+// version 1 handshake.
+func (c *Client) KemLevel() uint {
+	return c.kemLevel
+}
+
+// Version returns the handshake version negotiated in the handshake.
+func (c *Client) Version() uint {
+	return c.version
+}
+
 func (c *Client) SetServerSigningPublicKey(serverSigningPublicKey *signaturealgorithm.PublicKey) {
 	c.serverSigningPublicKey = serverSigningPublicKey
 }
@@ -110,17 +138,8 @@ func (c *Client) PerformHandshake() error {
 		return errors.New("Handshake already done")
 	}
 
-	//Initialize KEM
-	kem := oqs.KeyEncapsulation{}
-
-	err := kem.Init(oqs.KemName, nil)
-	if err != nil {
-		return err
-	}
-	c.kem = &kem
-
 	//Make client hello message
-	err = c.makeClientHello()
+	err := c.makeClientHello()
 	if err != nil {
 		return err
 	}
@@ -165,6 +184,9 @@ func (c *Client) PerformHandshake() error {
 
 	//Create the secrets
 	secret, err := NewSessionSecret(transcriptHash, c.kemSharedSecret[:])
+	if err != nil {
+		return err
+	}
 	c.secret = *secret
 
 	//Receive the server verify message
@@ -249,26 +271,61 @@ func (c *Client) PerformHandshake() error {
 	}
 
 	c.handshakeDone = true
+	c.clientKeyTime = time.Now()
 
 	return nil
 }
 
 func (c *Client) makeClientHello() error {
 	clientHelloMessage := new(clientHelloMessage)
-	clientHelloMessage.Version = 1
+	clientHelloMessage.Version = c.maxVersion
 
-	//Generate an ephemeral kem keypair
-	kemPrivateKey, err := c.kem.GenerateKemKeyPair()
-	if err != nil {
-		return err
+	//Offer a Kyber512 key to servers that only speak the version 1 handshake
+	if c.config.legacyHandshakeAccepted() {
+		kem, err := newLegacyKem()
+		if err != nil {
+			return err
+		}
+		c.legacyKem = kem
+		publicKey, err := generateKemKeyShare(kem)
+		if err != nil {
+			return err
+		}
+		clientHelloMessage.ClientKemPublicKey = publicKey
+	}
+
+	if c.maxVersion >= handshakeVersion {
+		//Generate an ephemeral X25519 key
+		ecdhKey, err := generateEcdhKey()
+		if err != nil {
+			return err
+		}
+		c.ephemeralEcdhKey = ecdhKey
+		clientHelloMessage.ClientEcdhPublicKey = ecdhKey.PublicKey().Bytes()
+
+		//Generate an ephemeral kem keypair for every offered level
+		levels, err := c.config.offeredKemLevels()
+		if err != nil {
+			return err
+		}
+		c.kems = make(map[uint]*oqs.KeyEncapsulation, len(levels))
+		for _, level := range levels {
+			kem, err := newKem(level)
+			if err != nil {
+				return err
+			}
+			c.kems[level] = kem
+			publicKey, err := generateKemKeyShare(kem)
+			if err != nil {
+				return err
+			}
+			clientHelloMessage.KemKeyShares = append(clientHelloMessage.KemKeyShares, kemKeyShare{Level: level, PublicKey: publicKey})
+		}
 	}
-	c.ephemeralKemPrivateKey = kemPrivateKey
-	clientHelloMessage.ClientKemPublicKey = make([]byte, c.kem.AlgDetails.LengthPublicKey)
-	copy(clientHelloMessage.ClientKemPublicKey[:], c.ephemeralKemPrivateKey.N.Bytes())
 
 	// Generate ClientRandomData
 	randomData := make([]byte, shaLength)
-	_, err = rand.Read(randomData)
+	_, err := rand.Read(randomData)
 	if err != nil {
 		return err
 	}
@@ -280,20 +337,54 @@ func (c *Client) makeClientHello() error {
 }
 
 func (c *Client) Cleanup() {
-	if c.kem != nil {
-		c.kem.Clean()
+	for _, kem := range c.kems {
+		kem.Clean()
+	}
+	c.kems = nil
+	if c.legacyKem != nil {
+		c.legacyKem.Clean()
+		c.legacyKem = nil
 	}
 }
 
 func (c *Client) handleServerHello() error {
+	switch {
+	case c.serverHelloMessage.Version == legacyHandshakeVersion && c.legacyKem != nil:
+		return c.handleLegacyServerHello()
+	case c.serverHelloMessage.Version != handshakeVersion || c.kems == nil:
+		return errHandshakeVersion
+	}
 
-	sharedSecret, err := c.kem.DecapsulateSecret(c.serverHelloMessage.CipherText[:])
+	kem, ok := c.kems[c.serverHelloMessage.KemLevel]
+	if !ok {
+		return errInvalidKemLevel
+	}
+	kemSecret, err := kem.DecapsulateSecret(c.serverHelloMessage.CipherText[:])
 	if err != nil {
 		return err
 	}
 
-	c.kemSharedSecret = make([]byte, c.kem.AlgDetails.LengthSharedSecret)
-	copy(c.kemSharedSecret[:], sharedSecret[:])
+	ecdhSecret, err := ecdhSharedSecret(c.ephemeralEcdhKey, c.serverHelloMessage.ServerEcdhPublicKey)
+	if err != nil {
+		return err
+	}
+
+	c.kemLevel = c.serverHelloMessage.KemLevel
+	c.kemSharedSecret = hybridSecret(ecdhSecret, kemSecret)
+	c.version = handshakeVersion
+
+	return nil
+}
+
+// handleLegacyServerHello completes the Kyber512 key exchange of the version 1
+// handshake.
+func (c *Client) handleLegacyServerHello() error {
+	sharedSecret, err := c.legacyKem.DecapsulateSecret(c.serverHelloMessage.CipherText[:])
+	if err != nil {
+		return err
+	}
+	c.kemSharedSecret = sharedSecret
+	c.version = legacyHandshakeVersion
 
 	return nil
 }
@@ -315,7 +406,10 @@ func (c *Client) ReadAndDecryptMessage(msg interface{}, packetType PacketType) e
 
 func (c *Client) WriteEncrypted(data []byte, context uint64, packetType PacketType) error {
 	if packetType == PacketTypeApplicationData {
-		if c.handshakeDone != true {
+		if c.handshakeDone && c.version >= handshakeVersion && c.config.rekeyDue(c.clientSeqNumApplication, c.clientKeyTime) {
+			if err := c.updateWriteKey(); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -376,7 +470,36 @@ func (c *Client) WriteEncrypted(data []byte, context uint64, packetType PacketTy
 	return nil
 }
 
+// updateWriteKey tells the server that the client switches to its next
+// application traffic key and then switches.
+func (c *Client) updateWriteKey() error {
+	if err := c.WriteEncrypted(nil, 0, PacketTypeKeyUpdate); err != nil {
+		return err
+	}
+	if err := c.secret.UpdateClientApplicationSecret(); err != nil {
+		return err
+	}
+	c.clientSeqNumApplication = 1
+	c.clientKeyTime = time.Now()
+	return nil
+}
+
+// ReadAndDecrypt reads the next record of the given type. Key updates sent by the
+// server in between application data are applied transparently.
 func (c *Client) ReadAndDecrypt(packetType PacketType) (*DataPacket, error) {
+	for {
+		dataPacket, err := c.readRecord(packetType)
+		if err != nil || dataPacket.packetType != PacketTypeKeyUpdate {
+			return dataPacket, err
+		}
+		if err := c.secret.UpdateServerApplicationSecret(); err != nil {
+			return nil, err
+		}
+		c.serverSeqNumApplication = 1
+	}
+}
+
+func (c *Client) readRecord(packetType PacketType) (*DataPacket, error) {
 	if packetType == PacketTypeApplicationData {
 
 	}
@@ -424,7 +547,7 @@ func (c *Client) ReadAndDecrypt(packetType PacketType) (*DataPacket, error) {
 		return nil, err
 	}
 
-	if dataPacket.packetType != packetType {
+	if dataPacket.packetType != packetType && !(packetType == PacketTypeApplicationData && dataPacket.packetType == PacketTypeKeyUpdate) {
 		return nil, errors.New("packetType mismatch")
 	}
 	dataPacket.context = header.Context
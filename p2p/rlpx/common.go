@@ -28,6 +28,7 @@ type PacketType byte
 const (
 	PacketTypeHandshake       PacketType = 21
 	PacketTypeApplicationData PacketType = 23
+	PacketTypeKeyUpdate       PacketType = 24 // sender switches to its next application traffic key
 	ReadTimeout                          = time.Second * 10
 	WriteTimeout                         = time.Second * 20
 )
@@ -0,0 +1,187 @@
+package rlpx
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/crypto/oqs"
+	"github.com/QuantumCoinProject/qc/rlp"
+)
+
+// handshakeVersion is the version of the hybrid handshake. Version 1 uses a single
+// Kyber512 key exchange and no rekeying; it is accepted, and offered to servers
+// that do not speak version 2, until Config.LegacyHandshakeCutover.
+const (
+	handshakeVersion       = 2
+	legacyHandshakeVersion = 1
+)
+
+var (
+	errHandshakeVersion = errors.New("unsupported handshake version")
+	errNoCommonKemLevel = errors.New("no common ML-KEM level")
+	errInvalidKemLevel  = errors.New("invalid ML-KEM level")
+)
+
+// kemLevels lists the supported ML-KEM parameter sets, weakest first.
+var kemLevels = []uint{512, 768, 1024}
+
+var kemNames = map[uint]string{
+	512:  "ML-KEM-512",
+	768:  "ML-KEM-768",
+	1024: "ML-KEM-1024",
+}
+
+// Config contains the key exchange and rekeying settings of a connection.
+type Config struct {
+	// KemLevel is the weakest ML-KEM parameter set (512, 768 or 1024) accepted in
+	// the handshake. Zero selects the default.
+	KemLevel uint `toml:",omitempty"`
+
+	// RekeyRecords is the number of records written with one traffic key before
+	// it is updated. Zero selects the default.
+	RekeyRecords uint `toml:",omitempty"`
+
+	// RekeyInterval is the time after which the traffic key used for writing is
+	// updated. Zero selects the default.
+	RekeyInterval time.Duration `toml:",omitempty"`
+
+	// LegacyHandshakeCutover is the time after which peers that only speak the
+	// version 1 handshake are rejected. Zero keeps accepting them.
+	LegacyHandshakeCutover time.Time `toml:",omitempty"`
+}
+
+// DefaultConfig contains the default connection settings.
+var DefaultConfig = Config{
+	KemLevel:      768,
+	RekeyRecords:  1 << 24,
+	RekeyInterval: time.Hour,
+}
+
+func (cfg Config) kemLevel() uint {
+	if cfg.KemLevel == 0 {
+		return DefaultConfig.KemLevel
+	}
+	return cfg.KemLevel
+}
+
+// legacyHandshakeAccepted reports whether the version 1 handshake is still
+// accepted and offered.
+func (cfg Config) legacyHandshakeAccepted() bool {
+	return cfg.LegacyHandshakeCutover.IsZero() || time.Now().Before(cfg.LegacyHandshakeCutover)
+}
+
+// offeredKemLevels returns the ML-KEM levels a client offers in its hello message.
+func (cfg Config) offeredKemLevels() ([]uint, error) {
+	min := cfg.kemLevel()
+	if _, ok := kemNames[min]; !ok {
+		return nil, fmt.Errorf("%w: %d", errInvalidKemLevel, min)
+	}
+	var levels []uint
+	for _, level := range kemLevels {
+		if level >= min {
+			levels = append(levels, level)
+		}
+	}
+	return levels, nil
+}
+
+// selectKeyShare picks the weakest offered key share that satisfies the configured
+// minimum level.
+func (cfg Config) selectKeyShare(shares []kemKeyShare) (*kemKeyShare, error) {
+	min := cfg.kemLevel()
+	if _, ok := kemNames[min]; !ok {
+		return nil, fmt.Errorf("%w: %d", errInvalidKemLevel, min)
+	}
+	var selected *kemKeyShare
+	for i := range shares {
+		share := &shares[i]
+		if _, ok := kemNames[share.Level]; !ok || share.Level < min {
+			continue
+		}
+		if selected == nil || share.Level < selected.Level {
+			selected = share
+		}
+	}
+	if selected == nil {
+		return nil, errNoCommonKemLevel
+	}
+	return selected, nil
+}
+
+// rekeyDue reports whether the traffic key that has been used for seqNum-1 records
+// since the given time must be updated before writing the next record.
+func (cfg Config) rekeyDue(seqNum uint, since time.Time) bool {
+	records, interval := cfg.RekeyRecords, cfg.RekeyInterval
+	if records == 0 {
+		records = DefaultConfig.RekeyRecords
+	}
+	if interval == 0 {
+		interval = DefaultConfig.RekeyInterval
+	}
+	return seqNum > records || time.Since(since) >= interval
+}
+
+// kemKeyShare is an ephemeral ML-KEM public key offered by the client.
+type kemKeyShare struct {
+	Level     uint
+	PublicKey []byte
+	Rest      []rlp.RawValue `rlp:"tail"`
+}
+
+// newKem initializes the KEM of the given ML-KEM level.
+func newKem(level uint) (*oqs.KeyEncapsulation, error) {
+	name, ok := kemNames[level]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", errInvalidKemLevel, level)
+	}
+	kem := new(oqs.KeyEncapsulation)
+	if err := kem.Init(name, nil); err != nil {
+		return nil, err
+	}
+	return kem, nil
+}
+
+// newLegacyKem initializes the Kyber512 KEM of the version 1 handshake.
+func newLegacyKem() (*oqs.KeyEncapsulation, error) {
+	kem := new(oqs.KeyEncapsulation)
+	if err := kem.Init(oqs.KemName, nil); err != nil {
+		return nil, err
+	}
+	return kem, nil
+}
+
+// generateKemKeyShare creates an ephemeral key pair of the KEM and returns its
+// public key.
+func generateKemKeyShare(kem *oqs.KeyEncapsulation) ([]byte, error) {
+	priv, err := kem.GenerateKemKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	return common.LeftPadBytes(priv.PublicKey.N.Bytes(), kem.AlgDetails.LengthPublicKey), nil
+}
+
+// generateEcdhKey creates an ephemeral X25519 key.
+func generateEcdhKey() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+// ecdhSharedSecret computes the X25519 shared secret with the remote public key.
+func ecdhSharedSecret(priv *ecdh.PrivateKey, remotePub []byte) ([]byte, error) {
+	pub, err := ecdh.X25519().NewPublicKey(remotePub)
+	if err != nil {
+		return nil, err
+	}
+	return priv.ECDH(pub)
+}
+
+// hybridSecret combines the classical and the post-quantum shared secrets. The
+// session stays secure as long as either of the key exchanges is unbroken.
+func hybridSecret(ecdhSecret, kemSecret []byte) []byte {
+	secret := make([]byte, 0, len(ecdhSecret)+len(kemSecret))
+	secret = append(secret, ecdhSecret...)
+	return append(secret, kemSecret...)
+}
@@ -0,0 +1,271 @@
+package rlpx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/QuantumCoinProject/qc/crypto/cryptobase"
+	"github.com/QuantumCoinProject/qc/p2p/pipes"
+	"github.com/QuantumCoinProject/qc/rlp"
+)
+
+// handshakePair performs a handshake between a client and a server with the given
+// settings.
+func handshakePair(t *testing.T, clientConfig, serverConfig Config) (*Client, *Server, error) {
+	return handshakePairVersions(t, clientConfig, serverConfig, handshakeVersion, handshakeVersion)
+}
+
+// handshakePairVersions is like handshakePair, with peers limited to the given
+// handshake versions. A peer limited to version 1 sends the same hello messages
+// as the nodes released before the hybrid handshake.
+func handshakePairVersions(t *testing.T, clientConfig, serverConfig Config, clientVersion, serverVersion uint) (*Client, *Server, error) {
+	clientConn, serverConn, err := pipes.TCPPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		clientConn.Close()
+		serverConn.Close()
+	})
+	deadline := time.Now().Add(10 * time.Second)
+	clientConn.SetDeadline(deadline)
+	serverConn.SetDeadline(deadline)
+
+	serverSigningKey, err := cryptobase.SigAlg.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientSigningKey, err := cryptobase.SigAlg.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := NewServer(serverConn, serverSigningKey, "test")
+	server.SetConfig(serverConfig)
+	server.maxVersion = serverVersion
+	t.Cleanup(server.Cleanup)
+	serverErr := make(chan error, 1)
+	go func() {
+		err := server.PerformHandshake()
+		if err != nil {
+			// Unblock the client.
+			serverConn.Close()
+		}
+		serverErr <- err
+	}()
+
+	client := NewClient(clientConn, clientSigningKey, &serverSigningKey.PublicKey, "test")
+	client.SetConfig(clientConfig)
+	client.maxVersion = clientVersion
+	t.Cleanup(client.Cleanup)
+	if err := client.PerformHandshake(); err != nil {
+		<-serverErr
+		return nil, nil, err
+	}
+	if err := <-serverErr; err != nil {
+		return nil, nil, err
+	}
+	return client, server, nil
+}
+
+// exchange sends n messages in both directions and checks that they arrive intact.
+func exchange(t *testing.T, client *Client, server *Server, n int, pause time.Duration) {
+	errc := make(chan error, 1)
+	go func() {
+		for i := 0; i < n; i++ {
+			packet, err := server.ReadAndDecrypt(PacketTypeApplicationData)
+			if err != nil {
+				errc <- err
+				return
+			}
+			if err := server.WriteEncrypted(packet.fragment, packet.context, PacketTypeApplicationData); err != nil {
+				errc <- err
+				return
+			}
+		}
+		errc <- nil
+	}()
+	for i := 0; i < n; i++ {
+		msg := []byte(fmt.Sprintf("message %d", i))
+		if err := client.WriteEncrypted(msg, uint64(i), PacketTypeApplicationData); err != nil {
+			t.Fatalf("write %d: %v", i, err)
+		}
+		packet, err := client.ReadAndDecrypt(PacketTypeApplicationData)
+		if err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+		if !bytes.Equal(packet.fragment, msg) || packet.context != uint64(i) {
+			t.Fatalf("message %d mismatch: %q", i, packet.fragment)
+		}
+		time.Sleep(pause)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_HybridHandshakeLevels(t *testing.T) {
+	for _, level := range kemLevels {
+		client, server, err := handshakePair(t, Config{KemLevel: level}, Config{KemLevel: level})
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		if client.KemLevel() != level || server.KemLevel() != level {
+			t.Fatalf("level %d: negotiated %d/%d", level, client.KemLevel(), server.KemLevel())
+		}
+		exchange(t, client, server, 3, 0)
+	}
+}
+
+func Test_KemLevelNegotiation(t *testing.T) {
+	tests := []struct {
+		client, server, want uint
+	}{
+		{512, 512, 512},
+		{512, 768, 768},
+		{512, 1024, 1024},
+		{1024, 512, 1024},
+		{0, 0, DefaultConfig.KemLevel},
+	}
+	for _, test := range tests {
+		client, server, err := handshakePair(t, Config{KemLevel: test.client}, Config{KemLevel: test.server})
+		if err != nil {
+			t.Fatalf("%d/%d: %v", test.client, test.server, err)
+		}
+		if client.KemLevel() != test.want || server.KemLevel() != test.want {
+			t.Fatalf("%d/%d: negotiated %d/%d, want %d", test.client, test.server, client.KemLevel(), server.KemLevel(), test.want)
+		}
+	}
+}
+
+func Test_KemLevelMismatch(t *testing.T) {
+	shares := []kemKeyShare{{Level: 512}, {Level: 768}}
+	if _, err := (Config{KemLevel: 1024}).selectKeyShare(shares); err != errNoCommonKemLevel {
+		t.Fatalf("got %v, want %v", err, errNoCommonKemLevel)
+	}
+	if _, err := (Config{KemLevel: 1000}).offeredKemLevels(); !errors.Is(err, errInvalidKemLevel) {
+		t.Fatalf("got %v, want %v", err, errInvalidKemLevel)
+	}
+}
+
+func Test_LegacyHandshakeInterop(t *testing.T) {
+	past := Config{LegacyHandshakeCutover: time.Now().Add(-time.Minute), RekeyRecords: 2}
+	future := Config{LegacyHandshakeCutover: time.Now().Add(time.Hour), RekeyRecords: 2}
+	tests := []struct {
+		name                         string
+		clientConfig, serverConfig   Config
+		clientVersion, serverVersion uint
+		want                         uint
+	}{
+		{"v1 client, v2 server", Config{}, future, legacyHandshakeVersion, handshakeVersion, legacyHandshakeVersion},
+		{"v2 client, v1 server", future, Config{}, handshakeVersion, legacyHandshakeVersion, legacyHandshakeVersion},
+		{"v2 client, v2 server", future, future, handshakeVersion, handshakeVersion, handshakeVersion},
+		{"v2 peers after the cutover", past, past, handshakeVersion, handshakeVersion, handshakeVersion},
+		{"v1 client after the cutover", Config{}, past, legacyHandshakeVersion, handshakeVersion, 0},
+		{"v1 server after the cutover", past, Config{}, handshakeVersion, legacyHandshakeVersion, 0},
+	}
+	for _, test := range tests {
+		client, server, err := handshakePairVersions(t, test.clientConfig, test.serverConfig, test.clientVersion, test.serverVersion)
+		if test.want == 0 {
+			if err == nil {
+				t.Fatalf("%s: handshake succeeded", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if client.Version() != test.want || server.version != test.want {
+			t.Fatalf("%s: negotiated %d/%d, want %d", test.name, client.Version(), server.version, test.want)
+		}
+		// Version 1 peers do not understand key updates, so traffic keys are only
+		// updated in version 2 sessions.
+		clientKey := client.secret.ClientApplicationKey
+		exchange(t, client, server, 4, 0)
+		if updated := !bytes.Equal(client.secret.ClientApplicationKey, clientKey); updated != (test.want == handshakeVersion) {
+			t.Fatalf("%s: traffic key updated %v", test.name, updated)
+		}
+	}
+
+	// Nodes released before the hybrid handshake decode the new hello messages,
+	// and the new nodes decode theirs.
+	type legacyClientHello struct {
+		ClientKemPublicKey    []byte
+		ClientHelloRandomData [shaLen]byte
+		Version               uint
+		Rest                  []rlp.RawValue `rlp:"tail"`
+	}
+	type legacyServerHello struct {
+		CipherText            []byte
+		ServerHelloRandomData [shaLen]byte
+		Version               uint
+		Rest                  []rlp.RawValue `rlp:"tail"`
+	}
+	hello := &clientHelloMessage{ClientKemPublicKey: []byte{1}, Version: handshakeVersion, ClientEcdhPublicKey: []byte{2}, KemKeyShares: []kemKeyShare{{Level: 768, PublicKey: []byte{3}}}}
+	blob, _ := rlp.EncodeToBytes(hello)
+	var oldHello legacyClientHello
+	if err := rlp.DecodeBytes(blob, &oldHello); err != nil || !bytes.Equal(oldHello.ClientKemPublicKey, hello.ClientKemPublicKey) || len(oldHello.Rest) != 2 {
+		t.Fatalf("version 2 client hello not decoded by version 1 nodes: %v", err)
+	}
+	blob, _ = rlp.EncodeToBytes(&legacyServerHello{CipherText: []byte{1}, Version: legacyHandshakeVersion})
+	var newServerHello serverHelloMessage
+	if err := rlp.DecodeBytes(blob, &newServerHello); err != nil || newServerHello.Version != legacyHandshakeVersion {
+		t.Fatalf("version 1 server hello not decoded: %v", err)
+	}
+
+	// Version 1 hellos are rejected after the cutover.
+	server := NewServer(nil, nil, "test")
+	server.SetConfig(past)
+	server.clientHelloMessage = &clientHelloMessage{Version: legacyHandshakeVersion, ClientKemPublicKey: []byte{1}}
+	if err := server.handleClientHello(); err != errHandshakeVersion {
+		t.Fatalf("got %v, want %v", err, errHandshakeVersion)
+	}
+}
+
+func Test_RekeyByRecordCount(t *testing.T) {
+	config := Config{RekeyRecords: 4}
+	client, server, err := handshakePair(t, config, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKey := client.secret.ClientApplicationKey
+	serverKey := server.secret.ServerApplicationKey
+
+	exchange(t, client, server, 10, 0)
+
+	// 10 records with a limit of 4 records per key require two updates.
+	if bytes.Equal(client.secret.ClientApplicationKey, clientKey) || bytes.Equal(server.secret.ServerApplicationKey, serverKey) {
+		t.Fatal("traffic keys not updated")
+	}
+	if !bytes.Equal(client.secret.ClientApplicationKey, server.secret.ClientApplicationKey) ||
+		!bytes.Equal(client.secret.ServerApplicationKey, server.secret.ServerApplicationKey) {
+		t.Fatal("traffic keys out of sync")
+	}
+	if client.clientSeqNumApplication != 3 || server.serverSeqNumApplication != 3 {
+		t.Fatalf("wrong sequence numbers %d/%d", client.clientSeqNumApplication, server.serverSeqNumApplication)
+	}
+}
+
+func Test_RekeyByInterval(t *testing.T) {
+	config := Config{RekeyInterval: 20 * time.Millisecond}
+	client, server, err := handshakePair(t, config, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKey := client.secret.ClientApplicationKey
+
+	exchange(t, client, server, 2, 0)
+	if !bytes.Equal(client.secret.ClientApplicationKey, clientKey) {
+		t.Fatal("traffic key updated too early")
+	}
+	exchange(t, client, server, 3, 30*time.Millisecond)
+	if bytes.Equal(client.secret.ClientApplicationKey, clientKey) {
+		t.Fatal("traffic key not updated")
+	}
+	if !bytes.Equal(client.secret.ClientApplicationKey, server.secret.ClientApplicationKey) {
+		t.Fatal("traffic keys out of sync")
+	}
+}
@@ -48,6 +48,12 @@ type Conn struct {
 // NewConn wraps the given network connection. If dialDest is non-nil, the connection
 // behaves as the initiator during the handshake.
 func NewConn(conn net.Conn, dialDest *signaturealgorithm.PublicKey, context string) *Conn {
+	return NewConnWithConfig(conn, dialDest, context, DefaultConfig)
+}
+
+// NewConnWithConfig is like NewConn, but uses the given key exchange and rekeying
+// settings.
+func NewConnWithConfig(conn net.Conn, dialDest *signaturealgorithm.PublicKey, context string, config Config) *Conn {
 	connection := &Conn{
 		dialDest: dialDest,
 		conn:     conn,
@@ -56,8 +62,10 @@ func NewConn(conn net.Conn, dialDest *signaturealgorithm.PublicKey, context stri
 
 	if dialDest == nil {
 		connection.server = NewServer(conn, nil, context)
+		connection.server.SetConfig(config)
 	} else {
 		connection.client = NewClient(conn, nil, dialDest, context)
+		connection.client.SetConfig(config)
 	}
 
 	return connection
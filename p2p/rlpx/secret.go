@@ -20,6 +20,7 @@ const (
 
 	clientApplicationTrafficLabelName = "c ap traffic"
 	serverApplicationTrafficLabelName = "s ap traffic"
+	trafficUpdateLabelName            = "traffic upd"
 )
 
 type SessionSecret struct {
@@ -262,6 +263,57 @@ func (ss *SessionSecret) CreateApplicationSecrets(transcriptHash []byte) error {
 	return nil
 }
 
+// UpdateClientApplicationSecret replaces the client application traffic secret by
+// its successor and derives the new client key, IV and cipher.
+func (ss *SessionSecret) UpdateClientApplicationSecret() error {
+	secret, key, iv, aead, err := nextApplicationSecret(ss.clientApplicationTrafficSecret)
+	if err != nil {
+		return err
+	}
+	ss.clientApplicationTrafficSecret = secret
+	ss.ClientApplicationKey = key
+	ss.ClientApplicationIv = iv
+	ss.ClientApplicationCipher = aead
+	return nil
+}
+
+// UpdateServerApplicationSecret replaces the server application traffic secret by
+// its successor and derives the new server key, IV and cipher.
+func (ss *SessionSecret) UpdateServerApplicationSecret() error {
+	secret, key, iv, aead, err := nextApplicationSecret(ss.serverApplicationTrafficSecret)
+	if err != nil {
+		return err
+	}
+	ss.serverApplicationTrafficSecret = secret
+	ss.ServerApplicationKey = key
+	ss.ServerApplicationIv = iv
+	ss.ServerApplicationCipher = aead
+	return nil
+}
+
+func nextApplicationSecret(trafficSecret []byte) (secret, key, iv []byte, aead cipher.AEAD, err error) {
+	if len(trafficSecret) == 0 {
+		return nil, nil, nil, nil, errors.New("application secrets not established")
+	}
+	if secret, err = HkdfExpandLabel(trafficSecret, trafficUpdateLabelName, nil, shaLength); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if key, err = HkdfExpandLabel(secret, secretKeyLabelName, nil, symmetricKeySize); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if iv, err = HkdfExpandLabel(secret, secretIvLabelName, nil, ivSize); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if aead, err = cipher.NewGCM(block); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return secret, key, iv, aead, nil
+}
+
 func HkdfExpandLabel(secret []byte, label string, hashVal []byte, outputLength int) ([]byte, error) {
 	hkdfLabel := hkdfEncodeLabel(label, hashVal, outputLength)
 
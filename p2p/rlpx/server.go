@@ -3,22 +3,25 @@ package rlpx
 import (
 	"bytes"
 	cipher2 "crypto/cipher"
+	"crypto/ecdh"
 	"crypto/rand"
 	"errors"
 	"github.com/QuantumCoinProject/qc/crypto"
 	"github.com/QuantumCoinProject/qc/crypto/cryptobase"
-	"github.com/QuantumCoinProject/qc/crypto/keyestablishmentalgorithm"
 	"github.com/QuantumCoinProject/qc/crypto/oqs"
 	"github.com/QuantumCoinProject/qc/crypto/signaturealgorithm"
 	"github.com/QuantumCoinProject/qc/rlp"
 	"io"
 	"sync"
+	"time"
 )
 
 type serverHelloMessage struct {
 	CipherText            []byte //kemCipherTextLength
 	ServerHelloRandomData [shaLen]byte
 	Version               uint
+	ServerEcdhPublicKey   []byte         `rlp:"optional"` //X25519 public key, not sent in version 1
+	KemLevel              uint           `rlp:"optional"` //selected ML-KEM level, not sent in version 1
 	Rest                  []rlp.RawValue `rlp:"tail"`
 }
 
@@ -29,8 +32,11 @@ type serverVerifyMessage struct {
 }
 
 type Server struct {
-	ephemeralKemPrivateKey  *keyestablishmentalgorithm.PrivateKey
+	ephemeralEcdhKey        *ecdh.PrivateKey
 	kem                     *oqs.KeyEncapsulation
+	kemLevel                uint
+	version                 uint //handshake version selected from the client hello
+	maxVersion              uint //highest handshake version spoken
 	serverSigningPrivateKey *signaturealgorithm.PrivateKey
 	clientSigningPublicKey  *signaturealgorithm.PublicKey
 
@@ -43,7 +49,7 @@ type Server struct {
 	clientVerifyMessage *clientVerifyMessage
 
 	kemCipherText   []byte //kemCipherTextLength
-	kemSharedSecret []byte //kemSecretLength
+	kemSharedSecret []byte //hybrid shared secret, or the Kyber512 secret in version 1
 
 	serverSeqNumHandshake uint
 	clientSeqNumHandshake uint
@@ -64,6 +70,9 @@ type Server struct {
 	handshakeDone bool
 	mutex         sync.Mutex
 
+	config        Config
+	serverKeyTime time.Time //when the server application key was established
+
 	context string
 }
 
@@ -72,6 +81,8 @@ func NewServer(conn io.ReadWriter, serverSigningPrivateKey *signaturealgorithm.P
 		conn:                    conn,
 		serverSigningPrivateKey: serverSigningPrivateKey,
 		context:                 context,
+		config:                  DefaultConfig,
+		maxVersion:              handshakeVersion,
 	}
 
 	server.serializer = NewRlpxSerializer()
@@ -89,6 +100,17 @@ func (s *Server) SetClient(client *Client) {
 	s.client = client
 }
 
+// SetConfig sets the key exchange and rekeying settings. It must be called before
+// the handshake.
+func (s *Server) SetConfig(config Config) {
+	s.config = config
+}
+
+// KemLevel returns the ML-KEM level negotiated in the handshake.
+func (s *Server) KemLevel() uint {
+	return s.kemLevel
+}
+
 func (s *Server) SetServerSigningPrivateKey(serverSigningPrivateKey *signaturealgorithm.PrivateKey) {
 	s.serverSigningPrivateKey = serverSigningPrivateKey
 }
@@ -102,18 +124,9 @@ func (s *Server) PerformHandshake() error {
 		return errors.New("Handshake already done")
 	}
 
-	//Initialize KEM
-	kem := oqs.KeyEncapsulation{}
-
-	err := kem.Init(oqs.KemName, nil)
-	if err != nil {
-		return err
-	}
-	s.kem = &kem
-
 	//Receive client hello message
 	clientHelloMessage := new(clientHelloMessage)
-	_, err = s.serializer.Deserialize(clientHelloMessage, s.conn)
+	_, err := s.serializer.Deserialize(clientHelloMessage, s.conn)
 	if err != nil {
 		return err
 	}
@@ -156,6 +169,9 @@ func (s *Server) PerformHandshake() error {
 
 	//Create the secrets
 	secret, err := NewSessionSecret(transcriptHash, s.kemSharedSecret[:])
+	if err != nil {
+		return err
+	}
 	s.secret = *secret
 
 	//Sign the transcript hash
@@ -195,6 +211,7 @@ func (s *Server) PerformHandshake() error {
 	}
 
 	s.handshakeDone = true
+	s.serverKeyTime = time.Now()
 
 	return nil
 }
@@ -212,7 +229,11 @@ func (s *Server) Read() error {
 
 func (s *Server) makeServerHello() error {
 	serverHelloMessage := new(serverHelloMessage)
-	serverHelloMessage.Version = 1
+	serverHelloMessage.Version = s.version
+	if s.version >= handshakeVersion {
+		serverHelloMessage.ServerEcdhPublicKey = s.ephemeralEcdhKey.PublicKey().Bytes()
+		serverHelloMessage.KemLevel = s.kemLevel
+	}
 
 	// Generate ServerRandomData
 	randomData := make([]byte, shaLength)
@@ -229,7 +250,63 @@ func (s *Server) makeServerHello() error {
 	return nil
 }
 
+// handleClientHello selects the handshake version from the client hello. Clients
+// of version 2 or later get the hybrid handshake; version 1 clients get the
+// Kyber512 handshake until the configured cutover.
 func (s *Server) handleClientHello() error {
+	if s.clientHelloMessage.Version < handshakeVersion || s.maxVersion < handshakeVersion {
+		if !s.config.legacyHandshakeAccepted() {
+			return errHandshakeVersion
+		}
+		return s.handleLegacyClientHello()
+	}
+
+	//Select the ML-KEM level and encapsulate to the client's key share
+	share, err := s.config.selectKeyShare(s.clientHelloMessage.KemKeyShares)
+	if err != nil {
+		return err
+	}
+	s.kem, err = newKem(share.Level)
+	if err != nil {
+		return err
+	}
+	s.kemLevel = share.Level
+
+	ciphertext, kemSecret, err := s.kem.EncapsulateSecret(share.PublicKey)
+	if err != nil {
+		return err
+	}
+
+	s.kemCipherText = make([]byte, s.kem.AlgDetails.LengthCiphertext)
+	copy(s.kemCipherText[:], ciphertext[:])
+
+	//Generate an ephemeral X25519 key
+	s.ephemeralEcdhKey, err = generateEcdhKey()
+	if err != nil {
+		return err
+	}
+	ecdhSecret, err := ecdhSharedSecret(s.ephemeralEcdhKey, s.clientHelloMessage.ClientEcdhPublicKey)
+	if err != nil {
+		return err
+	}
+
+	s.kemSharedSecret = hybridSecret(ecdhSecret, kemSecret)
+	s.version = handshakeVersion
+
+	return nil
+}
+
+// handleLegacyClientHello encapsulates a secret to the Kyber512 key of a version
+// 1 client hello.
+func (s *Server) handleLegacyClientHello() error {
+	if len(s.clientHelloMessage.ClientKemPublicKey) == 0 {
+		return errHandshakeVersion
+	}
+	kem, err := newLegacyKem()
+	if err != nil {
+		return err
+	}
+	s.kem = kem
 
 	ciphertext, sharedSecret, err := s.kem.EncapsulateSecret(s.clientHelloMessage.ClientKemPublicKey[:])
 	if err != nil {
@@ -239,8 +316,8 @@ func (s *Server) handleClientHello() error {
 	s.kemCipherText = make([]byte, s.kem.AlgDetails.LengthCiphertext)
 	copy(s.kemCipherText[:], ciphertext[:])
 
-	s.kemSharedSecret = make([]byte, s.kem.AlgDetails.LengthSharedSecret)
-	copy(s.kemSharedSecret[:], sharedSecret[:])
+	s.kemSharedSecret = sharedSecret
+	s.version = legacyHandshakeVersion
 
 	return nil
 }
@@ -297,6 +374,14 @@ func (s *Server) createApplicationSecrets() error {
 }
 
 func (s *Server) WriteEncrypted(data []byte, context uint64, packetType PacketType) error {
+	if packetType == PacketTypeApplicationData {
+		if s.handshakeDone && s.version >= handshakeVersion && s.config.rekeyDue(s.serverSeqNumApplication, s.serverKeyTime) {
+			if err := s.updateWriteKey(); err != nil {
+				return err
+			}
+		}
+	}
+
 	additionalData := make([]byte, shaLength)
 	_, err := rand.Read(additionalData)
 	if err != nil {
@@ -355,7 +440,36 @@ func (s *Server) WriteEncrypted(data []byte, context uint64, packetType PacketTy
 	return nil
 }
 
+// updateWriteKey tells the client that the server switches to its next
+// application traffic key and then switches.
+func (s *Server) updateWriteKey() error {
+	if err := s.WriteEncrypted(nil, 0, PacketTypeKeyUpdate); err != nil {
+		return err
+	}
+	if err := s.secret.UpdateServerApplicationSecret(); err != nil {
+		return err
+	}
+	s.serverSeqNumApplication = 1
+	s.serverKeyTime = time.Now()
+	return nil
+}
+
+// ReadAndDecrypt reads the next record of the given type. Key updates sent by the
+// client in between application data are applied transparently.
 func (s *Server) ReadAndDecrypt(packetType PacketType) (*DataPacket, error) {
+	for {
+		dataPacket, err := s.readRecord(packetType)
+		if err != nil || dataPacket.packetType != PacketTypeKeyUpdate {
+			return dataPacket, err
+		}
+		if err := s.secret.UpdateClientApplicationSecret(); err != nil {
+			return nil, err
+		}
+		s.clientSeqNumApplication = 1
+	}
+}
+
+func (s *Server) readRecord(packetType PacketType) (*DataPacket, error) {
 
 	if packetType == PacketTypeApplicationData {
 	}
@@ -400,7 +514,7 @@ func (s *Server) ReadAndDecrypt(packetType PacketType) (*DataPacket, error) {
 		return nil, err
 	}
 
-	if dataPacket.packetType != packetType {
+	if dataPacket.packetType != packetType && !(packetType == PacketTypeApplicationData && dataPacket.packetType == PacketTypeKeyUpdate) {
 		return nil, errors.New("packetType mismatch")
 	}
 	dataPacket.context = header.Context
@@ -0,0 +1,175 @@
+package p2p
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/QuantumCoinProject/qc/common/mclock"
+	"github.com/QuantumCoinProject/qc/p2p/enode"
+)
+
+// ScoreEvent is a peer behaviour observed by a protocol handler which affects
+// the reputation of the peer.
+type ScoreEvent int
+
+const (
+	ScoreUsefulConsensusPacket  ScoreEvent = iota // Peer relayed a valid consensus packet
+	ScoreInvalidConsensusPacket                   // Peer sent a malformed or badly signed consensus packet
+	ScoreInvalidBlock                             // Peer propagated a block failing validation
+	ScoreInvalidTransactions                      // Peer sent transactions rejected by the pool
+	ScoreSyncFailure                              // Peer stalled or delivered bad data during sync
+)
+
+// scoreWeights are the score adjustments of the individual events.
+var scoreWeights = [...]float64{
+	ScoreUsefulConsensusPacket:  0.1,
+	ScoreInvalidConsensusPacket: -25,
+	ScoreInvalidBlock:           -50,
+	ScoreInvalidTransactions:    -5,
+	ScoreSyncFailure:            -40,
+}
+
+func (e ScoreEvent) String() string {
+	switch e {
+	case ScoreUsefulConsensusPacket:
+		return "useful consensus packet"
+	case ScoreInvalidConsensusPacket:
+		return "invalid consensus packet"
+	case ScoreInvalidBlock:
+		return "invalid block"
+	case ScoreInvalidTransactions:
+		return "invalid transactions"
+	case ScoreSyncFailure:
+		return "sync failure"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	maxPeerScore   = 20.0             // Upper bound of the reputation a peer can build up
+	banPeerScore   = -100.0           // Score at which a peer is disconnected and banned
+	scoreHalfLife  = 10 * time.Minute // Time it takes for a score to decay to half its value
+	peerBanTimeout = time.Hour        // Time a misbehaving peer is refused for
+)
+
+// peerScore is the decaying reputation of a single peer.
+type peerScore struct {
+	value   float64
+	updated mclock.AbsTime
+}
+
+// decayed returns the score value at the given time.
+func (s *peerScore) decayed(now mclock.AbsTime) float64 {
+	elapsed := time.Duration(now - s.updated)
+	if elapsed <= 0 {
+		return s.value
+	}
+	return s.value * math.Pow(0.5, float64(elapsed)/float64(scoreHalfLife))
+}
+
+// peerScores tracks the reputation of the peers seen by the server. Scores
+// decay towards zero over time, so a peer's past is gradually forgiven.
+type peerScores struct {
+	clock  mclock.Clock
+	lock   sync.Mutex
+	scores map[enode.ID]*peerScore
+}
+
+func newPeerScores(clock mclock.Clock) *peerScores {
+	return &peerScores{clock: clock, scores: make(map[enode.ID]*peerScore)}
+}
+
+// add applies a score adjustment to a peer and returns its new score.
+func (ps *peerScores) add(id enode.ID, delta float64) float64 {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	now := ps.clock.Now()
+	s := ps.scores[id]
+	if s == nil {
+		s = new(peerScore)
+		ps.scores[id] = s
+	}
+	s.value = math.Min(s.decayed(now)+delta, maxPeerScore)
+	s.updated = now
+	return s.value
+}
+
+// get returns the current score of a peer.
+func (ps *peerScores) get(id enode.ID) float64 {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if s := ps.scores[id]; s != nil {
+		return s.decayed(ps.clock.Now())
+	}
+	return 0
+}
+
+// remove forgets the score of a peer.
+func (ps *peerScores) remove(id enode.ID) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	delete(ps.scores, id)
+}
+
+// ReportPeer records a behaviour of a peer. Peers whose score drops to the ban
+// threshold are disconnected and refused for a while. Trusted peers are scored
+// but never banned.
+func (srv *Server) ReportPeer(id enode.ID, event ScoreEvent) {
+	if srv.scores == nil {
+		return
+	}
+	delta := scoreWeights[event]
+	if delta < 0 {
+		peerPenaltyMeter.Mark(1)
+	}
+	score := srv.scores.add(id, delta)
+	if delta < 0 {
+		srv.log.Debug("Penalized peer", "id", id, "event", event, "score", score)
+	}
+	if score > banPeerScore {
+		return
+	}
+	var peer *Peer
+	srv.doPeerOp(func(peers map[enode.ID]*Peer) {
+		peer = peers[id]
+	})
+	if peer != nil && peer.rw.is(trustedConn) {
+		return
+	}
+	srv.banPeer(id)
+	if peer != nil {
+		peer.Disconnect(DiscUselessPeer)
+	}
+}
+
+// PeerScore returns the current reputation of a peer.
+func (srv *Server) PeerScore(id enode.ID) float64 {
+	if srv.scores == nil {
+		return 0
+	}
+	return srv.scores.get(id)
+}
+
+// banPeer refuses connections with a node for the ban timeout. The ban is
+// persisted in the node database so it survives restarts.
+func (srv *Server) banPeer(id enode.ID) {
+	srv.log.Debug("Banning peer", "id", id, "duration", peerBanTimeout)
+	peerBanMeter.Mark(1)
+	srv.scores.remove(id)
+	if err := srv.nodedb.UpdateBannedUntil(id, time.Now().Add(peerBanTimeout)); err != nil {
+		srv.log.Warn("Failed to store peer ban", "id", id, "err", err)
+	}
+}
+
+// isBanned reports whether connections with a node are currently refused.
+func (srv *Server) isBanned(id enode.ID) bool {
+	if srv.nodedb == nil {
+		return false
+	}
+	return time.Now().Before(srv.nodedb.BannedUntil(id))
+}
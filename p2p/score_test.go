@@ -0,0 +1,88 @@
+package p2p
+
+import (
+	"math"
+	"net"
+	"testing"
+
+	"github.com/QuantumCoinProject/qc/common/mclock"
+	"github.com/QuantumCoinProject/qc/crypto/signaturealgorithm"
+	"github.com/QuantumCoinProject/qc/internal/testlog"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/p2p/enode"
+	"github.com/QuantumCoinProject/qc/p2p/pipes"
+)
+
+func TestPeerScoreDecay(t *testing.T) {
+	var (
+		clock  = new(mclock.Simulated)
+		scores = newPeerScores(clock)
+		id     = enode.ID{1}
+	)
+	if score := scores.add(id, scoreWeights[ScoreInvalidBlock]); score != -50 {
+		t.Fatalf("wrong initial score: have %v, want %v", score, -50)
+	}
+	clock.Run(scoreHalfLife)
+	if score := scores.get(id); math.Abs(score+25) > 1e-9 {
+		t.Fatalf("wrong score after one half-life: have %v, want %v", score, -25)
+	}
+	clock.Run(2 * scoreHalfLife)
+	if score := scores.add(id, scoreWeights[ScoreInvalidConsensusPacket]); math.Abs(score+31.25) > 1e-9 {
+		t.Fatalf("wrong score after penalty: have %v, want %v", score, -31.25)
+	}
+	// Good behaviour only builds up a limited reputation
+	for i := 0; i < 10000; i++ {
+		scores.add(id, scoreWeights[ScoreUsefulConsensusPacket])
+	}
+	if score := scores.get(id); score != maxPeerScore {
+		t.Fatalf("score not capped: have %v, want %v", score, maxPeerScore)
+	}
+}
+
+func TestServerPeerBan(t *testing.T) {
+	var (
+		srvkey  = newkey()
+		peerkey = newkey()
+		peer    = enode.NewV4(&peerkey.PublicKey, nil, 0)
+	)
+	srv := &Server{
+		Config: Config{
+			PrivateKey:  srvkey,
+			MaxPeers:    10,
+			NoDial:      true,
+			NoDiscovery: true,
+			Protocols:   []Protocol{discard},
+			Logger:      testlog.Logger(t, log.LvlTrace),
+			clock:       new(mclock.Simulated),
+		},
+		newTransport: func(fd net.Conn, dialDest *signaturealgorithm.PublicKey, context string) transport {
+			return newTestTransport(&peerkey.PublicKey, fd, dialDest)
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("couldn't start server: %v", err)
+	}
+	defer srv.Stop()
+
+	srv.ReportPeer(peer.ID(), ScoreInvalidBlock)
+	if srv.isBanned(peer.ID()) {
+		t.Fatal("peer banned after a single penalty")
+	}
+	srv.ReportPeer(peer.ID(), ScoreInvalidBlock)
+	if !srv.isBanned(peer.ID()) {
+		t.Fatal("peer not banned after exhausting its score")
+	}
+	if score := srv.PeerScore(peer.ID()); score != 0 {
+		t.Errorf("score not reset after ban: %v", score)
+	}
+
+	// The banned node is neither dialed nor accepted
+	if err := srv.dialsched.checkDial(peer); err != errBanned {
+		t.Errorf("wrong dial check error: have %v, want %v", err, errBanned)
+	}
+	conn, _, _ := pipes.NetPipe()
+	defer conn.Close()
+	if err := srv.SetupConn(conn, inboundConn, nil); err != DiscUselessPeer {
+		t.Errorf("wrong setup error: have %v, want %v", err, DiscUselessPeer)
+	}
+}
@@ -36,10 +36,12 @@ import (
 	"github.com/QuantumCoinProject/qc/crypto"
 	"github.com/QuantumCoinProject/qc/event"
 	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/p2p/discover"
 	"github.com/QuantumCoinProject/qc/p2p/enode"
 	"github.com/QuantumCoinProject/qc/p2p/enr"
 	"github.com/QuantumCoinProject/qc/p2p/nat"
 	"github.com/QuantumCoinProject/qc/p2p/netutil"
+	"github.com/QuantumCoinProject/qc/p2p/rlpx"
 	"math/rand"
 )
 
@@ -100,10 +102,14 @@ type Config struct {
 	// Disabling is useful for protocol debugging (manual topology).
 	NoDiscovery bool
 
-	// DiscoveryV5 specifies whether the new topic-discovery based V5 discovery
-	// protocol should be started or not.
+	// DiscoveryV5 specifies whether topic discovery should be started or not. Nodes
+	// are advertised and looked up under the names of the running protocols.
 	DiscoveryV5 bool `toml:",omitempty"`
 
+	// RLPx contains the key exchange and rekeying settings of peer connections.
+	// Unset fields use the defaults of package rlpx.
+	RLPx rlpx.Config `toml:",omitempty"`
+
 	// Name sets the node name of this server.
 	// Use common.MakeName to create a name that follows existing conventions.
 	Name string `toml:"-"`
@@ -125,6 +131,12 @@ type Config struct {
 	// allowed to connect, even above the peer limit.
 	TrustedNodes []*enode.Node
 
+	// TrustedOnly restricts connectivity to the trusted nodes. Connections with
+	// other nodes are dropped as soon as the encryption handshake authenticated
+	// them, and no nodes are dialed besides the static ones. Validators use it to
+	// peer exclusively with their sentry nodes.
+	TrustedOnly bool `toml:",omitempty"`
+
 	// Connectivity can be restricted to certain IP networks.
 	// If this option is set to a non-nil value, only hosts which match one of the
 	// IP networks contained in the list are considered.
@@ -166,6 +178,15 @@ type Config struct {
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger log.Logger `toml:",omitempty"`
 
+	// MaxEgressRate limits the outbound bandwidth of all peers together, in
+	// bytes per second. Messages marked as priority by their protocol, such as
+	// consensus messages, are sent without waiting. Zero means unlimited.
+	MaxEgressRate int `toml:",omitempty"`
+
+	// MaxPeerEgressRate limits the outbound bandwidth to every single peer, in
+	// bytes per second. Zero means unlimited.
+	MaxPeerEgressRate int `toml:",omitempty"`
+
 	clock mclock.Clock
 }
 
@@ -191,8 +212,13 @@ type Server struct {
 
 	nodedb    *enode.DB
 	localnode *enode.LocalNode
+	ntab      *discover.UDP
 	discmix   *enode.FairMix
 	dialsched *dialScheduler
+	scores    *peerScores
+
+	traffic      *trafficCounter // Traffic of all peers since the server started
+	egressBucket *tokenBucket    // Server wide bandwidth limit, nil if unlimited
 
 	// Channels into the run loop.
 	quit                    chan struct{}
@@ -413,6 +439,9 @@ func (srv *Server) SetRequestPeersFn(fun RequestPeers) {
 }
 
 func (srv *Server) HandlePeerList(peerList []string) error {
+	if srv.TrustedOnly {
+		return nil
+	}
 	//Shuffle so that peers are not connected in the same order
 	for i := len(peerList) - 1; i > 0; i-- { //Fisher Yates shuffle.
 		minVal := 0
@@ -481,6 +510,11 @@ func (srv *Server) Start() (err error) {
 	if srv.clock == nil {
 		srv.clock = mclock.System{}
 	}
+	srv.scores = newPeerScores(srv.clock)
+	srv.traffic = newTrafficCounter(nil)
+	if srv.MaxEgressRate > 0 {
+		srv.egressBucket = newTokenBucket(srv.clock, srv.MaxEgressRate)
+	}
 	if srv.NoDial && srv.ListenAddr == "" {
 		srv.log.Warn("P2P server will be useless, neither dialing nor listening")
 	}
@@ -492,7 +526,7 @@ func (srv *Server) Start() (err error) {
 		return errors.New("Server.PrivateKey must be set to a non-nil key")
 	}
 	if srv.newTransport == nil {
-		srv.newTransport = newRLPX
+		srv.newTransport = newRLPXWithConfig(srv.RLPx)
 	}
 	if srv.listenFunc == nil {
 		srv.listenFunc = net.Listen
@@ -586,6 +620,65 @@ func (srv *Server) setupDiscovery() error {
 		}
 	}
 
+	// Don't listen on UDP endpoint if discovery is disabled.
+	if srv.NoDiscovery && !srv.DiscoveryV5 {
+		return nil
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", srv.ListenAddr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return err
+	}
+	realaddr := conn.LocalAddr().(*net.UDPAddr)
+	srv.log.Debug("UDP listener up", "addr", realaddr)
+	if srv.NAT != nil {
+		if !realaddr.IP.IsLoopback() {
+			srv.loopWG.Add(1)
+			go func() {
+				nat.Map(srv.NAT, srv.quit, "udp", realaddr.Port, realaddr.Port, "ethereum discovery")
+				srv.loopWG.Done()
+			}()
+		}
+	}
+	srv.localnode.SetFallbackUDP(realaddr.Port)
+
+	bootnodes := srv.BootstrapNodes
+	if srv.DiscoveryV5 {
+		bootnodes = append(append([]*enode.Node{}, bootnodes...), srv.BootstrapNodesV5...)
+	}
+	cfg := discover.Config{
+		PrivateKey:  srv.PrivateKey,
+		NetRestrict: srv.NetRestrict,
+		Bootnodes:   bootnodes,
+		Log:         srv.log,
+	}
+	ntab, err := discover.ListenUDP(conn, srv.localnode, cfg)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	srv.ntab = ntab
+
+	// Only nodes with a TCP endpoint can be dialed.
+	dialable := func(n *enode.Node) bool { return n.TCP() != 0 }
+	if !srv.NoDiscovery {
+		srv.discmix.AddSource(enode.Filter(ntab.RandomNodes(), dialable), "discover")
+	}
+	if srv.DiscoveryV5 {
+		topics := make(map[string]bool)
+		for _, proto := range srv.Protocols {
+			if topics[proto.Name] {
+				continue
+			}
+			topics[proto.Name] = true
+			ntab.RegisterTopic(proto.Name)
+			srv.discmix.AddSource(enode.Filter(ntab.TopicNodes(proto.Name), dialable), "discover-topic")
+		}
+	}
 	return nil
 }
 
@@ -598,6 +691,7 @@ func (srv *Server) setupDialScheduler() {
 		netRestrict:    srv.NetRestrict,
 		dialer:         srv.Dialer,
 		clock:          srv.clock,
+		banned:         srv.isBanned,
 	}
 	if config.dialer == nil {
 		config.dialer = tcpDialer{&net.Dialer{Timeout: defaultDialTimeout}}
@@ -678,10 +772,19 @@ func (srv *Server) setupListening() error {
 
 	srv.loopWG.Add(1)
 	go srv.listenLoop()
-	go srv.peerLoop()
+	if !srv.TrustedOnly {
+		go srv.peerLoop()
+	}
 	return nil
 }
 
+// closeDiscovery stops the discovery listener, if any.
+func (srv *Server) closeDiscovery() {
+	if srv.ntab != nil {
+		srv.ntab.Close()
+	}
+}
+
 // doPeerOp runs fn on the main loop.
 func (srv *Server) doPeerOp(fn peerOpFunc) {
 	select {
@@ -698,6 +801,7 @@ func (srv *Server) run() {
 	defer srv.loopWG.Done()
 	defer srv.nodedb.Close()
 	defer srv.discmix.Close()
+	defer srv.closeDiscovery()
 	defer srv.dialsched.stop()
 
 	var (
@@ -710,7 +814,9 @@ func (srv *Server) run() {
 	for _, n := range srv.TrustedNodes {
 		trusted[n.ID()] = true
 	}
-	go srv.connectNodes()
+	if !srv.TrustedOnly {
+		go srv.connectNodes()
+	}
 
 running:
 	for {
@@ -798,6 +904,10 @@ running:
 
 func (srv *Server) postHandshakeChecks(peers map[enode.ID]*Peer, inboundCount int, c *conn) error {
 	switch {
+	case srv.TrustedOnly && !c.is(trustedConn):
+		return DiscUnexpectedIdentity
+	case !c.is(trustedConn) && srv.isBanned(c.node.ID()):
+		return DiscUselessPeer
 	case !c.is(trustedConn) && len(peers) >= srv.MaxPeers:
 		return DiscTooManyPeers
 	case !c.is(trustedConn) && c.is(inboundConn) && inboundCount >= srv.maxInboundConns():
@@ -1107,6 +1217,12 @@ func (srv *Server) checkpoint(c *conn, stage chan<- *conn) error {
 
 func (srv *Server) launchPeer(c *conn) *Peer {
 	p := newPeer(srv.log, c, srv.Protocols)
+	p.traffic = newTrafficCounter(srv.traffic)
+	var peerBucket *tokenBucket
+	if srv.MaxPeerEgressRate > 0 {
+		peerBucket = newTokenBucket(srv.clock, srv.MaxPeerEgressRate)
+	}
+	p.limiter = newEgressLimiter(srv.clock, srv.egressBucket, peerBucket)
 	if srv.EnableMsgEvents {
 		// If message events are enabled, pass the peerFeed
 		// to the peer.
@@ -1160,7 +1276,8 @@ type NodeInfo struct {
 	ENR   string `json:"enr"`   // Ethereum Node Record
 	IP    string `json:"ip"`    // IP address of the node
 	Ports struct {
-		Listener int `json:"listener"` // TCP listening port for RLPx
+		Discovery int `json:"discovery"` // UDP listening port for discovery protocol
+		Listener  int `json:"listener"`  // TCP listening port for RLPx
 	} `json:"ports"`
 	ListenAddr string                 `json:"listenAddr"`
 	Protocols  map[string]interface{} `json:"protocols"`
@@ -1178,6 +1295,7 @@ func (srv *Server) NodeInfo() *NodeInfo {
 		ListenAddr: srv.ListenAddr,
 		Protocols:  make(map[string]interface{}),
 	}
+	info.Ports.Discovery = node.UDP()
 	info.Ports.Listener = node.TCP()
 	info.ENR = node.String()
 
@@ -1200,7 +1318,9 @@ func (srv *Server) PeersInfo() []*PeerInfo {
 	infos := make([]*PeerInfo, 0, srv.PeerCount())
 	for _, peer := range srv.Peers() {
 		if peer != nil {
-			infos = append(infos, peer.Info())
+			info := peer.Info()
+			info.Score = srv.PeerScore(peer.ID())
+			infos = append(infos, info)
 		}
 	}
 	// Sort the result array alphabetically by node identifier
@@ -32,6 +32,7 @@ import (
 	"github.com/QuantumCoinProject/qc/internal/testlog"
 	"github.com/QuantumCoinProject/qc/log"
 	"github.com/QuantumCoinProject/qc/p2p/enode"
+	"github.com/QuantumCoinProject/qc/p2p/pipes"
 )
 
 type testTransport struct {
@@ -132,6 +133,39 @@ func TestServerListen(t *testing.T) {
 	}
 }
 
+func TestServerDiscovery(t *testing.T) {
+	start := func(bootnodes []*enode.Node) *Server {
+		srv := &Server{Config: Config{
+			Name:           "test",
+			MaxPeers:       10,
+			ListenAddr:     "127.0.0.1:0",
+			NoDial:         true,
+			BootstrapNodes: bootnodes,
+			PrivateKey:     newkey(),
+			Logger:         testlog.Logger(t, log.LvlTrace),
+		}}
+		if err := srv.Start(); err != nil {
+			t.Fatalf("Could not start server: %v", err)
+		}
+		return srv
+	}
+	srv1 := start(nil)
+	defer srv1.Stop()
+	srv2 := start([]*enode.Node{srv1.Self()})
+	defer srv2.Stop()
+
+	if srv1.NodeInfo().Ports.Discovery == 0 {
+		t.Fatalf("discovery port not set")
+	}
+	n, err := srv2.ntab.RequestENR(srv1.Self())
+	if err != nil {
+		t.Fatalf("ENR request failed: %v", err)
+	}
+	if n.ID() != srv1.Self().ID() || n.TCP() != srv1.Self().TCP() {
+		t.Fatalf("wrong record %v", n)
+	}
+}
+
 func TestServerPeerLimits(t *testing.T) {
 	srvkey := newkey()
 	clientkey := newkey()
@@ -201,6 +235,73 @@ func TestServerPeerLimits(t *testing.T) {
 	conn.Close()
 }
 
+func TestServerTrustedOnly(t *testing.T) {
+	var (
+		srvkey     = newkey()
+		sentrykey  = newkey()
+		sentrynode = enode.NewV4(&sentrykey.PublicKey, nil, 0)
+		otherkey   = newkey()
+		othernode  = enode.NewV4(&otherkey.PublicKey, nil, 0)
+	)
+	newSetupTransport := func(key *signaturealgorithm.PrivateKey) *setupTransport {
+		pubKey, err := cryptobase.SigAlg.SerializePublicKey(&key.PublicKey)
+		if err != nil {
+			t.Fatalf("SerializePublicKey")
+		}
+		return &setupTransport{pubkey: &key.PublicKey, phs: protoHandshake{ID: pubKey}}
+	}
+	var tp *setupTransport
+	srv := &Server{
+		Config: Config{
+			PrivateKey:   srvkey,
+			MaxPeers:     10,
+			NoDial:       true,
+			NoDiscovery:  true,
+			TrustedOnly:  true,
+			TrustedNodes: []*enode.Node{sentrynode},
+			Protocols:    []Protocol{discard},
+			Logger:       testlog.Logger(t, log.LvlTrace),
+		},
+		newTransport: func(fd net.Conn, dialDest *signaturealgorithm.PublicKey, context string) transport { return tp },
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("couldn't start server: %v", err)
+	}
+	defer srv.Stop()
+
+	// Any node other than the trusted one is rejected, dialed or not
+	for _, flags := range []connFlag{inboundConn, dynDialedConn} {
+		tp = newSetupTransport(otherkey)
+		conn, _, _ := pipes.NetPipe()
+		srv.SetupConn(conn, flags, othernode)
+		if tp.closeErr != DiscUnexpectedIdentity {
+			t.Errorf("untrusted %v connection: unexpected close error: %q", flags, tp.closeErr)
+		}
+		if tp.calls != "doEncHandshake,close," {
+			t.Errorf("untrusted %v connection: calls mismatch: %q", flags, tp.calls)
+		}
+		conn.Close()
+	}
+
+	// The trusted node gets past the identity checks and is only dropped for
+	// not running any matching protocol
+	tp = newSetupTransport(sentrykey)
+	conn, _, _ := pipes.NetPipe()
+	srv.SetupConn(conn, inboundConn, nil)
+	if tp.closeErr != DiscUselessPeer {
+		t.Errorf("trusted connection: unexpected close error: %q", tp.closeErr)
+	}
+	conn.Close()
+
+	// Peer lists are not dialed
+	if err := srv.HandlePeerList([]string{othernode.String()}); err != nil {
+		t.Fatal(err)
+	}
+	if srv.dialsched.isDialingOrConnected(othernode) {
+		t.Error("node from peer list dialed")
+	}
+}
+
 func TestServerSetupConn(t *testing.T) {
 	var (
 		clientkey, srvkey = newkey(), newkey()
@@ -0,0 +1,249 @@
+package p2p
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumCoinProject/qc/common/mclock"
+)
+
+// MessageTraffic is the amount of data exchanged with peers for one kind of
+// message. Sizes are message payload sizes, excluding the RLPx framing.
+type MessageTraffic struct {
+	IngressBytes   uint64 `json:"ingressBytes"`
+	IngressPackets uint64 `json:"ingressPackets"`
+	EgressBytes    uint64 `json:"egressBytes"`
+	EgressPackets  uint64 `json:"egressPackets"`
+	Throttled      uint64 `json:"throttled"` // Outbound messages delayed by the bandwidth limits
+}
+
+func (t *MessageTraffic) add(other *MessageTraffic) {
+	t.IngressBytes += other.IngressBytes
+	t.IngressPackets += other.IngressPackets
+	t.EgressBytes += other.EgressBytes
+	t.EgressPackets += other.EgressPackets
+	t.Throttled += other.Throttled
+}
+
+// PeerTraffic is the traffic exchanged with a connected peer.
+type PeerTraffic struct {
+	ID       string                    `json:"id"`
+	Name     string                    `json:"name"`
+	Total    MessageTraffic            `json:"total"`
+	Messages map[string]MessageTraffic `json:"messages"` // Keyed by protocol/version/code
+}
+
+// NetworkTraffic summarizes the traffic of the server since it was started.
+type NetworkTraffic struct {
+	Total    MessageTraffic            `json:"total"`
+	Messages map[string]MessageTraffic `json:"messages"` // Keyed by protocol/version/code, including disconnected peers
+	Peers    []*PeerTraffic            `json:"peers"`
+	Limits   struct {
+		MaxEgressRate     int `json:"maxEgressRate"`     // Bytes per second for all peers, 0 if unlimited
+		MaxPeerEgressRate int `json:"maxPeerEgressRate"` // Bytes per second for every peer, 0 if unlimited
+	} `json:"limits"`
+}
+
+// messageKey names a subprotocol message in the traffic statistics.
+func messageKey(cap Cap, code uint64) string {
+	return fmt.Sprintf("%s/%d/%#02x", cap.Name, cap.Version, code)
+}
+
+// trafficCounter accumulates the traffic per kind of message. Counts are also
+// added to the parent counter, if any.
+type trafficCounter struct {
+	parent   *trafficCounter
+	messages map[string]*MessageTraffic
+	lock     sync.Mutex
+}
+
+func newTrafficCounter(parent *trafficCounter) *trafficCounter {
+	return &trafficCounter{
+		parent:   parent,
+		messages: make(map[string]*MessageTraffic),
+	}
+}
+
+func (c *trafficCounter) message(key string) *MessageTraffic {
+	t, ok := c.messages[key]
+	if !ok {
+		t = new(MessageTraffic)
+		c.messages[key] = t
+	}
+	return t
+}
+
+func (c *trafficCounter) ingress(key string, size uint32) {
+	for ; c != nil; c = c.parent {
+		c.lock.Lock()
+		t := c.message(key)
+		t.IngressBytes += uint64(size)
+		t.IngressPackets++
+		c.lock.Unlock()
+	}
+}
+
+func (c *trafficCounter) egress(key string, size uint32, throttled bool) {
+	for ; c != nil; c = c.parent {
+		c.lock.Lock()
+		t := c.message(key)
+		t.EgressBytes += uint64(size)
+		t.EgressPackets++
+		if throttled {
+			t.Throttled++
+		}
+		c.lock.Unlock()
+	}
+}
+
+// snapshot returns a copy of the counters and their sum.
+func (c *trafficCounter) snapshot() (MessageTraffic, map[string]MessageTraffic) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var total MessageTraffic
+	messages := make(map[string]MessageTraffic, len(c.messages))
+	for key, t := range c.messages {
+		messages[key] = *t
+		total.add(t)
+	}
+	return total, messages
+}
+
+// tokenBucket is a byte rate limiter. Tokens are taken before a message is sent
+// and may go negative, in which case the sender waits for the debt to be
+// refilled.
+type tokenBucket struct {
+	clock   mclock.Clock
+	rate    float64 // Tokens added per second
+	burst   float64 // Maximum number of tokens
+	tokens  float64
+	updated mclock.AbsTime
+	lock    sync.Mutex
+}
+
+func newTokenBucket(clock mclock.Clock, rate int) *tokenBucket {
+	return &tokenBucket{
+		clock:   clock,
+		rate:    float64(rate),
+		burst:   float64(rate),
+		tokens:  float64(rate),
+		updated: clock.Now(),
+	}
+}
+
+func (b *tokenBucket) refill() {
+	now := b.clock.Now()
+	b.tokens += b.rate * time.Duration(now-b.updated).Seconds()
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.updated = now
+}
+
+// take reserves size tokens and returns how long the caller has to wait before
+// sending.
+func (b *tokenBucket) take(size int) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill()
+	b.tokens -= float64(size)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// charge takes size tokens without waiting, delaying the next callers of take
+// instead. The debt is capped at one burst so that priority traffic cannot
+// starve other messages indefinitely.
+func (b *tokenBucket) charge(size int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill()
+	b.tokens -= float64(size)
+	if b.tokens < -b.burst {
+		b.tokens = -b.burst
+	}
+}
+
+// egressLimiter applies the server wide and the per peer bandwidth limits to
+// the outbound messages of a peer.
+type egressLimiter struct {
+	clock   mclock.Clock
+	buckets []*tokenBucket
+}
+
+func newEgressLimiter(clock mclock.Clock, buckets ...*tokenBucket) *egressLimiter {
+	l := &egressLimiter{clock: clock}
+	for _, b := range buckets {
+		if b != nil {
+			l.buckets = append(l.buckets, b)
+		}
+	}
+	if len(l.buckets) == 0 {
+		return nil
+	}
+	return l
+}
+
+// wait blocks until a message of the given size may be sent. Priority messages
+// never wait, they only delay the messages sent after them. It reports whether
+// the message was delayed.
+func (l *egressLimiter) wait(size uint32, priority bool, closed <-chan struct{}) (bool, error) {
+	if priority {
+		for _, b := range l.buckets {
+			b.charge(int(size))
+		}
+		return false, nil
+	}
+	var delay time.Duration
+	for _, b := range l.buckets {
+		if d := b.take(int(size)); d > delay {
+			delay = d
+		}
+	}
+	if delay == 0 {
+		return false, nil
+	}
+	throttleMeter.Mark(1)
+	throttleTimer.Update(delay)
+
+	timer := l.clock.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return true, nil
+	case <-closed:
+		return true, ErrShuttingDown
+	}
+}
+
+// NetworkTraffic returns the traffic statistics of the server and its peers.
+func (srv *Server) NetworkTraffic() *NetworkTraffic {
+	stats := new(NetworkTraffic)
+	stats.Limits.MaxEgressRate = srv.MaxEgressRate
+	stats.Limits.MaxPeerEgressRate = srv.MaxPeerEgressRate
+	if srv.traffic != nil {
+		stats.Total, stats.Messages = srv.traffic.snapshot()
+	}
+	for _, p := range srv.Peers() {
+		if p == nil || p.traffic == nil {
+			continue
+		}
+		peer := &PeerTraffic{
+			ID:   p.ID().String(),
+			Name: p.Fullname(),
+		}
+		peer.Total, peer.Messages = p.traffic.snapshot()
+		stats.Peers = append(stats.Peers, peer)
+	}
+	sort.Slice(stats.Peers, func(i, j int) bool {
+		return stats.Peers[i].ID < stats.Peers[j].ID
+	})
+	return stats
+}
@@ -0,0 +1,101 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumCoinProject/qc/common/mclock"
+)
+
+func TestTrafficCounter(t *testing.T) {
+	var (
+		server = newTrafficCounter(nil)
+		peer1  = newTrafficCounter(server)
+		peer2  = newTrafficCounter(server)
+		key    = messageKey(Cap{"eth", 67}, 0x18)
+	)
+	peer1.ingress(key, 100)
+	peer1.egress(key, 50, true)
+	peer2.egress(key, 25, false)
+	peer2.egress(messageKey(Cap{"eth", 67}, 0x07), 1000, false)
+
+	total, messages := peer1.snapshot()
+	if total.IngressBytes != 100 || total.EgressBytes != 50 || total.Throttled != 1 {
+		t.Fatalf("wrong peer traffic: %+v", total)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("wrong number of peer message types: have %d, want 1", len(messages))
+	}
+	total, messages = server.snapshot()
+	if total.EgressBytes != 1075 || total.EgressPackets != 3 || total.IngressPackets != 1 {
+		t.Fatalf("wrong server traffic: %+v", total)
+	}
+	if m := messages[key]; m.EgressBytes != 75 || m.EgressPackets != 2 {
+		t.Fatalf("wrong consensus message traffic: %+v", m)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	var (
+		clock  = new(mclock.Simulated)
+		bucket = newTokenBucket(clock, 1000)
+	)
+	if wait := bucket.take(600); wait != 0 {
+		t.Fatalf("wait within burst: %v", wait)
+	}
+	if wait := bucket.take(600); wait != 200*time.Millisecond {
+		t.Fatalf("wrong wait: have %v, want %v", wait, 200*time.Millisecond)
+	}
+	clock.Run(200 * time.Millisecond)
+	if wait := bucket.take(500); wait != 500*time.Millisecond {
+		t.Fatalf("wrong wait after refill: have %v, want %v", wait, 500*time.Millisecond)
+	}
+
+	// Priority traffic never waits but its debt is capped at one burst
+	clock.Run(time.Second)
+	bucket.charge(5000)
+	if wait := bucket.take(0); wait != time.Second {
+		t.Fatalf("wrong wait after priority traffic: have %v, want %v", wait, time.Second)
+	}
+}
+
+func TestEgressLimiterPriority(t *testing.T) {
+	var (
+		clock   = new(mclock.Simulated)
+		limiter = newEgressLimiter(clock, newTokenBucket(clock, 1000), nil)
+		closed  = make(chan struct{})
+	)
+	if newEgressLimiter(clock, nil, nil) != nil {
+		t.Fatal("limiter without buckets is not nil")
+	}
+	// Use up the burst with priority traffic, which must not block
+	if throttled, err := limiter.wait(1000, true, closed); throttled || err != nil {
+		t.Fatalf("priority message held back: throttled %v, err %v", throttled, err)
+	}
+	done := make(chan bool)
+	go func() {
+		throttled, _ := limiter.wait(500, false, closed)
+		done <- throttled
+	}()
+	clock.WaitForTimers(1)
+	select {
+	case <-done:
+		t.Fatal("gossip message sent before the bandwidth was available")
+	default:
+	}
+	clock.Run(500 * time.Millisecond)
+	if throttled := <-done; !throttled {
+		t.Fatal("delayed message not reported as throttled")
+	}
+
+	// A waiting sender is released when the peer shuts down
+	go func() {
+		_, err := limiter.wait(5000, false, closed)
+		done <- err == ErrShuttingDown
+	}()
+	clock.WaitForTimers(1)
+	close(closed)
+	if ok := <-done; !ok {
+		t.Fatal("waiting sender not released on shutdown")
+	}
+}
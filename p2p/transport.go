@@ -57,6 +57,13 @@ func newRLPX(conn net.Conn, dialDest *signaturealgorithm.PublicKey, context stri
 	return &rlpxTransport{conn: rlpx.NewConn(conn, dialDest, context)}
 }
 
+// newRLPXWithConfig returns a transport constructor using the given RLPx settings.
+func newRLPXWithConfig(config rlpx.Config) func(net.Conn, *signaturealgorithm.PublicKey, string) transport {
+	return func(conn net.Conn, dialDest *signaturealgorithm.PublicKey, context string) transport {
+		return &rlpxTransport{conn: rlpx.NewConnWithConfig(conn, dialDest, context, config)}
+	}
+}
+
 func (t *rlpxTransport) ReadMsg() (Msg, error) {
 	t.rmu.Lock()
 	defer t.rmu.Unlock()
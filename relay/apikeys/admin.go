@@ -0,0 +1,170 @@
+package apikeys
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+// KeyResponse is a key returned by the admin api. The secret is only returned
+// when the key is created or rotated.
+type KeyResponse struct {
+	Id        string `json:"id"`
+	Tier      string `json:"tier"`
+	CreatedAt int64  `json:"createdAt"`
+	Config    bool   `json:"config"`
+	Key       string `json:"key,omitempty"`
+}
+
+type ListKeysResponse struct {
+	Items []KeyResponse `json:"items"`
+}
+
+type CreateKeyRequest struct {
+	Tier string `json:"tier"`
+}
+
+type KeyUsageResponse struct {
+	Id    string   `json:"id"`
+	Tier  string   `json:"tier"`
+	Items []*Usage `json:"items"`
+}
+
+type errorResponse struct {
+	Message string `json:"message"`
+	Status  int    `json:"status"`
+}
+
+func newKeyResponse(key Key, secret string) KeyResponse {
+	return KeyResponse{Id: key.Id, Tier: key.Tier, CreatedAt: key.CreatedAt, Config: key.Config, Key: secret}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Error("Write admin response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Message: message, Status: status})
+}
+
+func writeKeyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrKeyNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrUnknownTier):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrConfigKey):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		log.Error("Admin api", "error", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+	}
+}
+
+// RegisterAdminRoutes adds the admin api, which creates, rotates and deletes
+// keys and returns their usage, to a router. Requests are authorized with the
+// admin key in the X-Admin-Key header; without an admin key, the admin api is
+// not available.
+func (m *Manager) RegisterAdminRoutes(router *mux.Router) {
+	if len(m.adminKey) == 0 {
+		return
+	}
+	routes := []struct {
+		name    string
+		method  string
+		pattern string
+		handler http.HandlerFunc
+	}{
+		{"AdminListKeys", http.MethodGet, "/admin/keys", m.listKeys},
+		{"AdminCreateKey", http.MethodPost, "/admin/keys", m.createKey},
+		{"AdminRotateKey", http.MethodPost, "/admin/keys/{id}/rotate", m.rotateKey},
+		{"AdminDeleteKey", http.MethodDelete, "/admin/keys/{id}", m.deleteKey},
+		{"AdminKeyUsage", http.MethodGet, "/admin/keys/{id}/usage", m.keyUsage},
+	}
+	for _, route := range routes {
+		router.Methods(route.method).Path(route.pattern).Name(route.name).Handler(m.admin(route.name, route.handler))
+	}
+}
+
+func (m *Manager) admin(name string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		adminKey := r.Header.Get(AdminKeyHeader)
+		if subtle.ConstantTimeCompare([]byte(adminKey), []byte(m.adminKey)) != 1 {
+			log.Error(name, "error", "Unauthorized")
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		log.Info(name, "id", mux.Vars(r)["id"])
+		next(w, r)
+	})
+}
+
+func (m *Manager) listKeys(w http.ResponseWriter, r *http.Request) {
+	keys := m.Keys()
+	response := ListKeysResponse{Items: make([]KeyResponse, len(keys))}
+	for i, key := range keys {
+		response.Items[i] = newKeyResponse(key, "")
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (m *Manager) createKey(w http.ResponseWriter, r *http.Request) {
+	request := CreateKeyRequest{Tier: DefaultTier}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	key, secret, err := m.CreateKey(request.Tier)
+	if err != nil {
+		writeKeyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newKeyResponse(key, secret))
+}
+
+func (m *Manager) rotateKey(w http.ResponseWriter, r *http.Request) {
+	key, secret, err := m.RotateKey(mux.Vars(r)["id"])
+	if err != nil {
+		writeKeyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newKeyResponse(key, secret))
+}
+
+func (m *Manager) deleteKey(w http.ResponseWriter, r *http.Request) {
+	if err := m.DeleteKey(mux.Vars(r)["id"]); err != nil {
+		writeKeyError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *Manager) keyUsage(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	days := 7
+	if param := r.URL.Query().Get("days"); len(param) > 0 {
+		var err error
+		days, err = strconv.Atoi(param)
+		if err != nil || days < 1 || days > MaxUsageDays {
+			writeError(w, http.StatusBadRequest, "days must be between 1 and "+strconv.Itoa(MaxUsageDays))
+			return
+		}
+	}
+	items, err := m.Usage(id, days)
+	if err != nil {
+		writeKeyError(w, err)
+		return
+	}
+	key, _ := m.Key(id)
+	writeJSON(w, http.StatusOK, KeyUsageResponse{Id: id, Tier: key.Tier, Items: items})
+}
@@ -0,0 +1,560 @@
+// Package apikeys implements the api keys of the relay: named tiers with
+// per-route token bucket limits, per-key usage counters and key rotation.
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/metrics"
+	"github.com/gorilla/mux"
+	"golang.org/x/time/rate"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ApiKeyKey = "apikey-%s" //%s is key id
+var ApiKeyKeyPrefix = "apikey-"
+var ApiUsageKey = "apiusage-%s-%s" //%s is key id, %s is the UTC date
+
+const (
+	ApiKeyHeader   = "X-Api-Key"
+	ApiKeyParam    = "apiKey" // Query parameter of WebSocket and EventSource clients
+	AdminKeyHeader = "X-Admin-Key"
+
+	// DefaultTier is the tier of keys set without a tier, and of clients without
+	// a valid key, which are limited by ip address.
+	DefaultTier = "default"
+
+	// UsageFlushInterval is how often the usage counters are written to the
+	// database.
+	UsageFlushInterval = 10 * time.Second
+
+	// MaxUsageDays is the number of days of usage returned at most.
+	MaxUsageDays = 90
+
+	bucketIdleTimeout = 10 * time.Minute
+	usageDateLayout   = "2006-01-02"
+)
+
+var (
+	ErrKeyNotFound = errors.New("api key not found")
+	ErrUnknownTier = errors.New("unknown tier")
+	ErrConfigKey   = errors.New("api keys set in the config cannot be changed")
+)
+
+// Limit is a token bucket, refilled at Rate tokens per second up to Burst
+// tokens. Each request takes a token.
+type Limit struct {
+	Rate  float64 `json:"rate"`  // 0 for no limit
+	Burst int     `json:"burst"` // Defaults to the rate, at least 1
+}
+
+func (l Limit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	if l.Rate < 1 {
+		return 1
+	}
+	return int(math.Ceil(l.Rate))
+}
+
+// Tier is a named set of limits. Routes overrides the limit of the tier for
+// some routes, by route name.
+type Tier struct {
+	Limit
+	Routes     map[string]Limit `json:"routes"`
+	DailyQuota uint64           `json:"dailyQuota"` // Requests per UTC day, 0 for no quota
+}
+
+func (t Tier) limit(route string) Limit {
+	if l, ok := t.Routes[route]; ok {
+		return l
+	}
+	return t.Limit
+}
+
+// Key is an api key. Only the SHA-256 hash of the key is kept.
+type Key struct {
+	Id        string `json:"id"`
+	Tier      string `json:"tier"`
+	Hash      string `json:"hash"`
+	CreatedAt int64  `json:"createdAt"`
+	Config    bool   `json:"config"` // Set in the config rather than with the admin api
+}
+
+// Usage holds the requests made with a key in a UTC day.
+type Usage struct {
+	Date     string            `json:"date"`
+	Requests uint64            `json:"requests"`
+	Limited  uint64            `json:"limited"` // Requests rejected by a limit or the quota
+	Routes   map[string]uint64 `json:"routes"`
+}
+
+type bucket struct {
+	limiter *rate.Limiter
+	used    time.Time
+}
+
+// Manager authorizes and limits the requests of a relay api, and keeps the
+// keys created with the admin api and the usage of each key in a database.
+type Manager struct {
+	db       ethdb.KeyValueStore
+	tiers    map[string]Tier
+	adminKey string
+	now      func() time.Time
+
+	lock    sync.Mutex
+	byId    map[string]*Key
+	byHash  map[string]*Key
+	buckets map[string]*bucket // key id or client ip, and route name, to bucket
+	usage   map[string]*Usage  // key id to usage of the current day
+	dirty   map[string]bool
+
+	limitedMeter metrics.Meter
+	quit         chan struct{}
+	wg           sync.WaitGroup
+}
+
+// NewManager creates the manager of the keys in apiKeys, a comma separated list
+// of keys each optionally followed by a colon and the name of its tier, and of
+// the keys stored in db.
+func NewManager(db ethdb.KeyValueStore, apiKeys string, tiers map[string]Tier, adminKey string) (*Manager, error) {
+	m := &Manager{
+		db:           db,
+		tiers:        tiers,
+		adminKey:     adminKey,
+		now:          time.Now,
+		byId:         make(map[string]*Key),
+		byHash:       make(map[string]*Key),
+		buckets:      make(map[string]*bucket),
+		usage:        make(map[string]*Usage),
+		dirty:        make(map[string]bool),
+		limitedMeter: metrics.GetOrRegisterMeter("relay/apikeys/limited", nil),
+		quit:         make(chan struct{}),
+	}
+	if m.tiers == nil {
+		m.tiers = make(map[string]Tier)
+	}
+	for name, tier := range m.tiers {
+		if tier.Rate < 0 || tier.Burst < 0 {
+			return nil, fmt.Errorf("invalid limit of tier %s", name)
+		}
+		for route, limit := range tier.Routes {
+			if limit.Rate < 0 || limit.Burst < 0 {
+				return nil, fmt.Errorf("invalid limit of route %s of tier %s", route, name)
+			}
+		}
+	}
+
+	it := db.NewIterator([]byte(ApiKeyKeyPrefix), nil)
+	defer it.Release()
+	for it.Next() {
+		var key Key
+		if err := json.Unmarshal(it.Value(), &key); err != nil {
+			return nil, err
+		}
+		if m.hasTier(key.Tier) == false {
+			log.Warn("Api key of an unknown tier, limited with the default tier", "id", key.Id, "tier", key.Tier)
+		}
+		m.add(&key)
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range strings.Split(apiKeys, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		secret, tier := entry, DefaultTier
+		if i := strings.LastIndex(entry, ":"); i > 0 {
+			secret, tier = entry[:i], entry[i+1:]
+		}
+		if m.hasTier(tier) == false {
+			return nil, fmt.Errorf("%w %s of api key", ErrUnknownTier, tier)
+		}
+		hash := hashKey(secret)
+		m.add(&Key{Id: hash[:16], Tier: tier, Hash: hash, Config: true})
+	}
+	return m, nil
+}
+
+func hashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (m *Manager) add(key *Key) {
+	m.byId[key.Id] = key
+	m.byHash[key.Hash] = key
+}
+
+func (m *Manager) hasTier(name string) bool {
+	_, ok := m.tiers[name]
+	return ok || name == DefaultTier
+}
+
+// tier returns the limits of a tier. The keys of a tier that is no longer
+// configured are limited with the default tier.
+func (m *Manager) tier(name string) Tier {
+	if tier, ok := m.tiers[name]; ok {
+		return tier
+	}
+	return m.tiers[DefaultTier]
+}
+
+// Start starts writing the usage counters to the database.
+func (m *Manager) Start() {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		ticker := time.NewTicker(UsageFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.flush(); err != nil {
+					log.Error("Flush api key usage", "error", err)
+				}
+			case <-m.quit:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the manager and writes the usage counters to the database.
+func (m *Manager) Close() error {
+	close(m.quit)
+	m.wg.Wait()
+	return m.flush()
+}
+
+// Authorize reports whether apiKey is a valid key.
+func (m *Manager) Authorize(apiKey string) bool {
+	if len(apiKey) == 0 {
+		return false
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.byHash[hashKey(apiKey)] != nil
+}
+
+// RequestKey returns the api key of a request, from the X-Api-Key header or the
+// apiKey query parameter.
+func RequestKey(r *http.Request) string {
+	if apiKey := r.Header.Get(ApiKeyHeader); len(apiKey) > 0 {
+		return apiKey
+	}
+	return r.URL.Query().Get(ApiKeyParam)
+}
+
+func remoteIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Middleware rejects the requests over the limits of their tier with a 429
+// response and a Retry-After header, and counts the requests of each key.
+// Requests without a valid key are limited by ip address, with the default
+// tier. It is used with a mux router, to limit each route separately.
+func (m *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		route := ""
+		if current := mux.CurrentRoute(r); current != nil {
+			route = current.GetName()
+		}
+		if retryAfter, ok := m.allow(RequestKey(r), remoteIp(r), route); ok == false {
+			m.limitedMeter.Mark(1)
+			w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10))
+			writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allow takes a token from the bucket of the caller for the route, and returns
+// how long to wait if the request is over a limit.
+func (m *Manager) allow(apiKey string, ip string, route string) (time.Duration, bool) {
+	now := m.now()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var key *Key
+	if len(apiKey) > 0 {
+		key = m.byHash[hashKey(apiKey)]
+	}
+	id, tier := "ip-"+ip, m.tiers[DefaultTier]
+	var usage *Usage
+	if key != nil {
+		id, tier = key.Id, m.tier(key.Tier)
+		usage = m.currentUsage(key.Id, now)
+		m.dirty[key.Id] = true
+		if tier.DailyQuota > 0 && usage.Requests >= tier.DailyQuota {
+			usage.Limited++
+			midnight := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+			return midnight.Sub(now), false
+		}
+	}
+
+	if limit := tier.limit(route); limit.Rate > 0 {
+		name := id + "/" + route
+		b := m.buckets[name]
+		if b == nil {
+			b = &bucket{limiter: rate.NewLimiter(rate.Limit(limit.Rate), limit.burst())}
+			m.buckets[name] = b
+		}
+		b.used = now
+		reservation := b.limiter.ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			reservation.CancelAt(now)
+			if usage != nil {
+				usage.Limited++
+			}
+			return delay, false
+		}
+	}
+
+	if usage != nil {
+		usage.Requests++
+		usage.Routes[route]++
+	}
+	return 0, true
+}
+
+// currentUsage returns the usage of a key for the day of now, reading it from
+// the database when the day starts or the relay restarts.
+func (m *Manager) currentUsage(id string, now time.Time) *Usage {
+	date := now.UTC().Format(usageDateLayout)
+	if usage := m.usage[id]; usage != nil && usage.Date == date {
+		return usage
+	}
+	if err := m.flushLocked(); err != nil {
+		log.Error("Flush api key usage", "error", err)
+	}
+	usage, err := m.readUsage(id, date)
+	if err != nil {
+		log.Error("Read api key usage", "id", id, "error", err)
+	}
+	if usage == nil {
+		usage = &Usage{Date: date, Routes: make(map[string]uint64)}
+	}
+	m.usage[id] = usage
+	return usage
+}
+
+func (m *Manager) readUsage(id string, date string) (*Usage, error) {
+	key := []byte(fmt.Sprintf(ApiUsageKey, id, date))
+	if ok, err := m.db.Has(key); err != nil || ok == false {
+		return nil, err
+	}
+	data, err := m.db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	var usage Usage
+	if err := json.Unmarshal(data, &usage); err != nil {
+		return nil, err
+	}
+	if usage.Routes == nil {
+		usage.Routes = make(map[string]uint64)
+	}
+	return &usage, nil
+}
+
+func (m *Manager) flush() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := m.now()
+	for name, b := range m.buckets {
+		if now.Sub(b.used) > bucketIdleTimeout {
+			delete(m.buckets, name)
+		}
+	}
+	return m.flushLocked()
+}
+
+func (m *Manager) flushLocked() error {
+	if len(m.dirty) == 0 {
+		return nil
+	}
+	batch := m.db.NewBatch()
+	for id := range m.dirty {
+		usage := m.usage[id]
+		if usage == nil {
+			continue
+		}
+		data, err := json.Marshal(usage)
+		if err != nil {
+			return err
+		}
+		if err := batch.Put([]byte(fmt.Sprintf(ApiUsageKey, id, usage.Date)), data); err != nil {
+			return err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	m.dirty = make(map[string]bool)
+	return nil
+}
+
+// Keys returns the keys, ordered by id.
+func (m *Manager) Keys() []Key {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	keys := make([]Key, 0, len(m.byId))
+	for _, key := range m.byId {
+		keys = append(keys, *key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Id < keys[j].Id })
+	return keys
+}
+
+// Key returns the key with an id.
+func (m *Manager) Key(id string) (Key, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if key := m.byId[id]; key != nil {
+		return *key, true
+	}
+	return Key{}, false
+}
+
+func (m *Manager) putKey(key *Key) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return m.db.Put([]byte(fmt.Sprintf(ApiKeyKey, key.Id)), data)
+}
+
+// CreateKey creates a key of a tier, and returns it with its secret.
+func (m *Manager) CreateKey(tier string) (Key, string, error) {
+	if m.hasTier(tier) == false {
+		return Key{}, "", ErrUnknownTier
+	}
+	id, err := randomHex(8)
+	if err != nil {
+		return Key{}, "", err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return Key{}, "", err
+	}
+	key := &Key{Id: id, Tier: tier, Hash: hashKey(secret), CreatedAt: m.now().Unix()}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if err := m.putKey(key); err != nil {
+		return Key{}, "", err
+	}
+	m.add(key)
+	return *key, secret, nil
+}
+
+// RotateKey replaces the secret of a key. The previous secret stops working at
+// once; the id, and so the usage and the limits, stay the same.
+func (m *Manager) RotateKey(id string) (Key, string, error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return Key{}, "", err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	key := m.byId[id]
+	if key == nil {
+		return Key{}, "", ErrKeyNotFound
+	}
+	if key.Config {
+		return Key{}, "", ErrConfigKey
+	}
+	rotated := *key
+	rotated.Hash = hashKey(secret)
+	rotated.CreatedAt = m.now().Unix()
+	if err := m.putKey(&rotated); err != nil {
+		return Key{}, "", err
+	}
+	delete(m.byHash, key.Hash)
+	m.add(&rotated)
+	return rotated, secret, nil
+}
+
+// DeleteKey deletes a key. Its usage is kept.
+func (m *Manager) DeleteKey(id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	key := m.byId[id]
+	if key == nil {
+		return ErrKeyNotFound
+	}
+	if key.Config {
+		return ErrConfigKey
+	}
+	if err := m.flushLocked(); err != nil {
+		return err
+	}
+	if err := m.db.Delete([]byte(fmt.Sprintf(ApiKeyKey, id))); err != nil {
+		return err
+	}
+	delete(m.byId, id)
+	delete(m.byHash, key.Hash)
+	delete(m.usage, id)
+	return nil
+}
+
+// Usage returns the usage of a key in the last days, most recent first. Days
+// without requests are left out.
+func (m *Manager) Usage(id string, days int) ([]*Usage, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.byId[id] == nil {
+		return nil, ErrKeyNotFound
+	}
+	if err := m.flushLocked(); err != nil {
+		return nil, err
+	}
+	now := m.now().UTC()
+	items := make([]*Usage, 0)
+	for i := 0; i < days; i++ {
+		usage, err := m.readUsage(id, now.AddDate(0, 0, -i).Format(usageDateLayout))
+		if err != nil {
+			return nil, err
+		}
+		if usage != nil {
+			items = append(items, usage)
+		}
+	}
+	return items, nil
+}
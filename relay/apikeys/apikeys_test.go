@@ -0,0 +1,201 @@
+package apikeys
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/ethdb"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testTiers = map[string]Tier{
+	DefaultTier: {Limit: Limit{Rate: 1, Burst: 2}},
+	"premium": {
+		Limit:      Limit{Rate: 100},
+		Routes:     map[string]Limit{"Send": {Rate: 1, Burst: 1}},
+		DailyQuota: 5,
+	},
+}
+
+func newTestManager(t *testing.T, db ethdb.Database, apiKeys string, now *time.Time) *Manager {
+	m, err := NewManager(db, apiKeys, testTiers, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.now = func() time.Time { return *now }
+	return m
+}
+
+func newTestRouter(m *Manager) *mux.Router {
+	router := mux.NewRouter()
+	for _, name := range []string{"Read", "Send"} {
+		router.Path("/" + name).Name(name).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	}
+	router.Use(m.Middleware)
+	m.RegisterAdminRoutes(router)
+	return router
+}
+
+func serve(router *mux.Router, method string, path string, header string, value string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	if len(header) > 0 {
+		r.Header.Set(header, value)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestRateLimit(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := newTestManager(t, rawdb.NewMemoryDatabase(), "basic,gold:premium", &now)
+	router := newTestRouter(m)
+
+	if _, err := NewManager(rawdb.NewMemoryDatabase(), "key:unknown", testTiers, ""); !errors.Is(err, ErrUnknownTier) {
+		t.Fatalf("unexpected error %v, want %v", err, ErrUnknownTier)
+	}
+	if m.Authorize("basic") == false || m.Authorize("gold") == false || m.Authorize("other") {
+		t.Fatal("unexpected authorization")
+	}
+
+	// Clients without a key are limited by ip with the default tier, each route
+	// separately
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if w := serve(router, http.MethodGet, "/Read", "", ""); w.Code != want {
+			t.Fatalf("request %d: status %d, want %d", i, w.Code, want)
+		}
+	}
+	w := serve(router, http.MethodGet, "/Read", "", "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("status %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := serve(router, http.MethodGet, "/Send", "", ""); w.Code != http.StatusOK {
+		t.Fatalf("status %d on another route", w.Code)
+	}
+	if w := serve(router, http.MethodGet, "/Read", ApiKeyHeader, "basic"); w.Code != http.StatusOK {
+		t.Fatalf("status %d with a key", w.Code)
+	}
+	now = now.Add(time.Second)
+	if w := serve(router, http.MethodGet, "/Read", "", ""); w.Code != http.StatusOK {
+		t.Fatalf("status %d after the bucket refilled", w.Code)
+	}
+
+	// Route limits override the limit of the tier, and the quota applies to all
+	// the routes
+	if w := serve(router, http.MethodGet, "/Send?apiKey=gold", "", ""); w.Code != http.StatusOK {
+		t.Fatalf("status %d", w.Code)
+	}
+	if w := serve(router, http.MethodGet, "/Send", ApiKeyHeader, "gold"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d over the route limit", w.Code)
+	}
+	for i := 0; i < 4; i++ {
+		if w := serve(router, http.MethodGet, "/Read", ApiKeyHeader, "gold"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i, w.Code)
+		}
+	}
+	w = serve(router, http.MethodGet, "/Read", ApiKeyHeader, "gold")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "43199" {
+		t.Fatalf("status %d, Retry-After %q over the quota", w.Code, w.Header().Get("Retry-After"))
+	}
+	now = now.Add(12 * time.Hour)
+	if w := serve(router, http.MethodGet, "/Read", ApiKeyHeader, "gold"); w.Code != http.StatusOK {
+		t.Fatalf("status %d on the next day", w.Code)
+	}
+}
+
+func TestKeyRotationAndUsage(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	db := rawdb.NewMemoryDatabase()
+	m := newTestManager(t, db, "basic", &now)
+	router := newTestRouter(m)
+
+	if w := serve(router, http.MethodPost, "/admin/keys", AdminKeyHeader, "wrong"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("status %d with a wrong admin key", w.Code)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/admin/keys", strings.NewReader(`{"tier":"premium"}`))
+	r.Header.Set(AdminKeyHeader, "admin")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	var created KeyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || w.Code != http.StatusOK || created.Tier != "premium" {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+	serve(router, http.MethodGet, "/Read", ApiKeyHeader, created.Key)
+	serve(router, http.MethodGet, "/Send", ApiKeyHeader, created.Key)
+	serve(router, http.MethodGet, "/Send", ApiKeyHeader, created.Key)
+
+	w = serve(router, http.MethodPost, "/admin/keys/"+created.Id+"/rotate", AdminKeyHeader, "admin")
+	var rotated KeyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &rotated); err != nil || rotated.Id != created.Id || rotated.Key == created.Key {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+	if m.Authorize(created.Key) || m.Authorize(rotated.Key) == false {
+		t.Fatal("previous key still valid after rotation")
+	}
+	if _, _, err := m.RotateKey(hashKey("basic")[:16]); !errors.Is(err, ErrConfigKey) {
+		t.Fatalf("unexpected error %v, want %v", err, ErrConfigKey)
+	}
+
+	// Keys and usage are kept across restarts
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	m = newTestManager(t, db, "basic", &now)
+	if m.Authorize(rotated.Key) == false {
+		t.Fatal("rotated key lost")
+	}
+	now = now.Add(24 * time.Hour)
+	if _, ok := m.allow(rotated.Key, "", "Read"); ok == false {
+		t.Fatal("request not allowed")
+	}
+	usage, err := m.Usage(created.Id, 7)
+	if err != nil || len(usage) != 2 {
+		t.Fatalf("unexpected usage %v, %v", usage, err)
+	}
+	if usage[0].Date != "2024-01-02" || usage[0].Requests != 1 {
+		t.Fatalf("unexpected usage %+v", usage[0])
+	}
+	if day := usage[1]; day.Requests != 2 || day.Limited != 1 || day.Routes["Send"] != 1 {
+		t.Fatalf("unexpected usage %+v", day)
+	}
+
+	if err := m.DeleteKey(created.Id); err != nil {
+		t.Fatal(err)
+	}
+	if m.Authorize(rotated.Key) {
+		t.Fatal("deleted key still valid")
+	}
+	if _, err := m.Usage(created.Id, 7); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("unexpected error %v, want %v", err, ErrKeyNotFound)
+	}
+}
+
+func TestRemovedTier(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	db := rawdb.NewMemoryDatabase()
+	m := newTestManager(t, db, "", &now)
+	_, secret, err := m.CreateKey("premium")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys of a tier removed from the config are limited with the default tier
+	m, err = NewManager(db, "", map[string]Tier{DefaultTier: testTiers[DefaultTier]}, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.now = func() time.Time { return now }
+	for i, want := range []bool{true, true, false} {
+		if _, ok := m.allow(secret, "", "Read"); ok != want {
+			t.Fatalf("request %d: allowed %v, want %v", i, ok, want)
+		}
+	}
+}
@@ -1,18 +1,38 @@
 package relay
 
-import "errors"
+import (
+	"errors"
+	"github.com/QuantumCoinProject/qc/relay/apikeys"
+	"strings"
+)
 
 var (
 	InfoTitleLatestBlockDetails             = "Get latest block details"
 	InfoTitleAccountDetails                 = "Get account details"
 	InfoTitleTransaction                    = "Get Transaction"
 	InfoTitleSendTransaction                = "Send Transaction"
+	InfoTitleSimulateTransaction            = "Simulate Transaction"
+	InfoTitleAccountNonce                   = "Get account nonce"
+	InfoTitleFees                           = "Get fees"
 	InfoTitleListAccountTransactions        = "List Account Transactions"
 	InfoTitleListAccountPendingTransactions = "List Account Pending Transactions"
 	InfoTitleGetBlockchainDetails           = "Get Blockchain details"
 	InfoTitleQueryDetails                   = "Query details"
 	InfoTitleAccountTokenDetails            = "Get account token details"
 	InfoTitleTokenDetails                   = "Get token details"
+	InfoTitleListAccountTokens              = "List Account Tokens"
+	InfoTitleTokenHolders                   = "Get token holders"
+	InfoTitleRegisterWebhook                = "Register webhook"
+	InfoTitleWebhook                        = "Webhook"
+	InfoTitleListValidators                 = "List validators"
+	InfoTitleStakingDetails                 = "Get staking details"
+	InfoTitleBlockStakingDetails            = "Get block staking details"
+	InfoTitleValidatorStats                 = "Get validator stats"
+	InfoTitleExportAccount                  = "Export account"
+	InfoTitleRichList                       = "Get rich list"
+	InfoTitleSupply                         = "Get supply"
+	InfoTitleSupplyDistribution             = "Get supply distribution"
+	InfoTitleSupplyHistory                  = "Get supply history"
 )
 
 var (
@@ -31,6 +51,7 @@ var (
 	MsgStatus             = "Status"
 	MsgError              = "Error"
 	MsgContractAddress    = "Contract Address"
+	MsgValidatorStats     = "Validator stats"
 )
 
 var (
@@ -39,18 +60,36 @@ var (
 	ErrEmptyHash      = errors.New("empty hash")
 	ErrInvalidHash    = errors.New("invalid hash")
 	ErrEmptyRawTxHex  = errors.New("empty raw tx")
+	ErrInvalidRange   = errors.New("invalid block range")
 )
 
 type RelayConfig struct {
-	Api                string `json:"api"`
-	Ip                 string `json:"ip"`
-	Port               string `json:"port"`
-	NodeUrl            string `json:"nodeUrl"`
-	CorsAllowedOrigins string `json:"corsAllowedOrigins"`
-	EnableAuth         bool   `json:"enableAuth"`
-	ApiKeys            string `json:"apiKeys"`
-	CachePath          string `json:"cachePath"`
-	EnableExtendedApis bool   `json:"enableExtendedApis"`
-	GenesisFilePath    string `json:"genesisFilePath"`
-	MaxSupply          string `json:"maxSupply"`
+	Api                       string                  `json:"api"`
+	Ip                        string                  `json:"ip"`
+	Port                      string                  `json:"port"`
+	NodeUrl                   string                  `json:"nodeUrl"`
+	NodeUrls                  []string                `json:"nodeUrls"`
+	CorsAllowedOrigins        string                  `json:"corsAllowedOrigins"`
+	EnableAuth                bool                    `json:"enableAuth"`
+	ApiKeys                   string                  `json:"apiKeys"`
+	CachePath                 string                  `json:"cachePath"`
+	EnableExtendedApis        bool                    `json:"enableExtendedApis"`
+	IndexInternalTransactions bool                    `json:"indexInternalTransactions"`
+	GenesisFilePath           string                  `json:"genesisFilePath"`
+	MaxSupply                 string                  `json:"maxSupply"`
+	MetricsAddress            string                  `json:"metricsAddress"`
+	ApiKeyTiers               map[string]apikeys.Tier `json:"apiKeyTiers"`
+	AdminApiKey               string                  `json:"adminApiKey"`
+}
+
+// Upstreams returns the urls of the nodes the relay uses, nodeUrl followed by
+// nodeUrls.
+func (c RelayConfig) Upstreams() []string {
+	urls := make([]string, 0, len(c.NodeUrls)+1)
+	for _, url := range append([]string{c.NodeUrl}, c.NodeUrls...) {
+		if url = strings.TrimSpace(url); len(url) > 0 {
+			urls = append(urls, url)
+		}
+	}
+	return urls
 }
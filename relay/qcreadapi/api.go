@@ -12,7 +12,10 @@ package qcreadapi
 
 import (
 	"context"
+	"github.com/QuantumCoinProject/qc/cachemanager"
+	"github.com/QuantumCoinProject/qc/event"
 	"net/http"
+	"time"
 )
 
 
@@ -30,6 +33,23 @@ type ReadApiAPIRouter interface {
 	QueryDetails(http.ResponseWriter, *http.Request)
 	GetTokenDetails(http.ResponseWriter, *http.Request)
 	GetAccountTokenDetails(http.ResponseWriter, *http.Request)
+	ListAccountTokens(http.ResponseWriter, *http.Request)
+	GetTokenHolders(http.ResponseWriter, *http.Request)
+	SubscribeEvents(http.ResponseWriter, *http.Request)
+	StreamEvents(http.ResponseWriter, *http.Request)
+	RegisterWebhook(http.ResponseWriter, *http.Request)
+	AddWebhookAddresses(http.ResponseWriter, *http.Request)
+	GetWebhook(http.ResponseWriter, *http.Request)
+	DeleteWebhook(http.ResponseWriter, *http.Request)
+	ListValidators(http.ResponseWriter, *http.Request)
+	GetStakingDetails(http.ResponseWriter, *http.Request)
+	GetBlockStakingDetails(http.ResponseWriter, *http.Request)
+	GetValidatorStats(http.ResponseWriter, *http.Request)
+	ExportAccountHistory(http.ResponseWriter, *http.Request)
+	GetRichList(http.ResponseWriter, *http.Request)
+	GetSupply(http.ResponseWriter, *http.Request)
+	GetSupplyDistribution(http.ResponseWriter, *http.Request)
+	GetSupplyHistory(http.ResponseWriter, *http.Request)
 }
 
 
@@ -47,4 +67,21 @@ type ReadApiAPIServicer interface {
 	QueryDetails(context.Context, string) (ImplResponse, error)
 	GetTokenDetails(context.Context, string) (ImplResponse, error)
 	GetAccountTokenDetails(context.Context, string, string) (ImplResponse, error)
+	ListAccountTokens(context.Context, string, int64) (ImplResponse, error)
+	GetTokenHolders(context.Context, string) (ImplResponse, error)
+	SubscribeEvents(chan<- *cachemanager.Event) event.Subscription
+	RegisterWebhook(context.Context, WebhookRequest) (ImplResponse, error)
+	AddWebhookAddresses(context.Context, string, WebhookAddressesRequest) (ImplResponse, error)
+	GetWebhook(context.Context, string) (ImplResponse, error)
+	DeleteWebhook(context.Context, string) (ImplResponse, error)
+	ListValidators(context.Context) (ImplResponse, error)
+	GetStakingDetails(context.Context, string) (ImplResponse, error)
+	GetBlockStakingDetails(context.Context, int64) (ImplResponse, error)
+	GetValidatorStats(context.Context, string, int64, int64) (ImplResponse, error)
+	ResolveExportRange(context.Context, cachemanager.ExportQuery) (cachemanager.ExportRange, error)
+	ExportAccount(context.Context, string, cachemanager.ExportRange, func(*cachemanager.ExportEntry) error) error
+	GetRichList(context.Context, int64) (ImplResponse, error)
+	GetSupply(context.Context) (ImplResponse, error)
+	GetSupplyDistribution(context.Context) (ImplResponse, error)
+	GetSupplyHistory(context.Context, time.Time, time.Time) (ImplResponse, error)
 }
@@ -15,6 +15,7 @@ import (
 	"github.com/QuantumCoinProject/qc/common"
 	"github.com/QuantumCoinProject/qc/log"
 	"github.com/QuantumCoinProject/qc/relay"
+	"github.com/QuantumCoinProject/qc/relay/apikeys"
 	"net/http"
 	"strconv"
 	"strings"
@@ -31,7 +32,7 @@ type ReadApiAPIController struct {
 	errorHandler ErrorHandler
 	corsAllowedOrigins string
 	enableAuth bool
-	apiKeysMap map[string]bool
+	keys *apikeys.Manager
 }
 
 // ReadApiAPIOption for how the controller is set up.
@@ -45,23 +46,13 @@ func WithReadApiAPIErrorHandler(h ErrorHandler) ReadApiAPIOption {
 }
 
 // NewReadApiAPIController creates a default api controller
-func NewReadApiAPIController(s ReadApiAPIServicer, corsAllowedOrigins string, enableAuth bool, apiKeys string, opts ...ReadApiAPIOption) *ReadApiAPIController {
+func NewReadApiAPIController(s ReadApiAPIServicer, corsAllowedOrigins string, enableAuth bool, keys *apikeys.Manager, opts ...ReadApiAPIOption) *ReadApiAPIController {
 	controller := &ReadApiAPIController{
 		service:      s,
 		errorHandler: DefaultErrorHandler,
 		corsAllowedOrigins: corsAllowedOrigins,
 		enableAuth: enableAuth,
-		apiKeysMap: make(map[string]bool),
-	}
-
-	if len(apiKeys) > 0 {
-		apiKeyList := strings.Split(apiKeys, ",")
-		for _, key := range apiKeyList {
-			if len(key) == 0 {
-				continue
-			}
-			controller.apiKeysMap[key] = true
-		}
+		keys: keys,
 	}
 
 	for _, opt := range opts {
@@ -119,13 +110,98 @@ func (c *ReadApiAPIController) Routes() Routes {
 			"/account/{address}/tokens/{contractAddress}",
 			c.GetAccountTokenDetails,
 		},
+		"ListAccountTokens": Route{
+			strings.ToUpper("Get"),
+			"/account/{address}/tokens",
+			c.ListAccountTokens,
+		},
+		"GetTokenHolders": Route{
+			strings.ToUpper("Get"),
+			"/token/{contractAddress}/holders",
+			c.GetTokenHolders,
+		},
+		"SubscribeEvents": Route{
+			strings.ToUpper("Get"),
+			"/subscribe",
+			c.SubscribeEvents,
+		},
+		"StreamEvents": Route{
+			strings.ToUpper("Get"),
+			"/events",
+			c.StreamEvents,
+		},
+		"RegisterWebhook": Route{
+			strings.ToUpper("Post"),
+			"/webhooks",
+			c.RegisterWebhook,
+		},
+		"AddWebhookAddresses": Route{
+			strings.ToUpper("Post"),
+			"/webhooks/{id}/addresses",
+			c.AddWebhookAddresses,
+		},
+		"GetWebhook": Route{
+			strings.ToUpper("Get"),
+			"/webhooks/{id}",
+			c.GetWebhook,
+		},
+		"DeleteWebhook": Route{
+			strings.ToUpper("Delete"),
+			"/webhooks/{id}",
+			c.DeleteWebhook,
+		},
+		"ListValidators": Route{
+			strings.ToUpper("Get"),
+			"/validators",
+			c.ListValidators,
+		},
+		"GetStakingDetails": Route{
+			strings.ToUpper("Get"),
+			"/staking/{address}",
+			c.GetStakingDetails,
+		},
+		"GetBlockStakingDetails": Route{
+			strings.ToUpper("Get"),
+			"/block/{blockNumber}/staking",
+			c.GetBlockStakingDetails,
+		},
+		"GetValidatorStats": Route{
+			strings.ToUpper("Get"),
+			"/validator/{address}/stats/{fromBlock}/{toBlock}",
+			c.GetValidatorStats,
+		},
+		"ExportAccountHistory": Route{
+			strings.ToUpper("Get"),
+			"/account/{address}/export",
+			c.ExportAccountHistory,
+		},
+		"GetRichList": Route{
+			strings.ToUpper("Get"),
+			"/richlist",
+			c.GetRichList,
+		},
+		"GetSupply": Route{
+			strings.ToUpper("Get"),
+			"/supply",
+			c.GetSupply,
+		},
+		"GetSupplyDistribution": Route{
+			strings.ToUpper("Get"),
+			"/supply/distribution",
+			c.GetSupplyDistribution,
+		},
+		"GetSupplyHistory": Route{
+			strings.ToUpper("Get"),
+			"/supply/history",
+			c.GetSupplyHistory,
+		},
 	}
 }
 
 //(*w).Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Api-Key")
 func (c *ReadApiAPIController) setupCORS(w *http.ResponseWriter, req *http.Request) {
 	(*w).Header().Set("Access-Control-Allow-Origin", c.corsAllowedOrigins)
-	(*w).Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+	(*w).Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
 	(*w).Header().Set("Access-Control-Allow-Headers", "*")
 }
 
@@ -144,11 +220,7 @@ func (c *ReadApiAPIController) authorize(req *http.Request) bool {
 		return false
 	}
 
-	if c.apiKeysMap[apiKey] == true {
-		return true
-	}
-
-	return false
+	return c.keys.Authorize(apiKey)
 }
 
 // GetLatestBlockDetails - Get latest block details
@@ -637,4 +709,336 @@ func (c *ReadApiAPIController) GetAccountTokenDetails(w http.ResponseWriter, r *
 	_ = EncodeJSONResponse(result.Body, &result.Code, w)
 
 	log.Info("GetAccountTokenDetails ok", "requestId", requestId)
-}
\ No newline at end of file
+}
+
+// ListAccountTokens - List the tokens held by an account
+func (c *ReadApiAPIController) ListAccountTokens(w http.ResponseWriter, r *http.Request) {
+	requestId := ""
+	if r.Header != nil {
+		requestId = r.Header.Get(REQUEST_ID_HEADER_NAME)
+	}
+	if len(requestId) > 0 {
+		log.Info("ListAccountTokens", "requestId", requestId)
+	}
+
+	c.setupCORS(&w, r)
+	if (*r).Method == "OPTIONS" {
+		log.Info("ListAccountTokens OPTIONS", "requestId", requestId)
+		return
+	}
+
+	if c.authorize(r) == false {
+		result := Response(http.StatusUnauthorized, nil)
+		// If no error, encode the body and the result code
+		_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+		log.Error("ListAccountTokens", "requestId", requestId, "error", "Unauthorized")
+		c.errorHandler(w, r, errors.New("Unauthorized"), &result)
+		return
+	}
+
+	params := mux.Vars(r)
+	addressParam := params["address"]
+	if addressParam == "" {
+		c.errorHandler(w, r, &RequiredError{"address"}, nil)
+		log.Error("ListAccountTokens", "requestId", requestId, "error", "address is empty")
+		return
+	}
+
+	if !common.IsHexAddressDeep(addressParam) {
+		log.Error(relay.MsgAddress, relay.MsgAddress, addressParam, relay.MsgError, relay.ErrInvalidAddress, relay.MsgStatus, http.StatusBadRequest, "requestId", requestId)
+		c.errorHandler(w, r, &ParsingError{"address", errors.New("Invalid address")}, nil)
+		return
+	}
+
+	pageNumber := int64(1)
+	pageNumberParam := r.URL.Query().Get("pageNumber")
+	var err error
+	if len(pageNumberParam) > 0 {
+		pageNumber, err = strconv.ParseInt(pageNumberParam, 10, 64)
+		if err != nil {
+			c.errorHandler(w, r, &ParsingError{"pageNumber", err}, nil)
+			log.Error("ListAccountTokens", "requestId", requestId, "error", "invalid pageNumber")
+			return
+		}
+		if pageNumber <= 0 {
+			pageNumber = 1
+		}
+	}
+
+	log.Info("ListAccountTokens", "requestId", requestId, "addressParam", addressParam, "pageNumber", pageNumber)
+	result, err := c.service.ListAccountTokens(r.Context(), addressParam, pageNumber)
+	// If an error occurred, encode the error with the status code
+	if err != nil {
+		c.errorHandler(w, r, err, &result)
+		log.Error("ListAccountTokens", "requestId", requestId, "error", err)
+		return
+	}
+	// If no error, encode the body and the result code
+	_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+	log.Info("ListAccountTokens ok", "requestId", requestId)
+}
+
+// GetTokenHolders - Get the holder count of a token
+func (c *ReadApiAPIController) GetTokenHolders(w http.ResponseWriter, r *http.Request) {
+	requestId := ""
+	if r.Header != nil {
+		requestId = r.Header.Get(REQUEST_ID_HEADER_NAME)
+	}
+	if len(requestId) > 0 {
+		log.Info("GetTokenHolders", "requestId", requestId)
+	}
+
+	c.setupCORS(&w, r)
+	if (*r).Method == "OPTIONS" {
+		log.Info("GetTokenHolders OPTIONS", "requestId", requestId)
+		return
+	}
+
+	if c.authorize(r) == false {
+		result := Response(http.StatusUnauthorized, nil)
+		// If no error, encode the body and the result code
+		_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+		log.Error("GetTokenHolders", "requestId", requestId, "error", "Unauthorized")
+		c.errorHandler(w, r, errors.New("Unauthorized"), &result)
+		return
+	}
+
+	params := mux.Vars(r)
+	contractAddressParam := params["contractAddress"]
+	if contractAddressParam == "" {
+		c.errorHandler(w, r, &RequiredError{"contractAddress"}, nil)
+		log.Error("GetTokenHolders", "requestId", requestId, "error", "contractAddress is empty")
+		return
+	}
+
+	if !common.IsHexAddressDeep(contractAddressParam) {
+		log.Error(relay.MsgContractAddress, relay.MsgContractAddress, contractAddressParam, relay.MsgError, relay.ErrInvalidAddress, relay.MsgStatus, http.StatusBadRequest, "requestId", requestId)
+		c.errorHandler(w, r, &ParsingError{"contractAddress", errors.New("Invalid contractAddress")}, nil)
+		return
+	}
+
+	log.Info("GetTokenHolders", "requestId", requestId, "contractAddressParam", contractAddressParam)
+	result, err := c.service.GetTokenHolders(r.Context(), contractAddressParam)
+	// If an error occurred, encode the error with the status code
+	if err != nil {
+		c.errorHandler(w, r, err, &result)
+		log.Error("GetTokenHolders", "requestId", requestId, "error", err)
+		return
+	}
+	// If no error, encode the body and the result code
+	_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+	log.Info("GetTokenHolders ok", "requestId", requestId)
+}
+
+// ListValidators - List validators
+func (c *ReadApiAPIController) ListValidators(w http.ResponseWriter, r *http.Request) {
+	requestId := ""
+	if r.Header != nil {
+		requestId = r.Header.Get(REQUEST_ID_HEADER_NAME)
+	}
+	if len(requestId) > 0 {
+		log.Info("ListValidators", "requestId", requestId)
+	}
+
+	c.setupCORS(&w, r)
+	if (*r).Method == "OPTIONS" {
+		log.Info("ListValidators OPTIONS", "requestId", requestId)
+		return
+	}
+
+	if c.authorize(r) == false {
+		result := Response(http.StatusUnauthorized, nil)
+		// If no error, encode the body and the result code
+		_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+		log.Error("ListValidators", "requestId", requestId, "error", "Unauthorized")
+		c.errorHandler(w, r, errors.New("Unauthorized"), &result)
+		return
+	}
+
+	result, err := c.service.ListValidators(r.Context())
+	// If an error occurred, encode the error with the status code
+	if err != nil {
+		c.errorHandler(w, r, err, &result)
+		log.Error("ListValidators", "requestId", requestId, "error", err)
+		return
+	}
+	// If no error, encode the body and the result code
+	_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+	log.Info("ListValidators ok", "requestId", requestId)
+}
+
+// GetStakingDetails - Get the staking details of a depositor or validator
+func (c *ReadApiAPIController) GetStakingDetails(w http.ResponseWriter, r *http.Request) {
+	requestId := ""
+	if r.Header != nil {
+		requestId = r.Header.Get(REQUEST_ID_HEADER_NAME)
+	}
+	if len(requestId) > 0 {
+		log.Info("GetStakingDetails", "requestId", requestId)
+	}
+
+	c.setupCORS(&w, r)
+	if (*r).Method == "OPTIONS" {
+		log.Info("GetStakingDetails OPTIONS", "requestId", requestId)
+		return
+	}
+
+	if c.authorize(r) == false {
+		result := Response(http.StatusUnauthorized, nil)
+		// If no error, encode the body and the result code
+		_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+		log.Error("GetStakingDetails", "requestId", requestId, "error", "Unauthorized")
+		c.errorHandler(w, r, errors.New("Unauthorized"), &result)
+		return
+	}
+
+	params := mux.Vars(r)
+	addressParam := params["address"]
+	if addressParam == "" {
+		c.errorHandler(w, r, &RequiredError{"address"}, nil)
+		log.Error("GetStakingDetails", "requestId", requestId, "error", "address is empty")
+		return
+	}
+
+	if !common.IsHexAddressDeep(addressParam) {
+		log.Error(relay.MsgAddress, relay.MsgAddress, addressParam, relay.MsgError, relay.ErrInvalidAddress, relay.MsgStatus, http.StatusBadRequest, "requestId", requestId)
+		c.errorHandler(w, r, &ParsingError{"address", errors.New("Invalid address")}, nil)
+		return
+	}
+
+	log.Info("GetStakingDetails", "requestId", requestId, "addressParam", addressParam)
+	result, err := c.service.GetStakingDetails(r.Context(), addressParam)
+	// If an error occurred, encode the error with the status code
+	if err != nil {
+		c.errorHandler(w, r, err, &result)
+		log.Error("GetStakingDetails", "requestId", requestId, "error", err)
+		return
+	}
+	// If no error, encode the body and the result code
+	_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+	log.Info("GetStakingDetails ok", "requestId", requestId)
+}
+
+// GetBlockStakingDetails - Get the proposer and rewards of a block
+func (c *ReadApiAPIController) GetBlockStakingDetails(w http.ResponseWriter, r *http.Request) {
+	requestId := ""
+	if r.Header != nil {
+		requestId = r.Header.Get(REQUEST_ID_HEADER_NAME)
+	}
+	if len(requestId) > 0 {
+		log.Info("GetBlockStakingDetails", "requestId", requestId)
+	}
+
+	c.setupCORS(&w, r)
+	if (*r).Method == "OPTIONS" {
+		log.Info("GetBlockStakingDetails OPTIONS", "requestId", requestId)
+		return
+	}
+
+	if c.authorize(r) == false {
+		result := Response(http.StatusUnauthorized, nil)
+		// If no error, encode the body and the result code
+		_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+		log.Error("GetBlockStakingDetails", "requestId", requestId, "error", "Unauthorized")
+		c.errorHandler(w, r, errors.New("Unauthorized"), &result)
+		return
+	}
+
+	params := mux.Vars(r)
+	blockNumber, err := strconv.ParseInt(params["blockNumber"], 10, 64)
+	if err != nil || blockNumber < 0 {
+		c.errorHandler(w, r, &ParsingError{"blockNumber", errors.New("Invalid blockNumber")}, nil)
+		log.Error("GetBlockStakingDetails", "requestId", requestId, "error", "invalid blockNumber")
+		return
+	}
+
+	log.Info("GetBlockStakingDetails", "requestId", requestId, "blockNumber", blockNumber)
+	result, err := c.service.GetBlockStakingDetails(r.Context(), blockNumber)
+	// If an error occurred, encode the error with the status code
+	if err != nil {
+		c.errorHandler(w, r, err, &result)
+		log.Error("GetBlockStakingDetails", "requestId", requestId, "error", err)
+		return
+	}
+	// If no error, encode the body and the result code
+	_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+	log.Info("GetBlockStakingDetails ok", "requestId", requestId)
+}
+
+// GetValidatorStats - Get validator participation statistics
+func (c *ReadApiAPIController) GetValidatorStats(w http.ResponseWriter, r *http.Request) {
+	requestId := ""
+	if r.Header != nil {
+		requestId = r.Header.Get(REQUEST_ID_HEADER_NAME)
+	}
+	if len(requestId) > 0 {
+		log.Info("GetValidatorStats", "requestId", requestId)
+	}
+
+	c.setupCORS(&w, r)
+	if (*r).Method == "OPTIONS" {
+		log.Info("GetValidatorStats OPTIONS", "requestId", requestId)
+		return
+	}
+
+	if c.authorize(r) == false {
+		result := Response(http.StatusUnauthorized, nil)
+		// If no error, encode the body and the result code
+		_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+		log.Error("GetValidatorStats", "requestId", requestId, "error", "Unauthorized")
+		c.errorHandler(w, r, errors.New("Unauthorized"), &result)
+		return
+	}
+
+	params := mux.Vars(r)
+	addressParam := params["address"]
+	if addressParam == "" {
+		c.errorHandler(w, r, &RequiredError{"address"}, nil)
+		log.Error("GetValidatorStats", "requestId", requestId, "error", "address is empty")
+		return
+	}
+
+	if !common.IsHexAddressDeep(addressParam) {
+		log.Error(relay.MsgAddress, relay.MsgAddress, addressParam, relay.MsgError, relay.ErrInvalidAddress, relay.MsgStatus, http.StatusBadRequest, "requestId", requestId)
+		c.errorHandler(w, r, &ParsingError{"address", errors.New("Invalid address")}, nil)
+		return
+	}
+
+	fromBlock, err := strconv.ParseInt(params["fromBlock"], 10, 64)
+	if err != nil || fromBlock < 0 {
+		c.errorHandler(w, r, &ParsingError{"fromBlock", relay.ErrInvalidRange}, nil)
+		log.Error("GetValidatorStats", "requestId", requestId, "error", "invalid fromBlock")
+		return
+	}
+
+	toBlock, err := strconv.ParseInt(params["toBlock"], 10, 64)
+	if err != nil || toBlock < fromBlock {
+		c.errorHandler(w, r, &ParsingError{"toBlock", relay.ErrInvalidRange}, nil)
+		log.Error("GetValidatorStats", "requestId", requestId, "error", "invalid toBlock")
+		return
+	}
+
+	log.Info("GetValidatorStats", "requestId", requestId, "addressParam", addressParam, "fromBlock", fromBlock, "toBlock", toBlock)
+	result, err := c.service.GetValidatorStats(r.Context(), addressParam, fromBlock, toBlock)
+	// If an error occurred, encode the error with the status code
+	if err != nil {
+		c.errorHandler(w, r, err, &result)
+		log.Error("GetValidatorStats", "requestId", requestId, "error", err)
+		return
+	}
+	// If no error, encode the body and the result code
+	_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+	log.Info("GetValidatorStats ok", "requestId", requestId)
+}
@@ -0,0 +1,166 @@
+/*
+ * QC Read API
+ *
+ * API version: v1
+ */
+
+package qcreadapi
+
+import (
+	"context"
+	"errors"
+	"github.com/QuantumCoinProject/qc/cachemanager"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/relay"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers of account exports, set to the block range of the export
+const (
+	ExportFromBlockHeader = "X-Export-From-Block"
+	ExportToBlockHeader   = "X-Export-To-Block"
+)
+
+// parseExportQuery parses the fromBlock, toBlock, fromDate and toDate query
+// parameters of an account export.
+func parseExportQuery(r *http.Request) (cachemanager.ExportQuery, error) {
+	var query cachemanager.ExportQuery
+	values := r.URL.Query()
+	for _, param := range []struct {
+		name  string
+		block **uint64
+	}{{"fromBlock", &query.FromBlock}, {"toBlock", &query.ToBlock}} {
+		if value := values.Get(param.name); len(value) > 0 {
+			number, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return query, &ParsingError{param.name, relay.ErrInvalidRange}
+			}
+			*param.block = &number
+		}
+	}
+	for _, param := range []struct {
+		name string
+		date **time.Time
+	}{{"fromDate", &query.FromDate}, {"toDate", &query.ToDate}} {
+		if value := values.Get(param.name); len(value) > 0 {
+			date, err := time.Parse(cachemanager.ExportDateLayout, value)
+			if err != nil {
+				return query, &ParsingError{param.name, err}
+			}
+			*param.date = &date
+		}
+	}
+	return query, nil
+}
+
+// ExportAccountHistory - Export the history of an account as CSV or JSON lines
+func (c *ReadApiAPIController) ExportAccountHistory(w http.ResponseWriter, r *http.Request) {
+	requestId := r.Header.Get(REQUEST_ID_HEADER_NAME)
+
+	c.setupCORS(&w, r)
+	if (*r).Method == "OPTIONS" {
+		return
+	}
+
+	if c.authorize(r) == false {
+		result := Response(http.StatusUnauthorized, nil)
+		log.Error("ExportAccountHistory", "requestId", requestId, "error", "Unauthorized")
+		c.errorHandler(w, r, errors.New("Unauthorized"), &result)
+		return
+	}
+
+	addressParam := mux.Vars(r)["address"]
+	if !common.IsHexAddressDeep(addressParam) {
+		log.Error(relay.MsgAddress, relay.MsgAddress, addressParam, relay.MsgError, relay.ErrInvalidAddress, relay.MsgStatus, http.StatusBadRequest, "requestId", requestId)
+		c.errorHandler(w, r, &ParsingError{"address", errors.New("Invalid address")}, nil)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if len(format) == 0 {
+		format = cachemanager.ExportFormatCsv
+	}
+	contentType := "text/csv; charset=UTF-8"
+	if format == cachemanager.ExportFormatJsonLines {
+		contentType = "application/x-ndjson"
+	} else if format != cachemanager.ExportFormatCsv {
+		c.errorHandler(w, r, &ParsingError{"format", cachemanager.ErrExportFormat}, nil)
+		return
+	}
+
+	query, err := parseExportQuery(r)
+	if err != nil {
+		c.errorHandler(w, r, err, nil)
+		log.Error("ExportAccountHistory", "requestId", requestId, "error", err)
+		return
+	}
+	exportRange, err := c.service.ResolveExportRange(r.Context(), query)
+	if err != nil {
+		result := Response(http.StatusInternalServerError, nil)
+		if errors.Is(err, cachemanager.ErrExportRange) {
+			result = Response(http.StatusBadRequest, nil)
+		}
+		c.errorHandler(w, r, err, &result)
+		log.Error("ExportAccountHistory", "requestId", requestId, "error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename="+addressParam+"-"+strconv.FormatUint(exportRange.FromBlock, 10)+"-"+strconv.FormatUint(exportRange.ToBlock, 10)+"."+format)
+	w.Header().Set(ExportFromBlockHeader, strconv.FormatUint(exportRange.FromBlock, 10))
+	w.Header().Set(ExportToBlockHeader, strconv.FormatUint(exportRange.ToBlock, 10))
+	writer, err := cachemanager.NewExportWriter(w, format)
+	if err != nil {
+		c.errorHandler(w, r, err, nil)
+		return
+	}
+
+	log.Info("ExportAccountHistory", "requestId", requestId, "address", addressParam, "fromBlock", exportRange.FromBlock, "toBlock", exportRange.ToBlock)
+	err = c.service.ExportAccount(r.Context(), addressParam, exportRange, writer.Write)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		// The status is already sent, the connection is aborted so that the
+		// client does not take the export for complete
+		log.Error("ExportAccountHistory", "requestId", requestId, "error", err)
+		panic(http.ErrAbortHandler)
+	}
+	log.Info("ExportAccountHistory ok", "requestId", requestId)
+}
+
+// ResolveExportRange returns the block range of an account export
+func (s *ReadApiAPIService) ResolveExportRange(ctx context.Context, query cachemanager.ExportQuery) (cachemanager.ExportRange, error) {
+	return s.cacheManager.ResolveExportRange(ctx, query)
+}
+
+// ExportAccount writes the history of an account in an export range
+func (s *ReadApiAPIService) ExportAccount(ctx context.Context, address string, exportRange cachemanager.ExportRange, write func(*cachemanager.ExportEntry) error) error {
+	startTime := time.Now()
+
+	log.Info(relay.InfoTitleExportAccount, relay.MsgAddress, address)
+
+	if !common.IsHexAddressDeep(address) {
+		return relay.ErrInvalidAddress
+	}
+
+	count := 0
+	err := s.cacheManager.ExportAccount(ctx, common.HexToAddress(address), exportRange, func(entry *cachemanager.ExportEntry) error {
+		count++
+		return write(entry)
+	})
+	if err != nil {
+		log.Error(relay.InfoTitleExportAccount, relay.MsgAddress, address, relay.MsgError, err)
+		return err
+	}
+
+	duration := time.Now().Sub(startTime)
+
+	log.Info(relay.InfoTitleExportAccount, relay.MsgAddress, address, "entries", count, relay.MsgTimeDuration, duration, relay.MsgStatus, http.StatusOK)
+
+	return nil
+}
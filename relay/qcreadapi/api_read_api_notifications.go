@@ -0,0 +1,460 @@
+/*
+ * QC Read API
+ *
+ * API version: v1
+ */
+
+package qcreadapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/QuantumCoinProject/qc/cachemanager"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/event"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/relay"
+	"github.com/QuantumCoinProject/qc/relay/apikeys"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxSubscriptionAddresses is the maximum number of addresses of a subscription.
+	MaxSubscriptionAddresses = 1000
+
+	streamQueueSize    = 1024
+	streamPingInterval = 30 * time.Second
+	streamWriteTimeout = 10 * time.Second
+)
+
+var errStreamOverflow = errors.New("client is not reading events fast enough")
+
+// eventFilter selects the events sent to a subscriber. Block events are sent if
+// their type is selected, account events if their type is selected and, when
+// addresses are given, the account is one of them.
+type eventFilter struct {
+	types     map[cachemanager.EventType]bool
+	addresses map[string]bool
+}
+
+// parseEventFilter parses the comma separated "events" and "address" query
+// parameters. The address parameter can also be repeated.
+func parseEventFilter(r *http.Request) (*eventFilter, error) {
+	filter := &eventFilter{
+		types:     make(map[cachemanager.EventType]bool),
+		addresses: make(map[string]bool),
+	}
+	query := r.URL.Query()
+	if events := query.Get("events"); len(events) > 0 {
+		for _, e := range strings.Split(events, ",") {
+			if cachemanager.IsValidEventType(e) == false {
+				return nil, &ParsingError{"events", fmt.Errorf("invalid event type %s", e)}
+			}
+			filter.types[cachemanager.EventType(e)] = true
+		}
+	} else {
+		for _, e := range cachemanager.AllEventTypes {
+			filter.types[e] = true
+		}
+	}
+	for _, param := range query["address"] {
+		for _, address := range strings.Split(param, ",") {
+			if common.IsHexAddressDeep(address) == false {
+				return nil, &ParsingError{"address", errors.New("Invalid address")}
+			}
+			filter.addresses[strings.ToLower(common.HexToAddress(address).Hex())] = true
+		}
+	}
+	if len(filter.addresses) > MaxSubscriptionAddresses {
+		return nil, &ParsingError{"address", fmt.Errorf("more than %d addresses", MaxSubscriptionAddresses)}
+	}
+	return filter, nil
+}
+
+func (f *eventFilter) matches(ev *cachemanager.Event) bool {
+	if f.types[ev.Type] == false {
+		return false
+	}
+	if len(ev.Address) == 0 || len(f.addresses) == 0 {
+		return true
+	}
+	return f.addresses[ev.Address]
+}
+
+// authorizeStream also accepts the api key as the apiKey query parameter, since
+// browsers cannot set headers on WebSocket and EventSource requests.
+func (c *ReadApiAPIController) authorizeStream(r *http.Request) bool {
+	if c.authorize(r) {
+		return true
+	}
+	return c.keys.Authorize(r.URL.Query().Get(apikeys.ApiKeyParam))
+}
+
+// streamEvents sends the events matching the filter until send fails or done is
+// closed. Events are queued so that a slow client does not hold up the indexer;
+// a client falling behind by more than streamQueueSize events is disconnected.
+func (c *ReadApiAPIController) streamEvents(filter *eventFilter, done <-chan struct{}, send func(*cachemanager.Event) error, ping func() error) error {
+	events := make(chan *cachemanager.Event, 256)
+	sub := c.service.SubscribeEvents(events)
+	defer sub.Unsubscribe()
+
+	queue := make(chan *cachemanager.Event, streamQueueSize)
+	overflow := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case ev := <-events:
+				if filter.matches(ev) == false {
+					continue
+				}
+				select {
+				case queue <- ev:
+				default:
+					close(overflow)
+					return
+				}
+			case <-sub.Err():
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	pings := time.NewTicker(streamPingInterval)
+	defer pings.Stop()
+	for {
+		select {
+		case ev := <-queue:
+			if err := send(ev); err != nil {
+				return err
+			}
+		case <-pings.C:
+			if err := ping(); err != nil {
+				return err
+			}
+		case <-overflow:
+			return errStreamOverflow
+		case <-done:
+			return nil
+		}
+	}
+}
+
+// SubscribeEvents - Subscribe to events over a WebSocket connection
+func (c *ReadApiAPIController) SubscribeEvents(w http.ResponseWriter, r *http.Request) {
+	requestId := r.Header.Get(REQUEST_ID_HEADER_NAME)
+
+	if c.authorizeStream(r) == false {
+		result := Response(http.StatusUnauthorized, nil)
+		log.Error("SubscribeEvents", "requestId", requestId, "error", "Unauthorized")
+		c.errorHandler(w, r, errors.New("Unauthorized"), &result)
+		return
+	}
+
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		c.errorHandler(w, r, err, nil)
+		log.Error("SubscribeEvents", "requestId", requestId, "error", err)
+		return
+	}
+
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return len(origin) == 0 || c.corsAllowedOrigins == "*" || origin == c.corsAllowedOrigins
+		},
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Error("SubscribeEvents", "requestId", requestId, "error", err)
+		return
+	}
+	defer conn.Close()
+
+	// Messages from the client are not used, reading detects the closed connection
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	log.Info("SubscribeEvents", "requestId", requestId, "addresses", len(filter.addresses))
+	err = c.streamEvents(filter, done, func(ev *cachemanager.Event) error {
+		conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		return conn.WriteJSON(ev)
+	}, func() error {
+		return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout))
+	})
+	if err != nil {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, err.Error()), time.Now().Add(streamWriteTimeout))
+		log.Warn("SubscribeEvents closed", "requestId", requestId, "error", err)
+		return
+	}
+	log.Info("SubscribeEvents closed", "requestId", requestId)
+}
+
+// StreamEvents - Subscribe to events as Server-Sent Events
+func (c *ReadApiAPIController) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	requestId := r.Header.Get(REQUEST_ID_HEADER_NAME)
+
+	c.setupCORS(&w, r)
+	if (*r).Method == "OPTIONS" {
+		return
+	}
+
+	if c.authorizeStream(r) == false {
+		result := Response(http.StatusUnauthorized, nil)
+		log.Error("StreamEvents", "requestId", requestId, "error", "Unauthorized")
+		c.errorHandler(w, r, errors.New("Unauthorized"), &result)
+		return
+	}
+
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		c.errorHandler(w, r, err, nil)
+		log.Error("StreamEvents", "requestId", requestId, "error", err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if ok == false {
+		result := Response(http.StatusInternalServerError, nil)
+		c.errorHandler(w, r, errors.New("streaming not supported"), &result)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	log.Info("StreamEvents", "requestId", requestId, "addresses", len(filter.addresses))
+	err = c.streamEvents(filter, r.Context().Done(), func(ev *cachemanager.Event) error {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", ev.Id, ev.Type, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}, func() error {
+		if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+	if err != nil {
+		log.Warn("StreamEvents closed", "requestId", requestId, "error", err)
+		return
+	}
+	log.Info("StreamEvents closed", "requestId", requestId)
+}
+
+// RegisterWebhook - Register a webhook
+func (c *ReadApiAPIController) RegisterWebhook(w http.ResponseWriter, r *http.Request) {
+	requestId := r.Header.Get(REQUEST_ID_HEADER_NAME)
+
+	c.setupCORS(&w, r)
+	if (*r).Method == "OPTIONS" {
+		return
+	}
+
+	if c.authorize(r) == false {
+		result := Response(http.StatusUnauthorized, nil)
+		log.Error("RegisterWebhook", "requestId", requestId, "error", "Unauthorized")
+		c.errorHandler(w, r, errors.New("Unauthorized"), &result)
+		return
+	}
+
+	webhookRequestParam := WebhookRequest{}
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&webhookRequestParam); err != nil && !errors.Is(err, io.EOF) {
+		c.errorHandler(w, r, &ParsingError{Err: err, Param: "webhook"}, nil)
+		log.Error("RegisterWebhook", "requestId", requestId, "error", err)
+		return
+	}
+	if err := AssertWebhookRequestRequired(webhookRequestParam); err != nil {
+		c.errorHandler(w, r, err, nil)
+		log.Error("RegisterWebhook", "requestId", requestId, "error", err)
+		return
+	}
+
+	result, err := c.service.RegisterWebhook(r.Context(), webhookRequestParam)
+	if err != nil {
+		c.errorHandler(w, r, err, &result)
+		log.Error("RegisterWebhook", "requestId", requestId, "error", err)
+		return
+	}
+	_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+	log.Info("RegisterWebhook ok", "requestId", requestId)
+}
+
+// AddWebhookAddresses - Add addresses to a webhook
+func (c *ReadApiAPIController) AddWebhookAddresses(w http.ResponseWriter, r *http.Request) {
+	requestId := r.Header.Get(REQUEST_ID_HEADER_NAME)
+
+	c.setupCORS(&w, r)
+	if (*r).Method == "OPTIONS" {
+		return
+	}
+
+	if c.authorize(r) == false {
+		result := Response(http.StatusUnauthorized, nil)
+		log.Error("AddWebhookAddresses", "requestId", requestId, "error", "Unauthorized")
+		c.errorHandler(w, r, errors.New("Unauthorized"), &result)
+		return
+	}
+
+	addressesParam := WebhookAddressesRequest{}
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&addressesParam); err != nil && !errors.Is(err, io.EOF) {
+		c.errorHandler(w, r, &ParsingError{Err: err, Param: "addresses"}, nil)
+		log.Error("AddWebhookAddresses", "requestId", requestId, "error", err)
+		return
+	}
+	if err := AssertWebhookAddressesRequestRequired(addressesParam); err != nil {
+		c.errorHandler(w, r, err, nil)
+		log.Error("AddWebhookAddresses", "requestId", requestId, "error", err)
+		return
+	}
+
+	result, err := c.service.AddWebhookAddresses(r.Context(), mux.Vars(r)["id"], addressesParam)
+	if err != nil {
+		c.errorHandler(w, r, err, &result)
+		log.Error("AddWebhookAddresses", "requestId", requestId, "error", err)
+		return
+	}
+	_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+	log.Info("AddWebhookAddresses ok", "requestId", requestId)
+}
+
+// GetWebhook - Get a webhook
+func (c *ReadApiAPIController) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	requestId := r.Header.Get(REQUEST_ID_HEADER_NAME)
+
+	c.setupCORS(&w, r)
+	if (*r).Method == "OPTIONS" {
+		return
+	}
+
+	if c.authorize(r) == false {
+		result := Response(http.StatusUnauthorized, nil)
+		log.Error("GetWebhook", "requestId", requestId, "error", "Unauthorized")
+		c.errorHandler(w, r, errors.New("Unauthorized"), &result)
+		return
+	}
+
+	result, err := c.service.GetWebhook(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		c.errorHandler(w, r, err, &result)
+		log.Error("GetWebhook", "requestId", requestId, "error", err)
+		return
+	}
+	_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+	log.Info("GetWebhook ok", "requestId", requestId)
+}
+
+// DeleteWebhook - Delete a webhook
+func (c *ReadApiAPIController) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	requestId := r.Header.Get(REQUEST_ID_HEADER_NAME)
+
+	c.setupCORS(&w, r)
+	if (*r).Method == "OPTIONS" {
+		return
+	}
+
+	if c.authorize(r) == false {
+		result := Response(http.StatusUnauthorized, nil)
+		log.Error("DeleteWebhook", "requestId", requestId, "error", "Unauthorized")
+		c.errorHandler(w, r, errors.New("Unauthorized"), &result)
+		return
+	}
+
+	result, err := c.service.DeleteWebhook(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		c.errorHandler(w, r, err, &result)
+		log.Error("DeleteWebhook", "requestId", requestId, "error", err)
+		return
+	}
+	_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+	log.Info("DeleteWebhook ok", "requestId", requestId)
+}
+
+// SubscribeEvents - Subscribe to the events of the cache indexer
+func (s *ReadApiAPIService) SubscribeEvents(ch chan<- *cachemanager.Event) event.Subscription {
+	return s.cacheManager.SubscribeEvents(ch)
+}
+
+func webhookErrorResponse(err error) ImplResponse {
+	switch {
+	case errors.Is(err, cachemanager.ErrWebhookNotFound):
+		return Response(http.StatusNotFound, nil)
+	case errors.Is(err, cachemanager.ErrWebhookUrl), errors.Is(err, cachemanager.ErrWebhookEvent), errors.Is(err, cachemanager.ErrWebhookAddress):
+		return Response(http.StatusBadRequest, nil)
+	}
+	return Response(http.StatusInternalServerError, nil)
+}
+
+// RegisterWebhook - Register a webhook
+func (s *ReadApiAPIService) RegisterWebhook(ctx context.Context, request WebhookRequest) (ImplResponse, error) {
+	log.Info(relay.InfoTitleRegisterWebhook, "url", request.Url, "addresses", len(request.Addresses))
+
+	hook, err := s.cacheManager.RegisterWebhook(request.Url, request.Addresses, request.Events)
+	if err != nil {
+		return webhookErrorResponse(err), err
+	}
+	return Response(http.StatusOK, hook), nil
+}
+
+// AddWebhookAddresses - Add addresses to a webhook
+func (s *ReadApiAPIService) AddWebhookAddresses(ctx context.Context, id string, request WebhookAddressesRequest) (ImplResponse, error) {
+	log.Info(relay.InfoTitleWebhook, "id", id, "addresses", len(request.Addresses))
+
+	hook, err := s.cacheManager.AddWebhookAddresses(id, request.Addresses)
+	if err != nil {
+		return webhookErrorResponse(err), err
+	}
+	return Response(http.StatusOK, hook), nil
+}
+
+// GetWebhook - Get a webhook
+func (s *ReadApiAPIService) GetWebhook(ctx context.Context, id string) (ImplResponse, error) {
+	log.Info(relay.InfoTitleWebhook, "id", id)
+
+	hook, err := s.cacheManager.GetWebhook(id)
+	if err != nil {
+		return webhookErrorResponse(err), err
+	}
+	return Response(http.StatusOK, hook), nil
+}
+
+// DeleteWebhook - Delete a webhook
+func (s *ReadApiAPIService) DeleteWebhook(ctx context.Context, id string) (ImplResponse, error) {
+	log.Info(relay.InfoTitleWebhook, "id", id, "delete", true)
+
+	if err := s.cacheManager.DeleteWebhook(id); err != nil {
+		return webhookErrorResponse(err), err
+	}
+	return Response(http.StatusOK, nil), nil
+}
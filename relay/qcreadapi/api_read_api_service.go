@@ -20,7 +20,7 @@ import (
 	"github.com/QuantumCoinProject/qc/relay"
 	"github.com/QuantumCoinProject/qc/common"
 	"github.com/QuantumCoinProject/qc/common/hexutil"
-	"github.com/QuantumCoinProject/qc/rpc"
+	"github.com/QuantumCoinProject/qc/relay/upstream"
 	"github.com/QuantumCoinProject/qc/cachemanager"
 	"math/big"
 	"net/http"
@@ -35,7 +35,7 @@ import (
 // This service should implement the business logic for every endpoint for the ReadApiAPI API.
 // Include any external packages or services that will be required by this service.
 type ReadApiAPIService struct {
-  DpUrl string
+  upstreams *upstream.Pool
   cacheManager *cachemanager.CacheManager
 	enableExtendedApis bool
 }
@@ -56,11 +56,23 @@ type RPCTransaction struct {
 	Type             hexutil.Uint64    `json:"type"`
 }
 
+type RPCValidatorStats struct {
+	Validator        common.Address `json:"validator"`
+	FromBlock        hexutil.Uint64 `json:"fromBlock"`
+	ToBlock          hexutil.Uint64 `json:"toBlock"`
+	BlockCount       hexutil.Uint64 `json:"blockCount"`
+	ProposalsMade    hexutil.Uint64 `json:"proposalsMade"`
+	ProposalsMissed  hexutil.Uint64 `json:"proposalsMissed"`
+	VotesSigned      hexutil.Uint64 `json:"votesSigned"`
+	Slashes          hexutil.Uint64 `json:"slashes"`
+	UptimePercentage float64        `json:"uptimePercentage"`
+}
+
 // NewReadApiAPIService creates a default api service
-func NewReadApiAPIService(dpUrl string, cacheManager *cachemanager.CacheManager,enableExtendedApis bool) (*ReadApiAPIService, error) {
+func NewReadApiAPIService(upstreams *upstream.Pool, cacheManager *cachemanager.CacheManager,enableExtendedApis bool) (*ReadApiAPIService, error) {
 	log.Root().SetHandler(log.LvlFilterHandler(log.Lvl(3), log.StreamHandler(colorable.NewColorableStderr(), log.TerminalFormat(true))))
 	return &ReadApiAPIService{
-		DpUrl: dpUrl,
+		upstreams: upstreams,
 		cacheManager: cacheManager,
 		enableExtendedApis: enableExtendedApis,
 	}, nil
@@ -71,14 +83,10 @@ func (s *ReadApiAPIService) GetLatestBlockDetails(ctx context.Context) (ImplResp
 
 	startTime := time.Now()
 
-	log.Info(relay.InfoTitleLatestBlockDetails, relay.MsgDial, s.DpUrl)
+	log.Info(relay.InfoTitleLatestBlockDetails, relay.MsgDial, s.upstreams.Best().Url)
 
-	client, err := rpc.Dial(s.DpUrl)
-	if err != nil {
-		log.Error(relay.MsgDial, relay.MsgError, "errors.New(err.Error())", relay.MsgStatus, http.StatusInternalServerError)
-		return Response(http.StatusInternalServerError, nil), errors.New(err.Error())
-	}
-	defer client.Close()
+	client := s.upstreams
+	var err error
 
 	var blockNumber *hexutil.Uint64
 	err = client.CallContext(ctx, &blockNumber, "eth_blockNumber")
@@ -105,14 +113,10 @@ func (s *ReadApiAPIService) GetAccountDetails(ctx context.Context, address strin
 
 	startTime := time.Now()
 
-	log.Info(relay.InfoTitleAccountDetails, relay.MsgDial, s.DpUrl)
+	log.Info(relay.InfoTitleAccountDetails, relay.MsgDial, s.upstreams.Best().Url)
 
-	client, err := rpc.Dial(s.DpUrl)
-	if err != nil {
-		log.Error(relay.MsgDial, relay.MsgError, errors.New(err.Error()), relay.MsgStatus, http.StatusInternalServerError)
-		return Response(http.StatusInternalServerError, nil), errors.New(err.Error())
-	}
-	defer client.Close()
+	client := s.upstreams
+	var err error
 
 	if !common.IsHexAddressDeep(address) {
 		log.Error(relay.MsgAddress, relay.MsgAddress, address, relay.MsgError, relay.ErrInvalidAddress, relay.MsgStatus, http.StatusBadRequest)
@@ -176,14 +180,10 @@ func (s *ReadApiAPIService) GetTransactionDetails(ctx context.Context, hash stri
 	startTime := time.Now()
 	isDiscarded := false
 	discardReason := ""
-	log.Info(relay.InfoTitleTransaction, relay.MsgDial, s.DpUrl)
+	log.Info(relay.InfoTitleTransaction, relay.MsgDial, s.upstreams.Best().Url)
 
-	client, err := rpc.Dial(s.DpUrl)
-	if err != nil {
-		log.Error(relay.MsgDial,relay.MsgError, errors.New(err.Error()), relay.MsgStatus, http.StatusInternalServerError)
-		return Response(http.StatusInternalServerError, nil), errors.New(err.Error())
-	}
-	defer client.Close()
+	client := s.upstreams
+	var err error
 
 	if !common.IsHexAddressDeep(hash)  {
 		log.Error(relay.MsgHash, relay.MsgHash, hash, relay.MsgError, relay.ErrInvalidHash, relay.MsgStatus, http.StatusBadRequest)
@@ -415,7 +415,7 @@ func (s *ReadApiAPIService) GetAccountTokenDetails(ctx context.Context, address
 
 	startTime := time.Now()
 
-	log.Info(relay.InfoTitleAccountDetails, relay.MsgDial, s.DpUrl)
+	log.Info(relay.InfoTitleAccountDetails, relay.MsgDial, s.upstreams.Best().Url)
 
 	if !common.IsHexAddressDeep(address) {
 		log.Error(relay.MsgAddress, relay.MsgAddress, address, relay.MsgError, relay.ErrInvalidAddress, relay.MsgStatus, http.StatusBadRequest)
@@ -427,17 +427,10 @@ func (s *ReadApiAPIService) GetAccountTokenDetails(ctx context.Context, address
 		return Response(http.StatusBadRequest, nil), relay.ErrInvalidAddress
 	}
 
-	var client *ethclient.Client
-
-	client, err := ethclient.Dial(s.DpUrl)
-	if err != nil {
-		log.Error(relay.MsgDial, relay.MsgError, errors.New(err.Error()), relay.MsgStatus, http.StatusInternalServerError)
-		return Response(http.StatusInternalServerError, nil), errors.New(err.Error())
-	}
-	defer client.Close()
+	client := ethclient.NewClient(s.upstreams.Client())
 
 	var balance *big.Int
-	balance, err = client.GetAccountTokenBalance(common.HexToAddress(contractAddress), common.HexToAddress(address))
+	balance, err := client.GetAccountTokenBalance(common.HexToAddress(contractAddress), common.HexToAddress(address))
 	if err != nil {
 		log.Error("GetTokenBalance", relay.MsgError, errors.New(err.Error()), relay.MsgStatus, http.StatusInternalServerError)
 		return Response(http.StatusInternalServerError, nil), errors.New(err.Error())
@@ -464,7 +457,7 @@ func (s *ReadApiAPIService) GetAccountTokenDetails(ctx context.Context, address
 func (s *ReadApiAPIService) GetTokenDetails(ctx context.Context, contractAddress string) (ImplResponse, error) {
 	startTime := time.Now()
 
-	log.Info(relay.InfoTitleAccountDetails, relay.MsgDial, s.DpUrl)
+	log.Info(relay.InfoTitleAccountDetails, relay.MsgDial, s.upstreams.Best().Url)
 
 	if !common.IsHexAddressDeep(contractAddress) {
 		log.Error(relay.MsgContractAddress, relay.MsgContractAddress, contractAddress, relay.MsgError, relay.ErrInvalidAddress, relay.MsgStatus, http.StatusBadRequest)
@@ -515,4 +508,182 @@ func (s *ReadApiAPIService) GetTokenDetails(ctx context.Context, contractAddress
 	log.Info(relay.InfoTitleTokenDetails, relay.MsgAddress, contractAddress, relay.MsgTimeDuration, duration, relay.MsgStatus, http.StatusOK)
 
 	return Response(http.StatusOK, tokenDetailsResponse), nil
-}
\ No newline at end of file
+}
+
+// ListAccountTokens - List the tokens held by an account
+func (s *ReadApiAPIService) ListAccountTokens(ctx context.Context, address string, pageNumber int64) (ImplResponse, error) {
+	startTime := time.Now()
+
+	log.Info(relay.InfoTitleListAccountTokens)
+
+	if !common.IsHexAddressDeep(address) {
+		log.Error(relay.MsgAddress, relay.MsgAddress, address, relay.MsgError, relay.ErrInvalidAddress, relay.MsgStatus, http.StatusBadRequest)
+		return Response(http.StatusBadRequest, nil), relay.ErrInvalidAddress
+	}
+
+	listResponse, err := s.cacheManager.ListTokensByAccount(common.HexToAddress(address), pageNumber)
+	if err != nil {
+		return Response(http.StatusInternalServerError, nil), errors.New("Internal Server Error")
+	}
+
+	duration := time.Now().Sub(startTime)
+
+	log.Info(relay.InfoTitleListAccountTokens, relay.MsgAddress, address, relay.MsgTimeDuration, duration, relay.MsgStatus, http.StatusOK)
+
+	return Response(http.StatusOK, listResponse), nil
+}
+
+// GetTokenHolders - Get the holder count of a token
+func (s *ReadApiAPIService) GetTokenHolders(ctx context.Context, contractAddress string) (ImplResponse, error) {
+	startTime := time.Now()
+
+	log.Info(relay.InfoTitleTokenHolders)
+
+	if !common.IsHexAddressDeep(contractAddress) {
+		log.Error(relay.MsgContractAddress, relay.MsgContractAddress, contractAddress, relay.MsgError, relay.ErrInvalidAddress, relay.MsgStatus, http.StatusBadRequest)
+		return Response(http.StatusBadRequest, nil), relay.ErrInvalidAddress
+	}
+
+	holdersResponse, err := s.cacheManager.GetTokenHolders(contractAddress)
+	if err != nil {
+		return Response(http.StatusInternalServerError, nil), errors.New("Internal Server Error")
+	}
+
+	duration := time.Now().Sub(startTime)
+
+	log.Info(relay.InfoTitleTokenHolders, relay.MsgContractAddress, contractAddress, relay.MsgTimeDuration, duration, relay.MsgStatus, http.StatusOK)
+
+	return Response(http.StatusOK, holdersResponse), nil
+}
+
+// ListValidators - List validators
+func (s *ReadApiAPIService) ListValidators(ctx context.Context) (ImplResponse, error) {
+	startTime := time.Now()
+
+	log.Info(relay.InfoTitleListValidators)
+
+	if s.enableExtendedApis == false {
+		return Response(http.StatusNotFound, nil), errors.New("Not Found")
+	}
+
+	validatorsResponse, err := s.cacheManager.ListValidators()
+	if err != nil {
+		if errors.Is(err, cachemanager.ErrValidatorsNotFound) {
+			return Response(http.StatusNotFound, nil), err
+		}
+		return Response(http.StatusInternalServerError, nil), errors.New("Internal Server Error")
+	}
+
+	duration := time.Now().Sub(startTime)
+
+	log.Info(relay.InfoTitleListValidators, relay.MsgTimeDuration, duration, relay.MsgStatus, http.StatusOK)
+
+	return Response(http.StatusOK, validatorsResponse), nil
+}
+
+// GetStakingDetails - Get the staking details of a depositor or validator
+func (s *ReadApiAPIService) GetStakingDetails(ctx context.Context, address string) (ImplResponse, error) {
+	startTime := time.Now()
+
+	log.Info(relay.InfoTitleStakingDetails)
+
+	if s.enableExtendedApis == false {
+		return Response(http.StatusNotFound, nil), errors.New("Not Found")
+	}
+
+	if !common.IsHexAddressDeep(address) {
+		log.Error(relay.MsgAddress, relay.MsgAddress, address, relay.MsgError, relay.ErrInvalidAddress, relay.MsgStatus, http.StatusBadRequest)
+		return Response(http.StatusBadRequest, nil), relay.ErrInvalidAddress
+	}
+
+	stakingResponse, err := s.cacheManager.GetStakingDetails(common.HexToAddress(address))
+	if err != nil {
+		if errors.Is(err, cachemanager.ErrStakingNotFound) {
+			return Response(http.StatusNotFound, nil), err
+		}
+		return Response(http.StatusInternalServerError, nil), errors.New("Internal Server Error")
+	}
+
+	duration := time.Now().Sub(startTime)
+
+	log.Info(relay.InfoTitleStakingDetails, relay.MsgAddress, address, relay.MsgTimeDuration, duration, relay.MsgStatus, http.StatusOK)
+
+	return Response(http.StatusOK, stakingResponse), nil
+}
+
+// GetBlockStakingDetails - Get the proposer and rewards of a block
+func (s *ReadApiAPIService) GetBlockStakingDetails(ctx context.Context, blockNumber int64) (ImplResponse, error) {
+	startTime := time.Now()
+
+	log.Info(relay.InfoTitleBlockStakingDetails)
+
+	if s.enableExtendedApis == false {
+		return Response(http.StatusNotFound, nil), errors.New("Not Found")
+	}
+
+	if blockNumber < 0 {
+		return Response(http.StatusBadRequest, nil), errors.New("Invalid blockNumber")
+	}
+
+	stakingResponse, err := s.cacheManager.GetBlockStakingDetails(uint64(blockNumber))
+	if err != nil {
+		if errors.Is(err, cachemanager.ErrStakingNotFound) {
+			return Response(http.StatusNotFound, nil), err
+		}
+		return Response(http.StatusInternalServerError, nil), errors.New("Internal Server Error")
+	}
+
+	duration := time.Now().Sub(startTime)
+
+	log.Info(relay.InfoTitleBlockStakingDetails, "blockNumber", blockNumber, relay.MsgTimeDuration, duration, relay.MsgStatus, http.StatusOK)
+
+	return Response(http.StatusOK, stakingResponse), nil
+}
+
+// GetValidatorStats - Get validator participation statistics
+func (s *ReadApiAPIService) GetValidatorStats(ctx context.Context, address string, fromBlock int64, toBlock int64) (ImplResponse, error) {
+	startTime := time.Now()
+
+	log.Info(relay.InfoTitleValidatorStats, relay.MsgDial, s.upstreams.Best().Url)
+
+	if !common.IsHexAddressDeep(address) {
+		log.Error(relay.MsgAddress, relay.MsgAddress, address, relay.MsgError, relay.ErrInvalidAddress, relay.MsgStatus, http.StatusBadRequest)
+		return Response(http.StatusBadRequest, nil), relay.ErrInvalidAddress
+	}
+
+	if fromBlock < 0 || toBlock < fromBlock {
+		return Response(http.StatusBadRequest, nil), relay.ErrInvalidRange
+	}
+
+	client := s.upstreams
+	var err error
+
+	var rpcStats *RPCValidatorStats
+	err = client.CallContext(ctx, &rpcStats, "proofofstake_getValidatorStats", common.HexToAddress(address),
+		hexutil.EncodeUint64(uint64(fromBlock)), hexutil.EncodeUint64(uint64(toBlock)))
+	if err != nil {
+		log.Error(relay.MsgValidatorStats, relay.MsgError, errors.New(err.Error()), relay.MsgStatus, http.StatusInternalServerError)
+		return Response(http.StatusInternalServerError, nil), errors.New(err.Error())
+	}
+	if rpcStats == nil {
+		return Response(http.StatusNotFound, nil), errors.New("Not Found")
+	}
+
+	duration := time.Now().Sub(startTime)
+
+	log.Info(relay.InfoTitleValidatorStats, relay.MsgAddress, address, relay.MsgTimeDuration, duration, relay.MsgStatus, http.StatusOK)
+
+	validatorStats := ValidatorStats{
+		Validator:        rpcStats.Validator.Hex(),
+		FromBlock:        int64(rpcStats.FromBlock),
+		ToBlock:          int64(rpcStats.ToBlock),
+		BlockCount:       int64(rpcStats.BlockCount),
+		ProposalsMade:    int64(rpcStats.ProposalsMade),
+		ProposalsMissed:  int64(rpcStats.ProposalsMissed),
+		VotesSigned:      int64(rpcStats.VotesSigned),
+		Slashes:          int64(rpcStats.Slashes),
+		UptimePercentage: rpcStats.UptimePercentage,
+	}
+
+	return Response(http.StatusOK, ValidatorStatsResponse{validatorStats}), nil
+}
@@ -0,0 +1,183 @@
+/*
+ * QC Read API
+ *
+ * API version: v1
+ */
+
+package qcreadapi
+
+import (
+	"context"
+	"errors"
+	"github.com/QuantumCoinProject/qc/cachemanager"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/relay"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// supplyHistoryDefaultDays is the number of days of the supply history when no
+// fromDate is given
+const supplyHistoryDefaultDays = 30
+
+// serveSupply authorizes a supply request and encodes the response of call.
+// Parameters are parsed by call, which returns a ParsingError for invalid ones.
+func (c *ReadApiAPIController) serveSupply(w http.ResponseWriter, r *http.Request, name string, call func() (ImplResponse, error)) {
+	requestId := r.Header.Get(REQUEST_ID_HEADER_NAME)
+
+	c.setupCORS(&w, r)
+	if (*r).Method == "OPTIONS" {
+		return
+	}
+
+	if c.authorize(r) == false {
+		result := Response(http.StatusUnauthorized, nil)
+		log.Error(name, "requestId", requestId, "error", "Unauthorized")
+		c.errorHandler(w, r, errors.New("Unauthorized"), &result)
+		return
+	}
+
+	result, err := call()
+	if err != nil {
+		c.errorHandler(w, r, err, &result)
+		log.Error(name, "requestId", requestId, "error", err)
+		return
+	}
+	_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+	log.Info(name+" ok", "requestId", requestId)
+}
+
+// GetRichList - Get the accounts holding the most coins
+func (c *ReadApiAPIController) GetRichList(w http.ResponseWriter, r *http.Request) {
+	c.serveSupply(w, r, "GetRichList", func() (ImplResponse, error) {
+		count := int64(cachemanager.DefaultRichListCount)
+		if value := r.URL.Query().Get("count"); len(value) > 0 {
+			var err error
+			count, err = strconv.ParseInt(value, 10, 64)
+			if err != nil || count < 1 || count > cachemanager.MaxRichListCount {
+				return ImplResponse{}, &ParsingError{"count", relay.ErrInvalidRange}
+			}
+		}
+		return c.service.GetRichList(r.Context(), count)
+	})
+}
+
+// GetSupply - Get the staked and liquid supply at the last indexed block
+func (c *ReadApiAPIController) GetSupply(w http.ResponseWriter, r *http.Request) {
+	c.serveSupply(w, r, "GetSupply", func() (ImplResponse, error) {
+		return c.service.GetSupply(r.Context())
+	})
+}
+
+// GetSupplyDistribution - Get the balance distribution of the accounts
+func (c *ReadApiAPIController) GetSupplyDistribution(w http.ResponseWriter, r *http.Request) {
+	c.serveSupply(w, r, "GetSupplyDistribution", func() (ImplResponse, error) {
+		return c.service.GetSupplyDistribution(r.Context())
+	})
+}
+
+// GetSupplyHistory - Get the daily supply snapshots
+func (c *ReadApiAPIController) GetSupplyHistory(w http.ResponseWriter, r *http.Request) {
+	c.serveSupply(w, r, "GetSupplyHistory", func() (ImplResponse, error) {
+		now := time.Now().UTC()
+		toDate := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		if value := r.URL.Query().Get("toDate"); len(value) > 0 {
+			date, err := time.Parse(cachemanager.SupplyDateLayout, value)
+			if err != nil {
+				return ImplResponse{}, &ParsingError{"toDate", err}
+			}
+			toDate = date
+		}
+		fromDate := toDate.AddDate(0, 0, 1-supplyHistoryDefaultDays)
+		if value := r.URL.Query().Get("fromDate"); len(value) > 0 {
+			date, err := time.Parse(cachemanager.SupplyDateLayout, value)
+			if err != nil {
+				return ImplResponse{}, &ParsingError{"fromDate", err}
+			}
+			fromDate = date
+		}
+		return c.service.GetSupplyHistory(r.Context(), fromDate, toDate)
+	})
+}
+
+// supplyResponse maps the errors of the supply queries of the cache manager to
+// responses.
+func supplyResponse(title string, startTime time.Time, body interface{}, err error) (ImplResponse, error) {
+	if err != nil {
+		log.Error(title, relay.MsgError, err)
+		if errors.Is(err, cachemanager.ErrSupplyNotFound) {
+			return Response(http.StatusNotFound, nil), err
+		}
+		if errors.Is(err, cachemanager.ErrSupplyRange) {
+			return Response(http.StatusBadRequest, nil), err
+		}
+		return Response(http.StatusInternalServerError, nil), errors.New("Internal Server Error")
+	}
+
+	duration := time.Now().Sub(startTime)
+
+	log.Info(title, relay.MsgTimeDuration, duration, relay.MsgStatus, http.StatusOK)
+
+	return Response(http.StatusOK, body), nil
+}
+
+// GetRichList - Get the accounts holding the most coins
+func (s *ReadApiAPIService) GetRichList(ctx context.Context, count int64) (ImplResponse, error) {
+	startTime := time.Now()
+
+	log.Info(relay.InfoTitleRichList, "count", count)
+
+	if s.enableExtendedApis == false {
+		return Response(http.StatusNotFound, nil), errors.New("Not Found")
+	}
+	if count < 1 {
+		return Response(http.StatusBadRequest, nil), relay.ErrInvalidRange
+	}
+
+	response, err := s.cacheManager.GetRichList(uint64(count))
+	return supplyResponse(relay.InfoTitleRichList, startTime, response, err)
+}
+
+// GetSupply - Get the staked and liquid supply at the last indexed block
+func (s *ReadApiAPIService) GetSupply(ctx context.Context) (ImplResponse, error) {
+	startTime := time.Now()
+
+	log.Info(relay.InfoTitleSupply)
+
+	if s.enableExtendedApis == false {
+		return Response(http.StatusNotFound, nil), errors.New("Not Found")
+	}
+
+	response, err := s.cacheManager.GetSupply()
+	return supplyResponse(relay.InfoTitleSupply, startTime, response, err)
+}
+
+// GetSupplyDistribution - Get the balance distribution of the accounts
+func (s *ReadApiAPIService) GetSupplyDistribution(ctx context.Context) (ImplResponse, error) {
+	startTime := time.Now()
+
+	log.Info(relay.InfoTitleSupplyDistribution)
+
+	if s.enableExtendedApis == false {
+		return Response(http.StatusNotFound, nil), errors.New("Not Found")
+	}
+
+	response, err := s.cacheManager.GetSupplyDistribution()
+	return supplyResponse(relay.InfoTitleSupplyDistribution, startTime, response, err)
+}
+
+// GetSupplyHistory - Get the daily supply snapshots
+func (s *ReadApiAPIService) GetSupplyHistory(ctx context.Context, fromDate time.Time, toDate time.Time) (ImplResponse, error) {
+	startTime := time.Now()
+
+	log.Info(relay.InfoTitleSupplyHistory, "fromDate", fromDate.Format(cachemanager.SupplyDateLayout), "toDate", toDate.Format(cachemanager.SupplyDateLayout))
+
+	if s.enableExtendedApis == false {
+		return Response(http.StatusNotFound, nil), errors.New("Not Found")
+	}
+
+	response, err := s.cacheManager.GetSupplyHistory(fromDate, toDate)
+	return supplyResponse(relay.InfoTitleSupplyHistory, startTime, response, err)
+}
@@ -38,6 +38,8 @@ type AccountTransactionCompact struct {
 	TransactionType TransactionType `json:"transactionType,omitempty"`
 
 	ErrorReason *string `json:"errorReason,omitempty"`
+
+	TokenAddress *string `json:"tokenAddress,omitempty"`
 }
 
 // AssertAccountTransactionCompactRequired checks if the required fields are not zero-ed
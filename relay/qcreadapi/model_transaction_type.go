@@ -26,6 +26,7 @@ const (
 	TOKEN_TRANSFER TransactionType = "TokenTransfer"
 	NEW_SMART_CONTRACT TransactionType = "NewSmartContract"
 	SMART_CONTRACT TransactionType = "SmartContract"
+	INTERNAL_TRANSFER TransactionType = "InternalTransfer"
 )
 
 // AllowedTransactionTypeEnumValues is all the allowed values of TransactionType enum
@@ -35,6 +36,7 @@ var AllowedTransactionTypeEnumValues = []TransactionType{
 	"TokenTransfer",
 	"NewSmartContract",
 	"SmartContract",
+	"InternalTransfer",
 }
 
 // validTransactionTypeEnumValue provides a map of TransactionTypes for fast verification of use input
@@ -44,6 +46,7 @@ var validTransactionTypeEnumValues = map[TransactionType]struct{}{
 	"TokenTransfer": {},
 	"NewSmartContract": {},
 	"SmartContract": {},
+	"InternalTransfer": {},
 }
 
 // IsValid return true if the value is valid for the enum, false otherwise
@@ -0,0 +1,35 @@
+/*
+ * QC Read API
+ *
+ * API version: v1
+ */
+
+package qcreadapi
+
+type WebhookRequest struct {
+	Url string `json:"url"`
+
+	Addresses []string `json:"addresses,omitempty"`
+
+	Events []string `json:"events,omitempty"`
+}
+
+type WebhookAddressesRequest struct {
+	Addresses []string `json:"addresses"`
+}
+
+// AssertWebhookRequestRequired checks if the required fields are not zero-ed
+func AssertWebhookRequestRequired(obj WebhookRequest) error {
+	if obj.Url == "" {
+		return &RequiredError{Field: "url"}
+	}
+	return nil
+}
+
+// AssertWebhookAddressesRequestRequired checks if the required fields are not zero-ed
+func AssertWebhookAddressesRequestRequired(obj WebhookAddressesRequest) error {
+	if len(obj.Addresses) == 0 {
+		return &RequiredError{Field: "addresses"}
+	}
+	return nil
+}
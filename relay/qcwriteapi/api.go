@@ -22,6 +22,9 @@ import (
 // pass the data to a WriteApiAPIServicer to perform the required actions, then write the service results to the http response.
 type WriteApiAPIRouter interface { 
 	SendTransaction(http.ResponseWriter, *http.Request)
+	SimulateTransaction(http.ResponseWriter, *http.Request)
+	GetAccountNonce(http.ResponseWriter, *http.Request)
+	GetFees(http.ResponseWriter, *http.Request)
 }
 
 
@@ -31,4 +34,7 @@ type WriteApiAPIRouter interface {
 // and updated with the logic required for the API.
 type WriteApiAPIServicer interface { 
 	SendTransaction(context.Context, SendTransactionRequest) (ImplResponse, error)
+	SimulateTransaction(context.Context, SimulateTransactionRequest) (ImplResponse, error)
+	GetAccountNonce(context.Context, string) (ImplResponse, error)
+	GetFees(context.Context) (ImplResponse, error)
 }
@@ -12,7 +12,10 @@ package qcwriteapi
 
 import (
 	"encoding/json"
+	"github.com/QuantumCoinProject/qc/common"
 	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/relay/apikeys"
+	"github.com/gorilla/mux"
 	"io"
 	"net/http"
 	"strings"
@@ -28,7 +31,7 @@ type WriteApiAPIController struct {
 	errorHandler ErrorHandler
 	corsAllowedOrigins string
 	enableAuth bool
-	apiKeysMap map[string]bool
+	keys *apikeys.Manager
 }
 
 // WriteApiAPIOption for how the controller is set up.
@@ -42,23 +45,13 @@ func WithWriteApiAPIErrorHandler(h ErrorHandler) WriteApiAPIOption {
 }
 
 // NewWriteApiAPIController creates a default api controller
-func NewWriteApiAPIController(s WriteApiAPIServicer, corsAllowedOrigins string, enableAuth bool, apiKeys string, opts ...WriteApiAPIOption) *WriteApiAPIController {
+func NewWriteApiAPIController(s WriteApiAPIServicer, corsAllowedOrigins string, enableAuth bool, keys *apikeys.Manager, opts ...WriteApiAPIOption) *WriteApiAPIController {
 	controller := &WriteApiAPIController{
 		service:      s,
 		errorHandler: DefaultErrorHandler,
 		corsAllowedOrigins: corsAllowedOrigins,
 		enableAuth: enableAuth,
-		apiKeysMap: make(map[string]bool),
-	}
-
-	if len(apiKeys) > 0 {
-		apiKeyList := strings.Split(apiKeys, ",")
-		for _, key := range apiKeyList {
-			if len(key) == 0 {
-				continue
-			}
-			controller.apiKeysMap[key] = true
-		}
+		keys: keys,
 	}
 
 	for _, opt := range opts {
@@ -76,6 +69,21 @@ func (c *WriteApiAPIController) Routes() Routes {
 			"/transactions",
 			c.SendTransaction,
 		},
+		"SimulateTransaction": Route{
+			strings.ToUpper("Post"),
+			"/transaction/simulate",
+			c.SimulateTransaction,
+		},
+		"GetAccountNonce": Route{
+			strings.ToUpper("Get"),
+			"/account/{address}/nonce",
+			c.GetAccountNonce,
+		},
+		"GetFees": Route{
+			strings.ToUpper("Get"),
+			"/fees",
+			c.GetFees,
+		},
 	}
 }
 
@@ -100,11 +108,7 @@ func (c *WriteApiAPIController) authorize(w http.ResponseWriter, req *http.Reque
 		return false
 	}
 
-	if c.apiKeysMap[apiKey] == true {
-		return true
-	}
-
-	return false
+	return c.keys.Authorize(apiKey)
 }
 
 // SendTransaction - Send Transaction
@@ -165,3 +169,143 @@ func (c *WriteApiAPIController) SendTransaction(w http.ResponseWriter, r *http.R
 
 	log.Info("SendTransaction ok", "requestId", requestId)
 }
+
+// SimulateTransaction - Simulate Transaction
+func (c *WriteApiAPIController) SimulateTransaction(w http.ResponseWriter, r *http.Request) {
+	requestId := ""
+	if r.Header != nil {
+		requestId = r.Header.Get(REQUEST_ID_HEADER_NAME)
+	}
+	if len(requestId) > 0 {
+		log.Info("SimulateTransaction", "requestId", requestId)
+	}
+
+	c.setupCORS(&w, r)
+	if (*r).Method == "OPTIONS" {
+		log.Info("SimulateTransaction OPTIONS", "requestId", requestId)
+		return
+	}
+
+	if c.authorize(w, r) == false {
+		result := Response(http.StatusUnauthorized, nil)
+		// If no error, encode the body and the result code
+		_ = EncodeJSONResponse(result.Body, &result.Code, w)
+		log.Error("SimulateTransaction", "requestId", requestId, "error", "Unauthorized")
+		c.errorHandler(w, r, errors.New("Unauthorized"), &result)
+		return
+	}
+
+	simulateTransactionRequestParam := SimulateTransactionRequest{}
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&simulateTransactionRequestParam); err != nil && !errors.Is(err, io.EOF) {
+		c.errorHandler(w, r, &ParsingError{Err: err}, nil)
+		log.Error("SimulateTransaction", "requestId", requestId, "error", "invalid request")
+		return
+	}
+	if err := AssertSimulateTransactionRequestRequired(simulateTransactionRequestParam); err != nil {
+		c.errorHandler(w, r, err, nil)
+		log.Error("SimulateTransaction", "requestId", requestId, "error", "err fields")
+		return
+	}
+	if err := AssertSimulateTransactionRequestConstraints(simulateTransactionRequestParam); err != nil {
+		c.errorHandler(w, r, err, nil)
+		log.Error("SimulateTransaction", "requestId", requestId, "error", "err constraints")
+		return
+	}
+	result, err := c.service.SimulateTransaction(r.Context(), simulateTransactionRequestParam)
+	// If an error occurred, encode the error with the status code
+	if err != nil {
+		c.errorHandler(w, r, err, &result)
+		log.Error("SimulateTransaction", "requestId", requestId, "error", err)
+		return
+	}
+	// If no error, encode the body and the result code
+	_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+	log.Info("SimulateTransaction ok", "requestId", requestId)
+}
+
+// GetAccountNonce - Get the next nonce of an account
+func (c *WriteApiAPIController) GetAccountNonce(w http.ResponseWriter, r *http.Request) {
+	requestId := ""
+	if r.Header != nil {
+		requestId = r.Header.Get(REQUEST_ID_HEADER_NAME)
+	}
+	if len(requestId) > 0 {
+		log.Info("GetAccountNonce", "requestId", requestId)
+	}
+
+	c.setupCORS(&w, r)
+	if (*r).Method == "OPTIONS" {
+		log.Info("GetAccountNonce OPTIONS", "requestId", requestId)
+		return
+	}
+
+	if c.authorize(w, r) == false {
+		result := Response(http.StatusUnauthorized, nil)
+		// If no error, encode the body and the result code
+		_ = EncodeJSONResponse(result.Body, &result.Code, w)
+		log.Error("GetAccountNonce", "requestId", requestId, "error", "Unauthorized")
+		c.errorHandler(w, r, errors.New("Unauthorized"), &result)
+		return
+	}
+
+	params := mux.Vars(r)
+	addressParam := params["address"]
+	if !common.IsHexAddressDeep(addressParam) {
+		c.errorHandler(w, r, &ParsingError{"address", errors.New("Invalid address")}, nil)
+		log.Error("GetAccountNonce", "requestId", requestId, "error", "invalid address")
+		return
+	}
+
+	result, err := c.service.GetAccountNonce(r.Context(), addressParam)
+	// If an error occurred, encode the error with the status code
+	if err != nil {
+		c.errorHandler(w, r, err, &result)
+		log.Error("GetAccountNonce", "requestId", requestId, "error", err)
+		return
+	}
+	// If no error, encode the body and the result code
+	_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+	log.Info("GetAccountNonce ok", "requestId", requestId)
+}
+
+// GetFees - Get the chain id, gas price and block gas limit
+func (c *WriteApiAPIController) GetFees(w http.ResponseWriter, r *http.Request) {
+	requestId := ""
+	if r.Header != nil {
+		requestId = r.Header.Get(REQUEST_ID_HEADER_NAME)
+	}
+	if len(requestId) > 0 {
+		log.Info("GetFees", "requestId", requestId)
+	}
+
+	c.setupCORS(&w, r)
+	if (*r).Method == "OPTIONS" {
+		log.Info("GetFees OPTIONS", "requestId", requestId)
+		return
+	}
+
+	if c.authorize(w, r) == false {
+		result := Response(http.StatusUnauthorized, nil)
+		// If no error, encode the body and the result code
+		_ = EncodeJSONResponse(result.Body, &result.Code, w)
+		log.Error("GetFees", "requestId", requestId, "error", "Unauthorized")
+		c.errorHandler(w, r, errors.New("Unauthorized"), &result)
+		return
+	}
+
+	result, err := c.service.GetFees(r.Context())
+	// If an error occurred, encode the error with the status code
+	if err != nil {
+		c.errorHandler(w, r, err, &result)
+		log.Error("GetFees", "requestId", requestId, "error", err)
+		return
+	}
+	// If no error, encode the body and the result code
+	_ = EncodeJSONResponse(result.Body, &result.Code, w)
+
+	log.Info("GetFees ok", "requestId", requestId)
+}
@@ -12,10 +12,13 @@ package qcwriteapi
 
 import (
 	"context"
+	ethereum "github.com/QuantumCoinProject/qc"
 	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/ethclient"
 	"github.com/QuantumCoinProject/qc/log"
 	"github.com/QuantumCoinProject/qc/relay"
-	"github.com/QuantumCoinProject/qc/rpc"
+	"github.com/QuantumCoinProject/qc/relay/upstream"
 	"net/http"
 	"errors"
 	"github.com/mattn/go-colorable"
@@ -27,13 +30,13 @@ import (
 // This service should implement the business logic for every endpoint for the WriteApiAPI API.
 // Include any external packages or services that will be required by this service.
 type WriteApiAPIService struct {
-	DpUrl string
+	upstreams *upstream.Pool
 }
 
 // NewWriteApiAPIService creates a default api service
-func NewWriteApiAPIService(dpUrl string) *WriteApiAPIService {
+func NewWriteApiAPIService(upstreams *upstream.Pool) *WriteApiAPIService {
 	log.Root().SetHandler(log.LvlFilterHandler(log.Lvl(3), log.StreamHandler(colorable.NewColorableStderr(), log.TerminalFormat(true))))
-	return &WriteApiAPIService{DpUrl: dpUrl}
+	return &WriteApiAPIService{upstreams: upstreams}
 }
 
 // SendTransaction - Send Transaction
@@ -41,14 +44,9 @@ func (s *WriteApiAPIService) SendTransaction(ctx context.Context, sendTransactio
 
 	startTime := time.Now()
 
-	log.Info(relay.InfoTitleSendTransaction, relay.MsgDial, s.DpUrl)
+	log.Info(relay.InfoTitleSendTransaction, relay.MsgDial, s.upstreams.Best().Url)
 
-	client, err := rpc.Dial(s.DpUrl)
-	if err != nil {
-		log.Error(relay.MsgDial, relay.MsgError, errors.New(err.Error()), relay.MsgStatus, http.StatusInternalServerError)
-		return Response(http.StatusInternalServerError, nil), errors.New(err.Error())
-	}
-	defer client.Close()
+	client := ethclient.NewClient(s.upstreams.Client())
 
 	rawTxHex := sendTransactionRequest.TxnData
 
@@ -57,12 +55,18 @@ func (s *WriteApiAPIService) SendTransaction(ctx context.Context, sendTransactio
 		return  Response(http.StatusBadRequest, nil), relay.ErrEmptyRawTxHex
 	}
 
-	var txHash *common.Hash
-	err = client.CallContext(ctx, &txHash, "eth_sendRawTransaction", rawTxHex)
+	_, from, txErr := validateTransaction(ctx, client, rawTxHex)
+	if txErr != nil {
+		log.Error(relay.MsgSend + " " + relay.MsgTransaction, relay.MsgAddress, from, relay.MsgError, txErr, relay.MsgStatus, txErr.Status)
+		return Response(txErr.Status, nil), txErr
+	}
+
+	txHash, err := s.upstreams.SendRawTransaction(ctx, strings.TrimSpace(rawTxHex))
 
 	if err != nil {
-		log.Error(relay.MsgSend + " " + relay.MsgTransaction, relay.MsgError, errors.New(err.Error()), relay.MsgStatus, http.StatusBadRequest)
-		return Response(http.StatusBadRequest, nil), errors.New(err.Error())
+		txErr := sendError(err)
+		log.Error(relay.MsgSend + " " + relay.MsgTransaction, relay.MsgError, errors.New(err.Error()), relay.MsgStatus, txErr.Status)
+		return Response(txErr.Status, nil), txErr
 	}
 
 	duration := time.Now().Sub(startTime)
@@ -71,3 +75,115 @@ func (s *WriteApiAPIService) SendTransaction(ctx context.Context, sendTransactio
 
 	return Response(http.StatusOK, txHash.String()), nil
 }
+
+// SimulateTransaction - Simulate Transaction
+func (s *WriteApiAPIService) SimulateTransaction(ctx context.Context, simulateTransactionRequest SimulateTransactionRequest) (ImplResponse, error) {
+
+	startTime := time.Now()
+
+	log.Info(relay.InfoTitleSimulateTransaction, relay.MsgDial, s.upstreams.Best().Url)
+
+	client := ethclient.NewClient(s.upstreams.Client())
+
+	var msg ethereum.CallMsg
+	if len(strings.TrimSpace(simulateTransactionRequest.TxnData)) > 0 {
+		tx, from, txErr := validateTransaction(ctx, client, simulateTransactionRequest.TxnData)
+		if txErr != nil {
+			return simulationFailure(txErr)
+		}
+		msg = ethereum.CallMsg{From: from, To: tx.To(), Gas: tx.Gas(), Value: tx.Value(), Data: tx.Data(), AccessList: tx.AccessList()}
+	} else {
+		var txErr *TransactionError
+		msg, txErr = callMsgFromRequest(simulateTransactionRequest)
+		if txErr != nil {
+			return Response(txErr.Status, nil), txErr
+		}
+	}
+
+	returnData, err := client.CallContract(ctx, msg, nil)
+	if err != nil {
+		return simulationFailure(executionError(err))
+	}
+	gasEstimate, err := client.EstimateGas(ctx, msg)
+	if err != nil {
+		return simulationFailure(executionError(err))
+	}
+
+	duration := time.Now().Sub(startTime)
+
+	log.Info(relay.InfoTitleSimulateTransaction, relay.MsgAddress, msg.From, relay.MsgTimeDuration, duration, relay.MsgStatus, http.StatusOK)
+
+	return Response(http.StatusOK, SimulateTransactionResponse{Success: true, GasEstimate: gasEstimate, ReturnData: hexutil.Encode(returnData)}), nil
+}
+
+// simulationFailure reports a transaction that would fail in the body of a
+// successful response. Only node errors fail the request.
+func simulationFailure(txErr *TransactionError) (ImplResponse, error) {
+	if txErr.Code == ErrCodeNodeUnavailable {
+		return Response(txErr.Status, nil), txErr
+	}
+	log.Info(relay.InfoTitleSimulateTransaction, relay.MsgError, txErr, relay.MsgStatus, http.StatusOK)
+	return Response(http.StatusOK, SimulateTransactionResponse{
+		Success: false,
+		Error: &ErrorResponseModel{Message: &txErr.Message, Status: int32(txErr.Status), Code: &txErr.Code},
+	}), nil
+}
+
+// GetAccountNonce - Get the next nonce of an account
+func (s *WriteApiAPIService) GetAccountNonce(ctx context.Context, address string) (ImplResponse, error) {
+
+	startTime := time.Now()
+
+	log.Info(relay.InfoTitleAccountNonce, relay.MsgDial, s.upstreams.Best().Url)
+
+	if common.IsHexAddressDeep(address) == false {
+		return Response(http.StatusBadRequest, nil), relay.ErrInvalidAddress
+	}
+
+	client := ethclient.NewClient(s.upstreams.Client())
+
+	account := common.HexToAddress(address)
+	nonce, err := client.PendingNonceAt(ctx, account)
+	if err != nil {
+		return Response(http.StatusServiceUnavailable, nil), nodeUnavailableError(err)
+	}
+	confirmedNonce, err := client.NonceAt(ctx, account, nil)
+	if err != nil {
+		return Response(http.StatusServiceUnavailable, nil), nodeUnavailableError(err)
+	}
+
+	duration := time.Now().Sub(startTime)
+
+	log.Info(relay.InfoTitleAccountNonce, relay.MsgAddress, address, relay.MsgTimeDuration, duration, relay.MsgStatus, http.StatusOK)
+
+	return Response(http.StatusOK, AccountNonceResponse{Address: address, Nonce: nonce, ConfirmedNonce: confirmedNonce}), nil
+}
+
+// GetFees - Get the chain id, gas price and block gas limit
+func (s *WriteApiAPIService) GetFees(ctx context.Context) (ImplResponse, error) {
+
+	startTime := time.Now()
+
+	log.Info(relay.InfoTitleFees, relay.MsgDial, s.upstreams.Best().Url)
+
+	client := ethclient.NewClient(s.upstreams.Client())
+
+	chainId, err := client.ChainID(ctx)
+	if err != nil {
+		return Response(http.StatusServiceUnavailable, nil), nodeUnavailableError(err)
+	}
+	gasPrice, err := client.SuggestGasPrice(ctx)
+	if err != nil {
+		return Response(http.StatusServiceUnavailable, nil), nodeUnavailableError(err)
+	}
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return Response(http.StatusServiceUnavailable, nil), nodeUnavailableError(err)
+	}
+
+	duration := time.Now().Sub(startTime)
+
+	log.Info(relay.InfoTitleFees, relay.MsgTimeDuration, duration, relay.MsgStatus, http.StatusOK)
+
+	return Response(http.StatusOK, FeesResponse{ChainId: hexutil.EncodeBig(chainId), GasPrice: hexutil.EncodeBig(gasPrice), BlockGasLimit: header.GasLimit}), nil
+}
@@ -62,6 +62,14 @@ func DefaultErrorHandler(w http.ResponseWriter, _ *http.Request, err error, resu
 		return
 	}
 
+	var txErr *TransactionError
+	if ok := errors.As(err, &txErr); ok {
+		// Handle transaction validation errors with their code
+		status := txErr.Status
+		_ = EncodeJSONResponse(ErrorResponseModel{Message: &txErr.Message, Status: int32(status), Code: &txErr.Code}, &status, w)
+		return
+	}
+
 	var requiredErr *RequiredError
 	if ok := errors.As(err, &requiredErr); ok {
 		// Handle missing required errors
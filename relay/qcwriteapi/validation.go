@@ -0,0 +1,234 @@
+package qcwriteapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	ethereum "github.com/QuantumCoinProject/qc"
+	"github.com/QuantumCoinProject/qc/accounts/abi"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/conversionutil"
+	"github.com/QuantumCoinProject/qc/core"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/ethclient"
+	"github.com/QuantumCoinProject/qc/rpc"
+	"math/big"
+	"net/http"
+	"strings"
+)
+
+// Error codes returned in the code field of ErrorResponseModel
+const (
+	ErrCodeInvalidTransaction = "INVALID_TRANSACTION"
+	ErrCodeChainIdMismatch    = "CHAIN_ID_MISMATCH"
+	ErrCodeInvalidSignature   = "INVALID_SIGNATURE"
+	ErrCodeNonceTooLow        = "NONCE_TOO_LOW"
+	ErrCodeNonceGap           = "NONCE_GAP"
+	ErrCodeInsufficientFunds  = "INSUFFICIENT_FUNDS"
+	ErrCodeIntrinsicGas       = "INTRINSIC_GAS_TOO_LOW"
+	ErrCodeGasLimitExceeded   = "GAS_LIMIT_EXCEEDED"
+	ErrCodeExecutionReverted  = "EXECUTION_REVERTED"
+	ErrCodeNodeRejected       = "NODE_REJECTED"
+	ErrCodeNodeUnavailable    = "NODE_UNAVAILABLE"
+)
+
+// TransactionError is an error with a machine readable code, returned to the
+// client as an ErrorResponseModel.
+type TransactionError struct {
+	Code    string
+	Message string
+	Status  int
+}
+
+func (e *TransactionError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func newTransactionError(code string, format string, args ...interface{}) *TransactionError {
+	return &TransactionError{Code: code, Message: fmt.Sprintf(format, args...), Status: http.StatusBadRequest}
+}
+
+func nodeUnavailableError(err error) *TransactionError {
+	return &TransactionError{Code: ErrCodeNodeUnavailable, Message: err.Error(), Status: http.StatusServiceUnavailable}
+}
+
+// accountState is the chain state a transaction is validated against.
+type accountState struct {
+	nonce         uint64   // Nonce of the sender at the latest block
+	pendingNonce  uint64   // Nonce of the sender including the transactions of the pool
+	balance       *big.Int // Balance of the sender
+	blockGasLimit uint64   // Gas limit of the latest block
+}
+
+// decodeTransaction decodes a hex encoded signed transaction.
+func decodeTransaction(rawTxHex string) (*types.Transaction, *TransactionError) {
+	data, err := hexutil.Decode(strings.TrimSpace(rawTxHex))
+	if err != nil {
+		return nil, newTransactionError(ErrCodeInvalidTransaction, "txnData is not valid hex: %v", err)
+	}
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(data); err != nil {
+		return nil, newTransactionError(ErrCodeInvalidTransaction, "txnData is not a valid transaction: %v", err)
+	}
+	if tx.VerifyFields() == false {
+		return nil, newTransactionError(ErrCodeInvalidTransaction, "transaction fields are not valid")
+	}
+	return tx, nil
+}
+
+// transactionSender checks the chain id and the signature of a transaction and
+// returns its sender.
+func transactionSender(tx *types.Transaction, chainId *big.Int) (common.Address, *TransactionError) {
+	if tx.ChainId().Cmp(chainId) != 0 {
+		return common.Address{}, newTransactionError(ErrCodeChainIdMismatch, "transaction chain id %v does not match the network chain id %v", tx.ChainId(), chainId)
+	}
+	from, err := types.Sender(types.LatestSignerForChainID(chainId), tx)
+	if err != nil {
+		return common.Address{}, newTransactionError(ErrCodeInvalidSignature, "invalid signature: %v", err)
+	}
+	return from, nil
+}
+
+// checkTransaction applies the checks of the node's transaction pool to a
+// transaction, so that a send that would be rejected or never mined fails early.
+// Nonces between the confirmed and the pending nonce of the account replace a
+// pending transaction, and are left to the pool to accept or not.
+func checkTransaction(tx *types.Transaction, chainId *big.Int, state *accountState) *TransactionError {
+	if tx.Nonce() < state.nonce {
+		return newTransactionError(ErrCodeNonceTooLow, "nonce %d is lower than the next nonce %d of the account", tx.Nonce(), state.nonce)
+	}
+	if tx.Nonce() > state.pendingNonce {
+		return newTransactionError(ErrCodeNonceGap, "nonce %d is higher than the next pending nonce %d of the account, the transaction would not be mined until the gap is filled", tx.Nonce(), state.pendingNonce)
+	}
+	if tx.Gas() > state.blockGasLimit {
+		return newTransactionError(ErrCodeGasLimitExceeded, "gas limit %d exceeds the block gas limit %d", tx.Gas(), state.blockGasLimit)
+	}
+	intrinsicGas, err := core.IntrinsicGas(tx.Data(), tx.AccessList(), tx.To() == nil, true, true)
+	if err != nil {
+		return newTransactionError(ErrCodeIntrinsicGas, "%v", err)
+	}
+	if tx.Gas() < intrinsicGas {
+		return newTransactionError(ErrCodeIntrinsicGas, "gas limit %d is lower than the intrinsic gas %d", tx.Gas(), intrinsicGas)
+	}
+	if state.balance.Cmp(tx.Cost()) < 0 {
+		isGasExempt, err := conversionutil.IsGasExemptTxn(tx, types.LatestSignerForChainID(chainId))
+		if err != nil || isGasExempt == false {
+			return newTransactionError(ErrCodeInsufficientFunds, "balance %v is lower than the value plus the fee %v", state.balance, tx.Cost())
+		}
+	}
+	return nil
+}
+
+// getAccountState reads the state a transaction of the account is validated
+// against from the node.
+func getAccountState(ctx context.Context, client *ethclient.Client, from common.Address) (*accountState, error) {
+	nonce, err := client.NonceAt(ctx, from, nil)
+	if err != nil {
+		return nil, err
+	}
+	pendingNonce, err := client.PendingNonceAt(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	if pendingNonce < nonce {
+		pendingNonce = nonce
+	}
+	balance, err := client.BalanceAt(ctx, from, nil)
+	if err != nil {
+		return nil, err
+	}
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &accountState{nonce: nonce, pendingNonce: pendingNonce, balance: balance, blockGasLimit: header.GasLimit}, nil
+}
+
+// validateTransaction decodes and validates a signed transaction against the
+// state of the node and returns it with its sender.
+func validateTransaction(ctx context.Context, client *ethclient.Client, rawTxHex string) (*types.Transaction, common.Address, *TransactionError) {
+	tx, txErr := decodeTransaction(rawTxHex)
+	if txErr != nil {
+		return nil, common.Address{}, txErr
+	}
+	chainId, err := client.ChainID(ctx)
+	if err != nil {
+		return nil, common.Address{}, nodeUnavailableError(err)
+	}
+	from, txErr := transactionSender(tx, chainId)
+	if txErr != nil {
+		return nil, common.Address{}, txErr
+	}
+	state, err := getAccountState(ctx, client, from)
+	if err != nil {
+		return nil, common.Address{}, nodeUnavailableError(err)
+	}
+	if txErr := checkTransaction(tx, chainId, state); txErr != nil {
+		return nil, common.Address{}, txErr
+	}
+	return tx, from, nil
+}
+
+// callMsgFromRequest builds the call of an unsigned simulation request.
+func callMsgFromRequest(request SimulateTransactionRequest) (ethereum.CallMsg, *TransactionError) {
+	msg := ethereum.CallMsg{Gas: request.Gas}
+	if common.IsHexAddressDeep(request.From) == false {
+		return msg, newTransactionError(ErrCodeInvalidTransaction, "from is not a valid address")
+	}
+	msg.From = common.HexToAddress(request.From)
+	if len(request.To) > 0 {
+		if common.IsHexAddressDeep(request.To) == false {
+			return msg, newTransactionError(ErrCodeInvalidTransaction, "to is not a valid address")
+		}
+		to := common.HexToAddress(request.To)
+		msg.To = &to
+	}
+	if len(request.Value) > 0 {
+		value, err := hexutil.DecodeBig(request.Value)
+		if err != nil {
+			return msg, newTransactionError(ErrCodeInvalidTransaction, "value is not a valid hex number: %v", err)
+		}
+		msg.Value = value
+	}
+	if len(request.Data) > 0 {
+		data, err := hexutil.Decode(request.Data)
+		if err != nil {
+			return msg, newTransactionError(ErrCodeInvalidTransaction, "data is not valid hex: %v", err)
+		}
+		msg.Data = data
+	}
+	return msg, nil
+}
+
+// executionError converts the error of eth_call or eth_estimateGas, with the
+// revert reason if there is one.
+func executionError(err error) *TransactionError {
+	var dataErr rpc.DataError
+	if errors.As(err, &dataErr) {
+		if data, ok := dataErr.ErrorData().(string); ok {
+			if revert, decodeErr := hexutil.Decode(data); decodeErr == nil {
+				if reason, unpackErr := abi.UnpackRevert(revert); unpackErr == nil {
+					return newTransactionError(ErrCodeExecutionReverted, "execution reverted: %s", reason)
+				}
+			}
+		}
+		return newTransactionError(ErrCodeExecutionReverted, "%s", dataErr.Error())
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return newTransactionError(ErrCodeExecutionReverted, "%s", rpcErr.Error())
+	}
+	return nodeUnavailableError(err)
+}
+
+// sendError converts the error of eth_sendRawTransaction. Errors returned by
+// the nodes are rejections of the transaction; other errors mean that no node
+// could be reached.
+func sendError(err error) *TransactionError {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return newTransactionError(ErrCodeNodeRejected, "%s", rpcErr.Error())
+	}
+	return nodeUnavailableError(err)
+}
@@ -0,0 +1,101 @@
+package qcwriteapi
+
+import (
+	"encoding/json"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/crypto/cryptobase"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func signedTransaction(t *testing.T, chainId *big.Int, nonce uint64, gas uint64) (string, common.Address) {
+	key, err := cryptobase.SigAlg.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	to := common.BytesToAddress([]byte{0x01})
+	tx := types.NewDefaultFeeTransaction(chainId, nonce, &to, big.NewInt(1000), gas, types.GAS_TIER_DEFAULT, nil)
+	tx, err = types.SignTx(tx, types.LatestSignerForChainID(chainId), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := tx.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, err := cryptobase.SigAlg.PublicKeyToAddress(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hexutil.Encode(data), from
+}
+
+func TestValidateTransaction(t *testing.T) {
+	chainId := big.NewInt(123123)
+	rawTx, from := signedTransaction(t, chainId, 5, 21000)
+
+	if _, txErr := decodeTransaction("0x1234"); txErr == nil || txErr.Code != ErrCodeInvalidTransaction {
+		t.Fatalf("unexpected error %v, want %s", txErr, ErrCodeInvalidTransaction)
+	}
+	tx, txErr := decodeTransaction(rawTx)
+	if txErr != nil {
+		t.Fatal(txErr)
+	}
+	if _, txErr := transactionSender(tx, big.NewInt(1)); txErr == nil || txErr.Code != ErrCodeChainIdMismatch {
+		t.Fatalf("unexpected error %v, want %s", txErr, ErrCodeChainIdMismatch)
+	}
+	sender, txErr := transactionSender(tx, chainId)
+	if txErr != nil || sender != from {
+		t.Fatalf("sender %x, %v, want %x", sender, txErr, from)
+	}
+
+	enough := new(big.Int).Mul(tx.Cost(), big.NewInt(2))
+	tests := []struct {
+		state *accountState
+		code  string
+	}{
+		{&accountState{nonce: 5, pendingNonce: 5, balance: enough, blockGasLimit: 30000000}, ""},
+		{&accountState{nonce: 6, pendingNonce: 6, balance: enough, blockGasLimit: 30000000}, ErrCodeNonceTooLow},
+		{&accountState{nonce: 4, pendingNonce: 4, balance: enough, blockGasLimit: 30000000}, ErrCodeNonceGap},
+		{&accountState{nonce: 5, pendingNonce: 5, balance: big.NewInt(1000), blockGasLimit: 30000000}, ErrCodeInsufficientFunds},
+		{&accountState{nonce: 5, pendingNonce: 5, balance: enough, blockGasLimit: 20000}, ErrCodeGasLimitExceeded},
+		// Replaces a pending transaction of the account
+		{&accountState{nonce: 4, pendingNonce: 7, balance: enough, blockGasLimit: 30000000}, ""},
+		{&accountState{nonce: 5, pendingNonce: 6, balance: enough, blockGasLimit: 30000000}, ""},
+		{&accountState{nonce: 6, pendingNonce: 8, balance: enough, blockGasLimit: 30000000}, ErrCodeNonceTooLow},
+	}
+	for i, test := range tests {
+		txErr := checkTransaction(tx, chainId, test.state)
+		if test.code == "" && txErr != nil {
+			t.Errorf("test %d: unexpected error %v", i, txErr)
+		}
+		if test.code != "" && (txErr == nil || txErr.Code != test.code) {
+			t.Errorf("test %d: unexpected error %v, want %s", i, txErr, test.code)
+		}
+	}
+
+	lowGasTx, _ := signedTransaction(t, chainId, 5, 20000)
+	tx, _ = decodeTransaction(lowGasTx)
+	if txErr := checkTransaction(tx, chainId, tests[0].state); txErr == nil || txErr.Code != ErrCodeIntrinsicGas {
+		t.Fatalf("unexpected error %v, want %s", txErr, ErrCodeIntrinsicGas)
+	}
+}
+
+func TestTransactionErrorResponse(t *testing.T) {
+	w := httptest.NewRecorder()
+	DefaultErrorHandler(w, nil, newTransactionError(ErrCodeNonceGap, "gap"), &ImplResponse{Code: http.StatusBadRequest})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	var response ErrorResponseModel
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Code == nil || *response.Code != ErrCodeNonceGap || response.Message == nil || *response.Message != "gap" {
+		t.Fatalf("unexpected response %s", w.Body.String())
+	}
+}
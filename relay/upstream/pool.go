@@ -0,0 +1,435 @@
+// Package upstream implements a pool of the nodes the relay reads from and
+// sends transactions to, with health checks, failover and circuit breaking.
+package upstream
+
+import (
+	"context"
+	"errors"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/log"
+	"github.com/QuantumCoinProject/qc/metrics"
+	"github.com/QuantumCoinProject/qc/rpc"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	HealthCheckInterval = 5 * time.Second  // Time between health checks of each upstream
+	HealthCheckTimeout  = 3 * time.Second  // Time after which a health check fails
+	MaxHeadLag          = 4                // Blocks an upstream can be behind the best head and still be healthy
+	FailureThreshold    = 3                // Consecutive failures after which the circuit of an upstream opens
+	CircuitOpenDuration = 30 * time.Second // Time an open circuit waits before the upstream is checked again
+	BroadcastCount      = 3                // Number of upstreams a transaction is sent to
+	BroadcastTimeout    = 10 * time.Second // Time after which sending a transaction to an upstream is abandoned
+)
+
+var ErrNoUpstreams = errors.New("no upstream nodes")
+
+var metricsNameRegexp = regexp.MustCompile(`[^a-zA-Z0-9.\-]+`)
+
+// Upstream is a node of the pool.
+type Upstream struct {
+	Url    string
+	client *rpc.Client
+
+	lock        sync.Mutex
+	head        uint64
+	syncing     bool
+	latency     time.Duration // Moving average of the health check latency
+	checked     bool          // Whether a health check succeeded since the circuit closed
+	failures    int           // Consecutive failures
+	circuitOpen time.Time     // Time the circuit opened, zero if it is closed
+
+	headGauge    metrics.Gauge
+	healthyGauge metrics.Gauge
+	latencyTimer metrics.Timer
+	requestMeter metrics.Meter
+	failureMeter metrics.Meter
+	circuitMeter metrics.Meter
+}
+
+func newUpstream(url string, client *rpc.Client) *Upstream {
+	prefix := "relay/upstream/" + metricsNameRegexp.ReplaceAllString(url, "_") + "/"
+	return &Upstream{
+		Url:          url,
+		client:       client,
+		headGauge:    metrics.GetOrRegisterGauge(prefix+"head", nil),
+		healthyGauge: metrics.GetOrRegisterGauge(prefix+"healthy", nil),
+		latencyTimer: metrics.GetOrRegisterTimer(prefix+"latency", nil),
+		requestMeter: metrics.GetOrRegisterMeter(prefix+"requests", nil),
+		failureMeter: metrics.GetOrRegisterMeter(prefix+"failures", nil),
+		circuitMeter: metrics.GetOrRegisterMeter(prefix+"circuit/open", nil),
+	}
+}
+
+// Client returns the rpc client of the upstream.
+func (u *Upstream) Client() *rpc.Client {
+	return u.client
+}
+
+// succeeded records a successful health check or request.
+func (u *Upstream) succeeded() {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.circuitOpen.IsZero() == false {
+		log.Info("Upstream circuit closed", "url", u.Url)
+	}
+	u.failures = 0
+	u.circuitOpen = time.Time{}
+}
+
+// failed records a failed health check or request, and opens the circuit
+// after FailureThreshold consecutive failures.
+func (u *Upstream) failed(err error, now time.Time) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	u.failureMeter.Mark(1)
+	u.failures++
+	u.checked = false
+	if u.failures >= FailureThreshold && (u.circuitOpen.IsZero() || now.Sub(u.circuitOpen) >= CircuitOpenDuration) {
+		log.Warn("Upstream circuit opened", "url", u.Url, "failures", u.failures, "error", err)
+		u.circuitMeter.Mark(1)
+		u.circuitOpen = now
+	}
+}
+
+// isOpen reports whether the circuit of the upstream is open. Once
+// CircuitOpenDuration has passed, the upstream is checked again (half open).
+func (u *Upstream) isOpen(now time.Time) bool {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return u.circuitOpen.IsZero() == false && now.Sub(u.circuitOpen) < CircuitOpenDuration
+}
+
+type upstreamState struct {
+	upstream *Upstream
+	head     uint64
+	syncing  bool
+	latency  time.Duration
+	checked  bool
+	open     bool
+}
+
+func (u *Upstream) state(now time.Time) upstreamState {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return upstreamState{
+		upstream: u,
+		head:     u.head,
+		syncing:  u.syncing,
+		latency:  u.latency,
+		checked:  u.checked,
+		open:     u.circuitOpen.IsZero() == false && now.Sub(u.circuitOpen) < CircuitOpenDuration,
+	}
+}
+
+// Pool is a set of upstream nodes. Reads go to the healthiest upstream and
+// transactions are broadcast to several of them.
+type Pool struct {
+	upstreams []*Upstream
+
+	checkInterval time.Duration
+	quit          chan struct{}
+	wg            sync.WaitGroup
+}
+
+// NewPool dials the upstream nodes. Duplicate urls are ignored.
+func NewPool(urls []string) (*Pool, error) {
+	clients := make(map[string]*rpc.Client)
+	for _, url := range urls {
+		if _, ok := clients[url]; ok {
+			continue
+		}
+		client, err := rpc.DialContext(context.Background(), url)
+		if err != nil {
+			for _, c := range clients {
+				c.Close()
+			}
+			return nil, err
+		}
+		clients[url] = client
+	}
+	upstreams := make([]*Upstream, 0, len(clients))
+	for _, url := range urls {
+		if client, ok := clients[url]; ok {
+			upstreams = append(upstreams, newUpstream(url, client))
+			delete(clients, url)
+		}
+	}
+	return newPool(upstreams)
+}
+
+func newPool(upstreams []*Upstream) (*Pool, error) {
+	if len(upstreams) == 0 {
+		return nil, ErrNoUpstreams
+	}
+	return &Pool{
+		upstreams:     upstreams,
+		checkInterval: HealthCheckInterval,
+		quit:          make(chan struct{}),
+	}, nil
+}
+
+// Start checks the upstreams once and then keeps checking them in the
+// background.
+func (p *Pool) Start() {
+	p.checkAll()
+	p.wg.Add(1)
+	go p.loop()
+}
+
+// Close stops the health checks and closes the upstream connections.
+func (p *Pool) Close() {
+	close(p.quit)
+	p.wg.Wait()
+	for _, u := range p.upstreams {
+		u.client.Close()
+	}
+}
+
+func (p *Pool) loop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.checkAll()
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+func (p *Pool) checkAll() {
+	var wg sync.WaitGroup
+	for _, u := range p.upstreams {
+		if u.isOpen(time.Now()) {
+			continue
+		}
+		wg.Add(1)
+		go func(u *Upstream) {
+			defer wg.Done()
+			p.check(u)
+		}(u)
+	}
+	wg.Wait()
+
+	best := p.Best()
+	for _, u := range p.upstreams {
+		if p.isHealthy(u.state(time.Now()), p.maxHead()) {
+			u.healthyGauge.Update(1)
+		} else {
+			u.healthyGauge.Update(0)
+		}
+	}
+	log.Debug("Checked upstreams", "best", best.Url)
+}
+
+// check reads the head block and sync status of an upstream.
+func (p *Pool) check(u *Upstream) {
+	ctx, cancel := context.WithTimeout(context.Background(), HealthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	var head hexutil.Uint64
+	err := u.client.CallContext(ctx, &head, "eth_blockNumber")
+	latency := time.Since(start)
+	if err != nil {
+		log.Debug("Upstream health check failed", "url", u.Url, "error", err)
+		u.failed(err, time.Now())
+		return
+	}
+	var syncing interface{}
+	if err := u.client.CallContext(ctx, &syncing, "eth_syncing"); err != nil {
+		log.Debug("Upstream health check failed", "url", u.Url, "error", err)
+		u.failed(err, time.Now())
+		return
+	}
+	u.latencyTimer.Update(latency)
+	u.headGauge.Update(int64(head))
+
+	u.lock.Lock()
+	u.head = uint64(head)
+	u.syncing = syncing != false
+	if u.checked {
+		u.latency = (u.latency*3 + latency) / 4
+	} else {
+		u.latency = latency
+	}
+	u.checked = true
+	u.lock.Unlock()
+
+	u.succeeded()
+}
+
+func (p *Pool) maxHead() uint64 {
+	var head uint64
+	for _, u := range p.upstreams {
+		if state := u.state(time.Now()); state.checked && state.head > head {
+			head = state.head
+		}
+	}
+	return head
+}
+
+func (p *Pool) isHealthy(state upstreamState, maxHead uint64) bool {
+	return state.checked && state.open == false && state.syncing == false && state.head+MaxHeadLag >= maxHead
+}
+
+// ranked returns the upstreams ordered from the healthiest: healthy upstreams
+// by latency, then upstreams that are behind by head, then upstreams that
+// have not been checked and last those with an open circuit.
+func (p *Pool) ranked() []*Upstream {
+	now := time.Now()
+	maxHead := p.maxHead()
+	states := make([]upstreamState, len(p.upstreams))
+	for i, u := range p.upstreams {
+		states[i] = u.state(now)
+	}
+	rank := func(state upstreamState) int {
+		switch {
+		case p.isHealthy(state, maxHead):
+			return 0
+		case state.open:
+			return 3
+		case state.checked:
+			return 1
+		default:
+			return 2
+		}
+	}
+	sort.SliceStable(states, func(i, j int) bool {
+		ri, rj := rank(states[i]), rank(states[j])
+		if ri != rj {
+			return ri < rj
+		}
+		switch ri {
+		case 0:
+			return states[i].latency < states[j].latency
+		case 1:
+			return states[i].head > states[j].head
+		}
+		return false
+	})
+	upstreams := make([]*Upstream, len(states))
+	for i, state := range states {
+		upstreams[i] = state.upstream
+	}
+	return upstreams
+}
+
+// Best returns the healthiest upstream. If none is healthy, the upstream most
+// likely to answer is returned, so that callers get the error of the node.
+func (p *Pool) Best() *Upstream {
+	return p.ranked()[0]
+}
+
+// Client returns the rpc client of the healthiest upstream.
+func (p *Pool) Client() *rpc.Client {
+	return p.Best().client
+}
+
+// Urls returns the urls of the upstreams.
+func (p *Pool) Urls() []string {
+	urls := make([]string, len(p.upstreams))
+	for i, u := range p.upstreams {
+		urls[i] = u.Url
+	}
+	return urls
+}
+
+// isUpstreamError reports whether a call failed because of the upstream,
+// rather than returning an error for the request itself.
+func isUpstreamError(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	var rpcErr rpc.Error
+	return errors.As(err, &rpcErr) == false
+}
+
+// CallContext performs a JSON-RPC call on the healthiest upstream. If the
+// upstream fails, the call is retried on the next one.
+func (p *Pool) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	return p.Failover(ctx, func(client *rpc.Client) error {
+		return client.CallContext(ctx, result, method, args...)
+	})
+}
+
+// Failover calls fn with the rpc client of the healthiest upstream. If the
+// upstream fails, fn is called again with the client of the next one, so that
+// calls that have to be answered by the same node are retried together.
+func (p *Pool) Failover(ctx context.Context, fn func(client *rpc.Client) error) error {
+	var err error
+	for _, u := range p.ranked() {
+		u.requestMeter.Mark(1)
+		err = fn(u.client)
+		if isUpstreamError(ctx, err) == false {
+			return err
+		}
+		log.Debug("Upstream call failed", "url", u.Url, "error", err)
+		u.failed(err, time.Now())
+	}
+	return err
+}
+
+// SendRawTransaction sends a signed transaction to up to BroadcastCount of the
+// healthiest upstreams, so that it propagates faster. The hash is returned as
+// soon as one of them accepts the transaction, while it keeps being sent to
+// the others; if all of them reject it, the error of the healthiest one is
+// returned.
+func (p *Pool) SendRawTransaction(ctx context.Context, rawTxHex string) (common.Hash, error) {
+	upstreams := p.ranked()
+	count := 0
+	for count < len(upstreams) && count < BroadcastCount && upstreams[count].isOpen(time.Now()) == false {
+		count++
+	}
+	if count == 0 {
+		count = 1
+	}
+	upstreams = upstreams[:count]
+
+	type result struct {
+		index int
+		hash  common.Hash
+		err   error
+	}
+	results := make(chan result, count)
+	for i, u := range upstreams {
+		go func(i int, u *Upstream) {
+			// The request context is not used, the other upstreams still get
+			// the transaction after the response is sent
+			sendCtx, cancel := context.WithTimeout(context.Background(), BroadcastTimeout)
+			defer cancel()
+
+			u.requestMeter.Mark(1)
+			var hash common.Hash
+			err := u.client.CallContext(sendCtx, &hash, "eth_sendRawTransaction", rawTxHex)
+			if isUpstreamError(sendCtx, err) {
+				u.failed(err, time.Now())
+			}
+			results <- result{i, hash, err}
+		}(i, u)
+	}
+
+	errs := make([]error, count)
+	for i := 0; i < count; i++ {
+		select {
+		case r := <-results:
+			if r.err == nil {
+				return r.hash, nil
+			}
+			errs[r.index] = r.err
+		case <-ctx.Done():
+			return common.Hash{}, ctx.Err()
+		}
+	}
+	return common.Hash{}, errs[0]
+}
@@ -0,0 +1,206 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/common/hexutil"
+	"github.com/QuantumCoinProject/qc/rpc"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testNode is the eth API of an in-process upstream.
+type testNode struct {
+	lock    sync.Mutex
+	head    uint64
+	syncing bool
+	sent    []string
+	reject  bool
+}
+
+func (n *testNode) BlockNumber() hexutil.Uint64 {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return hexutil.Uint64(n.head)
+}
+
+func (n *testNode) Syncing() (interface{}, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.syncing {
+		return map[string]interface{}{"currentBlock": hexutil.Uint64(n.head)}, nil
+	}
+	return false, nil
+}
+
+func (n *testNode) SendRawTransaction(rawTxHex string) (common.Hash, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.reject {
+		return common.Hash{}, errors.New("nonce too low")
+	}
+	n.sent = append(n.sent, rawTxHex)
+	return common.Hash{0x01}, nil
+}
+
+func (n *testNode) sentCount() int {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return len(n.sent)
+}
+
+func newTestPool(t *testing.T, nodes ...*testNode) *Pool {
+	upstreams := make([]*Upstream, len(nodes))
+	for i, node := range nodes {
+		server := rpc.NewServer()
+		if err := server.RegisterName("eth", node); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(server.Stop)
+		upstreams[i] = newUpstream("inproc-"+string(rune('a'+i)), rpc.DialInProc(server))
+	}
+	pool, err := newPool(upstreams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func TestPoolRouting(t *testing.T) {
+	behind := &testNode{head: 90}
+	syncing := &testNode{head: 100, syncing: true}
+	healthy := &testNode{head: 100}
+	pool := newTestPool(t, behind, syncing, healthy)
+	pool.checkAll()
+
+	if best := pool.Best(); best.Url != "inproc-c" {
+		t.Fatalf("best upstream %s, want inproc-c", best.Url)
+	}
+
+	// Once it catches up, the first upstream is healthy again
+	behind.lock.Lock()
+	behind.head = 98
+	behind.lock.Unlock()
+	pool.checkAll()
+	ranked := pool.ranked()
+	if ranked[2].Url != "inproc-b" {
+		t.Fatalf("syncing upstream ranked %v", pool.Urls())
+	}
+	for _, u := range ranked[:2] {
+		if pool.isHealthy(u.state(time.Now()), pool.maxHead()) == false {
+			t.Fatalf("upstream %s not healthy", u.Url)
+		}
+	}
+}
+
+func TestPoolFailover(t *testing.T) {
+	first, second := &testNode{head: 100}, &testNode{head: 100}
+	pool := newTestPool(t, first, second)
+	pool.checkAll()
+
+	// The call fails over to the other upstream, and the failed one is no
+	// longer preferred
+	failing := pool.Best()
+	failing.client.Close()
+	var head hexutil.Uint64
+	if err := pool.CallContext(context.Background(), &head, "eth_blockNumber"); err != nil || head != 100 {
+		t.Fatalf("call failed: %v, head %d", err, head)
+	}
+	if pool.Best() == failing {
+		t.Fatal("failed upstream still preferred")
+	}
+
+	// Its circuit opens after enough failed health checks
+	for i := 1; i < FailureThreshold; i++ {
+		pool.checkAll()
+	}
+	if failing.isOpen(time.Now()) == false {
+		t.Fatal("circuit not open")
+	}
+	// Open circuits are not checked until CircuitOpenDuration passes
+	pool.checkAll()
+	if failures := failing.state(time.Now()); failing.failures != FailureThreshold || failures.open == false {
+		t.Fatalf("%d failures, want %d", failing.failures, FailureThreshold)
+	}
+	if ranked := pool.ranked(); ranked[len(ranked)-1] != failing {
+		t.Fatal("open upstream not ranked last")
+	}
+
+	// Errors returned by the node are not failures of the upstream
+	other := pool.Best()
+	if err := pool.CallContext(context.Background(), nil, "eth_unknown"); err == nil {
+		t.Fatal("expected error")
+	}
+	if other.isOpen(time.Now()) || other.failures != 0 {
+		t.Fatal("node error counted as upstream failure")
+	}
+}
+
+func TestPoolFailoverSequence(t *testing.T) {
+	first, second := &testNode{head: 100}, &testNode{head: 100}
+	pool := newTestPool(t, first, second)
+	pool.checkAll()
+
+	// A sequence of calls runs on one upstream, and is retried as a whole on
+	// the next one if the upstream fails part way
+	failing := pool.Best()
+	calls := 0
+	clients := make(map[*rpc.Client]int)
+	err := pool.Failover(context.Background(), func(client *rpc.Client) error {
+		for i := 0; i < 2; i++ {
+			calls++
+			if calls == 2 {
+				failing.client.Close()
+			}
+			var head hexutil.Uint64
+			if err := client.CallContext(context.Background(), &head, "eth_blockNumber"); err != nil {
+				return err
+			}
+			clients[client]++
+		}
+		return nil
+	})
+	if err != nil || calls != 4 {
+		t.Fatalf("sequence failed: %v, %d calls", err, calls)
+	}
+	if clients[failing.client] != 1 || len(clients) != 2 || failing.failures != 1 {
+		t.Fatalf("sequence not retried on the next upstream: %v, %d failures", clients, failing.failures)
+	}
+}
+
+func TestPoolBroadcast(t *testing.T) {
+	nodes := []*testNode{{head: 100}, {head: 100, reject: true}, {head: 100}}
+	pool := newTestPool(t, nodes...)
+	pool.checkAll()
+
+	hash, err := pool.SendRawTransaction(context.Background(), "0x01")
+	if err != nil || hash != (common.Hash{0x01}) {
+		t.Fatalf("unexpected result %x, %v", hash, err)
+	}
+	// Sending continues in the background after the first success
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sent := 0
+		for _, node := range nodes {
+			sent += node.sentCount()
+		}
+		if sent == BroadcastCount-1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("transaction sent to %d upstreams, want %d", sent, BroadcastCount-1)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, node := range nodes {
+		node.lock.Lock()
+		node.reject = true
+		node.lock.Unlock()
+	}
+	if _, err := pool.SendRawTransaction(context.Background(), "0x02"); err == nil || err.Error() != "nonce too low" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package systemcontracts
+
+import (
+	"errors"
+	"fmt"
+	"github.com/QuantumCoinProject/qc/accounts/abi"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/state"
+	"github.com/QuantumCoinProject/qc/core/types"
+)
+
+// CALL_GAS is the gas available to read-only calls, the same as the default RPC gas cap.
+const CALL_GAS = uint64(50000000)
+
+var (
+	ErrUnknownBlock = errors.New("unknown block")
+	ErrEmptyResult  = errors.New("system contract call returned no data")
+)
+
+// Backend executes calls to system contracts. It is implemented by core.BlockChain.
+type Backend interface {
+	GetHeaderByHash(hash common.Hash) *types.Header
+	StateAt(root common.Hash) (*state.StateDB, error)
+
+	// ExecuteSystemCall applies a privileged call from ZERO_ADDRESS that is not charged gas.
+	ExecuteSystemCall(to common.Address, data []byte, state *state.StateDB, header *types.Header) ([]byte, error)
+
+	// CallContract executes a read-only call capped at gas.
+	CallContract(to common.Address, data []byte, gas uint64, state *state.StateDB, header *types.Header) ([]byte, error)
+}
+
+// Caller packs calls to a system contract, executes them against a Backend and unpacks the results.
+type Caller struct {
+	backend Backend
+	address common.Address
+	abi     abi.ABI
+}
+
+func NewCaller(backend Backend, address common.Address, abiData abi.ABI) *Caller {
+	return &Caller{
+		backend: backend,
+		address: address,
+		abi:     abiData,
+	}
+}
+
+func (c *Caller) Address() common.Address {
+	return c.address
+}
+
+func (c *Caller) ABI() abi.ABI {
+	return c.abi
+}
+
+// Call executes a read-only call against the state of the given block. The result is unpacked
+// into out, which is left untouched if nil.
+func (c *Caller) Call(blockHash common.Hash, out interface{}, method string, args ...interface{}) error {
+	if c.backend == nil {
+		return errors.New("system contract backend not set")
+	}
+	header := c.backend.GetHeaderByHash(blockHash)
+	if header == nil {
+		return ErrUnknownBlock
+	}
+	state, err := c.backend.StateAt(header.Root)
+	if err != nil {
+		return err
+	}
+	return c.call(state, header, out, method, args...)
+}
+
+// CallAt executes a read-only call against a copy of the given state.
+func (c *Caller) CallAt(state *state.StateDB, header *types.Header, out interface{}, method string, args ...interface{}) error {
+	return c.call(state.Copy(), header, out, method, args...)
+}
+
+func (c *Caller) call(state *state.StateDB, header *types.Header, out interface{}, method string, args ...interface{}) error {
+	data, err := c.abi.Pack(method, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	result, err := c.backend.CallContract(c.address, data, CALL_GAS, state, header)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	return c.unpack(out, method, result)
+}
+
+// Execute applies a privileged call from ZERO_ADDRESS to the given state. It is used by the consensus
+// engine to update system contracts while finalizing a block.
+func (c *Caller) Execute(state *state.StateDB, header *types.Header, out interface{}, method string, args ...interface{}) error {
+	data, err := c.abi.Pack(method, args...)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	result, err := c.backend.ExecuteSystemCall(c.address, data, state, header)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	return c.unpack(out, method, result)
+}
+
+func (c *Caller) unpack(out interface{}, method string, result []byte) error {
+	if out == nil {
+		return nil
+	}
+	if len(result) == 0 {
+		return fmt.Errorf("%s: %w", method, ErrEmptyResult)
+	}
+	if err := c.abi.UnpackIntoInterface(out, method, result); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package systemcontracts_test
+
+import (
+	"errors"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/core/state"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/core/vm/runtime"
+	"github.com/QuantumCoinProject/qc/systemcontracts"
+	"github.com/QuantumCoinProject/qc/systemcontracts/consensuscontext"
+	"math"
+	"math/big"
+	"testing"
+)
+
+// testBackend runs calls with the EVM runtime against a single in-memory state.
+type testBackend struct {
+	header *types.Header
+	state  *state.StateDB
+}
+
+func newTestBackend() *testBackend {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.SetCode(consensuscontext.CONSENSUS_CONTEXT_CONTRACT_ADDRESS, common.FromHex(consensuscontext.CONSENSUS_CONTEXT_RUNTIME_BIN))
+	return &testBackend{
+		header: &types.Header{Number: big.NewInt(1)},
+		state:  statedb,
+	}
+}
+
+func (b *testBackend) GetHeaderByHash(hash common.Hash) *types.Header {
+	if hash != b.header.Hash() {
+		return nil
+	}
+	return b.header
+}
+
+func (b *testBackend) StateAt(root common.Hash) (*state.StateDB, error) {
+	return b.state.Copy(), nil
+}
+
+func (b *testBackend) ExecuteSystemCall(to common.Address, data []byte, state *state.StateDB, header *types.Header) ([]byte, error) {
+	return b.CallContract(to, data, math.MaxUint64, state, header)
+}
+
+func (b *testBackend) CallContract(to common.Address, data []byte, gas uint64, state *state.StateDB, header *types.Header) ([]byte, error) {
+	ret, _, err := runtime.Call(to, data, &runtime.Config{
+		Origin:      common.ZERO_ADDRESS,
+		State:       state,
+		GasLimit:    gas,
+		BlockNumber: header.Number,
+	})
+	return ret, err
+}
+
+func newContextCaller(t *testing.T, backend systemcontracts.Backend, address common.Address) *systemcontracts.Caller {
+	abiData, err := consensuscontext.GetConsensusContract_ABI()
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	return systemcontracts.NewCaller(backend, address, abiData)
+}
+
+func TestCaller_ExecuteAndCall(t *testing.T) {
+	backend := newTestBackend()
+	caller := newContextCaller(t, backend, consensuscontext.CONSENSUS_CONTEXT_CONTRACT_ADDRESS)
+
+	var context [32]byte
+	context[0] = 7
+	err := caller.Execute(backend.state, backend.header, nil, consensuscontext.SET_CONTEXT_METHOD, "bc-1", context)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	var out [32]byte
+	if err = caller.Call(backend.header.Hash(), &out, consensuscontext.GET_CONTEXT_METHOD, "bc-1"); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if out != context {
+		t.Fatalf("failed %v", out)
+	}
+
+	//Read-only calls must not change the state they are executed on
+	err = caller.CallAt(backend.state, backend.header, nil, consensuscontext.DELETE_CONTEXT_METHOD, "bc-1")
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if err = caller.CallAt(backend.state, backend.header, &out, consensuscontext.GET_CONTEXT_METHOD, "bc-1"); err != nil || out != context {
+		t.Fatalf("failed %v %v", out, err)
+	}
+}
+
+func TestCaller_Errors(t *testing.T) {
+	backend := newTestBackend()
+	caller := newContextCaller(t, backend, consensuscontext.CONSENSUS_CONTEXT_CONTRACT_ADDRESS)
+
+	var out [32]byte
+	if err := caller.Call(common.Hash{1}, &out, consensuscontext.GET_CONTEXT_METHOD, "bc-1"); err != systemcontracts.ErrUnknownBlock {
+		t.Fatalf("failed %v", err)
+	}
+	if err := caller.Call(backend.header.Hash(), &out, "unknownMethod"); err == nil {
+		t.Fatalf("failed")
+	}
+
+	noCode := newContextCaller(t, backend, common.HexToAddress("0x9000"))
+	err := noCode.Call(backend.header.Hash(), &out, consensuscontext.GET_CONTEXT_METHOD, "bc-1")
+	if errors.Is(err, systemcontracts.ErrEmptyResult) == false {
+		t.Fatalf("failed %v", err)
+	}
+}
@@ -6,10 +6,8 @@ import (
 )
 import "github.com/QuantumCoinProject/qc/accounts/abi"
 
-// Steps after Contract is modified
-// 1) solc --bin --bin-runtime --abi c:\github\go-dp\systemcontracts\consensuscontext\ConsensusContextContract.sol  -o c:\github\go-dp\systemcontracts\consensuscontext
-// 2) abigen --bin=c:\github\go-dp\systemcontracts\consensuscontext\ConsensusContextContract.bin --abi=c:\github\go-dp\systemcontracts\consensuscontext\ConsensusContextContract.abi --pkg=consensuscontext --out=c:\github\go-dp\systemcontracts\consensuscontext\ConsensusContext.go
-// 3) copy ConsensusContextContract-runtime.bin into consensuscontextbin.go CONTEXT_RUNTIME_BIN field
+// After the contract is modified, run go generate in systemcontracts/consensuscontext to recompile it and
+// regenerate the Go bindings and the runtime bytecode (see gen.go).
 
 const CONSENSUS_CONTEXT_CONTRACT = "0x0000000000000000000000000000000000000000000000000000000000003000"
 
@@ -0,0 +1,6 @@
+package consensuscontext
+
+// Run go generate in this directory after ConsensusContextContract.sol is modified. solc must be on the path.
+//go:generate solc --bin --bin-runtime --abi --overwrite ConsensusContextContract.sol -o .
+//go:generate go run ../../cmd/abigen --bin=ConsensusContextContract.bin --abi=ConsensusContextContract.abi --pkg=consensuscontext --out=ConsensusContext.go
+//go:generate go run ../genbin -bin ConsensusContextContract.bin-runtime -pkg consensuscontext -name CONSENSUS_CONTEXT_RUNTIME_BIN -out consensuscontextbin.go
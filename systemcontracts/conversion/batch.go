@@ -0,0 +1,150 @@
+package conversion
+
+import (
+	"errors"
+	"github.com/QuantumCoinProject/qc/accounts/abi"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/crypto"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// The conversion batch contract has no EVM code. Transactions sent to CONVERSION_BATCH_CONTRACT_ADDRESS
+// carry several conversion requests for the same quantum address, and are processed by the consensus
+// engine in Finalize, in the same way as the single requests sent to the conversion contract.
+const CONVERSION_BATCH_CONTRACT = "0x0000000000000000000000000000000000000000000000000000000000006000"
+
+var CONVERSION_BATCH_CONTRACT_ADDRESS = common.HexToAddress(CONVERSION_BATCH_CONTRACT)
+
+const REQUEST_CONVERSION_BATCH_METHOD = "requestConversionBatch"
+
+const CONVERSION_BATCH_ABI = `[
+	{"inputs":[{"internalType":"string[]","name":"ethAddresses","type":"string[]"},{"internalType":"string[]","name":"ethSignatures","type":"string[]"}],"name":"requestConversionBatch","outputs":[],"stateMutability":"nonpayable","type":"function"}
+]`
+
+var MAX_CONVERSION_BATCH_SIZE = 128
+
+// Block from which batch conversions are accepted and unclaimed snapshot amounts expire
+var CONVERSION_V2_START_BLOCK = uint64(math.MaxUint64) //To be scheduled
+
+var (
+	ErrInvalidConversionBatch = errors.New("invalid conversion batch")
+	ErrConversionBatchSize    = errors.New("conversion batch is empty or too large")
+	ErrExpiryBalance          = errors.New("conversion contract balance is lower than the expired amount")
+)
+
+type ConversionRequest struct {
+	EthAddress   string `json:"ethAddress"`
+	EthSignature string `json:"ethSignature"`
+}
+
+func GetConversionBatchContract_ABI() (abi.ABI, error) {
+	a, err := abi.JSON(strings.NewReader(CONVERSION_BATCH_ABI))
+	return a, err
+}
+
+func PackConversionBatch(requests []*ConversionRequest) ([]byte, error) {
+	if len(requests) == 0 || len(requests) > MAX_CONVERSION_BATCH_SIZE {
+		return nil, ErrConversionBatchSize
+	}
+	abiData, err := GetConversionBatchContract_ABI()
+	if err != nil {
+		return nil, err
+	}
+	ethAddresses := make([]string, len(requests))
+	ethSignatures := make([]string, len(requests))
+	for i, request := range requests {
+		ethAddresses[i] = request.EthAddress
+		ethSignatures[i] = request.EthSignature
+	}
+	return abiData.Pack(REQUEST_CONVERSION_BATCH_METHOD, ethAddresses, ethSignatures)
+}
+
+func UnpackConversionBatch(data []byte) ([]*ConversionRequest, error) {
+	if len(data) < 4 {
+		return nil, ErrInvalidConversionBatch
+	}
+	abiData, err := GetConversionBatchContract_ABI()
+	if err != nil {
+		return nil, err
+	}
+	method, err := abiData.MethodById(data[:4])
+	if err != nil || method.Name != REQUEST_CONVERSION_BATCH_METHOD {
+		return nil, ErrInvalidConversionBatch
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, err
+	}
+	ethAddresses := args[0].([]string)
+	ethSignatures := args[1].([]string)
+	if len(ethAddresses) != len(ethSignatures) {
+		return nil, ErrInvalidConversionBatch
+	}
+	if len(ethAddresses) == 0 || len(ethAddresses) > MAX_CONVERSION_BATCH_SIZE {
+		return nil, ErrConversionBatchSize
+	}
+	requests := make([]*ConversionRequest, len(ethAddresses))
+	for i := range ethAddresses {
+		requests[i] = &ConversionRequest{EthAddress: ethAddresses[i], EthSignature: ethSignatures[i]}
+	}
+	return requests, nil
+}
+
+// StateDB is the subset of the state database needed to expire unclaimed conversions.
+type StateDB interface {
+	GetState(common.Address, common.Hash) common.Hash
+	SetState(common.Address, common.Hash, common.Hash)
+	GetBalance(common.Address) *big.Int
+	AddBalance(common.Address, *big.Int)
+	SubBalance(common.Address, *big.Int)
+}
+
+// The expiry markers are kept in the storage of the conversion contract, under keys that do not
+// overlap with the slots of the solidity mappings.
+var (
+	expiryProcessedKey = crypto.Keccak256Hash([]byte("expiryProcessed"))
+	expiryCursorKey    = crypto.Keccak256Hash([]byte("expiryCursor"))
+)
+
+func expiredKey(ethAddress common.Address) common.Hash {
+	return crypto.Keccak256Hash([]byte("expired"), ethAddress.Bytes())
+}
+
+func IsExpired(db StateDB, ethAddress common.Address) bool {
+	return db.GetState(CONVERSION_CONTRACT_ADDRESS, expiredKey(ethAddress)) != (common.Hash{})
+}
+
+func IsExpiryProcessed(db StateDB) bool {
+	return db.GetState(CONVERSION_CONTRACT_ADDRESS, expiryProcessedKey) != (common.Hash{})
+}
+
+func SetExpiryProcessed(db StateDB, blockNumber uint64) {
+	db.SetState(CONVERSION_CONTRACT_ADDRESS, expiryProcessedKey, common.BigToHash(new(big.Int).SetUint64(blockNumber)))
+}
+
+// GetExpiryCursor returns the number of snapshot entries, in address order, that the expiry has
+// visited so far.
+func GetExpiryCursor(db StateDB) uint64 {
+	return db.GetState(CONVERSION_CONTRACT_ADDRESS, expiryCursorKey).Big().Uint64()
+}
+
+func SetExpiryCursor(db StateDB, cursor uint64) {
+	db.SetState(CONVERSION_CONTRACT_ADDRESS, expiryCursorKey, common.BigToHash(new(big.Int).SetUint64(cursor)))
+}
+
+// Expire marks an unconverted snapshot entry as expired and moves its amount from the conversion
+// contract to the recipient. Expired entries can no longer be converted.
+func Expire(db StateDB, ethAddress common.Address, amount *big.Int, recipient common.Address) error {
+	if IsExpired(db, ethAddress) {
+		return nil
+	}
+	if db.GetBalance(CONVERSION_CONTRACT_ADDRESS).Cmp(amount) < 0 {
+		return ErrExpiryBalance
+	}
+	db.SetState(CONVERSION_CONTRACT_ADDRESS, expiredKey(ethAddress), common.BigToHash(big.NewInt(1)))
+	db.SubBalance(CONVERSION_CONTRACT_ADDRESS, amount)
+	db.AddBalance(recipient, amount)
+	return nil
+}
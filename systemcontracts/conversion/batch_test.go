@@ -0,0 +1,74 @@
+package conversion
+
+import (
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/core/state"
+	"math/big"
+	"testing"
+)
+
+func TestConversionBatch_PackUnpack(t *testing.T) {
+	requests := []*ConversionRequest{
+		{EthAddress: "0x9d0beec8d63ef6484686d1f8470be62a210b7dbd", EthSignature: "0x01"},
+		{EthAddress: "0x4c581f07cc836e62800b3c05d1ccd6d115c916e5", EthSignature: "0x02"},
+	}
+	data, err := PackConversionBatch(requests)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	unpacked, err := UnpackConversionBatch(data)
+	if err != nil || len(unpacked) != 2 {
+		t.Fatalf("failed %v %v", unpacked, err)
+	}
+	for i := range requests {
+		if *unpacked[i] != *requests[i] {
+			t.Fatalf("failed %v", unpacked[i])
+		}
+	}
+
+	if _, err = PackConversionBatch(nil); err != ErrConversionBatchSize {
+		t.Fatalf("failed %v", err)
+	}
+	if _, err = UnpackConversionBatch([]byte{1, 2, 3, 4, 5}); err != ErrInvalidConversionBatch {
+		t.Fatalf("failed %v", err)
+	}
+}
+
+func TestConversion_Expire(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.AddBalance(CONVERSION_CONTRACT_ADDRESS, big.NewInt(1000))
+	ethAddress := common.HexToAddress("0x9d0beec8d63ef6484686d1f8470be62a210b7dbd")
+	recipient := common.HexToAddress("0x0000000000000000000000000000000000000000000000000000000000000099")
+
+	if IsExpired(statedb, ethAddress) || IsExpiryProcessed(statedb) {
+		t.Fatalf("failed")
+	}
+	if err := Expire(statedb, ethAddress, big.NewInt(2000), recipient); err == nil {
+		t.Fatalf("expired more than the contract balance")
+	}
+	if err := Expire(statedb, ethAddress, big.NewInt(600), recipient); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	//Expiring again does not move funds twice
+	if err := Expire(statedb, ethAddress, big.NewInt(600), recipient); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if IsExpired(statedb, ethAddress) == false || statedb.GetBalance(recipient).Cmp(big.NewInt(600)) != 0 ||
+		statedb.GetBalance(CONVERSION_CONTRACT_ADDRESS).Cmp(big.NewInt(400)) != 0 {
+		t.Fatalf("failed")
+	}
+
+	if GetExpiryCursor(statedb) != 0 {
+		t.Fatalf("failed")
+	}
+	SetExpiryCursor(statedb, 256)
+	if GetExpiryCursor(statedb) != 256 {
+		t.Fatalf("failed")
+	}
+
+	SetExpiryProcessed(statedb, 100)
+	if IsExpiryProcessed(statedb) == false {
+		t.Fatalf("failed")
+	}
+}
@@ -6,10 +6,8 @@ import (
 	"strings"
 )
 
-// Steps after Contract is modified
-// 1) solc --bin --bin-runtime --abi c:\github\go-dp\systemcontracts\conversion\ConversionContract.sol  -o c:\github\go-dp\systemcontracts\conversion
-// 2) abigen --bin=c:\github\go-dp\systemcontracts\conversion\ConversionContract.bin --abi=c:\github\go-dp\systemcontracts\conversion\ConversionContract.abi --pkg=conversion --out=c:\github\go-dp\systemcontracts\conversion\conversion.go
-// 3) copy ConversionContract-runtime.bin into conversionbin.go CONVERSION_RUNTIME_BIN field
+// After the contract is modified, run go generate in systemcontracts/conversion to recompile it and
+// regenerate the Go bindings and the runtime bytecode (see gen.go).
 const CONVERSION_CONTRACT = "0x0000000000000000000000000000000000000000000000000000000000002000"
 
 var CONVERSION_CONTRACT_ADDRESS = common.HexToAddress(CONVERSION_CONTRACT)
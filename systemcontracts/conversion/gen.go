@@ -0,0 +1,6 @@
+package conversion
+
+// Run go generate in this directory after ConversionContract.sol is modified. solc must be on the path.
+//go:generate solc --bin --bin-runtime --abi --overwrite ConversionContract.sol -o .
+//go:generate go run ../../cmd/abigen --bin=ConversionContract.bin --abi=ConversionContract.abi --pkg=conversion --type=Conversion --out=conversion.go
+//go:generate go run ../genbin -bin ConversionContract.bin-runtime -pkg conversion -name CONVERSION_RUNTIME_BIN -out conversionbin.go
@@ -0,0 +1,49 @@
+// genbin writes the runtime bytecode emitted by solc into a Go constant, so that the consensus
+// engine can install the code of a system contract without reading files at run time.
+//
+// Usage: go run github.com/QuantumCoinProject/qc/systemcontracts/genbin -bin X.bin-runtime -pkg pkg -name X_RUNTIME_BIN -out xbin.go
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+var (
+	binFlag  = flag.String("bin", "", "Path to the runtime bytecode generated by solc --bin-runtime")
+	pkgFlag  = flag.String("pkg", "", "Package name of the generated file")
+	nameFlag = flag.String("name", "", "Name of the generated constant")
+	outFlag  = flag.String("out", "", "Output file")
+)
+
+func main() {
+	flag.Parse()
+	if *binFlag == "" || *pkgFlag == "" || *nameFlag == "" || *outFlag == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if err := generate(*binFlag, *pkgFlag, *nameFlag, *outFlag); err != nil {
+		fmt.Fprintln(os.Stderr, "genbin:", err)
+		os.Exit(1)
+	}
+}
+
+func generate(binFile string, pkg string, name string, outFile string) error {
+	data, err := ioutil.ReadFile(binFile)
+	if err != nil {
+		return err
+	}
+	code := strings.TrimSpace(string(data))
+	if len(code) == 0 {
+		return fmt.Errorf("%s is empty", binFile)
+	}
+	if _, err := hex.DecodeString(code); err != nil {
+		return fmt.Errorf("%s is not hex encoded: %v", binFile, err)
+	}
+	src := fmt.Sprintf("package %s\n\nconst %s = \"%s\"\n", pkg, name, code)
+	return ioutil.WriteFile(outFile, []byte(src), 0644)
+}
@@ -0,0 +1,44 @@
+package governance
+
+import (
+	"github.com/QuantumCoinProject/qc/accounts/abi"
+	"github.com/QuantumCoinProject/qc/common"
+	"math/big"
+	"strings"
+)
+
+// The governance contract has no EVM code. Like conversion requests, transactions sent to
+// GOVERNANCE_CONTRACT_ADDRESS are picked up by the consensus engine in Finalize, and their
+// ABI encoded data is applied to the storage of the contract address.
+const GOVERNANCE_CONTRACT = "0x0000000000000000000000000000000000000000000000000000000000004000"
+
+var GOVERNANCE_CONTRACT_ADDRESS = common.HexToAddress(GOVERNANCE_CONTRACT)
+
+const PROPOSE_METHOD = "propose"
+const VOTE_METHOD = "vote"
+
+const GOVERNANCE_ABI = `[
+	{"inputs":[{"internalType":"uint8","name":"parameter","type":"uint8"},{"internalType":"uint256","name":"value","type":"uint256"},{"internalType":"uint256","name":"effectiveBlock","type":"uint256"}],"name":"propose","outputs":[],"stateMutability":"nonpayable","type":"function"},
+	{"inputs":[{"internalType":"uint256","name":"proposalId","type":"uint256"},{"internalType":"bool","name":"support","type":"bool"}],"name":"vote","outputs":[],"stateMutability":"nonpayable","type":"function"}
+]`
+
+func GetGovernanceContract_ABI() (abi.ABI, error) {
+	a, err := abi.JSON(strings.NewReader(GOVERNANCE_ABI))
+	return a, err
+}
+
+func PackPropose(parameter Parameter, value *big.Int, effectiveBlock uint64) ([]byte, error) {
+	abiData, err := GetGovernanceContract_ABI()
+	if err != nil {
+		return nil, err
+	}
+	return abiData.Pack(PROPOSE_METHOD, uint8(parameter), value, new(big.Int).SetUint64(effectiveBlock))
+}
+
+func PackVote(proposalId uint64, support bool) ([]byte, error) {
+	abiData, err := GetGovernanceContract_ABI()
+	if err != nil {
+		return nil, err
+	}
+	return abiData.Pack(VOTE_METHOD, new(big.Int).SetUint64(proposalId), support)
+}
@@ -0,0 +1,639 @@
+package governance
+
+import (
+	"errors"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/crypto"
+	"github.com/QuantumCoinProject/qc/params"
+	"math"
+	"math/big"
+)
+
+type Parameter uint8
+
+const (
+	PARAMETER_SLASH_AMOUNT               Parameter = 1
+	PARAMETER_TXN_FEE_REWARDS_PERCENTAGE Parameter = 2
+	PARAMETER_GAS_TIER_PRICE             Parameter = 3
+	//Block after which unconverted snapshot amounts expire, 0 if there is no deadline
+	PARAMETER_CONVERSION_DEADLINE_BLOCK Parameter = 4
+	//Address that expired snapshot amounts are moved to
+	PARAMETER_CONVERSION_UNCLAIMED_ADDRESS Parameter = 5
+)
+
+type ProposalStatus uint8
+
+const (
+	PROPOSAL_STATUS_NONE     ProposalStatus = 0
+	PROPOSAL_STATUS_VOTING   ProposalStatus = 1
+	PROPOSAL_STATUS_PASSED   ProposalStatus = 2
+	PROPOSAL_STATUS_REJECTED ProposalStatus = 3
+	PROPOSAL_STATUS_APPLIED  ProposalStatus = 4
+	PROPOSAL_STATUS_TALLYING ProposalStatus = 5
+)
+
+const (
+	VOTE_NONE uint64 = 0
+	VOTE_YES  uint64 = 1
+	VOTE_NO   uint64 = 2
+)
+
+var (
+	VOTING_PERIOD_BLOCKS       = uint64(32000)
+	MIN_EXECUTION_DELAY_BLOCKS = uint64(4096)
+	MAX_EXECUTION_DELAY_BLOCKS = uint64(512000)
+
+	//Percentage of the total deposited balance that has to vote for the result to count
+	QUORUM_PERCENTAGE = int64(33)
+	//Percentage of the voted balance that has to vote yes for a proposal to pass
+	PASS_PERCENTAGE = int64(67)
+
+	//Number of proposals a depositor can have in voting or being tallied at the same time
+	MAX_OPEN_PROPOSALS_PER_PROPOSER = uint64(4)
+	//Number of votes weighed per block; proposals whose voting ended are tallied in order across blocks
+	MAX_TALLY_VOTES_PER_BLOCK = uint64(256)
+)
+
+var (
+	ErrUnknownParameter      = errors.New("unknown governance parameter")
+	ErrParameterOutOfRange   = errors.New("governance parameter value out of range")
+	ErrInvalidEffectiveBlock = errors.New("effective block is outside the allowed execution delay")
+	ErrNotDepositor          = errors.New("only depositors with a staking balance can propose or vote")
+	ErrUnknownProposal       = errors.New("unknown proposal")
+	ErrVotingClosed          = errors.New("voting is closed for the proposal")
+	ErrAlreadyVoted          = errors.New("depositor has already voted on the proposal")
+	ErrNotInitialized        = errors.New("governance contract is not initialized")
+	ErrUnknownMethod         = errors.New("unknown governance method")
+	ErrTooManyOpenProposals  = errors.New("proposer has too many open proposals")
+)
+
+type parameterRange struct {
+	min *big.Int
+	max *big.Int
+}
+
+var parameterRanges = map[Parameter]parameterRange{
+	PARAMETER_SLASH_AMOUNT:                 {big.NewInt(0), params.EtherToWei(big.NewInt(10000))},
+	PARAMETER_TXN_FEE_REWARDS_PERCENTAGE:   {big.NewInt(0), big.NewInt(100)},
+	PARAMETER_GAS_TIER_PRICE:               {big.NewInt(1), new(big.Int).Mul(types.GAS_TIER_DEFAULT_PRICE, big.NewInt(100))},
+	PARAMETER_CONVERSION_DEADLINE_BLOCK:    {big.NewInt(0), new(big.Int).SetUint64(math.MaxUint64)},
+	PARAMETER_CONVERSION_UNCLAIMED_ADDRESS: {big.NewInt(0), new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))},
+}
+
+var parameterNames = map[Parameter]string{
+	PARAMETER_SLASH_AMOUNT:                 "slashAmount",
+	PARAMETER_TXN_FEE_REWARDS_PERCENTAGE:   "txnFeeRewardsPercentage",
+	PARAMETER_GAS_TIER_PRICE:               "gasTierPrice",
+	PARAMETER_CONVERSION_DEADLINE_BLOCK:    "conversionDeadlineBlock",
+	PARAMETER_CONVERSION_UNCLAIMED_ADDRESS: "conversionUnclaimedAddress",
+}
+
+func (p Parameter) String() string {
+	name, ok := parameterNames[p]
+	if ok == false {
+		return "unknown"
+	}
+	return name
+}
+
+func Parameters() []Parameter {
+	return []Parameter{PARAMETER_SLASH_AMOUNT, PARAMETER_TXN_FEE_REWARDS_PERCENTAGE, PARAMETER_GAS_TIER_PRICE,
+		PARAMETER_CONVERSION_DEADLINE_BLOCK, PARAMETER_CONVERSION_UNCLAIMED_ADDRESS}
+}
+
+func ParameterByName(name string) (Parameter, error) {
+	for p, n := range parameterNames {
+		if n == name {
+			return p, nil
+		}
+	}
+	return 0, ErrUnknownParameter
+}
+
+func ValidateParameter(parameter Parameter, value *big.Int) error {
+	r, ok := parameterRanges[parameter]
+	if ok == false {
+		return ErrUnknownParameter
+	}
+	if value == nil || value.Cmp(r.min) < 0 || value.Cmp(r.max) > 0 {
+		return ErrParameterOutOfRange
+	}
+	return nil
+}
+
+// StateDB is the subset of the state database the governance contract needs.
+type StateDB interface {
+	GetState(common.Address, common.Hash) common.Hash
+	SetState(common.Address, common.Hash, common.Hash)
+	GetNonce(common.Address) uint64
+	SetNonce(common.Address, uint64)
+}
+
+// StakeReader returns staking balances that voting weight is derived from.
+type StakeReader interface {
+	GetBalanceOfDepositor(depositor common.Address) (*big.Int, error)
+	GetTotalDepositedBalance() (*big.Int, error)
+}
+
+type Proposal struct {
+	Id             uint64
+	Proposer       common.Address
+	Parameter      Parameter
+	Value          *big.Int
+	StartBlock     uint64
+	EndBlock       uint64
+	EffectiveBlock uint64
+	Status         ProposalStatus
+	VoterCount     uint64
+	YesWeight      *big.Int
+	NoWeight       *big.Int
+}
+
+type Tally struct {
+	YesWeight             *big.Int
+	NoWeight              *big.Int
+	TotalDepositedBalance *big.Int
+	QuorumReached         bool
+	Passed                bool
+}
+
+// Storage layout of the governance contract address
+var (
+	initializedKey   = common.BytesToHash([]byte("initialized"))
+	proposalCountKey = common.BytesToHash([]byte("proposalCount"))
+	tallyHeadKey     = common.BytesToHash([]byte("tallyHead"))
+	tallyTailKey     = common.BytesToHash([]byte("tallyTail"))
+)
+
+const (
+	proposalFieldProposer = iota
+	proposalFieldParameter
+	proposalFieldValue
+	proposalFieldStartBlock
+	proposalFieldEndBlock
+	proposalFieldEffectiveBlock
+	proposalFieldStatus
+	proposalFieldVoterCount
+	proposalFieldYesWeight
+	proposalFieldNoWeight
+	proposalFieldTalliedCount
+)
+
+func uint64Bytes(v uint64) []byte {
+	return new(big.Int).SetUint64(v).FillBytes(make([]byte, 8))
+}
+
+func parameterKey(parameter Parameter) common.Hash {
+	return crypto.Keccak256Hash([]byte("parameter"), []byte{byte(parameter)})
+}
+
+func proposalKey(id uint64, field int) common.Hash {
+	base := crypto.Keccak256Hash([]byte("proposal"), uint64Bytes(id)).Big()
+	return common.BigToHash(base.Add(base, big.NewInt(int64(field))))
+}
+
+func voterKey(id uint64, index uint64) common.Hash {
+	return crypto.Keccak256Hash([]byte("voter"), uint64Bytes(id), uint64Bytes(index))
+}
+
+func voteKey(id uint64, voter common.Address) common.Hash {
+	return crypto.Keccak256Hash([]byte("vote"), uint64Bytes(id), voter.Bytes())
+}
+
+func openProposalsKey(proposer common.Address) common.Hash {
+	return crypto.Keccak256Hash([]byte("openProposals"), proposer.Bytes())
+}
+
+func tallyItemKey(index uint64) common.Hash {
+	return crypto.Keccak256Hash([]byte("tally"), uint64Bytes(index))
+}
+
+func scheduleCountKey(kind string, blockNumber uint64) common.Hash {
+	return crypto.Keccak256Hash([]byte(kind), uint64Bytes(blockNumber))
+}
+
+func scheduleItemKey(kind string, blockNumber uint64, index uint64) common.Hash {
+	return crypto.Keccak256Hash([]byte(kind), uint64Bytes(blockNumber), uint64Bytes(index))
+}
+
+const (
+	scheduleEnding    = "ending"
+	scheduleEffective = "effective"
+)
+
+func getUint64(db StateDB, key common.Hash) uint64 {
+	return db.GetState(GOVERNANCE_CONTRACT_ADDRESS, key).Big().Uint64()
+}
+
+func setUint64(db StateDB, key common.Hash, v uint64) {
+	db.SetState(GOVERNANCE_CONTRACT_ADDRESS, key, common.BigToHash(new(big.Int).SetUint64(v)))
+}
+
+func getBig(db StateDB, key common.Hash) *big.Int {
+	return db.GetState(GOVERNANCE_CONTRACT_ADDRESS, key).Big()
+}
+
+func setBig(db StateDB, key common.Hash, v *big.Int) {
+	db.SetState(GOVERNANCE_CONTRACT_ADDRESS, key, common.BigToHash(v))
+}
+
+// Initialize seeds the parameter storage with the values that were in effect before governance
+// was activated. The nonce is set so that the account is not removed as empty.
+func Initialize(db StateDB, defaults map[Parameter]*big.Int) error {
+	for _, p := range Parameters() {
+		value, ok := defaults[p]
+		if ok == false {
+			return ErrUnknownParameter
+		}
+		if err := ValidateParameter(p, value); err != nil {
+			return err
+		}
+		setBig(db, parameterKey(p), value)
+	}
+	if db.GetNonce(GOVERNANCE_CONTRACT_ADDRESS) == 0 {
+		db.SetNonce(GOVERNANCE_CONTRACT_ADDRESS, 1)
+	}
+	setUint64(db, initializedKey, 1)
+	return nil
+}
+
+func IsInitialized(db StateDB) bool {
+	return getUint64(db, initializedKey) == 1
+}
+
+func GetParameter(db StateDB, parameter Parameter) (*big.Int, error) {
+	if IsInitialized(db) == false {
+		return nil, ErrNotInitialized
+	}
+	if _, ok := parameterRanges[parameter]; ok == false {
+		return nil, ErrUnknownParameter
+	}
+	return getBig(db, parameterKey(parameter)), nil
+}
+
+func GetParameters(db StateDB) (map[Parameter]*big.Int, error) {
+	values := make(map[Parameter]*big.Int)
+	for _, p := range Parameters() {
+		v, err := GetParameter(db, p)
+		if err != nil {
+			return nil, err
+		}
+		values[p] = v
+	}
+	return values, nil
+}
+
+func GetProposalCount(db StateDB) uint64 {
+	return getUint64(db, proposalCountKey)
+}
+
+func GetProposal(db StateDB, id uint64) (*Proposal, error) {
+	if id == 0 || id > GetProposalCount(db) {
+		return nil, ErrUnknownProposal
+	}
+	return &Proposal{
+		Id:             id,
+		Proposer:       common.BytesToAddress(db.GetState(GOVERNANCE_CONTRACT_ADDRESS, proposalKey(id, proposalFieldProposer)).Bytes()),
+		Parameter:      Parameter(getUint64(db, proposalKey(id, proposalFieldParameter))),
+		Value:          getBig(db, proposalKey(id, proposalFieldValue)),
+		StartBlock:     getUint64(db, proposalKey(id, proposalFieldStartBlock)),
+		EndBlock:       getUint64(db, proposalKey(id, proposalFieldEndBlock)),
+		EffectiveBlock: getUint64(db, proposalKey(id, proposalFieldEffectiveBlock)),
+		Status:         ProposalStatus(getUint64(db, proposalKey(id, proposalFieldStatus))),
+		VoterCount:     getUint64(db, proposalKey(id, proposalFieldVoterCount)),
+		YesWeight:      getBig(db, proposalKey(id, proposalFieldYesWeight)),
+		NoWeight:       getBig(db, proposalKey(id, proposalFieldNoWeight)),
+	}, nil
+}
+
+func GetVoters(db StateDB, id uint64) ([]common.Address, error) {
+	proposal, err := GetProposal(db, id)
+	if err != nil {
+		return nil, err
+	}
+	voters := make([]common.Address, proposal.VoterCount)
+	for i := uint64(0); i < proposal.VoterCount; i++ {
+		voters[i] = common.BytesToAddress(db.GetState(GOVERNANCE_CONTRACT_ADDRESS, voterKey(id, i)).Bytes())
+	}
+	return voters, nil
+}
+
+func GetVote(db StateDB, id uint64, voter common.Address) uint64 {
+	return getUint64(db, voteKey(id, voter))
+}
+
+func addToSchedule(db StateDB, kind string, blockNumber uint64, id uint64) {
+	countKey := scheduleCountKey(kind, blockNumber)
+	count := getUint64(db, countKey)
+	setUint64(db, scheduleItemKey(kind, blockNumber, count), id)
+	setUint64(db, countKey, count+1)
+}
+
+func getSchedule(db StateDB, kind string, blockNumber uint64) []uint64 {
+	count := getUint64(db, scheduleCountKey(kind, blockNumber))
+	ids := make([]uint64, count)
+	for i := uint64(0); i < count; i++ {
+		ids[i] = getUint64(db, scheduleItemKey(kind, blockNumber, i))
+	}
+	return ids
+}
+
+func isDepositor(stake StakeReader, address common.Address) (bool, error) {
+	balance, err := stake.GetBalanceOfDepositor(address)
+	if err != nil {
+		return false, err
+	}
+	return balance != nil && balance.Sign() > 0, nil
+}
+
+// Propose records a parameter change proposal. Voting starts in the current block and ends
+// VOTING_PERIOD_BLOCKS later; effectiveBlock is when the change is applied if it passes.
+func Propose(db StateDB, stake StakeReader, proposer common.Address, parameter Parameter, value *big.Int,
+	effectiveBlock uint64, blockNumber uint64) (uint64, error) {
+	if IsInitialized(db) == false {
+		return 0, ErrNotInitialized
+	}
+	if err := ValidateParameter(parameter, value); err != nil {
+		return 0, err
+	}
+	endBlock := blockNumber + VOTING_PERIOD_BLOCKS
+	if effectiveBlock < endBlock+MIN_EXECUTION_DELAY_BLOCKS || effectiveBlock > endBlock+MAX_EXECUTION_DELAY_BLOCKS {
+		return 0, ErrInvalidEffectiveBlock
+	}
+	ok, err := isDepositor(stake, proposer)
+	if err != nil {
+		return 0, err
+	}
+	if ok == false {
+		return 0, ErrNotDepositor
+	}
+	openProposals := getUint64(db, openProposalsKey(proposer))
+	if openProposals >= MAX_OPEN_PROPOSALS_PER_PROPOSER {
+		return 0, ErrTooManyOpenProposals
+	}
+	setUint64(db, openProposalsKey(proposer), openProposals+1)
+
+	id := GetProposalCount(db) + 1
+	setUint64(db, proposalCountKey, id)
+
+	db.SetState(GOVERNANCE_CONTRACT_ADDRESS, proposalKey(id, proposalFieldProposer), proposer.Hash())
+	setUint64(db, proposalKey(id, proposalFieldParameter), uint64(parameter))
+	setBig(db, proposalKey(id, proposalFieldValue), value)
+	setUint64(db, proposalKey(id, proposalFieldStartBlock), blockNumber)
+	setUint64(db, proposalKey(id, proposalFieldEndBlock), endBlock)
+	setUint64(db, proposalKey(id, proposalFieldEffectiveBlock), effectiveBlock)
+	setUint64(db, proposalKey(id, proposalFieldStatus), uint64(PROPOSAL_STATUS_VOTING))
+	addToSchedule(db, scheduleEnding, endBlock, id)
+
+	return id, nil
+}
+
+// Vote records the vote of a depositor. The weight is not fixed at this point; it is computed
+// from the staking balance of each voter when the proposal is tallied.
+func Vote(db StateDB, stake StakeReader, voter common.Address, id uint64, support bool, blockNumber uint64) error {
+	proposal, err := GetProposal(db, id)
+	if err != nil {
+		return err
+	}
+	if proposal.Status != PROPOSAL_STATUS_VOTING || blockNumber > proposal.EndBlock {
+		return ErrVotingClosed
+	}
+	if GetVote(db, id, voter) != VOTE_NONE {
+		return ErrAlreadyVoted
+	}
+	ok, err := isDepositor(stake, voter)
+	if err != nil {
+		return err
+	}
+	if ok == false {
+		return ErrNotDepositor
+	}
+
+	vote := VOTE_NO
+	if support {
+		vote = VOTE_YES
+	}
+	setUint64(db, voteKey(id, voter), vote)
+	db.SetState(GOVERNANCE_CONTRACT_ADDRESS, voterKey(id, proposal.VoterCount), voter.Hash())
+	setUint64(db, proposalKey(id, proposalFieldVoterCount), proposal.VoterCount+1)
+
+	return nil
+}
+
+// TallyProposal weighs every vote of the proposal by the current staking balance of the voter.
+// It is not bounded, and is meant for previewing the result of a proposal off chain.
+func TallyProposal(db StateDB, stake StakeReader, id uint64) (*Tally, error) {
+	voters, err := GetVoters(db, id)
+	if err != nil {
+		return nil, err
+	}
+	total, err := stake.GetTotalDepositedBalance()
+	if err != nil {
+		return nil, err
+	}
+
+	tally := &Tally{
+		YesWeight:             big.NewInt(0),
+		NoWeight:              big.NewInt(0),
+		TotalDepositedBalance: total,
+	}
+	for _, voter := range voters {
+		balance, err := stake.GetBalanceOfDepositor(voter)
+		if err != nil {
+			return nil, err
+		}
+		if balance == nil {
+			continue
+		}
+		if GetVote(db, id, voter) == VOTE_YES {
+			tally.YesWeight = common.SafeAddBigInt(tally.YesWeight, balance)
+		} else {
+			tally.NoWeight = common.SafeAddBigInt(tally.NoWeight, balance)
+		}
+	}
+
+	tally.count()
+
+	return tally, nil
+}
+
+// count decides the result of the tally from the weights.
+func (tally *Tally) count() {
+	voted := common.SafeAddBigInt(tally.YesWeight, tally.NoWeight)
+	tally.QuorumReached = tally.TotalDepositedBalance.Sign() > 0 &&
+		new(big.Int).Mul(voted, big.NewInt(100)).Cmp(new(big.Int).Mul(tally.TotalDepositedBalance, big.NewInt(QUORUM_PERCENTAGE))) >= 0
+	tally.Passed = tally.QuorumReached &&
+		new(big.Int).Mul(tally.YesWeight, big.NewInt(100)).Cmp(new(big.Int).Mul(voted, big.NewInt(PASS_PERCENTAGE))) >= 0
+}
+
+// GetTallyQueue returns the ids of the proposals whose voting ended, in the order they are tallied.
+func GetTallyQueue(db StateDB) []uint64 {
+	head, tail := getUint64(db, tallyHeadKey), getUint64(db, tallyTailKey)
+	ids := make([]uint64, 0, tail-head)
+	for i := head; i < tail; i++ {
+		ids = append(ids, getUint64(db, tallyItemKey(i)))
+	}
+	return ids
+}
+
+// tallyVotes weighs up to limit votes of the proposal at the head of the tally queue, adding them
+// to the weights stored with the proposal. It returns the number of votes weighed and whether all
+// votes of the proposal were weighed.
+func tallyVotes(db StateDB, stake StakeReader, id uint64, limit uint64) (uint64, bool, error) {
+	voterCount := getUint64(db, proposalKey(id, proposalFieldVoterCount))
+	tallied := getUint64(db, proposalKey(id, proposalFieldTalliedCount))
+	yesWeight := getBig(db, proposalKey(id, proposalFieldYesWeight))
+	noWeight := getBig(db, proposalKey(id, proposalFieldNoWeight))
+
+	count := uint64(0)
+	for ; tallied < voterCount && count < limit; tallied, count = tallied+1, count+1 {
+		voter := common.BytesToAddress(db.GetState(GOVERNANCE_CONTRACT_ADDRESS, voterKey(id, tallied)).Bytes())
+		balance, err := stake.GetBalanceOfDepositor(voter)
+		if err != nil {
+			return 0, false, err
+		}
+		if balance == nil {
+			continue
+		}
+		if GetVote(db, id, voter) == VOTE_YES {
+			yesWeight = common.SafeAddBigInt(yesWeight, balance)
+		} else {
+			noWeight = common.SafeAddBigInt(noWeight, balance)
+		}
+	}
+
+	setBig(db, proposalKey(id, proposalFieldYesWeight), yesWeight)
+	setBig(db, proposalKey(id, proposalFieldNoWeight), noWeight)
+	setUint64(db, proposalKey(id, proposalFieldTalliedCount), tallied)
+	return count, tallied == voterCount, nil
+}
+
+// closeProposal decides a proposal once all its votes were weighed. A passed proposal is applied
+// at its effective block, or in the current block if the tally completed after it.
+func closeProposal(db StateDB, id uint64, total *big.Int, blockNumber uint64) error {
+	proposal, err := GetProposal(db, id)
+	if err != nil {
+		return err
+	}
+	tally := &Tally{
+		YesWeight:             proposal.YesWeight,
+		NoWeight:              proposal.NoWeight,
+		TotalDepositedBalance: total,
+	}
+	tally.count()
+
+	if tally.Passed {
+		setUint64(db, proposalKey(id, proposalFieldStatus), uint64(PROPOSAL_STATUS_PASSED))
+		effectiveBlock := proposal.EffectiveBlock
+		if effectiveBlock < blockNumber {
+			effectiveBlock = blockNumber
+		}
+		addToSchedule(db, scheduleEffective, effectiveBlock, id)
+	} else {
+		setUint64(db, proposalKey(id, proposalFieldStatus), uint64(PROPOSAL_STATUS_REJECTED))
+	}
+
+	openProposals := getUint64(db, openProposalsKey(proposal.Proposer))
+	if openProposals > 0 {
+		setUint64(db, openProposalsKey(proposal.Proposer), openProposals-1)
+	}
+	return nil
+}
+
+// ProcessBlock queues the proposals whose voting ends in the block for tallying, weighs up to
+// MAX_TALLY_VOTES_PER_BLOCK votes of the queued proposals, closing those that were fully tallied,
+// and applies passed proposals that are scheduled for the block. It returns the proposals that
+// were applied. The weight of a vote is the staking balance of the voter at the block it is weighed.
+func ProcessBlock(db StateDB, stake StakeReader, blockNumber uint64) ([]*Proposal, error) {
+	if IsInitialized(db) == false {
+		return nil, nil
+	}
+
+	tail := getUint64(db, tallyTailKey)
+	for _, id := range getSchedule(db, scheduleEnding, blockNumber) {
+		setUint64(db, proposalKey(id, proposalFieldStatus), uint64(PROPOSAL_STATUS_TALLYING))
+		setUint64(db, tallyItemKey(tail), id)
+		tail++
+	}
+	setUint64(db, tallyTailKey, tail)
+
+	var total *big.Int
+	budget := MAX_TALLY_VOTES_PER_BLOCK
+	for head := getUint64(db, tallyHeadKey); head < tail; head++ {
+		id := getUint64(db, tallyItemKey(head))
+		count, done, err := tallyVotes(db, stake, id, budget)
+		if err != nil {
+			return nil, err
+		}
+		budget -= count
+		if done == false {
+			break
+		}
+		if total == nil {
+			total, err = stake.GetTotalDepositedBalance()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err = closeProposal(db, id, total, blockNumber); err != nil {
+			return nil, err
+		}
+		setUint64(db, tallyHeadKey, head+1)
+	}
+
+	var applied []*Proposal
+	for _, id := range getSchedule(db, scheduleEffective, blockNumber) {
+		proposal, err := GetProposal(db, id)
+		if err != nil {
+			return nil, err
+		}
+		if proposal.Status != PROPOSAL_STATUS_PASSED {
+			continue
+		}
+		setBig(db, parameterKey(proposal.Parameter), proposal.Value)
+		setUint64(db, proposalKey(id, proposalFieldStatus), uint64(PROPOSAL_STATUS_APPLIED))
+		proposal.Status = PROPOSAL_STATUS_APPLIED
+		applied = append(applied, proposal)
+	}
+
+	return applied, nil
+}
+
+// ProcessTransaction applies the ABI encoded call data of a transaction sent to the governance
+// contract address.
+func ProcessTransaction(db StateDB, stake StakeReader, from common.Address, data []byte, blockNumber uint64) error {
+	if len(data) < 4 {
+		return ErrUnknownMethod
+	}
+	abiData, err := GetGovernanceContract_ABI()
+	if err != nil {
+		return err
+	}
+	method, err := abiData.MethodById(data[:4])
+	if err != nil {
+		return ErrUnknownMethod
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return err
+	}
+
+	switch method.Name {
+	case PROPOSE_METHOD:
+		effectiveBlock := args[2].(*big.Int)
+		if effectiveBlock.IsUint64() == false {
+			return ErrInvalidEffectiveBlock
+		}
+		_, err = Propose(db, stake, from, Parameter(args[0].(uint8)), args[1].(*big.Int), effectiveBlock.Uint64(), blockNumber)
+		return err
+	case VOTE_METHOD:
+		id := args[0].(*big.Int)
+		if id.IsUint64() == false {
+			return ErrUnknownProposal
+		}
+		return Vote(db, stake, from, id.Uint64(), args[1].(bool), blockNumber)
+	}
+
+	return ErrUnknownMethod
+}
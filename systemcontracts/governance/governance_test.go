@@ -0,0 +1,350 @@
+package governance
+
+import (
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/core/state"
+	"github.com/QuantumCoinProject/qc/core/types"
+	"github.com/QuantumCoinProject/qc/params"
+	"math/big"
+	"testing"
+)
+
+type testStake struct {
+	balances map[common.Address]*big.Int
+}
+
+func (s *testStake) GetBalanceOfDepositor(depositor common.Address) (*big.Int, error) {
+	balance, ok := s.balances[depositor]
+	if ok == false {
+		return big.NewInt(0), nil
+	}
+	return balance, nil
+}
+
+func (s *testStake) GetTotalDepositedBalance() (*big.Int, error) {
+	total := big.NewInt(0)
+	for _, balance := range s.balances {
+		total.Add(total, balance)
+	}
+	return total, nil
+}
+
+var (
+	depositor1 = common.HexToAddress("0x0000000000000000000000000000000000000000000000000000000000000001")
+	depositor2 = common.HexToAddress("0x0000000000000000000000000000000000000000000000000000000000000002")
+	depositor3 = common.HexToAddress("0x0000000000000000000000000000000000000000000000000000000000000003")
+	outsider   = common.HexToAddress("0x0000000000000000000000000000000000000000000000000000000000000009")
+)
+
+func newTestStake() *testStake {
+	return &testStake{balances: map[common.Address]*big.Int{
+		depositor1: params.EtherToWei(big.NewInt(5000000)),
+		depositor2: params.EtherToWei(big.NewInt(3000000)),
+		depositor3: params.EtherToWei(big.NewInt(2000000)),
+	}}
+}
+
+func newGovernanceStateDb(t *testing.T) *state.StateDB {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	err := Initialize(statedb, map[Parameter]*big.Int{
+		PARAMETER_SLASH_AMOUNT:                 params.EtherToWei(big.NewInt(100)),
+		PARAMETER_TXN_FEE_REWARDS_PERCENTAGE:   big.NewInt(50),
+		PARAMETER_GAS_TIER_PRICE:               types.GAS_TIER_DEFAULT_PRICE,
+		PARAMETER_CONVERSION_DEADLINE_BLOCK:    big.NewInt(0),
+		PARAMETER_CONVERSION_UNCLAIMED_ADDRESS: big.NewInt(0),
+	})
+	if err != nil {
+		t.Fatalf("Initialize failed %v", err)
+	}
+	statedb.Finalise(true)
+	return statedb
+}
+
+func TestGovernance_Initialize(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if IsInitialized(statedb) {
+		t.Fatalf("failed")
+	}
+	if _, err := GetParameter(statedb, PARAMETER_SLASH_AMOUNT); err != ErrNotInitialized {
+		t.Fatalf("failed %v", err)
+	}
+
+	statedb = newGovernanceStateDb(t)
+	if IsInitialized(statedb) == false {
+		t.Fatalf("failed")
+	}
+	if statedb.Exist(GOVERNANCE_CONTRACT_ADDRESS) == false {
+		t.Fatalf("governance account was removed as empty")
+	}
+	value, err := GetParameter(statedb, PARAMETER_TXN_FEE_REWARDS_PERCENTAGE)
+	if err != nil || value.Cmp(big.NewInt(50)) != 0 {
+		t.Fatalf("failed %v %v", value, err)
+	}
+}
+
+func TestGovernance_ProposeValidation(t *testing.T) {
+	statedb := newGovernanceStateDb(t)
+	stake := newTestStake()
+	blockNumber := uint64(100)
+	effectiveBlock := blockNumber + VOTING_PERIOD_BLOCKS + MIN_EXECUTION_DELAY_BLOCKS
+
+	_, err := Propose(statedb, stake, depositor1, PARAMETER_TXN_FEE_REWARDS_PERCENTAGE, big.NewInt(101), effectiveBlock, blockNumber)
+	if err != ErrParameterOutOfRange {
+		t.Fatalf("failed %v", err)
+	}
+	_, err = Propose(statedb, stake, depositor1, Parameter(99), big.NewInt(1), effectiveBlock, blockNumber)
+	if err != ErrUnknownParameter {
+		t.Fatalf("failed %v", err)
+	}
+	_, err = Propose(statedb, stake, depositor1, PARAMETER_TXN_FEE_REWARDS_PERCENTAGE, big.NewInt(60), effectiveBlock-1, blockNumber)
+	if err != ErrInvalidEffectiveBlock {
+		t.Fatalf("failed %v", err)
+	}
+	_, err = Propose(statedb, stake, outsider, PARAMETER_TXN_FEE_REWARDS_PERCENTAGE, big.NewInt(60), effectiveBlock, blockNumber)
+	if err != ErrNotDepositor {
+		t.Fatalf("failed %v", err)
+	}
+
+	id, err := Propose(statedb, stake, depositor1, PARAMETER_TXN_FEE_REWARDS_PERCENTAGE, big.NewInt(60), effectiveBlock, blockNumber)
+	if err != nil || id != 1 {
+		t.Fatalf("failed %v %v", id, err)
+	}
+	proposal, err := GetProposal(statedb, id)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if proposal.Proposer.IsEqualTo(depositor1) == false || proposal.Status != PROPOSAL_STATUS_VOTING ||
+		proposal.EndBlock != blockNumber+VOTING_PERIOD_BLOCKS || proposal.EffectiveBlock != effectiveBlock ||
+		proposal.Value.Cmp(big.NewInt(60)) != 0 {
+		t.Fatalf("failed %v", proposal)
+	}
+}
+
+func TestGovernance_VotePassAndApply(t *testing.T) {
+	statedb := newGovernanceStateDb(t)
+	stake := newTestStake()
+	blockNumber := uint64(100)
+	effectiveBlock := blockNumber + VOTING_PERIOD_BLOCKS + MIN_EXECUTION_DELAY_BLOCKS
+
+	id, err := Propose(statedb, stake, depositor1, PARAMETER_TXN_FEE_REWARDS_PERCENTAGE, big.NewInt(60), effectiveBlock, blockNumber)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	if err = Vote(statedb, stake, depositor1, id, true, blockNumber+1); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if err = Vote(statedb, stake, depositor1, id, false, blockNumber+2); err != ErrAlreadyVoted {
+		t.Fatalf("failed %v", err)
+	}
+	if err = Vote(statedb, stake, outsider, id, true, blockNumber+2); err != ErrNotDepositor {
+		t.Fatalf("failed %v", err)
+	}
+	if err = Vote(statedb, stake, depositor3, id, false, blockNumber+3); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if err = Vote(statedb, stake, depositor2, id, true, blockNumber+VOTING_PERIOD_BLOCKS+1); err != ErrVotingClosed {
+		t.Fatalf("failed %v", err)
+	}
+
+	tally, err := TallyProposal(statedb, stake, id)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if tally.QuorumReached == false || tally.Passed == false {
+		t.Fatalf("failed %v", tally)
+	}
+
+	applied, err := ProcessBlock(statedb, stake, blockNumber+VOTING_PERIOD_BLOCKS)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("failed %v %v", applied, err)
+	}
+	proposal, _ := GetProposal(statedb, id)
+	if proposal.Status != PROPOSAL_STATUS_PASSED || proposal.YesWeight.Cmp(stake.balances[depositor1]) != 0 {
+		t.Fatalf("failed %v", proposal)
+	}
+
+	value, _ := GetParameter(statedb, PARAMETER_TXN_FEE_REWARDS_PERCENTAGE)
+	if value.Cmp(big.NewInt(50)) != 0 {
+		t.Fatalf("parameter changed before effective block %v", value)
+	}
+
+	applied, err = ProcessBlock(statedb, stake, effectiveBlock)
+	if err != nil || len(applied) != 1 || applied[0].Id != id {
+		t.Fatalf("failed %v %v", applied, err)
+	}
+	value, _ = GetParameter(statedb, PARAMETER_TXN_FEE_REWARDS_PERCENTAGE)
+	if value.Cmp(big.NewInt(60)) != 0 {
+		t.Fatalf("failed %v", value)
+	}
+	proposal, _ = GetProposal(statedb, id)
+	if proposal.Status != PROPOSAL_STATUS_APPLIED {
+		t.Fatalf("failed %v", proposal)
+	}
+}
+
+func TestGovernance_Reject(t *testing.T) {
+	statedb := newGovernanceStateDb(t)
+	stake := newTestStake()
+	blockNumber := uint64(100)
+	effectiveBlock := blockNumber + VOTING_PERIOD_BLOCKS + MIN_EXECUTION_DELAY_BLOCKS
+
+	//No quorum
+	id1, _ := Propose(statedb, stake, depositor3, PARAMETER_SLASH_AMOUNT, params.EtherToWei(big.NewInt(50)), effectiveBlock, blockNumber)
+	//Not enough yes votes
+	id2, _ := Propose(statedb, stake, depositor3, PARAMETER_SLASH_AMOUNT, params.EtherToWei(big.NewInt(60)), effectiveBlock, blockNumber)
+
+	if err := Vote(statedb, stake, depositor3, id1, true, blockNumber); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if err := Vote(statedb, stake, depositor1, id2, false, blockNumber); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if err := Vote(statedb, stake, depositor2, id2, true, blockNumber); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	if _, err := ProcessBlock(statedb, stake, blockNumber+VOTING_PERIOD_BLOCKS); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	for _, id := range []uint64{id1, id2} {
+		proposal, _ := GetProposal(statedb, id)
+		if proposal.Status != PROPOSAL_STATUS_REJECTED {
+			t.Fatalf("failed %v", proposal)
+		}
+	}
+
+	applied, err := ProcessBlock(statedb, stake, effectiveBlock)
+	if err != nil || len(applied) != 0 {
+		t.Fatalf("failed %v %v", applied, err)
+	}
+	value, _ := GetParameter(statedb, PARAMETER_SLASH_AMOUNT)
+	if value.Cmp(params.EtherToWei(big.NewInt(100))) != 0 {
+		t.Fatalf("failed %v", value)
+	}
+}
+
+func TestGovernance_OpenProposalLimit(t *testing.T) {
+	statedb := newGovernanceStateDb(t)
+	stake := newTestStake()
+	blockNumber := uint64(100)
+	effectiveBlock := blockNumber + VOTING_PERIOD_BLOCKS + MIN_EXECUTION_DELAY_BLOCKS
+
+	for i := uint64(0); i < MAX_OPEN_PROPOSALS_PER_PROPOSER; i++ {
+		if _, err := Propose(statedb, stake, depositor1, PARAMETER_SLASH_AMOUNT, big.NewInt(1), effectiveBlock, blockNumber); err != nil {
+			t.Fatalf("failed %v", err)
+		}
+	}
+	_, err := Propose(statedb, stake, depositor1, PARAMETER_SLASH_AMOUNT, big.NewInt(1), effectiveBlock, blockNumber)
+	if err != ErrTooManyOpenProposals {
+		t.Fatalf("failed %v", err)
+	}
+	if _, err = Propose(statedb, stake, depositor2, PARAMETER_SLASH_AMOUNT, big.NewInt(1), effectiveBlock, blockNumber); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	//Proposals are open until they are tallied
+	if _, err = ProcessBlock(statedb, stake, blockNumber+VOTING_PERIOD_BLOCKS); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	blockNumber = blockNumber + VOTING_PERIOD_BLOCKS + 1
+	if _, err = Propose(statedb, stake, depositor1, PARAMETER_SLASH_AMOUNT, big.NewInt(1), blockNumber+VOTING_PERIOD_BLOCKS+MIN_EXECUTION_DELAY_BLOCKS, blockNumber); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+}
+
+func TestGovernance_BoundedTally(t *testing.T) {
+	maxVotes := MAX_TALLY_VOTES_PER_BLOCK
+	MAX_TALLY_VOTES_PER_BLOCK = 2
+	defer func() {
+		MAX_TALLY_VOTES_PER_BLOCK = maxVotes
+	}()
+
+	statedb := newGovernanceStateDb(t)
+	stake := newTestStake()
+	blockNumber := uint64(100)
+	endBlock := blockNumber + VOTING_PERIOD_BLOCKS
+	effectiveBlock := endBlock + MIN_EXECUTION_DELAY_BLOCKS
+
+	id1, _ := Propose(statedb, stake, depositor1, PARAMETER_TXN_FEE_REWARDS_PERCENTAGE, big.NewInt(60), effectiveBlock, blockNumber)
+	id2, _ := Propose(statedb, stake, depositor2, PARAMETER_TXN_FEE_REWARDS_PERCENTAGE, big.NewInt(70), effectiveBlock, blockNumber)
+	for _, voter := range []common.Address{depositor1, depositor2, depositor3} {
+		if err := Vote(statedb, stake, voter, id1, true, blockNumber); err != nil {
+			t.Fatalf("failed %v", err)
+		}
+		if err := Vote(statedb, stake, voter, id2, false, blockNumber); err != nil {
+			t.Fatalf("failed %v", err)
+		}
+	}
+
+	//Two votes of the first proposal are weighed in the block its voting ends
+	if _, err := ProcessBlock(statedb, stake, endBlock); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	proposal, _ := GetProposal(statedb, id1)
+	want := new(big.Int).Add(stake.balances[depositor1], stake.balances[depositor2])
+	if proposal.Status != PROPOSAL_STATUS_TALLYING || proposal.YesWeight.Cmp(want) != 0 {
+		t.Fatalf("failed %v", proposal)
+	}
+	if queue := GetTallyQueue(statedb); len(queue) != 2 || queue[0] != id1 || queue[1] != id2 {
+		t.Fatalf("failed %v", queue)
+	}
+
+	//The first proposal is closed with its last vote, and the remaining budget goes to the second
+	if _, err := ProcessBlock(statedb, stake, endBlock+1); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	proposal, _ = GetProposal(statedb, id1)
+	if proposal.Status != PROPOSAL_STATUS_PASSED || proposal.YesWeight.Cmp(params.EtherToWei(big.NewInt(10000000))) != 0 {
+		t.Fatalf("failed %v", proposal)
+	}
+	proposal, _ = GetProposal(statedb, id2)
+	if proposal.Status != PROPOSAL_STATUS_TALLYING || proposal.NoWeight.Cmp(stake.balances[depositor1]) != 0 {
+		t.Fatalf("failed %v", proposal)
+	}
+
+	if _, err := ProcessBlock(statedb, stake, endBlock+2); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	proposal, _ = GetProposal(statedb, id2)
+	if proposal.Status != PROPOSAL_STATUS_REJECTED {
+		t.Fatalf("failed %v", proposal)
+	}
+	if queue := GetTallyQueue(statedb); len(queue) != 0 {
+		t.Fatalf("failed %v", queue)
+	}
+}
+
+func TestGovernance_ProcessTransaction(t *testing.T) {
+	statedb := newGovernanceStateDb(t)
+	stake := newTestStake()
+	blockNumber := uint64(100)
+	effectiveBlock := blockNumber + VOTING_PERIOD_BLOCKS + MIN_EXECUTION_DELAY_BLOCKS
+
+	data, err := PackPropose(PARAMETER_GAS_TIER_PRICE, big.NewInt(1000), effectiveBlock)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if err = ProcessTransaction(statedb, stake, depositor2, data, blockNumber); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if GetProposalCount(statedb) != 1 {
+		t.Fatalf("failed")
+	}
+
+	data, err = PackVote(1, true)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if err = ProcessTransaction(statedb, stake, depositor2, data, blockNumber); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if GetVote(statedb, 1, depositor2) != VOTE_YES {
+		t.Fatalf("failed")
+	}
+
+	if err = ProcessTransaction(statedb, stake, depositor2, []byte{1, 2, 3, 4, 5}, blockNumber); err != ErrUnknownMethod {
+		t.Fatalf("failed %v", err)
+	}
+}
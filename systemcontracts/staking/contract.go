@@ -9,11 +9,8 @@ import (
 	"strings"
 )
 
-// Steps after Contract is modified
-// 1) solc --bin --bin-runtime --abi c:\github\quantum-coin-go\systemcontracts\staking\stakingv2\StakingContract.sol  -o c:\github\quantum-coin-go\systemcontracts\staking\stakingv2
-// 2) abigen --bin=c:\github\quantum-coin-go\systemcontracts\staking\stakingv2\StakingContract.bin --abi=c:\github\quantum-coin-go\systemcontracts\staking\stakingv2\StakingContract.abi --pkg=staking --out=c:\github\quantum-coin-go\systemcontracts\staking\stakingv2\staking.go
-// 3) in staking\stakingv2\staking.go, change the package name to just "stakingv2" (instead of "staking") to clear the error
-// 4) copy StakingContract-runtime.bin into stakingbin.go STAKING_RUNTIME_BIN field
+// After the contract is modified, run go generate in systemcontracts/staking/stakingv2 to recompile it and
+// regenerate the Go bindings and the runtime bytecode (see gen.go). stakingv1 is frozen and is not regenerated.
 const STAKING_CONTRACT = "0x0000000000000000000000000000000000000000000000000000000000001000"
 
 var STAKING_CONTRACT_ADDRESS = common.HexToAddress(STAKING_CONTRACT)
@@ -288,3 +285,7 @@ func GetContract_Method_CompletePartialWithdrawal() string {
 func GetContract_Method_GetStakingDetails() string {
 	return "getStakingDetails"
 }
+
+func GetContract_Event_InitiatePartialWithdrawal() string {
+	return "OnInitiatePartialWithdrawal"
+}
@@ -0,0 +1,6 @@
+package stakingv2
+
+// Run go generate in this directory after StakingContract.sol is modified. solc must be on the path.
+//go:generate solc --bin --bin-runtime --abi --overwrite StakingContract.sol -o .
+//go:generate go run ../../../cmd/abigen --bin=StakingContract.bin --abi=StakingContract.abi --pkg=stakingv2 --type=Staking --out=staking.go
+//go:generate go run ../../genbin -bin StakingContract.bin-runtime -pkg stakingv2 -name STAKING_RUNTIME_BIN -out stakingbin.go
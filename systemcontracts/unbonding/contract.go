@@ -0,0 +1,44 @@
+package unbonding
+
+import (
+	"github.com/QuantumCoinProject/qc/accounts/abi"
+	"github.com/QuantumCoinProject/qc/common"
+	"math/big"
+	"strings"
+)
+
+// The unbonding contract has no EVM code. Partial withdrawals initiated in the staking contract are
+// moved into the unbonding queue by the consensus engine in Finalize, and transactions sent to
+// UNBONDING_CONTRACT_ADDRESS are applied to the storage of the contract address.
+const UNBONDING_CONTRACT = "0x0000000000000000000000000000000000000000000000000000000000005000"
+
+var UNBONDING_CONTRACT_ADDRESS = common.HexToAddress(UNBONDING_CONTRACT)
+
+const COMPLETE_METHOD = "completeUnbonding"
+const EXIT_EARLY_METHOD = "exitEarly"
+
+const UNBONDING_ABI = `[
+	{"inputs":[{"internalType":"uint256","name":"trancheId","type":"uint256"}],"name":"completeUnbonding","outputs":[],"stateMutability":"nonpayable","type":"function"},
+	{"inputs":[{"internalType":"uint256","name":"trancheId","type":"uint256"}],"name":"exitEarly","outputs":[],"stateMutability":"nonpayable","type":"function"}
+]`
+
+func GetUnbondingContract_ABI() (abi.ABI, error) {
+	a, err := abi.JSON(strings.NewReader(UNBONDING_ABI))
+	return a, err
+}
+
+func PackComplete(trancheId uint64) ([]byte, error) {
+	abiData, err := GetUnbondingContract_ABI()
+	if err != nil {
+		return nil, err
+	}
+	return abiData.Pack(COMPLETE_METHOD, new(big.Int).SetUint64(trancheId))
+}
+
+func PackExitEarly(trancheId uint64) ([]byte, error) {
+	abiData, err := GetUnbondingContract_ABI()
+	if err != nil {
+		return nil, err
+	}
+	return abiData.Pack(EXIT_EARLY_METHOD, new(big.Int).SetUint64(trancheId))
+}
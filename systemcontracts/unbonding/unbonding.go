@@ -0,0 +1,408 @@
+package unbonding
+
+import (
+	"errors"
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/crypto"
+	"github.com/QuantumCoinProject/qc/systemcontracts/staking"
+	"math"
+	"math/big"
+)
+
+type TrancheStatus uint8
+
+const (
+	TRANCHE_STATUS_NONE        TrancheStatus = 0
+	TRANCHE_STATUS_UNBONDING   TrancheStatus = 1
+	TRANCHE_STATUS_WITHDRAWN   TrancheStatus = 2
+	TRANCHE_STATUS_EXITEDEARLY TrancheStatus = 3
+)
+
+var (
+	//Block from which partial withdrawals go through the unbonding queue, and the unbonding contract accepts transactions
+	UNBONDING_QUEUE_START_BLOCK = uint64(math.MaxUint64) //To be scheduled
+
+	//Delay when no other stake is exiting, same as the WITHDRAWAL_BLOCK_DELAY of the staking contract
+	BASE_DELAY_BLOCKS = uint64(32000)
+	MAX_DELAY_BLOCKS  = uint64(4 * 32000)
+
+	//Percentage of the total deposited balance that, when exiting, scales the delay up to MAX_DELAY_BLOCKS
+	FULL_DELAY_EXIT_PERCENTAGE = int64(10)
+
+	//Penalty burnt when a tranche exits right after it is queued; it reduces linearly to zero at maturity
+	EARLY_EXIT_PENALTY_PERCENTAGE = int64(20)
+)
+
+var (
+	ErrUnknownTranche   = errors.New("unknown unbonding tranche")
+	ErrNotTrancheOwner  = errors.New("tranche belongs to another depositor")
+	ErrTrancheClosed    = errors.New("tranche is already withdrawn")
+	ErrTrancheNotMature = errors.New("tranche maturity block not reached")
+	ErrInvalidAmount    = errors.New("invalid unbonding amount")
+	ErrUnknownMethod    = errors.New("unknown unbonding method")
+	ErrNoFullWithdrawal = errors.New("depositor has no pending full withdrawal")
+)
+
+// StateDB is the subset of the state database the unbonding contract needs.
+type StateDB interface {
+	GetState(common.Address, common.Hash) common.Hash
+	SetState(common.Address, common.Hash, common.Hash)
+	GetNonce(common.Address) uint64
+	SetNonce(common.Address, uint64)
+	GetBalance(common.Address) *big.Int
+	AddBalance(common.Address, *big.Int)
+	SubBalance(common.Address, *big.Int)
+}
+
+type Tranche struct {
+	Id            uint64
+	Depositor     common.Address
+	Amount        *big.Int
+	StartBlock    uint64
+	MaturityBlock uint64
+	Status        TrancheStatus
+}
+
+// Storage slots of the withdrawal state in the stakingv2 contract
+const (
+	stakingValidatorListSlot           = 0
+	stakingDepositorBalancesSlot       = 1
+	stakingTotalDepositedBalanceSlot   = 2
+	stakingValidatorToDepositorSlot    = 8
+	stakingDepositorSlashingsSlot      = 10
+	stakingDepositorRewardsSlot        = 11
+	stakingWithdrawalRequestsSlot      = 12
+	stakingPartialWithdrawalBlockSlot  = 14
+	stakingPartialWithdrawalAmountSlot = 15
+)
+
+// Storage layout of the unbonding contract address
+var (
+	trancheCountKey = common.BytesToHash([]byte("trancheCount"))
+	exitingStakeKey = common.BytesToHash([]byte("exitingStake"))
+)
+
+const (
+	trancheFieldDepositor = iota
+	trancheFieldAmount
+	trancheFieldStartBlock
+	trancheFieldMaturityBlock
+	trancheFieldStatus
+	trancheFieldIndex //position in the list of open tranches of the depositor
+)
+
+func uint64Bytes(v uint64) []byte {
+	return new(big.Int).SetUint64(v).FillBytes(make([]byte, 8))
+}
+
+func trancheKey(id uint64, field int) common.Hash {
+	base := crypto.Keccak256Hash([]byte("tranche"), uint64Bytes(id)).Big()
+	return common.BigToHash(base.Add(base, big.NewInt(int64(field))))
+}
+
+func depositorCountKey(depositor common.Address) common.Hash {
+	return crypto.Keccak256Hash([]byte("depositorCount"), depositor.Bytes())
+}
+
+func depositorTrancheKey(depositor common.Address, index uint64) common.Hash {
+	return crypto.Keccak256Hash([]byte("depositorTranche"), depositor.Bytes(), uint64Bytes(index))
+}
+
+func stakingMappingKey(key common.Address, slot uint64) common.Hash {
+	return crypto.Keccak256Hash(key.Bytes(), common.BigToHash(new(big.Int).SetUint64(slot)).Bytes())
+}
+
+func stakingSlotKey(slot uint64) common.Hash {
+	return common.BigToHash(new(big.Int).SetUint64(slot))
+}
+
+func getUint64(db StateDB, key common.Hash) uint64 {
+	return db.GetState(UNBONDING_CONTRACT_ADDRESS, key).Big().Uint64()
+}
+
+func setUint64(db StateDB, key common.Hash, v uint64) {
+	db.SetState(UNBONDING_CONTRACT_ADDRESS, key, common.BigToHash(new(big.Int).SetUint64(v)))
+}
+
+func getBig(db StateDB, key common.Hash) *big.Int {
+	return db.GetState(UNBONDING_CONTRACT_ADDRESS, key).Big()
+}
+
+func setBig(db StateDB, key common.Hash, v *big.Int) {
+	db.SetState(UNBONDING_CONTRACT_ADDRESS, key, common.BigToHash(v))
+}
+
+// GetExitingStake returns the total amount of all tranches that are still in the queue.
+func GetExitingStake(db StateDB) *big.Int {
+	return getBig(db, exitingStakeKey)
+}
+
+// UnbondingDelay returns the number of blocks a new tranche has to wait. The delay grows linearly
+// from BASE_DELAY_BLOCKS to MAX_DELAY_BLOCKS as the exiting stake grows to FULL_DELAY_EXIT_PERCENTAGE
+// of the total deposited balance.
+func UnbondingDelay(exitingStake *big.Int, totalDepositedBalance *big.Int) uint64 {
+	if exitingStake.Sign() <= 0 {
+		return BASE_DELAY_BLOCKS
+	}
+	fullDelayStake := new(big.Int).Mul(totalDepositedBalance, big.NewInt(FULL_DELAY_EXIT_PERCENTAGE))
+	fullDelayStake.Div(fullDelayStake, big.NewInt(100))
+	if exitingStake.Cmp(fullDelayStake) >= 0 {
+		return MAX_DELAY_BLOCKS
+	}
+	extra := new(big.Int).SetUint64(MAX_DELAY_BLOCKS - BASE_DELAY_BLOCKS)
+	extra.Mul(extra, exitingStake)
+	extra.Div(extra, fullDelayStake)
+	return BASE_DELAY_BLOCKS + extra.Uint64()
+}
+
+// EarlyExitPenalty returns the amount that is burnt when the tranche exits at the given block.
+func EarlyExitPenalty(tranche *Tranche, blockNumber uint64) *big.Int {
+	if blockNumber >= tranche.MaturityBlock || tranche.MaturityBlock <= tranche.StartBlock {
+		return big.NewInt(0)
+	}
+	remaining := new(big.Int).SetUint64(tranche.MaturityBlock - blockNumber)
+	penalty := new(big.Int).Mul(tranche.Amount, big.NewInt(EARLY_EXIT_PENALTY_PERCENTAGE))
+	penalty.Mul(penalty, remaining)
+	penalty.Div(penalty, new(big.Int).SetUint64(100*(tranche.MaturityBlock-tranche.StartBlock)))
+	return penalty
+}
+
+func GetTrancheCount(db StateDB) uint64 {
+	return getUint64(db, trancheCountKey)
+}
+
+func GetTranche(db StateDB, id uint64) (*Tranche, error) {
+	if id == 0 || id > GetTrancheCount(db) {
+		return nil, ErrUnknownTranche
+	}
+	return &Tranche{
+		Id:            id,
+		Depositor:     common.BytesToAddress(db.GetState(UNBONDING_CONTRACT_ADDRESS, trancheKey(id, trancheFieldDepositor)).Bytes()),
+		Amount:        getBig(db, trancheKey(id, trancheFieldAmount)),
+		StartBlock:    getUint64(db, trancheKey(id, trancheFieldStartBlock)),
+		MaturityBlock: getUint64(db, trancheKey(id, trancheFieldMaturityBlock)),
+		Status:        TrancheStatus(getUint64(db, trancheKey(id, trancheFieldStatus))),
+	}, nil
+}
+
+// GetTranches returns the tranches of the depositor that are still unbonding.
+func GetTranches(db StateDB, depositor common.Address) ([]*Tranche, error) {
+	count := getUint64(db, depositorCountKey(depositor))
+	tranches := make([]*Tranche, count)
+	for i := uint64(0); i < count; i++ {
+		tranche, err := GetTranche(db, getUint64(db, depositorTrancheKey(depositor, i)))
+		if err != nil {
+			return nil, err
+		}
+		tranches[i] = tranche
+	}
+	return tranches, nil
+}
+
+// Queue moves a partial withdrawal that was initiated in the staking contract into the unbonding
+// queue. The pending request is removed from the staking contract, so that the depositor can initiate
+// further withdrawals, and the amount is moved from the staking contract to the unbonding contract.
+func Queue(db StateDB, depositor common.Address, amount *big.Int, totalDepositedBalance *big.Int, blockNumber uint64) (*Tranche, error) {
+	if amount == nil || amount.Sign() <= 0 || db.GetBalance(staking.STAKING_CONTRACT_ADDRESS).Cmp(amount) < 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	db.SetState(staking.STAKING_CONTRACT_ADDRESS, stakingMappingKey(depositor, stakingPartialWithdrawalBlockSlot), common.Hash{})
+	db.SetState(staking.STAKING_CONTRACT_ADDRESS, stakingMappingKey(depositor, stakingPartialWithdrawalAmountSlot), common.Hash{})
+	return queueTranche(db, depositor, amount, totalDepositedBalance, blockNumber), nil
+}
+
+// PendingFullWithdrawals returns the depositors with a full withdrawal request in the staking contract.
+// Full withdrawals can no longer be initiated with stakingv2; the requests left from stakingv1 can be
+// found through the list of validators.
+func PendingFullWithdrawals(db StateDB) []common.Address {
+	listLength := db.GetState(staking.STAKING_CONTRACT_ADDRESS, stakingSlotKey(stakingValidatorListSlot)).Big().Uint64()
+	listBase := crypto.Keccak256Hash(stakingSlotKey(stakingValidatorListSlot).Bytes()).Big()
+
+	seen := make(map[common.Address]bool)
+	var depositors []common.Address
+	for i := uint64(0); i < listLength; i++ {
+		validatorKey := common.BigToHash(new(big.Int).Add(listBase, new(big.Int).SetUint64(i)))
+		validator := common.BytesToAddress(db.GetState(staking.STAKING_CONTRACT_ADDRESS, validatorKey).Bytes())
+		depositor := common.BytesToAddress(db.GetState(staking.STAKING_CONTRACT_ADDRESS,
+			stakingMappingKey(validator, stakingValidatorToDepositorSlot)).Bytes())
+		if seen[depositor] {
+			continue
+		}
+		seen[depositor] = true
+		if db.GetState(staking.STAKING_CONTRACT_ADDRESS, stakingMappingKey(depositor, stakingWithdrawalRequestsSlot)) != (common.Hash{}) {
+			depositors = append(depositors, depositor)
+		}
+	}
+	return depositors
+}
+
+// QueueFullWithdrawal moves a full withdrawal request of the staking contract into the unbonding queue.
+// The staking contract state is cleared the same way completeWithdrawal does, and the net balance of the
+// depositor is moved from the staking contract to the unbonding contract.
+func QueueFullWithdrawal(db StateDB, depositor common.Address, totalDepositedBalance *big.Int, blockNumber uint64) (*Tranche, error) {
+	getStaking := func(slot uint64) *big.Int {
+		return db.GetState(staking.STAKING_CONTRACT_ADDRESS, stakingMappingKey(depositor, slot)).Big()
+	}
+	clearStaking := func(slot uint64) {
+		db.SetState(staking.STAKING_CONTRACT_ADDRESS, stakingMappingKey(depositor, slot), common.Hash{})
+	}
+	if getStaking(stakingWithdrawalRequestsSlot).Sign() == 0 {
+		return nil, ErrNoFullWithdrawal
+	}
+
+	balance := common.SafeAddBigInt(getStaking(stakingDepositorBalancesSlot), getStaking(stakingDepositorRewardsSlot))
+	slashings := getStaking(stakingDepositorSlashingsSlot)
+	if balance.Cmp(slashings) <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	netBalance := common.SafeSubBigInt(balance, slashings)
+	totalKey := stakingSlotKey(stakingTotalDepositedBalanceSlot)
+	stakingTotal := db.GetState(staking.STAKING_CONTRACT_ADDRESS, totalKey).Big()
+	if stakingTotal.Cmp(netBalance) < 0 || db.GetBalance(staking.STAKING_CONTRACT_ADDRESS).Cmp(netBalance) < 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	clearStaking(stakingDepositorBalancesSlot)
+	clearStaking(stakingDepositorRewardsSlot)
+	clearStaking(stakingDepositorSlashingsSlot)
+	clearStaking(stakingWithdrawalRequestsSlot)
+	db.SetState(staking.STAKING_CONTRACT_ADDRESS, totalKey, common.BigToHash(common.SafeSubBigInt(stakingTotal, netBalance)))
+	return queueTranche(db, depositor, netBalance, totalDepositedBalance, blockNumber), nil
+}
+
+// queueTranche adds a tranche for an amount that is held by the staking contract.
+func queueTranche(db StateDB, depositor common.Address, amount *big.Int, totalDepositedBalance *big.Int, blockNumber uint64) *Tranche {
+	exitingStake := GetExitingStake(db)
+	tranche := &Tranche{
+		Id:            GetTrancheCount(db) + 1,
+		Depositor:     depositor,
+		Amount:        amount,
+		StartBlock:    blockNumber,
+		MaturityBlock: blockNumber + UnbondingDelay(exitingStake, totalDepositedBalance),
+		Status:        TRANCHE_STATUS_UNBONDING,
+	}
+
+	db.SubBalance(staking.STAKING_CONTRACT_ADDRESS, amount)
+	db.AddBalance(UNBONDING_CONTRACT_ADDRESS, amount)
+	if db.GetNonce(UNBONDING_CONTRACT_ADDRESS) == 0 {
+		db.SetNonce(UNBONDING_CONTRACT_ADDRESS, 1)
+	}
+
+	id := tranche.Id
+	setUint64(db, trancheCountKey, id)
+	db.SetState(UNBONDING_CONTRACT_ADDRESS, trancheKey(id, trancheFieldDepositor), depositor.Hash())
+	setBig(db, trancheKey(id, trancheFieldAmount), amount)
+	setUint64(db, trancheKey(id, trancheFieldStartBlock), tranche.StartBlock)
+	setUint64(db, trancheKey(id, trancheFieldMaturityBlock), tranche.MaturityBlock)
+	setUint64(db, trancheKey(id, trancheFieldStatus), uint64(TRANCHE_STATUS_UNBONDING))
+
+	count := getUint64(db, depositorCountKey(depositor))
+	setUint64(db, depositorTrancheKey(depositor, count), id)
+	setUint64(db, trancheKey(id, trancheFieldIndex), count)
+	setUint64(db, depositorCountKey(depositor), count+1)
+
+	setBig(db, exitingStakeKey, common.SafeAddBigInt(exitingStake, amount))
+
+	return tranche
+}
+
+func openTranche(db StateDB, depositor common.Address, id uint64) (*Tranche, error) {
+	tranche, err := GetTranche(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if tranche.Depositor.IsEqualTo(depositor) == false {
+		return nil, ErrNotTrancheOwner
+	}
+	if tranche.Status != TRANCHE_STATUS_UNBONDING {
+		return nil, ErrTrancheClosed
+	}
+	return tranche, nil
+}
+
+// closeTranche removes the tranche from the open tranches of the depositor, moving the last one into its place.
+func closeTranche(db StateDB, tranche *Tranche, status TrancheStatus) {
+	id := tranche.Id
+	depositor := tranche.Depositor
+	count := getUint64(db, depositorCountKey(depositor))
+	index := getUint64(db, trancheKey(id, trancheFieldIndex))
+	lastId := getUint64(db, depositorTrancheKey(depositor, count-1))
+	setUint64(db, depositorTrancheKey(depositor, index), lastId)
+	setUint64(db, trancheKey(lastId, trancheFieldIndex), index)
+	setUint64(db, depositorTrancheKey(depositor, count-1), 0)
+	setUint64(db, depositorCountKey(depositor), count-1)
+
+	setUint64(db, trancheKey(id, trancheFieldStatus), uint64(status))
+	setBig(db, exitingStakeKey, common.SafeSubBigInt(GetExitingStake(db), tranche.Amount))
+}
+
+// Complete pays out a tranche that has reached its maturity block.
+func Complete(db StateDB, depositor common.Address, id uint64, blockNumber uint64) (*big.Int, error) {
+	tranche, err := openTranche(db, depositor, id)
+	if err != nil {
+		return nil, err
+	}
+	if blockNumber < tranche.MaturityBlock {
+		return nil, ErrTrancheNotMature
+	}
+
+	closeTranche(db, tranche, TRANCHE_STATUS_WITHDRAWN)
+	db.SubBalance(UNBONDING_CONTRACT_ADDRESS, tranche.Amount)
+	db.AddBalance(depositor, tranche.Amount)
+
+	return tranche.Amount, nil
+}
+
+// ExitEarly pays out a tranche before its maturity block; the early exit penalty is burnt.
+func ExitEarly(db StateDB, depositor common.Address, id uint64, blockNumber uint64) (payout *big.Int, penalty *big.Int, err error) {
+	tranche, err := openTranche(db, depositor, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	penalty = EarlyExitPenalty(tranche, blockNumber)
+	payout = common.SafeSubBigInt(tranche.Amount, penalty)
+
+	closeTranche(db, tranche, TRANCHE_STATUS_EXITEDEARLY)
+	db.SubBalance(UNBONDING_CONTRACT_ADDRESS, tranche.Amount)
+	db.AddBalance(depositor, payout)
+	db.AddBalance(common.ZERO_ADDRESS, penalty)
+
+	return payout, penalty, nil
+}
+
+// ProcessTransaction applies the ABI encoded call data of a transaction sent to the unbonding
+// contract address.
+func ProcessTransaction(db StateDB, from common.Address, data []byte, blockNumber uint64) error {
+	if len(data) < 4 {
+		return ErrUnknownMethod
+	}
+	abiData, err := GetUnbondingContract_ABI()
+	if err != nil {
+		return err
+	}
+	method, err := abiData.MethodById(data[:4])
+	if err != nil {
+		return ErrUnknownMethod
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return err
+	}
+	id := args[0].(*big.Int)
+	if id.IsUint64() == false {
+		return ErrUnknownTranche
+	}
+
+	switch method.Name {
+	case COMPLETE_METHOD:
+		_, err = Complete(db, from, id.Uint64(), blockNumber)
+		return err
+	case EXIT_EARLY_METHOD:
+		_, _, err = ExitEarly(db, from, id.Uint64(), blockNumber)
+		return err
+	}
+
+	return ErrUnknownMethod
+}
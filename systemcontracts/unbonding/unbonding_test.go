@@ -0,0 +1,213 @@
+package unbonding
+
+import (
+	"github.com/QuantumCoinProject/qc/common"
+	"github.com/QuantumCoinProject/qc/core/rawdb"
+	"github.com/QuantumCoinProject/qc/core/state"
+	"github.com/QuantumCoinProject/qc/crypto"
+	"github.com/QuantumCoinProject/qc/params"
+	"github.com/QuantumCoinProject/qc/systemcontracts/staking"
+	"math/big"
+	"testing"
+)
+
+var (
+	depositor1 = common.HexToAddress("0x0000000000000000000000000000000000000000000000000000000000000001")
+	depositor2 = common.HexToAddress("0x0000000000000000000000000000000000000000000000000000000000000002")
+
+	totalDeposited = params.EtherToWei(big.NewInt(10000000))
+)
+
+func newUnbondingStateDb() *state.StateDB {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.AddBalance(staking.STAKING_CONTRACT_ADDRESS, totalDeposited)
+	return statedb
+}
+
+func TestUnbondingDelay(t *testing.T) {
+	if d := UnbondingDelay(big.NewInt(0), totalDeposited); d != BASE_DELAY_BLOCKS {
+		t.Fatalf("failed %v", d)
+	}
+	halfFull := params.EtherToWei(big.NewInt(500000)) //5% of total
+	if d := UnbondingDelay(halfFull, totalDeposited); d != BASE_DELAY_BLOCKS+(MAX_DELAY_BLOCKS-BASE_DELAY_BLOCKS)/2 {
+		t.Fatalf("failed %v", d)
+	}
+	if d := UnbondingDelay(totalDeposited, totalDeposited); d != MAX_DELAY_BLOCKS {
+		t.Fatalf("failed %v", d)
+	}
+	if d := UnbondingDelay(big.NewInt(1), big.NewInt(0)); d != MAX_DELAY_BLOCKS {
+		t.Fatalf("failed %v", d)
+	}
+}
+
+func TestUnbonding_QueueAndComplete(t *testing.T) {
+	statedb := newUnbondingStateDb()
+	amount := params.EtherToWei(big.NewInt(500000))
+	blockNumber := uint64(100)
+
+	tranche1, err := Queue(statedb, depositor1, amount, totalDeposited, blockNumber)
+	if err != nil || tranche1.Id != 1 || tranche1.MaturityBlock != blockNumber+BASE_DELAY_BLOCKS {
+		t.Fatalf("failed %v %v", tranche1, err)
+	}
+	tranche2, err := Queue(statedb, depositor1, amount, totalDeposited, blockNumber+1)
+	if err != nil || tranche2.MaturityBlock <= blockNumber+1+BASE_DELAY_BLOCKS {
+		t.Fatalf("delay did not scale with exiting stake %v %v", tranche2, err)
+	}
+	if _, err = Queue(statedb, depositor2, totalDeposited, totalDeposited, blockNumber); err != ErrInvalidAmount {
+		t.Fatalf("failed %v", err)
+	}
+
+	tranches, err := GetTranches(statedb, depositor1)
+	if err != nil || len(tranches) != 2 {
+		t.Fatalf("failed %v %v", tranches, err)
+	}
+	if GetExitingStake(statedb).Cmp(new(big.Int).Mul(amount, big.NewInt(2))) != 0 {
+		t.Fatalf("failed %v", GetExitingStake(statedb))
+	}
+	if statedb.GetBalance(UNBONDING_CONTRACT_ADDRESS).Cmp(GetExitingStake(statedb)) != 0 {
+		t.Fatalf("failed %v", statedb.GetBalance(UNBONDING_CONTRACT_ADDRESS))
+	}
+
+	if _, err = Complete(statedb, depositor1, tranche1.Id, tranche1.MaturityBlock-1); err != ErrTrancheNotMature {
+		t.Fatalf("failed %v", err)
+	}
+	if _, err = Complete(statedb, depositor2, tranche1.Id, tranche1.MaturityBlock); err != ErrNotTrancheOwner {
+		t.Fatalf("failed %v", err)
+	}
+	paid, err := Complete(statedb, depositor1, tranche1.Id, tranche1.MaturityBlock)
+	if err != nil || paid.Cmp(amount) != 0 || statedb.GetBalance(depositor1).Cmp(amount) != 0 {
+		t.Fatalf("failed %v %v", paid, err)
+	}
+	if _, err = Complete(statedb, depositor1, tranche1.Id, tranche1.MaturityBlock); err != ErrTrancheClosed {
+		t.Fatalf("failed %v", err)
+	}
+
+	tranches, _ = GetTranches(statedb, depositor1)
+	if len(tranches) != 1 || tranches[0].Id != tranche2.Id {
+		t.Fatalf("failed %v", tranches)
+	}
+	if GetExitingStake(statedb).Cmp(amount) != 0 {
+		t.Fatalf("failed %v", GetExitingStake(statedb))
+	}
+}
+
+func TestUnbonding_ExitEarly(t *testing.T) {
+	statedb := newUnbondingStateDb()
+	amount := params.EtherToWei(big.NewInt(1000))
+	blockNumber := uint64(100)
+
+	tranche, err := Queue(statedb, depositor1, amount, totalDeposited, blockNumber)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+
+	//Half way through the delay, half of the penalty applies
+	exitBlock := blockNumber + BASE_DELAY_BLOCKS/2
+	payout, penalty, err := ExitEarly(statedb, depositor1, tranche.Id, exitBlock)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	expectedPenalty := params.EtherToWei(big.NewInt(100))
+	if penalty.Cmp(expectedPenalty) != 0 || payout.Cmp(new(big.Int).Sub(amount, expectedPenalty)) != 0 {
+		t.Fatalf("failed %v %v", payout, penalty)
+	}
+	if statedb.GetBalance(common.ZERO_ADDRESS).Cmp(expectedPenalty) != 0 || statedb.GetBalance(UNBONDING_CONTRACT_ADDRESS).Sign() != 0 {
+		t.Fatalf("failed")
+	}
+
+	tranche, _ = GetTranche(statedb, tranche.Id)
+	if tranche.Status != TRANCHE_STATUS_EXITEDEARLY {
+		t.Fatalf("failed %v", tranche)
+	}
+}
+
+func TestUnbonding_ProcessTransaction(t *testing.T) {
+	statedb := newUnbondingStateDb()
+	amount := params.EtherToWei(big.NewInt(1000))
+
+	tranche, _ := Queue(statedb, depositor1, amount, totalDeposited, 100)
+	data, err := PackComplete(tranche.Id)
+	if err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if err = ProcessTransaction(statedb, depositor1, data, 101); err != ErrTrancheNotMature {
+		t.Fatalf("failed %v", err)
+	}
+	if err = ProcessTransaction(statedb, depositor1, data, tranche.MaturityBlock); err != nil {
+		t.Fatalf("failed %v", err)
+	}
+	if err = ProcessTransaction(statedb, depositor1, []byte{1, 2, 3, 4, 5}, 101); err != ErrUnknownMethod {
+		t.Fatalf("failed %v", err)
+	}
+}
+
+// setFullWithdrawalRequest adds the validator of the depositor to the staking contract, with a pending
+// stakingv1 full withdrawal request.
+func setFullWithdrawalRequest(statedb *state.StateDB, validator common.Address, depositor common.Address, balance *big.Int, rewards *big.Int, slashings *big.Int) {
+	listKey := stakingSlotKey(stakingValidatorListSlot)
+	listLength := statedb.GetState(staking.STAKING_CONTRACT_ADDRESS, listKey).Big()
+	listBase := crypto.Keccak256Hash(listKey.Bytes()).Big()
+	statedb.SetState(staking.STAKING_CONTRACT_ADDRESS, common.BigToHash(new(big.Int).Add(listBase, listLength)), validator.Hash())
+	statedb.SetState(staking.STAKING_CONTRACT_ADDRESS, listKey, common.BigToHash(new(big.Int).Add(listLength, big.NewInt(1))))
+
+	statedb.SetState(staking.STAKING_CONTRACT_ADDRESS, stakingMappingKey(validator, stakingValidatorToDepositorSlot), depositor.Hash())
+	statedb.SetState(staking.STAKING_CONTRACT_ADDRESS, stakingMappingKey(depositor, stakingDepositorBalancesSlot), common.BigToHash(balance))
+	statedb.SetState(staking.STAKING_CONTRACT_ADDRESS, stakingMappingKey(depositor, stakingDepositorRewardsSlot), common.BigToHash(rewards))
+	statedb.SetState(staking.STAKING_CONTRACT_ADDRESS, stakingMappingKey(depositor, stakingDepositorSlashingsSlot), common.BigToHash(slashings))
+	statedb.SetState(staking.STAKING_CONTRACT_ADDRESS, stakingMappingKey(depositor, stakingWithdrawalRequestsSlot), common.BigToHash(big.NewInt(50)))
+}
+
+func TestUnbonding_FullAndPartialWithdrawals(t *testing.T) {
+	statedb := newUnbondingStateDb()
+	statedb.SetState(staking.STAKING_CONTRACT_ADDRESS, stakingSlotKey(stakingTotalDepositedBalanceSlot), common.BigToHash(totalDeposited))
+	validator1 := common.HexToAddress("0x0000000000000000000000000000000000000000000000000000000000000101")
+	validator2 := common.HexToAddress("0x0000000000000000000000000000000000000000000000000000000000000102")
+	setFullWithdrawalRequest(statedb, validator1, depositor1, params.EtherToWei(big.NewInt(5000000)), big.NewInt(0), big.NewInt(0))
+	setFullWithdrawalRequest(statedb, validator2, depositor2, params.EtherToWei(big.NewInt(400000)), params.EtherToWei(big.NewInt(200)),
+		params.EtherToWei(big.NewInt(100)))
+	//Only the second depositor has a pending full withdrawal
+	statedb.SetState(staking.STAKING_CONTRACT_ADDRESS, stakingMappingKey(depositor1, stakingWithdrawalRequestsSlot), common.Hash{})
+
+	partialAmount := params.EtherToWei(big.NewInt(500000))
+	partial, err := Queue(statedb, depositor1, partialAmount, totalDeposited, 100)
+	if err != nil || partial.MaturityBlock != 100+BASE_DELAY_BLOCKS {
+		t.Fatalf("failed %v %v", partial, err)
+	}
+
+	depositors := PendingFullWithdrawals(statedb)
+	if len(depositors) != 1 || depositors[0].IsEqualTo(depositor2) == false {
+		t.Fatalf("failed %v", depositors)
+	}
+	if _, err = QueueFullWithdrawal(statedb, depositor1, totalDeposited, 100); err != ErrNoFullWithdrawal {
+		t.Fatalf("failed %v", err)
+	}
+
+	//The full withdrawal waits behind the exiting partial withdrawal, and adds to the exiting stake
+	netBalance := params.EtherToWei(big.NewInt(400100))
+	full, err := QueueFullWithdrawal(statedb, depositor2, totalDeposited, 100)
+	if err != nil || full.Amount.Cmp(netBalance) != 0 || full.MaturityBlock <= partial.MaturityBlock {
+		t.Fatalf("failed %v %v", full, err)
+	}
+	if GetExitingStake(statedb).Cmp(new(big.Int).Add(partialAmount, netBalance)) != 0 {
+		t.Fatalf("failed %v", GetExitingStake(statedb))
+	}
+	if len(PendingFullWithdrawals(statedb)) != 0 {
+		t.Fatalf("failed")
+	}
+	stakingTotal := statedb.GetState(staking.STAKING_CONTRACT_ADDRESS, stakingSlotKey(stakingTotalDepositedBalanceSlot)).Big()
+	if stakingTotal.Cmp(new(big.Int).Sub(totalDeposited, netBalance)) != 0 ||
+		statedb.GetState(staking.STAKING_CONTRACT_ADDRESS, stakingMappingKey(depositor2, stakingDepositorBalancesSlot)) != (common.Hash{}) {
+		t.Fatalf("failed %v", stakingTotal)
+	}
+
+	//A later partial withdrawal waits behind both
+	later, err := Queue(statedb, depositor1, partialAmount, totalDeposited, 100)
+	if err != nil || later.MaturityBlock <= full.MaturityBlock {
+		t.Fatalf("failed %v %v", later, err)
+	}
+
+	paid, err := Complete(statedb, depositor2, full.Id, full.MaturityBlock)
+	if err != nil || paid.Cmp(netBalance) != 0 || statedb.GetBalance(depositor2).Cmp(netBalance) != 0 {
+		t.Fatalf("failed %v %v", paid, err)
+	}
+}